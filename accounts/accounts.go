@@ -39,6 +39,7 @@ const (
 	MimetypeDataWithValidator = "data/validator"
 	MimetypeTypedData         = "data/typed"
 	MimetypeClique            = "application/x-clique-header"
+	MimetypeHmhash            = "application/x-hmhash-header"
 	MimetypeTextPlain         = "text/plain"
 )
 
@@ -67,8 +67,26 @@ var (
 		utils.OverrideShanghai,
 		utils.EnablePersonal,
 		utils.EthashCacheDirFlag,
+		utils.EthashCachesInMemoryFlag,
+		utils.EthashCachesOnDiskFlag,
 		utils.EthashCachesLockMmapFlag,
+		utils.EthashDatasetDirFlag,
+		utils.EthashDatasetsInMemoryFlag,
+		utils.EthashDatasetsOnDiskFlag,
 		utils.EthashDatasetsLockMmapFlag,
+		utils.EthashDatasetFractionFlag,
+		utils.EthashNUMAFlag,
+		utils.EthashPregenerationDistanceFlag,
+		utils.EthashSealCacheSizeFlag,
+		utils.EthashMaxReorgDepthFlag,
+		utils.EthashReorgAlertDepthFlag,
+		utils.EthashForkRuleWindowFlag,
+		utils.EthashForkRuleThresholdFlag,
+		utils.EthashDiagnosticsDirFlag,
+		utils.EthashCheckpointPeersFlag,
+		utils.EthashRecordingsDirFlag,
+		utils.EthashChainWorkIntervalFlag,
+		utils.EthashHashAlgoFlag,
 		utils.TxPoolLocalsFlag,
 		utils.TxPoolNoLocalsFlag,
 		utils.TxPoolJournalFlag,
@@ -116,12 +134,21 @@ var (
 		utils.MaxPendingPeersFlag,
 		utils.MiningEnabledFlag,
 		utils.MinerThreadsFlag,
+		utils.MinerCPUsFlag,
+		utils.MinerNiceFlag,
+		utils.MinerGovernorImportLatencyFlag,
+		utils.MinerGovernorRPCActiveFlag,
+		utils.MinerGovernorIntervalFlag,
+		utils.MinerHashrateResolutionFlag,
+		utils.MinerHashrateRetentionFlag,
 		utils.MinerNotifyFlag,
 		utils.MinerGasLimitFlag,
 		utils.MinerGasPriceFlag,
 		utils.MinerEtherbaseFlag,
 		utils.MinerExtraDataFlag,
 		utils.MinerRecommitIntervalFlag,
+		utils.MinerEmptyDelayFlag,
+		utils.MinerRegenerateFlag,
 		utils.MinerNoVerifyFlag,
 		utils.MinerNewPayloadTimeout,
 		utils.NATFlag,
@@ -144,6 +171,58 @@ var (
 		utils.GpoMaxGasPriceFlag,
 		utils.GpoIgnoreGasPriceFlag,
 		utils.MinerNotifyFullFlag,
+		utils.MinerNotifyRetriesFlag,
+		utils.MinerNotifyQuarantineFlag,
+		utils.MinerSubmitTokensFlag,
+		utils.MinerSubmitRateFlag,
+		utils.MinerRequestRateFlag,
+		utils.MinerRequestSizeFlag,
+		utils.MinerSignedHashrateFlag,
+		utils.MinerWorkBufferFlag,
+		utils.MinerSealTimeoutFlag,
+		utils.MinerSimulateFlag,
+		utils.MinerBenchmarkFlag,
+		utils.MinerClientTagFlag,
+		utils.MinerDrainTimeoutFlag,
+		utils.MinerBanThresholdFlag,
+		utils.MinerBanTimeFlag,
+		utils.MinerWorkerExpiryFlag,
+		utils.MinerGetworkFlag,
+		utils.MinerGetworkListenFlag,
+		utils.MinerGetworkCORSFlag,
+		utils.MinerGetworkTimeoutFlag,
+		utils.MinerMQTTFlag,
+		utils.MinerMQTTTopicFlag,
+		utils.MinerMQTTQoSFlag,
+		utils.MinerKafkaFlag,
+		utils.MinerKafkaTopicFlag,
+		utils.MinerEpochAnnounceFlag,
+		utils.MinerTraceFlag,
+		utils.MinerTraceRatioFlag,
+		utils.MinerTransportsFlag,
+		utils.MinerTLSCertFlag,
+		utils.MinerTLSKeyFlag,
+		utils.MinerTLSCAFlag,
+		utils.MinerStratumFlag,
+		utils.MinerHmwireFlag,
+		utils.MinerGPUsFlag,
+		utils.MinerNonceStrategyFlag,
+		utils.MinerStaleWindowFlag,
+		utils.MinerGRPCFlag,
+		utils.MinerExtranonceFlag,
+		utils.MinerShareDiffFlag,
+		utils.MinerVardiffFlag,
+		utils.MinerPayoutSchemeFlag,
+		utils.MinerPayoutMaturityFlag,
+		utils.MinerPayoutAccountFlag,
+		utils.MinerPayoutIntervalFlag,
+		utils.MinerPayoutThresholdFlag,
+		utils.MinerPayoutGasPriceFlag,
+		utils.MinerPayoutBatchFlag,
+		utils.MinerShareAuditWindowFlag,
+		utils.MinerShareAuditThresholdFlag,
+		utils.MinerWithholdWindowFlag,
+		utils.MinerWithholdSignificanceFlag,
 		configFileFlag,
 	}, utils.NetworkFlags, utils.DatabasePathFlags)
 
@@ -222,6 +301,10 @@ func init() {
 		// See misccmd.go:
 		makecacheCommand,
 		makedagCommand,
+		exportdagCommand,
+		importdagCommand,
+		makevectorsCommand,
+		makediffvectorsCommand,
 		versionCommand,
 		versionCheckCommand,
 		licenseCommand,
@@ -17,11 +17,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/internal/version"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/urfave/cli/v2"
@@ -60,6 +64,56 @@ The makedag command generates an ethash DAG in <outputDir>.
 
 This command exists to support the system testing project.
 Regular users do not need to execute it.
+`,
+	}
+	exportdagCommand = &cli.Command{
+		Action:    exportdag,
+		Name:      "exportdag",
+		Usage:     "Export an ethash mining DAG to a file",
+		ArgsUsage: "<epoch> <file>",
+		Flags:     []cli.Flag{utils.EthashDatasetDirFlag},
+		Description: `
+The exportdag command writes the ethash DAG of <epoch> to <file>, loading it
+from the DAG directory or generating it there first.
+
+The file can be distributed to mining rigs and imported with importdag, sparing
+them the generation. Rigs must share the byte order of the exporting machine.
+`,
+	}
+	importdagCommand = &cli.Command{
+		Action:    importdag,
+		Name:      "importdag",
+		Usage:     "Import an ethash mining DAG from a file",
+		ArgsUsage: "<epoch> <file>",
+		Flags:     []cli.Flag{utils.EthashDatasetDirFlag},
+		Description: `
+The importdag command validates the ethash DAG of <epoch> exported to <file> by
+exportdag and copies it into the DAG directory.
+`,
+	}
+	makevectorsCommand = &cli.Command{
+		Action:    makevectors,
+		Name:      "makevectors",
+		Usage:     "Generate hmhash known-answer test vectors",
+		ArgsUsage: "<epoch> <count> <file>",
+		Description: `
+The makevectors command computes <count> proof-of-work test vectors at <epoch>
+with the reference implementation and writes them to <file> as JSON.
+
+Alternative miner implementations can validate their results against them.
+`,
+	}
+	makediffvectorsCommand = &cli.Command{
+		Action:    makediffvectors,
+		Name:      "makediffvectors",
+		Usage:     "Generate difficulty adjustment test vectors",
+		ArgsUsage: "<file>",
+		Description: `
+The makediffvectors command computes the difficulty adjustment over the supported
+fork configurations and block time scenarios and writes the vectors to <file> as
+JSON.
+
+Miner software can mirror the difficulty adjustment by validating against them.
 `,
 	}
 	versionCommand = &cli.Command{
@@ -95,12 +149,106 @@ and displays information about any security vulnerabilities that affect the curr
 
 // makecache generates an ethash verification cache into the provided folder.
 func makecache(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	if len(args) != 2 {
+		utils.Fatalf(`Usage: geth makecache <block number> <outputdir>`)
+	}
+	block, err := strconv.ParseUint(args[0], 0, 64)
+	if err != nil {
+		utils.Fatalf("Invalid block number: %v", err)
+	}
+	ethash.MakeCache(block, args[1])
+
 	return nil
 }
 
 // makedag generates an ethash mining DAG into the provided folder.
 func makedag(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	if len(args) != 2 {
+		utils.Fatalf(`Usage: geth makedag <block number> <outputdir>`)
+	}
+	block, err := strconv.ParseUint(args[0], 0, 64)
+	if err != nil {
+		utils.Fatalf("Invalid block number: %v", err)
+	}
+	ethash.MakeDataset(block, args[1])
+
+	return nil
+}
 
+// exportdag writes an ethash mining DAG into the provided file.
+func exportdag(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	if len(args) != 2 {
+		utils.Fatalf(`Usage: geth exportdag <epoch> <file>`)
+	}
+	epoch, err := strconv.ParseUint(args[0], 0, 64)
+	if err != nil {
+		utils.Fatalf("Invalid epoch: %v", err)
+	}
+	if err := ethash.ExportDataset(epoch, ctx.String(utils.EthashDatasetDirFlag.Name), args[1]); err != nil {
+		utils.Fatalf("Failed to export DAG: %v", err)
+	}
+	return nil
+}
+
+// importdag validates an ethash mining DAG from the provided file and copies it
+// into the DAG directory.
+func importdag(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	if len(args) != 2 {
+		utils.Fatalf(`Usage: geth importdag <epoch> <file>`)
+	}
+	epoch, err := strconv.ParseUint(args[0], 0, 64)
+	if err != nil {
+		utils.Fatalf("Invalid epoch: %v", err)
+	}
+	if err := ethash.ImportDataset(epoch, ctx.String(utils.EthashDatasetDirFlag.Name), args[1]); err != nil {
+		utils.Fatalf("Failed to import DAG: %v", err)
+	}
+	return nil
+}
+
+// makevectors writes known-answer test vectors of the proof-of-work into the
+// provided file.
+func makevectors(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	if len(args) != 3 {
+		utils.Fatalf(`Usage: geth makevectors <epoch> <count> <file>`)
+	}
+	epoch, err := strconv.ParseUint(args[0], 0, 64)
+	if err != nil {
+		utils.Fatalf("Invalid epoch: %v", err)
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count <= 0 {
+		utils.Fatalf("Invalid vector count: %s", args[1])
+	}
+	blob, err := json.MarshalIndent(ethash.MakeTestVectors(epoch, count), "", "  ")
+	if err != nil {
+		utils.Fatalf("Failed to encode test vectors: %v", err)
+	}
+	if err := os.WriteFile(args[2], append(blob, '\n'), 0644); err != nil {
+		utils.Fatalf("Failed to write test vectors: %v", err)
+	}
+	return nil
+}
+
+// makediffvectors writes the difficulty adjustment test vectors into the provided
+// file.
+func makediffvectors(ctx *cli.Context) error {
+	args := ctx.Args().Slice()
+	if len(args) != 1 {
+		utils.Fatalf(`Usage: geth makediffvectors <file>`)
+	}
+	blob, err := json.MarshalIndent(ethash.DifficultyVectors(), "", "  ")
+	if err != nil {
+		utils.Fatalf("Failed to encode difficulty vectors: %v", err)
+	}
+	if err := os.WriteFile(args[0], append(blob, '\n'), 0644); err != nil {
+		utils.Fatalf("Failed to write difficulty vectors: %v", err)
+	}
 	return nil
 }
 
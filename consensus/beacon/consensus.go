@@ -17,6 +17,7 @@
 package beacon
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
@@ -26,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
@@ -214,6 +216,78 @@ func (beacon *Beacon) VerifyUncles(chain consensus.ChainReader, block *types.Blo
 	return nil
 }
 
+// VerifyState implements consensus.StateVerifier, delegating the verification of
+// pre-merge headers to the eth1 engine if it depends on the state.
+func (beacon *Beacon) VerifyState(chain consensus.ChainHeaderReader, header *types.Header, parent *state.StateDB) error {
+	if beacon.IsPoSHeader(header) {
+		return nil
+	}
+	if verifier, ok := beacon.ethone.(consensus.StateVerifier); ok {
+		return verifier.VerifyState(chain, header, parent)
+	}
+	return nil
+}
+
+// DiagnoseState implements consensus.StateDiagnoser, delegating the diagnosis of
+// pre-merge blocks to the eth1 engine.
+func (beacon *Beacon) DiagnoseState(chain consensus.ChainHeaderReader, block *types.Block, err error) {
+	if beacon.IsPoSHeader(block.Header()) {
+		return
+	}
+	if diagnoser, ok := beacon.ethone.(consensus.StateDiagnoser); ok {
+		diagnoser.DiagnoseState(chain, block, err)
+	}
+}
+
+// SealContext implements consensus.ContextSealer, delegating the sealing of
+// pre-merge blocks to the eth1 engine.
+func (beacon *Beacon) SealContext(ctx context.Context, chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block) error {
+	if beacon.IsPoSHeader(block.Header()) {
+		return nil
+	}
+	if sealer, ok := beacon.ethone.(consensus.ContextSealer); ok {
+		return sealer.SealContext(ctx, chain, block, results)
+	}
+	return beacon.ethone.Seal(chain, block, results, ctx.Done())
+}
+
+// VerifySealContext implements consensus.ContextSealer, delegating the seal
+// verification of pre-merge headers to the eth1 engine. Engines unable to check
+// the seal alone verify the whole header instead.
+func (beacon *Beacon) VerifySealContext(ctx context.Context, chain consensus.ChainHeaderReader, header *types.Header) error {
+	if beacon.IsPoSHeader(header) {
+		return nil
+	}
+	if sealer, ok := beacon.ethone.(consensus.ContextSealer); ok {
+		return sealer.VerifySealContext(ctx, chain, header)
+	}
+	return beacon.ethone.VerifyHeader(chain, header, true)
+}
+
+// SubscribeSealFailures implements consensus.SealFailureNotifier, forwarding the
+// abandoned seals of the eth1 engine, if it reports them.
+func (beacon *Beacon) SubscribeSealFailures(ch chan<- consensus.SealFailure) event.Subscription {
+	if notifier, ok := beacon.ethone.(consensus.SealFailureNotifier); ok {
+		return notifier.SubscribeSealFailures(ch)
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// SubscribeUncleCandidates implements consensus.UncleSealer, forwarding the late
+// sealed blocks of the eth1 engine, if it hands them over.
+func (beacon *Beacon) SubscribeUncleCandidates(ch chan<- *types.Block) event.Subscription {
+	if sealer, ok := beacon.ethone.(consensus.UncleSealer); ok {
+		return sealer.SubscribeUncleCandidates(ch)
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 // verifyHeader checks whether a header conforms to the consensus rules of the
 // stock Ethereum consensus engine. The difference between the beacon and classic is
 // (a) The following fields are expected to be constants:
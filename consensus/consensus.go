@@ -18,11 +18,13 @@
 package consensus
 
 import (
+	"context"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -128,3 +130,52 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// ContextSealer is a consensus engine whose sealing and seal verification can be
+// cancelled through a context, instead of only through a stop channel.
+type ContextSealer interface {
+	// SealContext is like Seal, but sealing is aborted once the context is done,
+	// after which no result is delivered anymore.
+	SealContext(ctx context.Context, chain ChainHeaderReader, block *types.Block, results chan<- *types.Block) error
+
+	// VerifySealContext checks whether the seal of a header is valid, returning
+	// the error of the context if it's done before the verification finished.
+	VerifySealContext(ctx context.Context, chain ChainHeaderReader, header *types.Header) error
+}
+
+// SealFailure reports an asynchronous seal abandoned by the consensus engine.
+type SealFailure struct {
+	SealHash common.Hash
+	Err      error
+}
+
+// SealFailureNotifier is a consensus engine which may abandon seals on its own,
+// like on a sealing deadline, reporting them so the miner can rebuild the block.
+type SealFailureNotifier interface {
+	// SubscribeSealFailures registers a subscription for the abandoned seals.
+	SubscribeSealFailures(ch chan<- SealFailure) event.Subscription
+}
+
+// UncleSealer is a consensus engine which may seal blocks too late to extend the
+// chain, handing them to the miner as uncle candidates instead.
+type UncleSealer interface {
+	// SubscribeUncleCandidates registers a subscription for the late sealed blocks.
+	SubscribeUncleCandidates(ch chan<- *types.Block) event.Subscription
+}
+
+// StateVerifier is a consensus engine whose rules also depend on the state of the
+// chain, such as a validator set kept in a system contract.
+type StateVerifier interface {
+	// VerifyState checks whether a header conforms to the consensus rules which
+	// depend on the state of its parent. It's called before the block is
+	// processed.
+	VerifyState(chain ChainHeaderReader, header *types.Header, parent *state.StateDB) error
+}
+
+// StateDiagnoser is a consensus engine which can report the inputs of its state
+// transition of a block, to debug consensus splits between client versions.
+type StateDiagnoser interface {
+	// DiagnoseState is called with a block whose state or receipt root differs
+	// from the one computed locally, and the error reporting the mismatch.
+	DiagnoseState(chain ChainHeaderReader, block *types.Block, err error)
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"errors"
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	errInvalidNice         = errors.New("nice value must be between -20 and 19")
+	errAffinityUnsupported = errors.New("thread affinity and priority not supported on this platform")
+)
+
+// threadPlacement is the CPU affinity and priority of the local mining threads.
+type threadPlacement struct {
+	cpus []int // CPUs the threads may run on, all if empty
+	nice int   // Nice value of the threads, zero to keep the process priority
+}
+
+// newThreadPlacement parses and validates the CPU list and nice value of the
+// mining threads.
+func newThreadPlacement(cpus string, nice int) (threadPlacement, error) {
+	list, err := parseCPUList(cpus)
+	if err != nil {
+		return threadPlacement{}, err
+	}
+	if !validNice(nice) {
+		return threadPlacement{}, errInvalidNice
+	}
+	return threadPlacement{cpus: list, nice: nice}, nil
+}
+
+// validNice returns whether a nice value is within the range of the OS.
+func validNice(nice int) bool {
+	return nice >= -20 && nice <= 19
+}
+
+// apply locks the calling goroutine to its OS thread and sets the affinity and
+// priority of the thread, if any. The goroutine must not unlock the thread, so
+// it's terminated along with the goroutine instead of running others with them.
+func (p threadPlacement) apply(logger log.Logger) {
+	if len(p.cpus) == 0 && p.nice == 0 {
+		return
+	}
+	runtime.LockOSThread()
+	if len(p.cpus) > 0 {
+		if err := setAffinity(p.cpus); err != nil {
+			logger.Warn("Failed to set hmhash mining thread affinity", "cpus", p.cpus, "err", err)
+		}
+	}
+	if p.nice != 0 {
+		if err := setNice(p.nice); err != nil {
+			logger.Warn("Failed to set hmhash mining thread priority", "nice", p.nice, "err", err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that the CPU list and nice value of the mining threads are validated.
+func TestThreadPlacement(t *testing.T) {
+	tests := []struct {
+		cpus string
+		nice int
+		want threadPlacement
+		fail bool
+	}{
+		{cpus: "", nice: 0, want: threadPlacement{}},
+		{cpus: "0-2,5", nice: 19, want: threadPlacement{cpus: []int{0, 1, 2, 5}, nice: 19}},
+		{cpus: "", nice: -20, want: threadPlacement{nice: -20}},
+		{cpus: "2-1", fail: true},
+		{cpus: "", nice: 20, fail: true},
+	}
+	for i, tt := range tests {
+		have, err := newThreadPlacement(tt.cpus, tt.nice)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if !tt.fail && !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: placement mismatch: have %+v, want %+v", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the placement of the mining threads is changed at runtime, and
+// blocks are still sealed by the placed threads.
+func TestRuntimeThreadPlacement(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	api, admin := &MiningAPI{hmhash}, &AdminAPI{hmhash: hmhash}
+
+	var update RuntimeConfig
+	if err := json.Unmarshal([]byte(`{"minerCPUs": "0", "minerNice": 5}`), &update); err != nil {
+		t.Fatalf("failed to decode update: %v", err)
+	}
+	if err := admin.SetConfig(update); err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+	if want := (threadPlacement{cpus: []int{0}, nice: 5}); !reflect.DeepEqual(hmhash.affinity, want) {
+		t.Fatalf("placement mismatch: have %+v, want %+v", hmhash.affinity, want)
+	}
+	// Ensure invalid updates change nothing
+	nice := 42
+	if err := admin.SetConfig(RuntimeConfig{MinerNice: &nice}); err != errInvalidNice {
+		t.Errorf("invalid nice error mismatch: have %v, want %v", err, errInvalidNice)
+	}
+	if config := api.GetConfig(); *config.MinerCPUs != "0" || *config.MinerNice != 5 {
+		t.Errorf("reported placement mismatch: have %q/%d, want \"0\"/5", *config.MinerCPUs, *config.MinerNice)
+	}
+	// Seal a block with the placed threads
+	hmhash.SetThreads(2)
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case block := <-results:
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Errorf("sealed block invalid: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("sealing timed out")
+	}
+}
@@ -17,15 +17,72 @@
 package ethash
 
 import (
+	"encoding/binary"
 	"hash"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 
-	"golang.org/x/crypto/sha3"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/log"
 )
 
 const (
-	epochLength = 30000 // Blocks per epoch
+	datasetInitBytes   = 1 << 30 // Bytes in dataset at genesis
+	datasetGrowthBytes = 1 << 23 // Dataset growth per epoch
+	cacheInitBytes     = 1 << 24 // Bytes in cache at genesis
+	cacheGrowthBytes   = 1 << 17 // Cache growth per epoch
+	epochLength        = 30000   // Blocks per epoch
+	mixBytes           = 128     // Width of mix
+	hashBytes          = 64      // Hash length in bytes
+	hashWords          = 16      // Number of 32 bit ints in a hash
+	datasetParents     = 256     // Number of parents of each dataset element
+	cacheRounds        = 3       // Number of rounds in cache production
+	loopAccesses       = 64      // Number of accesses in hashimoto loop
+
+	testCacheSize   = 1024      // Size of the verification cache in test mode
+	testDatasetSize = 32 * 1024 // Size of the mining dataset in test mode
 )
 
+// cacheSize returns the size of the hmhash verification cache that belongs to a
+// certain block number, using the default sizing parameters.
+func cacheSize(block uint64) uint64 {
+	return calcCacheSize(block/epochLength, cacheInitBytes, cacheGrowthBytes)
+}
+
+// calcCacheSize calculates the cache size for epoch. The cache size grows linearly,
+// however, we always take the highest prime below the linearly growing threshold in
+// order to reduce the risk of accidental regularities leading to cyclic behavior.
+func calcCacheSize(epoch uint64, init, growth uint64) uint64 {
+	size := init + growth*epoch - hashBytes
+	for !new(big.Int).SetUint64(size / hashBytes).ProbablyPrime(1) { // Always accurate for n < 2^64
+		size -= 2 * hashBytes
+	}
+	return size
+}
+
+// datasetSize returns the size of the hmhash mining dataset that belongs to a
+// certain block number, using the default sizing parameters.
+func datasetSize(block uint64) uint64 {
+	return calcDatasetSize(block/epochLength, datasetInitBytes, datasetGrowthBytes)
+}
+
+// calcDatasetSize calculates the dataset size for epoch. The dataset size grows
+// linearly, however, we always take the highest prime below the linearly growing
+// threshold in order to reduce the risk of accidental regularities leading to
+// cyclic behavior.
+func calcDatasetSize(epoch uint64, init, growth uint64) uint64 {
+	size := init + growth*epoch - mixBytes
+	for !new(big.Int).SetUint64(size / mixBytes).ProbablyPrime(1) { // Always accurate for n < 2^64
+		size -= 2 * mixBytes
+	}
+	return size
+}
+
 // hasher is a repetitive hasher allowing the same hash data structures to be
 // reused between hash runs instead of requiring new ones to be created.
 type hasher func(dest []byte, data []byte)
@@ -40,51 +97,341 @@ func makeHasher(h hash.Hash) hasher {
 		hash.Hash
 		Read([]byte) (int, error)
 	}
-	rh, ok := h.(readerHash)
-	if !ok {
-		panic("can't find Read method on hash")
+	outputLen := h.Size()
+	if rh, ok := h.(readerHash); ok {
+		return func(dest []byte, data []byte) {
+			rh.Reset()
+			rh.Write(data)
+			rh.Read(dest[:outputLen])
+		}
 	}
-	outputLen := rh.Size()
+	// Other hashes append the sum, which lands in dest as long as it has room
 	return func(dest []byte, data []byte) {
-		rh.Reset()
-		rh.Write(data)
-		rh.Read(dest[:outputLen])
+		h.Reset()
+		h.Write(data)
+		h.Sum(dest[:0:outputLen])
 	}
 }
 
 // seedHash is the seed to use for generating a verification cache and the mining
 // dataset.
 func seedHash(block uint64) []byte {
-	seed := make([]byte, 32)
-	if block < epochLength {
-		return seed
+	seed := epochSeed(block / epochLength)
+	return seed[:]
+}
+
+// generateCache creates a verification cache of a given size for an input seed.
+// The cache production process involves first sequentially filling up 32 MB of
+// memory, then performing two passes of Sergio Demian Lerner's RandMemoHash
+// algorithm from Strict Memory Hard Hashing Functions (2014). The output is a
+// set of 524288 64-byte values.
+// This method places the result into dest in machine byte order.
+func generateCache(algo HashAlgo, dest []uint32, epoch uint64, seed []byte) {
+	// Print some debug logs to allow analysis on low end devices
+	logger := log.New("epoch", epoch)
+
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+
+		logFn := logger.Debug
+		if elapsed > 3*time.Second {
+			logFn = logger.Info
+		}
+		logFn("Generated hmhash verification cache", "elapsed", common.PrettyDuration(elapsed))
+		cacheGenerateTimer.Update(elapsed)
+	}()
+	// Convert our destination slice to a byte buffer
+	cache := unsafe.Slice((*byte)(unsafe.Pointer(&dest[0])), len(dest)*4)
+
+	// Calculate the number of theoretical rows (we'll store in one buffer nonetheless)
+	size := uint64(len(cache))
+	rows := int(size) / hashBytes
+
+	// Start a monitoring goroutine to report progress on low end devices
+	var progress uint32
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(3 * time.Second):
+				logger.Info("Generating hmhash verification cache", "percentage", atomic.LoadUint32(&progress)*100/uint32(rows)/(cacheRounds+1), "elapsed", common.PrettyDuration(time.Since(start)))
+			}
+		}
+	}()
+	// Create a hasher to reuse between invocations
+	hash512 := makeHasher(algo.New512())
+
+	// Sequentially produce the initial dataset
+	hash512(cache, seed)
+	for offset := uint64(hashBytes); offset < size; offset += hashBytes {
+		hash512(cache[offset:], cache[offset-hashBytes:offset])
+		atomic.AddUint32(&progress, 1)
+	}
+	// Use a low-round version of randmemohash
+	temp := make([]byte, hashBytes)
+
+	for i := 0; i < cacheRounds; i++ {
+		for j := 0; j < rows; j++ {
+			var (
+				srcOff = ((j - 1 + rows) % rows) * hashBytes
+				dstOff = j * hashBytes
+				xorOff = (binary.LittleEndian.Uint32(cache[dstOff:]) % uint32(rows)) * hashBytes
+			)
+			bitutil.XORBytes(temp, cache[srcOff:srcOff+hashBytes], cache[xorOff:xorOff+hashBytes])
+			hash512(cache[dstOff:], temp)
+
+			atomic.AddUint32(&progress, 1)
+		}
+	}
+	// Swap the byte order on big endian systems and return
+	if !isLittleEndian() {
+		swap(cache)
 	}
-	keccak256 := makeHasher(sha3.NewLegacyKeccak256())
-	for i := 0; i < int(block/epochLength); i++ {
-		keccak256(seed, seed)
+}
+
+// swap changes the byte order of the buffer assuming a uint32 representation.
+func swap(buffer []byte) {
+	for i := 0; i < len(buffer); i += 4 {
+		binary.BigEndian.PutUint32(buffer[i:], binary.LittleEndian.Uint32(buffer[i:]))
+	}
+}
+
+// fnv is an algorithm inspired by the FNV hash, which in some cases is used as
+// a non-associative substitute for XOR. Note that we multiply the prime with
+// the full 32-bit input, in contrast with the FNV-1 spec which multiplies the
+// prime with one byte (octet) in turn.
+func fnv(a, b uint32) uint32 {
+	return a*0x01000193 ^ b
+}
+
+// fnvHash mixes in data into mix using the hmhash fnv method.
+func fnvHash(mix []uint32, data []uint32) {
+	for i := 0; i < len(mix); i++ {
+		mix[i] = mix[i]*0x01000193 ^ data[i]
 	}
-	return seed
 }
 
-// hashimoto produce our final value for a particular header hash and nonce.
-func hashimoto(hash []byte, nonceHash []byte) []byte {
-	resultBytes := make([]byte, len(hash))
-	for i := 0; i < len(hash); i++ {
-		resultBytes[i] = hash[i] ^ nonceHash[i]
+// generateDatasetItem combines data from 256 pseudorandomly selected cache nodes,
+// and hashes that to compute a single dataset node.
+func generateDatasetItem(cache []uint32, index uint32, hash512 hasher) []byte {
+	// Calculate the number of theoretical rows (we use one buffer nonetheless)
+	rows := uint32(len(cache) / hashWords)
+
+	// Initialize the mix
+	mix := make([]byte, hashBytes)
+
+	binary.LittleEndian.PutUint32(mix, cache[(index%rows)*hashWords]^index)
+	for i := 1; i < hashWords; i++ {
+		binary.LittleEndian.PutUint32(mix[i*4:], cache[(index%rows)*hashWords+uint32(i)])
+	}
+	hash512(mix, mix)
+
+	// Convert the mix to uint32s to avoid constant bit shifting
+	intMix := make([]uint32, hashWords)
+	for i := 0; i < len(intMix); i++ {
+		intMix[i] = binary.LittleEndian.Uint32(mix[i*4:])
+	}
+	// fnv it with a lot of random cache nodes based on index
+	for i := uint32(0); i < datasetParents; i++ {
+		parent := fnv(index^i, intMix[i%16]) % rows
+		fnvHash(intMix, cache[parent*hashWords:])
+	}
+	// Flatten the uint32 mix into a binary one and return
+	for i, val := range intMix {
+		binary.LittleEndian.PutUint32(mix[i*4:], val)
 	}
-	return resultBytes
+	hash512(mix, mix)
+	return mix
+}
+
+// generateDataset generates the entire hmhash dataset for mining.
+// This method places the result into dest in machine byte order. The progress
+// is reported to the metrics and, if set, to the progress callback after every
+// percent generated.
+func generateDataset(algo HashAlgo, dest []uint32, epoch uint64, cache []uint32, progress func(DatasetProgress)) {
+	// Print some debug logs to allow analysis on low end devices
+	logger := log.New("epoch", epoch)
+
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+
+		logFn := logger.Debug
+		if elapsed > 3*time.Second {
+			logFn = logger.Info
+		}
+		logFn("Generated hmhash mining dataset", "elapsed", common.PrettyDuration(elapsed))
+		datasetGenerateTimer.Update(elapsed)
+	}()
+
+	// Figure out whether the bytes need to be swapped for the machine
+	swapped := !isLittleEndian()
+
+	// Convert our destination slice to a byte buffer
+	dataset := unsafe.Slice((*byte)(unsafe.Pointer(&dest[0])), len(dest)*4)
+
+	// Generate the dataset on many goroutines since it takes a while
+	threads := runtime.NumCPU()
+	size := uint64(len(dataset))
+
+	var pend sync.WaitGroup
+	pend.Add(threads)
+
+	var (
+		items    = size / hashBytes
+		done     uint64     // Atomic counter of the items generated
+		reported uint64     // Last percentage reported
+		reportMu sync.Mutex // Serializes the reports of the generator threads
+	)
+	datasetEpochGauge.Update(int64(epoch))
+
+	report := func(status uint64) {
+		reportMu.Lock()
+		defer reportMu.Unlock()
+
+		percent := status * 100 / items
+		if percent <= reported {
+			return
+		}
+		reported = percent
+
+		elapsed := time.Since(start)
+		eta := time.Duration(float64(elapsed) * float64(items-status) / float64(status))
+		logger.Info("Generating DAG in progress", "percentage", percent, "elapsed", common.PrettyDuration(elapsed), "eta", common.PrettyDuration(eta))
+
+		datasetProgressGauge.Update(int64(percent))
+		datasetETAGauge.Update(int64(eta / time.Second))
+		if progress != nil {
+			progress(DatasetProgress{Epoch: epoch, Percent: percent, Elapsed: elapsed, ETA: eta})
+		}
+	}
+	for i := 0; i < threads; i++ {
+		go func(id int) {
+			defer pend.Done()
+
+			// Create a hasher to reuse between invocations
+			hash512 := makeHasher(algo.New512())
+
+			// Calculate the data segment this thread should generate
+			batch := (size + hashBytes*uint64(threads) - 1) / (hashBytes * uint64(threads))
+			first := uint64(id) * batch
+			limit := first + batch
+			if limit > size/hashBytes {
+				limit = size / hashBytes
+			}
+			// Calculate the dataset segment
+			percent := items / 100
+			for index := first; index < limit; index++ {
+				item := generateDatasetItem(cache, uint32(index), hash512)
+				if swapped {
+					swap(item)
+				}
+				copy(dataset[index*hashBytes:], item)
+
+				if status := atomic.AddUint64(&done, 1); percent != 0 && status%percent == 0 {
+					report(status)
+				}
+			}
+		}(i)
+	}
+	// Wait for all the generators to finish and report the completion
+	pend.Wait()
+	report(items)
+}
+
+// hashimoto aggregates data from the full dataset in order to produce our final
+// value for a particular header hash and nonce.
+func hashimoto(algo HashAlgo, hash []byte, nonce uint64, size uint64, lookup func(index uint32) []uint32) ([]byte, []byte) {
+	// Calculate the number of theoretical rows (we use one buffer nonetheless)
+	rows := uint32(size / mixBytes)
+
+	// The default Keccak takes the single block path of sumKeccak, sparing the
+	// hasher allocations once per nonce in the mining loop
+	_, fast := algo.(keccakAlgo)
+
+	// Combine header+nonce into a 40 byte seed
+	seed := make([]byte, 40)
+	copy(seed, hash)
+	binary.LittleEndian.PutUint64(seed[32:], nonce)
+
+	if fast {
+		sum := make([]byte, 64)
+		sumKeccak(sum, keccak512Rate, seed)
+		seed = sum
+	} else {
+		hash512 := algo.New512()
+		hash512.Write(seed)
+		seed = hash512.Sum(nil)
+	}
+	seedHead := binary.LittleEndian.Uint32(seed)
+
+	// Start the mix with replicated seed
+	mix := make([]uint32, mixBytes/4)
+	for i := 0; i < len(mix); i++ {
+		mix[i] = binary.LittleEndian.Uint32(seed[i%16*4:])
+	}
+	// Mix in random dataset nodes
+	temp := make([]uint32, len(mix))
+
+	for i := 0; i < loopAccesses; i++ {
+		parent := fnv(uint32(i)^seedHead, mix[i%len(mix)]) % rows
+		for j := uint32(0); j < mixBytes/hashBytes; j++ {
+			copy(temp[j*hashWords:], lookup(2*parent+j))
+		}
+		fnvHash(mix, temp)
+	}
+	// Compress mix
+	for i := 0; i < len(mix); i += 4 {
+		mix[i/4] = fnv(fnv(fnv(mix[i], mix[i+1]), mix[i+2]), mix[i+3])
+	}
+	mix = mix[:len(mix)/4]
+
+	digest := make([]byte, common.HashLength)
+	for i, val := range mix {
+		binary.LittleEndian.PutUint32(digest[i*4:], val)
+	}
+	if fast {
+		result := make([]byte, common.HashLength)
+		sumKeccak(result, keccak256Rate, seed, digest)
+		return digest, result
+	}
+	hash256 := algo.New256()
+	hash256.Write(seed)
+	hash256.Write(digest)
+	return digest, hash256.Sum(nil)
 }
 
 // hashimotoLight aggregates data from the full dataset (using only a small
 // in-memory cache) in order to produce our final value for a particular header
 // hash and nonce.
-func hashimotoLight(hash []byte, nonce []byte) []byte {
-	return hashimoto(hash, nonce)
+func hashimotoLight(algo HashAlgo, size uint64, cache []uint32, hash []byte, nonce uint64) ([]byte, []byte) {
+	hash512 := makeHasher(algo.New512())
+
+	lookup := func(index uint32) []uint32 {
+		rawData := generateDatasetItem(cache, index, hash512)
+
+		data := make([]uint32, len(rawData)/4)
+		for i := 0; i < len(data); i++ {
+			data[i] = binary.LittleEndian.Uint32(rawData[i*4:])
+		}
+		return data
+	}
+	return hashimoto(algo, hash, nonce, size, lookup)
 }
 
 // hashimotoFull aggregates data from the full dataset (using the full in-memory
 // dataset) in order to produce our final value for a particular header hash and
 // nonce.
-func hashimotoFull(hash []byte, nonce []byte) []byte {
-	return hashimoto(hash, nonce)
+func hashimotoFull(algo HashAlgo, dataset []uint32, hash []byte, nonce uint64) ([]byte, []byte) {
+	lookup := func(index uint32) []uint32 {
+		offset := index * hashWords
+		return dataset[offset : offset+hashWords]
+	}
+	return hashimoto(algo, hash, nonce, uint64(len(dataset))*4, lookup)
 }
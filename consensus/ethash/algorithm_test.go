@@ -19,7 +19,8 @@ package ethash
 import (
 	"bytes"
 	"encoding/binary"
-	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"path/filepath"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -37,38 +38,164 @@ func prepare(dest []uint32, src []byte) {
 // Tests whether the hashimoto lookup works for both light as well as the full
 // datasets.
 func TestHashimoto(t *testing.T) {
+	// Create the verification cache and mining dataset
+	cache := make([]uint32, 1024/4)
+	generateCache(keccakAlgo{}, cache, 0, make([]byte, 32))
+
+	dataset := make([]uint32, 32*1024/4)
+	generateDataset(keccakAlgo{}, dataset, 0, cache, nil)
+
 	// Create a block to verify
 	hash := hexutil.MustDecode("0xc9149cc0386e689d789a1c2f3d5d169a61a6218ed30e74414dc736e442ef3d1f")
 	nonce := uint64(0)
 
+	wantDigest := hexutil.MustDecode("0xe4073cffaef931d37117cefd9afd27ea0f1cad6a981dd2605c4a1ac97c519800")
 	wantResult := hexutil.MustDecode("0xd3539235ee2e6f8db665c0a72169f55b7f6c605712330b778ec3944f0eb5a557")
 
-	result := hashimotoLight(hash, types.EncodeNonce(nonce).Hash())
+	digest, result := hashimotoLight(keccakAlgo{}, 32*1024, cache, hash, nonce)
+	if !bytes.Equal(digest, wantDigest) {
+		t.Errorf("light hashimoto digest mismatch: have %x, want %x", digest, wantDigest)
+	}
 	if !bytes.Equal(result, wantResult) {
 		t.Errorf("light hashimoto result mismatch: have %x, want %x", result, wantResult)
 	}
-	result = hashimotoFull(hash, types.EncodeNonce(nonce).Hash())
+	digest, result = hashimotoFull(keccakAlgo{}, dataset, hash, nonce)
+	if !bytes.Equal(digest, wantDigest) {
+		t.Errorf("full hashimoto digest mismatch: have %x, want %x", digest, wantDigest)
+	}
 	if !bytes.Equal(result, wantResult) {
 		t.Errorf("full hashimoto result mismatch: have %x, want %x", result, wantResult)
 	}
 }
 
+// Tests that the reference implementation reproduces the known-answer vectors
+// shipped for alternative implementations, and rejects tampered ones.
+func TestKnownAnswerVectors(t *testing.T) {
+	vectors, err := LoadTestVectors(filepath.Join("testdata", "vectors.json"))
+	if err != nil {
+		t.Fatalf("failed to load test vectors: %v", err)
+	}
+	if err := CheckTestVectors(vectors); err != nil {
+		t.Fatalf("test vector mismatch: %v", err)
+	}
+	if have := MakeTestVectors(0, 1); have[0] != vectors[0] {
+		t.Errorf("generated vector mismatch: have %+v, want %+v", have[0], vectors[0])
+	}
+	vectors[0].Nonce++
+	if err := CheckTestVectors(vectors[:1]); err == nil {
+		t.Errorf("tampered test vector accepted")
+	}
+}
+
+// Tests that the dataset generation reports its progress to the registered
+// callback, ending with the completion.
+func TestDatasetProgress(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	var reports []DatasetProgress
+	hmhash.SetDatasetProgressHook(func(progress DatasetProgress) {
+		reports = append(reports, progress)
+	})
+	hmhash.dataset(nil, epochLength, false)
+
+	if len(reports) == 0 {
+		t.Fatalf("no progress reported")
+	}
+	for i, report := range reports {
+		if report.Epoch != 1 {
+			t.Errorf("report %d: epoch mismatch: have %d, want 1", i, report.Epoch)
+		}
+		if i > 0 && report.Percent <= reports[i-1].Percent {
+			t.Errorf("report %d: progress not increasing: have %d, previous %d", i, report.Percent, reports[i-1].Percent)
+		}
+	}
+	if last := reports[len(reports)-1]; last.Percent != 100 || last.ETA != 0 {
+		t.Errorf("completion mismatch: have %d%% with ETA %v, want 100%% with ETA 0", last.Percent, last.ETA)
+	}
+}
+
+// Tests that the configurable sizing parameters produce prime row counts.
+func TestSizeCalculation(t *testing.T) {
+	for epoch := uint64(0); epoch < 32; epoch++ {
+		if size := calcCacheSize(epoch, cacheInitBytes, cacheGrowthBytes); !new(big.Int).SetUint64(size / hashBytes).ProbablyPrime(1) {
+			t.Errorf("epoch %d: cache rows %d not prime", epoch, size/hashBytes)
+		}
+		if size := calcDatasetSize(epoch, datasetInitBytes, datasetGrowthBytes); !new(big.Int).SetUint64(size / mixBytes).ProbablyPrime(1) {
+			t.Errorf("epoch %d: dataset rows %d not prime", epoch, size/mixBytes)
+		}
+	}
+	if have, want := cacheSize(0), uint64(16776896); have != want {
+		t.Errorf("genesis cache size mismatch: have %d, want %d", have, want)
+	}
+	if have, want := datasetSize(0), uint64(1073739904); have != want {
+		t.Errorf("genesis dataset size mismatch: have %d, want %d", have, want)
+	}
+}
+
+// Tests that sizing overrides too small for the size search are rejected, and
+// that the smallest accepted ones still produce prime row counts.
+func TestSizeOverrides(t *testing.T) {
+	tests := []struct {
+		cache, dataset uint64
+		ok             bool
+	}{
+		{0, 0, true},
+		{minSizeRows * hashBytes, minSizeRows * mixBytes, true},
+		{hashBytes, 0, false},
+		{minSizeRows*hashBytes - 1, 0, false},
+		{0, mixBytes / 2, false},
+		{0, minSizeRows*mixBytes - 1, false},
+	}
+	for i, tt := range tests {
+		err := checkSizeOverrides(&Config{CacheInitBytes: tt.cache, DatasetInitBytes: tt.dataset})
+		if (err == nil) != tt.ok {
+			t.Errorf("test %d: error mismatch: have %v, want ok %v", i, err, tt.ok)
+		}
+	}
+	for epoch := uint64(0); epoch < 4; epoch++ {
+		if size := calcCacheSize(epoch, minSizeRows*hashBytes, hashBytes); size < 2*hashBytes || !new(big.Int).SetUint64(size/hashBytes).ProbablyPrime(1) {
+			t.Errorf("epoch %d: minimum cache size %d invalid", epoch, size)
+		}
+		if size := calcDatasetSize(epoch, minSizeRows*mixBytes, mixBytes); size < 2*mixBytes || !new(big.Int).SetUint64(size/mixBytes).ProbablyPrime(1) {
+			t.Errorf("epoch %d: minimum dataset size %d invalid", epoch, size)
+		}
+	}
+}
+
+// Benchmarks the cache generation performance.
+func BenchmarkCacheGeneration(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		cache := make([]uint32, cacheSize(1)/4)
+		generateCache(keccakAlgo{}, cache, 0, make([]byte, 32))
+	}
+}
+
 // Benchmarks the light verification performance.
 func BenchmarkHashimotoLight(b *testing.B) {
+	cache := make([]uint32, cacheSize(1)/4)
+	generateCache(keccakAlgo{}, cache, 0, make([]byte, 32))
+
 	hash := hexutil.MustDecode("0xc9149cc0386e689d789a1c2f3d5d169a61a6218ed30e74414dc736e442ef3d1f")
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		hashimotoLight(hash, types.EncodeNonce(0).Hash())
+		hashimotoLight(keccakAlgo{}, datasetSize(1), cache, hash, 0)
 	}
 }
 
 // Benchmarks the full (small) verification performance.
 func BenchmarkHashimotoFullSmall(b *testing.B) {
+	cache := make([]uint32, 65536/4)
+	generateCache(keccakAlgo{}, cache, 0, make([]byte, 32))
+
+	dataset := make([]uint32, 32*65536/4)
+	generateDataset(keccakAlgo{}, dataset, 0, cache, nil)
+
 	hash := hexutil.MustDecode("0xc9149cc0386e689d789a1c2f3d5d169a61a6218ed30e74414dc736e442ef3d1f")
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		hashimotoFull(hash, types.EncodeNonce(0).Hash())
+		hashimotoFull(keccakAlgo{}, dataset, hash, 0)
 	}
 }
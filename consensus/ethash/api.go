@@ -17,11 +17,16 @@
 package ethash
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var errHmhashStopped = errors.New("hmhash stopped")
@@ -39,9 +44,14 @@ type API struct {
 //	result[1] - 32 bytes hex encoded seed hash used for DAG
 //	result[2] - 32 bytes hex encoded boundary condition ("target"), 2^256/difficulty
 //	result[3] - hex encoded block number
-func (api *API) GetWork() ([4]string, error) {
+//	result[4] - hex encoded work package version, see WorkVersion
+//	result[5] - comma separated capabilities of the remote sealer
+func (api *API) GetWork(ctx context.Context) ([]string, error) {
 	if api.hmhash.remote == nil {
-		return [4]string{}, errors.New("not supported")
+		return nil, errors.New("not supported")
+	}
+	if err := api.hmhash.remote.checkRequest(ctx, methodGetWork, 0); err != nil {
+		return nil, err
 	}
 
 	var (
@@ -51,36 +61,152 @@ func (api *API) GetWork() ([4]string, error) {
 	select {
 	case api.hmhash.remote.fetchWorkCh <- &sealWork{errc: errc, res: workCh}:
 	case <-api.hmhash.remote.exitCh:
-		return [4]string{}, errHmhashStopped
+		return nil, errHmhashStopped
 	}
 	select {
 	case work := <-workCh:
-		return work, nil
+		return api.hmhash.versionWork(work), nil
 	case err := <-errc:
-		return [4]string{}, err
+		return nil, err
 	}
 }
 
 // SubmitWork can be used by external miner to submit their POW solution.
 // It returns an indication if the work was accepted.
 // Note either an invalid solution, a stale work a non-existent work will return false.
-func (api *API) SubmitWork(nonce types.BlockNonce, hash, digest common.Hash) bool {
+//
+// If submission tokens are configured, the solution has to carry one and is
+// credited to the worker bound to it.
+func (api *API) SubmitWork(ctx context.Context, nonce types.BlockNonce, hash, digest common.Hash, token *string) bool {
+	return api.submitWorkToken(ctx, nonce, hash, digest, token) == nil
+}
+
+// submitWorkToken submits a POW solution carrying a submission token, returning
+// why it was rejected, if so.
+func (api *API) submitWorkToken(ctx context.Context, nonce types.BlockNonce, hash, digest common.Hash, token *string) error {
+	worker, source, err := api.authorizeWork(ctx, hash, token, "")
+	if err != nil {
+		return err
+	}
+	return api.submitWorkFrom(ctx, nonce, hash, digest, worker, source)
+}
+
+// authorizeWork rate limits a remote work submission and checks its submission
+// token, returning the worker credited with it and the source tracked for bans.
+// The worker is the one bound to the token, or the given name if submissions
+// aren't authenticated, and anonymous miners are tracked by IP address.
+func (api *API) authorizeWork(ctx context.Context, hash common.Hash, token *string, name string) (string, string, error) {
 	if api.hmhash.remote == nil {
-		return false
+		return "", "", errNoMiningWork
+	}
+	var worker string
+	err := api.hmhash.remote.checkRequest(ctx, methodSubmitWork, tokenSize(token)+len(name))
+	if err == nil {
+		worker, err = api.hmhash.remote.auth.authorize(token)
 	}
+	if err != nil {
+		api.hmhash.logs.sealer.Debug("Rejected remote work submission", logSealHash, hash, "err", err)
+		markSubmitRejection(err)
+		return "", "", err
+	}
+	if api.hmhash.remote.auth == nil {
+		worker = name
+	}
+	source := worker
+	if source == "" {
+		source = requestSource(ctx)
+	}
+	return worker, source, nil
+}
 
+// submitWork submits a POW solution on behalf of a named worker, which is
+// credited with a share if share accounting is enabled.
+func (api *API) submitWork(nonce types.BlockNonce, hash, digest common.Hash, worker string) bool {
+	return api.submitWorkFrom(context.Background(), nonce, hash, digest, worker, worker) == nil
+}
+
+// submitWorkFrom submits a POW solution on behalf of a named worker, tracking
+// duplicate and invalid solutions of the source, rejected if banned. It returns
+// why the solution was rejected, if so.
+func (api *API) submitWorkFrom(ctx context.Context, nonce types.BlockNonce, hash, digest common.Hash, worker, source string) (err error) {
+	if api.hmhash.remote == nil {
+		return errNoMiningWork
+	}
+	ctx, span := api.hmhash.startSpan(ctx, "hmhash.SubmitWork", attribute.String("hmhash.sealhash", hash.Hex()), attribute.String("hmhash.source", source))
+	defer func() {
+		span.SetAttributes(attribute.Bool("hmhash.accepted", err == nil))
+		span.End()
+	}()
+	if api.hmhash.remote.bans.banned(source, time.Now()) {
+		api.hmhash.events.reject.Send(SolutionRejected{SealHash: hash, Nonce: nonce, Source: source, Reason: RejectBanned})
+		markSubmitRejection(errBannedSubmitter)
+		return errBannedSubmitter
+	}
 	var errc = make(chan error, 1)
 	select {
 	case api.hmhash.remote.submitWorkCh <- &mineResult{
 		nonce:     nonce,
 		mixDigest: digest,
 		hash:      hash,
+		worker:    worker,
+		source:    source,
+		received:  time.Now(),
+		ctx:       ctx,
 		errc:      errc,
 	}:
+	case <-api.hmhash.remote.exitCh:
+		return errHmhashStopped
+	}
+	return <-errc
+}
+
+// GetAuxWork returns a work package for a miner merge-mining from a parent
+// chain.
+//
+// The work package consists of 3 strings:
+//
+//	result[0] - 32 bytes hex encoded commitment the parent chain header's extra-data has to end with
+//	result[1] - 32 bytes hex encoded boundary condition ("target"), 2^256/difficulty
+//	result[2] - hex encoded block number
+func (api *API) GetAuxWork(ctx context.Context) ([3]string, error) {
+	work, err := api.GetWork(ctx)
+	if err != nil {
+		return [3]string{}, err
+	}
+	return [3]string{work[0], work[2], work[3]}, nil
+}
+
+// SubmitAuxWork can be used by a merge-mining miner to submit the RLP encoded
+// parent chain header committing to a work package. It returns an indication
+// if the work was accepted. Like SubmitWork, it requires a submission token if
+// tokens are configured.
+func (api *API) SubmitAuxWork(ctx context.Context, header hexutil.Bytes, token *string) bool {
+	if api.hmhash.remote == nil {
+		return false
+	}
+	err := api.hmhash.remote.checkRequest(ctx, methodSubmitWork, len(header)+tokenSize(token))
+	if err == nil {
+		_, err = api.hmhash.remote.auth.authorize(token)
+	}
+	if err != nil {
+		api.hmhash.logs.sealer.Debug("Rejected remote aux work submission", "err", err)
+		return false
+	}
+	aux := new(types.Header)
+	if err := rlp.DecodeBytes(header, aux); err != nil {
+		return false
+	}
+	ctx, span := api.hmhash.startSpan(ctx, "hmhash.SubmitAuxWork", attribute.String("hmhash.parent", aux.Hash().Hex()))
+	defer span.End()
+
+	var errc = make(chan error, 1)
+	select {
+	case api.hmhash.remote.submitWorkCh <- &mineResult{aux: aux, received: time.Now(), ctx: ctx, errc: errc}:
 	case <-api.hmhash.remote.exitCh:
 		return false
 	}
-	err := <-errc
+	err = <-errc
+	span.SetAttributes(attribute.Bool("hmhash.accepted", err == nil))
 	return err == nil
 }
 
@@ -89,15 +215,61 @@ func (api *API) SubmitWork(nonce types.BlockNonce, hash, digest common.Hash) boo
 // which submit work through this node.
 //
 // It accepts the miner hash rate and an identifier which must be unique
-// between nodes.
-func (api *API) SubmitHashrate(rate hexutil.Uint64, id common.Hash) bool {
+// between nodes. If submission tokens are configured, the hash rate has to carry
+// one and the identifier is bound to the worker of the token. If a signing key
+// is registered for the identifier, the hash rate has to carry its signature
+// of HashrateSigHash and the Unix time it was signed at.
+func (api *API) SubmitHashrate(ctx context.Context, rate hexutil.Uint64, id common.Hash, token *string, sig *hexutil.Bytes, signed *hexutil.Uint64) bool {
+	var (
+		signature []byte
+		at        uint64
+	)
+	if sig != nil {
+		signature = *sig
+	}
+	if signed != nil {
+		at = uint64(*signed)
+	}
+	return api.submitHashrateToken(ctx, rate, id, token, signature, at)
+}
+
+// submitHashrateToken submits the hash rate of a remote miner carrying a
+// submission token and signature, rate limited and checked like every remote
+// hash rate regardless of the transport it arrived over.
+func (api *API) submitHashrateToken(ctx context.Context, rate hexutil.Uint64, id common.Hash, token *string, sig []byte, signed uint64) bool {
+	if api.hmhash.remote == nil {
+		return false
+	}
+	auth := api.hmhash.remote.auth
+
+	var worker string
+	err := api.hmhash.remote.checkRequest(ctx, methodSubmitHashrate, tokenSize(token)+len(sig))
+	if err == nil {
+		worker, err = auth.authorize(token)
+	}
+	if err == nil {
+		err = api.hmhash.remote.signers.verify(uint64(rate), id, signed, sig, time.Now())
+	}
+	if err == nil {
+		err = auth.bindHashrate(worker, id)
+	}
+	if err != nil {
+		api.hmhash.logs.sealer.Debug("Rejected remote hashrate submission", "id", id, "err", err)
+		return false
+	}
+	return api.submitHashrate(rate, id, worker)
+}
+
+// submitHashrate submits the hash rate of a remote miner without authentication,
+// on behalf of the worker bound to the id, if any.
+func (api *API) submitHashrate(rate hexutil.Uint64, id common.Hash, worker string) bool {
 	if api.hmhash.remote == nil {
 		return false
 	}
 
 	var done = make(chan struct{}, 1)
 	select {
-	case api.hmhash.remote.submitRateCh <- &hashrate{done: done, rate: uint64(rate), id: id}:
+	case api.hmhash.remote.submitRateCh <- &hashrate{done: done, rate: uint64(rate), id: id, worker: worker}:
 	case <-api.hmhash.remote.exitCh:
 		return false
 	}
@@ -111,3 +283,246 @@ func (api *API) SubmitHashrate(rate hexutil.Uint64, id common.Hash) bool {
 func (api *API) GetHashrate() uint64 {
 	return uint64(api.hmhash.Hashrate())
 }
+
+// AdminAPI exposes the hmhash methods touching the files of the node, served
+// under the admin namespace only.
+type AdminAPI struct {
+	hmhash *Hmhash
+	chain  consensus.ChainHeaderReader
+}
+
+// SetConfig applies a partial configuration update atomically, without
+// restarting the node. Omitted fields are left unchanged.
+func (api *AdminAPI) SetConfig(update RuntimeConfig) error {
+	return api.hmhash.SetRuntimeConfig(&update)
+}
+
+// SetLogVerbosity sets the log verbosity of a mining subsystem ("sealer",
+// "verifier" or "dataset") regardless of the node's verbosity, or reverts it to
+// the node's one if negative.
+func (api *AdminAPI) SetLogVerbosity(subsystem string, level int) error {
+	return api.hmhash.SetLogVerbosity(subsystem, level)
+}
+
+// StartRecording starts recording the work packages handed out to remote
+// miners and their submissions to a new file of the recordings directory.
+func (api *AdminAPI) StartRecording(name string) error {
+	return api.hmhash.StartRecording(name)
+}
+
+// StopRecording stops recording the remote mining session.
+func (api *AdminAPI) StopRecording() error {
+	return api.hmhash.StopRecording()
+}
+
+// Replay replays a remote mining session of the recordings directory against
+// the engine, reporting the submissions whose outcome differs from the recorded
+// one.
+func (api *AdminAPI) Replay(name string) (*ReplayResult, error) {
+	return api.hmhash.Replay(name)
+}
+
+// RegisterWorker registers the key of the given address to sign the hash rates
+// a remote worker submits under its hashrate id.
+func (api *AdminAPI) RegisterWorker(id common.Hash, signer common.Address) error {
+	return api.hmhash.RegisterHashrateSigner(id, signer)
+}
+
+// UnregisterWorker removes the signing key registered for a hashrate id,
+// reporting whether there was one.
+func (api *AdminAPI) UnregisterWorker(id common.Hash) bool {
+	return api.hmhash.UnregisterHashrateSigner(id)
+}
+
+// AddNotifyTarget starts notifying a URL of new work, persisting it across
+// restarts if a notify file is configured.
+func (api *AdminAPI) AddNotifyTarget(url string) error {
+	return api.hmhash.AddNotifyTarget(url)
+}
+
+// RemoveNotifyTarget stops notifying a URL of new work.
+func (api *AdminAPI) RemoveNotifyTarget(url string) error {
+	return api.hmhash.RemoveNotifyTarget(url)
+}
+
+// Benchmark runs the local mining threads on synthetic work at a block, the
+// genesis if unset, for a Go duration such as "30s", reporting the hashrate and
+// memory bandwidth of the node's hardware. The block has to be at most two
+// epochs past the current one, so no far-future DAG is generated.
+func (api *AdminAPI) Benchmark(duration string, block *hexutil.Uint64) (*BenchmarkResult, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return nil, err
+	}
+	var number uint64
+	if block != nil {
+		number = uint64(*block)
+	}
+	if err := checkDAGEpoch(api.chain.CurrentHeader().Number.Uint64(), number/epochLength); err != nil {
+		return nil, err
+	}
+	return api.hmhash.Benchmark(d, number)
+}
+
+// MakeDAG generates the mining DAG of an epoch up to two past the current one
+// into the DAG directory, returning once done.
+func (api *AdminAPI) MakeDAG(epoch hexutil.Uint64) error {
+	if err := checkDAGEpoch(api.chain.CurrentHeader().Number.Uint64(), uint64(epoch)); err != nil {
+		return err
+	}
+	api.hmhash.MakeDAG(uint64(epoch))
+	return nil
+}
+
+// ExportDAG writes the mining DAG of an epoch up to two past the current one to
+// a file of the export directory within the DAG directory, generating it if
+// needed, to be imported by other nodes with ImportDAG.
+func (api *AdminAPI) ExportDAG(epoch hexutil.Uint64, name string) error {
+	if err := checkDAGEpoch(api.chain.CurrentHeader().Number.Uint64(), uint64(epoch)); err != nil {
+		return err
+	}
+	return api.hmhash.ExportDAG(uint64(epoch), name)
+}
+
+// ImportDAG validates a mining DAG exported by ExportDAG from a file of the
+// export directory and copies it into the DAG directory.
+func (api *AdminAPI) ImportDAG(epoch hexutil.Uint64, name string) error {
+	if err := checkDAGEpoch(api.chain.CurrentHeader().Number.Uint64(), uint64(epoch)); err != nil {
+		return err
+	}
+	return api.hmhash.ImportDAG(uint64(epoch), name)
+}
+
+// MiningAPI exposes hmhash mining statistics, which unlike API are only served
+// under the hmhash namespace.
+type MiningAPI struct {
+	hmhash *Hmhash
+}
+
+// GetGPUStats returns the hashrate, temperature and utilization of the GPUs
+// selected for mining.
+func (api *MiningAPI) GetGPUStats() []GPUStats {
+	return api.hmhash.GPUStats()
+}
+
+// GetStaleWorkWindow returns the number of blocks for which solutions to old
+// work packages are accepted from remote miners.
+func (api *MiningAPI) GetStaleWorkWindow() hexutil.Uint64 {
+	return hexutil.Uint64(api.hmhash.StaleWorkWindow())
+}
+
+// SetStaleWorkWindow updates the number of blocks for which solutions to old
+// work packages are accepted from remote miners.
+func (api *MiningAPI) SetStaleWorkWindow(window hexutil.Uint64) error {
+	return api.hmhash.SetStaleWorkWindow(uint64(window))
+}
+
+// GetConfig returns the effective configuration of the engine which can be
+// changed at runtime.
+func (api *MiningAPI) GetConfig() *RuntimeConfig {
+	return api.hmhash.RuntimeConfig()
+}
+
+// GetLogVerbosity returns the log verbosity of each mining subsystem, -1 for the
+// ones following the node's verbosity.
+func (api *MiningAPI) GetLogVerbosity() map[string]int {
+	return api.hmhash.LogVerbosity()
+}
+
+// GetSolutionTraces returns the latency traces of the count most recent
+// solutions, oldest first, or of all the kept ones if count is not given.
+func (api *MiningAPI) GetSolutionTraces(count *hexutil.Uint64) []SolutionTrace {
+	limit := uint64(solutionTraceLimit)
+	if count != nil && uint64(*count) < limit {
+		limit = uint64(*count)
+	}
+	return api.hmhash.SolutionTraces(int(limit))
+}
+
+// GetHashrateBreakdown returns the hashrate of each local mining thread and
+// GPU, and of each remote miner which submitted its hashrate.
+func (api *MiningAPI) GetHashrateBreakdown() *HashrateBreakdown {
+	return api.hmhash.HashrateBreakdown()
+}
+
+// Status returns a health report of the engine: its mode and threads, the epoch
+// being sealed and whether its dataset is ready, the state of the remote sealer
+// and the time of the last sealed block.
+func (api *MiningAPI) Status() *Status {
+	return api.hmhash.Status()
+}
+
+// GetBannedWorkers returns the remote workers, or IP addresses of anonymous
+// miners, temporarily banned for submitting duplicate or invalid solutions.
+func (api *MiningAPI) GetBannedWorkers() []BannedWorker {
+	return api.hmhash.BannedWorkers()
+}
+
+// GetRegisteredWorkers returns the hashrate ids with a registered signing key.
+func (api *MiningAPI) GetRegisteredWorkers() []HashrateSigner {
+	return api.hmhash.HashrateSigners()
+}
+
+// GetNotifyTargets returns the delivery record of each URL notified of new
+// work, including whether it's quarantined for failing.
+func (api *MiningAPI) GetNotifyTargets() []NotifyTargetHealth {
+	return api.hmhash.NotifyTargets()
+}
+
+// VerifyDataset checks the verification caches and mining DAGs of an epoch
+// dumped on the node against their checksums.
+func (api *MiningAPI) VerifyDataset(epoch hexutil.Uint64) ([]DumpCheck, error) {
+	return api.hmhash.VerifyDataset(uint64(epoch))
+}
+
+// GetHashrateHistory returns the local and remote hashrate between two Unix
+// times, averaged over step seconds if non-zero.
+func (api *MiningAPI) GetHashrateHistory(from, to, step hexutil.Uint64) ([]HashratePoint, error) {
+	return api.hmhash.HashrateHistory(uint64(from), uint64(to), uint64(step))
+}
+
+// GetWorkers returns the roster of the remote workers, with their last reported
+// hashrate and submission statistics.
+func (api *MiningAPI) GetWorkers() []RemoteWorker {
+	return api.hmhash.Workers()
+}
+
+// SubmitWorkDetailed submits a POW solution like eth_submitWork, returning the
+// code of the outcome and the reason of the rejection instead of a bare bool.
+func (api *MiningAPI) SubmitWorkDetailed(ctx context.Context, nonce types.BlockNonce, hash, digest common.Hash, token *string) *SubmitResult {
+	return newSubmitResult((&API{api.hmhash}).submitWorkToken(ctx, nonce, hash, digest, token))
+}
+
+// ForkStatus returns the share of the recently observed headers following other
+// consensus rules than the local ones, and whether a network split is suspected.
+func (api *MiningAPI) ForkStatus() (*ForkStatus, error) {
+	return api.hmhash.ForkStatus()
+}
+
+// VerifyWork checks a POW solution to the current or a recent work package
+// without submitting it, returning why it doesn't seal the block if invalid.
+func (api *MiningAPI) VerifyWork(hash common.Hash, nonce types.BlockNonce, digest common.Hash) *WorkVerification {
+	return api.hmhash.VerifyWork(hash, nonce, digest)
+}
+
+// SubmitShare submits a POW solution on behalf of a worker, crediting it with a
+// share if the solution meets the share difficulty. Like SubmitWork, it returns
+// whether the solution was accepted.
+func (api *MiningAPI) SubmitShare(worker string, nonce types.BlockNonce, hash, digest common.Hash) bool {
+	return (&API{api.hmhash}).submitWork(nonce, hash, digest, worker)
+}
+
+// GetShares returns the share statistics of every worker which submitted a
+// share, or an error if share accounting is disabled.
+func (api *MiningAPI) GetShares() (map[string]*WorkerShares, error) {
+	if api.hmhash.shares == nil {
+		return nil, errSharesDisabled
+	}
+	return api.hmhash.shares.workerShares(), nil
+}
+
+// GetShareAudit returns the latest audit of the shares of every named worker
+// against its reported hashrate, or an error if share accounting is disabled.
+func (api *MiningAPI) GetShareAudit() ([]ShareAudit, error) {
+	return api.hmhash.ShareAudits()
+}
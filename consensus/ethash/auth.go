@@ -0,0 +1,109 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	"golang.org/x/time/rate"
+)
+
+var (
+	errMissingToken  = errors.New("missing submission token")
+	errUnknownToken  = errors.New("unknown submission token")
+	errTokenThrottle = errors.New("submission rate limit exceeded")
+	errHashrateOwner = errors.New("hashrate id bound to another worker")
+)
+
+var authRejectMeter = metrics.NewRegisteredMeter("hmhash/remote/auth/rejected", nil)
+
+// submitAuth authenticates remote work and hashrate submissions by API token,
+// binding each token to a worker identity and limiting its submission rate.
+type submitAuth struct {
+	tokens map[string]string        // Worker bound to each token
+	limits map[string]*rate.Limiter // Submission rate limiter of each token, nil if unlimited
+
+	lock sync.Mutex
+	ids  map[common.Hash]string // Worker bound to each submitted hashrate id
+}
+
+// newSubmitAuth creates the authenticator of the given token to worker mapping,
+// allowing limit submissions per second for each token. It returns nil if there
+// are no tokens, accepting anonymous submissions.
+func newSubmitAuth(tokens map[string]string, limit float64) *submitAuth {
+	if len(tokens) == 0 {
+		return nil
+	}
+	auth := &submitAuth{
+		tokens: make(map[string]string, len(tokens)),
+		ids:    make(map[common.Hash]string),
+	}
+	if limit > 0 {
+		auth.limits = make(map[string]*rate.Limiter, len(tokens))
+	}
+	for token, worker := range tokens {
+		auth.tokens[token] = worker
+		if auth.limits != nil {
+			auth.limits[token] = rate.NewLimiter(rate.Limit(limit), int(math.Max(1, math.Ceil(limit))))
+		}
+	}
+	return auth
+}
+
+// authorize checks a submission token and its rate limit, returning the worker
+// bound to it. Without authentication every submission is anonymous.
+func (a *submitAuth) authorize(token *string) (string, error) {
+	if a == nil {
+		return "", nil
+	}
+	err := errMissingToken
+	if token != nil {
+		worker, ok := a.tokens[*token]
+		switch {
+		case !ok:
+			err = errUnknownToken
+		case a.limits != nil && !a.limits[*token].Allow():
+			err = errTokenThrottle
+		default:
+			return worker, nil
+		}
+	}
+	authRejectMeter.Mark(1)
+	return "", err
+}
+
+// bindHashrate binds a hashrate id to the worker submitting it, rejecting the
+// hashrates of ids bound to another worker so workers can't overwrite each
+// other's reports.
+func (a *submitAuth) bindHashrate(worker string, id common.Hash) error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if owner, ok := a.ids[id]; ok && owner != worker {
+		authRejectMeter.Mark(1)
+		return errHashrateOwner
+	}
+	a.ids[id] = worker
+	return nil
+}
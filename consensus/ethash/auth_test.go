@@ -0,0 +1,87 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that submission tokens are checked, rate limited and bound to workers.
+func TestSubmitAuth(t *testing.T) {
+	auth := newSubmitAuth(map[string]string{"secret": "rig1"}, 1)
+
+	token, unknown := "secret", "guess"
+	if _, err := auth.authorize(nil); err != errMissingToken {
+		t.Errorf("missing token error mismatch: have %v, want %v", err, errMissingToken)
+	}
+	if _, err := auth.authorize(&unknown); err != errUnknownToken {
+		t.Errorf("unknown token error mismatch: have %v, want %v", err, errUnknownToken)
+	}
+	if worker, err := auth.authorize(&token); err != nil || worker != "rig1" {
+		t.Errorf("worker mismatch: have %q (%v), want %q", worker, err, "rig1")
+	}
+	if _, err := auth.authorize(&token); err != errTokenThrottle {
+		t.Errorf("throttled token error mismatch: have %v, want %v", err, errTokenThrottle)
+	}
+	// Without tokens, every submission is anonymous
+	if worker, err := newSubmitAuth(nil, 1).authorize(nil); err != nil || worker != "" {
+		t.Errorf("anonymous submission rejected: %q (%v)", worker, err)
+	}
+}
+
+// Tests that remote submissions require a valid token if tokens are configured,
+// and that hashrate ids can't be taken over by other workers. Seals aren't
+// verified, so only authentication decides over the work submissions.
+func TestSubmitAuthRemote(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, SubmitTokens: map[string]string{"a": "rig1", "b": "rig2"}}, nil, true)
+	defer hmhash.Close()
+
+	var (
+		api    = &API{hmhash}
+		id     = common.HexToHash("a")
+		a, b   = "a", "b"
+		header = &types.Header{Number: common.Big1, Difficulty: common.Big1}
+	)
+	if api.SubmitHashrate(context.Background(), hexutil.Uint64(100), id, nil, nil, nil) {
+		t.Errorf("unauthenticated hashrate accepted")
+	}
+	if !api.SubmitHashrate(context.Background(), hexutil.Uint64(100), id, &a, nil, nil) {
+		t.Errorf("authenticated hashrate rejected")
+	}
+	if api.SubmitHashrate(context.Background(), hexutil.Uint64(200), id, &b, nil, nil) {
+		t.Errorf("hashrate of another worker's id accepted")
+	}
+	if have := hmhash.Hashrate(); have != 100 {
+		t.Errorf("hashrate mismatch: have %f, want 100", have)
+	}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+	if _, err := api.GetWork(context.Background()); err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	if api.SubmitWork(context.Background(), types.BlockNonce{}, hmhash.SealHash(header), common.Hash{}, nil) {
+		t.Errorf("unauthenticated work accepted")
+	}
+	if !api.SubmitWork(context.Background(), types.BlockNonce{}, hmhash.SealHash(header), common.Hash{}, &b) {
+		t.Errorf("authenticated work rejected")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// auxPoWLength is the maximum size of the parent chain header carried in the
+	// extra-data of merge-mined blocks, on top of the vanity.
+	auxPoWLength = 1024
+
+	// maxAuxPoWEpoch caps the epoch of parent chain headers, so a forged block
+	// number can't make us generate arbitrarily large verification caches.
+	maxAuxPoWEpoch = 2048
+)
+
+var (
+	// errInvalidAuxPoW is returned if the extra-data of a merge-mined block
+	// doesn't decode into a vanity and a parent chain header.
+	errInvalidAuxPoW = errors.New("invalid auxiliary proof-of-work")
+
+	// errAuxPoWFields is returned if a merge-mined block carries a proof-of-work
+	// nonce or mix digest of its own.
+	errAuxPoWFields = errors.New("proof-of-work fields set in merge-mined block")
+
+	// errMissingAuxCommitment is returned if the parent chain header of a
+	// merge-mined block doesn't commit to it.
+	errMissingAuxCommitment = errors.New("parent chain header doesn't commit to block")
+
+	// errAuxPoWEpoch is returned if the parent chain header of a merge-mined
+	// block is too far in the future to be verified.
+	errAuxPoWEpoch = errors.New("parent chain header epoch too high")
+)
+
+// auxPoW is the extra-data of a merge-mined block: the vanity of the block and
+// the parent chain header whose proof-of-work seals it.
+type auxPoW struct {
+	Vanity []byte
+	Parent *types.Header
+}
+
+// isAuxPoW reports whether the extra-data of a header carries an auxiliary
+// proof-of-work, which never fits into plain extra-data.
+func isAuxPoW(header *types.Header) bool {
+	return uint64(len(header.Extra)) > params.MaximumExtraDataSize
+}
+
+// decodeAuxPoW splits the extra-data of a merge-mined block into its vanity and
+// the parent chain header.
+func decodeAuxPoW(header *types.Header) (*auxPoW, error) {
+	aux := new(auxPoW)
+	if err := rlp.DecodeBytes(header.Extra, aux); err != nil || aux.Parent == nil || aux.Parent.Number == nil {
+		return nil, errInvalidAuxPoW
+	}
+	if uint64(len(aux.Vanity)) > params.MaximumExtraDataSize {
+		return nil, errInvalidAuxPoW
+	}
+	return aux, nil
+}
+
+// AuxCommitment returns the commitment a parent chain block has to end its
+// extra-data with to merge-mine a block: the seal hash of the block without the
+// auxiliary proof-of-work, which is also the hash of its work package.
+func (hmhash *Hmhash) AuxCommitment(header *types.Header) (common.Hash, error) {
+	if !isAuxPoW(header) {
+		return hmhash.SealHash(header), nil
+	}
+	aux, err := decodeAuxPoW(header)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	cpy := types.CopyHeader(header)
+	cpy.Extra = aux.Vanity
+	return hmhash.SealHash(cpy), nil
+}
+
+// AuxSeal returns a copy of the header merge-mined by the given parent chain
+// header, which has to commit to it.
+func AuxSeal(header *types.Header, parent *types.Header) (*types.Header, error) {
+	extra, err := rlp.EncodeToBytes(&auxPoW{Vanity: header.Extra, Parent: parent})
+	if err != nil {
+		return nil, err
+	}
+	cpy := types.CopyHeader(header)
+	cpy.Nonce, cpy.MixDigest = types.BlockNonce{}, common.Hash{}
+	cpy.Extra = extra
+	return cpy, nil
+}
+
+// verifyAuxPoW checks whether a merge-mined block is sealed by the proof-of-work
+// of a parent chain header committing to it, meeting the difficulty of the block.
+func (hmhash *Hmhash) verifyAuxPoW(header *types.Header) error {
+	if header.Difficulty.Sign() <= 0 {
+		return errInvalidDifficulty
+	}
+	if header.Nonce != (types.BlockNonce{}) || header.MixDigest != (common.Hash{}) {
+		return errAuxPoWFields
+	}
+	aux, err := decodeAuxPoW(header)
+	if err != nil {
+		return err
+	}
+	commitment, err := hmhash.AuxCommitment(header)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(aux.Parent.Extra, commitment[:]) {
+		return errMissingAuxCommitment
+	}
+	if !aux.Parent.Number.IsUint64() || aux.Parent.Number.Uint64()/epochLength > maxAuxPoWEpoch {
+		return errAuxPoWEpoch
+	}
+	digest, result := hmhash.auxPoWResult(aux.Parent)
+	if digest != aux.Parent.MixDigest {
+		return errInvalidMixDigest
+	}
+	target := new(big.Int).Div(two256, header.Difficulty)
+	if new(big.Int).SetBytes(result).Cmp(target) > 0 {
+		return errInvalidPoW
+	}
+	return nil
+}
+
+// auxPoWResult computes the proof-of-work of a parent chain header. Only the
+// verification cache is used, as the parent chain is rarely at the epoch of the
+// local dataset. The parent chain follows none of the local ethash rules, its
+// headers are sealed with the stock hashimoto.
+func (hmhash *Hmhash) auxPoWResult(parent *types.Header) (common.Hash, []byte) {
+	if hmhash.shared != nil {
+		return hmhash.shared.auxPoWResult(parent)
+	}
+	number := parent.Number.Uint64()
+
+	cache := hmhash.cache(nil, number)
+	digest, result := hmhash.powLight(nil, cache, number, hmhash.SealHash(parent).Bytes(), parent.Nonce.Uint64())
+	runtime.KeepAlive(cache)
+	return common.BytesToHash(digest), result
+}
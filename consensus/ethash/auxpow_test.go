@@ -0,0 +1,110 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that blocks merge-mined by a parent chain header committing to them are
+// accepted, both through header verification and remote work submission.
+func TestAuxPoW(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	chain := &testHeaderChain{config: &params.ChainConfig{Ethash: &params.EthashConfig{AuxPoWBlock: big.NewInt(0)}}}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(10), Extra: []byte("vanity")}
+
+	commitment, err := hmhash.AuxCommitment(header)
+	if err != nil || commitment != hmhash.SealHash(header) {
+		t.Fatalf("commitment mismatch: have %x (%v), want %x", commitment, err, hmhash.SealHash(header))
+	}
+	// Mine a parent chain header committing to the block at the block difficulty
+	parent := &types.Header{Number: big.NewInt(5), Difficulty: big.NewInt(1), Extra: append([]byte("pool"), commitment[:]...)}
+	target := new(big.Int).Div(two256, header.Difficulty)
+	for nonce := uint64(0); ; nonce++ {
+		parent.Nonce = types.EncodeNonce(nonce)
+		digest, result := hmhash.auxPoWResult(parent)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			parent.MixDigest = digest
+			break
+		}
+	}
+	sealed, err := AuxSeal(header, parent)
+	if err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	if err := hmhash.verifySeal(context.Background(), chain, sealed, false); err != nil {
+		t.Fatalf("failed to verify merge-mined block: %v", err)
+	}
+	if have, err := hmhash.AuxCommitment(sealed); err != nil || have != commitment {
+		t.Errorf("sealed commitment mismatch: have %x (%v), want %x", have, err, commitment)
+	}
+	// Merge-mined blocks are rejected before the fork and if tampered with
+	if err := hmhash.checkSeal(&testHeaderChain{config: &params.ChainConfig{Ethash: new(params.EthashConfig)}}, sealed, false); err == nil {
+		t.Errorf("merge-mined block accepted before the fork")
+	}
+	tampered := types.CopyHeader(sealed)
+	tampered.Time++
+	if err := hmhash.verifyAuxPoW(tampered); err != errMissingAuxCommitment {
+		t.Errorf("tampered block error mismatch: have %v, want %v", err, errMissingAuxCommitment)
+	}
+	tampered = types.CopyHeader(sealed)
+	tampered.Nonce = types.EncodeNonce(1)
+	if err := hmhash.verifyAuxPoW(tampered); err != errAuxPoWFields {
+		t.Errorf("proof-of-work fields error mismatch: have %v, want %v", err, errAuxPoWFields)
+	}
+	forged := types.CopyHeader(parent)
+	forged.MixDigest = common.Hash{1}
+	if tampered, _ = AuxSeal(header, forged); hmhash.verifyAuxPoW(tampered) != errInvalidMixDigest {
+		t.Errorf("forged parent chain header accepted")
+	}
+	// Submit the parent chain header for a remote work package
+	api := &API{hmhash}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+	work, err := api.GetAuxWork(context.Background())
+	if err != nil || work[0] != commitment.Hex() {
+		t.Fatalf("aux work mismatch: have %v (%v), want commitment %x", work, err, commitment)
+	}
+	enc, _ := rlp.EncodeToBytes(forged)
+	if api.SubmitAuxWork(context.Background(), enc, nil) {
+		t.Errorf("forged parent chain header accepted remotely")
+	}
+	enc, _ = rlp.EncodeToBytes(parent)
+	if !api.SubmitAuxWork(context.Background(), enc, nil) {
+		t.Fatalf("merge-mined work rejected")
+	}
+	select {
+	case block := <-results:
+		if !bytes.Equal(block.Extra(), sealed.Extra) {
+			t.Errorf("sealed extra-data mismatch: have %x, want %x", block.Extra(), sealed.Extra)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("merge-mined block not delivered")
+	}
+}
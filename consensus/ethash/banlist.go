@@ -0,0 +1,208 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	lrupkg "github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// defaultBanTime is how long an abusive submission source is banned if the
+	// config leaves it unset.
+	defaultBanTime = 10 * time.Minute
+
+	// banWindow is the period over which the bad submissions of a source are
+	// counted towards the ban threshold.
+	banWindow = time.Minute
+
+	// submitDedupSize is the number of recent solutions remembered to reject
+	// duplicates without verifying them again.
+	submitDedupSize = 4096
+
+	// maxBanRecords is the number of tracked sources above which the ones
+	// neither banned nor misbehaving in the current window are dropped.
+	maxBanRecords = 4096
+)
+
+var (
+	duplicateSubmitMeter = metrics.NewRegisteredMeter("hmhash/remote/submit/duplicate", nil)
+	invalidSubmitMeter   = metrics.NewRegisteredMeter("hmhash/remote/submit/invalid", nil)
+	bannedSubmitMeter    = metrics.NewRegisteredMeter("hmhash/remote/submit/banned", nil)
+	banMeter             = metrics.NewRegisteredMeter("hmhash/remote/bans", nil)
+)
+
+// BannedWorker is a source of remote work submissions temporarily banned for
+// submitting too many duplicate or invalid solutions.
+type BannedWorker struct {
+	Source     string    `json:"source"`     // Worker name, or IP address of anonymous submitters
+	Until      time.Time `json:"until"`      // Time the ban expires
+	Duplicates uint64    `json:"duplicates"` // Duplicate solutions submitted in the ban window
+	Invalid    uint64    `json:"invalid"`    // Invalid solutions submitted in the ban window
+}
+
+// submission identifies a solution to a work package.
+type submission struct {
+	hash  common.Hash
+	nonce types.BlockNonce
+}
+
+// submitRecord is the count of bad submissions of a source.
+type submitRecord struct {
+	window     time.Time // Start of the current counting window
+	duplicates uint64
+	invalid    uint64
+	until      time.Time // Time until which the source is banned
+}
+
+// banList tracks duplicate and invalid work submissions per source, banning the
+// sources exceeding a threshold for a while so they can't waste verification
+// CPU.
+type banList struct {
+	threshold uint64        // Bad submissions in a window banning a source, zero never bans
+	duration  time.Duration // Duration of the bans
+
+	seen lrupkg.BasicLRU[submission, struct{}] // Recent solutions, only accessed by the remote sealer loop
+
+	lock    sync.Mutex
+	records map[string]*submitRecord
+}
+
+// newBanList creates a ban list banning sources for the given duration after
+// threshold bad submissions within the ban window.
+func newBanList(threshold uint64, duration time.Duration) *banList {
+	if duration <= 0 {
+		duration = defaultBanTime
+	}
+	return &banList{
+		threshold: threshold,
+		duration:  duration,
+		seen:      lrupkg.NewBasicLRU[submission, struct{}](submitDedupSize),
+		records:   make(map[string]*submitRecord),
+	}
+}
+
+// duplicate reports whether a solution was submitted before, remembering it
+// otherwise.
+func (b *banList) duplicate(hash common.Hash, nonce types.BlockNonce) bool {
+	key := submission{hash, nonce}
+	if b.seen.Contains(key) {
+		return true
+	}
+	b.seen.Add(key, struct{}{})
+	return false
+}
+
+// banned reports whether submissions of a source are rejected. Untracked, empty
+// sources are never banned.
+func (b *banList) banned(source string, now time.Time) bool {
+	if source == "" {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	record := b.records[source]
+	if record == nil || !now.Before(record.until) {
+		return false
+	}
+	bannedSubmitMeter.Mark(1)
+	return true
+}
+
+// record counts a duplicate or invalid submission of a source, returning whether
+// it got the source banned.
+func (b *banList) record(source string, duplicate bool, now time.Time) bool {
+	if duplicate {
+		duplicateSubmitMeter.Mark(1)
+	} else {
+		invalidSubmitMeter.Mark(1)
+	}
+	if source == "" || b.threshold == 0 {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	record := b.records[source]
+	if record == nil {
+		if len(b.records) >= maxBanRecords {
+			b.prune(now)
+		}
+		record = new(submitRecord)
+		b.records[source] = record
+	}
+	if now.Sub(record.window) >= banWindow {
+		record.window, record.duplicates, record.invalid = now, 0, 0
+	}
+	if duplicate {
+		record.duplicates++
+	} else {
+		record.invalid++
+	}
+	if record.duplicates+record.invalid < b.threshold || now.Before(record.until) {
+		return false
+	}
+	record.until = now.Add(b.duration)
+	banMeter.Mark(1)
+	return true
+}
+
+// prune drops the records of the sources neither banned nor misbehaving in the
+// current window. The caller must hold the lock.
+func (b *banList) prune(now time.Time) {
+	for source, record := range b.records {
+		if !now.Before(record.until) && now.Sub(record.window) >= banWindow {
+			delete(b.records, source)
+		}
+	}
+}
+
+// list returns the currently banned sources, ordered by name.
+func (b *banList) list(now time.Time) []BannedWorker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	banned := make([]BannedWorker, 0)
+	for source, record := range b.records {
+		if now.Before(record.until) {
+			banned = append(banned, BannedWorker{
+				Source:     source,
+				Until:      record.until,
+				Duplicates: record.duplicates,
+				Invalid:    record.invalid,
+			})
+		}
+	}
+	sort.Slice(banned, func(i, j int) bool { return banned[i].Source < banned[j].Source })
+	return banned
+}
+
+// BannedWorkers returns the remote submission sources currently banned for
+// submitting too many duplicate or invalid solutions.
+func (hmhash *Hmhash) BannedWorkers() []BannedWorker {
+	if hmhash.remote == nil {
+		return nil
+	}
+	return hmhash.remote.bans.list(time.Now())
+}
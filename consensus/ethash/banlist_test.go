@@ -0,0 +1,94 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that sources are banned after too many bad submissions in a window, and
+// that the bans expire.
+func TestBanList(t *testing.T) {
+	var (
+		bans = newBanList(3, time.Minute)
+		now  = time.Now()
+	)
+	bans.record("rig", true, now)
+	bans.record("rig", false, now)
+
+	// Bad submissions of an older window don't count
+	if bans.record("rig", false, now.Add(banWindow)) || bans.banned("rig", now.Add(banWindow)) {
+		t.Fatalf("source banned across windows")
+	}
+	now = now.Add(banWindow)
+	bans.record("rig", false, now)
+	if !bans.record("rig", true, now) {
+		t.Fatalf("source not banned after reaching the threshold")
+	}
+	if !bans.banned("rig", now) || bans.banned("other", now) || bans.banned("", now) {
+		t.Errorf("ban status mismatch")
+	}
+	if list := bans.list(now); len(list) != 1 || list[0].Source != "rig" || list[0].Duplicates != 1 || list[0].Invalid != 2 {
+		t.Errorf("ban list mismatch: %+v", list)
+	}
+	if bans.banned("rig", now.Add(time.Minute)) {
+		t.Errorf("ban didn't expire")
+	}
+	// Anonymous sources and disabled banning never ban
+	if newBanList(1, 0).record("", false, now) || newBanList(0, 0).record("rig", false, now) {
+		t.Errorf("untracked source banned")
+	}
+}
+
+// Tests that the remote sealer rejects duplicate solutions without verifying
+// them and bans the workers submitting too many bad ones.
+func TestRemoteSubmitBans(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, SubmitBanThreshold: 2}, nil, true)
+	defer hmhash.Close()
+
+	var (
+		api    = &API{hmhash}
+		header = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+	if _, err := api.GetWork(context.Background()); err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	sealhash := hmhash.SealHash(header)
+	if !api.submitWork(types.EncodeNonce(1), sealhash, common.Hash{}, "honest") {
+		t.Fatalf("solution rejected")
+	}
+	if api.submitWork(types.EncodeNonce(1), sealhash, common.Hash{}, "copycat") {
+		t.Errorf("duplicate solution accepted")
+	}
+	// Solutions to unknown work are invalid, the second one banning the worker
+	for i := 0; i < 2; i++ {
+		api.submitWork(types.EncodeNonce(uint64(i)), common.Hash{1}, common.Hash{}, "spammer")
+	}
+	if api.submitWork(types.EncodeNonce(2), sealhash, common.Hash{}, "spammer") {
+		t.Errorf("banned worker's solution accepted")
+	}
+	if banned := hmhash.BannedWorkers(); len(banned) != 1 || banned[0].Source != "spammer" {
+		t.Errorf("banned workers mismatch: %+v", banned)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	crand "crypto/rand"
+	"errors"
+	mrand "math/rand"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// maxBenchmarkDuration is the longest benchmark run accepted, so a mistyped
+// duration doesn't take the mining threads away for long.
+const maxBenchmarkDuration = 10 * time.Minute
+
+var errBenchmarkDuration = errors.New("benchmark duration must be positive and at most 10m")
+
+// ThreadBenchmark is the result of a benchmark on a single mining thread.
+type ThreadBenchmark struct {
+	Hashes   hexutil.Uint64 `json:"hashes"`   // Nonces searched
+	Hashrate float64        `json:"hashrate"` // Nonces searched per second
+}
+
+// BenchmarkResult is the result of a benchmark of the local mining threads.
+type BenchmarkResult struct {
+	Block        hexutil.Uint64    `json:"block"`        // Block the synthetic work was at
+	Duration     string            `json:"duration"`     // Time the search ran, as a Go duration
+	Threads      []ThreadBenchmark `json:"threads"`      // Results of every thread
+	Hashrate     float64           `json:"hashrate"`     // Nonces searched per second by all threads
+	DatasetBytes hexutil.Uint64    `json:"datasetBytes"` // Size of the mining dataset searched
+	Bandwidth    float64           `json:"bandwidth"`    // Bytes of the dataset read per second by all threads
+}
+
+// datasetReadBytes returns the number of bytes of the mining dataset read per
+// nonce searched for a block.
+func datasetReadBytes(rules *params.EthashConfig, block uint64) uint64 {
+	switch {
+	case isCPUPoW(rules, block):
+		return 0
+	case isProgpow(rules, block):
+		return progpowCntDag * progpowEntryBytes
+	}
+	return loopAccesses * mixBytes
+}
+
+// Benchmark runs the nonce search of the local mining threads on synthetic work
+// at the given block for a fixed duration, measuring the hashrate and memory
+// bandwidth of the hardware. The threads are placed as when mining, and share
+// the CPUs with any mining going on. The work follows the ethash rules of the
+// chain last sealed on, if any.
+func (hmhash *Hmhash) Benchmark(duration time.Duration, block uint64) (*BenchmarkResult, error) {
+	if duration <= 0 || duration > maxBenchmarkDuration {
+		return nil, errBenchmarkDuration
+	}
+	hmhash.lock.Lock()
+	threads, affinity := hmhash.threads, hmhash.affinity
+	hmhash.lock.Unlock()
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	rules := hmhash.sealRules.Load()
+
+	var dataset *dataset
+	if !isCPUPoW(rules, block) {
+		dataset = hmhash.dataset(rules, block, false)
+	}
+	hash := make([]byte, 32)
+	crand.Read(hash)
+
+	var (
+		hashes = make([]uint64, threads)
+		pend   sync.WaitGroup
+		start  = time.Now()
+		end    = start.Add(duration)
+	)
+	for i := 0; i < threads; i++ {
+		pend.Add(1)
+		go func(id int) {
+			defer pend.Done()
+			affinity.apply(hmhash.logs.sealer)
+
+			dataset := dataset
+			if hmhash.numa != nil {
+				node := hmhash.numa.node(id)
+				hmhash.numa.pin(node)
+				if dataset != nil {
+					dataset = hmhash.numa.place(dataset, node)
+				}
+			}
+			nonce := uint64(id) << 40
+			for time.Now().Before(end) {
+				for j := 0; j < 64; j++ {
+					hmhash.powFull(rules, dataset, block, hash, nonce)
+					nonce++
+				}
+				hashes[id] += 64
+			}
+			runtime.KeepAlive(dataset)
+		}(i)
+	}
+	pend.Wait()
+	elapsed := time.Since(start)
+
+	result := &BenchmarkResult{
+		Block:        hexutil.Uint64(block),
+		Duration:     elapsed.String(),
+		DatasetBytes: hexutil.Uint64(hmhash.datasetSize(block)),
+	}
+	var total uint64
+	for _, n := range hashes {
+		total += n
+		result.Threads = append(result.Threads, ThreadBenchmark{
+			Hashes:   hexutil.Uint64(n),
+			Hashrate: float64(n) / elapsed.Seconds(),
+		})
+	}
+	result.Hashrate = float64(total) / elapsed.Seconds()
+	result.Bandwidth = result.Hashrate * float64(datasetReadBytes(rules, block))
+	if dataset == nil {
+		result.DatasetBytes = 0
+	}
+	return result, nil
+}
+
+// sealBenchmark seals a block with a random nonce, computing its proof-of-work
+// like a mining thread would but ignoring the difficulty target, so that the
+// hashing path is part of the block production benchmarks.
+func (hmhash *Hmhash) sealBenchmark(rules *params.EthashConfig, block *types.Block, results chan<- *types.Block) {
+	header := block.Header()
+	header.Nonce = types.EncodeNonce(mrand.Uint64())
+
+	sealAttemptMeter.Mark(1)
+	start := time.Now()
+	digest, _ := hmhash.computeSeal(rules, header, true)
+	header.MixDigest = common.BytesToHash(digest)
+	hmhash.hashrate.Mark(1)
+	benchmarkSealTimer.UpdateSince(start)
+
+	select {
+	case results <- block.WithSeal(header):
+	default:
+		hmhash.logs.sealer.Warn("Sealing result is not read by miner", "mode", "benchmark", logSealHash, hmhash.SealHash(header))
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that benchmarks report the hashrate of every thread and the dataset
+// bandwidth they imply.
+func TestBenchmark(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(2)
+
+	var (
+		chain = &headedChain{testHeaderChain: &testHeaderChain{}, head: &types.Header{Number: big.NewInt(0)}}
+		api   = &AdminAPI{hmhash: hmhash, chain: chain}
+	)
+	far := hexutil.Uint64((2 + maxDAGLookahead) * epochLength)
+	if _, err := api.Benchmark("50ms", &far); !errors.Is(err, errFutureEpoch) {
+		t.Errorf("far-future benchmark error mismatch: have %v, want %v", err, errFutureEpoch)
+	}
+	result, err := api.Benchmark("50ms", nil)
+	if err != nil {
+		t.Fatalf("failed to benchmark: %v", err)
+	}
+	if len(result.Threads) != 2 {
+		t.Fatalf("thread results mismatch: have %d, want 2", len(result.Threads))
+	}
+	var total float64
+	for i, thread := range result.Threads {
+		if thread.Hashes == 0 || thread.Hashrate <= 0 {
+			t.Errorf("thread %d: no hashes searched", i)
+		}
+		total += thread.Hashrate
+	}
+	if math.Abs(result.Hashrate-total) > total*1e-9 {
+		t.Errorf("aggregate hashrate mismatch: have %f, want %f", result.Hashrate, total)
+	}
+	if want := result.Hashrate * loopAccesses * mixBytes; result.Bandwidth != want {
+		t.Errorf("bandwidth mismatch: have %f, want %f", result.Bandwidth, want)
+	}
+	if result.DatasetBytes != testDatasetSize {
+		t.Errorf("dataset size mismatch: have %d, want %d", result.DatasetBytes, testDatasetSize)
+	}
+	for _, duration := range []time.Duration{0, -time.Second, time.Hour} {
+		if _, err := hmhash.Benchmark(duration, 0); err != errBenchmarkDuration {
+			t.Errorf("duration %v: error mismatch: have %v, want %v", duration, err, errBenchmarkDuration)
+		}
+	}
+}
+
+// Tests that benchmark mode seals blocks right away with the proof-of-work of
+// their nonce regardless of the difficulty, and accepts any seal.
+func TestSealBenchmark(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeBenchmark, CacheInitBytes: testCacheSize, DatasetInitBytes: testDatasetSize}, nil, false)
+	defer hmhash.Close()
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(common.Big1, 200)}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	var block *types.Block
+	select {
+	case block = <-results:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("benchmark seal timed out")
+	}
+	sealed := block.Header()
+	if digest, _ := hmhash.computeSeal(nil, sealed, false); common.BytesToHash(digest) != sealed.MixDigest {
+		t.Errorf("mix digest mismatch: have %x, want %x", sealed.MixDigest, digest)
+	}
+	if err := hmhash.verifySeal(context.Background(), nil, sealed, false); err != nil {
+		t.Errorf("benchmark seal rejected: %v", err)
+	}
+}
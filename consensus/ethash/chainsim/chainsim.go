@@ -0,0 +1,415 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package chainsim simulates networks of hmhash miners in memory, each running
+// its own chain and engine, to check that they converge under the difficulty
+// and reorg rules before the rules are changed on a live network.
+package chainsim
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// defaultBlockTime is the mean block interval the default hashrates of the
+	// nodes mine at on the genesis difficulty.
+	defaultBlockTime = 15 * time.Second
+
+	// defaultLatency is the propagation delay of blocks between connected nodes
+	// if the config leaves it unset.
+	defaultLatency = 500 * time.Millisecond
+)
+
+var errNoNodes = errors.New("no nodes to simulate")
+
+// Config is the configuration of a simulated network.
+type Config struct {
+	// Nodes is the number of miners in the network.
+	Nodes int
+
+	// Genesis is the genesis of the chains, nil for a test chain at the minimum
+	// difficulty. Its timestamp has to be far enough in the past for the virtual
+	// clock not to run ahead of the wall clock, or blocks would be in the future.
+	Genesis *core.Genesis
+
+	// Hashrates are the hashes per second of each node, deciding how fast they
+	// mine on the difficulty of their chain. Empty shares the hashrate mining
+	// the genesis difficulty every 15 seconds evenly.
+	Hashrates []float64
+
+	// Latency is the propagation delay of blocks between connected nodes. Zero
+	// uses the default of 500ms.
+	Latency time.Duration
+
+	// Engine creates the engine of a node, nil for an hmhash engine accepting
+	// any seal, so only the consensus rules decide over the blocks.
+	Engine func(node int) *ethash.Hmhash
+
+	// Seed seeds the random source mining the blocks, making runs reproducible.
+	Seed int64
+}
+
+// node is a simulated miner running its own chain.
+type node struct {
+	chain    *core.BlockChain
+	engine   *ethash.Hmhash
+	coinbase common.Address
+	hashrate float64
+	group    int    // Partition the node is in, nodes only reach the ones of their own
+	round    uint64 // Mining round, bumped to discard the mining events of old heads
+}
+
+// Network is a network of simulated miners, advanced in virtual time.
+type Network struct {
+	config  *params.ChainConfig
+	nodes   []*node
+	latency time.Duration
+	rand    *rand.Rand
+
+	start  uint64        // Timestamp the virtual clock started at
+	clock  time.Duration // Virtual time passed since the start
+	events eventQueue
+	seq    uint64
+	errs   []error
+}
+
+// New creates a network of simulated miners, all starting at the genesis.
+func New(config Config) (*Network, error) {
+	if config.Nodes <= 0 {
+		return nil, errNoNodes
+	}
+	genesis := config.Genesis
+	if genesis == nil {
+		genesis = &core.Genesis{
+			Config:     params.TestChainConfig,
+			Difficulty: params.MinimumDifficulty,
+			GasLimit:   params.GenesisGasLimit,
+			BaseFee:    big.NewInt(params.InitialBaseFee),
+		}
+	}
+	latency := config.Latency
+	if latency <= 0 {
+		latency = defaultLatency
+	}
+	n := &Network{
+		config:  genesis.Config,
+		latency: latency,
+		rand:    rand.New(rand.NewSource(config.Seed)),
+		start:   genesis.Timestamp,
+	}
+	for i := 0; i < config.Nodes; i++ {
+		engine := ethash.NewFaker()
+		if config.Engine != nil {
+			engine = config.Engine(i)
+		}
+		chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), nil, genesis, nil, engine, vm.Config{}, nil, nil)
+		if err != nil {
+			n.Close()
+			return nil, fmt.Errorf("node %d: %w", i, err)
+		}
+		hashrate := new(big.Float).SetInt(chain.Genesis().Difficulty())
+		rate, _ := hashrate.Quo(hashrate, big.NewFloat(defaultBlockTime.Seconds()*float64(config.Nodes))).Float64()
+		if i < len(config.Hashrates) {
+			rate = config.Hashrates[i]
+		}
+		n.nodes = append(n.nodes, &node{
+			chain:    chain,
+			engine:   engine,
+			coinbase: common.BigToAddress(big.NewInt(int64(i + 1))),
+			hashrate: rate,
+		})
+	}
+	for i := range n.nodes {
+		n.scheduleMining(i)
+	}
+	return n, nil
+}
+
+// Close stops the chains and engines of the nodes.
+func (n *Network) Close() {
+	for _, node := range n.nodes {
+		node.chain.Stop()
+		node.engine.Close()
+	}
+}
+
+// Chain returns the chain of a node.
+func (n *Network) Chain(i int) *core.BlockChain {
+	return n.nodes[i].chain
+}
+
+// Clock returns the virtual time passed since the start of the simulation.
+func (n *Network) Clock() time.Duration {
+	return n.clock
+}
+
+// Heads returns the head of the chain of every node.
+func (n *Network) Heads() []*types.Header {
+	heads := make([]*types.Header, len(n.nodes))
+	for i, node := range n.nodes {
+		heads[i] = node.chain.CurrentBlock()
+	}
+	return heads
+}
+
+// Converged reports whether every node has the same head.
+func (n *Network) Converged() bool {
+	head := n.nodes[0].chain.CurrentBlock().Hash()
+	for _, node := range n.nodes[1:] {
+		if node.chain.CurrentBlock().Hash() != head {
+			return false
+		}
+	}
+	return true
+}
+
+// Errors returns the errors of the blocks the nodes failed to mine or import,
+// such as blocks violating the consensus rules of the receiving node or reorgs
+// refused for being too deep.
+func (n *Network) Errors() []error {
+	return n.errs
+}
+
+// Partition splits the network into the given groups of nodes, which only
+// reach the nodes of their own group. Nodes not listed form a group of their
+// own. Blocks in flight between the groups are lost.
+func (n *Network) Partition(groups ...[]int) {
+	for _, node := range n.nodes {
+		node.group = 0
+	}
+	for i, group := range groups {
+		for _, id := range group {
+			n.nodes[id].group = i + 1
+		}
+	}
+}
+
+// Heal joins the partitions of the network, every node announcing its head to
+// all others, which sync the missing blocks from it.
+func (n *Network) Heal() {
+	for _, node := range n.nodes {
+		node.group = 0
+	}
+	for i, node := range n.nodes {
+		head := node.chain.CurrentBlock()
+		n.broadcast(i, node.chain.GetBlock(head.Hash(), head.Number.Uint64()))
+	}
+}
+
+// Run advances the virtual clock by the given duration, the nodes mining and
+// exchanging blocks meanwhile.
+func (n *Network) Run(duration time.Duration) {
+	end := n.clock + duration
+	for len(n.events) > 0 && n.events[0].at <= end {
+		n.process(heap.Pop(&n.events).(*event))
+	}
+	n.clock = end
+}
+
+// Settle delivers the blocks in flight without mining new ones, advancing the
+// virtual clock to the last delivery.
+func (n *Network) Settle() {
+	var pending []*event
+	for len(n.events) > 0 {
+		ev := heap.Pop(&n.events).(*event)
+		if ev.block == nil {
+			pending = append(pending, ev)
+			continue
+		}
+		n.process(ev)
+	}
+	// Mining is memoryless, continue it from the settled heads
+	for _, ev := range pending {
+		if ev.round == n.nodes[ev.node].round {
+			n.scheduleMining(ev.node)
+		}
+	}
+}
+
+// process handles an event at its virtual time.
+func (n *Network) process(ev *event) {
+	if ev.at > n.clock {
+		n.clock = ev.at
+	}
+	if ev.block != nil {
+		n.receive(ev.node, ev.from, ev.block)
+		return
+	}
+	if ev.round == n.nodes[ev.node].round {
+		n.mine(ev.node)
+	}
+}
+
+// scheduleMining schedules the next block of a node on top of its head, the
+// time to find it being exponentially distributed around the head's difficulty
+// over the node's hashrate.
+func (n *Network) scheduleMining(i int) {
+	node := n.nodes[i]
+	node.round++
+	if node.hashrate <= 0 {
+		return
+	}
+	difficulty, _ := new(big.Float).SetInt(node.chain.CurrentBlock().Difficulty).Float64()
+	delay := time.Duration(n.rand.ExpFloat64() * difficulty / node.hashrate * float64(time.Second))
+	n.push(&event{at: n.clock + delay, node: i, round: node.round})
+}
+
+// mine seals a block on top of the head of a node and broadcasts it.
+func (n *Network) mine(i int) {
+	node := n.nodes[i]
+	parent := node.chain.CurrentBlock()
+
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       n.start + uint64(n.clock/time.Second),
+		Coinbase:   node.coinbase,
+	}
+	if header.Time <= parent.Time {
+		header.Time = parent.Time + 1
+	}
+	if n.config.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(n.config, parent)
+	}
+	block, err := n.seal(node, header)
+	if err != nil {
+		n.errs = append(n.errs, fmt.Errorf("node %d: mining block %d: %w", i, header.Number, err))
+		n.scheduleMining(i)
+		return
+	}
+	n.insert(i, types.Blocks{block})
+}
+
+// seal assembles and seals a block of a node.
+func (n *Network) seal(node *node, header *types.Header) (*types.Block, error) {
+	if err := node.engine.Prepare(node.chain, header); err != nil {
+		return nil, err
+	}
+	parent := node.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	state, err := node.chain.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	block, err := node.engine.FinalizeAndAssemble(node.chain, header, state, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	results := make(chan *types.Block, 1)
+	if err := node.engine.Seal(node.chain, block, results, nil); err != nil {
+		return nil, err
+	}
+	return <-results, nil
+}
+
+// receive imports a block a node received from a peer, first syncing the
+// ancestors it misses from the peer.
+func (n *Network) receive(i, from int, block *types.Block) {
+	node, peer := n.nodes[i], n.nodes[from]
+	if node.group != peer.group || node.chain.HasBlock(block.Hash(), block.NumberU64()) {
+		return
+	}
+	blocks := types.Blocks{block}
+	for parent := block; !node.chain.HasBlock(parent.ParentHash(), parent.NumberU64()-1); {
+		if parent = peer.chain.GetBlock(parent.ParentHash(), parent.NumberU64()-1); parent == nil {
+			n.errs = append(n.errs, fmt.Errorf("node %d: ancestor of block %d missing at node %d", i, block.NumberU64(), from))
+			return
+		}
+		blocks = append(types.Blocks{parent}, blocks...)
+	}
+	n.insert(i, blocks)
+}
+
+// insert imports blocks into the chain of a node, relaying the imported ones
+// and mining on top of the new head, if changed.
+func (n *Network) insert(i int, blocks types.Blocks) {
+	node := n.nodes[i]
+	head := node.chain.CurrentBlock().Hash()
+
+	imported, err := node.chain.InsertChain(blocks)
+	if err != nil {
+		n.errs = append(n.errs, fmt.Errorf("node %d: importing block %d: %w", i, blocks[imported].NumberU64(), err))
+	}
+	if imported > 0 {
+		n.broadcast(i, blocks[imported-1])
+	}
+	if node.chain.CurrentBlock().Hash() != head {
+		n.scheduleMining(i)
+	}
+}
+
+// broadcast sends a block to every other node, arriving after the latency.
+func (n *Network) broadcast(i int, block *types.Block) {
+	for j := range n.nodes {
+		if j != i {
+			n.push(&event{at: n.clock + n.latency, node: j, from: i, block: block})
+		}
+	}
+}
+
+// push queues an event.
+func (n *Network) push(ev *event) {
+	ev.seq = n.seq
+	n.seq++
+	heap.Push(&n.events, ev)
+}
+
+// event is a block mined by a node or delivered to it at a virtual time.
+type event struct {
+	at    time.Duration
+	seq   uint64 // Order of the events at the same time
+	node  int
+	round uint64       // Mining round of the node a mining event belongs to
+	from  int          // Sender of a delivered block
+	block *types.Block // Delivered block, nil for mining events
+}
+
+// eventQueue is a priority queue of events by virtual time.
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) { *q = append(*q, x.(*event)) }
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	ev := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return ev
+}
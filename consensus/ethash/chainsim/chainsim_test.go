@@ -0,0 +1,84 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package chainsim
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that a connected network converges on a single chain, every block
+// passing the consensus rules of every node.
+func TestConvergence(t *testing.T) {
+	network, err := New(Config{Nodes: 4, Seed: 1})
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	defer network.Close()
+
+	network.Run(time.Hour)
+	network.Settle()
+	if !network.Converged() {
+		t.Fatalf("network didn't converge: %v", network.Heads())
+	}
+	if errs := network.Errors(); len(errs) > 0 {
+		t.Fatalf("blocks rejected: %v", errs)
+	}
+	head := network.Heads()[0]
+	if head.Number.Uint64() < 100 {
+		t.Errorf("too few blocks mined in an hour: %d", head.Number)
+	}
+}
+
+// Tests that partitioned networks mine competing chains, and reorg onto the
+// one with the most work once healed.
+func TestPartitionReorg(t *testing.T) {
+	// Give the first partition three times the hashrate of the second
+	network, err := New(Config{Nodes: 4, Hashrates: []float64{4000, 4000, 1000, 1000}, Seed: 2})
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	defer network.Close()
+
+	network.Run(10 * time.Minute)
+	network.Partition([]int{0, 1}, []int{2, 3})
+	network.Run(30 * time.Minute)
+	network.Settle()
+
+	heads := network.Heads()
+	if heads[0].Hash() == heads[2].Hash() {
+		t.Fatalf("partitions didn't fork")
+	}
+	var (
+		majority = network.Chain(0).GetTd(heads[0].Hash(), heads[0].Number.Uint64())
+		minority = network.Chain(2).GetTd(heads[2].Hash(), heads[2].Number.Uint64())
+	)
+	if majority.Cmp(minority) <= 0 {
+		t.Fatalf("majority partition has less work: %v <= %v", majority, minority)
+	}
+	network.Heal()
+	network.Settle()
+	if !network.Converged() {
+		t.Fatalf("network didn't converge after healing: %v", network.Heads())
+	}
+	if head := network.Heads()[2]; head.Hash() != heads[0].Hash() {
+		t.Errorf("minority didn't reorg onto the majority chain: have %d %x, want %d %x", head.Number, head.Hash(), heads[0].Number, heads[0].Hash())
+	}
+	if errs := network.Errors(); len(errs) > 0 {
+		t.Errorf("blocks rejected: %v", errs)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+)
+
+// defaultChainWorkInterval is the number of blocks between cumulative work
+// checkpoints if the engine config doesn't set one.
+const defaultChainWorkInterval = 1024
+
+var (
+	errInvalidWorkRange = errors.New("chain work range ends before it starts")
+	errNoChainWork      = errors.New("chain work unavailable")
+)
+
+// workCheckpoint is the cumulative work of the canonical chain up to a block.
+type workCheckpoint struct {
+	hash common.Hash // Hash of the block, to detect reorganizations
+	work *big.Int    // Summed difficulty of the blocks from genesis up to this one
+}
+
+// chainWork maintains checkpoints of the cumulative work of the canonical chain
+// every interval blocks, so the work over an arbitrary range only sums the
+// difficulty of the blocks past the closest checkpoints. Checkpoints are built
+// on demand and replaced once the chain reorganizes past them.
+type chainWork struct {
+	interval    uint64
+	checkpoints map[uint64]workCheckpoint
+	lock        sync.Mutex
+}
+
+// newChainWork creates an empty set of checkpoints every interval blocks.
+func newChainWork(interval uint64) *chainWork {
+	if interval == 0 {
+		interval = defaultChainWorkInterval
+	}
+	return &chainWork{
+		interval:    interval,
+		checkpoints: make(map[uint64]workCheckpoint),
+	}
+}
+
+// cumulative returns the summed difficulty of the canonical blocks from genesis
+// up to and including number.
+func (w *chainWork) cumulative(chain consensus.ChainHeaderReader, number uint64) (*big.Int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// Start from the closest checkpoint still on the canonical chain
+	var (
+		start = number - number%w.interval
+		work  *big.Int
+	)
+	for ; start > 0; start -= w.interval {
+		checkpoint, ok := w.checkpoints[start]
+		if !ok {
+			continue
+		}
+		if header := chain.GetHeaderByNumber(start); header != nil && header.Hash() == checkpoint.hash {
+			work = new(big.Int).Set(checkpoint.work)
+			break
+		}
+		delete(w.checkpoints, start)
+	}
+	if work == nil {
+		genesis := chain.GetHeaderByNumber(0)
+		if genesis == nil {
+			return nil, errUnknownBlock
+		}
+		work = new(big.Int).Set(genesis.Difficulty)
+	}
+	// Sum the blocks past it, checkpointing along the way
+	for n := start + 1; n <= number; n++ {
+		header := chain.GetHeaderByNumber(n)
+		if header == nil {
+			return nil, fmt.Errorf("%w: #%d", errUnknownBlock, n)
+		}
+		work.Add(work, header.Difficulty)
+		if n%w.interval == 0 {
+			w.checkpoints[n] = workCheckpoint{hash: header.Hash(), work: new(big.Int).Set(work)}
+		}
+	}
+	return work, nil
+}
+
+// span returns the summed difficulty of the canonical blocks from up to and
+// including to.
+func (w *chainWork) span(chain consensus.ChainHeaderReader, from, to uint64) (*big.Int, error) {
+	if to < from {
+		return nil, errInvalidWorkRange
+	}
+	work, err := w.cumulative(chain, to)
+	if err != nil || from == 0 {
+		return work, err
+	}
+	before, err := w.cumulative(chain, from-1)
+	if err != nil {
+		return nil, err
+	}
+	return work.Sub(work, before), nil
+}
+
+// ChainWorkAPI exposes the work done by the miners of the canonical chain for
+// the RPC interface, e.g. to estimate the cost of attacks.
+type ChainWorkAPI struct {
+	hmhash *Hmhash
+	chain  consensus.ChainHeaderReader
+}
+
+// GetChainWork returns the summed difficulty of the canonical blocks from up to
+// and including to.
+func (api *ChainWorkAPI) GetChainWork(from, to hexutil.Uint64) (*hexutil.Big, error) {
+	if api.hmhash.work == nil {
+		return nil, errNoChainWork
+	}
+	work, err := api.hmhash.work.span(api.chain, uint64(from), uint64(to))
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(work), nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// makeWorkChain creates a canonical chain of n+1 headers, the difficulty of each
+// given by diff.
+func makeWorkChain(n int, diff func(number int) int64) *testHeaderChain {
+	chain := &testHeaderChain{
+		config:    &params.ChainConfig{},
+		headers:   make(map[common.Hash]*types.Header),
+		canonical: make(map[uint64]common.Hash),
+	}
+	var parent common.Hash
+	for i := 0; i <= n; i++ {
+		header := &types.Header{ParentHash: parent, Number: big.NewInt(int64(i)), Difficulty: big.NewInt(diff(i))}
+		chain.headers[header.Hash()] = header
+		chain.canonical[uint64(i)] = header.Hash()
+		parent = header.Hash()
+	}
+	return chain
+}
+
+func TestChainWork(t *testing.T) {
+	chain := makeWorkChain(20, func(number int) int64 { return int64(number + 1) })
+	work := newChainWork(4)
+
+	tests := []struct {
+		from, to uint64
+		want     int64
+	}{
+		{0, 0, 1},
+		{0, 20, 231},
+		{5, 5, 6},
+		{3, 9, 4 + 5 + 6 + 7 + 8 + 9 + 10},
+		{8, 20, 231 - 36},
+		{0, 3, 10},
+	}
+	for i, tt := range tests {
+		have, err := work.span(chain, tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to compute work: %v", i, err)
+		}
+		if have.Int64() != tt.want {
+			t.Errorf("test %d: work mismatch: have %v, want %d", i, have, tt.want)
+		}
+	}
+	if len(work.checkpoints) != 5 {
+		t.Errorf("checkpoint count mismatch: have %d, want 5", len(work.checkpoints))
+	}
+	// Reorganize the chain past some checkpoints and ensure they're replaced
+	reorged := makeWorkChain(20, func(number int) int64 {
+		if number > 10 {
+			return 100
+		}
+		return int64(number + 1)
+	})
+	if have, err := work.span(reorged, 0, 20); err != nil || have.Int64() != 66+1000 {
+		t.Errorf("reorganized work mismatch: have %v, %v, want %d", have, err, 66+1000)
+	}
+	if checkpoint := work.checkpoints[16]; checkpoint.work.Int64() != 66+600 {
+		t.Errorf("reorganized checkpoint mismatch: have %v, want %d", checkpoint.work, 66+600)
+	}
+	// Invalid and unknown ranges are rejected
+	if _, err := work.span(chain, 5, 4); err != errInvalidWorkRange {
+		t.Errorf("inverted range error mismatch: have %v, want %v", err, errInvalidWorkRange)
+	}
+	if _, err := work.span(chain, 0, 21); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
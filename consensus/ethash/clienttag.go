@@ -0,0 +1,224 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// clientTagLength is the size of the client tag embedded into the extra-data:
+	// the magic, the major, minor and patch version, and the fork id checksum.
+	clientTagLength = 3 + 3 + 4
+
+	// defaultSoftwareBlocks is the number of recent blocks the miner software
+	// distribution is reported over if the caller doesn't choose.
+	defaultSoftwareBlocks = 1000
+
+	// maxSoftwareBlocks caps the number of blocks the miner software distribution
+	// is reported over, bounding the headers retrieved per call.
+	maxSoftwareBlocks = 10000
+
+	// unknownSoftware is the client reported for blocks not identifying their
+	// software in their extra-data.
+	unknownSoftware = "unknown"
+)
+
+// clientTagMagic starts the client tag, 0xff not being a valid first byte of
+// neither the printable vanities nor the RLP encoded version lists miners use.
+var clientTagMagic = []byte{0xff, 'h', 'm'}
+
+var errNoSoftwareBlocks = errors.New("miner software distribution needs at least one block")
+
+// ClientTag identifies the software which mined a block, embedded at the end of
+// the extra-data vanity.
+type ClientTag struct {
+	Major, Minor, Patch uint8
+	ForkHash            [4]byte // Fork id checksum of the rules the block was mined by
+}
+
+// String returns the client and version identified by the tag.
+func (tag *ClientTag) String() string {
+	return fmt.Sprintf("hmhash/v%d.%d.%d", tag.Major, tag.Minor, tag.Patch)
+}
+
+// encode returns the binary form of the tag embedded into the extra-data.
+func (tag *ClientTag) encode() []byte {
+	enc := make([]byte, 0, clientTagLength)
+	enc = append(enc, clientTagMagic...)
+	enc = append(enc, tag.Major, tag.Minor, tag.Patch)
+	return append(enc, tag.ForkHash[:]...)
+}
+
+// newClientTag creates the tag of the running client mining the given header,
+// with the fork id checksum of the rules enabled at it.
+func newClientTag(chain consensus.ChainHeaderReader, header *types.Header) *ClientTag {
+	tag := &ClientTag{Major: params.VersionMajor, Minor: params.VersionMinor, Patch: params.VersionPatch}
+	if genesis := chain.GetHeaderByNumber(0); genesis != nil {
+		tag.ForkHash = forkid.NewID(chain.Config(), genesis.Hash(), header.Number.Uint64(), header.Time).Hash
+	}
+	return tag
+}
+
+// parseClientTag returns the client tag ending an extra-data vanity, nil if none.
+func parseClientTag(vanity []byte) *ClientTag {
+	if len(vanity) < clientTagLength {
+		return nil
+	}
+	enc := vanity[len(vanity)-clientTagLength:]
+	if !bytes.HasPrefix(enc, clientTagMagic) {
+		return nil
+	}
+	tag := &ClientTag{Major: enc[3], Minor: enc[4], Patch: enc[5]}
+	copy(tag.ForkHash[:], enc[6:])
+	return tag
+}
+
+// embedClientTag appends a client tag to an extra-data vanity, replacing any tag
+// already there and truncating the vanity if needed to fit the maximum length.
+// The required prefix is never truncated, the tag being left out if the prefix
+// leaves no room for it.
+func embedClientTag(vanity []byte, prefix []byte, limit uint64, tag *ClientTag) []byte {
+	if parseClientTag(vanity) != nil && len(vanity)-clientTagLength >= len(prefix) {
+		vanity = vanity[:len(vanity)-clientTagLength]
+	}
+	if limit < uint64(len(prefix))+clientTagLength {
+		return vanity
+	}
+	if uint64(len(vanity)) > limit-clientTagLength {
+		vanity = vanity[:limit-clientTagLength]
+	}
+	return append(common.CopyBytes(vanity), tag.encode()...)
+}
+
+// parseSoftware returns the client and version which mined a block from its
+// extra-data vanity: the client tag if embedded, else the version list geth
+// style clients default to, and unknownSoftware otherwise.
+func parseSoftware(vanity []byte) string {
+	if tag := parseClientTag(vanity); tag != nil {
+		return tag.String()
+	}
+	var version struct {
+		Version uint
+		Name    string
+		Rest    []rlp.RawValue `rlp:"tail"`
+	}
+	if err := rlp.DecodeBytes(vanity, &version); err != nil || version.Name == "" {
+		return unknownSoftware
+	}
+	return fmt.Sprintf("%s/v%d.%d.%d", version.Name, version.Version>>16, version.Version>>8&0xff, version.Version&0xff)
+}
+
+// SoftwareShare is the share of the recent blocks mined by a client version.
+type SoftwareShare struct {
+	Client   string         `json:"client"`             // Client and version, or unknown
+	ForkHash *hexutil.Bytes `json:"forkHash,omitempty"` // Fork id checksum of tagged blocks, nil if untagged
+	Blocks   int            `json:"blocks"`
+	Share    float64        `json:"share"` // Percentage of the scanned blocks
+	Miners   int            `json:"miners"`
+	miners   map[common.Address]struct{}
+}
+
+// SoftwareDistribution is the distribution of the software mining the recent
+// blocks of the network.
+type SoftwareDistribution struct {
+	From    uint64           `json:"from"`    // First block scanned
+	To      uint64           `json:"to"`      // Last block scanned
+	Blocks  int              `json:"blocks"`  // Blocks scanned
+	Tagged  int              `json:"tagged"`  // Blocks carrying a client tag
+	Clients []*SoftwareShare `json:"clients"` // Shares by client version, largest first
+}
+
+// MinerSoftware reports the distribution of the software mining the last blocks
+// of the chain, identified by the client tags or the default version lists in
+// their extra-data. Fewer blocks are scanned close to genesis.
+func MinerSoftware(chain consensus.ChainHeaderReader, blocks uint64) (*SoftwareDistribution, error) {
+	if blocks == 0 {
+		return nil, errNoSoftwareBlocks
+	}
+	if blocks > maxSoftwareBlocks {
+		blocks = maxSoftwareBlocks
+	}
+	head := chain.CurrentHeader()
+	if head == nil {
+		return nil, errNoSoftwareBlocks
+	}
+	var (
+		dist   = &SoftwareDistribution{To: head.Number.Uint64(), Clients: []*SoftwareShare{}}
+		shares = make(map[string]*SoftwareShare)
+	)
+	for header := head; header != nil && uint64(dist.Blocks) < blocks && header.Number.Sign() > 0; {
+		// Tagged blocks are told apart by the fork rules they were mined by too
+		var (
+			client = unknownSoftware
+			fork   *hexutil.Bytes
+		)
+		if vanity, err := extraVanity(chain, header); err == nil {
+			if tag := parseClientTag(vanity); tag != nil {
+				hash := hexutil.Bytes(tag.ForkHash[:])
+				client, fork = fmt.Sprintf("%s@%x", tag, tag.ForkHash), &hash
+				dist.Tagged++
+			} else {
+				client = parseSoftware(vanity)
+			}
+		}
+		share := shares[client]
+		if share == nil {
+			share = &SoftwareShare{Client: client, ForkHash: fork, miners: make(map[common.Address]struct{})}
+			shares[client] = share
+			dist.Clients = append(dist.Clients, share)
+		}
+		share.Blocks++
+		share.miners[header.Coinbase] = struct{}{}
+
+		dist.From = header.Number.Uint64()
+		dist.Blocks++
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	if dist.Blocks == 0 {
+		return nil, errNoSoftwareBlocks
+	}
+	for _, share := range dist.Clients {
+		share.Share = float64(share.Blocks) * 100 / float64(dist.Blocks)
+		share.Miners = len(share.miners)
+	}
+	sort.SliceStable(dist.Clients, func(i, j int) bool {
+		return dist.Clients[i].Blocks > dist.Clients[j].Blocks
+	})
+	return dist, nil
+}
+
+// MinerSoftware reports the distribution of the software mining the given number
+// of recent blocks, 1000 if omitted.
+func (api *NetworkAPI) MinerSoftware(blocks *hexutil.Uint64) (*SoftwareDistribution, error) {
+	n := uint64(defaultSoftwareBlocks)
+	if blocks != nil {
+		n = uint64(*blocks)
+	}
+	return MinerSoftware(api.chain, n)
+}
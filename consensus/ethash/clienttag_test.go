@@ -0,0 +1,141 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that client tags are embedded at the end of the vanity, replacing any
+// previous one and truncating the vanity to fit.
+func TestEmbedClientTag(t *testing.T) {
+	tag := &ClientTag{Major: 1, Minor: 2, Patch: 3, ForkHash: [4]byte{0xde, 0xad, 0xbe, 0xef}}
+
+	extra := embedClientTag([]byte("farm/rig-1"), nil, 32, tag)
+	if !bytes.HasPrefix(extra, []byte("farm/rig-1")) || len(extra) != 10+clientTagLength {
+		t.Fatalf("tagged vanity mismatch: %x", extra)
+	}
+	if have := parseClientTag(extra); have == nil || *have != *tag {
+		t.Fatalf("parsed tag mismatch: have %v, want %v", have, tag)
+	}
+	if again := embedClientTag(extra, nil, 32, tag); !bytes.Equal(again, extra) {
+		t.Errorf("retagged vanity mismatch: have %x, want %x", again, extra)
+	}
+	long := embedClientTag(bytes.Repeat([]byte{'x'}, 32), nil, 32, tag)
+	if len(long) != 32 || parseClientTag(long) == nil {
+		t.Errorf("truncated vanity mismatch: %x", long)
+	}
+	// The required prefix is kept whole, leaving the tag out if there's no room
+	prefix := bytes.Repeat([]byte{'p'}, 20)
+	if kept := embedClientTag(append(prefix, "rig"...), prefix, 32, tag); !bytes.HasPrefix(kept, prefix) || len(kept) != 32 || parseClientTag(kept) == nil {
+		t.Errorf("prefixed vanity mismatch: %x", kept)
+	}
+	prefix = bytes.Repeat([]byte{'p'}, 28)
+	if kept := embedClientTag(prefix, prefix, 32, tag); !bytes.Equal(kept, prefix) {
+		t.Errorf("untaggable vanity mismatch: have %x, want %x", kept, prefix)
+	}
+	if parseClientTag([]byte("farm/rig-1")) != nil {
+		t.Errorf("untagged vanity parsed as tagged")
+	}
+}
+
+// Tests that the software is identified by the client tag, or the version list
+// geth style clients default to.
+func TestParseSoftware(t *testing.T) {
+	geth, _ := rlp.EncodeToBytes([]interface{}{uint(1<<16 | 10<<8 | 26), "geth", "go1.20.3", "linux"})
+
+	tests := []struct {
+		vanity []byte
+		want   string
+	}{
+		{embedClientTag(nil, nil, 32, &ClientTag{Major: 1, Minor: 11, Patch: 4}), "hmhash/v1.11.4"},
+		{geth, "geth/v1.10.26"},
+		{[]byte("farm/rig-1"), unknownSoftware},
+		{nil, unknownSoftware},
+	}
+	for i, tt := range tests {
+		if have := parseSoftware(tt.vanity); have != tt.want {
+			t.Errorf("test %d: software mismatch: have %q, want %q", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that prepared headers carry the tag of the client and the fork rules
+// enabled at them, and that the distribution of the software mining the recent
+// blocks is reported.
+func TestMinerSoftware(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeFake, ClientTag: true}, nil, false)
+	defer hmhash.Close()
+
+	var (
+		genesis = &types.Header{Number: new(big.Int), Difficulty: big.NewInt(131072), GasLimit: params.GenesisGasLimit}
+		chain   = &headedChain{
+			testHeaderChain: &testHeaderChain{
+				config:    params.TestChainConfig,
+				headers:   map[common.Hash]*types.Header{genesis.Hash(): genesis},
+				canonical: map[uint64]common.Hash{0: genesis.Hash()},
+			},
+			head: genesis,
+		}
+		geth, _ = rlp.EncodeToBytes([]interface{}{uint(1<<16 | 10<<8 | 26), "geth", "go1.20.3", "linux"})
+	)
+	for i := int64(1); i <= 8; i++ {
+		header := &types.Header{ParentHash: chain.head.Hash(), Number: big.NewInt(i), Time: uint64(i * 10), Coinbase: common.Address{byte(i % 2)}}
+		switch {
+		case i <= 4:
+			if err := hmhash.Prepare(chain, header); err != nil {
+				t.Fatalf("block %d: failed to prepare: %v", i, err)
+			}
+		case i <= 7:
+			header.Extra = geth
+		}
+		chain.headers[header.Hash()] = header
+		chain.canonical[uint64(i)] = header.Hash()
+		chain.head = header
+	}
+	want := forkid.NewID(params.TestChainConfig, genesis.Hash(), 1, 10).Hash
+	if tag := parseClientTag(chain.GetHeaderByNumber(1).Extra); tag == nil || tag.ForkHash != want || tag.Major != params.VersionMajor {
+		t.Fatalf("prepared tag mismatch: have %v, want fork hash %x", tag, want)
+	}
+	dist, err := MinerSoftware(chain, 100)
+	if err != nil {
+		t.Fatalf("failed to report miner software: %v", err)
+	}
+	if dist.From != 1 || dist.To != 8 || dist.Blocks != 8 || dist.Tagged != 4 || len(dist.Clients) != 3 {
+		t.Fatalf("distribution mismatch: %+v", dist)
+	}
+	if top := dist.Clients[0]; top.Blocks != 4 || top.Share != 50 || top.Miners != 2 || top.ForkHash == nil || !bytes.Equal(*top.ForkHash, want[:]) {
+		t.Errorf("tagged client mismatch: %+v", top)
+	}
+	if second := dist.Clients[1]; second.Client != "geth/v1.10.26" || second.Blocks != 3 || second.ForkHash != nil {
+		t.Errorf("geth client mismatch: %+v", second)
+	}
+	if last := dist.Clients[2]; last.Client != unknownSoftware || last.Blocks != 1 || last.Miners != 1 {
+		t.Errorf("unknown client mismatch: %+v", last)
+	}
+	if _, err := MinerSoftware(chain, 0); err != errNoSoftwareBlocks {
+		t.Errorf("zero blocks error mismatch: have %v, want %v", err, errNoSoftwareBlocks)
+	}
+}
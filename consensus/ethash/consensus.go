@@ -17,8 +17,11 @@
 package ethash
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"runtime"
 	"time"
@@ -33,6 +36,9 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -84,13 +90,17 @@ var (
 // error types into the consensus package.
 var (
 	errOlderBlockTime    = errors.New("timestamp older than parent")
+	errMedianTimePast    = errors.New("timestamp not past median of ancestors")
 	errTooManyUncles     = errors.New("too many uncles")
 	errDuplicateUncle    = errors.New("duplicate uncle")
 	errUncleIsAncestor   = errors.New("uncle is ancestor")
 	errDanglingUncle     = errors.New("uncle's parent is not ancestor")
 	errInvalidDifficulty = errors.New("non-positive difficulty")
+	errDifficultyRange   = errors.New("difficulty outside chain range")
 	errInvalidMixDigest  = errors.New("invalid mix digest")
 	errInvalidPoW        = errors.New("invalid proof-of-work")
+	errExtraTooLong      = errors.New("extra-data too long")
+	errWrongDifficulty   = errors.New("invalid difficulty")
 )
 
 // Author implements consensus.Engine, returning the header's coinbase as the
@@ -101,11 +111,14 @@ func (hmhash *Hmhash) Author(header *types.Header) (common.Address, error) {
 
 // VerifyHeader checks whether a header conforms to the consensus rules of the
 // stock Ethereum hmhash engine.
-func (hmhash *Hmhash) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+func (hmhash *Hmhash) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) (err error) {
 	// If we're running a full engine faking, accept any input as valid
 	if hmhash.config.PowMode == ModeFullFake {
 		return nil
 	}
+	ctx, span := hmhash.startSpan(context.Background(), "hmhash.VerifyHeader", attribute.Int64("hmhash.number", header.Number.Int64()), attribute.Bool("hmhash.seal", seal))
+	defer func() { endSpan(span, err) }()
+
 	// Short circuit if the header is known, or its parent not
 	number := header.Number.Uint64()
 	if chain.GetHeader(header.Hash(), number) != nil {
@@ -116,7 +129,9 @@ func (hmhash *Hmhash) VerifyHeader(chain consensus.ChainHeaderReader, header *ty
 		return consensus.ErrUnknownAncestor
 	}
 	// Sanity checks passed, do a proper verification
-	return hmhash.verifyHeader(chain, header, parent, false, seal, time.Now().Unix())
+	err = hmhash.verifyHeader(ctx, chain, header, parent, false, seal, time.Now().Unix())
+	hmhash.observeForkRules(chain, header, err)
+	return err
 }
 
 // VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers
@@ -132,6 +147,13 @@ func (hmhash *Hmhash) VerifyHeaders(chain consensus.ChainHeaderReader, headers [
 		return abort, results
 	}
 
+	ctx, span := hmhash.startSpan(context.Background(), "hmhash.VerifyHeaders", attribute.Int64("hmhash.number", headers[0].Number.Int64()), attribute.Int("hmhash.headers", len(headers)))
+
+	// Make the batch visible to the difficulty algorithms, the median-time-past
+	// rule and the hash algorithm rotation walking the ancestors
+	if config := chain.Config(); hasDifficultyAlgos(config) || (config.Ethash != nil && (config.Ethash.MedianTime != nil || config.Ethash.MultiAlgo != nil)) {
+		chain = newBatchHeaderReader(chain, headers)
+	}
 	// Spawn as many workers as allowed threads
 	workers := runtime.GOMAXPROCS(0)
 	if len(headers) < workers {
@@ -149,7 +171,7 @@ func (hmhash *Hmhash) VerifyHeaders(chain consensus.ChainHeaderReader, headers [
 	for i := 0; i < workers; i++ {
 		go func() {
 			for index := range inputs {
-				errors[index] = hmhash.verifyHeaderWorker(chain, headers, seals, index, unixNow)
+				errors[index] = hmhash.verifyHeaderWorker(ctx, chain, headers, seals, index, unixNow)
 				done <- index
 			}
 		}()
@@ -158,6 +180,7 @@ func (hmhash *Hmhash) VerifyHeaders(chain consensus.ChainHeaderReader, headers [
 	errorsOut := make(chan error, len(headers))
 	go func() {
 		defer close(inputs)
+		defer span.End()
 		var (
 			in, out = 0, 0
 			checked = make([]bool, len(headers))
@@ -172,12 +195,17 @@ func (hmhash *Hmhash) VerifyHeaders(chain consensus.ChainHeaderReader, headers [
 				}
 			case index := <-done:
 				for checked[index] = true; checked[out]; out++ {
+					if errors[out] != nil {
+						span.RecordError(errors[out], trace.WithAttributes(attribute.Int64("hmhash.number", headers[out].Number.Int64())))
+						span.SetStatus(codes.Error, errors[out].Error())
+					}
 					errorsOut <- errors[out]
 					if out == len(headers)-1 {
 						return
 					}
 				}
 			case <-abort:
+				span.SetAttributes(attribute.Bool("hmhash.aborted", true))
 				return
 			}
 		}
@@ -185,7 +213,7 @@ func (hmhash *Hmhash) VerifyHeaders(chain consensus.ChainHeaderReader, headers [
 	return abort, errorsOut
 }
 
-func (hmhash *Hmhash) verifyHeaderWorker(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool, index int, unixNow int64) error {
+func (hmhash *Hmhash) verifyHeaderWorker(ctx context.Context, chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool, index int, unixNow int64) error {
 	var parent *types.Header
 	if index == 0 {
 		parent = chain.GetHeader(headers[0].ParentHash, headers[0].Number.Uint64()-1)
@@ -195,7 +223,9 @@ func (hmhash *Hmhash) verifyHeaderWorker(chain consensus.ChainHeaderReader, head
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
-	return hmhash.verifyHeader(chain, headers[index], parent, false, seals[index], unixNow)
+	err := hmhash.verifyHeader(ctx, chain, headers[index], parent, false, seals[index], unixNow)
+	hmhash.observeForkRules(chain, headers[index], err)
+	return err
 }
 
 // VerifyUncles verifies that the given block's uncles conform to the consensus
@@ -254,7 +284,7 @@ func (hmhash *Hmhash) VerifyUncles(chain consensus.ChainReader, block *types.Blo
 		if ancestors[uncle.ParentHash] == nil || uncle.ParentHash == block.ParentHash() {
 			return errDanglingUncle
 		}
-		if err := hmhash.verifyHeader(chain, uncle, ancestors[uncle.ParentHash], true, true, time.Now().Unix()); err != nil {
+		if err := hmhash.verifyHeader(context.Background(), chain, uncle, ancestors[uncle.ParentHash], true, true, time.Now().Unix()); err != nil {
 			return err
 		}
 	}
@@ -264,10 +294,36 @@ func (hmhash *Hmhash) VerifyUncles(chain consensus.ChainReader, block *types.Blo
 // verifyHeader checks whether a header conforms to the consensus rules of the
 // stock Ethereum hmhash engine.
 // See YP section 4.3.4. "Block Header Validity"
-func (hmhash *Hmhash) verifyHeader(chain consensus.ChainHeaderReader, header, parent *types.Header, uncle bool, seal bool, unixNow int64) error {
+func (hmhash *Hmhash) verifyHeader(ctx context.Context, chain consensus.ChainHeaderReader, header, parent *types.Header, uncle bool, seal bool, unixNow int64) error {
+	// Ensure that the header doesn't reorganize the chain across a finalized checkpoint
+	if !uncle && hmhash.final != nil {
+		if err := hmhash.final.verify(chain, header); err != nil {
+			return err
+		}
+	}
+	// Report the header if it's the tip of a deep competing chain, and ensure it
+	// doesn't reorganize the chain too deep below the head
+	if !uncle {
+		hmhash.checkCompetingChain(chain, header)
+		if err := hmhash.reorgs.verify(chain, header); err != nil {
+			return err
+		}
+	}
 	// Ensure that the header's extra-data section is of a reasonable size
-	if uint64(len(header.Extra)) > params.MaximumExtraDataSize {
-		return fmt.Errorf("extra-data too long: %d > %d", len(header.Extra), params.MaximumExtraDataSize)
+	maxExtra := params.MaximumExtraDataSize
+	if rules := chain.Config().Ethash.ExtraDataRules(header.Number); rules != nil {
+		maxExtra = rules.MaxVanity()
+	}
+	if chain.Config().Ethash.IsValidatorBlock(header.Number) {
+		maxExtra += validatorSealLength
+	} else if chain.Config().IsAuxPoW(header.Number) {
+		maxExtra += auxPoWLength
+	}
+	if uint64(len(header.Extra)) > maxExtra {
+		return fmt.Errorf("%w: %d > %d", errExtraTooLong, len(header.Extra), maxExtra)
+	}
+	if err := verifyExtraData(chain, header); err != nil {
+		return err
 	}
 	// Verify the header's timestamp
 	if !uncle {
@@ -278,11 +334,19 @@ func (hmhash *Hmhash) verifyHeader(chain consensus.ChainHeaderReader, header, pa
 	if header.Time <= parent.Time {
 		return errOlderBlockTime
 	}
+	if mtp := chain.Config().Ethash.MedianTimeAt(header.Number); mtp != nil {
+		if median := medianTimePast(chain, parent, mtp.Ancestors()); header.Time <= median {
+			return fmt.Errorf("%w: have %d, median %d", errMedianTimePast, header.Time, median)
+		}
+	}
 	// Verify the block's difficulty based on its timestamp and parent's difficulty
+	if bounds := chain.Config().Ethash.DifficultyRangeAt(header.Number); bounds != nil && !chain.Config().Ethash.IsValidatorBlock(header.Number) && !inDifficultyRange(bounds, header.Difficulty) {
+		return fmt.Errorf("%w: %v", errDifficultyRange, header.Difficulty)
+	}
 	expected := hmhash.CalcDifficulty(chain, header.Time, parent)
 
 	if expected.Cmp(header.Difficulty) != 0 {
-		return fmt.Errorf("invalid difficulty: have %v, want %v", header.Difficulty, expected)
+		return fmt.Errorf("%w: have %v, want %v", errWrongDifficulty, header.Difficulty, expected)
 	}
 	// Verify that the gas limit is <= 2^63-1
 	if header.GasLimit > params.MaxGasLimit {
@@ -314,7 +378,7 @@ func (hmhash *Hmhash) verifyHeader(chain consensus.ChainHeaderReader, header, pa
 	}
 	// Verify the engine specific seal securing the block
 	if seal {
-		if err := hmhash.verifySeal(chain, header, false); err != nil {
+		if err := hmhash.verifySeal(ctx, chain, header, false); err != nil {
 			return err
 		}
 	}
@@ -330,16 +394,85 @@ func (hmhash *Hmhash) verifyHeader(chain consensus.ChainHeaderReader, header, pa
 
 // CalcDifficulty is the difficulty adjustment algorithm. It returns
 // the difficulty that a new block should have when created at time
-// given the parent block's time and difficulty.
+// given the parent block's time and difficulty. The chain config may switch to
+// an alternative algorithm, averaging over the ancestors of the block.
 func (hmhash *Hmhash) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
-	return CalcDifficulty(chain.Config(), time, parent)
+	return calcDifficulty(chain, chain.Config(), time, parent)
+}
+
+// calcDifficulty computes the difficulty of a block with the algorithm active at
+// it, walking the ancestors through chain for the windowed ones. Validator sealed
+// blocks have the minimal difficulty.
+func calcDifficulty(chain headerReader, config *params.ChainConfig, time uint64, parent *types.Header) *big.Int {
+	if config.Ethash.IsValidatorBlock(new(big.Int).Add(parent.Number, big1)) {
+		return new(big.Int).Set(validatorDifficulty)
+	}
+	parent = validatorParent(chain, config, time, parent)
+	parent = rotationParent(chain, config, time, parent)
+	if hasDifficultyAlgos(config) {
+		next := new(big.Int).Add(parent.Number, big1)
+		if algo := config.Ethash.DifficultyAlgo(next); algo != nil {
+			if diff := calcDifficultyAlgo(chain, config, algo, time, parent); diff != nil {
+				return clampDifficulty(config, next, emergencyDifficulty(config, next, time, parent, diff))
+			}
+		}
+	}
+	return CalcDifficulty(config, time, parent)
+}
+
+// clampDifficulty bounds the difficulty of block next to the difficulty range of
+// the chain, if any.
+func clampDifficulty(config *params.ChainConfig, next *big.Int, diff *big.Int) *big.Int {
+	bounds := config.Ethash.DifficultyRangeAt(next)
+	if bounds == nil {
+		return diff
+	}
+	if diff.Cmp(bounds.Floor()) < 0 {
+		diff.Set(bounds.Floor())
+	}
+	if bounds.Maximum != nil && diff.Cmp(bounds.Maximum) > 0 {
+		diff.Set(bounds.Maximum)
+	}
+	return diff
+}
+
+// inDifficultyRange reports whether a difficulty is within a difficulty range.
+func inDifficultyRange(bounds *params.DifficultyRangeConfig, diff *big.Int) bool {
+	return diff.Cmp(bounds.Floor()) >= 0 && (bounds.Maximum == nil || diff.Cmp(bounds.Maximum) <= 0)
 }
 
 // CalcDifficulty is the difficulty adjustment algorithm. It returns
 // the difficulty that a new block should have when created at time
-// given the parent block's time and difficulty.
+// given the parent block's time and difficulty. The block time targeted, the
+// difficulty bomb, the emergency adjustment and the difficulty range follow the
+// chain config. The alternative algorithms and the hash algorithm rotation of
+// the chain config are not taken into account, as they need the chain.
 func CalcDifficulty(config *params.ChainConfig, time uint64, parent *types.Header) *big.Int {
 	next := new(big.Int).Add(parent.Number, big1)
+	stamp := time
+	if target := targetBlockTime(config, next); target != defaultDifficultyTargetTime && time > parent.Time {
+		// The stock calculators aim at Ethereum's block time, so scale the block
+		// time of the chain to it
+		time = parent.Time + (time-parent.Time)*defaultDifficultyTargetTime/target
+	}
+	if config.Ethash != nil && config.Ethash.DifficultyBomb != nil {
+		// The stock calculators only look at the parent number for the bomb, so
+		// pretending the parent is the genesis block leaves the bomb out
+		stripped := *parent
+		stripped.Number = new(big.Int)
+
+		diff := calcForkDifficulty(config, next, time, &stripped)
+		if !config.Ethash.DifficultyBomb.Disabled {
+			diff.Add(diff, calcDifficultyBomb(config, config.Ethash.DifficultyBomb, next))
+		}
+		return clampDifficulty(config, next, emergencyDifficulty(config, next, stamp, parent, diff))
+	}
+	return clampDifficulty(config, next, emergencyDifficulty(config, next, stamp, parent, calcForkDifficulty(config, next, time, parent)))
+}
+
+// calcForkDifficulty returns the difficulty of block next using the stock
+// difficulty adjustment of the forks enabled at it.
+func calcForkDifficulty(config *params.ChainConfig, next *big.Int, time uint64, parent *types.Header) *big.Int {
 	switch {
 	case config.IsGrayGlacier(next):
 		return calcDifficultyEip5133(time, parent)
@@ -360,6 +493,40 @@ func CalcDifficulty(config *params.ChainConfig, time uint64, parent *types.Heade
 	}
 }
 
+// calcDifficultyBomb returns the exponential factor added to the difficulty of
+// block next, using the bomb delay of the enabled forks extended by the delay and
+// period of the bomb override.
+func calcDifficultyBomb(config *params.ChainConfig, bomb *params.DifficultyBombConfig, next *big.Int) *big.Int {
+	var delay uint64
+	switch {
+	case config.IsGrayGlacier(next):
+		delay = 11_400_000
+	case config.IsArrowGlacier(next):
+		delay = 10_700_000
+	case config.IsLondon(next):
+		delay = 9_700_000
+	case config.IsMuirGlacier(next):
+		delay = 9_000_000
+	case config.IsConstantinople(next):
+		delay = 5_000_000
+	case config.IsByzantium(next):
+		delay = 3_000_000
+	}
+	fakeBlockNumber := new(big.Int).SetUint64(delay)
+	fakeBlockNumber.Add(fakeBlockNumber, new(big.Int).SetUint64(bomb.Delay))
+	if next.Cmp(fakeBlockNumber) < 0 {
+		return new(big.Int)
+	}
+	fakeBlockNumber.Sub(next, fakeBlockNumber)
+
+	// diff = diff + 2^(periodCount - 2)
+	periodCount := fakeBlockNumber.Div(fakeBlockNumber, new(big.Int).SetUint64(bomb.DoublingPeriod()))
+	if periodCount.Cmp(big1) <= 0 {
+		return new(big.Int)
+	}
+	return periodCount.Exp(big2, periodCount.Sub(periodCount, big2), nil)
+}
+
 // Some weird constants to avoid constant memory allocs for them.
 var (
 	expDiffPeriod = big.NewInt(100000)
@@ -523,26 +690,96 @@ var DynamicDifficultyCalculator = makeDifficultyCalculator
 // verifySeal checks whether a block satisfies the PoW difficulty requirements,
 // either using the usual hmhash cache for it, or alternatively using a full DAG
 // to make remote mining fast.
-func (hmhash *Hmhash) verifySeal(chain consensus.ChainHeaderReader, header *types.Header, fulldag bool) error {
+func (hmhash *Hmhash) verifySeal(ctx context.Context, chain consensus.ChainHeaderReader, header *types.Header, fulldag bool) (err error) {
 	// If we're running a fake PoW, accept any seal as valid
-	if hmhash.config.PowMode == ModeFake || hmhash.config.PowMode == ModeFullFake {
+	if hmhash.config.PowMode == ModeFake || hmhash.config.PowMode == ModeFullFake || hmhash.config.PowMode == ModeSimulated || hmhash.config.PowMode == ModeBenchmark {
 		time.Sleep(hmhash.fakeDelay)
 		if hmhash.fakeFail == header.Number.Uint64() {
 			return errInvalidPoW
 		}
+		if hmhash.fakeFunc != nil {
+			return hmhash.fakeFunc(header)
+		}
 		return nil
 	}
 	// If we're running a shared PoW, delegate verification to it
 	if hmhash.shared != nil {
-		return hmhash.shared.verifySeal(chain, header, fulldag)
+		return hmhash.shared.verifySeal(ctx, chain, header, fulldag)
+	}
+	_, span := hmhash.startSpan(ctx, "hmhash.VerifySeal", attribute.Int64("hmhash.number", header.Number.Int64()), attribute.Bool("hmhash.fulldag", fulldag))
+	defer func() { endSpan(span, err) }()
+
+	// Seals verified before are looked up instead of recomputed. Only seals
+	// verified against a chain are remembered, as the chain config decides how
+	// a block is sealed.
+	if chain == nil || hmhash.seals == nil {
+		return hmhash.checkSeal(chain, header, fulldag)
+	}
+	hash := header.Hash()
+	if hmhash.seals.Contains(hash) {
+		sealCacheHitMeter.Mark(1)
+		span.SetAttributes(attribute.Bool("hmhash.cached", true))
+		return nil
+	}
+	if err := hmhash.checkSeal(chain, header, fulldag); err != nil {
+		return err
+	}
+	hmhash.seals.Add(hash, struct{}{})
+	return nil
+}
+
+// VerifySealContext implements consensus.ContextSealer, checking the seal of a
+// header against the verification cache. As generating the cache of a new epoch
+// takes a while, the verification is abandoned once the context is done, though
+// the cache still gets generated in the background for later use.
+func (hmhash *Hmhash) VerifySealContext(ctx context.Context, chain consensus.ChainHeaderReader, header *types.Header) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- hmhash.verifySeal(ctx, chain, header, false)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkSeal recomputes the seal of a header, checking whether it satisfies the
+// PoW difficulty requirements or carries a valid validator or auxiliary seal.
+func (hmhash *Hmhash) checkSeal(chain consensus.ChainHeaderReader, header *types.Header, fulldag bool) (err error) {
+	start := time.Now()
+	defer func() {
+		sealVerifyTimer.UpdateSince(start)
+		if err != nil {
+			hmhash.logs.verifier.Debug("Invalid header seal", "number", header.Number, logEpoch, header.Number.Uint64()/epochLength,
+				logSealHash, hmhash.SealHash(header), logNonce, header.Nonce.Uint64(), logElapsed, common.PrettyDuration(time.Since(start)), "err", err)
+		} else {
+			hmhash.logs.verifier.Trace("Verified header seal", "number", header.Number, logElapsed, common.PrettyDuration(time.Since(start)))
+		}
+	}()
+
+	// Validator sealed blocks of hybrid chains carry a signature instead
+	if chain != nil && chain.Config().Ethash.IsValidatorBlock(header.Number) {
+		return hmhash.verifyValidatorSeal(chain.Config().Ethash, header)
+	}
+	// Merge-mined blocks are sealed by the proof-of-work of a parent chain header
+	if chain != nil && chain.Config().IsAuxPoW(header.Number) && isAuxPoW(header) {
+		return hmhash.verifyAuxPoW(header)
 	}
 	// Ensure that we have a valid difficulty for the block
 	if header.Difficulty.Sign() <= 0 {
 		return errInvalidDifficulty
 	}
-
-	result := hashimotoLight(hmhash.SealHash(header).Bytes(), header.Nonce.Hash())
-	// Verify the calculated values against the ones provided in the header
+	// Recompute the digest and PoW values and verify them against the ones
+	// provided in the header
+	digest, result := hmhash.computeSeal(hmhash.chainRules(chain), header, fulldag)
+	if !bytes.Equal(header.MixDigest[:], digest) {
+		return errInvalidMixDigest
+	}
 	target := new(big.Int).Div(two256, header.Difficulty)
 	if new(big.Int).SetBytes(result).Cmp(target) > 0 {
 		return errInvalidPoW
@@ -550,20 +787,84 @@ func (hmhash *Hmhash) verifySeal(chain consensus.ChainHeaderReader, header *type
 	return nil
 }
 
+// computeSeal computes the mix digest and PoW value of the nonce of a header,
+// with the full dataset if requested and already generated.
+func (hmhash *Hmhash) computeSeal(rules *params.EthashConfig, header *types.Header, fulldag bool) (digest []byte, result []byte) {
+	number := header.Number.Uint64()
+
+	// The CPU proof-of-work needs neither dataset nor cache
+	cpupow := isCPUPoW(rules, number)
+	if cpupow {
+		digest, result = hmhash.powCPU(rules, number, hmhash.SealHash(header).Bytes(), header.Nonce.Uint64())
+	}
+	// If fast-but-heavy PoW verification was requested, use an hmhash dataset
+	if fulldag && !cpupow {
+		dataset := hmhash.dataset(rules, number, true)
+		if dataset.generated() {
+			digest, result = hmhash.powFull(rules, dataset, number, hmhash.SealHash(header).Bytes(), header.Nonce.Uint64())
+
+			// Datasets are unmapped in a finalizer. Ensure that the dataset stays alive
+			// until after the call to powFull so it's not unmapped while being used.
+			runtime.KeepAlive(dataset)
+		} else {
+			// Dataset not yet generated, don't hang, use a cache instead
+			fulldag = false
+		}
+	}
+	// If slow-but-light PoW verification was requested (or DAG not yet ready), use an hmhash cache
+	if !fulldag && !cpupow {
+		cache := hmhash.cache(rules, number)
+		digest, result = hmhash.powLight(rules, cache, number, hmhash.SealHash(header).Bytes(), header.Nonce.Uint64())
+
+		// Caches are unmapped in a finalizer. Ensure that the cache stays alive
+		// until after the call to powLight so it's not unmapped while being used.
+		runtime.KeepAlive(cache)
+	}
+	return digest, result
+}
+
 // Prepare implements consensus.Engine, initializing the difficulty field of a
-// header to conform to the hmhash protocol. The changes are done inline.
+// header to conform to the hmhash protocol, conforming the extra-data to the
+// extra-data policy and reserving the extra-data of validator sealed blocks. The
+// changes are done inline.
 func (hmhash *Hmhash) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
 	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
+	if hmhash.config.PowMode == ModeSimulated {
+		header.Time = hmhash.simulatedTime(parent, header.Time)
+	}
 	header.Difficulty = hmhash.CalcDifficulty(chain, header.Time, parent)
+
+	// Conform the vanity to the extra-data policy of the chain
+	if rules := chain.Config().Ethash.ExtraDataRules(header.Number); rules != nil {
+		header.Extra = applyExtraData(rules, header.Extra)
+	}
+	// Identify the client and the fork rules it mines by, if enabled
+	if hmhash.config.ClientTag {
+		var (
+			prefix []byte
+			limit  = params.MaximumExtraDataSize
+		)
+		if rules := chain.Config().Ethash.ExtraDataRules(header.Number); rules != nil {
+			prefix, limit = rules.Prefix, rules.MaxVanity()
+		}
+		header.Extra = embedClientTag(header.Extra, prefix, limit, newClientTag(chain, header))
+	}
+	// Reserve room for the signature of validator sealed blocks
+	if chain.Config().Ethash.IsValidatorBlock(header.Number) {
+		header.Extra = append(common.CopyBytes(header.Extra), make([]byte, validatorSealLength)...)
+	}
 	return nil
 }
 
 // Finalize implements consensus.Engine, accumulating the block and uncle rewards,
 // setting the final state on the header
 func (hmhash *Hmhash) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, withdrawals []*types.Withdrawal) {
+	_, span := hmhash.startSpan(context.Background(), "hmhash.Finalize", attribute.Int64("hmhash.number", header.Number.Int64()), attribute.Int("hmhash.txs", len(txs)), attribute.Int("hmhash.uncles", len(uncles)))
+	defer span.End()
+
 	// Accumulate any block and uncle rewards and commit the final state root
 	accumulateRewards(chain.Config(), state, header, uncles)
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
@@ -585,7 +886,14 @@ func (hmhash *Hmhash) FinalizeAndAssemble(chain consensus.ChainHeaderReader, hea
 // SealHash returns the hash of a block prior to it being sealed.
 func (hmhash *Hmhash) SealHash(header *types.Header) (hash common.Hash) {
 	hasher := sha3.NewLegacyKeccak256()
+	encodeSealHeader(hasher, header)
+	hasher.Sum(hash[:0])
+	return hash
+}
 
+// encodeSealHeader writes the RLP encoding of the header fields covered by the
+// seal.
+func encodeSealHeader(w io.Writer, header *types.Header) {
 	enc := []interface{}{
 		header.ParentHash,
 		header.UncleHash,
@@ -607,29 +915,28 @@ func (hmhash *Hmhash) SealHash(header *types.Header) (hash common.Hash) {
 	if header.WithdrawalsHash != nil {
 		panic("withdrawal hash set on hmhash")
 	}
-	rlp.Encode(hasher, enc)
-	hasher.Sum(hash[:0])
-	return hash
+	if err := rlp.Encode(w, enc); err != nil {
+		panic("can't encode: " + err.Error())
+	}
 }
 
 // Some weird constants to avoid constant memory allocs for them.
 var (
-	big8  = big.NewInt(8)
-	big32 = big.NewInt(32)
+	big8   = big.NewInt(8)
+	big32  = big.NewInt(32)
+	big100 = big.NewInt(100)
 )
 
 // AccumulateRewards credits the coinbase of the given block with the mining
 // reward. The total reward consists of the static block reward and rewards for
-// included uncles. The coinbase of each uncle block is also rewarded.
+// included uncles. The coinbase of each uncle block is also rewarded. The block
+// reward follows the reward schedule of the chain config, minus the share of the
+// treasury if one is configured.
 func accumulateRewards(config *params.ChainConfig, state *state.StateDB, header *types.Header, uncles []*types.Header) {
 	// Select the correct block reward based on chain progression
-	blockReward := FrontierBlockReward
-	if config.IsByzantium(header.Number) {
-		blockReward = ByzantiumBlockReward
-	}
-	if config.IsConstantinople(header.Number) {
-		blockReward = ConstantinopleBlockReward
-	}
+	step := NewRewardSchedule(config).Reward(header.Number)
+	blockReward := step.Reward
+
 	// Accumulate the rewards for the miner and any included uncles
 	reward := new(big.Int).Set(blockReward)
 	r := new(big.Int)
@@ -637,11 +944,20 @@ func accumulateRewards(config *params.ChainConfig, state *state.StateDB, header
 		r.Add(uncle.Number, big8)
 		r.Sub(r, header.Number)
 		r.Mul(r, blockReward)
-		r.Div(r, big8)
+		if fraction := step.UncleRewardFraction; fraction != nil {
+			r.Mul(r, fraction.Num())
+			r.Div(r, new(big.Int).Mul(fraction.Denom(), big8))
+		} else {
+			r.Div(r, big8)
+		}
 		state.AddBalance(uncle.Coinbase, r)
 
 		r.Div(blockReward, big32)
 		reward.Add(reward, r)
 	}
+	// Split the treasury share off the block reward of the miner
+	if config.Ethash != nil && config.Ethash.Treasury != nil {
+		reward.Sub(reward, payTreasury(config.Ethash.Treasury, state, header.Number, blockReward))
+	}
 	state.AddBalance(header.Coinbase, reward)
 }
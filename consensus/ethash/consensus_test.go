@@ -17,9 +17,11 @@
 package ethash
 
 import (
+	"context"
 	crand "crypto/rand"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"math/big"
 	"math/rand"
 	"os"
@@ -139,6 +141,160 @@ func TestDifficultyCalculators(t *testing.T) {
 	}
 }
 
+// Tests that the difficulty bomb override of the chain config removes, delays or
+// stretches the bomb of the stock difficulty adjustment.
+func TestDifficultyBomb(t *testing.T) {
+	forks := []*params.ChainConfig{
+		{},
+		{HomesteadBlock: big.NewInt(0)},
+		{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0)},
+		{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0), ConstantinopleBlock: big.NewInt(0), MuirGlacierBlock: big.NewInt(0)},
+		{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0), ConstantinopleBlock: big.NewInt(0), LondonBlock: big.NewInt(0), GrayGlacierBlock: big.NewInt(0)},
+	}
+	override := func(config *params.ChainConfig, bomb *params.DifficultyBombConfig) *params.ChainConfig {
+		cpy := *config
+		cpy.Ethash = &params.EthashConfig{DifficultyBomb: bomb}
+		return &cpy
+	}
+	for i, config := range forks {
+		for j := 0; j < 1000; j++ {
+			parent := &types.Header{
+				Difficulty: new(big.Int).SetUint64(params.MinimumDifficulty.Uint64() + rand.Uint64()%1_000_000_000),
+				Number:     new(big.Int).SetUint64(rand.Uint64() % 15_000_000),
+				Time:       1_000_000,
+				UncleHash:  types.EmptyUncleHash,
+			}
+			time := parent.Time + 1 + rand.Uint64()%30
+
+			// An override without changes keeps the stock bomb
+			want := CalcDifficulty(config, time, parent)
+			if have := CalcDifficulty(override(config, &params.DifficultyBombConfig{}), time, parent); have.Cmp(want) != 0 {
+				t.Fatalf("fork %d, block %v: noop override mismatch: have %v, want %v", i, parent.Number, have, want)
+			}
+			// A disabled bomb matches the stock difficulty without the exponential factor
+			genesis := *parent
+			genesis.Number = new(big.Int)
+			want = calcForkDifficulty(config, new(big.Int).Add(parent.Number, big1), time, &genesis)
+			if have := CalcDifficulty(override(config, &params.DifficultyBombConfig{Disabled: true}), time, parent); have.Cmp(want) != 0 {
+				t.Fatalf("fork %d, block %v: disabled bomb mismatch: have %v, want %v", i, parent.Number, have, want)
+			}
+		}
+	}
+	// A delayed or stretched bomb grows later or slower than the stock one
+	config := forks[len(forks)-1]
+	parent := &types.Header{
+		Difficulty: big.NewInt(1_000_000_000),
+		Number:     big.NewInt(12_399_999),
+		Time:       1_000_000,
+		UncleHash:  types.EmptyUncleHash,
+	}
+	base := CalcDifficulty(override(config, &params.DifficultyBombConfig{Disabled: true}), parent.Time+15, parent)
+	tests := []struct {
+		bomb *params.DifficultyBombConfig
+		want int64 // exponential factor at block 12_400_000
+	}{
+		{&params.DifficultyBombConfig{}, 1 << 8},
+		{&params.DifficultyBombConfig{Delay: 500_000}, 1 << 3},
+		{&params.DifficultyBombConfig{Delay: 900_000}, 0},
+		{&params.DifficultyBombConfig{Period: 200_000}, 1 << 3},
+		{&params.DifficultyBombConfig{Delay: 200_000, Period: 50_000}, 1 << 14},
+	}
+	for i, tt := range tests {
+		have := CalcDifficulty(override(config, tt.bomb), parent.Time+15, parent)
+		if bomb := new(big.Int).Sub(have, base); bomb.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("test %d: bomb mismatch: have %v, want %v", i, bomb, tt.want)
+		}
+	}
+}
+
+// Tests that the stock difficulty adjustment retargets to the block time of the
+// chain config.
+func TestTargetBlockTime(t *testing.T) {
+	ethereum := &params.ChainConfig{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}
+	parent := &types.Header{
+		Difficulty: big.NewInt(1_000_000_000),
+		Number:     big.NewInt(1000),
+		Time:       1_000_000,
+		UncleHash:  types.EmptyUncleHash,
+	}
+	for _, target := range []uint64{3, 13, 30} {
+		config := *ethereum
+		config.Ethash = &params.EthashConfig{BlockTime: target}
+
+		for _, factor := range []uint64{1, 2, 5} {
+			want := CalcDifficulty(ethereum, parent.Time+13*factor, parent)
+			if have := CalcDifficulty(&config, parent.Time+target*factor, parent); have.Cmp(want) != 0 {
+				t.Errorf("target %ds, block time %ds: difficulty mismatch: have %v, want %v", target, target*factor, have, want)
+			}
+		}
+		// Blocks at the target time must keep the difficulty at about the same level
+		if have := CalcDifficulty(&config, parent.Time+target, parent); have.Cmp(parent.Difficulty) < 0 {
+			t.Errorf("target %ds: difficulty dropped at the target block time: have %v, parent %v", target, have, parent.Difficulty)
+		}
+	}
+	// Blocks before the switch keep targeting the Ethereum block time
+	config := *ethereum
+	config.Ethash = &params.EthashConfig{BlockTime: 3, BlockTimeBlock: big.NewInt(1002)}
+	if have, want := CalcDifficulty(&config, parent.Time+13, parent), CalcDifficulty(ethereum, parent.Time+13, parent); have.Cmp(want) != 0 {
+		t.Errorf("difficulty before the switch mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that the difficulty range of the chain config bounds the difficulty of
+// the blocks from its activation onwards, and that blocks outside it are
+// rejected.
+func TestDifficultyRange(t *testing.T) {
+	config := &params.ChainConfig{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}
+	config.Ethash = &params.EthashConfig{DifficultyRange: &params.DifficultyRangeConfig{
+		Block:   big.NewInt(1001),
+		Minimum: big.NewInt(990_000),
+		Maximum: big.NewInt(1_000_100),
+	}}
+	parent := &types.Header{
+		Difficulty: big.NewInt(1_000_000),
+		Number:     big.NewInt(1000),
+		Time:       1_000_000,
+		UncleHash:  types.EmptyUncleHash,
+	}
+	// Fast blocks are capped at the ceiling, and blocks after a long downtime at
+	// the floor
+	if have := CalcDifficulty(config, parent.Time+1, parent); have.Cmp(config.Ethash.DifficultyRange.Maximum) != 0 {
+		t.Errorf("fast block difficulty mismatch: have %v, want %v", have, config.Ethash.DifficultyRange.Maximum)
+	}
+	if have := CalcDifficulty(config, parent.Time+100_000, parent); have.Cmp(config.Ethash.DifficultyRange.Minimum) != 0 {
+		t.Errorf("late block difficulty mismatch: have %v, want %v", have, config.Ethash.DifficultyRange.Minimum)
+	}
+	// Blocks before the activation are left alone
+	early := types.CopyHeader(parent)
+	early.Number = big.NewInt(999)
+	if have := CalcDifficulty(config, parent.Time+1, early); have.Cmp(config.Ethash.DifficultyRange.Maximum) <= 0 {
+		t.Errorf("difficulty capped before activation: have %v", have)
+	}
+	// Floors below the stock minimum apply to the alternative algorithms
+	ema := *config
+	ema.Ethash = &params.EthashConfig{
+		DifficultyAlgos: []*params.DifficultyAlgoConfig{{Block: big.NewInt(0), Algo: params.DifficultyAlgoEMA}},
+		DifficultyRange: &params.DifficultyRangeConfig{Block: big.NewInt(0), Minimum: big.NewInt(1)},
+	}
+	low := types.CopyHeader(parent)
+	low.Difficulty = big.NewInt(1000)
+	if have := calcDifficulty(nil, &ema, parent.Time+100_000, low); have.Cmp(params.MinimumDifficulty) >= 0 {
+		t.Errorf("difficulty not lowered below stock minimum: have %v", have)
+	}
+	// Headers outside the range are rejected
+	chain := &testHeaderChain{config: config}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     big.NewInt(1001),
+		Time:       parent.Time + 13,
+		Difficulty: big.NewInt(2_000_000),
+	}
+	err := NewFaker().verifyHeader(context.Background(), chain, header, parent, false, false, int64(header.Time))
+	if !errors.Is(err, errDifficultyRange) {
+		t.Errorf("out of range header error mismatch: have %v, want %v", err, errDifficultyRange)
+	}
+}
+
 func BenchmarkDifficultyCalculator(b *testing.B) {
 	x1 := makeDifficultyCalculator(big.NewInt(1000000))
 	x2 := MakeDifficultyCalculatorU256(big.NewInt(1000000))
@@ -186,3 +342,65 @@ func BenchmarkDifficultyCalculator(b *testing.B) {
 		}
 	})
 }
+
+// Tests that verified seals are remembered and looked up on later verifications,
+// while invalid ones are not.
+func TestSealCache(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	chain := &testHeaderChain{config: &params.ChainConfig{Ethash: new(params.EthashConfig)}}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(10)}
+	target := new(big.Int).Div(two256, header.Difficulty)
+	for nonce := uint64(0); ; nonce++ {
+		digest, result := hmhash.powResult(1, hmhash.SealHash(header), nonce)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			header.Nonce, header.MixDigest = types.EncodeNonce(nonce), digest
+			break
+		}
+	}
+	invalid := types.CopyHeader(header)
+	invalid.MixDigest = common.Hash{1}
+
+	if err := hmhash.verifySeal(context.Background(), nil, header, false); err != nil || hmhash.seals.Contains(header.Hash()) {
+		t.Fatalf("seal verified without chain cached: %v", err)
+	}
+	if err := hmhash.verifySeal(context.Background(), chain, header, false); err != nil || !hmhash.seals.Contains(header.Hash()) {
+		t.Fatalf("verified seal not cached: %v", err)
+	}
+	if err := hmhash.verifySeal(context.Background(), chain, invalid, false); err != errInvalidMixDigest || hmhash.seals.Contains(invalid.Hash()) {
+		t.Fatalf("invalid seal cached: %v", err)
+	}
+	// Disabled caches always recompute the seal
+	disabled := New(Config{PowMode: ModeTest, SealCacheSize: -1}, nil, false)
+	defer disabled.Close()
+
+	if disabled.seals != nil {
+		t.Fatalf("seal cache not disabled")
+	}
+	if err := disabled.verifySeal(context.Background(), chain, header, false); err != nil {
+		t.Fatalf("failed to verify seal without cache: %v", err)
+	}
+}
+
+// Tests that fake engines fail the seals of exactly the blocks their predicate
+// rejects.
+func TestFakeFailerFunc(t *testing.T) {
+	miner := common.Address{0xbb}
+	hmhash := NewFakeFailerFunc(func(header *types.Header) error {
+		if header.Number.Uint64()%3 == 0 || header.Coinbase == miner {
+			return errInvalidPoW
+		}
+		return nil
+	})
+	for i := int64(1); i <= 6; i++ {
+		header := &types.Header{Number: big.NewInt(i), Difficulty: big.NewInt(1)}
+		if i == 5 {
+			header.Coinbase = miner
+		}
+		err := hmhash.verifySeal(context.Background(), nil, header, false)
+		if fail := i%3 == 0 || i == 5; (err != nil) != fail {
+			t.Errorf("block %d: seal error mismatch: have %v, want failure %v", i, err, fail)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// The CPU proof-of-work is a RandomX-style, virtual machine based proof-of-work
+// suiting commodity CPUs rather than GPUs and ASICs: every nonce runs random
+// programs of integer, floating point and memory instructions over a scratchpad
+// sized for the L2 cache of a CPU core. It needs neither verification cache nor
+// dataset, so blocks are verified running the same computation as mining them.
+//
+// The floating point results are rounded to float64 after every instruction,
+// preventing the compiler from fusing operations, and replaced with 1 when not
+// finite, so the results are identical on all platforms.
+const (
+	cpupowScratchpadWords = 1 << 15 // 256 KiB scratchpad
+	cpupowPrograms        = 8       // Programs run per nonce
+	cpupowProgramSize     = 64      // Instructions per program
+	cpupowIterations      = 128     // Runs of every program
+)
+
+// Instructions of the CPU proof-of-work virtual machine.
+const (
+	cpuopIAdd  = iota // r[dst] += r[src] + imm
+	cpuopISub         // r[dst] -= r[src]
+	cpuopIMul         // r[dst] *= r[src] | 1
+	cpuopIMulH        // r[dst] = high 64 bits of r[dst] * r[src]
+	cpuopIXor         // r[dst] ^= r[src]
+	cpuopIRor         // r[dst] rotated right by r[src] % 64
+	cpuopISwap        // Swap r[dst] and r[src]
+	cpuopLoad         // r[dst] ^= scratchpad[r[src] + imm]
+	cpuopStore        // scratchpad[r[dst] + imm] = r[src]
+	cpuopFAdd         // f[dst] += integer operand from r[src]
+	cpuopFMul         // f[dst] *= operand in [1, 2) from r[src]
+	cpuopFDiv         // f[dst] /= operand in [1, 2) from r[src]
+	cpuopFSqrt        // f[dst] = sqrt(|f[dst]|)
+	cpuopFMix         // r[dst] ^= bits of f[dst]
+	cpuopCMov         // r[dst] = r[src] if r[dst] + imm is even
+	cpuopCount
+)
+
+// cpupowInstruction is a decoded instruction of a CPU proof-of-work program.
+type cpupowInstruction struct {
+	op  uint8
+	dst uint8
+	src uint8
+	imm uint64
+}
+
+// cpupowVM is the state of the CPU proof-of-work virtual machine.
+type cpupowVM struct {
+	r       [8]uint64
+	f       [4]float64
+	pad     []uint64
+	program [cpupowProgramSize]cpupowInstruction
+}
+
+// splitmix64 advances a SplitMix64 generator, returning its next output.
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// cpupowOperand maps a register to a float64 in [1, 2), which keeps products and
+// quotients finite for long.
+func cpupowOperand(x uint64) float64 {
+	return math.Float64frombits(0x3ff0000000000000 | x&0x000fffffffffffff)
+}
+
+// cpupowFinite replaces the non-finite results of floating point instructions,
+// whose bit patterns may differ between platforms.
+func cpupowFinite(x float64) float64 {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 1
+	}
+	return x
+}
+
+// generate decodes a random program seeded from the registers.
+func (vm *cpupowVM) generate() {
+	var state uint64
+	for i, r := range vm.r {
+		state ^= bits.RotateLeft64(r, 8*i)
+	}
+	for i := range vm.program {
+		word := splitmix64(&state)
+		vm.program[i] = cpupowInstruction{
+			op:  uint8(word % cpuopCount),
+			dst: uint8(word>>8) & 7,
+			src: uint8(word>>11) & 7,
+			imm: word >> 32,
+		}
+	}
+}
+
+// execute runs the current program once.
+func (vm *cpupowVM) execute() {
+	const mask = cpupowScratchpadWords - 1
+	for _, ins := range vm.program {
+		r, f := &vm.r, &vm.f
+		switch ins.op {
+		case cpuopIAdd:
+			r[ins.dst] += r[ins.src] + ins.imm
+		case cpuopISub:
+			r[ins.dst] -= r[ins.src]
+		case cpuopIMul:
+			r[ins.dst] *= r[ins.src] | 1
+		case cpuopIMulH:
+			r[ins.dst], _ = bits.Mul64(r[ins.dst], r[ins.src])
+		case cpuopIXor:
+			r[ins.dst] ^= r[ins.src]
+		case cpuopIRor:
+			r[ins.dst] = bits.RotateLeft64(r[ins.dst], -int(r[ins.src]&63))
+		case cpuopISwap:
+			r[ins.dst], r[ins.src] = r[ins.src], r[ins.dst]
+		case cpuopLoad:
+			r[ins.dst] ^= vm.pad[(r[ins.src]+ins.imm)&mask]
+		case cpuopStore:
+			vm.pad[(r[ins.dst]+ins.imm)&mask] = r[ins.src]
+		case cpuopFAdd:
+			f[ins.dst&3] = cpupowFinite(float64(f[ins.dst&3] + float64(int32(r[ins.src]))))
+		case cpuopFMul:
+			f[ins.dst&3] = cpupowFinite(float64(f[ins.dst&3] * cpupowOperand(r[ins.src])))
+		case cpuopFDiv:
+			f[ins.dst&3] = cpupowFinite(float64(f[ins.dst&3] / cpupowOperand(r[ins.src])))
+		case cpuopFSqrt:
+			f[ins.dst&3] = math.Sqrt(math.Abs(f[ins.dst&3]))
+		case cpuopFMix:
+			r[ins.dst] ^= math.Float64bits(f[ins.dst&3])
+		case cpuopCMov:
+			if (r[ins.dst]+ins.imm)&1 == 0 {
+				r[ins.dst] = r[ins.src]
+			}
+		}
+	}
+}
+
+// cpupowHash computes the mix digest and proof-of-work result of a nonce with
+// the CPU proof-of-work, keyed by the seed of the epoch.
+func cpupowHash(algo HashAlgo, seed []byte, hash []byte, nonce uint64) ([]byte, []byte) {
+	const mask = cpupowScratchpadWords - 1
+
+	// Derive the initial state from the seed, the header and the nonce
+	input := make([]byte, 0, len(seed)+len(hash)+8)
+	input = append(input, seed...)
+	input = append(input, hash...)
+	input = binary.LittleEndian.AppendUint64(input, nonce)
+
+	hasher := algo.New512()
+	hasher.Write(input)
+	init := hasher.Sum(nil)
+
+	vm := &cpupowVM{pad: make([]uint64, cpupowScratchpadWords)}
+	for i := range vm.r {
+		vm.r[i] = binary.LittleEndian.Uint64(init[8*i:])
+	}
+	for i := range vm.f {
+		vm.f[i] = cpupowOperand(vm.r[i] ^ vm.r[i+4])
+	}
+	state := vm.r[0] ^ vm.r[7]
+	for i := range vm.pad {
+		vm.pad[i] = splitmix64(&state)
+	}
+	// Run the programs, mixing the registers with the scratchpad between runs
+	for p := 0; p < cpupowPrograms; p++ {
+		vm.generate()
+		for i := 0; i < cpupowIterations; i++ {
+			vm.execute()
+			for j := range vm.r {
+				addr := (vm.r[j] >> 3) & mask
+				vm.pad[addr] ^= vm.r[(j+1)&7]
+				vm.r[j] ^= vm.pad[(addr+uint64(j)*4099)&mask]
+			}
+		}
+	}
+	// Fold the scratchpad, and hash the registers into the digest and everything
+	// into the result
+	var fold [8]uint64
+	for i, word := range vm.pad {
+		fold[i&7] = bits.RotateLeft64(fold[i&7], 7) ^ word
+	}
+	state64 := make([]byte, 0, 96)
+	for _, r := range vm.r {
+		state64 = binary.LittleEndian.AppendUint64(state64, r)
+	}
+	for _, f := range vm.f {
+		state64 = binary.LittleEndian.AppendUint64(state64, math.Float64bits(f))
+	}
+	hasher = algo.New256()
+	hasher.Write(state64)
+	digest := hasher.Sum(nil)
+
+	hasher = algo.New256()
+	hasher.Write(init)
+	hasher.Write(digest)
+	for _, word := range fold {
+		hasher.Write(binary.LittleEndian.AppendUint64(nil, word))
+	}
+	return digest, hasher.Sum(nil)
+}
+
+// isCPUPoW returns whether blocks at the given height are sealed with the CPU
+// proof-of-work by the ethash rules of a chain.
+func isCPUPoW(rules *params.EthashConfig, block uint64) bool {
+	return rules != nil && rules.CPUPoWBlock != nil && rules.CPUPoWBlock.Cmp(new(big.Int).SetUint64(block)) <= 0
+}
+
+// powCPU computes the proof-of-work of a block with the CPU proof-of-work.
+func (hmhash *Hmhash) powCPU(rules *params.EthashConfig, block uint64, hash []byte, nonce uint64) ([]byte, []byte) {
+	return cpupowHash(hmhash.algoAt(rules, block), seedHash(block), hash, nonce)
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the CPU proof-of-work is deterministic and depends on all its
+// inputs.
+func TestCPUPoWHash(t *testing.T) {
+	var (
+		seed = seedHash(0)
+		hash = common.HexToHash("0xc9149cc0386e689d789a1c2f3d5d169a61a6218ed30e74414dc736e442ef3d1f").Bytes()
+	)
+	digest, result := cpupowHash(keccakAlgo{}, seed, hash, 42)
+	if len(digest) != 32 || len(result) != 32 {
+		t.Fatalf("output length mismatch: digest %d, result %d", len(digest), len(result))
+	}
+	again, _ := cpupowHash(keccakAlgo{}, seed, hash, 42)
+	if !bytes.Equal(digest, again) {
+		t.Fatalf("nondeterministic digest: %x != %x", digest, again)
+	}
+	for i, other := range [][]byte{
+		first(cpupowHash(keccakAlgo{}, seed, hash, 43)),
+		first(cpupowHash(keccakAlgo{}, seedHash(epochLength), hash, 42)),
+		first(cpupowHash(keccakAlgo{}, seed, common.Hash{}.Bytes(), 42)),
+		first(cpupowHash(blake2bAlgo{}, seed, hash, 42)),
+	} {
+		if bytes.Equal(digest, other) {
+			t.Errorf("variant %d: digest unchanged", i)
+		}
+	}
+}
+
+// first returns the first of two values.
+func first(a, b []byte) []byte { return a }
+
+// Tests that blocks past the switch are sealed and verified with the CPU
+// proof-of-work, without generating any cache or dataset.
+func TestCPUPoWSeal(t *testing.T) {
+	config := &params.ChainConfig{Ethash: &params.EthashConfig{CPUPoWBlock: big.NewInt(1)}}
+	chain := configReader{config}
+
+	hmhash := New(Config{PowMode: ModeTest}, nil, false)
+	defer hmhash.Close()
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block)
+	if err := hmhash.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	select {
+	case block := <-results:
+		header.Nonce = types.EncodeNonce(block.Nonce())
+		header.MixDigest = block.MixDigest()
+	case <-time.NewTimer(10 * time.Second).C:
+		t.Fatal("sealing result timeout")
+	}
+	if err := hmhash.verifySeal(context.Background(), chain, header, false); err != nil {
+		t.Fatalf("unexpected verification error: %v", err)
+	}
+	if _, ok := hmhash.caches.peek(0); ok {
+		t.Errorf("verification cache generated for CPU proof-of-work")
+	}
+	if _, ok := hmhash.datasets.peek(0); ok {
+		t.Errorf("dataset generated for CPU proof-of-work")
+	}
+	// Engines before the switch, and the stateless verification, tell it apart
+	tester := NewTester(nil, false)
+	defer tester.Close()
+	if err := tester.verifySeal(context.Background(), nil, header, false); err == nil {
+		t.Errorf("CPU proof-of-work seal accepted by hashimoto engine")
+	}
+	if err := VerifyHeaderSeal(config, header); err != nil {
+		t.Errorf("stateless verification failed: %v", err)
+	}
+}
+
+func BenchmarkCPUPoW(b *testing.B) {
+	seed, hash := seedHash(0), make([]byte, 32)
+	for i := 0; i < b.N; i++ {
+		cpupowHash(keccakAlgo{}, seed, hash, uint64(i))
+	}
+}
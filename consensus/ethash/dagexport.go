@@ -0,0 +1,295 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const (
+	// dagSpotChecks is the number of random items of an imported DAG regenerated
+	// from the verification cache to validate it.
+	dagSpotChecks = 64
+
+	// dagExportDir is the directory within the DAG directory the DAGs are
+	// exported to and imported from, apart from the DAGs in use.
+	dagExportDir = "exports"
+
+	// maxDAGLookahead is the number of epochs past the one of the head block the
+	// DAGs can be generated, exported or imported for.
+	maxDAGLookahead = 2
+)
+
+var (
+	errNoDatasetDir   = errors.New("no DAG directory configured")
+	errDAGMismatch    = errors.New("DAG doesn't match epoch")
+	errInvalidDAGName = errors.New("invalid DAG file name")
+	errFutureEpoch    = errors.New("epoch too far in the future")
+)
+
+// checkDAGEpoch ensures the DAG of an epoch is needed soon by a chain at the
+// given head block.
+func checkDAGEpoch(head uint64, epoch uint64) error {
+	if limit := head/epochLength + maxDAGLookahead; epoch > limit {
+		return fmt.Errorf("%w: have %d, max %d", errFutureEpoch, epoch, limit)
+	}
+	return nil
+}
+
+// exportPath resolves the name of an exported DAG file within the export
+// directory of the DAG directory, refusing names escaping it.
+func (hmhash *Hmhash) exportPath(name string) (string, error) {
+	if hmhash.config.DatasetDir == "" {
+		return "", errNoDatasetDir
+	}
+	path, ok := localPath(filepath.Join(hmhash.config.DatasetDir, dagExportDir), name)
+	if !ok {
+		return "", errInvalidDAGName
+	}
+	return path, nil
+}
+
+// localPath joins a file name to a directory, refusing names escaping it.
+func localPath(dir, name string) (string, bool) {
+	name = filepath.Clean(name)
+	if name == "." || filepath.IsAbs(name) || filepath.VolumeName(name) != "" || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(dir, name), true
+}
+
+// MakeDAG generates the mining dataset of an epoch, storing it in the DAG
+// directory if one is configured.
+func (hmhash *Hmhash) MakeDAG(epoch uint64) {
+	hmhash.dataset(nil, epoch*epochLength, false)
+}
+
+// ExportDAG writes the mining dataset of an epoch to a file of the export
+// directory, generating it if needed. The file is in the format of the DAG
+// directory, so it can be imported with ImportDAG on machines of the same
+// endianness.
+func (hmhash *Hmhash) ExportDAG(epoch uint64, name string) error {
+	path, err := hmhash.exportPath(name)
+	if err != nil {
+		return err
+	}
+	d := hmhash.dataset(nil, epoch*epochLength, false)
+	defer runtime.KeepAlive(d)
+
+	if d.partial() {
+		return errPartialDataset
+	}
+	return writeDataset(path, d.dataset)
+}
+
+// ImportDAG validates a mining dataset exported by ExportDAG to a file of the
+// export directory and copies it into the DAG directory, sparing its generation.
+func (hmhash *Hmhash) ImportDAG(epoch uint64, name string) error {
+	path, err := hmhash.exportPath(name)
+	if err != nil {
+		return err
+	}
+	block := epoch * epochLength
+
+	c := hmhash.cache(nil, block)
+	defer runtime.KeepAlive(c)
+
+	return importDataset(hmhash.algo, c.cache, epoch, hmhash.datasetSize(block), hmhash.config.DatasetDir, path)
+}
+
+// DumpCheck is the result of checking a verification cache or mining dataset
+// dumped on disk.
+type DumpCheck struct {
+	Kind  string `json:"kind"` // "cache" or "dataset"
+	Algo  string `json:"algo"`
+	Path  string `json:"path"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyDataset checks the dump magic, size and checksum of the verification
+// caches and mining datasets of an epoch dumped on disk, for every hash algorithm
+// the engine seals with. Dumps not generated yet are skipped. Corrupted dumps are
+// regenerated when next loaded.
+func (hmhash *Hmhash) VerifyDataset(epoch uint64) ([]DumpCheck, error) {
+	if hmhash.config.CacheDir == "" && hmhash.config.DatasetDir == "" {
+		return nil, errNoDatasetDir
+	}
+	block := epoch * epochLength
+
+	algos := append([]HashAlgo{hmhash.algo}, hmhash.rotatedAlgos()...)
+	sort.Slice(algos[1:], func(i, j int) bool { return algos[1+i].Name() < algos[1+j].Name() })
+
+	checks := []DumpCheck{}
+	for _, algo := range algos {
+		if dir := hmhash.config.CacheDir; dir != "" {
+			if check, ok := checkDump("cache", algo, cachePath(dir, epoch, algo), hmhash.cacheSize(block)); ok {
+				checks = append(checks, check)
+			}
+		}
+		if dir := hmhash.config.DatasetDir; dir != "" {
+			if check, ok := checkDump("dataset", algo, datasetPath(dir, epoch, algo), hmhash.datasetSize(block)); ok {
+				checks = append(checks, check)
+			}
+		}
+	}
+	return checks, nil
+}
+
+// checkDump checks a dump of the given size on disk, returning false if it
+// doesn't exist.
+func checkDump(kind string, algo HashAlgo, path string, size uint64) (DumpCheck, bool) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return DumpCheck{}, false
+	}
+	check := DumpCheck{Kind: kind, Algo: algo.Name(), Path: path}
+
+	dump, mem, data, err := memoryMap(path, false, true)
+	if err == nil {
+		if uint64(len(data))*4 != size {
+			err = fmt.Errorf("size mismatch: have %d, want %d", len(data)*4, size)
+		}
+		mem.Unmap()
+		dump.Close()
+	}
+	if err != nil {
+		check.Error = err.Error()
+	} else {
+		check.Valid = true
+	}
+	return check, true
+}
+
+// ExportDataset writes the mining dataset of an epoch to a file, generating it
+// in dir, or in memory if dir is empty.
+func ExportDataset(epoch uint64, dir, path string) error {
+	block := epoch * epochLength
+
+	d := newDataset(epoch, keccakAlgo{})
+	d.generate(dir, math.MaxInt32, false, cacheSize(block), datasetSize(block))
+	defer runtime.KeepAlive(d)
+
+	return writeDataset(path, d.dataset)
+}
+
+// ImportDataset validates a mining dataset exported by ExportDataset and copies
+// it into dir.
+func ImportDataset(epoch uint64, dir, path string) error {
+	if dir == "" {
+		return errNoDatasetDir
+	}
+	block := epoch * epochLength
+
+	c := newCache(epoch, keccakAlgo{})
+	c.generate("", 0, false, cacheSize(block))
+
+	return importDataset(keccakAlgo{}, c.cache, epoch, datasetSize(block), dir, path)
+}
+
+// writeDataset dumps a dataset into a file, prefixed with the dump magic and the
+// checksum of the dataset.
+func writeDataset(path string, dataset []uint32) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temp := path + "." + strconv.Itoa(rand.Int())
+
+	dump, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	for _, words := range [][]uint32{dumpMagic, {dumpChecksum(dataset)}, dataset} {
+		if _, err = dump.Write(unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), len(words)*4)); err != nil {
+			break
+		}
+	}
+	if cerr := dump.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// importDataset checks the size of a dataset dump and a sample of its items
+// against the verification cache of the epoch, then copies it into dir.
+func importDataset(algo HashAlgo, cache []uint32, epoch uint64, dsize uint64, dir, path string) error {
+	dump, mem, dataset, err := memoryMap(path, false, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		mem.Unmap()
+		dump.Close()
+	}()
+	if uint64(len(dataset))*4 != dsize {
+		return fmt.Errorf("%w: size mismatch: have %d, want %d", errDAGMismatch, len(dataset)*4, dsize)
+	}
+	var (
+		hash512 = makeHasher(algo.New512())
+		items   = len(dataset) / hashWords
+		swapped = !isLittleEndian()
+	)
+	for i := 0; i < dagSpotChecks; i++ {
+		index := rand.Intn(items)
+
+		want := generateDatasetItem(cache, uint32(index), hash512)
+		if swapped {
+			swap(want)
+		}
+		have := dataset[index*hashWords : (index+1)*hashWords]
+		if !bytes.Equal(unsafe.Slice((*byte)(unsafe.Pointer(&have[0])), hashBytes), want) {
+			return fmt.Errorf("%w: item %d mismatch", errDAGMismatch, index)
+		}
+	}
+	// The dump is valid, copy it over to the DAG directory
+	target := datasetPath(dir, epoch, algo)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	temp := target + "." + strconv.Itoa(rand.Int())
+
+	out, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	if _, err = dump.Seek(0, io.SeekStart); err == nil {
+		_, err = io.Copy(out, dump)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, target)
+}
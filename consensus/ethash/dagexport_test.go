@@ -0,0 +1,143 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests that exported DAGs are imported into the DAG directory of another node
+// and loaded from there, while DAGs of other epochs are rejected.
+func TestDAGExportImport(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	exporter := New(Config{PowMode: ModeTest, DatasetDir: filepath.Join(tmpdir, "source")}, nil, false)
+	defer exporter.Close()
+
+	if err := exporter.ExportDAG(1, "dag"); err != nil {
+		t.Fatalf("failed to export DAG: %v", err)
+	}
+	importer := New(Config{PowMode: ModeTest, DatasetDir: filepath.Join(tmpdir, "dags"), DatasetsOnDisk: 1, DatasetsInMem: 1}, nil, false)
+	defer importer.Close()
+
+	// Ship the export over to the export directory of the importer
+	blob, err := os.ReadFile(filepath.Join(tmpdir, "source", dagExportDir, "dag"))
+	if err != nil {
+		t.Fatalf("exported DAG missing: %v", err)
+	}
+	os.MkdirAll(filepath.Join(tmpdir, "dags", dagExportDir), 0755)
+	if err := os.WriteFile(filepath.Join(tmpdir, "dags", dagExportDir, "dag"), blob, 0644); err != nil {
+		t.Fatalf("failed to copy DAG: %v", err)
+	}
+	if err := importer.ImportDAG(2, "dag"); !errors.Is(err, errDAGMismatch) {
+		t.Fatalf("foreign epoch import error mismatch: have %v, want %v", err, errDAGMismatch)
+	}
+	if err := importer.ImportDAG(1, "dag"); err != nil {
+		t.Fatalf("failed to import DAG: %v", err)
+	}
+	if _, err := os.Stat(datasetPath(importer.config.DatasetDir, 1, importer.algo)); err != nil {
+		t.Fatalf("imported DAG missing: %v", err)
+	}
+	if have, want := importer.dataset(nil, epochLength, false).dataset, exporter.dataset(nil, epochLength, false).dataset; !reflect.DeepEqual(have, want) {
+		t.Errorf("imported DAG mismatch")
+	}
+	// Exporting and importing need a DAG directory, and stay within it
+	tester := NewTester(nil, false)
+	defer tester.Close()
+
+	if err := tester.ImportDAG(1, "dag"); err != errNoDatasetDir {
+		t.Errorf("missing directory error mismatch: have %v, want %v", err, errNoDatasetDir)
+	}
+	for _, name := range []string{"", "..", "../dag", "sub/../../dag", filepath.Join(tmpdir, "dag")} {
+		if err := importer.ExportDAG(1, name); err != errInvalidDAGName {
+			t.Errorf("name %q: export error mismatch: have %v, want %v", name, err, errInvalidDAGName)
+		}
+		if err := importer.ImportDAG(1, name); err != errInvalidDAGName {
+			t.Errorf("name %q: import error mismatch: have %v, want %v", name, err, errInvalidDAGName)
+		}
+	}
+	// DAGs are only handled up to a few epochs ahead of the head
+	if err := checkDAGEpoch(epochLength, 1+maxDAGLookahead); err != nil {
+		t.Errorf("upcoming epoch rejected: %v", err)
+	}
+	if err := checkDAGEpoch(epochLength, 2+maxDAGLookahead); !errors.Is(err, errFutureEpoch) {
+		t.Errorf("future epoch error mismatch: have %v, want %v", err, errFutureEpoch)
+	}
+}
+
+// Tests that corrupted dataset dumps are reported by VerifyDataset and
+// regenerated instead of loaded.
+func TestDatasetIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{PowMode: ModeTest, CacheDir: dir, CachesOnDisk: 1, DatasetDir: dir, DatasetsOnDisk: 1, DatasetsInMem: 1}
+
+	hmhash := New(config, nil, false)
+	defer hmhash.Close()
+
+	if checks, err := hmhash.VerifyDataset(0); err != nil || len(checks) != 0 {
+		t.Fatalf("checks before generation mismatch: have %v, %v, want none", checks, err)
+	}
+	hmhash.cache(nil, 0)
+	want := append([]uint32{}, hmhash.dataset(nil, 0, false).dataset...)
+
+	checks, err := hmhash.VerifyDataset(0)
+	if err != nil {
+		t.Fatalf("failed to verify dataset: %v", err)
+	}
+	if len(checks) != 2 || checks[0].Kind != "cache" || checks[1].Kind != "dataset" {
+		t.Fatalf("checks mismatch: %+v", checks)
+	}
+	for _, check := range checks {
+		if !check.Valid {
+			t.Fatalf("%s dump invalid: %s", check.Kind, check.Error)
+		}
+	}
+	// Flip a bit of the dataset and ensure it's detected
+	path := datasetPath(dir, 0, hmhash.algo)
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob[len(blob)/2] ^= 0x01
+	if err := os.WriteFile(path, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if checks, _ := hmhash.VerifyDataset(0); checks[1].Valid || checks[1].Error != ErrCorruptDump.Error() {
+		t.Fatalf("corrupt dataset check mismatch: %+v", checks[1])
+	}
+	// A fresh engine must regenerate the dataset instead of loading it
+	fresh := New(config, nil, false)
+	defer fresh.Close()
+
+	if have := fresh.dataset(nil, 0, false).dataset; !reflect.DeepEqual(have, want) {
+		t.Errorf("regenerated dataset mismatch")
+	}
+	if checks, _ := fresh.VerifyDataset(0); !checks[1].Valid {
+		t.Errorf("regenerated dataset invalid: %s", checks[1].Error)
+	}
+	// Verifying needs a directory to check
+	tester := NewTester(nil, false)
+	defer tester.Close()
+
+	if _, err := tester.VerifyDataset(0); err != errNoDatasetDir {
+		t.Errorf("missing directory error mismatch: have %v, want %v", err, errNoDatasetDir)
+	}
+}
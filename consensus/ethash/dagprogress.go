@@ -0,0 +1,63 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	datasetEpochGauge    = metrics.NewRegisteredGauge("hmhash/dataset/epoch", nil)
+	datasetProgressGauge = metrics.NewRegisteredGauge("hmhash/dataset/progress", nil)
+	datasetETAGauge      = metrics.NewRegisteredGauge("hmhash/dataset/eta", nil)
+)
+
+// DatasetProgress is a progress report of a mining dataset being generated.
+type DatasetProgress struct {
+	Epoch   uint64        // Epoch of the dataset being generated
+	Percent uint64        // Percentage of the dataset generated so far
+	Elapsed time.Duration // Time spent generating the dataset
+	ETA     time.Duration // Estimated time until the dataset is generated
+}
+
+// progressHook is a callback receiving the dataset generation progress.
+type progressHook func(DatasetProgress)
+
+// SetDatasetProgressHook registers a callback receiving the progress of the
+// mining datasets being generated, after every percent generated. Reports are
+// delivered one at a time from the generator threads, so the callback should
+// return quickly. A nil callback removes the current one.
+func (hmhash *Hmhash) SetDatasetProgressHook(fn func(DatasetProgress)) {
+	hmhash.lock.Lock()
+	defer hmhash.lock.Unlock()
+
+	hmhash.progress = fn
+}
+
+// reportDatasetProgress forwards the progress of a dataset being generated to
+// the registered callback, if any.
+func (hmhash *Hmhash) reportDatasetProgress(progress DatasetProgress) {
+	hmhash.lock.Lock()
+	fn := hmhash.progress
+	hmhash.lock.Unlock()
+
+	if fn != nil {
+		fn(progress)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// DiagnosticUncle is an uncle of a diagnosed block, as rewarded by it.
+type DiagnosticUncle struct {
+	Hash     common.Hash    `json:"hash"`
+	Number   hexutil.Uint64 `json:"number"`
+	Coinbase common.Address `json:"coinbase"`
+}
+
+// StateDiagnostic is the dump of the reward computation of a block whose state
+// or receipt root diverged, to be compared against the dump of another client
+// version to find the rule they disagree on.
+type StateDiagnostic struct {
+	Client      string      `json:"client"` // Version of the client computing the rewards
+	Error       string      `json:"error"`  // Error reporting the mismatch
+	Number      uint64      `json:"number"`
+	Hash        common.Hash `json:"hash"`
+	ParentHash  common.Hash `json:"parentHash"`
+	Root        common.Hash `json:"root"`        // State root of the header
+	ReceiptHash common.Hash `json:"receiptHash"` // Receipt root of the header
+	GasUsed     uint64      `json:"gasUsed"`
+	Txs         int         `json:"txs"`
+
+	Coinbase common.Address                  `json:"coinbase"`
+	Uncles   []DiagnosticUncle               `json:"uncles"`
+	Reward   *params.RewardConfig            `json:"reward"`             // Block reward step in effect
+	Treasury *params.TreasuryConfig          `json:"treasury,omitempty"` // Treasury sharing the block reward, if any
+	Credits  map[common.Address]*hexutil.Big `json:"credits"`            // Balances credited by the rewards
+}
+
+// DiagnoseState implements consensus.StateDiagnoser, dumping the inputs and the
+// outcome of the reward computation of a block whose state or receipt root
+// diverged to the diagnostics directory, if configured. The block is also
+// reported to the fork rule monitor as following other state transition rules.
+func (hmhash *Hmhash) DiagnoseState(chain consensus.ChainHeaderReader, block *types.Block, err error) {
+	if hmhash.forkRules != nil {
+		hmhash.reportForkRules(block.Header(), ForkRuleState, err)
+	}
+	if hmhash.config.DiagnosticsDir == "" {
+		return
+	}
+	diag, derr := newStateDiagnostic(chain.Config(), block, err)
+	if derr != nil {
+		hmhash.logs.verifier.Warn("Failed to diagnose state mismatch", "number", block.Number(), "hash", block.Hash(), "err", derr)
+		return
+	}
+	path := filepath.Join(hmhash.config.DiagnosticsDir, fmt.Sprintf("state-%d-%x.json", block.NumberU64(), block.Hash().Bytes()[:8]))
+	if derr := writeStateDiagnostic(path, diag); derr != nil {
+		hmhash.logs.verifier.Warn("Failed to dump state diagnostics", "number", block.Number(), "hash", block.Hash(), "err", derr)
+		return
+	}
+	hmhash.logs.verifier.Warn("Dumped state diagnostics of diverged block", "number", block.Number(), "hash", block.Hash(), "path", path)
+}
+
+// newStateDiagnostic gathers the reward computation of a block, crediting the
+// rewards to an empty state to tell them apart from the rest of the block.
+func newStateDiagnostic(config *params.ChainConfig, block *types.Block, err error) (*StateDiagnostic, error) {
+	header := block.Header()
+	diag := &StateDiagnostic{
+		Client:      params.VersionWithMeta,
+		Error:       err.Error(),
+		Number:      block.NumberU64(),
+		Hash:        block.Hash(),
+		ParentHash:  block.ParentHash(),
+		Root:        header.Root,
+		ReceiptHash: header.ReceiptHash,
+		GasUsed:     header.GasUsed,
+		Txs:         len(block.Transactions()),
+		Coinbase:    header.Coinbase,
+		Reward:      NewRewardSchedule(config).Reward(header.Number),
+		Credits:     make(map[common.Address]*hexutil.Big),
+	}
+	if config.Ethash != nil && config.Ethash.Treasury != nil && config.Ethash.Treasury.IsActive(header.Number) {
+		diag.Treasury = config.Ethash.Treasury
+	}
+	for _, uncle := range block.Uncles() {
+		diag.Uncles = append(diag.Uncles, DiagnosticUncle{Hash: uncle.Hash(), Number: hexutil.Uint64(uncle.Number.Uint64()), Coinbase: uncle.Coinbase})
+	}
+	statedb, serr := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if serr != nil {
+		return nil, serr
+	}
+	accumulateRewards(config, statedb, header, block.Uncles())
+
+	credited := []common.Address{header.Coinbase}
+	for _, uncle := range block.Uncles() {
+		credited = append(credited, uncle.Coinbase)
+	}
+	if treasury := diag.Treasury; treasury != nil {
+		credited = append(credited, treasury.Address)
+		for _, recipient := range treasury.Recipients {
+			credited = append(credited, recipient.Address)
+		}
+	}
+	for _, addr := range credited {
+		if balance := statedb.GetBalance(addr); balance.Sign() > 0 {
+			diag.Credits[addr] = (*hexutil.Big)(new(big.Int).Set(balance))
+		}
+	}
+	return diag, nil
+}
+
+// writeStateDiagnostic writes a state diagnostic as indented JSON.
+func writeStateDiagnostic(path string, diag *StateDiagnostic) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	blob, err := json.MarshalIndent(diag, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, blob, 0644)
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that blocks with a diverged state have their rewards dumped, credited
+// to the miner and the uncles as the engine computes them.
+func TestDiagnoseState(t *testing.T) {
+	dir := t.TempDir()
+	hmhash := New(Config{PowMode: ModeFake, DiagnosticsDir: dir}, nil, false)
+	defer hmhash.Close()
+
+	var (
+		miner  = common.Address{0x01}
+		uncler = common.Address{0x02}
+		uncle  = &types.Header{Number: big.NewInt(9), Coinbase: uncler, Difficulty: common.Big1}
+		header = &types.Header{Number: big.NewInt(10), Coinbase: miner, Difficulty: common.Big1}
+		block  = types.NewBlock(header, nil, []*types.Header{uncle}, nil, nil)
+		chain  = &testHeaderChain{config: params.TestChainConfig}
+	)
+	hmhash.DiagnoseState(chain, block, errors.New("invalid merkle root"))
+
+	blob, err := os.ReadFile(filepath.Join(dir, "state-10-"+common.Bytes2Hex(block.Hash().Bytes()[:8])+".json"))
+	if err != nil {
+		t.Fatalf("failed to read diagnostics: %v", err)
+	}
+	var diag StateDiagnostic
+	if err := json.Unmarshal(blob, &diag); err != nil {
+		t.Fatalf("failed to decode diagnostics: %v", err)
+	}
+	if diag.Hash != block.Hash() || diag.Error != "invalid merkle root" || len(diag.Uncles) != 1 || diag.Uncles[0].Coinbase != uncler {
+		t.Errorf("diagnostics mismatch: %+v", diag)
+	}
+	// Constantinople pays 2 ether, uncles one block deep 7/8 of it
+	var (
+		reward     = ConstantinopleBlockReward
+		minerWant  = new(big.Int).Add(reward, new(big.Int).Div(reward, big32))
+		unclerWant = new(big.Int).Div(new(big.Int).Mul(reward, big.NewInt(7)), big8)
+		minerHave  = (*big.Int)(diag.Credits[miner])
+		unclerHave = (*big.Int)(diag.Credits[uncler])
+	)
+	if diag.Reward.Reward.Cmp(reward) != 0 {
+		t.Errorf("block reward mismatch: have %v, want %v", diag.Reward.Reward, reward)
+	}
+	if minerHave == nil || minerHave.Cmp(minerWant) != 0 {
+		t.Errorf("miner credit mismatch: have %v, want %v", minerHave, minerWant)
+	}
+	if unclerHave == nil || unclerHave.Cmp(unclerWant) != 0 {
+		t.Errorf("uncle credit mismatch: have %v, want %v", unclerHave, unclerWant)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Defaults of the difficulty algorithms, used if the chain config
+// leaves the parameters unset.
+const (
+	defaultDifficultyTargetTime = 13 // Targeted block time in seconds, as Ethereum
+
+	defaultDigishieldWindow = 17 // Blocks averaged by Digishield v3
+	defaultLWMAWindow       = 60 // Blocks averaged by LWMA
+	defaultEMAWindow        = 20 // Smoothing constant of the EMA, in blocks
+)
+
+// headerReader is the part of the chain needed to walk the ancestors of a block
+// for the windowed difficulty algorithms.
+type headerReader interface {
+	GetHeader(hash common.Hash, number uint64) *types.Header
+}
+
+// batchHeaderReader resolves headers from a batch under verification before
+// falling back to the chain, since the batch is not yet part of it.
+type batchHeaderReader struct {
+	consensus.ChainHeaderReader
+	headers map[common.Hash]*types.Header
+}
+
+// newBatchHeaderReader wraps a chain, making the given headers retrievable.
+func newBatchHeaderReader(chain consensus.ChainHeaderReader, headers []*types.Header) *batchHeaderReader {
+	batch := &batchHeaderReader{
+		ChainHeaderReader: chain,
+		headers:           make(map[common.Hash]*types.Header, len(headers)),
+	}
+	for _, header := range headers {
+		batch.headers[header.Hash()] = header
+	}
+	return batch
+}
+
+// GetHeader implements consensus.ChainHeaderReader, retrieving a header from the
+// batch or the chain.
+func (r *batchHeaderReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := r.headers[hash]; ok && header.Number.Uint64() == number {
+		return header
+	}
+	return r.ChainHeaderReader.GetHeader(hash, number)
+}
+
+// targetBlockTime returns the block time targeted by the chain config at block
+// next, in seconds.
+func targetBlockTime(config *params.ChainConfig, next *big.Int) uint64 {
+	if target := config.Ethash.BlockTimeAt(next); target != 0 {
+		return target
+	}
+	return defaultDifficultyTargetTime
+}
+
+// hasDifficultyAlgos reports whether the chain config switches to alternative
+// difficulty algorithms, which may need the ancestors of a block.
+func hasDifficultyAlgos(config *params.ChainConfig) bool {
+	return config.Ethash != nil && len(config.Ethash.DifficultyAlgos) > 0
+}
+
+// difficultyWindow returns up to n+1 consecutive headers ending with parent,
+// oldest first. The window is shorter close to genesis or if ancestors are
+// missing from the chain.
+func difficultyWindow(chain headerReader, parent *types.Header, n uint64) []*types.Header {
+	window := []*types.Header{parent}
+	for header := parent; uint64(len(window)) <= n && header.Number.Sign() > 0; {
+		if header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			break
+		}
+		window = append(window, header)
+	}
+	for i, j := 0, len(window)-1; i < j; i, j = i+1, j-1 {
+		window[i], window[j] = window[j], window[i]
+	}
+	return window
+}
+
+// calcDifficultyAlgo computes the difficulty of a block with the algorithm of a
+// chain config switch.
+func calcDifficultyAlgo(chain headerReader, config *params.ChainConfig, algo *params.DifficultyAlgoConfig, time uint64, parent *types.Header) *big.Int {
+	target := algo.TargetTime
+	if target == 0 {
+		target = targetBlockTime(config, new(big.Int).Add(parent.Number, big1))
+	}
+	window := algo.Window
+
+	var diff *big.Int
+	switch algo.Algo {
+	case params.DifficultyAlgoDigishield:
+		if window == 0 {
+			window = defaultDigishieldWindow
+		}
+		diff = calcDifficultyDigishield(difficultyWindow(chain, parent, window), target)
+	case params.DifficultyAlgoLWMA:
+		if window == 0 {
+			window = defaultLWMAWindow
+		}
+		diff = calcDifficultyLWMA(difficultyWindow(chain, parent, window), target)
+	case params.DifficultyAlgoEMA:
+		if window == 0 {
+			window = defaultEMAWindow
+		}
+		diff = calcDifficultyEMA(time, parent, target, window)
+	default:
+		return nil
+	}
+	// The difficulty range of the chain may lower the floor
+	floor := params.MinimumDifficulty
+	if bounds := config.Ethash.DifficultyRangeAt(new(big.Int).Add(parent.Number, big1)); bounds != nil {
+		floor = bounds.Floor()
+	}
+	if diff.Cmp(floor) < 0 {
+		diff.Set(floor)
+	}
+	return diff
+}
+
+// calcDifficultyDigishield is Digishield v3: the average difficulty of the
+// window, scaled by the ratio of the targeted to the actual timespan of the
+// window. The timespan is dampened to a quarter of its deviation and bounded to
+// -16%/+32% of the targeted one.
+func calcDifficultyDigishield(window []*types.Header, target uint64) *big.Int {
+	parent := window[len(window)-1]
+	if len(window) < 2 {
+		return new(big.Int).Set(parent.Difficulty)
+	}
+	var (
+		blocks   = uint64(len(window) - 1)
+		sum      = new(big.Int)
+		expected = blocks * target
+		actual   = parent.Time - window[0].Time
+	)
+	for _, header := range window[1:] {
+		sum.Add(sum, header.Difficulty)
+	}
+	// timespan = expected + (actual - expected) / 4, within [84%, 132%] of expected
+	timespan := new(big.Int).SetUint64(actual)
+	timespan.Sub(timespan, new(big.Int).SetUint64(expected))
+	timespan.Quo(timespan, big.NewInt(4))
+	timespan.Add(timespan, new(big.Int).SetUint64(expected))
+
+	if lower := new(big.Int).SetUint64(expected * 84 / 100); timespan.Cmp(lower) < 0 {
+		timespan = lower
+	}
+	if upper := new(big.Int).SetUint64(expected * 132 / 100); timespan.Cmp(upper) > 0 {
+		timespan = upper
+	}
+	// diff = sum / blocks * expected / timespan
+	diff := sum.Mul(sum, new(big.Int).SetUint64(expected))
+	return diff.Div(diff, timespan.Mul(timespan, new(big.Int).SetUint64(blocks)))
+}
+
+// calcDifficultyLWMA is the linearly weighted moving average difficulty
+// algorithm (LWMA-1): the average difficulty of the window, scaled by the ratio
+// of the targeted block time to the average block time, weighting recent blocks
+// more. Individual block times are capped to six times the target.
+func calcDifficultyLWMA(window []*types.Header, target uint64) *big.Int {
+	parent := window[len(window)-1]
+	if len(window) < 2 {
+		return new(big.Int).Set(parent.Difficulty)
+	}
+	var (
+		blocks   = uint64(len(window) - 1)
+		sum      = new(big.Int)
+		weighted uint64
+	)
+	for i := uint64(1); i <= blocks; i++ {
+		solvetime := window[i].Time - window[i-1].Time
+		if solvetime > 6*target {
+			solvetime = 6 * target
+		}
+		weighted += i * solvetime
+		sum.Add(sum, window[i].Difficulty)
+	}
+	// Guard against timestamp manipulation collapsing the weighted time
+	k := blocks * (blocks + 1) / 2
+	if min := k * target / 10; weighted < min {
+		weighted = min
+	}
+	if weighted == 0 {
+		weighted = 1
+	}
+	// diff = sum / blocks * k * target / weighted
+	diff := sum.Mul(sum, new(big.Int).SetUint64(k*target))
+	return diff.Div(diff, new(big.Int).SetUint64(blocks*weighted))
+}
+
+// calcDifficultyEMA is an exponential moving average of the block times,
+// adjusting the parent difficulty by the deviation of the new block's time from
+// the target, smoothed over the given number of blocks. Block times are capped
+// to six times the target.
+func calcDifficultyEMA(time uint64, parent *types.Header, target uint64, window uint64) *big.Int {
+	solvetime := time - parent.Time
+	if solvetime > 6*target {
+		solvetime = 6 * target
+	}
+	// diff = parent_diff * target * window / (target * (window - 1) + solvetime)
+	denom := target*(window-1) + solvetime
+	if denom == 0 {
+		denom = 1
+	}
+	diff := new(big.Int).Mul(parent.Difficulty, new(big.Int).SetUint64(target*window))
+	return diff.Div(diff, new(big.Int).SetUint64(denom))
+}
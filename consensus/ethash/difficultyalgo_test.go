@@ -0,0 +1,181 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testHeaderChain is a minimal consensus.ChainHeaderReader over a set of headers.
+type testHeaderChain struct {
+	config    *params.ChainConfig
+	headers   map[common.Hash]*types.Header
+	canonical map[uint64]common.Hash
+}
+
+func (c *testHeaderChain) Config() *params.ChainConfig  { return c.config }
+func (c *testHeaderChain) CurrentHeader() *types.Header { return nil }
+func (c *testHeaderChain) GetHeaderByNumber(number uint64) *types.Header {
+	if hash, ok := c.canonical[number]; ok {
+		return c.headers[hash]
+	}
+	return nil
+}
+func (c *testHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.headers[hash]
+}
+func (c *testHeaderChain) GetTd(hash common.Hash, number uint64) *big.Int { return nil }
+func (c *testHeaderChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+// makeDifficultyWindow creates n+1 headers with the given difficulty and block
+// time, oldest first.
+func makeDifficultyWindow(n int, difficulty int64, blocktime uint64) []*types.Header {
+	window := make([]*types.Header, n+1)
+	for i := range window {
+		window[i] = &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Time:       uint64(i) * blocktime,
+			Difficulty: big.NewInt(difficulty),
+		}
+	}
+	return window
+}
+
+// Tests that the difficulty algorithms hold the difficulty at the target block
+// time and move it in the right direction otherwise.
+func TestDifficultyAlgos(t *testing.T) {
+	const (
+		target     = 15
+		difficulty = 10_000_000
+	)
+	tests := []struct {
+		name string
+		calc func(window []*types.Header) *big.Int
+	}{
+		{"digishield", func(window []*types.Header) *big.Int { return calcDifficultyDigishield(window, target) }},
+		{"lwma", func(window []*types.Header) *big.Int { return calcDifficultyLWMA(window, target) }},
+		{"ema", func(window []*types.Header) *big.Int {
+			parent := window[len(window)-1]
+			return calcDifficultyEMA(parent.Time+(parent.Time-window[len(window)-2].Time), parent, target, 20)
+		}},
+	}
+	for _, tt := range tests {
+		if have := tt.calc(makeDifficultyWindow(20, difficulty, target)); have.Int64() != difficulty {
+			t.Errorf("%s: steady difficulty mismatch: have %v, want %d", tt.name, have, difficulty)
+		}
+		if have := tt.calc(makeDifficultyWindow(20, difficulty, target/3)); have.Int64() <= difficulty {
+			t.Errorf("%s: difficulty not raised for fast blocks: have %v", tt.name, have)
+		}
+		if have := tt.calc(makeDifficultyWindow(20, difficulty, target*3)); have.Int64() >= difficulty {
+			t.Errorf("%s: difficulty not lowered for slow blocks: have %v", tt.name, have)
+		}
+	}
+	// The window based algorithms keep the parent difficulty without history
+	if have := calcDifficultyDigishield(makeDifficultyWindow(0, difficulty, target), target); have.Int64() != difficulty {
+		t.Errorf("digishield: genesis difficulty mismatch: have %v, want %d", have, difficulty)
+	}
+	if have := calcDifficultyLWMA(makeDifficultyWindow(0, difficulty, target), target); have.Int64() != difficulty {
+		t.Errorf("lwma: genesis difficulty mismatch: have %v, want %d", have, difficulty)
+	}
+	// Digishield bounds the timespan to -16%/+32% of the expected 17*15 seconds
+	if have, want := calcDifficultyDigishield(makeDifficultyWindow(17, difficulty, 1), target), int64(difficulty*255/214); have.Int64() != want {
+		t.Errorf("digishield: upper bound mismatch: have %v, want %d", have, want)
+	}
+	if have, want := calcDifficultyDigishield(makeDifficultyWindow(17, difficulty, 1000), target), int64(difficulty*255/336); have.Int64() != want {
+		t.Errorf("digishield: lower bound mismatch: have %v, want %d", have, want)
+	}
+}
+
+// Tests that the chain config switches difficulty algorithms at their activation
+// blocks and that batches of headers are verified against them.
+func TestDifficultyAlgoSwitch(t *testing.T) {
+	config := &params.ChainConfig{
+		ChainID:        big.NewInt(1),
+		HomesteadBlock: big.NewInt(0),
+		Ethash: &params.EthashConfig{
+			DifficultyAlgos: []*params.DifficultyAlgoConfig{
+				{Block: big.NewInt(5), Algo: params.DifficultyAlgoLWMA, TargetTime: 10, Window: 4},
+				{Block: big.NewInt(10), Algo: params.DifficultyAlgoEMA, TargetTime: 10},
+				{Block: big.NewInt(15), Algo: params.DifficultyAlgoEthash},
+			},
+		},
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		t.Fatalf("invalid chain config: %v", err)
+	}
+	genesis := &types.Header{
+		Number:     big.NewInt(0),
+		Difficulty: big.NewInt(1_000_000),
+		GasLimit:   5000,
+		UncleHash:  types.EmptyUncleHash,
+	}
+	var (
+		hmhash  = NewFaker()
+		chain   = &testHeaderChain{config: config, headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		headers []*types.Header
+		seals   []bool
+	)
+	parent := genesis
+	for i := 1; i <= 20; i++ {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			UncleHash:  types.EmptyUncleHash,
+			Number:     big.NewInt(int64(i)),
+			Time:       parent.Time + uint64(3+i%7),
+			GasLimit:   5000,
+		}
+		header.Difficulty = hmhash.CalcDifficulty(chain, header.Time, parent)
+
+		switch {
+		case i < 5 || i >= 15:
+			if want := CalcDifficulty(config, header.Time, parent); header.Difficulty.Cmp(want) != 0 {
+				t.Errorf("block %d: ethash difficulty mismatch: have %v, want %v", i, header.Difficulty, want)
+			}
+		case i < 10:
+			if want := calcDifficultyLWMA(difficultyWindow(chain, parent, 4), 10); header.Difficulty.Cmp(want) != 0 {
+				t.Errorf("block %d: lwma difficulty mismatch: have %v, want %v", i, header.Difficulty, want)
+			}
+		default:
+			if want := calcDifficultyEMA(header.Time, parent, 10, defaultEMAWindow); header.Difficulty.Cmp(want) != 0 {
+				t.Errorf("block %d: ema difficulty mismatch: have %v, want %v", i, header.Difficulty, want)
+			}
+		}
+		chain.headers[header.Hash()] = header
+		headers, seals = append(headers, header), append(seals, false)
+		parent = header
+	}
+	// Verify the headers as a batch, without the chain knowing about them
+	chain.headers = map[common.Hash]*types.Header{genesis.Hash(): genesis}
+
+	abort, results := hmhash.VerifyHeaders(chain, headers, seals)
+	defer close(abort)
+	for i := range headers {
+		if err := <-results; err != nil {
+			t.Fatalf("header %d: verification failed: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Scenarios of the difficulty vectors: the blocks the difficulty is computed
+// for, the seconds between the blocks, and the parent difficulty and time.
+var (
+	difficultyVectorNumbers   = []uint64{1, 1_000_000, 5_000_000, 10_000_000, 15_000_000}
+	difficultyVectorIntervals = []uint64{1, 5, 9, 10, 13, 15, 20, 30, 60, 100, 1000}
+	difficultyVectorParent    = new(big.Int).Lsh(big1, 40)
+	difficultyVectorTime      = uint64(1_600_000_000)
+)
+
+// DifficultyConfig is a named chain configuration the difficulty adjustment is
+// exercised with.
+type DifficultyConfig struct {
+	Name   string
+	Config *params.ChainConfig
+}
+
+// DifficultyConfigs returns the chain configurations covered by the difficulty
+// vectors: every stock Ethereum fork, the block time and bomb overrides, and the
+// alternative difficulty algorithms.
+func DifficultyConfigs() []DifficultyConfig {
+	forks := []func(c *params.ChainConfig){
+		func(c *params.ChainConfig) { c.HomesteadBlock = new(big.Int) },
+		func(c *params.ChainConfig) { c.ByzantiumBlock = new(big.Int) },
+		func(c *params.ChainConfig) { c.ConstantinopleBlock = new(big.Int) },
+		func(c *params.ChainConfig) { c.MuirGlacierBlock = new(big.Int) },
+		func(c *params.ChainConfig) { c.LondonBlock = new(big.Int) },
+		func(c *params.ChainConfig) { c.ArrowGlacierBlock = new(big.Int) },
+		func(c *params.ChainConfig) { c.GrayGlacierBlock = new(big.Int) },
+	}
+	// upTo returns a chain config with the first n stock forks enabled at genesis
+	upTo := func(n int, ethash *params.EthashConfig) *params.ChainConfig {
+		config := &params.ChainConfig{Ethash: ethash}
+		for _, fork := range forks[:n] {
+			fork(config)
+		}
+		return config
+	}
+	latest := len(forks)
+	return []DifficultyConfig{
+		{"frontier", upTo(0, nil)},
+		{"homestead", upTo(1, nil)},
+		{"byzantium", upTo(2, nil)},
+		{"constantinople", upTo(3, nil)},
+		{"muirglacier", upTo(4, nil)},
+		{"london", upTo(5, nil)},
+		{"arrowglacier", upTo(6, nil)},
+		{"grayglacier", upTo(latest, nil)},
+		{"blocktime", upTo(latest, &params.EthashConfig{BlockTime: 5})},
+		{"nobomb", upTo(latest, &params.EthashConfig{DifficultyBomb: &params.DifficultyBombConfig{Disabled: true}})},
+		{"bombdelay", upTo(latest, &params.EthashConfig{DifficultyBomb: &params.DifficultyBombConfig{Delay: 1_000_000, Period: 50_000}})},
+		{"digishield", upTo(latest, &params.EthashConfig{DifficultyAlgos: []*params.DifficultyAlgoConfig{{Block: new(big.Int), Algo: params.DifficultyAlgoDigishield}}})},
+		{"lwma", upTo(latest, &params.EthashConfig{DifficultyAlgos: []*params.DifficultyAlgoConfig{{Block: new(big.Int), Algo: params.DifficultyAlgoLWMA}}})},
+		{"ema", upTo(latest, &params.EthashConfig{DifficultyAlgos: []*params.DifficultyAlgoConfig{{Block: new(big.Int), Algo: params.DifficultyAlgoEMA}}})},
+	}
+}
+
+// DifficultyVector is a difficulty adjustment test case: the difficulty of a
+// block on top of a chain whose blocks all share the parent difficulty and are
+// spaced by the same interval, the block itself included.
+type DifficultyVector struct {
+	Config           string         `json:"config"`
+	Number           hexutil.Uint64 `json:"number"`
+	Interval         hexutil.Uint64 `json:"interval"`
+	ParentTime       hexutil.Uint64 `json:"parentTime"`
+	ParentDifficulty *hexutil.Big   `json:"parentDifficulty"`
+	ParentUncles     bool           `json:"parentUncles"`
+	Difficulty       *hexutil.Big   `json:"difficulty"`
+}
+
+// CalcDifficultyForConfig computes the difficulty vectors of a chain config over
+// every block number, block time and parent uncle scenario.
+func CalcDifficultyForConfig(name string, config *params.ChainConfig) []DifficultyVector {
+	var vectors []DifficultyVector
+	for _, number := range difficultyVectorNumbers {
+		for _, interval := range difficultyVectorIntervals {
+			for _, uncles := range []bool{false, true} {
+				parent := &types.Header{
+					Number:     new(big.Int).SetUint64(number - 1),
+					Time:       difficultyVectorTime,
+					Difficulty: difficultyVectorParent,
+					UncleHash:  types.EmptyUncleHash,
+				}
+				if uncles {
+					parent.UncleHash = common.Hash{0x01} // Anything but the empty uncle list
+				}
+				chain := &uniformChain{head: parent, interval: interval}
+				vectors = append(vectors, DifficultyVector{
+					Config:           name,
+					Number:           hexutil.Uint64(number),
+					Interval:         hexutil.Uint64(interval),
+					ParentTime:       hexutil.Uint64(parent.Time),
+					ParentDifficulty: (*hexutil.Big)(parent.Difficulty),
+					ParentUncles:     uncles,
+					Difficulty:       (*hexutil.Big)(calcDifficulty(chain, config, parent.Time+interval, parent)),
+				})
+			}
+		}
+	}
+	return vectors
+}
+
+// DifficultyVectors computes the difficulty vectors of all the configurations
+// returned by DifficultyConfigs.
+func DifficultyVectors() []DifficultyVector {
+	var vectors []DifficultyVector
+	for _, config := range DifficultyConfigs() {
+		vectors = append(vectors, CalcDifficultyForConfig(config.Name, config.Config)...)
+	}
+	return vectors
+}
+
+// uniformChain is a chain whose blocks all share the difficulty of its head and
+// are spaced by the same interval, resolving ancestors by number only.
+type uniformChain struct {
+	head     *types.Header
+	interval uint64
+}
+
+// GetHeader implements headerReader, synthesizing the ancestor at number.
+func (c *uniformChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	head := c.head.Number.Uint64()
+	if number > head {
+		return nil
+	}
+	if number == head {
+		return c.head
+	}
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(number),
+		Time:       c.head.Time - (head-number)*c.interval,
+		Difficulty: c.head.Difficulty,
+		UncleHash:  types.EmptyUncleHash,
+	}
+}
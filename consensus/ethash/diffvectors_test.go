@@ -0,0 +1,129 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests the difficulty vectors against difficulties computed by hand from the
+// adjustment rules of the chain configs.
+func TestDifficultyVectors(t *testing.T) {
+	var (
+		parent = new(big.Int).Lsh(big1, 40)
+		step   = new(big.Int).Rsh(parent, 11) // Adjustment quantum, a 2048th
+	)
+	// adjust returns the parent difficulty adjusted by n quanta plus the bomb
+	adjust := func(n int64, bomb int64) *big.Int {
+		diff := new(big.Int).Add(parent, new(big.Int).Mul(step, big.NewInt(n)))
+		if bomb >= 0 {
+			diff.Add(diff, new(big.Int).Lsh(big1, uint(bomb)))
+		}
+		return diff
+	}
+	tests := []struct {
+		config   string
+		number   uint64
+		interval uint64
+		uncles   bool
+		want     *big.Int
+	}{
+		{"frontier", 1, 5, false, adjust(1, -1)},
+		{"frontier", 1, 20, false, adjust(-1, -1)},
+		{"frontier", 1_000_000, 20, false, adjust(-1, 8)},
+		{"homestead", 1, 9, false, adjust(1, -1)},
+		{"homestead", 1, 10, false, adjust(0, -1)},
+		{"homestead", 1, 30, false, adjust(-2, -1)},
+		{"homestead", 1, 1000, false, adjust(-99, -1)},
+		{"byzantium", 1, 5, true, adjust(2, -1)},
+		{"byzantium", 1, 5, false, adjust(1, -1)},
+		{"byzantium", 5_000_000, 13, false, adjust(0, 18)},
+		{"grayglacier", 15_000_000, 13, false, adjust(0, 34)},
+		{"nobomb", 15_000_000, 13, false, adjust(0, -1)},
+		{"bombdelay", 15_000_000, 13, false, adjust(0, 50)},
+		{"blocktime", 1, 5, false, adjust(0, -1)},
+		{"blocktime", 1, 1, false, adjust(1, -1)},
+		{"ema", 1, 13, false, adjust(0, -1)},
+	}
+	configs := make(map[string]*params.ChainConfig)
+	for _, config := range DifficultyConfigs() {
+		configs[config.Name] = config.Config
+	}
+	for i, tt := range tests {
+		var have *big.Int
+		for _, v := range CalcDifficultyForConfig(tt.config, configs[tt.config]) {
+			if uint64(v.Number) == tt.number && uint64(v.Interval) == tt.interval && v.ParentUncles == tt.uncles {
+				have = v.Difficulty.ToInt()
+			}
+		}
+		if have == nil {
+			t.Fatalf("test %d (%s, block %d, %ds): no vector", i, tt.config, tt.number, tt.interval)
+		}
+		if have.Cmp(tt.want) != 0 {
+			t.Errorf("test %d (%s, block %d, %ds): difficulty mismatch: have %v, want %v", i, tt.config, tt.number, tt.interval, have, tt.want)
+		}
+	}
+}
+
+// Tests that the difficulty vectors cover every config and scenario, survive a
+// JSON round trip, and match the stock calculator where no algorithm switches.
+func TestDifficultyVectorsExport(t *testing.T) {
+	vectors := DifficultyVectors()
+	if want := len(DifficultyConfigs()) * len(difficultyVectorNumbers) * len(difficultyVectorIntervals) * 2; len(vectors) != want {
+		t.Fatalf("vector count mismatch: have %d, want %d", len(vectors), want)
+	}
+	blob, err := json.Marshal(vectors)
+	if err != nil {
+		t.Fatalf("failed to encode vectors: %v", err)
+	}
+	var decoded []DifficultyVector
+	if err := json.Unmarshal(blob, &decoded); err != nil {
+		t.Fatalf("failed to decode vectors: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, vectors) {
+		t.Errorf("vectors changed over JSON round trip")
+	}
+	configs := make(map[string]*params.ChainConfig)
+	for _, config := range DifficultyConfigs() {
+		configs[config.Name] = config.Config
+	}
+	for i, v := range vectors {
+		config := configs[v.Config]
+		if hasDifficultyAlgos(config) {
+			continue
+		}
+		parent := &types.Header{
+			Number:     new(big.Int).SetUint64(uint64(v.Number) - 1),
+			Time:       uint64(v.ParentTime),
+			Difficulty: v.ParentDifficulty.ToInt(),
+			UncleHash:  types.EmptyUncleHash,
+		}
+		if v.ParentUncles {
+			parent.UncleHash = common.Hash{0x01}
+		}
+		if want := CalcDifficulty(config, uint64(v.ParentTime+v.Interval), parent); want.Cmp(v.Difficulty.ToInt()) != 0 {
+			t.Errorf("vector %d: difficulty mismatch: have %v, want %v", i, v.Difficulty, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// errSealDraining is returned by Seal once the engine is draining.
+	errSealDraining = errors.New("hmhash is draining, no new work accepted")
+
+	// errDrainTimeout is returned by Drain if in-flight seals had to be aborted
+	// as they didn't finish in time.
+	errDrainTimeout = errors.New("in-flight seals aborted on drain timeout")
+)
+
+// Drain stops the engine from accepting new work to seal and waits up to the
+// given timeout for the in-flight seals to finish, aborting them afterwards.
+// Once the miner threads stopped, a final hash rate sample is published. Drain
+// is meant to be called before Close for clean restarts of mining nodes, which
+// Close does by itself if a drain timeout is configured.
+func (hmhash *Hmhash) Drain(timeout time.Duration) error {
+	hmhash.lock.Lock()
+	hmhash.draining = true
+	if hmhash.drain == nil {
+		hmhash.drain = make(chan struct{})
+	}
+	drain := hmhash.drain
+	hmhash.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		hmhash.sealing.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		hmhash.lock.Lock()
+		select {
+		case <-drain:
+		default:
+			close(drain)
+		}
+		hmhash.lock.Unlock()
+
+		<-done
+		err = errDrainTimeout
+	}
+	hmhash.flushHashrate()
+	hmhash.logs.sealer.Info("Drained hmhash sealing", "aborted", err != nil)
+	return err
+}
+
+// flushHashrate publishes the hash rate recorded by the stopped miner threads,
+// along with the remote one, as a final sample.
+func (hmhash *Hmhash) flushHashrate() {
+	if hmhash.hashrate == nil {
+		return
+	}
+	sample := HashrateSample{Local: hmhash.hashrate.Rate1(), Time: time.Now()}
+	if hmhash.remote != nil {
+		res := make(chan uint64, 1)
+		select {
+		case hmhash.remote.fetchRateCh <- res:
+			sample.Remote = <-res
+		case <-hmhash.remote.exitCh:
+		}
+	}
+	hmhash.events.rates.Send(sample)
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that draining waits for in-flight seals, aborts them on timeout, refuses
+// new work and publishes a final hash rate sample.
+func TestDrain(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	samples := make(chan HashrateSample, 1)
+	defer hmhash.SubscribeHashrateSample(samples).Unsubscribe()
+
+	// Seal a block which won't be found in time
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(big.NewInt(1), 200)}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	start := time.Now()
+	if err := hmhash.Drain(100 * time.Millisecond); err != errDrainTimeout {
+		t.Errorf("drain error mismatch: have %v, want %v", err, errDrainTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("drain returned early after %v", elapsed)
+	}
+	select {
+	case <-samples:
+	default:
+		t.Errorf("no final hashrate sample published")
+	}
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != errSealDraining {
+		t.Errorf("seal error mismatch: have %v, want %v", err, errSealDraining)
+	}
+	// Draining without in-flight seals returns right away
+	idle := NewTester(nil, false)
+	defer idle.Close()
+
+	if err := idle.Drain(time.Minute); err != nil {
+		t.Errorf("idle drain failed: %v", err)
+	}
+}
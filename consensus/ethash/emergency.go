@@ -0,0 +1,51 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// emergencyDifficulty cuts the difficulty of block next if the emergency
+// difficulty adjustment of the chain is active and its parent is older than the
+// stall period at time. The difficulty is divided once for every stall period
+// elapsed, down to the difficulty floor of the chain.
+func emergencyDifficulty(config *params.ChainConfig, next *big.Int, time uint64, parent *types.Header, diff *big.Int) *big.Int {
+	eda := config.Ethash.EmergencyAt(next)
+	if eda == nil || time <= parent.Time {
+		return diff
+	}
+	periods := (time - parent.Time) / (eda.Stall * targetBlockTime(config, next))
+	if periods == 0 {
+		return diff
+	}
+	floor := params.MinimumDifficulty
+	if bounds := config.Ethash.DifficultyRangeAt(next); bounds != nil {
+		floor = bounds.Floor()
+	}
+	divisor := new(big.Int).SetUint64(eda.CutDivisor())
+	for ; periods > 0 && diff.Cmp(floor) > 0; periods-- {
+		diff.Div(diff, divisor)
+	}
+	if diff.Cmp(floor) < 0 {
+		diff.Set(floor)
+	}
+	return diff
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestEmergencyDifficulty(t *testing.T) {
+	stock := &params.ChainConfig{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}
+	config := *stock
+	config.Ethash = &params.EthashConfig{Emergency: &params.EmergencyConfig{Block: big.NewInt(1001), Stall: 12}}
+
+	parent := &types.Header{
+		Difficulty: big.NewInt(1_000_000_000),
+		Number:     big.NewInt(1000),
+		Time:       1_000_000,
+		UncleHash:  types.EmptyUncleHash,
+	}
+	stall := uint64(12 * defaultDifficultyTargetTime)
+	tests := []struct {
+		elapsed uint64
+		cut     int64
+	}{
+		{1, 1},
+		{stall - 1, 1},
+		{stall, 4},
+		{2*stall - 1, 4},
+		{2 * stall, 16},
+		{3 * stall, 64},
+	}
+	for i, tt := range tests {
+		want := CalcDifficulty(stock, parent.Time+tt.elapsed, parent)
+		want.Div(want, big.NewInt(tt.cut))
+		if have := CalcDifficulty(&config, parent.Time+tt.elapsed, parent); have.Cmp(want) != 0 {
+			t.Errorf("test %d: difficulty mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	// Long stalls bottom out at the minimum difficulty
+	if have := CalcDifficulty(&config, parent.Time+100*stall, parent); have.Cmp(params.MinimumDifficulty) != 0 {
+		t.Errorf("long stall difficulty mismatch: have %v, want %v", have, params.MinimumDifficulty)
+	}
+	// Blocks before the activation are left alone
+	early := types.CopyHeader(parent)
+	early.Number = big.NewInt(999)
+	if have, want := CalcDifficulty(&config, parent.Time+stall, early), CalcDifficulty(stock, parent.Time+stall, early); have.Cmp(want) != 0 {
+		t.Errorf("difficulty cut before activation: have %v, want %v", have, want)
+	}
+	// The stall period follows the targeted block time of the chain
+	slow := config
+	slow.Ethash = &params.EthashConfig{BlockTime: 60, Emergency: config.Ethash.Emergency}
+	if have, want := CalcDifficulty(&slow, parent.Time+stall, parent), CalcDifficulty(&params.ChainConfig{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0), Ethash: &params.EthashConfig{BlockTime: 60}}, parent.Time+stall, parent); have.Cmp(want) != 0 {
+		t.Errorf("difficulty cut before stall period: have %v, want %v", have, want)
+	}
+}
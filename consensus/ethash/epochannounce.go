@@ -0,0 +1,113 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// notificationHeader is the HTTP header marking the notifications posted to the
+// notify targets which aren't work packages, valued with their kind.
+const notificationHeader = "X-Hmhash-Notification"
+
+// EpochAnnouncement pre-announces an upcoming epoch to the remote miners, so
+// they can generate its DAG before the transition instead of stalling on it.
+type EpochAnnouncement struct {
+	Epoch    hexutil.Uint64 `json:"epoch"`
+	Blocks   hexutil.Uint64 `json:"blocksUntilEpoch"` // Blocks left until the first block of the epoch
+	SeedHash common.Hash    `json:"seedHash"`
+}
+
+// EpochAnnouncer is implemented by the remote transports able to pre-announce
+// upcoming epochs to their miners.
+type EpochAnnouncer interface {
+	AnnounceEpoch(ann EpochAnnouncement)
+}
+
+// announceEpoch pre-announces the epoch following the one of a work package to
+// the notify targets and remote transports, once per epoch, if the work is
+// within the configured distance of the transition.
+func (s *remoteSealer) announceEpoch(number uint64) {
+	distance := s.hmhash.config.EpochAnnounceDistance
+	if distance == 0 {
+		return
+	}
+	next := number/epochLength + 1
+	blocks := next*epochLength - number
+	if blocks > distance || s.announced >= next {
+		return
+	}
+	s.announced = next
+
+	ann := EpochAnnouncement{
+		Epoch:    hexutil.Uint64(next),
+		Blocks:   hexutil.Uint64(blocks),
+		SeedHash: common.BytesToHash(SeedHash(next * epochLength)),
+	}
+	s.hmhash.logs.sealer.Info("Announcing epoch to remote miners", logEpoch, next, "blocks", blocks, "seed", ann.SeedHash)
+
+	blob, _ := json.Marshal(ann)
+	header := s.hmhash.workHeader()
+	header.Set(notificationHeader, "epoch")
+
+	now := time.Now()
+	for _, target := range s.targets.all() {
+		if !target.ready(now) {
+			continue
+		}
+		s.reqWG.Add(1)
+		go func(url string) {
+			defer s.reqWG.Done()
+			if err := postNotification(s.notifyCtx, s.client, url, blob, header); err != nil {
+				s.hmhash.logs.sealer.Debug("Failed to announce epoch to remote miner", "miner", url, "err", err)
+			}
+		}(target.url)
+	}
+	for _, server := range s.hmhash.servers {
+		if announcer, ok := server.(EpochAnnouncer); ok {
+			announcer.AnnounceEpoch(ann)
+		}
+	}
+}
+
+// AnnounceEpoch implements EpochAnnouncer, pushing the announcement to the
+// subscribed miners as a mining.announce_epoch notification carrying the seed
+// hash, the epoch and the blocks left until it.
+func (s *stratumServer) AnnounceEpoch(ann EpochAnnouncement) {
+	msg := &stratumNotification{
+		Method: "mining.announce_epoch",
+		Params: []interface{}{strings.TrimPrefix(ann.SeedHash.Hex(), "0x"), uint64(ann.Epoch), uint64(ann.Blocks)},
+	}
+	s.lock.Lock()
+	sessions := make([]*stratumSession, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.lock.Unlock()
+
+	// Write on separate goroutines so slow miners can't stall the sealer
+	for _, session := range sessions {
+		if session.isSubscribed() {
+			go session.write(msg)
+		}
+	}
+}
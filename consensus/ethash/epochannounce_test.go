@@ -0,0 +1,96 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that upcoming epochs are announced once to the notify targets and the
+// stratum miners when the work gets close enough to the transition.
+func TestEpochAnnouncement(t *testing.T) {
+	announces := make(chan EpochAnnouncement, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(notificationHeader) != "epoch" {
+			return // Work notification
+		}
+		var ann EpochAnnouncement
+		if err := json.NewDecoder(req.Body).Decode(&ann); err != nil {
+			t.Errorf("invalid announcement: %v", err)
+		}
+		announces <- ann
+	}))
+	defer server.Close()
+
+	hmhash := New(Config{PowMode: ModeTest, StratumAddr: "127.0.0.1:0", EpochAnnounceDistance: 10}, []string{server.URL}, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	client := dialStratum(t, hmhash.stratum.listener.Addr().String())
+	defer client.conn.Close()
+	if res := client.call("mining.subscribe", "test", stratumProtocol); res["error"] != nil {
+		t.Fatalf("subscription failed: %v", res["error"])
+	}
+	seal := func(number uint64) {
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Difficulty: big.NewInt(100)}
+		hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+	}
+	// Work beyond the distance isn't announced, work within it is announced once
+	seal(epochLength - 11)
+	seal(epochLength - 5)
+	seal(epochLength - 4)
+
+	seed := common.BytesToHash(SeedHash(epochLength))
+	select {
+	case ann := <-announces:
+		if ann.Epoch != 1 || ann.Blocks != 5 || ann.SeedHash != seed {
+			t.Errorf("announcement mismatch: have %+v, want epoch 1 in 5 blocks with seed %x", ann, seed)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("announcement timeout")
+	}
+	select {
+	case ann := <-announces:
+		t.Errorf("epoch announced again: %+v", ann)
+	case <-time.After(100 * time.Millisecond):
+	}
+	for {
+		msg := client.read()
+		if msg["method"] != "mining.announce_epoch" {
+			continue
+		}
+		params := msg["params"].([]interface{})
+		if params[0] != common.Bytes2Hex(seed.Bytes()) || params[1] != float64(1) || params[2] != float64(5) {
+			t.Errorf("stratum announcement mismatch: %v", params)
+		}
+		break
+	}
+	for _, capability := range hmhash.WorkCapabilities() {
+		if capability == CapEpochAnnounce+"=10" {
+			return
+		}
+	}
+	t.Errorf("epoch announcements not advertised: %v", hmhash.WorkCapabilities())
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// WorkPackageIssued is posted when a block is handed out for sealing, to the
+// local miners and the remote sealer alike.
+type WorkPackageIssued struct {
+	SealHash   common.Hash
+	SeedHash   common.Hash
+	Number     uint64
+	Difficulty *big.Int
+}
+
+// SolutionFound is posted when a solution sealing a block is handed to the
+// miner, found locally or submitted by a remote miner.
+type SolutionFound struct {
+	SealHash common.Hash
+	Hash     common.Hash // Hash of the sealed block
+	Number   uint64
+	Nonce    types.BlockNonce
+	Remote   bool   // Whether the solution was submitted by a remote miner
+	Worker   string // Remote worker of the solution, empty if anonymous
+}
+
+// Reasons of the rejection of remote solutions.
+const (
+	RejectInvalid   = "invalid"   // Bad proof-of-work, or unknown or stale work
+	RejectDuplicate = "duplicate" // Solution submitted before
+	RejectBanned    = "banned"    // Submitter banned for abuse
+)
+
+// SolutionRejected is posted when a remote miner submits a solution which is
+// not accepted.
+type SolutionRejected struct {
+	SealHash common.Hash
+	Nonce    types.BlockNonce
+	Source   string // Remote worker, or IP address of anonymous miners
+	Reason   string // One of the Reject constants
+}
+
+// EpochTransition is posted when the engine starts sealing blocks of another
+// epoch than the previous ones.
+type EpochTransition struct {
+	Epoch  uint64
+	Number uint64 // Number of the first block sealed in the epoch
+}
+
+// HashrateSample is posted periodically by the remote sealer with the current
+// hash rates.
+type HashrateSample struct {
+	Local  float64 // Hash rate of the local miners
+	Remote uint64  // Sum of the hash rates submitted by remote miners
+	Time   time.Time
+}
+
+// CompetingChain is posted when header verification meets a chain competing
+// with the local one which forks off deeper than the alert depth below the local
+// head, so it would reorganize that many blocks if it overtook the local chain.
+type CompetingChain struct {
+	Ancestor       common.Hash // Common ancestor of both branches
+	AncestorNumber uint64
+	LocalHead      common.Hash // Tip of the local branch
+	LocalNumber    uint64
+	Tip            common.Hash // Tip of the competing branch, the verified header
+	TipNumber      uint64
+	Depth          uint64 // Blocks of the local branch past the common ancestor
+}
+
+// miningEvents are the feeds publishing the mining events, along with the state
+// needed to detect epoch transitions.
+type miningEvents struct {
+	work      event.Feed
+	found     event.Feed
+	reject    event.Feed
+	epochs    event.Feed
+	rates     event.Feed
+	failures  event.Feed
+	uncles    event.Feed
+	forks     event.Feed
+	withhold  event.Feed
+	forkRules event.Feed
+	scope     event.SubscriptionScope
+
+	epoch atomic.Uint64 // Epoch of the last sealed block plus one, zero if none yet
+}
+
+// SubscribeWorkPackageIssued registers a subscription for the work packages
+// handed out for sealing. Events are delivered synchronously, so the channel
+// has to be drained promptly not to stall sealing, as for all mining events.
+func (hmhash *Hmhash) SubscribeWorkPackageIssued(ch chan<- WorkPackageIssued) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.work.Subscribe(ch))
+}
+
+// SubscribeSolutionFound registers a subscription for the solutions sealing
+// blocks, found locally or remotely.
+func (hmhash *Hmhash) SubscribeSolutionFound(ch chan<- SolutionFound) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.found.Subscribe(ch))
+}
+
+// SubscribeSolutionRejected registers a subscription for the rejected solutions
+// of remote miners.
+func (hmhash *Hmhash) SubscribeSolutionRejected(ch chan<- SolutionRejected) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.reject.Subscribe(ch))
+}
+
+// SubscribeEpochTransition registers a subscription for the transitions of the
+// sealing epoch.
+func (hmhash *Hmhash) SubscribeEpochTransition(ch chan<- EpochTransition) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.epochs.Subscribe(ch))
+}
+
+// SubscribeHashrateSample registers a subscription for the periodic hash rate
+// samples.
+func (hmhash *Hmhash) SubscribeHashrateSample(ch chan<- HashrateSample) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.rates.Subscribe(ch))
+}
+
+// SubscribeCompetingChain registers a subscription for the chains competing
+// with the local one deeper than the alert depth, met during header
+// verification.
+func (hmhash *Hmhash) SubscribeCompetingChain(ch chan<- CompetingChain) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.forks.Subscribe(ch))
+}
+
+// SubscribeForkAlert registers a subscription for the alerts of the fork rule
+// monitor, raised when too many recent headers follow other consensus rules
+// than the local ones and cleared when they no longer do.
+func (hmhash *Hmhash) SubscribeForkAlert(ch chan<- ForkAlert) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.forkRules.Subscribe(ch))
+}
+
+// solutionFound records a sealed block handed to the miner and publishes it.
+func (hmhash *Hmhash) solutionFound(ev SolutionFound) {
+	solutionFoundMeter.Mark(1)
+	hmhash.lastSeal.Store(time.Now().UnixNano())
+	hmhash.events.found.Send(ev)
+}
+
+// SubscribeSealFailures implements consensus.SealFailureNotifier, registering a
+// subscription for the seals abandoned on the sealing deadline.
+func (hmhash *Hmhash) SubscribeSealFailures(ch chan<- consensus.SealFailure) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.failures.Subscribe(ch))
+}
+
+// SubscribeUncleCandidates implements consensus.UncleSealer, registering a
+// subscription for the blocks sealed by remote solutions to outdated work.
+func (hmhash *Hmhash) SubscribeUncleCandidates(ch chan<- *types.Block) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.uncles.Subscribe(ch))
+}
+
+// postWork publishes a work package about to be sealed, preceded by an epoch
+// transition if it's in another epoch than the previous one.
+func (hmhash *Hmhash) postWork(block *types.Block) {
+	number := block.NumberU64()
+	epoch := number / epochLength
+
+	if prev := hmhash.events.epoch.Swap(epoch + 1); prev != 0 && prev != epoch+1 {
+		hmhash.events.epochs.Send(EpochTransition{Epoch: epoch, Number: number})
+	}
+	hmhash.events.work.Send(WorkPackageIssued{
+		SealHash:   hmhash.SealHash(block.Header()),
+		SeedHash:   common.BytesToHash(seedHash(number)),
+		Number:     number,
+		Difficulty: block.Difficulty(),
+	})
+}
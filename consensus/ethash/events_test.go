@@ -0,0 +1,90 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that sealing publishes the work packages, solutions, rejections and
+// epoch transitions on the mining event feeds.
+func TestMiningEvents(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	var (
+		works   = make(chan WorkPackageIssued, 4)
+		founds  = make(chan SolutionFound, 4)
+		rejects = make(chan SolutionRejected, 4)
+		epochs  = make(chan EpochTransition, 4)
+	)
+	defer hmhash.SubscribeWorkPackageIssued(works).Unsubscribe()
+	defer hmhash.SubscribeSolutionFound(founds).Unsubscribe()
+	defer hmhash.SubscribeSolutionRejected(rejects).Unsubscribe()
+	defer hmhash.SubscribeEpochTransition(epochs).Unsubscribe()
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	timeout := time.After(4 * time.Second)
+	select {
+	case work := <-works:
+		if work.SealHash != hmhash.SealHash(header) || work.Number != 1 {
+			t.Errorf("work package mismatch: %+v", work)
+		}
+	case <-timeout:
+		t.Fatalf("work package event timeout")
+	}
+	select {
+	case found := <-founds:
+		block := <-results
+		if found.Hash != block.Hash() || found.Remote {
+			t.Errorf("solution mismatch: have %+v, want local %x", found, block.Hash())
+		}
+	case <-timeout:
+		t.Fatalf("solution event timeout")
+	}
+	// Submit a bogus remote solution
+	if (&API{hmhash}).submitWork(types.EncodeNonce(1), common.Hash{1}, common.Hash{}, "rig") {
+		t.Fatalf("bogus solution accepted")
+	}
+	select {
+	case reject := <-rejects:
+		if reject.Source != "rig" || reject.Reason != RejectInvalid {
+			t.Errorf("rejection mismatch: %+v", reject)
+		}
+	case <-timeout:
+		t.Fatalf("rejection event timeout")
+	}
+	// Sealing a block of the next epoch transitions
+	hmhash.postWork(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(epochLength), Difficulty: big.NewInt(100)}))
+	select {
+	case epoch := <-epochs:
+		if epoch.Epoch != 1 || epoch.Number != epochLength {
+			t.Errorf("epoch transition mismatch: %+v", epoch)
+		}
+	case <-timeout:
+		t.Fatalf("epoch transition event timeout")
+	}
+}
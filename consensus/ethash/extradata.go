@@ -0,0 +1,96 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// errMissingExtraPrefix is returned if the extra-data vanity of a block
+	// doesn't start with the tag required by the extra-data policy.
+	errMissingExtraPrefix = errors.New("extra-data misses required prefix")
+
+	// errDeniedExtraTag is returned if the extra-data vanity of a block contains
+	// a tag denied by the extra-data policy.
+	errDeniedExtraTag = errors.New("extra-data contains denied tag")
+)
+
+// extraVanity returns the vanity of the extra-data of a header, without the
+// signature of validator sealed blocks or the auxiliary proof-of-work of
+// merge-mined ones.
+func extraVanity(chain consensus.ChainHeaderReader, header *types.Header) ([]byte, error) {
+	switch {
+	case chain.Config().Ethash.IsValidatorBlock(header.Number):
+		if len(header.Extra) < validatorSealLength {
+			return nil, errMissingValidatorSeal
+		}
+		return header.Extra[:len(header.Extra)-validatorSealLength], nil
+	case chain.Config().IsAuxPoW(header.Number) && isAuxPoW(header):
+		aux, err := decodeAuxPoW(header)
+		if err != nil {
+			return nil, err
+		}
+		return aux.Vanity, nil
+	default:
+		return header.Extra, nil
+	}
+}
+
+// verifyExtraData checks the extra-data vanity of a header against the extra-data
+// policy of the chain, if any.
+func verifyExtraData(chain consensus.ChainHeaderReader, header *types.Header) error {
+	rules := chain.Config().Ethash.ExtraDataRules(header.Number)
+	if rules == nil {
+		return nil
+	}
+	vanity, err := extraVanity(chain, header)
+	if err != nil {
+		return err
+	}
+	if uint64(len(vanity)) > rules.MaxVanity() {
+		return fmt.Errorf("%w: %d > %d", errExtraTooLong, len(vanity), rules.MaxVanity())
+	}
+	if !bytes.HasPrefix(vanity, rules.Prefix) {
+		return errMissingExtraPrefix
+	}
+	for _, tag := range rules.Denied {
+		if bytes.Contains(vanity, tag) {
+			return fmt.Errorf("%w: %q", errDeniedExtraTag, []byte(tag))
+		}
+	}
+	return nil
+}
+
+// applyExtraData conforms the extra-data vanity of a block being prepared to the
+// extra-data policy: the required prefix is prepended unless already present,
+// and the vanity is truncated to the maximum length.
+func applyExtraData(rules *params.ExtraDataConfig, vanity []byte) []byte {
+	if !bytes.HasPrefix(vanity, rules.Prefix) {
+		vanity = append(append([]byte{}, rules.Prefix...), vanity...)
+	}
+	if uint64(len(vanity)) > rules.MaxVanity() {
+		vanity = vanity[:rules.MaxVanity()]
+	}
+	return vanity
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the extra-data policy is enforced on the vanity of the blocks from
+// its activation onwards.
+func TestVerifyExtraData(t *testing.T) {
+	config := *params.TestChainConfig
+	config.Ethash = &params.EthashConfig{
+		ExtraData: &params.ExtraDataConfig{
+			Block:     big.NewInt(10),
+			MaxLength: 16,
+			Prefix:    []byte("farm/"),
+			Denied:    []hexutil.Bytes{[]byte("rogue")},
+		},
+		Hybrid: &params.HybridConfig{Block: big.NewInt(100), Period: 2},
+	}
+	chain := configReader{&config}
+
+	tests := []struct {
+		number uint64
+		extra  []byte
+		err    error
+	}{
+		{9, []byte("anything goes"), nil},
+		{10, []byte("farm/rig-1"), nil},
+		{10, []byte("rig-1"), errMissingExtraPrefix},
+		{10, []byte("farm/rogue-rig"), errDeniedExtraTag},
+		{10, []byte("farm/rig-with-a-long-name"), errors.New("extra-data too long: 25 > 16")},
+		{100, append([]byte("farm/rig-1"), make([]byte, validatorSealLength)...), nil},
+		{100, append([]byte("rig-1"), make([]byte, validatorSealLength)...), errMissingExtraPrefix},
+		{101, []byte("farm/rig-1"), nil},
+	}
+	for i, tt := range tests {
+		header := &types.Header{Number: new(big.Int).SetUint64(tt.number), Extra: tt.extra}
+		err := verifyExtraData(chain, header)
+		if (err == nil) != (tt.err == nil) || (err != nil && !errors.Is(err, tt.err) && err.Error() != tt.err.Error()) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that prepared blocks are conformed to the extra-data policy.
+func TestApplyExtraData(t *testing.T) {
+	rules := &params.ExtraDataConfig{Block: new(big.Int), MaxLength: 12, Prefix: []byte("farm/")}
+
+	tests := []struct {
+		vanity []byte
+		want   []byte
+	}{
+		{nil, []byte("farm/")},
+		{[]byte("rig-1"), []byte("farm/rig-1")},
+		{[]byte("farm/rig-1"), []byte("farm/rig-1")},
+		{[]byte("rig-with-a-long-name"), []byte("farm/rig-wit")},
+	}
+	for i, tt := range tests {
+		if have := applyExtraData(rules, tt.vanity); !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: vanity mismatch: have %q, want %q", i, have, tt.want)
+		}
+	}
+}
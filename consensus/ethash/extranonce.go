@@ -0,0 +1,110 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// maxExtranonceBytes is the longest extranonce prefix, leaving at least half of
+// the nonce space to every connection.
+const maxExtranonceBytes = 4
+
+var (
+	errExtranonceExhausted = errors.New("extranonce space exhausted")
+	errExtranonceMismatch  = errors.New("nonce outside of extranonce range")
+)
+
+// extranoncePool hands out unique nonce prefixes to remote connections, so
+// proxies and rental services splitting a work package between many workers
+// never search the same nonces.
+type extranoncePool struct {
+	size int // Length of the prefixes in bytes, zero if disabled
+
+	lock sync.Mutex
+	used map[uint32]struct{} // Prefixes currently leased to connections
+	next uint32              // Prefix to try first on the next allocation
+}
+
+// newExtranoncePool creates a pool of prefixes of the given length.
+func newExtranoncePool(size int) *extranoncePool {
+	if size > maxExtranonceBytes {
+		size = maxExtranonceBytes
+	}
+	return &extranoncePool{
+		size: size,
+		used: make(map[uint32]struct{}),
+	}
+}
+
+// allocate leases a new prefix, or returns nil if extranonces are disabled.
+func (p *extranoncePool) allocate() ([]byte, error) {
+	if p.size == 0 {
+		return nil, nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	space := uint64(1) << (8 * p.size)
+	if uint64(len(p.used)) >= space {
+		return nil, errExtranonceExhausted
+	}
+	for {
+		prefix := p.next
+		p.next = uint32((uint64(p.next) + 1) % space)
+		if _, ok := p.used[prefix]; !ok {
+			p.used[prefix] = struct{}{}
+
+			var blob [4]byte
+			binary.BigEndian.PutUint32(blob[:], prefix)
+			return blob[4-p.size:], nil
+		}
+	}
+}
+
+// release returns a prefix to the pool once its connection is gone.
+func (p *extranoncePool) release(extranonce []byte) {
+	if len(extranonce) == 0 {
+		return
+	}
+	var blob [4]byte
+	copy(blob[4-len(extranonce):], extranonce)
+
+	p.lock.Lock()
+	delete(p.used, binary.BigEndian.Uint32(blob[:]))
+	p.lock.Unlock()
+}
+
+// applyExtranonce completes a nonce submitted by a connection owning the given
+// prefix. Miners may submit either the full 8 byte nonce, which must start with
+// the prefix, or only the part following it.
+func applyExtranonce(extranonce []byte, nonce []byte) ([]byte, error) {
+	switch len(nonce) {
+	case 8:
+		if !bytes.HasPrefix(nonce, extranonce) {
+			return nil, errExtranonceMismatch
+		}
+		return nonce, nil
+	case 8 - len(extranonce):
+		return append(append(make([]byte, 0, 8), extranonce...), nonce...), nil
+	default:
+		return nil, errStratumInvalidParams
+	}
+}
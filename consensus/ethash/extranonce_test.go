@@ -0,0 +1,82 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Tests that extranonce prefixes are unique until released.
+func TestExtranoncePool(t *testing.T) {
+	// A disabled pool hands out empty prefixes
+	if extranonce, err := newExtranoncePool(0).allocate(); err != nil || len(extranonce) != 0 {
+		t.Fatalf("disabled pool allocation: have %x, %v", extranonce, err)
+	}
+	pool := newExtranoncePool(1)
+
+	seen := make(map[byte]bool)
+	for i := 0; i < 256; i++ {
+		extranonce, err := pool.allocate()
+		if err != nil {
+			t.Fatalf("allocation %d failed: %v", i, err)
+		}
+		if len(extranonce) != 1 {
+			t.Fatalf("allocation %d: prefix length mismatch: have %d, want 1", i, len(extranonce))
+		}
+		if seen[extranonce[0]] {
+			t.Fatalf("allocation %d: duplicate prefix %x", i, extranonce)
+		}
+		seen[extranonce[0]] = true
+	}
+	if _, err := pool.allocate(); !errors.Is(err, errExtranonceExhausted) {
+		t.Fatalf("exhausted pool error mismatch: have %v, want %v", err, errExtranonceExhausted)
+	}
+	pool.release([]byte{0x42})
+	if extranonce, err := pool.allocate(); err != nil || !bytes.Equal(extranonce, []byte{0x42}) {
+		t.Fatalf("released prefix not reused: have %x, %v", extranonce, err)
+	}
+}
+
+// Tests that submitted nonces are completed with, and checked against, the
+// prefix of the connection.
+func TestApplyExtranonce(t *testing.T) {
+	tests := []struct {
+		extranonce []byte
+		nonce      []byte
+		want       []byte
+		err        error
+	}{
+		{nil, []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{1, 2, 3, 4, 5, 6, 7, 8}, nil},
+		{nil, []byte{1, 2, 3}, nil, errStratumInvalidParams},
+		{[]byte{0xab, 0xcd}, []byte{3, 4, 5, 6, 7, 8}, []byte{0xab, 0xcd, 3, 4, 5, 6, 7, 8}, nil},
+		{[]byte{0xab, 0xcd}, []byte{0xab, 0xcd, 3, 4, 5, 6, 7, 8}, []byte{0xab, 0xcd, 3, 4, 5, 6, 7, 8}, nil},
+		{[]byte{0xab, 0xcd}, []byte{0xab, 0xce, 3, 4, 5, 6, 7, 8}, nil, errExtranonceMismatch},
+		{[]byte{0xab, 0xcd}, []byte{4, 5, 6, 7, 8}, nil, errStratumInvalidParams},
+	}
+	for i, tt := range tests {
+		nonce, err := applyExtranonce(tt.extranonce, tt.nonce)
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			continue
+		}
+		if !bytes.Equal(nonce, tt.want) {
+			t.Errorf("test %d: nonce mismatch: have %x, want %x", i, nonce, tt.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// finalizedCheckpointKey stores the latest finalized checkpoint as JSON.
+	finalizedCheckpointKey = []byte("hmhash-finalized-checkpoint")
+
+	// checkpointVotePrefix + number (uint64 big endian) + hash + signer stores the
+	// signatures of the checkpoints not yet finalized.
+	checkpointVotePrefix = []byte("hmhash-checkpoint-vote-")
+)
+
+var (
+	errFinalityDisabled        = errors.New("checkpoint finality disabled")
+	errNotCheckpoint           = errors.New("block is not a checkpoint")
+	errUnknownCheckpointSigner = errors.New("unknown checkpoint signer")
+
+	// errFinalizedConflict is returned if a header conflicts with a finalized
+	// checkpoint, which would reorganize the chain across it.
+	errFinalizedConflict = errors.New("block conflicts with finalized checkpoint")
+)
+
+// Checkpoint is a block co-signed by a quorum of checkpoint signers.
+type Checkpoint struct {
+	Number     hexutil.Uint64  `json:"number"`
+	Hash       common.Hash     `json:"hash"`
+	Signatures []hexutil.Bytes `json:"signatures"`
+}
+
+// CheckpointSigHash returns the hash checkpoint signers sign to co-sign a block:
+// keccak256(number (uint64 big endian) + hash).
+func CheckpointSigHash(number uint64, hash common.Hash) common.Hash {
+	var enc [8 + common.HashLength]byte
+	binary.BigEndian.PutUint64(enc[:], number)
+	copy(enc[8:], hash[:])
+	return crypto.Keccak256Hash(enc[:])
+}
+
+// checkpointID identifies a checkpoint candidate being co-signed.
+type checkpointID struct {
+	number uint64
+	hash   common.Hash
+}
+
+// finality collects the signatures of the checkpoint signers and tracks the
+// latest finalized checkpoint. The signatures and the finalized checkpoint are
+// stored in the database if any, and the new signatures relayed to the peers.
+type finality struct {
+	lock      sync.RWMutex
+	votes     map[checkpointID]map[common.Address][]byte // Signatures of the checkpoints not yet finalized
+	finalized *Checkpoint                                // Latest finalized checkpoint, nil if none yet
+
+	db     ethdb.KeyValueStore // Database persisting the checkpoints, nil if none
+	peers  []string            // RPC endpoints of the nodes relayed the signatures to
+	client *http.Client        // HTTP client relaying the signatures
+	log    log.Logger
+}
+
+// newFinality creates a checkpoint tracker, loading the checkpoints stored in
+// the database if any.
+func newFinality(db ethdb.KeyValueStore, peers []string, logger log.Logger) *finality {
+	f := &finality{
+		votes:  make(map[checkpointID]map[common.Address][]byte),
+		db:     db,
+		peers:  peers,
+		client: new(http.Client),
+		log:    logger,
+	}
+	if db == nil {
+		return f
+	}
+	if blob, err := db.Get(finalizedCheckpointKey); err == nil {
+		checkpoint := new(Checkpoint)
+		if err := json.Unmarshal(blob, checkpoint); err != nil {
+			logger.Error("Invalid finalized hmhash checkpoint", "err", err)
+		} else {
+			f.finalized = checkpoint
+		}
+	}
+	it := db.NewIterator(checkpointVotePrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()[len(checkpointVotePrefix):]
+		if len(key) != 8+common.HashLength+common.AddressLength {
+			continue
+		}
+		id := checkpointID{number: binary.BigEndian.Uint64(key), hash: common.BytesToHash(key[8 : 8+common.HashLength])}
+		if f.votes[id] == nil {
+			f.votes[id] = make(map[common.Address][]byte)
+		}
+		f.votes[id][common.BytesToAddress(key[8+common.HashLength:])] = common.CopyBytes(it.Value())
+	}
+	return f
+}
+
+// checkpointVoteKey = checkpointVotePrefix + number (uint64 big endian) + hash + signer
+func checkpointVoteKey(id checkpointID, signer common.Address) []byte {
+	key := make([]byte, 0, len(checkpointVotePrefix)+8+common.HashLength+common.AddressLength)
+	key = append(key, checkpointVotePrefix...)
+	key = binary.BigEndian.AppendUint64(key, id.number)
+	key = append(key, id.hash[:]...)
+	return append(key, signer[:]...)
+}
+
+// submit adds the signature of a checkpoint signer, returning whether it
+// finalized the checkpoint. A checkpoint is only finalized once it's part of the
+// local canonical chain, the signatures of others are kept until then.
+func (f *finality) submit(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, signature []byte) (bool, error) {
+	config := chain.Config().Ethash.Finality
+	if number == 0 || number%config.Interval != 0 {
+		return false, errNotCheckpoint
+	}
+	pubkey, err := crypto.SigToPub(CheckpointSigHash(number, hash).Bytes(), signature)
+	if err != nil {
+		return false, err
+	}
+	signer := crypto.PubkeyToAddress(*pubkey)
+
+	var known bool
+	for _, addr := range config.Signers {
+		if addr == signer {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return false, errUnknownCheckpointSigner
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.finalized != nil && number <= uint64(f.finalized.Number) {
+		return false, nil
+	}
+	id := checkpointID{number: number, hash: hash}
+	if f.votes[id] == nil {
+		f.votes[id] = make(map[common.Address][]byte)
+	}
+	if _, known := f.votes[id][signer]; !known {
+		f.votes[id][signer] = common.CopyBytes(signature)
+		if f.db != nil {
+			if err := f.db.Put(checkpointVoteKey(id, signer), signature); err != nil {
+				f.log.Error("Failed to store checkpoint signature", "number", number, "hash", hash, "err", err)
+			}
+		}
+		for _, peer := range f.peers {
+			go f.relay(peer, number, hash, signature)
+		}
+	}
+	if len(f.votes[id]) < config.Threshold() {
+		return false, nil
+	}
+	if canonical := chain.GetHeaderByNumber(number); canonical == nil || canonical.Hash() != hash {
+		f.log.Warn("Checkpoint quorum reached off the canonical chain", "number", number, "hash", hash)
+		return false, nil
+	}
+	// Quorum reached, finalize the checkpoint with its signatures ordered by signer
+	signers := make([]common.Address, 0, len(f.votes[id]))
+	for addr := range f.votes[id] {
+		signers = append(signers, addr)
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return bytes.Compare(signers[i][:], signers[j][:]) < 0
+	})
+	checkpoint := &Checkpoint{Number: hexutil.Uint64(number), Hash: hash}
+	for _, addr := range signers {
+		checkpoint.Signatures = append(checkpoint.Signatures, f.votes[id][addr])
+	}
+	f.finalized = checkpoint
+	for vote, signatures := range f.votes {
+		if vote.number > number {
+			continue
+		}
+		delete(f.votes, vote)
+		if f.db != nil {
+			for signer := range signatures {
+				f.db.Delete(checkpointVoteKey(vote, signer))
+			}
+		}
+	}
+	if f.db != nil {
+		blob, _ := json.Marshal(checkpoint)
+		if err := f.db.Put(finalizedCheckpointKey, blob); err != nil {
+			f.log.Error("Failed to store finalized checkpoint", "number", number, "hash", hash, "err", err)
+		}
+	}
+	f.log.Info("Finalized hmhash checkpoint", "number", number, "hash", hash, "signatures", len(signers))
+	return true, nil
+}
+
+// relay forwards a checkpoint signature to the hmhash RPC API of a peer.
+func (f *finality) relay(peer string, number uint64, hash common.Hash, signature []byte) {
+	blob, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "hmhash_submitCheckpointSignature",
+		"params":  []interface{}{hexutil.Uint64(number), hash, hexutil.Bytes(signature)},
+	})
+	if err := postNotification(context.Background(), f.client, peer, blob, nil); err != nil {
+		f.log.Debug("Failed to relay checkpoint signature", "peer", peer, "number", number, "err", err)
+	}
+}
+
+// latest returns the latest finalized checkpoint, or nil if none yet.
+func (f *finality) latest() *Checkpoint {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.finalized
+}
+
+// verify checks that a header doesn't conflict with the latest finalized
+// checkpoint: it must be the checkpoint itself at its height, and canonical
+// below it.
+func (f *finality) verify(chain consensus.ChainHeaderReader, header *types.Header) error {
+	checkpoint := f.latest()
+	if checkpoint == nil {
+		return nil
+	}
+	number := header.Number.Uint64()
+	switch {
+	case number > uint64(checkpoint.Number):
+		return nil
+	case number == uint64(checkpoint.Number):
+		if header.Hash() != checkpoint.Hash {
+			return errFinalizedConflict
+		}
+	default:
+		if canonical := chain.GetHeaderByNumber(number); canonical != nil && canonical.Hash() != header.Hash() {
+			return errFinalizedConflict
+		}
+	}
+	return nil
+}
+
+// FinalityAPI exposes the checkpoint finality of hmhash chains for the RPC
+// interface.
+type FinalityAPI struct {
+	hmhash *Hmhash
+	chain  consensus.ChainHeaderReader
+}
+
+// GetFinalizedBlock returns the latest finalized checkpoint, or nil if none has
+// been finalized yet.
+func (api *FinalityAPI) GetFinalizedBlock() (*Checkpoint, error) {
+	if api.hmhash.final == nil || api.chain.Config().Ethash == nil || api.chain.Config().Ethash.Finality == nil {
+		return nil, errFinalityDisabled
+	}
+	return api.hmhash.final.latest(), nil
+}
+
+// SubmitCheckpointSignature adds the signature of a checkpoint signer over
+// CheckpointSigHash of a checkpoint block, returning whether it finalized it.
+func (api *FinalityAPI) SubmitCheckpointSignature(number hexutil.Uint64, hash common.Hash, signature hexutil.Bytes) (bool, error) {
+	if api.hmhash.final == nil || api.chain.Config().Ethash == nil || api.chain.Config().Ethash.Finality == nil {
+		return false, errFinalityDisabled
+	}
+	return api.hmhash.final.submit(api.chain, uint64(number), hash, signature)
+}
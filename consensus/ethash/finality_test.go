@@ -0,0 +1,154 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that checkpoints are finalized once a quorum of the signers co-signed
+// them, and that headers conflicting with them are rejected.
+func TestCheckpointFinality(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	config := &params.FinalityConfig{Interval: 10}
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		config.Signers = append(config.Signers, crypto.PubkeyToAddress(keys[i].PublicKey))
+	}
+	sign := func(key *ecdsa.PrivateKey, number uint64, hash common.Hash) []byte {
+		sig, err := crypto.Sign(CheckpointSigHash(number, hash).Bytes(), key)
+		if err != nil {
+			t.Fatalf("failed to sign checkpoint: %v", err)
+		}
+		return sig
+	}
+	// Build a canonical chain of headers and a fork off it
+	chain := &testHeaderChain{
+		config:    &params.ChainConfig{Ethash: &params.EthashConfig{Finality: config}},
+		headers:   make(map[common.Hash]*types.Header),
+		canonical: make(map[uint64]common.Hash),
+	}
+	var canonical, fork []*types.Header
+	for i := 0; i <= 12; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), Extra: []byte("canonical")}
+		forked := &types.Header{Number: big.NewInt(int64(i)), Extra: []byte("fork")}
+		if i > 0 {
+			header.ParentHash, forked.ParentHash = canonical[i-1].Hash(), fork[i-1].Hash()
+		}
+		canonical, fork = append(canonical, header), append(fork, forked)
+		chain.headers[header.Hash()], chain.canonical[uint64(i)] = header, header.Hash()
+	}
+	checkpoint := canonical[10].Hash()
+	db := rawdb.NewMemoryDatabase()
+	f := newFinality(db, nil, log.Root())
+
+	// Reject signatures of non-checkpoint blocks and unknown signers
+	if _, err := f.submit(chain, 5, canonical[5].Hash(), sign(keys[0], 5, canonical[5].Hash())); err != errNotCheckpoint {
+		t.Fatalf("non-checkpoint error mismatch: have %v, want %v", err, errNotCheckpoint)
+	}
+	outsider, _ := crypto.GenerateKey()
+	if _, err := f.submit(chain, 10, checkpoint, sign(outsider, 10, checkpoint)); err != errUnknownCheckpointSigner {
+		t.Fatalf("unknown signer error mismatch: have %v, want %v", err, errUnknownCheckpointSigner)
+	}
+	// A quorum of three signatures is needed out of four signers, duplicates and
+	// signatures of other candidates don't count
+	for i, key := range []*ecdsa.PrivateKey{keys[0], keys[0], keys[1]} {
+		if done, err := f.submit(chain, 10, checkpoint, sign(key, 10, checkpoint)); err != nil || done {
+			t.Fatalf("signature %d: finalized early: %v, %v", i, done, err)
+		}
+	}
+	if done, err := f.submit(chain, 10, fork[10].Hash(), sign(keys[2], 10, fork[10].Hash())); err != nil || done {
+		t.Fatalf("fork finalized: %v, %v", done, err)
+	}
+	for i, header := range fork[1:] {
+		if err := f.verify(chain, header); err != nil {
+			t.Fatalf("fork header %d rejected before finality: %v", i+1, err)
+		}
+	}
+	if done, err := f.submit(chain, 10, checkpoint, sign(keys[3], 10, checkpoint)); err != nil || !done {
+		t.Fatalf("checkpoint not finalized: %v, %v", done, err)
+	}
+	if have := f.latest(); have == nil || have.Hash != checkpoint || have.Number != hexutil.Uint64(10) || len(have.Signatures) != 3 {
+		t.Fatalf("finalized checkpoint mismatch: have %+v", have)
+	}
+	// The canonical chain is still accepted, forks across the checkpoint aren't
+	for i, header := range canonical {
+		if err := f.verify(chain, header); err != nil {
+			t.Errorf("canonical header %d rejected: %v", i, err)
+		}
+	}
+	for i := 1; i <= 10; i++ {
+		if err := f.verify(chain, fork[i]); err != errFinalizedConflict {
+			t.Errorf("fork header %d error mismatch: have %v, want %v", i, err, errFinalizedConflict)
+		}
+	}
+	// Older checkpoints can't be finalized anymore
+	if done, err := f.submit(chain, 10, fork[10].Hash(), sign(keys[3], 10, fork[10].Hash())); err != nil || done {
+		t.Fatalf("stale checkpoint finalized: %v, %v", done, err)
+	}
+	// The finalized checkpoint survives restarts
+	if have := newFinality(db, nil, log.Root()).latest(); have == nil || have.Hash != checkpoint || len(have.Signatures) != 3 {
+		t.Fatalf("stored checkpoint mismatch: have %+v", have)
+	}
+	// A quorum off the canonical chain doesn't finalize the checkpoint
+	f = newFinality(nil, nil, log.Root())
+	for i, key := range keys[:3] {
+		if done, err := f.submit(chain, 10, fork[10].Hash(), sign(key, 10, fork[10].Hash())); err != nil || done {
+			t.Fatalf("signature %d: non-canonical checkpoint finalized: %v, %v", i, done, err)
+		}
+	}
+}
+
+// Tests that the signatures of the checkpoints not yet finalized survive
+// restarts.
+func TestCheckpointVotePersistence(t *testing.T) {
+	first, _ := crypto.GenerateKey()
+	second, _ := crypto.GenerateKey()
+	config := &params.FinalityConfig{Interval: 10, Signers: []common.Address{crypto.PubkeyToAddress(first.PublicKey), crypto.PubkeyToAddress(second.PublicKey)}}
+	chain := &testHeaderChain{
+		config:    &params.ChainConfig{Ethash: &params.EthashConfig{Finality: config}},
+		headers:   make(map[common.Hash]*types.Header),
+		canonical: make(map[uint64]common.Hash),
+	}
+	header := &types.Header{Number: big.NewInt(10)}
+	chain.headers[header.Hash()], chain.canonical[10] = header, header.Hash()
+
+	db := rawdb.NewMemoryDatabase()
+	sig, _ := crypto.Sign(CheckpointSigHash(10, header.Hash()).Bytes(), first)
+	if done, err := newFinality(db, nil, log.Root()).submit(chain, 10, header.Hash(), sig); err != nil || done {
+		t.Fatalf("checkpoint finalized early: %v, %v", done, err)
+	}
+	// The second signature after a restart reaches the quorum with the stored one
+	f := newFinality(db, nil, log.Root())
+	sig, _ = crypto.Sign(CheckpointSigHash(10, header.Hash()).Bytes(), second)
+	if done, err := f.submit(chain, 10, header.Hash(), sig); err != nil || !done {
+		t.Fatalf("checkpoint not finalized: %v, %v", done, err)
+	}
+	if it := db.NewIterator(checkpointVotePrefix, nil); it.Next() {
+		t.Errorf("signatures of finalized checkpoint left in the database")
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// errForkRulesDisabled is returned by the fork status queries if the fork rule
+// monitor is disabled.
+var errForkRulesDisabled = errors.New("fork rule monitor disabled")
+
+const (
+	// defaultForkRuleThreshold is the share of the observed headers, in percent,
+	// following other rules than the local ones from which an alert is raised.
+	defaultForkRuleThreshold = 25
+
+	// forkRuleMinSamples is the number of headers observed before the monitor
+	// raises alerts, so a lone invalid header after startup doesn't raise one.
+	forkRuleMinSamples = 16
+
+	// forkRuleRecent is the number of diverging headers returned in the status.
+	forkRuleRecent = 16
+)
+
+// Rules by which the observed headers diverge from the local ones.
+const (
+	ForkRuleExtraData  = "extra-data" // Extra-data format or content rejected
+	ForkRuleDifficulty = "difficulty" // Difficulty not matching the local adjustment
+	ForkRuleState      = "state"      // State or receipt root mismatch, such as other rewards
+	ForkRuleOther      = "other"      // Any other consensus rule
+)
+
+// ForkAlert is posted when the share of the recently observed headers following
+// other consensus rules than the local ones crosses the alert threshold, and
+// again once it falls back below.
+type ForkAlert struct {
+	Raised    bool           // Whether the alert is raised, or cleared
+	Observed  int            // Headers in the observation window
+	Diverging int            // Observed headers following other rules
+	Share     float64        // Percentage of the observed headers diverging
+	Reasons   map[string]int // Diverging headers by ForkRule constant
+}
+
+// DivergentHeader is a recently observed header following other consensus rules
+// than the local ones.
+type DivergentHeader struct {
+	Number   uint64         `json:"number"`
+	Hash     common.Hash    `json:"hash"`
+	Parent   common.Hash    `json:"parentHash"`
+	Coinbase common.Address `json:"miner"`
+	Rule     string         `json:"rule"`
+	Error    string         `json:"error"`
+}
+
+// ForkStatus is the state of the fork rule monitor, served by hmhash_forkStatus.
+type ForkStatus struct {
+	Window    int               `json:"window"`    // Headers tracked at most
+	Threshold float64           `json:"threshold"` // Percentage of diverging headers raising an alert
+	Observed  int               `json:"observed"`  // Headers in the observation window
+	Diverging int               `json:"diverging"` // Observed headers following other rules
+	Share     float64           `json:"share"`     // Percentage of the observed headers diverging
+	Reasons   map[string]int    `json:"reasons"`   // Diverging headers by rule
+	Alert     bool              `json:"alert"`     // Whether an alert is raised
+	Recent    []DivergentHeader `json:"recent"`    // Most recent diverging headers, newest first
+}
+
+// forkObservation is a header observed by the fork rule monitor, with the rule
+// it diverges by, empty if it follows the local rules.
+type forkObservation struct {
+	header *types.Header
+	rule   string
+	err    string
+}
+
+// forkRuleMonitor tracks the headers met during verification on any branch, and
+// raises an alert when too many of the recent ones follow other consensus rules
+// than the local ones, an early sign of a network split.
+type forkRuleMonitor struct {
+	window    int
+	threshold float64
+
+	ring      []forkObservation   // Observed headers, oldest overwritten first
+	next      int                 // Slot of the ring the next header is stored in
+	index     map[common.Hash]int // Slots of the observed headers by hash
+	diverging int
+	reasons   map[string]int
+	alert     bool
+	lock      sync.Mutex
+}
+
+// newForkRuleMonitor creates a monitor of the last window headers, alerting from
+// a share of diverging ones of threshold percent.
+func newForkRuleMonitor(window int, threshold float64) *forkRuleMonitor {
+	if threshold <= 0 {
+		threshold = defaultForkRuleThreshold
+	}
+	return &forkRuleMonitor{
+		window:    window,
+		threshold: threshold,
+		ring:      make([]forkObservation, 0, window),
+		index:     make(map[common.Hash]int),
+		reasons:   make(map[string]int),
+	}
+}
+
+// forkRule returns the consensus rule a verification error reports a header to
+// diverge by, and false if the error says nothing about the rules the header
+// follows, such as for missing ancestors or local reorganization limits. Seal
+// failures aren't counted either, as junk headers fail the same way.
+func forkRule(err error) (string, bool) {
+	switch {
+	case err == nil:
+		return "", true
+	case errors.Is(err, consensus.ErrUnknownAncestor), errors.Is(err, consensus.ErrPrunedAncestor),
+		errors.Is(err, consensus.ErrFutureBlock), errors.Is(err, errDeepReorg),
+		errors.Is(err, errNoReorgGuard), errors.Is(err, errFinalizedConflict),
+		errors.Is(err, errInvalidMixDigest), errors.Is(err, errInvalidPoW):
+		return "", false
+	case errors.Is(err, errExtraTooLong), errors.Is(err, errMissingExtraPrefix), errors.Is(err, errDeniedExtraTag),
+		errors.Is(err, misc.ErrBadProDAOExtra), errors.Is(err, misc.ErrBadNoDAOExtra):
+		return ForkRuleExtraData, true
+	case errors.Is(err, errInvalidDifficulty), errors.Is(err, errDifficultyRange), errors.Is(err, errWrongDifficulty):
+		return ForkRuleDifficulty, true
+	default:
+		return ForkRuleOther, true
+	}
+}
+
+// observe records a header diverging by the given rule, empty if following the
+// local rules, returning the alert to post if its state changed. A header seen
+// before is only recorded again if found diverging after all, as headers passing
+// verification may still fail on their state.
+func (m *forkRuleMonitor) observe(header *types.Header, rule string, err error) *ForkAlert {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	hash := header.Hash()
+	if slot, ok := m.index[hash]; ok {
+		if rule == "" || m.ring[slot].rule != "" {
+			return nil
+		}
+		m.ring[slot].rule, m.ring[slot].err = rule, err.Error()
+		m.diverging++
+		m.reasons[rule]++
+		return m.update()
+	}
+	obs := forkObservation{header: types.CopyHeader(header), rule: rule}
+	if err != nil {
+		obs.err = err.Error()
+	}
+	if len(m.ring) < m.window {
+		m.ring = append(m.ring, obs)
+	} else {
+		m.evict(m.ring[m.next])
+		m.ring[m.next] = obs
+	}
+	m.index[hash] = m.next
+	m.next = (m.next + 1) % m.window
+
+	if rule != "" {
+		m.diverging++
+		m.reasons[rule]++
+	}
+	return m.update()
+}
+
+// evict forgets an observation overwritten in the ring.
+func (m *forkRuleMonitor) evict(obs forkObservation) {
+	delete(m.index, obs.header.Hash())
+	if obs.rule == "" {
+		return
+	}
+	m.diverging--
+	if m.reasons[obs.rule]--; m.reasons[obs.rule] == 0 {
+		delete(m.reasons, obs.rule)
+	}
+}
+
+// share returns the percentage of the observed headers diverging.
+func (m *forkRuleMonitor) share() float64 {
+	if len(m.ring) == 0 {
+		return 0
+	}
+	return float64(m.diverging) * 100 / float64(len(m.ring))
+}
+
+// update raises or clears the alert, returning it if its state changed.
+func (m *forkRuleMonitor) update() *ForkAlert {
+	samples := forkRuleMinSamples
+	if m.window < samples {
+		samples = m.window
+	}
+	share := m.share()
+	raised := len(m.ring) >= samples && share >= m.threshold
+	if raised == m.alert {
+		return nil
+	}
+	m.alert = raised
+
+	reasons := make(map[string]int, len(m.reasons))
+	for rule, n := range m.reasons {
+		reasons[rule] = n
+	}
+	return &ForkAlert{Raised: raised, Observed: len(m.ring), Diverging: m.diverging, Share: share, Reasons: reasons}
+}
+
+// status returns the state of the monitor.
+func (m *forkRuleMonitor) status() *ForkStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status := &ForkStatus{
+		Window:    m.window,
+		Threshold: m.threshold,
+		Observed:  len(m.ring),
+		Diverging: m.diverging,
+		Share:     m.share(),
+		Reasons:   make(map[string]int, len(m.reasons)),
+		Alert:     m.alert,
+		Recent:    []DivergentHeader{},
+	}
+	for rule, n := range m.reasons {
+		status.Reasons[rule] = n
+	}
+	for i := 1; i <= len(m.ring) && len(status.Recent) < forkRuleRecent; i++ {
+		obs := m.ring[(m.next-i+m.window)%m.window]
+		if obs.rule == "" {
+			continue
+		}
+		status.Recent = append(status.Recent, DivergentHeader{
+			Number:   obs.header.Number.Uint64(),
+			Hash:     obs.header.Hash(),
+			Parent:   obs.header.ParentHash,
+			Coinbase: obs.header.Coinbase,
+			Rule:     obs.rule,
+			Error:    obs.err,
+		})
+	}
+	return status
+}
+
+// observeForkRules reports the outcome of the verification of a header to the
+// fork rule monitor, posting an alert if its state changed. Diverging headers
+// are only counted with a valid seal, so that fabricating them costs real work.
+func (hmhash *Hmhash) observeForkRules(chain consensus.ChainHeaderReader, header *types.Header, err error) {
+	if hmhash.forkRules == nil {
+		return
+	}
+	rule, ok := forkRule(err)
+	if !ok {
+		return
+	}
+	if rule != "" && hmhash.verifySeal(context.Background(), chain, header, false) != nil {
+		return
+	}
+	hmhash.reportForkRules(header, rule, err)
+}
+
+// reportForkRules records a header diverging by the given rule to the fork rule
+// monitor, posting an alert if its state changed.
+func (hmhash *Hmhash) reportForkRules(header *types.Header, rule string, err error) {
+	alert := hmhash.forkRules.observe(header, rule, err)
+	if alert == nil {
+		return
+	}
+	if alert.Raised {
+		forkRuleAlertMeter.Mark(1)
+		hmhash.logs.verifier.Warn("Network split suspected, recent blocks follow other rules", "observed", alert.Observed, "diverging", alert.Diverging, "share", alert.Share, "reasons", alert.Reasons)
+	} else {
+		hmhash.logs.verifier.Info("Network split alert cleared", "observed", alert.Observed, "diverging", alert.Diverging, "share", alert.Share)
+	}
+	hmhash.events.forkRules.Send(*alert)
+}
+
+// ForkStatus returns the share of the recently observed headers following other
+// consensus rules than the local ones, or an error if the monitor is disabled.
+func (hmhash *Hmhash) ForkStatus() (*ForkStatus, error) {
+	if hmhash.forkRules == nil {
+		return nil, errForkRulesDisabled
+	}
+	return hmhash.forkRules.status(), nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that verification errors are attributed to the rules they report the
+// headers to diverge by, ignoring those about the local view of the chain.
+func TestForkRule(t *testing.T) {
+	tests := []struct {
+		err     error
+		rule    string
+		counted bool
+	}{
+		{nil, "", true},
+		{consensus.ErrUnknownAncestor, "", false},
+		{consensus.ErrFutureBlock, "", false},
+		{errDeepReorg, "", false},
+		{fmt.Errorf("%w: 40 > 32", errExtraTooLong), ForkRuleExtraData, true},
+		{fmt.Errorf("%w: %q", errDeniedExtraTag, "rogue"), ForkRuleExtraData, true},
+		{fmt.Errorf("%w: have 1, want 2", errWrongDifficulty), ForkRuleDifficulty, true},
+		{errInvalidPoW, "", false},
+		{errOlderBlockTime, ForkRuleOther, true},
+	}
+	for i, tt := range tests {
+		rule, counted := forkRule(tt.err)
+		if rule != tt.rule || counted != tt.counted {
+			t.Errorf("test %d: rule mismatch: have %q/%v, want %q/%v", i, rule, counted, tt.rule, tt.counted)
+		}
+	}
+}
+
+// Tests that the monitor raises an alert once enough of the tracked headers
+// diverge, and clears it once the diverging ones leave the window.
+func TestForkRuleMonitor(t *testing.T) {
+	m := newForkRuleMonitor(20, 0)
+
+	header := func(n int64) *types.Header {
+		return &types.Header{Number: big.NewInt(n), Difficulty: common.Big1}
+	}
+	for i := int64(0); i < 13; i++ {
+		if alert := m.observe(header(i), "", nil); alert != nil {
+			t.Fatalf("header %d: unexpected alert %+v", i, alert)
+		}
+	}
+	// Diverging headers below the minimum samples don't raise alerts
+	for i := int64(13); i < 16; i++ {
+		if alert := m.observe(header(i), ForkRuleState, errors.New("invalid merkle root")); alert != nil {
+			t.Fatalf("header %d: unexpected alert %+v", i, alert)
+		}
+	}
+	// Headers seen before only count again if found diverging
+	if alert := m.observe(header(0), "", nil); alert != nil {
+		t.Fatalf("duplicate header raised alert %+v", alert)
+	}
+	if alert := m.observe(header(1), ForkRuleDifficulty, errWrongDifficulty); alert == nil || !alert.Raised || alert.Diverging != 4 || alert.Observed != 16 {
+		t.Fatalf("alert mismatch: have %+v, want raised with 4 of 16 diverging", alert)
+	}
+	status := m.status()
+	if !status.Alert || status.Reasons[ForkRuleState] != 3 || status.Reasons[ForkRuleDifficulty] != 1 {
+		t.Errorf("status mismatch: %+v", status)
+	}
+	if len(status.Recent) != 4 || status.Recent[0].Number != 15 || status.Recent[3].Number != 1 {
+		t.Errorf("recent headers mismatch: %+v", status.Recent)
+	}
+	// Push the diverging headers out of the window
+	var cleared *ForkAlert
+	for i := int64(16); i < 40; i++ {
+		if alert := m.observe(header(i), "", nil); alert != nil {
+			cleared = alert
+		}
+	}
+	if cleared == nil || cleared.Raised {
+		t.Fatalf("alert not cleared: %+v", cleared)
+	}
+	if status := m.status(); status.Observed != 20 || status.Diverging != 0 || len(status.Reasons) != 0 || len(status.Recent) != 0 {
+		t.Errorf("status mismatch after eviction: %+v", status)
+	}
+}
+
+// Tests that the engine reports the headers failing verification and the blocks
+// failing on their state to the monitor, alerting the subscribers.
+func TestForkRuleAlert(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeFake, ForkRuleWindow: 2, ForkRuleThreshold: 50}, nil, false)
+	defer hmhash.Close()
+
+	if _, err := NewFaker().ForkStatus(); !errors.Is(err, errForkRulesDisabled) {
+		t.Fatalf("disabled monitor error mismatch: have %v, want %v", err, errForkRulesDisabled)
+	}
+	alerts := make(chan ForkAlert, 2)
+	sub := hmhash.SubscribeForkAlert(alerts)
+	defer sub.Unsubscribe()
+
+	var (
+		parent = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(131072), Time: 1, GasLimit: params.GenesisGasLimit}
+		chain  = &testHeaderChain{
+			config:    params.TestChainConfig,
+			headers:   map[common.Hash]*types.Header{parent.Hash(): parent},
+			canonical: map[uint64]common.Hash{1: parent.Hash()},
+		}
+		header = &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(2), Difficulty: big.NewInt(1), Time: 2, GasLimit: params.GenesisGasLimit}
+	)
+	// Diverging headers without a valid seal aren't counted
+	hmhash.fakeFail = 2
+	if err := hmhash.VerifyHeader(chain, header, false); !errors.Is(err, errWrongDifficulty) {
+		t.Fatalf("verification error mismatch: have %v, want %v", err, errWrongDifficulty)
+	}
+	if status, _ := hmhash.ForkStatus(); status.Observed != 0 {
+		t.Fatalf("unsealed header observed: %+v", status)
+	}
+	hmhash.fakeFail = 0
+
+	if err := hmhash.VerifyHeader(chain, header, false); !errors.Is(err, errWrongDifficulty) {
+		t.Fatalf("verification error mismatch: have %v, want %v", err, errWrongDifficulty)
+	}
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3), Difficulty: common.Big1})
+	hmhash.DiagnoseState(chain, block, errors.New("invalid merkle root"))
+
+	select {
+	case alert := <-alerts:
+		if !alert.Raised || alert.Diverging != 2 || alert.Reasons[ForkRuleDifficulty] != 1 || alert.Reasons[ForkRuleState] != 1 {
+			t.Errorf("alert mismatch: %+v", alert)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fork alert not posted")
+	}
+	status, err := hmhash.ForkStatus()
+	if err != nil {
+		t.Fatalf("failed to get fork status: %v", err)
+	}
+	if !status.Alert || status.Share != 100 || len(status.Recent) != 2 || status.Recent[0].Rule != ForkRuleState {
+		t.Errorf("status mismatch: %+v", status)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// FuzzVerifySeal checks that seal verification rejects malformed headers,
+// including merge-mined ones, without panicking.
+func FuzzVerifySeal(f *testing.F) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	chain := &testHeaderChain{config: &params.ChainConfig{Ethash: &params.EthashConfig{AuxPoWBlock: big.NewInt(0)}}}
+
+	parent, _ := rlp.EncodeToBytes(&auxPoW{Vanity: []byte("vanity"), Parent: &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}})
+	f.Add(uint64(1), []byte{100}, uint64(0), make([]byte, 32), []byte("vanity"))
+	f.Add(uint64(epochLength), []byte{}, uint64(1), []byte{}, []byte{})
+	f.Add(uint64(2), []byte{1}, uint64(0), []byte{}, parent)
+	f.Add(uint64(3), []byte{1}, uint64(0), []byte{}, bytes.Repeat([]byte{0xc0}, int(params.MaximumExtraDataSize)+1))
+
+	f.Fuzz(func(t *testing.T, number uint64, difficulty []byte, nonce uint64, digest []byte, extra []byte) {
+		header := &types.Header{
+			Number:     new(big.Int).SetUint64(number % (4 * epochLength)), // Bound cache generation
+			Difficulty: new(big.Int).SetBytes(difficulty),
+			Nonce:      types.EncodeNonce(nonce),
+			MixDigest:  common.BytesToHash(digest),
+			Extra:      extra,
+		}
+		hmhash.verifySeal(context.Background(), chain, header, false)
+		hmhash.verifySeal(context.Background(), nil, header, false)
+	})
+}
+
+// FuzzSubmitWork checks that the remote sealer survives arbitrary parameters of
+// eth_submitWork, both while having work pending and not.
+func FuzzSubmitWork(f *testing.F) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("eth", &API{hmhash}); err != nil {
+		f.Fatalf("failed to register API: %v", err)
+	}
+	// Keep a work package pending, which can't be solved by chance
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(common.Big1, 200)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+	sealhash := hmhash.SealHash(header)
+
+	f.Add([]byte(fmt.Sprintf(`["0x0000000000000001", "%s", "0x%064x"]`, sealhash.Hex(), 0)))
+	f.Add([]byte(fmt.Sprintf(`["0x0000000000000001", "%s", "0x%064x", "token"]`, sealhash.Hex(), 0)))
+	f.Add([]byte(`["0x01", "0x02", "0x03"]`))
+	f.Add([]byte(`[null, null, null, null]`))
+	f.Add([]byte(`{"nonce": 1}`))
+	f.Add([]byte(`[`))
+
+	f.Fuzz(func(t *testing.T, params []byte) {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_submitWork","params":%s}`, params)
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
+
+// FuzzDatasetDump checks that malformed dataset dumps are rejected on import
+// without panicking.
+func FuzzDatasetDump(f *testing.F) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	cache := hmhash.cache(nil, 0)
+	dsize := hmhash.datasetSize(0)
+
+	magic := make([]byte, 4*len(dumpMagic))
+	for i, word := range dumpMagic {
+		binary.LittleEndian.PutUint32(magic[4*i:], word)
+	}
+	f.Add([]byte{})
+	f.Add(magic[:5])
+	f.Add(magic)
+	f.Add(append(append([]byte{}, magic...), make([]byte, dsize)...))
+	f.Add(append(append([]byte{}, magic...), bytes.Repeat([]byte{0xff}, int(dsize)+1)...))
+
+	f.Fuzz(func(t *testing.T, dump []byte) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "dump")
+		if err := os.WriteFile(path, dump, 0644); err != nil {
+			t.Fatalf("failed to write dump: %v", err)
+		}
+		importDataset(hmhash.algo, cache.cache, 0, dsize, filepath.Join(dir, "dag"), path)
+	})
+}
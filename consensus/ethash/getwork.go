@@ -0,0 +1,269 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rs/cors"
+)
+
+var errUnknownListenerNetwork = errors.New("unknown listener network")
+
+// GetworkListener is a listening address of the getwork endpoint.
+type GetworkListener struct {
+	// Network is "tcp" for the IPv4 and IPv6 addresses of the host (dual-stack
+	// if bound to [::]), "tcp4" or "tcp6" for a single IP version, or "unix" for
+	// a unix domain socket.
+	Network string
+
+	// Addr is the host and port to listen on, or the path of the unix socket.
+	Addr string
+
+	// Enabled tells whether the endpoint listens on the address, allowing to
+	// keep addresses configured while not in use.
+	Enabled bool
+}
+
+// String implements fmt.Stringer, in the form parsed by ParseGetworkListener.
+func (l GetworkListener) String() string {
+	return l.Network + "://" + l.Addr
+}
+
+// ParseGetworkListener parses an enabled getwork listener from an address with
+// an optional network scheme, e.g. 0.0.0.0:8008, tcp6://[::1]:8008 or
+// unix:///run/geth/getwork.sock. Addresses without scheme are bound over TCP.
+func ParseGetworkListener(addr string) (GetworkListener, error) {
+	if !strings.Contains(addr, "://") {
+		return GetworkListener{Network: "tcp", Addr: addr, Enabled: true}, nil
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return GetworkListener{}, err
+	}
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		return GetworkListener{Network: u.Scheme, Addr: u.Host, Enabled: true}, nil
+	case "unix":
+		return GetworkListener{Network: u.Scheme, Addr: u.Path, Enabled: true}, nil
+	default:
+		return GetworkListener{}, fmt.Errorf("%w: %q", errUnknownListenerNetwork, u.Scheme)
+	}
+}
+
+// getworkListeners returns the enabled listening addresses of the getwork
+// endpoint, GetworkAddr first.
+func getworkListeners(config *Config) []GetworkListener {
+	var listeners []GetworkListener
+	if config.GetworkAddr != "" {
+		listeners = append(listeners, GetworkListener{Network: "tcp", Addr: config.GetworkAddr, Enabled: true})
+	}
+	for _, l := range config.GetworkListeners {
+		if l.Enabled {
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
+
+// getworkServer serves the remote sealer API of the eth namespace over HTTP
+// JSON-RPC on its own listeners, apart from the node's RPC so that none of its
+// other namespaces are exposed to the mining farm. It has its own CORS policy
+// and timeouts, and is optionally served over TLS with client certificate
+// verification.
+type getworkServer struct {
+	hmhash    *Hmhash
+	listeners []net.Listener
+	rpc       *rpc.Server
+	server    *http.Server
+
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// listenGetwork opens the getwork listeners on the given addresses, serving TLS
+// over TCP if a config is given. Unix sockets are served in plain, access being
+// controlled by the permissions of the socket file. Calls are only served after
+// start is called.
+func listenGetwork(hmhash *Hmhash, addrs []GetworkListener, config *tls.Config) (*getworkServer, error) {
+	s := &getworkServer{
+		hmhash: hmhash,
+		rpc:    rpc.NewServer(),
+	}
+	for _, addr := range addrs {
+		listener, err := listenGetworkAddr(addr, config)
+		if err != nil {
+			s.closeListeners()
+			return nil, fmt.Errorf("%v: %w", addr, err)
+		}
+		s.listeners = append(s.listeners, listener)
+	}
+	if err := s.rpc.RegisterName("eth", &API{hmhash}); err != nil {
+		s.closeListeners()
+		return nil, err
+	}
+	timeouts := getworkTimeouts(hmhash.config.GetworkTimeouts)
+	s.server = &http.Server{
+		Handler:           getworkCORS(getworkBodyLimit(s.rpc, maxRequestSize(&hmhash.config)), hmhash.config.GetworkCORS),
+		ReadTimeout:       timeouts.ReadTimeout,
+		ReadHeaderTimeout: timeouts.ReadHeaderTimeout,
+		WriteTimeout:      timeouts.WriteTimeout,
+		IdleTimeout:       timeouts.IdleTimeout,
+	}
+	return s, nil
+}
+
+// getworkCORS wraps the getwork handler with the CORS policy of the allowed
+// origins, like the node's RPC.
+func getworkCORS(handler http.Handler, origins []string) http.Handler {
+	if len(origins) == 0 {
+		return handler
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodPost, http.MethodGet},
+		AllowedHeaders: []string{"*"},
+		MaxAge:         600,
+	}).Handler(handler)
+}
+
+// getworkTimeouts fills the unset HTTP timeouts of the getwork endpoint with
+// the defaults.
+func getworkTimeouts(timeouts rpc.HTTPTimeouts) rpc.HTTPTimeouts {
+	if timeouts.ReadTimeout == 0 {
+		timeouts.ReadTimeout = rpc.DefaultHTTPTimeouts.ReadTimeout
+	}
+	if timeouts.ReadHeaderTimeout == 0 {
+		timeouts.ReadHeaderTimeout = remoteSealerTimeout
+	}
+	if timeouts.WriteTimeout == 0 {
+		timeouts.WriteTimeout = rpc.DefaultHTTPTimeouts.WriteTimeout
+	}
+	if timeouts.IdleTimeout == 0 {
+		timeouts.IdleTimeout = rpc.DefaultHTTPTimeouts.IdleTimeout
+	}
+	return timeouts
+}
+
+// listenGetworkAddr opens a single getwork listener.
+func listenGetworkAddr(addr GetworkListener, config *tls.Config) (net.Listener, error) {
+	switch addr.Network {
+	case "tcp", "tcp4", "tcp6":
+		listener, err := net.Listen(addr.Network, addr.Addr)
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			listener = tls.NewListener(listener, config)
+		}
+		return listener, nil
+	case "unix":
+		// Remove any socket left behind by an unclean shutdown
+		if err := os.Remove(addr.Addr); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen(addr.Network, addr.Addr)
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownListenerNetwork, addr.Network)
+	}
+}
+
+// closeListeners closes the listeners of a server failing to start.
+func (s *getworkServer) closeListeners() {
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+}
+
+// Start begins serving getwork calls in the background.
+func (s *getworkServer) Start() {
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go func(listener net.Listener) {
+			defer s.wg.Done()
+			if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				s.hmhash.logs.sealer.Warn("Getwork server failed", "addr", listener.Addr(), "err", err)
+			}
+		}(listener)
+		s.hmhash.logs.sealer.Info("Getwork server started", "network", listener.Addr().Network(), "addr", listener.Addr())
+	}
+}
+
+// Close terminates the listener and all connections, waiting for them to exit.
+func (s *getworkServer) Close() {
+	s.once.Do(func() {
+		s.server.Close()
+		s.rpc.Stop()
+		s.wg.Wait()
+	})
+}
+
+// NotifyWork does nothing, getwork miners poll for new work.
+func (s *getworkServer) NotifyWork(work [4]string, block *types.Block) {}
+
+// remoteTLSConfigs loads the TLS configuration of the remote mining endpoints
+// from the certificate files of the config: the one the getwork server is
+// served with, nil if no certificate is configured, and the one work
+// notifications are sent with, nil to use the defaults.
+func remoteTLSConfigs(config *Config) (server *tls.Config, client *tls.Config, err error) {
+	if config.TLSCert == "" && config.TLSKey == "" && config.TLSCA == "" {
+		return nil, nil, nil
+	}
+	var (
+		certs []tls.Certificate
+		pool  *x509.CertPool
+	)
+	if config.TLSCert != "" || config.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if config.TLSCA != "" {
+		blob, err := os.ReadFile(config.TLSCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(blob) {
+			return nil, nil, fmt.Errorf("no certificates in %s", config.TLSCA)
+		}
+	}
+	if certs != nil {
+		server = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: certs}
+		if pool != nil {
+			server.ClientCAs = pool
+			server.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if len(getworkListeners(config)) > 0 || config.GRPCAddr != "" || config.HmwireAddr != "" {
+		return nil, nil, errors.New("client certificate authority set without server certificate")
+	}
+	client = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: certs, RootCAs: pool}
+	return server, client, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testCert issues a certificate signed by the given parent, or a self-signed
+// certificate authority if parent is nil.
+func testCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(crand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// Tests that the getwork endpoint is served over mutual TLS, rejecting clients
+// without a certificate signed by the configured authority.
+func TestGetworkTLS(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, blob []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, blob, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	ca, caKey, caPEM, _ := testCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "node", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCert(t, "rig", ca, caKey)
+
+	hmhash := New(Config{
+		PowMode:     ModeTest,
+		GetworkAddr: "127.0.0.1:0",
+		TLSCert:     write("node.crt", serverPEM),
+		TLSKey:      write("node.key", serverKeyPEM),
+		TLSCA:       write("ca.crt", caPEM),
+	}, nil, false)
+	defer hmhash.Close()
+
+	if hmhash.getwork == nil {
+		t.Fatalf("getwork server not started")
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatalf("failed to load client certificate: %v", err)
+	}
+	endpoint := "https://" + hmhash.getwork.listeners[0].Addr().String()
+	dial := func(certs []tls.Certificate) *rpc.Client {
+		transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}
+		client, err := rpc.DialHTTPWithClient(endpoint, &http.Client{Transport: transport, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("failed to dial getwork endpoint: %v", err)
+		}
+		return client
+	}
+	client := dial([]tls.Certificate{clientCert})
+	defer client.Close()
+
+	var work [4]string
+	if err := client.Call(&work, "eth_getWork"); err != nil {
+		t.Fatalf("failed to get work over mutual TLS: %v", err)
+	}
+	if want := hmhash.SealHash(header).Hex(); work[0] != want {
+		t.Errorf("work sealhash mismatch: have %s, want %s", work[0], want)
+	}
+	anonymous := dial(nil)
+	defer anonymous.Close()
+
+	if err := anonymous.Call(&work, "eth_getWork"); err == nil {
+		t.Errorf("client without certificate served")
+	}
+}
+
+// Tests the parsing of getwork listening addresses.
+func TestParseGetworkListener(t *testing.T) {
+	tests := []struct {
+		addr string
+		want GetworkListener
+		err  error
+	}{
+		{"0.0.0.0:8008", GetworkListener{Network: "tcp", Addr: "0.0.0.0:8008", Enabled: true}, nil},
+		{"tcp4://127.0.0.1:8008", GetworkListener{Network: "tcp4", Addr: "127.0.0.1:8008", Enabled: true}, nil},
+		{"tcp6://[::]:8008", GetworkListener{Network: "tcp6", Addr: "[::]:8008", Enabled: true}, nil},
+		{"unix:///run/geth/getwork.sock", GetworkListener{Network: "unix", Addr: "/run/geth/getwork.sock", Enabled: true}, nil},
+		{"udp://127.0.0.1:8008", GetworkListener{}, errUnknownListenerNetwork},
+	}
+	for _, tt := range tests {
+		have, err := ParseGetworkListener(tt.addr)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.addr, err, tt.err)
+		}
+		if have != tt.want {
+			t.Errorf("%s: listener mismatch: have %+v, want %+v", tt.addr, have, tt.want)
+		}
+	}
+}
+
+// Tests that the getwork endpoint serves every enabled listening address, over
+// both IP versions and unix sockets.
+func TestGetworkListeners(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "getwork.sock")
+	listeners := []GetworkListener{
+		{Network: "tcp4", Addr: "127.0.0.1:0", Enabled: true},
+		{Network: "unix", Addr: socket, Enabled: true},
+		{Network: "tcp4", Addr: "127.0.0.1:0", Enabled: false},
+	}
+	if probe, err := net.Listen("tcp6", "[::1]:0"); err == nil {
+		probe.Close()
+		listeners = append(listeners, GetworkListener{Network: "tcp6", Addr: "[::1]:0", Enabled: true})
+	}
+	hmhash := New(Config{PowMode: ModeTest, GetworkListeners: listeners}, nil, false)
+	defer hmhash.Close()
+
+	if hmhash.getwork == nil {
+		t.Fatalf("getwork server not started")
+	}
+	if have, want := len(hmhash.getwork.listeners), len(listeners)-1; have != want {
+		t.Fatalf("listener count mismatch: have %d, want %d", have, want)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+
+	for _, listener := range hmhash.getwork.listeners {
+		addr := listener.Addr()
+		transport := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, addr.Network(), addr.String())
+		}}
+		client, err := rpc.DialHTTPWithClient("http://getwork", &http.Client{Transport: transport, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("%s: failed to dial getwork endpoint: %v", addr, err)
+		}
+		var work [4]string
+		if err := client.Call(&work, "eth_getWork"); err != nil {
+			t.Errorf("%s: failed to get work: %v", addr, err)
+		} else if want := hmhash.SealHash(header).Hex(); work[0] != want {
+			t.Errorf("%s: work sealhash mismatch: have %s, want %s", addr, work[0], want)
+		}
+		client.Close()
+	}
+}
+
+// Tests that the getwork endpoint applies its own CORS policy and timeouts.
+func TestGetworkCORS(t *testing.T) {
+	hmhash := New(Config{
+		PowMode:         ModeTest,
+		GetworkAddr:     "127.0.0.1:0",
+		GetworkCORS:     []string{"http://farm.lan"},
+		GetworkTimeouts: rpc.HTTPTimeouts{WriteTimeout: 5 * time.Second},
+	}, nil, false)
+	defer hmhash.Close()
+
+	if hmhash.getwork == nil {
+		t.Fatalf("getwork server not started")
+	}
+	if have := hmhash.getwork.server.WriteTimeout; have != 5*time.Second {
+		t.Errorf("write timeout mismatch: have %v, want %v", have, 5*time.Second)
+	}
+	if have := hmhash.getwork.server.ReadTimeout; have != rpc.DefaultHTTPTimeouts.ReadTimeout {
+		t.Errorf("read timeout mismatch: have %v, want %v", have, rpc.DefaultHTTPTimeouts.ReadTimeout)
+	}
+	endpoint := "http://" + hmhash.getwork.listeners[0].Addr().String()
+	for origin, allowed := range map[string]bool{"http://farm.lan": true, "http://evil.example": false} {
+		req, _ := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_getHashrate"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", origin)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to call getwork endpoint: %v", err)
+		}
+		res.Body.Close()
+		if have := res.Header.Get("Access-Control-Allow-Origin") == origin; have != allowed {
+			t.Errorf("origin %s: allowed mismatch: have %v, want %v", origin, have, allowed)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// defaultGovernorInterval is the interval at which the thread governor samples
+// the node load if the config leaves it unset.
+const defaultGovernorInterval = 5 * time.Second
+
+// Names of the metrics the thread governor reads the node load from.
+const (
+	importLatencyMetric = "chain/inserts" // Timer of the block imports
+	rpcActiveMetric     = "rpc/active"    // Gauge of the RPC requests being served
+)
+
+var governorThrottledGauge = metrics.NewRegisteredGauge("hmhash/governor/throttled", nil)
+
+// nodeLoad is a sample of the load of the node the engine mines on.
+type nodeLoad struct {
+	importLatency time.Duration // Mean time recently taken to import a block
+	rpcActive     int64         // Number of RPC requests being served
+}
+
+// sampleNodeLoad reads the load of the node from its metrics.
+func sampleNodeLoad() nodeLoad {
+	var load nodeLoad
+	if timer, ok := metrics.DefaultRegistry.Get(importLatencyMetric).(metrics.Timer); ok {
+		load.importLatency = time.Duration(timer.Mean())
+	}
+	if gauge, ok := metrics.DefaultRegistry.Get(rpcActiveMetric).(metrics.Gauge); ok {
+		load.rpcActive = gauge.Value()
+	}
+	return load
+}
+
+// governor throttles the local mining threads while the node is loaded, taking
+// one off for every sample above the thresholds and ramping them back up one by
+// one while below half of them.
+type governor struct {
+	hmhash   *Hmhash
+	latency  time.Duration   // Block import latency above which threads are throttled, zero to ignore
+	active   int64           // RPC requests being served above which threads are throttled, zero to ignore
+	interval time.Duration   // Interval between the load samples
+	probe    func() nodeLoad // Sampler of the node load
+
+	throttled atomic.Int64 // Number of mining threads taken off
+
+	requestExit chan struct{}
+	exitCh      chan struct{}
+	closeOnce   sync.Once
+}
+
+// startGovernor creates a thread governor and starts its background thread.
+func startGovernor(hmhash *Hmhash, latency time.Duration, active int64, interval time.Duration, probe func() nodeLoad) *governor {
+	if interval == 0 {
+		interval = defaultGovernorInterval
+	}
+	g := &governor{
+		hmhash:      hmhash,
+		latency:     latency,
+		active:      active,
+		interval:    interval,
+		probe:       probe,
+		requestExit: make(chan struct{}),
+		exitCh:      make(chan struct{}),
+	}
+	go g.loop()
+	return g
+}
+
+// stop terminates the background thread and waits for it to exit.
+func (g *governor) stop() {
+	g.closeOnce.Do(func() {
+		close(g.requestExit)
+		<-g.exitCh
+	})
+}
+
+func (g *governor) loop() {
+	defer close(g.exitCh)
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			g.adjust(g.probe())
+
+		case <-g.requestExit:
+			return
+		}
+	}
+}
+
+// pressure returns whether the node load is above the thresholds (1), below
+// half of them (-1) or in between (0), the latter keeping the threads as they
+// are to avoid flapping.
+func (g *governor) pressure(load nodeLoad) int {
+	var (
+		high = (g.latency > 0 && load.importLatency > g.latency) || (g.active > 0 && load.rpcActive > g.active)
+		low  = (g.latency == 0 || load.importLatency <= g.latency/2) && (g.active == 0 || load.rpcActive <= g.active/2)
+	)
+	switch {
+	case high:
+		return 1
+	case low:
+		return -1
+	}
+	return 0
+}
+
+// adjust takes a mining thread off or puts one back depending on the node load,
+// keeping at least one running. The miners are restarted if the count changed.
+func (g *governor) adjust(load nodeLoad) {
+	pressure := g.pressure(load)
+	if pressure == 0 {
+		return
+	}
+	threads := g.hmhash.Threads()
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+	throttled := g.throttled.Load() + int64(pressure)
+	if max := int64(threads) - 1; throttled > max {
+		throttled = max
+	}
+	if throttled < 0 {
+		throttled = 0
+	}
+	if throttled == g.throttled.Load() {
+		return
+	}
+	g.throttled.Store(throttled)
+	governorThrottledGauge.Update(throttled)
+
+	logger := g.hmhash.logs.sealer
+	if pressure > 0 {
+		logger.Info("Throttled hmhash mining threads for node load", "active", int64(threads)-throttled, "threads", threads,
+			"import", common.PrettyDuration(load.importLatency), "rpc", load.rpcActive)
+	} else {
+		logger.Info("Ramped up hmhash mining threads", "active", int64(threads)-throttled, "threads", threads)
+	}
+	select {
+	case g.hmhash.update <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that the node load is classified with hysteresis, ignoring the unset
+// thresholds.
+func TestGovernorPressure(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		active  int64
+		load    nodeLoad
+		want    int
+	}{
+		{latency: time.Second, active: 10, load: nodeLoad{}, want: -1},
+		{latency: time.Second, active: 10, load: nodeLoad{importLatency: 2 * time.Second}, want: 1},
+		{latency: time.Second, active: 10, load: nodeLoad{rpcActive: 11}, want: 1},
+		{latency: time.Second, active: 10, load: nodeLoad{importLatency: 700 * time.Millisecond}, want: 0},
+		{latency: time.Second, active: 10, load: nodeLoad{rpcActive: 8}, want: 0},
+		{latency: time.Second, load: nodeLoad{rpcActive: 1000}, want: -1},
+		{active: 10, load: nodeLoad{importLatency: time.Hour}, want: -1},
+	}
+	for i, tt := range tests {
+		g := &governor{latency: tt.latency, active: tt.active}
+		if have := g.pressure(tt.load); have != tt.want {
+			t.Errorf("test %d: pressure mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the governor takes threads off under load, keeping one running,
+// and ramps them back up once idle.
+func TestGovernorThrottling(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(3)
+
+	g := &governor{hmhash: hmhash, latency: time.Second}
+	busy, calm, idle := nodeLoad{importLatency: 2 * time.Second}, nodeLoad{importLatency: time.Second}, nodeLoad{}
+
+	for i, step := range []struct {
+		load nodeLoad
+		want int64
+	}{
+		{busy, 1}, {busy, 2}, {busy, 2}, {calm, 2}, {idle, 1}, {calm, 1}, {idle, 0}, {idle, 0},
+	} {
+		g.adjust(step.load)
+		if have := g.throttled.Load(); have != step.want {
+			t.Fatalf("step %d: throttled threads mismatch: have %d, want %d", i, have, step.want)
+		}
+	}
+}
+
+// Tests that the governor samples the node load in the background.
+func TestGovernorLoop(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(2)
+
+	g := startGovernor(hmhash, 0, 5, time.Millisecond, func() nodeLoad { return nodeLoad{rpcActive: 6} })
+	defer g.stop()
+
+	for start := time.Now(); g.throttled.Load() != 1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("threads not throttled")
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// gpuBatchSize is the number of nonces searched by a single kernel launch.
+const gpuBatchSize = 1 << 20
+
+var (
+	errNoGPUBackend     = errors.New("no GPU mining backend available (build with -tags cuda or opencl)")
+	errGPUClosed        = errors.New("GPU device closed")
+	errGPUInvalidDevice = errors.New("GPU device index out of range")
+	errGPUHashAlgo      = errors.New("GPU mining only supports the default hash algorithm")
+)
+
+// gpuBackend is a GPU programming framework able to run the hashimoto search
+// loop. Implementations are build-tagged and register themselves on init.
+type gpuBackend interface {
+	// name returns the name of the framework, used for logging.
+	name() string
+
+	// devices returns the names of the devices available to the framework. The
+	// position of a device in the list is its index used for opening it.
+	devices() ([]string, error)
+
+	// open initializes the device at the given index for mining.
+	open(index int) (gpuDevice, error)
+}
+
+// gpuDevice is a single initialized GPU. Its methods are never called
+// concurrently.
+type gpuDevice interface {
+	// setDataset uploads the mining dataset to the device memory.
+	setDataset(dataset []uint32) error
+
+	// search tries count nonces starting at start, returning the first one whose
+	// hashimoto result meets the target.
+	search(hash []byte, target *big.Int, start uint64, count uint64) (uint64, bool, error)
+
+	// close releases all resources held by the device.
+	close()
+}
+
+// gpuMonitor is implemented by devices able to report their health.
+type gpuMonitor interface {
+	// health returns the device temperature in Celsius and its utilization in
+	// percent.
+	health() (temperature uint32, utilization uint32, err error)
+}
+
+// gpuBackends is the list of compiled in GPU backends, in order of preference.
+var gpuBackends []gpuBackend
+
+// gpuMiner is a GPU device selected for mining along with its statistics.
+type gpuMiner struct {
+	index    int           // Index of the device within its backend
+	name     string        // Human readable name of the device
+	hashrate metrics.Meter // Meter tracking the average hashrate of the device
+
+	lock   sync.Mutex // Serializes access to the device
+	device gpuDevice  // Initialized device, nil once closed
+	epoch  uint64     // Epoch of the dataset uploaded to the device
+}
+
+// load ensures the device holds the given dataset.
+func (m *gpuMiner) load(d *dataset) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.device == nil {
+		return errGPUClosed
+	}
+	if m.epoch == d.epoch {
+		return nil
+	}
+	if d.partial() {
+		return errPartialDataset
+	}
+	if err := m.device.setDataset(d.dataset); err != nil {
+		return err
+	}
+	m.epoch = d.epoch
+	return nil
+}
+
+// search runs a single batch of the nonce search on the device.
+func (m *gpuMiner) search(hash []byte, target *big.Int, start uint64) (uint64, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.device == nil {
+		return 0, false, errGPUClosed
+	}
+	return m.device.search(hash, target, start, gpuBatchSize)
+}
+
+// health returns the temperature and utilization of the device, or nils if the
+// device can't report them.
+func (m *gpuMiner) health() (*uint32, *uint32) {
+	m.lock.Lock()
+	monitor, ok := m.device.(gpuMonitor)
+	m.lock.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	temperature, utilization, err := monitor.health()
+	if err != nil {
+		return nil, nil
+	}
+	return &temperature, &utilization
+}
+
+// close releases the device, waiting for any running batch to finish first.
+func (m *gpuMiner) close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.device != nil {
+		m.device.close()
+		m.device = nil
+	}
+}
+
+// SetGPUDevices selects the GPUs to mine on, replacing any previous selection.
+// Devices are identified by their index within the first available backend.
+// An empty list disables GPU mining. Like SetThreads, this does not start
+// mining, but running seals pick up the change.
+func (hmhash *Hmhash) SetGPUDevices(ids []int) error {
+	// If we're running a shared PoW, set the devices on that instead
+	if hmhash.shared != nil {
+		return hmhash.shared.SetGPUDevices(ids)
+	}
+	var miners []*gpuMiner
+	if len(ids) > 0 {
+		if hmhash.algo.Name() != DefaultHashAlgo {
+			return errGPUHashAlgo
+		}
+		if len(gpuBackends) == 0 {
+			return errNoGPUBackend
+		}
+		backend := gpuBackends[0]
+		names, err := backend.devices()
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id < 0 || id >= len(names) {
+				err = errGPUInvalidDevice
+			}
+			var device gpuDevice
+			if err == nil {
+				device, err = backend.open(id)
+			}
+			if err != nil {
+				for _, miner := range miners {
+					miner.close()
+				}
+				return err
+			}
+			miners = append(miners, &gpuMiner{
+				index:    id,
+				name:     names[id],
+				hashrate: metrics.NewMeterForced(),
+				device:   device,
+				epoch:    math.MaxUint64,
+			})
+			hmhash.config.Log.Info("Enabled GPU mining", "backend", backend.name(), "device", id, "name", names[id])
+		}
+	}
+	hmhash.lock.Lock()
+	old := hmhash.gpus
+	hmhash.gpus = miners
+	hmhash.lock.Unlock()
+
+	// Ping any running seal to pull in the changes, then release the old devices
+	select {
+	case hmhash.update <- struct{}{}:
+	default:
+	}
+	for _, miner := range old {
+		miner.close()
+	}
+	return nil
+}
+
+// detectGPUs logs the GPUs available to the compiled in backends.
+func (hmhash *Hmhash) detectGPUs() {
+	for _, backend := range gpuBackends {
+		names, err := backend.devices()
+		if err != nil {
+			hmhash.config.Log.Debug("Failed to detect GPUs", "backend", backend.name(), "err", err)
+			continue
+		}
+		for i, name := range names {
+			hmhash.config.Log.Info("Detected GPU", "backend", backend.name(), "device", i, "name", name)
+		}
+	}
+}
+
+// GPUStats is the mining status of a single GPU.
+type GPUStats struct {
+	Index       int            `json:"index"`
+	Name        string         `json:"name"`
+	Hashrate    hexutil.Uint64 `json:"hashrate"`
+	Temperature *uint32        `json:"temperature,omitempty"` // Celsius, if the device reports it
+	Utilization *uint32        `json:"utilization,omitempty"` // Percent, if the device reports it
+}
+
+// GPUStats returns the hashrate and health of each GPU selected for mining.
+func (hmhash *Hmhash) GPUStats() []GPUStats {
+	if hmhash.shared != nil {
+		return hmhash.shared.GPUStats()
+	}
+	hmhash.lock.Lock()
+	gpus := hmhash.gpus
+	hmhash.lock.Unlock()
+
+	stats := make([]GPUStats, 0, len(gpus))
+	for _, miner := range gpus {
+		temperature, utilization := miner.health()
+		stats = append(stats, GPUStats{
+			Index:       miner.index,
+			Name:        miner.name,
+			Hashrate:    hexutil.Uint64(miner.hashrate.Rate1()),
+			Temperature: temperature,
+			Utilization: utilization,
+		})
+	}
+	return stats
+}
+
+// GPUHashrates returns the measured hashrate of each GPU selected for mining,
+// keyed by device index.
+func (hmhash *Hmhash) GPUHashrates() map[int]float64 {
+	if hmhash.shared != nil {
+		return hmhash.shared.GPUHashrates()
+	}
+	hmhash.lock.Lock()
+	defer hmhash.lock.Unlock()
+
+	rates := make(map[int]float64, len(hmhash.gpus))
+	for _, miner := range hmhash.gpus {
+		rates[miner.index] = miner.hashrate.Rate1()
+	}
+	return rates
+}
+
+// mineGPU is the GPU counterpart of mine, offloading the nonce search to a
+// device in batches and verifying any solution it reports on the CPU.
+func (hmhash *Hmhash) mineGPU(rules *params.EthashConfig, block *types.Block, miner *gpuMiner, seed uint64, abort chan struct{}, found chan *types.Block) {
+	var (
+		header  = block.Header()
+		hash    = hmhash.SealHash(header).Bytes()
+		target  = new(big.Int).Div(two256, header.Difficulty)
+		number  = header.Number.Uint64()
+		dataset = hmhash.dataset(rules, number, false)
+	)
+	logger := hmhash.config.Log.New("gpu", miner.index)
+	if err := miner.load(dataset); err != nil {
+		logger.Error("Failed to upload hmhash DAG to GPU", "err", err)
+		return
+	}
+	logger.Trace("Started hmhash GPU search for new nonces", "seed", seed)
+
+	nonce := seed
+search:
+	for {
+		select {
+		case <-abort:
+			logger.Trace("Hmhash GPU nonce search aborted", "attempts", nonce-seed)
+			break search
+
+		default:
+			solution, ok, err := miner.search(hash, target, nonce)
+			if err != nil {
+				if err != errGPUClosed {
+					logger.Error("Hmhash GPU search failed", "err", err)
+				}
+				break search
+			}
+			miner.hashrate.Mark(gpuBatchSize)
+			hmhash.hashrate.Mark(gpuBatchSize)
+
+			if ok {
+				// Recompute the solution to obtain the mix digest, which also guards
+				// against faulty devices or kernels
+				digest, result := hashimotoFull(hmhash.algo, dataset.dataset, hash, solution)
+				if new(big.Int).SetBytes(result).Cmp(target) > 0 {
+					logger.Warn("GPU reported invalid nonce", "nonce", solution)
+				} else {
+					header = types.CopyHeader(header)
+					header.Nonce = types.EncodeNonce(solution)
+					header.MixDigest = common.BytesToHash(digest)
+
+					select {
+					case found <- block.WithSeal(header):
+						logger.Trace("Hmhash GPU nonce found and reported", "attempts", solution-seed, "nonce", solution)
+					case <-abort:
+						logger.Trace("Hmhash GPU nonce found but discarded", "attempts", solution-seed, "nonce", solution)
+					}
+					break search
+				}
+			}
+			nonce += gpuBatchSize
+		}
+	}
+	// Datasets are unmapped in a finalizer. Ensure that the dataset stays live
+	// during sealing so it's not unmapped while being read.
+	runtime.KeepAlive(dataset)
+}
@@ -0,0 +1,453 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build cuda && cgo
+
+package ethash
+
+/*
+#cgo LDFLAGS: -lcuda -lnvrtc -lnvidia-ml
+
+#include <cuda.h>
+#include <nvrtc.h>
+#include <nvml.h>
+#include <stdlib.h>
+
+// cuda_launch_search launches the search kernel. Kernel parameters are passed as
+// an array of pointers, which must live in C memory.
+static CUresult cuda_launch_search(CUfunction fn, CUdeviceptr dag, unsigned int rows,
+	CUdeviceptr header, CUdeviceptr target, unsigned long long start,
+	unsigned long long count, CUdeviceptr found, CUdeviceptr result)
+{
+	void *args[] = {&dag, &rows, &header, &target, &start, &count, &found, &result};
+	unsigned int block = 256;
+	unsigned int grid = (unsigned int)((count + block - 1) / block);
+	return cuLaunchKernel(fn, grid, 1, 1, block, 1, 1, 0, NULL, args, NULL);
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+func init() {
+	// CUDA is preferred over OpenCL on NVIDIA hardware
+	gpuBackends = append([]gpuBackend{new(cudaBackend)}, gpuBackends...)
+}
+
+// cudaKernel is the hashimoto search kernel, compiled at runtime with NVRTC for
+// the architecture of each device. Every thread tries a single nonce, the first
+// one meeting the target is reported through the result buffer.
+const cudaKernel = `
+#define FNV_PRIME 0x01000193
+#define fnv(x, y) ((x) * FNV_PRIME ^ (y))
+#define rotl64(x, n) (((x) << (n)) | ((x) >> (64 - (n))))
+
+typedef unsigned char uint8;
+typedef unsigned int uint32;
+typedef unsigned long long uint64;
+
+__constant__ uint64 keccak_rc[24] = {
+	0x0000000000000001ULL, 0x0000000000008082ULL, 0x800000000000808aULL, 0x8000000080008000ULL,
+	0x000000000000808bULL, 0x0000000080000001ULL, 0x8000000080008081ULL, 0x8000000000008009ULL,
+	0x000000000000008aULL, 0x0000000000000088ULL, 0x0000000080008009ULL, 0x000000008000000aULL,
+	0x000000008000808bULL, 0x800000000000008bULL, 0x8000000000008089ULL, 0x8000000000008003ULL,
+	0x8000000000008002ULL, 0x8000000000000080ULL, 0x000000000000800aULL, 0x800000008000000aULL,
+	0x8000000080008081ULL, 0x8000000000008080ULL, 0x0000000080000001ULL, 0x8000000080008008ULL,
+};
+__constant__ uint32 keccak_rotc[24] = {
+	1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44,
+};
+__constant__ uint32 keccak_piln[24] = {
+	10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1,
+};
+
+__device__ void keccakf(uint64 st[25]) {
+	uint64 t, bc[5];
+	for (int r = 0; r < 24; r++) {
+		for (int i = 0; i < 5; i++)
+			bc[i] = st[i] ^ st[i + 5] ^ st[i + 10] ^ st[i + 15] ^ st[i + 20];
+		for (int i = 0; i < 5; i++) {
+			t = bc[(i + 4) % 5] ^ rotl64(bc[(i + 1) % 5], 1);
+			for (int j = 0; j < 25; j += 5)
+				st[j + i] ^= t;
+		}
+		t = st[1];
+		for (int i = 0; i < 24; i++) {
+			uint32 j = keccak_piln[i];
+			bc[0] = st[j];
+			st[j] = rotl64(t, keccak_rotc[i]);
+			t = bc[0];
+		}
+		for (int j = 0; j < 25; j += 5) {
+			for (int i = 0; i < 5; i++)
+				bc[i] = st[j + i];
+			for (int i = 0; i < 5; i++)
+				st[j + i] ^= (~bc[(i + 1) % 5]) & bc[(i + 2) % 5];
+		}
+		st[0] ^= keccak_rc[r];
+	}
+}
+
+extern "C" __global__ void search(
+	const uint32* dag, uint32 rows, const uint64* header, const uint8* target,
+	uint64 start, uint64 count, uint32* found, uint64* result)
+{
+	uint64 gid = (uint64)blockIdx.x * blockDim.x + threadIdx.x;
+	if (gid >= count)
+		return;
+	uint64 nonce = start + gid;
+	uint64 st[25];
+
+	// seed = keccak512(header || nonce)
+	for (int i = 0; i < 25; i++)
+		st[i] = 0;
+	for (int i = 0; i < 4; i++)
+		st[i] = header[i];
+	st[4] = nonce;
+	st[5] ^= 0x01ULL;
+	st[8] ^= 0x8000000000000000ULL;
+	keccakf(st);
+
+	uint64 seed[8];
+	for (int i = 0; i < 8; i++)
+		seed[i] = st[i];
+
+	uint32 mix[32];
+	for (int i = 0; i < 32; i++) {
+		uint64 w = seed[(i % 16) / 2];
+		mix[i] = (i & 1) ? (uint32)(w >> 32) : (uint32)w;
+	}
+	uint32 head = (uint32)seed[0];
+	for (uint32 i = 0; i < 64; i++) {
+		uint32 parent = fnv(i ^ head, mix[i % 32]) % rows;
+		const uint32* row = dag + (uint64)parent * 32;
+		for (int j = 0; j < 32; j++)
+			mix[j] = fnv(mix[j], row[j]);
+	}
+	uint32 digest[8];
+	for (int i = 0; i < 8; i++)
+		digest[i] = fnv(fnv(fnv(mix[4 * i], mix[4 * i + 1]), mix[4 * i + 2]), mix[4 * i + 3]);
+
+	// result = keccak256(seed || digest)
+	for (int i = 0; i < 25; i++)
+		st[i] = 0;
+	for (int i = 0; i < 8; i++)
+		st[i] = seed[i];
+	for (int i = 0; i < 4; i++)
+		st[8 + i] = (uint64)digest[2 * i] | ((uint64)digest[2 * i + 1] << 32);
+	st[12] ^= 0x01ULL;
+	st[16] ^= 0x8000000000000000ULL;
+	keccakf(st);
+
+	for (int k = 0; k < 32; k++) {
+		uint8 b = (uint8)(st[k / 8] >> (8 * (k % 8)));
+		if (b < target[k])
+			break;
+		if (b > target[k])
+			return;
+	}
+	if (atomicCAS(found, 0, 1) == 0)
+		*result = nonce;
+}
+`
+
+var (
+	cudaInitOnce sync.Once
+	cudaInitErr  error
+	nvmlReady    bool // Whether NVML is available for health monitoring
+)
+
+// cudaInit initializes the CUDA driver and NVML, once per process.
+func cudaInit() error {
+	cudaInitOnce.Do(func() {
+		if ret := C.cuInit(0); ret != C.CUDA_SUCCESS {
+			cudaInitErr = cudaError("cuInit", ret)
+			return
+		}
+		nvmlReady = C.nvmlInit_v2() == C.NVML_SUCCESS
+	})
+	return cudaInitErr
+}
+
+// cudaBackend runs the nonce search on NVIDIA GPUs.
+type cudaBackend struct{}
+
+func (cudaBackend) name() string { return "cuda" }
+
+func (cudaBackend) devices() ([]string, error) {
+	if err := cudaInit(); err != nil {
+		return nil, err
+	}
+	var count C.int
+	if ret := C.cuDeviceGetCount(&count); ret != C.CUDA_SUCCESS {
+		return nil, cudaError("cuDeviceGetCount", ret)
+	}
+	names := make([]string, int(count))
+	for i := range names {
+		var (
+			dev  C.CUdevice
+			name [256]C.char
+		)
+		if ret := C.cuDeviceGet(&dev, C.int(i)); ret != C.CUDA_SUCCESS {
+			return nil, cudaError("cuDeviceGet", ret)
+		}
+		C.cuDeviceGetName(&name[0], C.int(len(name)), dev)
+		names[i] = C.GoString(&name[0])
+	}
+	return names, nil
+}
+
+func (b cudaBackend) open(index int) (gpuDevice, error) {
+	names, err := b.devices()
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(names) {
+		return nil, errGPUInvalidDevice
+	}
+	d := new(cudaDevice)
+	if err := d.init(index); err != nil {
+		d.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// cudaDevice is an NVIDIA GPU with the search kernel loaded.
+type cudaDevice struct {
+	dev     C.CUdevice
+	context C.CUcontext
+	module  C.CUmodule
+	kernel  C.CUfunction
+	nvml    C.nvmlDevice_t // NVML handle for health monitoring, nil if unavailable
+
+	dag    C.CUdeviceptr // Dataset buffer, zero until uploaded
+	rows   uint32        // Number of mix sized rows in the dataset
+	header C.CUdeviceptr // Seal hash as four little endian words
+	target C.CUdeviceptr // Big endian target
+	found  C.CUdeviceptr // Flag set by the first thread finding a solution
+	result C.CUdeviceptr // Nonce of the solution
+}
+
+// run executes fn with the device's context bound to the calling thread.
+func (d *cudaDevice) run(fn func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if ret := C.cuCtxPushCurrent(d.context); ret != C.CUDA_SUCCESS {
+		return cudaError("cuCtxPushCurrent", ret)
+	}
+	defer C.cuCtxPopCurrent(nil)
+
+	return fn()
+}
+
+func (d *cudaDevice) init(index int) error {
+	if ret := C.cuDeviceGet(&d.dev, C.int(index)); ret != C.CUDA_SUCCESS {
+		return cudaError("cuDeviceGet", ret)
+	}
+	runtime.LockOSThread()
+	ret := C.cuCtxCreate(&d.context, 0, d.dev)
+	if ret == C.CUDA_SUCCESS {
+		C.cuCtxPopCurrent(nil)
+	}
+	runtime.UnlockOSThread()
+	if ret != C.CUDA_SUCCESS {
+		return cudaError("cuCtxCreate", ret)
+	}
+	ptx, err := d.compile()
+	if err != nil {
+		return err
+	}
+	if nvmlReady {
+		var busID [32]C.char
+		if C.cuDeviceGetPCIBusId(&busID[0], C.int(len(busID)), d.dev) == C.CUDA_SUCCESS {
+			if C.nvmlDeviceGetHandleByPciBusId_v2(&busID[0], &d.nvml) != C.NVML_SUCCESS {
+				d.nvml = nil
+			}
+		}
+	}
+	return d.run(func() error {
+		cptx := C.CString(ptx)
+		defer C.free(unsafe.Pointer(cptx))
+
+		if ret := C.cuModuleLoadData(&d.module, unsafe.Pointer(cptx)); ret != C.CUDA_SUCCESS {
+			return cudaError("cuModuleLoadData", ret)
+		}
+		name := C.CString("search")
+		defer C.free(unsafe.Pointer(name))
+
+		if ret := C.cuModuleGetFunction(&d.kernel, d.module, name); ret != C.CUDA_SUCCESS {
+			return cudaError("cuModuleGetFunction", ret)
+		}
+		for _, buf := range []struct {
+			ptr  *C.CUdeviceptr
+			size int
+		}{{&d.header, 32}, {&d.target, 32}, {&d.found, 4}, {&d.result, 8}} {
+			if ret := C.cuMemAlloc(buf.ptr, C.size_t(buf.size)); ret != C.CUDA_SUCCESS {
+				return cudaError("cuMemAlloc", ret)
+			}
+		}
+		return nil
+	})
+}
+
+// compile builds the search kernel into PTX for the device's architecture.
+func (d *cudaDevice) compile() (string, error) {
+	var major, minor C.int
+	C.cuDeviceGetAttribute(&major, C.CU_DEVICE_ATTRIBUTE_COMPUTE_CAPABILITY_MAJOR, d.dev)
+	C.cuDeviceGetAttribute(&minor, C.CU_DEVICE_ATTRIBUTE_COMPUTE_CAPABILITY_MINOR, d.dev)
+
+	source := C.CString(cudaKernel)
+	defer C.free(unsafe.Pointer(source))
+	name := C.CString("hmhash.cu")
+	defer C.free(unsafe.Pointer(name))
+
+	var prog C.nvrtcProgram
+	if ret := C.nvrtcCreateProgram(&prog, source, name, 0, nil, nil); ret != C.NVRTC_SUCCESS {
+		return "", fmt.Errorf("cuda: nvrtcCreateProgram failed with status %d", int(ret))
+	}
+	defer C.nvrtcDestroyProgram(&prog)
+
+	arch := C.CString(fmt.Sprintf("--gpu-architecture=compute_%d%d", int(major), int(minor)))
+	defer C.free(unsafe.Pointer(arch))
+
+	if ret := C.nvrtcCompileProgram(prog, 1, &arch); ret != C.NVRTC_SUCCESS {
+		var size C.size_t
+		C.nvrtcGetProgramLogSize(prog, &size)
+		buildLog := make([]byte, int(size)+1)
+		C.nvrtcGetProgramLog(prog, (*C.char)(unsafe.Pointer(&buildLog[0])))
+		return "", fmt.Errorf("cuda: nvrtcCompileProgram failed with status %d: %s", int(ret), buildLog[:size])
+	}
+	var size C.size_t
+	if ret := C.nvrtcGetPTXSize(prog, &size); ret != C.NVRTC_SUCCESS {
+		return "", fmt.Errorf("cuda: nvrtcGetPTXSize failed with status %d", int(ret))
+	}
+	ptx := make([]byte, int(size))
+	if ret := C.nvrtcGetPTX(prog, (*C.char)(unsafe.Pointer(&ptx[0]))); ret != C.NVRTC_SUCCESS {
+		return "", fmt.Errorf("cuda: nvrtcGetPTX failed with status %d", int(ret))
+	}
+	return string(ptx[:size-1]), nil // Strip the terminating NUL
+}
+
+func (d *cudaDevice) setDataset(dataset []uint32) error {
+	return d.run(func() error {
+		if d.dag != 0 {
+			C.cuMemFree(d.dag)
+			d.dag = 0
+		}
+		size := C.size_t(len(dataset) * 4)
+		if ret := C.cuMemAlloc(&d.dag, size); ret != C.CUDA_SUCCESS {
+			d.dag = 0
+			return cudaError("cuMemAlloc", ret)
+		}
+		if ret := C.cuMemcpyHtoD(d.dag, unsafe.Pointer(&dataset[0]), size); ret != C.CUDA_SUCCESS {
+			return cudaError("cuMemcpyHtoD", ret)
+		}
+		d.rows = uint32(len(dataset) * 4 / mixBytes)
+		return nil
+	})
+}
+
+func (d *cudaDevice) search(hash []byte, target *big.Int, start uint64, count uint64) (uint64, bool, error) {
+	var (
+		header [4]uint64
+		limit  [32]byte
+		zero   uint32
+		found  uint32
+		nonce  uint64
+	)
+	for i := range header {
+		header[i] = binary.LittleEndian.Uint64(hash[i*8:])
+	}
+	target.FillBytes(limit[:])
+
+	err := d.run(func() error {
+		for _, w := range []struct {
+			dst  C.CUdeviceptr
+			size int
+			src  unsafe.Pointer
+		}{{d.header, 32, unsafe.Pointer(&header[0])}, {d.target, 32, unsafe.Pointer(&limit[0])}, {d.found, 4, unsafe.Pointer(&zero)}} {
+			if ret := C.cuMemcpyHtoD(w.dst, w.src, C.size_t(w.size)); ret != C.CUDA_SUCCESS {
+				return cudaError("cuMemcpyHtoD", ret)
+			}
+		}
+		if ret := C.cuda_launch_search(d.kernel, d.dag, C.uint(d.rows), d.header, d.target, C.ulonglong(start), C.ulonglong(count), d.found, d.result); ret != C.CUDA_SUCCESS {
+			return cudaError("cuLaunchKernel", ret)
+		}
+		if ret := C.cuMemcpyDtoH(unsafe.Pointer(&found), d.found, 4); ret != C.CUDA_SUCCESS {
+			return cudaError("cuMemcpyDtoH", ret)
+		}
+		if found != 0 {
+			if ret := C.cuMemcpyDtoH(unsafe.Pointer(&nonce), d.result, 8); ret != C.CUDA_SUCCESS {
+				return cudaError("cuMemcpyDtoH", ret)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return nonce, found != 0, nil
+}
+
+func (d *cudaDevice) health() (uint32, uint32, error) {
+	if d.nvml == nil {
+		return 0, 0, fmt.Errorf("cuda: NVML unavailable")
+	}
+	var (
+		temperature C.uint
+		utilization C.nvmlUtilization_t
+	)
+	if ret := C.nvmlDeviceGetTemperature(d.nvml, C.NVML_TEMPERATURE_GPU, &temperature); ret != C.NVML_SUCCESS {
+		return 0, 0, fmt.Errorf("cuda: nvmlDeviceGetTemperature failed with status %d", int(ret))
+	}
+	if ret := C.nvmlDeviceGetUtilizationRates(d.nvml, &utilization); ret != C.NVML_SUCCESS {
+		return 0, 0, fmt.Errorf("cuda: nvmlDeviceGetUtilizationRates failed with status %d", int(ret))
+	}
+	return uint32(temperature), uint32(utilization.gpu), nil
+}
+
+func (d *cudaDevice) close() {
+	if d.context == nil {
+		return
+	}
+	d.run(func() error {
+		for _, ptr := range []C.CUdeviceptr{d.dag, d.header, d.target, d.found, d.result} {
+			if ptr != 0 {
+				C.cuMemFree(ptr)
+			}
+		}
+		if d.module != nil {
+			C.cuModuleUnload(d.module)
+		}
+		return nil
+	})
+	C.cuCtxDestroy(d.context)
+	d.context = nil
+}
+
+// cudaError wraps a failed CUDA driver call's status code into an error.
+func cudaError(call string, ret C.CUresult) error {
+	return fmt.Errorf("cuda: %s failed with status %d", call, int(ret))
+}
@@ -0,0 +1,370 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build opencl && cgo
+
+package ethash
+
+/*
+#cgo linux LDFLAGS: -lOpenCL
+#cgo windows LDFLAGS: -lOpenCL
+#cgo darwin LDFLAGS: -framework OpenCL
+
+#define CL_TARGET_OPENCL_VERSION 120
+#ifdef __APPLE__
+#include <OpenCL/opencl.h>
+#else
+#include <CL/cl.h>
+#endif
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"unsafe"
+)
+
+func init() {
+	gpuBackends = append(gpuBackends, new(openclBackend))
+}
+
+// openclKernel is the hashimoto search kernel. Every work item tries a single
+// nonce, the first one meeting the target is reported through the result
+// buffer.
+const openclKernel = `
+#define FNV_PRIME 0x01000193
+#define fnv(x, y) ((x) * FNV_PRIME ^ (y))
+
+__constant ulong keccak_rc[24] = {
+	0x0000000000000001UL, 0x0000000000008082UL, 0x800000000000808aUL, 0x8000000080008000UL,
+	0x000000000000808bUL, 0x0000000080000001UL, 0x8000000080008081UL, 0x8000000000008009UL,
+	0x000000000000008aUL, 0x0000000000000088UL, 0x0000000080008009UL, 0x000000008000000aUL,
+	0x000000008000808bUL, 0x800000000000008bUL, 0x8000000000008089UL, 0x8000000000008003UL,
+	0x8000000000008002UL, 0x8000000000000080UL, 0x000000000000800aUL, 0x800000008000000aUL,
+	0x8000000080008081UL, 0x8000000000008080UL, 0x0000000080000001UL, 0x8000000080008008UL,
+};
+__constant uint keccak_rotc[24] = {
+	1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44,
+};
+__constant uint keccak_piln[24] = {
+	10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1,
+};
+
+void keccakf(ulong st[25]) {
+	ulong t, bc[5];
+	for (int r = 0; r < 24; r++) {
+		for (int i = 0; i < 5; i++)
+			bc[i] = st[i] ^ st[i + 5] ^ st[i + 10] ^ st[i + 15] ^ st[i + 20];
+		for (int i = 0; i < 5; i++) {
+			t = bc[(i + 4) % 5] ^ rotate(bc[(i + 1) % 5], (ulong)1);
+			for (int j = 0; j < 25; j += 5)
+				st[j + i] ^= t;
+		}
+		t = st[1];
+		for (int i = 0; i < 24; i++) {
+			uint j = keccak_piln[i];
+			bc[0] = st[j];
+			st[j] = rotate(t, (ulong)keccak_rotc[i]);
+			t = bc[0];
+		}
+		for (int j = 0; j < 25; j += 5) {
+			for (int i = 0; i < 5; i++)
+				bc[i] = st[j + i];
+			for (int i = 0; i < 5; i++)
+				st[j + i] ^= (~bc[(i + 1) % 5]) & bc[(i + 2) % 5];
+		}
+		st[0] ^= keccak_rc[r];
+	}
+}
+
+__kernel void search(
+	__global const uint* dag, uint rows,
+	__constant ulong* header, __constant uchar* target,
+	ulong start, __global volatile uint* found, __global ulong* result)
+{
+	ulong nonce = start + get_global_id(0);
+	ulong st[25];
+
+	// seed = keccak512(header || nonce)
+	for (int i = 0; i < 25; i++)
+		st[i] = 0;
+	for (int i = 0; i < 4; i++)
+		st[i] = header[i];
+	st[4] = nonce;
+	st[5] ^= 0x01UL;
+	st[8] ^= 0x8000000000000000UL;
+	keccakf(st);
+
+	ulong seed[8];
+	for (int i = 0; i < 8; i++)
+		seed[i] = st[i];
+
+	uint mix[32];
+	for (int i = 0; i < 32; i++) {
+		ulong w = seed[(i % 16) / 2];
+		mix[i] = (i & 1) ? (uint)(w >> 32) : (uint)w;
+	}
+	uint head = (uint)seed[0];
+	for (uint i = 0; i < 64; i++) {
+		uint parent = fnv(i ^ head, mix[i % 32]) % rows;
+		__global const uint* row = dag + (ulong)parent * 32;
+		for (int j = 0; j < 32; j++)
+			mix[j] = fnv(mix[j], row[j]);
+	}
+	uint digest[8];
+	for (int i = 0; i < 8; i++)
+		digest[i] = fnv(fnv(fnv(mix[4 * i], mix[4 * i + 1]), mix[4 * i + 2]), mix[4 * i + 3]);
+
+	// result = keccak256(seed || digest)
+	for (int i = 0; i < 25; i++)
+		st[i] = 0;
+	for (int i = 0; i < 8; i++)
+		st[i] = seed[i];
+	for (int i = 0; i < 4; i++)
+		st[8 + i] = (ulong)digest[2 * i] | ((ulong)digest[2 * i + 1] << 32);
+	st[12] ^= 0x01UL;
+	st[16] ^= 0x8000000000000000UL;
+	keccakf(st);
+
+	for (int k = 0; k < 32; k++) {
+		uchar b = (uchar)(st[k / 8] >> (8 * (k % 8)));
+		if (b < target[k])
+			break;
+		if (b > target[k])
+			return;
+	}
+	if (atomic_cmpxchg(found, 0, 1) == 0)
+		*result = nonce;
+}
+`
+
+// openclBackend runs the nonce search on OpenCL capable GPUs.
+type openclBackend struct{}
+
+func (openclBackend) name() string { return "opencl" }
+
+// deviceIDs enumerates the GPUs of all OpenCL platforms.
+func (openclBackend) deviceIDs() ([]C.cl_device_id, error) {
+	var count C.cl_uint
+	if ret := C.clGetPlatformIDs(0, nil, &count); ret != C.CL_SUCCESS {
+		return nil, openclError("clGetPlatformIDs", ret)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	platforms := make([]C.cl_platform_id, count)
+	if ret := C.clGetPlatformIDs(count, &platforms[0], nil); ret != C.CL_SUCCESS {
+		return nil, openclError("clGetPlatformIDs", ret)
+	}
+	var ids []C.cl_device_id
+	for _, platform := range platforms {
+		var n C.cl_uint
+		if C.clGetDeviceIDs(platform, C.CL_DEVICE_TYPE_GPU, 0, nil, &n) != C.CL_SUCCESS || n == 0 {
+			continue
+		}
+		devices := make([]C.cl_device_id, n)
+		if ret := C.clGetDeviceIDs(platform, C.CL_DEVICE_TYPE_GPU, n, &devices[0], nil); ret != C.CL_SUCCESS {
+			return nil, openclError("clGetDeviceIDs", ret)
+		}
+		ids = append(ids, devices...)
+	}
+	return ids, nil
+}
+
+func (b openclBackend) devices() ([]string, error) {
+	ids, err := b.deviceIDs()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		var name [256]C.char
+		C.clGetDeviceInfo(id, C.CL_DEVICE_NAME, C.size_t(len(name)), unsafe.Pointer(&name[0]), nil)
+		names[i] = C.GoString(&name[0])
+	}
+	return names, nil
+}
+
+func (b openclBackend) open(index int) (gpuDevice, error) {
+	ids, err := b.deviceIDs()
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(ids) {
+		return nil, errGPUInvalidDevice
+	}
+	d := &openclDevice{id: ids[index]}
+	if err := d.init(); err != nil {
+		d.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// openclDevice is an OpenCL GPU with the search kernel compiled.
+type openclDevice struct {
+	id      C.cl_device_id
+	context C.cl_context
+	queue   C.cl_command_queue
+	program C.cl_program
+	kernel  C.cl_kernel
+
+	dag    C.cl_mem // Dataset buffer, nil until uploaded
+	rows   uint32   // Number of mix sized rows in the dataset
+	header C.cl_mem // Seal hash as four little endian words
+	target C.cl_mem // Big endian target
+	found  C.cl_mem // Flag set by the first work item finding a solution
+	result C.cl_mem // Nonce of the solution
+}
+
+func (d *openclDevice) init() error {
+	var ret C.cl_int
+	if d.context = C.clCreateContext(nil, 1, &d.id, nil, nil, &ret); ret != C.CL_SUCCESS {
+		return openclError("clCreateContext", ret)
+	}
+	if d.queue = C.clCreateCommandQueue(d.context, d.id, 0, &ret); ret != C.CL_SUCCESS {
+		return openclError("clCreateCommandQueue", ret)
+	}
+	source := C.CString(openclKernel)
+	defer C.free(unsafe.Pointer(source))
+
+	if d.program = C.clCreateProgramWithSource(d.context, 1, &source, nil, &ret); ret != C.CL_SUCCESS {
+		return openclError("clCreateProgramWithSource", ret)
+	}
+	if ret = C.clBuildProgram(d.program, 1, &d.id, nil, nil, nil); ret != C.CL_SUCCESS {
+		var buildLog [4096]C.char
+		C.clGetProgramBuildInfo(d.program, d.id, C.CL_PROGRAM_BUILD_LOG, C.size_t(len(buildLog)), unsafe.Pointer(&buildLog[0]), nil)
+		return fmt.Errorf("%w: %s", openclError("clBuildProgram", ret), C.GoString(&buildLog[0]))
+	}
+	name := C.CString("search")
+	defer C.free(unsafe.Pointer(name))
+
+	if d.kernel = C.clCreateKernel(d.program, name, &ret); ret != C.CL_SUCCESS {
+		return openclError("clCreateKernel", ret)
+	}
+	for _, buf := range []struct {
+		mem  *C.cl_mem
+		size int
+	}{{&d.header, 32}, {&d.target, 32}, {&d.found, 4}, {&d.result, 8}} {
+		if *buf.mem = C.clCreateBuffer(d.context, C.CL_MEM_READ_WRITE, C.size_t(buf.size), nil, &ret); ret != C.CL_SUCCESS {
+			return openclError("clCreateBuffer", ret)
+		}
+	}
+	return nil
+}
+
+func (d *openclDevice) setDataset(dataset []uint32) error {
+	if d.dag != nil {
+		C.clReleaseMemObject(d.dag)
+		d.dag = nil
+	}
+	var ret C.cl_int
+	size := C.size_t(len(dataset) * 4)
+	if d.dag = C.clCreateBuffer(d.context, C.CL_MEM_READ_ONLY, size, nil, &ret); ret != C.CL_SUCCESS {
+		d.dag = nil
+		return openclError("clCreateBuffer", ret)
+	}
+	if ret = C.clEnqueueWriteBuffer(d.queue, d.dag, C.CL_TRUE, 0, size, unsafe.Pointer(&dataset[0]), 0, nil, nil); ret != C.CL_SUCCESS {
+		return openclError("clEnqueueWriteBuffer", ret)
+	}
+	d.rows = uint32(len(dataset) * 4 / mixBytes)
+	return nil
+}
+
+func (d *openclDevice) search(hash []byte, target *big.Int, start uint64, count uint64) (uint64, bool, error) {
+	var (
+		header [4]uint64
+		limit  [32]byte
+		zero   uint32
+		found  uint32
+		nonce  uint64
+	)
+	for i := range header {
+		header[i] = binary.LittleEndian.Uint64(hash[i*8:])
+	}
+	target.FillBytes(limit[:])
+
+	for _, w := range []struct {
+		mem  C.cl_mem
+		size int
+		ptr  unsafe.Pointer
+	}{{d.header, 32, unsafe.Pointer(&header[0])}, {d.target, 32, unsafe.Pointer(&limit[0])}, {d.found, 4, unsafe.Pointer(&zero)}} {
+		if ret := C.clEnqueueWriteBuffer(d.queue, w.mem, C.CL_TRUE, 0, C.size_t(w.size), w.ptr, 0, nil, nil); ret != C.CL_SUCCESS {
+			return 0, false, openclError("clEnqueueWriteBuffer", ret)
+		}
+	}
+	rows := C.cl_uint(d.rows)
+	begin := C.cl_ulong(start)
+	args := []struct {
+		size C.size_t
+		ptr  unsafe.Pointer
+	}{
+		{C.size_t(unsafe.Sizeof(d.dag)), unsafe.Pointer(&d.dag)},
+		{C.size_t(unsafe.Sizeof(rows)), unsafe.Pointer(&rows)},
+		{C.size_t(unsafe.Sizeof(d.header)), unsafe.Pointer(&d.header)},
+		{C.size_t(unsafe.Sizeof(d.target)), unsafe.Pointer(&d.target)},
+		{C.size_t(unsafe.Sizeof(begin)), unsafe.Pointer(&begin)},
+		{C.size_t(unsafe.Sizeof(d.found)), unsafe.Pointer(&d.found)},
+		{C.size_t(unsafe.Sizeof(d.result)), unsafe.Pointer(&d.result)},
+	}
+	for i, arg := range args {
+		if ret := C.clSetKernelArg(d.kernel, C.cl_uint(i), arg.size, arg.ptr); ret != C.CL_SUCCESS {
+			return 0, false, openclError("clSetKernelArg", ret)
+		}
+	}
+	global := C.size_t(count)
+	if ret := C.clEnqueueNDRangeKernel(d.queue, d.kernel, 1, nil, &global, nil, 0, nil, nil); ret != C.CL_SUCCESS {
+		return 0, false, openclError("clEnqueueNDRangeKernel", ret)
+	}
+	if ret := C.clEnqueueReadBuffer(d.queue, d.found, C.CL_TRUE, 0, 4, unsafe.Pointer(&found), 0, nil, nil); ret != C.CL_SUCCESS {
+		return 0, false, openclError("clEnqueueReadBuffer", ret)
+	}
+	if found == 0 {
+		return 0, false, nil
+	}
+	if ret := C.clEnqueueReadBuffer(d.queue, d.result, C.CL_TRUE, 0, 8, unsafe.Pointer(&nonce), 0, nil, nil); ret != C.CL_SUCCESS {
+		return 0, false, openclError("clEnqueueReadBuffer", ret)
+	}
+	return nonce, true, nil
+}
+
+func (d *openclDevice) close() {
+	for _, mem := range []C.cl_mem{d.dag, d.header, d.target, d.found, d.result} {
+		if mem != nil {
+			C.clReleaseMemObject(mem)
+		}
+	}
+	if d.kernel != nil {
+		C.clReleaseKernel(d.kernel)
+	}
+	if d.program != nil {
+		C.clReleaseProgram(d.program)
+	}
+	if d.queue != nil {
+		C.clReleaseCommandQueue(d.queue)
+	}
+	if d.context != nil {
+		C.clReleaseContext(d.context)
+	}
+}
+
+// openclError wraps a failed OpenCL call's status code into an error.
+func openclError(call string, ret C.cl_int) error {
+	return fmt.Errorf("opencl: %s failed with status %d", call, int(ret))
+}
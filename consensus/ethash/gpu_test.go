@@ -0,0 +1,116 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// testGPUBackend emulates GPUs on the CPU, to test the device independent parts
+// of GPU mining.
+type testGPUBackend struct {
+	opened int
+}
+
+func (b *testGPUBackend) name() string               { return "test" }
+func (b *testGPUBackend) devices() ([]string, error) { return []string{"gpu0", "gpu1"}, nil }
+
+func (b *testGPUBackend) open(index int) (gpuDevice, error) {
+	b.opened++
+	return &testGPUDevice{backend: b}, nil
+}
+
+type testGPUDevice struct {
+	backend *testGPUBackend
+	dataset []uint32
+}
+
+func (d *testGPUDevice) setDataset(dataset []uint32) error {
+	d.dataset = dataset
+	return nil
+}
+
+func (d *testGPUDevice) search(hash []byte, target *big.Int, start uint64, count uint64) (uint64, bool, error) {
+	for nonce := start; nonce < start+count; nonce++ {
+		if _, result := hashimotoFull(keccakAlgo{}, d.dataset, hash, nonce); new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			return nonce, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (d *testGPUDevice) health() (uint32, uint32, error) { return 65, 100, nil }
+
+func (d *testGPUDevice) close() { d.backend.opened-- }
+
+// Tests that blocks can be sealed on GPU devices and that their hashrate and
+// health are tracked individually.
+func TestGPUSealing(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	if err := hmhash.SetGPUDevices([]int{0}); err != errNoGPUBackend {
+		t.Fatalf("error mismatch without backends: have %v, want %v", err, errNoGPUBackend)
+	}
+	backend := new(testGPUBackend)
+	gpuBackends = []gpuBackend{backend}
+	defer func() { gpuBackends = nil }()
+
+	if err := hmhash.SetGPUDevices([]int{2}); err != errGPUInvalidDevice {
+		t.Fatalf("error mismatch for unknown device: have %v, want %v", err, errGPUInvalidDevice)
+	}
+	if err := hmhash.SetGPUDevices([]int{1}); err != nil {
+		t.Fatalf("failed to select GPU: %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+	select {
+	case block := <-results:
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Fatalf("GPU sealed block invalid: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("GPU sealing timed out")
+	}
+	if rates := hmhash.GPUHashrates(); len(rates) != 1 {
+		t.Fatalf("hashrate reported for %d GPUs, want 1", len(rates))
+	}
+	stats := (&MiningAPI{hmhash}).GetGPUStats()
+	if len(stats) != 1 {
+		t.Fatalf("stats reported for %d GPUs, want 1", len(stats))
+	}
+	if stats[0].Index != 1 || stats[0].Name != "gpu1" {
+		t.Errorf("GPU identity mismatch: have %d/%s, want 1/gpu1", stats[0].Index, stats[0].Name)
+	}
+	if stats[0].Temperature == nil || *stats[0].Temperature != 65 || stats[0].Utilization == nil || *stats[0].Utilization != 100 {
+		t.Errorf("GPU health mismatch: have %v/%v, want 65/100", stats[0].Temperature, stats[0].Utilization)
+	}
+	if err := hmhash.SetGPUDevices(nil); err != nil {
+		t.Fatalf("failed to deselect GPUs: %v", err)
+	}
+	if backend.opened != 0 {
+		t.Fatalf("%d GPUs left open", backend.opened)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash/miningpb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcTokenScheme is the scheme of the authorization metadata carrying the
+// submission token of gRPC calls, as sent by bearer token per-RPC credentials.
+const grpcTokenScheme = "Bearer "
+
+// grpcServer exposes the remote sealer over gRPC, streaming work packages to
+// mining farm controllers and accepting their solutions.
+type grpcServer struct {
+	miningpb.UnimplementedMiningServer
+
+	hmhash   *Hmhash
+	listener net.Listener
+	server   *grpc.Server
+
+	lock  sync.Mutex
+	work  *miningpb.Work                   // Most recent work package, nil if there's no work yet
+	works map[common.Hash]*types.Block     // Blocks of recent work packages, for late submissions
+	subs  map[chan *miningpb.Work]struct{} // Work channels of the streaming GetWork calls
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+	once sync.Once
+}
+
+// listenGRPC opens the gRPC listener on the given address, serving TLS if a
+// configuration is given. Calls are only served after start is called.
+func listenGRPC(hmhash *Hmhash, addr string, config *tls.Config) (*grpcServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var opts []grpc.ServerOption
+	if config != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+	s := &grpcServer{
+		hmhash:   hmhash,
+		listener: listener,
+		server:   grpc.NewServer(opts...),
+		works:    make(map[common.Hash]*types.Block),
+		subs:     make(map[chan *miningpb.Work]struct{}),
+		quit:     make(chan struct{}),
+	}
+	miningpb.RegisterMiningServer(s.server, s)
+	return s, nil
+}
+
+// Start begins serving gRPC calls in the background.
+func (s *grpcServer) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(s.listener); err != nil {
+			s.hmhash.logs.sealer.Warn("Mining gRPC server failed", "err", err)
+		}
+	}()
+	s.hmhash.logs.sealer.Info("Mining gRPC server started", "addr", s.listener.Addr())
+}
+
+// Close terminates all streams and the listener, waiting for them to exit.
+func (s *grpcServer) Close() {
+	s.once.Do(func() {
+		close(s.quit)
+		s.server.Stop()
+		s.wg.Wait()
+	})
+}
+
+// NotifyWork registers a remote sealer work package as the current one and
+// pushes it to all streaming miners.
+func (s *grpcServer) NotifyWork(work [4]string, block *types.Block) {
+	pkg := &miningpb.Work{
+		SealHash: common.HexToHash(work[0]).Bytes(),
+		SeedHash: common.HexToHash(work[1]).Bytes(),
+		Target:   common.HexToHash(work[2]).Bytes(),
+		Number:   block.NumberU64(),
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.work = pkg
+	s.works[common.BytesToHash(pkg.SealHash)] = block
+	for hash, block := range s.works {
+		if block.NumberU64()+s.hmhash.StaleWorkWindow() <= pkg.Number {
+			delete(s.works, hash)
+		}
+	}
+	for ch := range s.subs {
+		// Replace any package not yet picked up by a slow stream, it's stale
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- pkg
+	}
+}
+
+// GetWork implements miningpb.MiningServer, streaming the current work package
+// and all following ones until the client goes away. Every stream leases its
+// own nonce prefix for the lifetime of the call.
+func (s *grpcServer) GetWork(req *miningpb.GetWorkRequest, stream miningpb.Mining_GetWorkServer) error {
+	if err := s.hmhash.remote.checkRequest(stream.Context(), methodGetWork, 0); err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	extranonce, err := s.hmhash.extra.allocate()
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer s.hmhash.extra.release(extranonce)
+
+	ch := make(chan *miningpb.Work, 1)
+
+	s.lock.Lock()
+	if s.work != nil {
+		ch <- s.work
+	}
+	s.subs[ch] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.subs, ch)
+		s.lock.Unlock()
+	}()
+	for {
+		select {
+		case work := <-ch:
+			if err := stream.Send(s.stamp(work, req.Worker, extranonce)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.quit:
+			return status.Error(codes.Unavailable, errHmhashStopped.Error())
+		}
+	}
+}
+
+// stamp returns the work package of a stream, carrying its nonce prefix and the
+// worker's share target. Packages are shared between streams, so it's a copy.
+func (s *grpcServer) stamp(work *miningpb.Work, worker string, extranonce []byte) *miningpb.Work {
+	if len(extranonce) == 0 && s.hmhash.shares == nil {
+		return work
+	}
+	target := work.Target
+	if s.hmhash.shares != nil {
+		s.lock.Lock()
+		block := s.works[common.BytesToHash(work.SealHash)]
+		s.lock.Unlock()
+
+		if block != nil {
+			target = common.BigToHash(s.hmhash.workerTarget(worker, block.Difficulty())).Bytes()
+		}
+	}
+	return &miningpb.Work{
+		SealHash:   work.SealHash,
+		SeedHash:   work.SeedHash,
+		Target:     target,
+		Number:     work.Number,
+		Extranonce: extranonce,
+	}
+}
+
+// SubmitWork implements miningpb.MiningServer, passing a solution on to the
+// remote sealer. The mix digest is computed by the node if it's omitted. Like
+// eth_submitWork, solutions are rate limited, checked against the submission
+// token if configured, and rejected from banned workers.
+func (s *grpcServer) SubmitWork(ctx context.Context, req *miningpb.SubmitWorkRequest) (*miningpb.SubmitWorkResponse, error) {
+	if len(req.SealHash) != common.HashLength {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid seal hash length %d", len(req.SealHash))
+	}
+	sealhash := common.BytesToHash(req.SealHash)
+
+	api := &API{s.hmhash}
+	worker, source, err := api.authorizeWork(ctx, sealhash, grpcToken(ctx), req.Worker)
+	if err != nil {
+		return &miningpb.SubmitWorkResponse{Accepted: false}, nil
+	}
+
+	var digest common.Hash
+	switch len(req.MixDigest) {
+	case 0:
+		s.lock.Lock()
+		block, ok := s.works[sealhash]
+		s.lock.Unlock()
+
+		if !ok {
+			return &miningpb.SubmitWorkResponse{Accepted: false}, nil
+		}
+		digest = s.hmhash.mixDigest(block.NumberU64(), sealhash, req.Nonce)
+	case common.HashLength:
+		digest = common.BytesToHash(req.MixDigest)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mix digest length %d", len(req.MixDigest))
+	}
+	err = api.submitWorkFrom(ctx, types.EncodeNonce(req.Nonce), sealhash, digest, worker, source)
+	return &miningpb.SubmitWorkResponse{Accepted: err == nil}, nil
+}
+
+// SubmitHashrate implements miningpb.MiningServer, recording the hashrate of a
+// remote miner, checked like the ones submitted over JSON-RPC.
+func (s *grpcServer) SubmitHashrate(ctx context.Context, req *miningpb.SubmitHashrateRequest) (*miningpb.SubmitHashrateResponse, error) {
+	if len(req.Id) != common.HashLength {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid miner id length %d", len(req.Id))
+	}
+	accepted := (&API{s.hmhash}).submitHashrateToken(ctx, hexutil.Uint64(req.Rate), common.BytesToHash(req.Id), grpcToken(ctx), req.Signature, req.SignedAt)
+	return &miningpb.SubmitHashrateResponse{Accepted: accepted}, nil
+}
+
+// grpcToken returns the submission token of a gRPC call, sent as bearer token
+// authorization metadata, nil if there's none.
+func grpcToken(ctx context.Context) *string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	for _, auth := range md.Get("authorization") {
+		if strings.HasPrefix(auth, grpcTokenScheme) {
+			token := strings.TrimPrefix(auth, grpcTokenScheme)
+			return &token
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash/miningpb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Tests the full gRPC flow: work streaming, submission and hashrate reporting.
+func TestGRPCServer(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, GRPCAddr: "127.0.0.1:0"}, nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	conn, err := grpc.Dial(hmhash.grpc.listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial gRPC server: %v", err)
+	}
+	defer conn.Close()
+	client := miningpb.NewMiningClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.GetWork(ctx, &miningpb.GetWorkRequest{})
+	if err != nil {
+		t.Fatalf("failed to open work stream: %v", err)
+	}
+	// Wait for the stream to be registered before pushing work
+	for {
+		hmhash.grpc.lock.Lock()
+		subs := len(hmhash.grpc.subs)
+		hmhash.grpc.lock.Unlock()
+		if subs > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+	work, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive work: %v", err)
+	}
+	sealhash := hmhash.SealHash(header)
+	if !bytes.Equal(work.SealHash, sealhash.Bytes()) || work.Number != 1 {
+		t.Fatalf("work mismatch: have %x #%d, want %x #1", work.SealHash, work.Number, sealhash)
+	}
+	// Malformed and invalid submissions must be rejected
+	if _, err := client.SubmitWork(ctx, &miningpb.SubmitWorkRequest{SealHash: []byte{1}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("malformed submission error mismatch: have %v, want %v", err, codes.InvalidArgument)
+	}
+	// Search a valid nonce and submit it without a mix digest
+	var (
+		cache  = hmhash.cache(nil, 1)
+		target = new(big.Int).SetBytes(work.Target)
+		nonce  uint64
+	)
+	for ; ; nonce++ {
+		_, result := hashimotoLight(hmhash.algo, testDatasetSize, cache.cache, work.SealHash, nonce)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			break
+		}
+	}
+	res, err := client.SubmitWork(ctx, &miningpb.SubmitWorkRequest{SealHash: work.SealHash, Nonce: nonce})
+	if err != nil || !res.Accepted {
+		t.Fatalf("valid submission rejected: %v", err)
+	}
+	select {
+	case block := <-results:
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Errorf("sealed block invalid: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("sealed block not delivered")
+	}
+	// Report a hashrate and ensure it's accounted for
+	id := bytes.Repeat([]byte{0x01}, 32)
+	if res, err := client.SubmitHashrate(ctx, &miningpb.SubmitHashrateRequest{Id: id, Rate: 1000}); err != nil || !res.Accepted {
+		t.Fatalf("hashrate submission rejected: %v", err)
+	}
+	if rates := hmhash.HashrateBreakdown().Remote; len(rates) != 1 {
+		t.Errorf("remote hashrate count mismatch: have %d, want 1", len(rates))
+	}
+}
+
+// Tests that the gRPC service is served over TLS and enforces the submission
+// tokens like the JSON-RPC remote sealer.
+func TestGRPCTLSTokens(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, blob []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, blob, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	ca, caKey, _, _ := testCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "node", ca, caKey)
+
+	hmhash := New(Config{
+		PowMode:      ModeTest,
+		GRPCAddr:     "127.0.0.1:0",
+		TLSCert:      write("node.crt", serverPEM),
+		TLSKey:       write("node.key", serverKeyPEM),
+		SubmitTokens: map[string]string{"secret": "rig"},
+	}, nil, false)
+	defer hmhash.Close()
+
+	if hmhash.grpc == nil {
+		t.Fatalf("gRPC server not started")
+	}
+	addr := hmhash.grpc.listener.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Plain text clients must not be served
+	plain, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial gRPC server: %v", err)
+	}
+	defer plain.Close()
+
+	req := &miningpb.SubmitHashrateRequest{Id: bytes.Repeat([]byte{0x01}, 32), Rate: 1000}
+	if _, err := miningpb.NewMiningClient(plain).SubmitHashrate(ctx, req); err == nil {
+		t.Errorf("plain text client served")
+	}
+	// TLS clients are served, but only accepted with a valid token
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots})))
+	if err != nil {
+		t.Fatalf("failed to dial gRPC server: %v", err)
+	}
+	defer conn.Close()
+	client := miningpb.NewMiningClient(conn)
+
+	if res, err := client.SubmitHashrate(ctx, req); err != nil || res.Accepted {
+		t.Errorf("tokenless hashrate accepted: %v", err)
+	}
+	if res, err := client.SubmitWork(ctx, &miningpb.SubmitWorkRequest{SealHash: make([]byte, 32)}); err != nil || res.Accepted {
+		t.Errorf("tokenless work accepted: %v", err)
+	}
+	bad := metadata.AppendToOutgoingContext(ctx, "authorization", grpcTokenScheme+"wrong")
+	if res, err := client.SubmitHashrate(bad, req); err != nil || res.Accepted {
+		t.Errorf("invalid token hashrate accepted: %v", err)
+	}
+	good := metadata.AppendToOutgoingContext(ctx, "authorization", grpcTokenScheme+"secret")
+	if res, err := client.SubmitHashrate(good, req); err != nil || !res.Accepted {
+		t.Fatalf("authorized hashrate rejected: %v", err)
+	}
+	if rates := hmhash.HashrateBreakdown().Remote; len(rates) != 1 {
+		t.Errorf("remote hashrate count mismatch: have %d, want 1", len(rates))
+	}
+}
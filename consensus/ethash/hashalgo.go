@@ -0,0 +1,154 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// HashAlgo is the hash function family used by the proof-of-work to generate
+// caches and datasets and to compute hashimoto results. Swapping it creates an
+// incompatible proof-of-work, so all nodes of a chain must use the same one.
+//
+// The seed hashes identifying epochs are always derived with Keccak-256.
+type HashAlgo interface {
+	// Name returns the unique name of the algorithm, used to select it in the
+	// configuration and to tell apart the files it generates on disk. It may
+	// only contain lowercase letters, digits and dashes.
+	Name() string
+
+	// New256 creates a hasher with 32 byte digests, used for the final
+	// hashimoto result.
+	New256() hash.Hash
+
+	// New512 creates a hasher with 64 byte digests, used for cache and dataset
+	// generation and for the hashimoto seed.
+	New512() hash.Hash
+}
+
+// DefaultHashAlgo is the name of the hash algorithm of the original proof-of-work.
+const DefaultHashAlgo = "keccak"
+
+var (
+	errUnknownHashAlgo   = errors.New("unknown hash algorithm")
+	errDuplicateHashAlgo = errors.New("hash algorithm already registered")
+	errInvalidHashAlgo   = errors.New("invalid hash algorithm name")
+)
+
+var (
+	hashAlgosLock sync.RWMutex
+	hashAlgos     = map[string]HashAlgo{
+		DefaultHashAlgo: keccakAlgo{},
+		"sha3":          sha3Algo{},
+		"blake2b":       blake2bAlgo{},
+	}
+)
+
+// RegisterHashAlgo makes a hash algorithm selectable through Config.HashAlgo.
+// It is meant to be called from init functions of packages providing custom
+// algorithms.
+func RegisterHashAlgo(algo HashAlgo) error {
+	name := algo.Name()
+	if name == "" {
+		return errInvalidHashAlgo
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return fmt.Errorf("%w: %q", errInvalidHashAlgo, name)
+		}
+	}
+	hashAlgosLock.Lock()
+	defer hashAlgosLock.Unlock()
+
+	if _, ok := hashAlgos[name]; ok {
+		return fmt.Errorf("%w: %q", errDuplicateHashAlgo, name)
+	}
+	hashAlgos[name] = algo
+	return nil
+}
+
+// HashAlgos returns the names of all selectable hash algorithms.
+func HashAlgos() []string {
+	hashAlgosLock.RLock()
+	defer hashAlgosLock.RUnlock()
+
+	names := make([]string, 0, len(hashAlgos))
+	for name := range hashAlgos {
+		names = append(names, name)
+	}
+	return names
+}
+
+// lookupHashAlgo returns the hash algorithm registered under the given name,
+// the default one if the name is empty.
+func lookupHashAlgo(name string) (HashAlgo, error) {
+	if name == "" {
+		name = DefaultHashAlgo
+	}
+	hashAlgosLock.RLock()
+	defer hashAlgosLock.RUnlock()
+
+	algo, ok := hashAlgos[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownHashAlgo, name)
+	}
+	return algo, nil
+}
+
+// dumpAlgo returns the file name suffix marking dumps generated with a hash
+// algorithm other than the default one.
+func dumpAlgo(algo HashAlgo) string {
+	if algo.Name() == DefaultHashAlgo {
+		return ""
+	}
+	return "-" + algo.Name()
+}
+
+// keccakAlgo is the legacy Keccak used by the original proof-of-work.
+type keccakAlgo struct{}
+
+func (keccakAlgo) Name() string      { return DefaultHashAlgo }
+func (keccakAlgo) New256() hash.Hash { return sha3.NewLegacyKeccak256() }
+func (keccakAlgo) New512() hash.Hash { return sha3.NewLegacyKeccak512() }
+
+// sha3Algo is the standardized SHA3, which differs from Keccak in its padding.
+type sha3Algo struct{}
+
+func (sha3Algo) Name() string      { return "sha3" }
+func (sha3Algo) New256() hash.Hash { return sha3.New256() }
+func (sha3Algo) New512() hash.Hash { return sha3.New512() }
+
+// blake2bAlgo is BLAKE2b, unkeyed.
+type blake2bAlgo struct{}
+
+func (blake2bAlgo) Name() string { return "blake2b" }
+
+func (blake2bAlgo) New256() hash.Hash {
+	h, _ := blake2b.New256(nil) // Only fails for oversized keys
+	return h
+}
+
+func (blake2bAlgo) New512() hash.Hash {
+	h, _ := blake2b.New512(nil) // Only fails for oversized keys
+	return h
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/crypto/sha3"
+)
+
+// namedAlgo is a hash algorithm with a configurable name, for registry tests.
+type namedAlgo string
+
+func (a namedAlgo) Name() string      { return string(a) }
+func (a namedAlgo) New256() hash.Hash { return sha3.New256() }
+func (a namedAlgo) New512() hash.Hash { return sha3.New512() }
+
+// Tests that hash algorithms are only registered with valid and unique names.
+func TestHashAlgoRegistry(t *testing.T) {
+	if err := RegisterHashAlgo(namedAlgo("sha3")); !errors.Is(err, errDuplicateHashAlgo) {
+		t.Errorf("duplicate registration error mismatch: have %v, want %v", err, errDuplicateHashAlgo)
+	}
+	if err := RegisterHashAlgo(namedAlgo("Bad/Name")); !errors.Is(err, errInvalidHashAlgo) {
+		t.Errorf("invalid name error mismatch: have %v, want %v", err, errInvalidHashAlgo)
+	}
+	if _, err := lookupHashAlgo("test-algo"); !errors.Is(err, errUnknownHashAlgo) {
+		t.Errorf("unknown algorithm error mismatch: have %v, want %v", err, errUnknownHashAlgo)
+	}
+	if err := RegisterHashAlgo(namedAlgo("test-algo")); err != nil {
+		t.Fatalf("failed to register algorithm: %v", err)
+	}
+	if algo, err := lookupHashAlgo("test-algo"); err != nil || algo.Name() != "test-algo" {
+		t.Errorf("registered algorithm lookup mismatch: have %v, %v", algo, err)
+	}
+	if algo, err := lookupHashAlgo(""); err != nil || algo.Name() != DefaultHashAlgo {
+		t.Errorf("default algorithm lookup mismatch: have %v, %v", algo, err)
+	}
+}
+
+// Tests that blocks sealed with each built-in hash algorithm verify with the
+// same algorithm only, and that caches of different algorithms don't collide
+// on disk.
+func TestHashAlgoSealing(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"keccak", "sha3", "blake2b"} {
+		hmhash := New(Config{PowMode: ModeTest, HashAlgo: name, CacheDir: dir, CachesInMem: 1, CachesOnDisk: 1}, nil, false)
+		defer hmhash.Close()
+
+		header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+		results := make(chan *types.Block)
+		hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+		var block *types.Block
+		select {
+		case block = <-results:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: sealing timed out", name)
+		}
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Errorf("%s: sealed block invalid: %v", name, err)
+		}
+		for _, other := range []string{"keccak", "sha3", "blake2b"} {
+			if other == name {
+				continue
+			}
+			verifier := New(Config{PowMode: ModeTest, HashAlgo: other}, nil, false)
+			if err := verifier.verifySeal(context.Background(), nil, block.Header(), false); err == nil {
+				t.Errorf("%s: block verified with %s", name, other)
+			}
+			verifier.Close()
+		}
+	}
+	files, _ := os.ReadDir(dir)
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file.Name()))
+	}
+	if len(names) != 3 {
+		t.Fatalf("cache file count mismatch: have %v, want 3", names)
+	}
+	for _, suffix := range []string{"-sha3", "-blake2b"} {
+		var found bool
+		for _, name := range names {
+			found = found || strings.Contains(name, suffix)
+		}
+		if !found {
+			t.Errorf("no cache file with suffix %s: %v", suffix, names)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+const (
+	// defaultHashrateResolution is the interval averaged into a point of the
+	// hashrate history if the config leaves it unset.
+	defaultHashrateResolution = time.Minute
+
+	// defaultHashrateRetention is the time the points of the hashrate history
+	// are kept if the config leaves it unset.
+	defaultHashrateRetention = 24 * time.Hour
+)
+
+var errInvalidHistoryRange = errors.New("invalid hashrate history range")
+
+// HashratePoint is the average hashrate of the engine over an interval.
+type HashratePoint struct {
+	Time   hexutil.Uint64 `json:"time"`   // Unix time of the start of the interval, in seconds
+	Local  float64        `json:"local"`  // Hashrate of the local threads and GPUs
+	Remote float64        `json:"remote"` // Hashrate submitted by the remote miners
+}
+
+// hashrateHistory keeps the hashrate of the retention period in a ring buffer,
+// averaging the hashrate samples posted by the remote sealer over every interval
+// of the resolution into a point.
+type hashrateHistory struct {
+	resolution time.Duration
+
+	points []HashratePoint // Ring buffer of the points
+	next   int             // Index of the slot for the next point
+	full   bool            // Whether the ring buffer wrapped around
+	lock   sync.Mutex
+
+	sub       event.Subscription
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// startHashrateHistory creates a hashrate history fed by the hashrate samples of
+// the engine.
+func startHashrateHistory(hmhash *Hmhash, resolution, retention time.Duration) *hashrateHistory {
+	if resolution <= 0 {
+		resolution = defaultHashrateResolution
+	}
+	if retention <= 0 {
+		retention = defaultHashrateRetention
+	}
+	size := int(retention / resolution)
+	if size < 1 {
+		size = 1
+	}
+	samples := make(chan HashrateSample, 16)
+	h := &hashrateHistory{
+		resolution: resolution,
+		points:     make([]HashratePoint, size),
+		sub:        hmhash.SubscribeHashrateSample(samples),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go h.loop(samples)
+	return h
+}
+
+// stop terminates the background thread and waits for it to exit.
+func (h *hashrateHistory) stop() {
+	h.closeOnce.Do(func() {
+		h.sub.Unsubscribe()
+		close(h.quit)
+		<-h.done
+	})
+}
+
+func (h *hashrateHistory) loop(samples chan HashrateSample) {
+	defer close(h.done)
+
+	var (
+		point HashratePoint // Point of the current interval
+		count int           // Number of samples averaged into the point
+	)
+	for {
+		select {
+		case sample := <-samples:
+			start := hexutil.Uint64(sample.Time.Truncate(h.resolution).Unix())
+			if count > 0 && point.Time != start {
+				h.add(point)
+				count = 0
+			}
+			if count == 0 {
+				point = HashratePoint{Time: start}
+			}
+			point.Local = (point.Local*float64(count) + sample.Local) / float64(count+1)
+			point.Remote = (point.Remote*float64(count) + float64(sample.Remote)) / float64(count+1)
+			count++
+
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// add appends a point, overwriting the oldest one if the buffer is full.
+func (h *hashrateHistory) add(point HashratePoint) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.points[h.next] = point
+	h.next = (h.next + 1) % len(h.points)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// query returns the points within [from, to], oldest first. A non-zero step
+// averages the points within every step long bucket, aligned to the Unix epoch,
+// into a single one timed at the start of the bucket.
+func (h *hashrateHistory) query(from, to, step uint64) []HashratePoint {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	start, count := 0, h.next
+	if h.full {
+		start, count = h.next, len(h.points)
+	}
+	var (
+		result []HashratePoint
+		merged int // Number of points averaged into the last result
+	)
+	for i := 0; i < count; i++ {
+		point := h.points[(start+i)%len(h.points)]
+		if uint64(point.Time) < from || uint64(point.Time) > to {
+			continue
+		}
+		if step == 0 {
+			result = append(result, point)
+			continue
+		}
+		bucket := hexutil.Uint64(uint64(point.Time) / step * step)
+		if len(result) == 0 || result[len(result)-1].Time != bucket {
+			result = append(result, HashratePoint{Time: bucket})
+			merged = 0
+		}
+		last := &result[len(result)-1]
+		last.Local = (last.Local*float64(merged) + point.Local) / float64(merged+1)
+		last.Remote = (last.Remote*float64(merged) + point.Remote) / float64(merged+1)
+		merged++
+	}
+	if result == nil {
+		result = []HashratePoint{}
+	}
+	return result
+}
+
+// HashrateHistory returns the hashrate points between the given Unix times,
+// averaged over step seconds if non-zero.
+func (hmhash *Hmhash) HashrateHistory(from, to, step uint64) ([]HashratePoint, error) {
+	if hmhash.shared != nil {
+		return hmhash.shared.HashrateHistory(from, to, step)
+	}
+	if from > to {
+		return nil, errInvalidHistoryRange
+	}
+	if hmhash.history == nil {
+		return []HashratePoint{}, nil
+	}
+	return hmhash.history.query(from, to, step), nil
+}
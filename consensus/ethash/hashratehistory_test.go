@@ -0,0 +1,63 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that the hashrate samples are averaged into points of the resolution,
+// keeping those of the retention period only.
+func TestHashrateHistory(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, HashrateResolution: 10 * time.Second, HashrateRetention: 30 * time.Second}, nil, false)
+	defer hmhash.Close()
+
+	// Post the samples of five intervals, the first two of which expire
+	base := time.Unix(1000, 0)
+	for i := 0; i < 10; i++ {
+		hmhash.events.rates.Send(HashrateSample{Local: float64(i), Remote: uint64(2 * i), Time: base.Add(time.Duration(i) * 5 * time.Second)})
+	}
+	hmhash.events.rates.Send(HashrateSample{Time: base.Add(time.Minute)}) // Closes the last interval
+
+	want := []HashratePoint{
+		{Time: 1020, Local: 4.5, Remote: 9},
+		{Time: 1030, Local: 6.5, Remote: 13},
+		{Time: 1040, Local: 8.5, Remote: 17},
+	}
+	var have []HashratePoint
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		if have, _ = hmhash.HashrateHistory(0, 2000, 0); reflect.DeepEqual(have, want) {
+			break
+		}
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("points mismatch: have %+v, want %+v", have, want)
+	}
+	// Query a range averaged over a coarser step
+	have, err := (&MiningAPI{hmhash}).GetHashrateHistory(1025, 2000, 20)
+	if err != nil {
+		t.Fatalf("failed to query history: %v", err)
+	}
+	want = []HashratePoint{{Time: 1020, Local: 6.5, Remote: 13}, {Time: 1040, Local: 8.5, Remote: 17}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("stepped points mismatch: have %+v, want %+v", have, want)
+	}
+	if _, err := hmhash.HashrateHistory(2000, 1000, 0); err != errInvalidHistoryRange {
+		t.Errorf("inverted range error mismatch: have %v, want %v", err, errInvalidHistoryRange)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// hashrateSigWindow is how far the time a hash rate was signed at may lie from
+// the local clock, bounding how long a captured signature stays usable.
+const hashrateSigWindow = time.Minute
+
+var (
+	errUnsignedHashrate    = errors.New("unsigned hashrate")
+	errStaleHashrateSig    = errors.New("stale or replayed hashrate signature")
+	errUnregisteredWorker  = errors.New("hashrate id not registered")
+	errInvalidHashrateSig  = errors.New("invalid hashrate signature")
+	errHashrateSignerOwner = errors.New("hashrate signed by another key")
+)
+
+var badHashrateSigMeter = metrics.NewRegisteredMeter("hmhash/remote/hashrate/badsig", nil)
+
+// HashrateSigner is a remote worker registered to sign the hash rates it
+// submits under its hashrate id.
+type HashrateSigner struct {
+	ID     common.Hash    `json:"id"`     // Hashrate id of the worker
+	Signer common.Address `json:"signer"` // Address of the key signing the hash rates
+}
+
+// hashrateSigners verifies the signatures of submitted hash rates against the
+// keys registered for their ids, so the aggregate hash rate can't be inflated
+// by anonymous submissions.
+type hashrateSigners struct {
+	required bool // Whether hash rates of unregistered ids are rejected
+
+	lock    sync.Mutex
+	signers map[common.Hash]common.Address
+	last    map[common.Hash]uint64 // Signing time of the last accepted hash rate of each id
+}
+
+// newHashrateSigners creates the registry of hashrate signers, rejecting the
+// hash rates of unregistered ids if required.
+func newHashrateSigners(required bool) *hashrateSigners {
+	return &hashrateSigners{
+		required: required,
+		signers:  make(map[common.Hash]common.Address),
+		last:     make(map[common.Hash]uint64),
+	}
+}
+
+// HashrateSigHash returns the hash a remote worker signs to submit a hash rate
+// under an id at a Unix time: keccak256(id || uint64 big-endian rate || uint64
+// big-endian time). The time has to be within a minute of the node's clock and
+// later than the one of the previous hash rate of the id, so signed hash rates
+// can't be replayed.
+func HashrateSigHash(rate uint64, id common.Hash, time uint64) common.Hash {
+	var enc [16]byte
+	binary.BigEndian.PutUint64(enc[:8], rate)
+	binary.BigEndian.PutUint64(enc[8:], time)
+	return crypto.Keccak256Hash(id[:], enc[:])
+}
+
+// register binds the key of the given address to a hashrate id.
+func (s *hashrateSigners) register(id common.Hash, signer common.Address) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.signers[id] = signer
+}
+
+// unregister removes the key bound to a hashrate id, reporting whether there
+// was one.
+func (s *hashrateSigners) unregister(id common.Hash) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.signers[id]
+	delete(s.signers, id)
+	delete(s.last, id)
+	return ok
+}
+
+// list returns the registered hashrate signers, ordered by id.
+func (s *hashrateSigners) list() []HashrateSigner {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	signers := make([]HashrateSigner, 0, len(s.signers))
+	for id, signer := range s.signers {
+		signers = append(signers, HashrateSigner{ID: id, Signer: signer})
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return bytes.Compare(signers[i].ID[:], signers[j].ID[:]) < 0
+	})
+	return signers
+}
+
+// verify checks the signature of a hash rate submitted with the time it was
+// signed at. The hash rates of registered ids have to be signed by their key
+// recently, and later than the previous one, the ones of unregistered ids are
+// rejected if signatures are required and accepted unsigned otherwise.
+func (s *hashrateSigners) verify(rate uint64, id common.Hash, signed uint64, sig []byte, now time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	signer, ok := s.signers[id]
+	switch {
+	case !ok && s.required:
+		badHashrateSigMeter.Mark(1)
+		return errUnregisteredWorker
+	case !ok:
+		return nil
+	case len(sig) == 0:
+		badHashrateSigMeter.Mark(1)
+		return errUnsignedHashrate
+	}
+	if at := time.Unix(int64(signed), 0); signed <= s.last[id] || at.Before(now.Add(-hashrateSigWindow)) || at.After(now.Add(hashrateSigWindow)) {
+		badHashrateSigMeter.Mark(1)
+		return errStaleHashrateSig
+	}
+	pubkey, err := crypto.SigToPub(HashrateSigHash(rate, id, signed).Bytes(), sig)
+	if err != nil {
+		badHashrateSigMeter.Mark(1)
+		return errInvalidHashrateSig
+	}
+	if crypto.PubkeyToAddress(*pubkey) != signer {
+		badHashrateSigMeter.Mark(1)
+		return errHashrateSignerOwner
+	}
+	s.last[id] = signed
+	return nil
+}
+
+// RegisterHashrateSigner registers the key of the given address to sign the
+// hash rates submitted under an id.
+func (hmhash *Hmhash) RegisterHashrateSigner(id common.Hash, signer common.Address) error {
+	if hmhash.remote == nil {
+		return errNoRemoteSealer
+	}
+	hmhash.remote.signers.register(id, signer)
+	return nil
+}
+
+// UnregisterHashrateSigner removes the key registered for a hashrate id,
+// reporting whether there was one.
+func (hmhash *Hmhash) UnregisterHashrateSigner(id common.Hash) bool {
+	if hmhash.remote == nil {
+		return false
+	}
+	return hmhash.remote.signers.unregister(id)
+}
+
+// HashrateSigners returns the registered hashrate signers.
+func (hmhash *Hmhash) HashrateSigners() []HashrateSigner {
+	if hmhash.remote == nil {
+		return nil
+	}
+	return hmhash.remote.signers.list()
+}
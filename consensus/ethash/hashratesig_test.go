@@ -0,0 +1,122 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the hash rates of registered ids have to be signed by their key
+// recently and only once, and that unregistered ids are only rejected if
+// signatures are required.
+func TestHashrateSigners(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+
+	var (
+		signers = newHashrateSigners(false)
+		id      = common.Hash{1}
+		now     = time.Unix(1000, 0)
+		sig, _  = crypto.Sign(HashrateSigHash(100, id, 1000).Bytes(), key)
+		bad, _  = crypto.Sign(HashrateSigHash(100, id, 1000).Bytes(), other)
+		old, _  = crypto.Sign(HashrateSigHash(100, id, 900).Bytes(), key)
+		next, _ = crypto.Sign(HashrateSigHash(100, id, 1010).Bytes(), key)
+	)
+	if err := signers.verify(100, id, 0, nil, now); err != nil {
+		t.Errorf("unregistered unsigned hashrate rejected: %v", err)
+	}
+	signers.register(id, crypto.PubkeyToAddress(key.PublicKey))
+	if err := signers.verify(100, id, 1000, nil, now); err != errUnsignedHashrate {
+		t.Errorf("unsigned hashrate error mismatch: have %v, want %v", err, errUnsignedHashrate)
+	}
+	if err := signers.verify(200, id, 1000, sig, now); err != errHashrateSignerOwner {
+		t.Errorf("tampered hashrate error mismatch: have %v, want %v", err, errHashrateSignerOwner)
+	}
+	if err := signers.verify(100, id, 1000, bad, now); err != errHashrateSignerOwner {
+		t.Errorf("foreign signature error mismatch: have %v, want %v", err, errHashrateSignerOwner)
+	}
+	if err := signers.verify(100, id, 1000, []byte{1, 2, 3}, now); err != errInvalidHashrateSig {
+		t.Errorf("malformed signature error mismatch: have %v, want %v", err, errInvalidHashrateSig)
+	}
+	if err := signers.verify(100, id, 900, old, now); err != errStaleHashrateSig {
+		t.Errorf("old signature error mismatch: have %v, want %v", err, errStaleHashrateSig)
+	}
+	if err := signers.verify(100, id, 1000, sig, now); err != nil {
+		t.Errorf("signed hashrate rejected: %v", err)
+	}
+	if err := signers.verify(100, id, 1000, sig, now); err != errStaleHashrateSig {
+		t.Errorf("replayed signature error mismatch: have %v, want %v", err, errStaleHashrateSig)
+	}
+	if err := signers.verify(100, id, 1010, next, now.Add(2*hashrateSigWindow)); err != errStaleHashrateSig {
+		t.Errorf("expired signature error mismatch: have %v, want %v", err, errStaleHashrateSig)
+	}
+	if err := signers.verify(100, id, 1010, next, now); err != nil {
+		t.Errorf("later signed hashrate rejected: %v", err)
+	}
+	if !signers.unregister(id) || signers.unregister(id) {
+		t.Errorf("unregistration mismatch")
+	}
+	if err := newHashrateSigners(true).verify(100, id, 1000, sig, now); err != errUnregisteredWorker {
+		t.Errorf("required signer error mismatch: have %v, want %v", err, errUnregisteredWorker)
+	}
+}
+
+// Tests that only signed hash rates of registered workers count towards the
+// remote hash rate if signatures are required.
+func TestSignedHashrateRemote(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, SignedHashrate: true}, nil, true)
+	defer hmhash.Close()
+
+	var (
+		api    = &API{hmhash}
+		ctx    = context.Background()
+		key, _ = crypto.GenerateKey()
+		id     = common.Hash{1}
+	)
+	if api.SubmitHashrate(ctx, 100, id, nil, nil, nil) {
+		t.Errorf("hashrate of unregistered worker accepted")
+	}
+	if hmhash.SubmitRemoteHashrate(ctx, 100, id, nil, nil, 0) {
+		t.Errorf("hashrate of unregistered worker accepted from transport")
+	}
+	if err := (&AdminAPI{hmhash: hmhash}).RegisterWorker(id, crypto.PubkeyToAddress(key.PublicKey)); err != nil {
+		t.Fatalf("failed to register worker: %v", err)
+	}
+	signed := hexutil.Uint64(time.Now().Unix())
+	sig, _ := crypto.Sign(HashrateSigHash(100, id, uint64(signed)).Bytes(), key)
+	if !api.SubmitHashrate(ctx, 100, id, nil, (*hexutil.Bytes)(&sig), &signed) {
+		t.Errorf("signed hashrate rejected")
+	}
+	if hmhash.SubmitRemoteHashrate(ctx, 100, id, nil, sig, uint64(signed)) {
+		t.Errorf("replayed hashrate accepted from transport")
+	}
+	if hmhash.SubmitRemoteHashrate(ctx, 100, id, nil, nil, 0) {
+		t.Errorf("unsigned hashrate of registered worker accepted from transport")
+	}
+	if have := hmhash.Hashrate(); have != 100 {
+		t.Errorf("hashrate mismatch: have %f, want 100", have)
+	}
+	if workers := (&MiningAPI{hmhash}).GetRegisteredWorkers(); len(workers) != 1 || workers[0].ID != id {
+		t.Errorf("registered workers mismatch: %v", workers)
+	}
+}
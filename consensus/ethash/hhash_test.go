@@ -17,9 +17,11 @@
 package ethash
 
 import (
+	"context"
 	"math/big"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -45,7 +47,7 @@ func TestTestMode(t *testing.T) {
 	case block := <-results:
 		header.Nonce = types.EncodeNonce(block.Nonce())
 		header.MixDigest = block.MixDigest()
-		if err := hmhash.verifySeal(nil, header, false); err != nil {
+		if err := hmhash.verifySeal(context.Background(), nil, header, false); err != nil {
 			t.Fatalf("unexpected verification error: %v", err)
 		}
 	case <-time.NewTimer(4 * time.Second).C:
@@ -65,7 +67,10 @@ func TestCacheFileEvict(t *testing.T) {
 	defer os.RemoveAll(tmpdir)
 
 	config := Config{
-		PowMode: ModeTest,
+		CachesInMem:  3,
+		CachesOnDisk: 10,
+		CacheDir:     tmpdir,
+		PowMode:      ModeTest,
 	}
 	e := New(config, nil, false)
 	defer e.Close()
@@ -91,7 +96,7 @@ func verifyTest(wg *sync.WaitGroup, e *Hmhash, workerIndex, epochs int) {
 			block = 0
 		}
 		header := &types.Header{Number: big.NewInt(block), Difficulty: big.NewInt(100)}
-		e.verifySeal(nil, header, false)
+		e.verifySeal(context.Background(), nil, header, false)
 	}
 }
 
@@ -100,7 +105,7 @@ func TestRemoteSealer(t *testing.T) {
 	defer hmhash.Close()
 
 	api := &API{hmhash}
-	if _, err := api.GetWork(); err != errNoMiningWork {
+	if _, err := api.GetWork(context.Background()); err != errNoMiningWork {
 		t.Error("expect to return an error indicate there is no mining work")
 	}
 	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
@@ -112,14 +117,14 @@ func TestRemoteSealer(t *testing.T) {
 	hmhash.Seal(nil, block, results, nil)
 
 	var (
-		work [4]string
+		work []string
 		err  error
 	)
-	if work, err = api.GetWork(); err != nil || work[0] != sealhash.Hex() {
+	if work, err = api.GetWork(context.Background()); err != nil || work[0] != sealhash.Hex() {
 		t.Error("expect to return a mining work has same hash")
 	}
 
-	if res := api.SubmitWork(types.BlockNonce{}, sealhash, common.Hash{}); res {
+	if res := api.SubmitWork(context.Background(), types.BlockNonce{}, sealhash, common.Hash{}, nil); res {
 		t.Error("expect to return false when submit a fake solution")
 	}
 	// Push new block with same block number to replace the original one.
@@ -128,7 +133,7 @@ func TestRemoteSealer(t *testing.T) {
 	sealhash = hmhash.SealHash(header)
 	hmhash.Seal(nil, block, results, nil)
 
-	if work, err = api.GetWork(); err != nil || work[0] != sealhash.Hex() {
+	if work, err = api.GetWork(context.Background()); err != nil || work[0] != sealhash.Hex() {
 		t.Error("expect to return the latest pushed work")
 	}
 }
@@ -148,7 +153,7 @@ func TestHashrate(t *testing.T) {
 
 	api := &API{hmhash}
 	for i := 0; i < len(hashrate); i += 1 {
-		if res := api.SubmitHashrate(hashrate[i], ids[i]); !res {
+		if res := api.SubmitHashrate(context.Background(), hashrate[i], ids[i], nil, nil, nil); !res {
 			t.Error("remote miner submit hashrate failed")
 		}
 		expect += uint64(hashrate[i])
@@ -158,17 +163,79 @@ func TestHashrate(t *testing.T) {
 	}
 }
 
+func TestHashrateBreakdown(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	api := &API{hmhash}
+	api.SubmitHashrate(context.Background(), hexutil.Uint64(100), common.HexToHash("a"), nil, nil, nil)
+	api.SubmitHashrate(context.Background(), hexutil.Uint64(200), common.HexToHash("b"), nil, nil, nil)
+
+	// Mine on two threads with an unreachable difficulty to get thread meters
+	hmhash.SetThreads(2)
+	stop := make(chan struct{})
+	defer close(stop)
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(big.NewInt(1), 200)}
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block), stop); err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	breakdown := (&MiningAPI{hmhash}).GetHashrateBreakdown()
+	if len(breakdown.Threads) != 2 {
+		t.Errorf("thread count mismatch: have %d, want 2", len(breakdown.Threads))
+	}
+	if len(breakdown.Remote) != 2 || breakdown.Remote[common.HexToHash("a")] != 100 || breakdown.Remote[common.HexToHash("b")] != 200 {
+		t.Errorf("remote hashrate mismatch: have %v", breakdown.Remote)
+	}
+}
+
 func TestClosedRemoteSealer(t *testing.T) {
 	hmhash := NewTester(nil, false)
 	time.Sleep(1 * time.Second) // ensure exit channel is listening
 	hmhash.Close()
 
 	api := &API{hmhash}
-	if _, err := api.GetWork(); err != errHmhashStopped {
+	if _, err := api.GetWork(context.Background()); err != errHmhashStopped {
 		t.Error("expect to return an error to indicate hmhash is stopped")
 	}
 
-	if res := api.SubmitHashrate(hexutil.Uint64(100), common.HexToHash("a")); res {
+	if res := api.SubmitHashrate(context.Background(), hexutil.Uint64(100), common.HexToHash("a"), nil, nil, nil); res {
 		t.Error("expect to return false when submit hashrate to a stopped hmhash")
 	}
 }
+
+// Tests that caches dumped to disk are loaded back by memory mapping instead of
+// being regenerated, and that dumps with a bad header are rejected.
+func TestCacheDiskPersistence(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	generated := newCache(0, keccakAlgo{})
+	generated.generate(tmpdir, 1, false, testCacheSize)
+
+	loaded := newCache(0, keccakAlgo{})
+	loaded.generate(tmpdir, 1, false, testCacheSize)
+	if loaded.mmap == nil {
+		t.Fatalf("cache was not memory mapped from disk")
+	}
+	if len(loaded.cache) != len(generated.cache) {
+		t.Fatalf("cache length mismatch: have %d, want %d", len(loaded.cache), len(generated.cache))
+	}
+	for i := range generated.cache {
+		if loaded.cache[i] != generated.cache[i] {
+			t.Fatalf("cache content mismatch at %d", i)
+		}
+	}
+	generated.finalizer()
+	loaded.finalizer()
+
+	// Corrupt the dump header and ensure it's detected
+	files, err := filepath.Glob(filepath.Join(tmpdir, "cache-R*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("unexpected cache dumps: %v, %v", files, err)
+	}
+	if err := os.WriteFile(files[0], make([]byte, 64), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := memoryMap(files[0], false, true); err != ErrInvalidDumpMagic {
+		t.Fatalf("corrupt dump error mismatch: have %v, want %v", err, ErrInvalidDumpMagic)
+	}
+}
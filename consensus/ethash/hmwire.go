@@ -0,0 +1,647 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// hmwire is the private binary mining protocol of hmhash. Its messages are
+// modelled after the Stratum v2 Mining sub-protocol with standard channels, but
+// it is not Stratum v2 and does not interoperate with Stratum v2 software: jobs
+// carry the seal hash, seed hash and block number, shares carry a 64 bit nonce,
+// and connections are secured with standard TLS using the remote mining
+// certificate instead of the Noise handshake. Without a certificate frames are
+// sent in plain text, like Stratum v1.
+
+const (
+	hmwireVersion       = 1 // Protocol version negotiated on connection setup
+	hmwireMiningProto   = 0 // Identifier of the Mining sub-protocol
+	hmwireHeaderSize    = 6 // Size of the frame header
+	hmwireMaxPayload    = 1 << 16
+	hmwireChannelBit    = 0x8000
+	hmwireHandshakeTime = 10 * time.Second // Time allowed to complete the TLS handshake
+)
+
+// hmwire message types.
+const (
+	hmwireSetupConnection                  = 0x00
+	hmwireSetupConnectionSuccess           = 0x01
+	hmwireSetupConnectionError             = 0x02
+	hmwireOpenStandardMiningChannel        = 0x10
+	hmwireOpenStandardMiningChannelSuccess = 0x11
+	hmwireOpenMiningChannelError           = 0x12
+	hmwireNewMiningJob                     = 0x15
+	hmwireSubmitSharesStandard             = 0x1a
+	hmwireSubmitSharesSuccess              = 0x1c
+	hmwireSubmitSharesError                = 0x1d
+	hmwireSetTarget                        = 0x21
+)
+
+var (
+	errHmwireTruncated   = errors.New("truncated hmwire message")
+	errHmwireBadFrame    = errors.New("malformed hmwire frame")
+	errHmwireNotSetup    = errors.New("connection not set up")
+	errHmwireUnknownType = errors.New("unknown hmwire message type")
+)
+
+// hmwireFrame is a single decoded hmwire message.
+type hmwireFrame struct {
+	extension uint16 // Extension type, including the channel message bit
+	msgType   uint8
+	payload   []byte
+}
+
+// encodeHmwireFrame serializes a message into a frame. Messages addressed to
+// a channel must have the channel bit set in their extension type.
+func encodeHmwireFrame(msgType uint8, channel bool, payload []byte) []byte {
+	var extension uint16
+	if channel {
+		extension |= hmwireChannelBit
+	}
+	frame := make([]byte, hmwireHeaderSize, hmwireHeaderSize+len(payload))
+	binary.LittleEndian.PutUint16(frame, extension)
+	frame[2] = msgType
+	frame[3], frame[4], frame[5] = byte(len(payload)), byte(len(payload)>>8), byte(len(payload)>>16)
+	return append(frame, payload...)
+}
+
+// decodeHmwireFrame parses a frame, checking the declared payload length.
+func decodeHmwireFrame(frame []byte) (*hmwireFrame, error) {
+	if len(frame) < hmwireHeaderSize {
+		return nil, errHmwireBadFrame
+	}
+	size := int(frame[3]) | int(frame[4])<<8 | int(frame[5])<<16
+	if len(frame) != hmwireHeaderSize+size {
+		return nil, errHmwireBadFrame
+	}
+	return &hmwireFrame{
+		extension: binary.LittleEndian.Uint16(frame),
+		msgType:   frame[2],
+		payload:   frame[hmwireHeaderSize:],
+	}, nil
+}
+
+// readHmwireFrame reads a single frame from r, rejecting oversized payloads
+// before allocating them.
+func readHmwireFrame(r io.Reader) (*hmwireFrame, error) {
+	header := make([]byte, hmwireHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := int(header[3]) | int(header[4])<<8 | int(header[5])<<16
+	if size > hmwireMaxPayload {
+		return nil, errHmwireBadFrame
+	}
+	frame := append(header, make([]byte, size)...)
+	if _, err := io.ReadFull(r, frame[hmwireHeaderSize:]); err != nil {
+		return nil, err
+	}
+	return decodeHmwireFrame(frame)
+}
+
+// hmwireEncoder serializes the hmwire data types.
+type hmwireEncoder struct {
+	buf []byte
+}
+
+func (e *hmwireEncoder) u8(v uint8)   { e.buf = append(e.buf, v) }
+func (e *hmwireEncoder) u16(v uint16) { e.buf = binary.LittleEndian.AppendUint16(e.buf, v) }
+func (e *hmwireEncoder) u32(v uint32) { e.buf = binary.LittleEndian.AppendUint32(e.buf, v) }
+func (e *hmwireEncoder) u64(v uint64) { e.buf = binary.LittleEndian.AppendUint64(e.buf, v) }
+
+func (e *hmwireEncoder) boolean(v bool) {
+	if v {
+		e.u8(1)
+	} else {
+		e.u8(0)
+	}
+}
+
+// u256 appends a 256 bit integer in little endian order.
+func (e *hmwireEncoder) u256(v *big.Int) {
+	var word [32]byte
+	v.FillBytes(word[:])
+	for i := len(word) - 1; i >= 0; i-- {
+		e.buf = append(e.buf, word[i])
+	}
+}
+
+// hash appends a 32 byte hash as is.
+func (e *hmwireEncoder) hash(h common.Hash) { e.buf = append(e.buf, h[:]...) }
+
+// str appends a STR0_255 string, truncating it if too long.
+func (e *hmwireEncoder) str(s string) {
+	if len(s) > math.MaxUint8 {
+		s = s[:math.MaxUint8]
+	}
+	e.u8(uint8(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// bytes32 appends a B0_32 byte array.
+func (e *hmwireEncoder) bytes32(b []byte) {
+	e.u8(uint8(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// hmwireDecoder deserializes the hmwire data types. The first error is
+// retained and all subsequent reads return zero values.
+type hmwireDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *hmwireDecoder) take(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if len(d.buf) < n {
+		d.err = errHmwireTruncated
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *hmwireDecoder) u8() uint8   { return d.take(1)[0] }
+func (d *hmwireDecoder) u16() uint16 { return binary.LittleEndian.Uint16(d.take(2)) }
+func (d *hmwireDecoder) u32() uint32 { return binary.LittleEndian.Uint32(d.take(4)) }
+func (d *hmwireDecoder) u64() uint64 { return binary.LittleEndian.Uint64(d.take(8)) }
+func (d *hmwireDecoder) boolean() bool {
+	return d.u8() != 0
+}
+
+func (d *hmwireDecoder) u256() *big.Int {
+	var word [32]byte
+	le := d.take(32)
+	for i := range word {
+		word[i] = le[31-i]
+	}
+	return new(big.Int).SetBytes(word[:])
+}
+
+func (d *hmwireDecoder) hash() common.Hash { return common.BytesToHash(d.take(32)) }
+func (d *hmwireDecoder) str() string       { return string(d.take(int(d.u8()))) }
+func (d *hmwireDecoder) bytes32() []byte   { return d.take(int(d.u8())) }
+
+// hmwireServer is an hmwire endpoint serving the remote sealer's work over TLS
+// connections. It runs alongside the HTTP notifications and the Stratum v1
+// server, all of which receive the same work packages.
+type hmwireServer struct {
+	hmhash   *Hmhash
+	listener net.Listener
+	config   *tls.Config // TLS configuration of the connections, nil for plain text
+
+	lock     sync.Mutex
+	sessions map[*hmwireSession]struct{}
+	jobID    uint32                 // Identifier of the most recent job, 0 if there's no work yet
+	jobs     map[uint32]*stratumJob // Recent jobs by identifier, for late submissions
+
+	wg       sync.WaitGroup
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// listenHmwire opens the hmwire listener on the given address, serving TLS if a
+// configuration is given. Connections are only accepted after start is called.
+func listenHmwire(hmhash *Hmhash, addr string, config *tls.Config) (*hmwireServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &hmwireServer{
+		hmhash:   hmhash,
+		listener: listener,
+		config:   config,
+		sessions: make(map[*hmwireSession]struct{}),
+		jobs:     make(map[uint32]*stratumJob),
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// Start begins serving hmwire connections in the background.
+func (s *hmwireServer) Start() {
+	s.wg.Add(1)
+	go s.serve()
+
+	s.hmhash.logs.sealer.Info("Hmwire server started", "addr", s.listener.Addr(), "tls", s.config != nil)
+}
+
+// serve accepts incoming connections until the listener is closed.
+func (s *hmwireServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			s.hmhash.logs.sealer.Warn("Hmwire accept failed", "err", err)
+			return
+		}
+		session := &hmwireSession{
+			server:   s,
+			raw:      conn,
+			jobCh:    make(chan uint32, 1),
+			channels: make(map[uint32]string),
+			targets:  make(map[uint32]*big.Int),
+			log:      s.hmhash.logs.sealer.New("miner", conn.RemoteAddr()),
+		}
+		s.lock.Lock()
+		s.sessions[session] = struct{}{}
+		s.lock.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			session.handle()
+
+			s.lock.Lock()
+			delete(s.sessions, session)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+// Close terminates the listener and all open sessions, waiting for them to exit.
+func (s *hmwireServer) Close() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+		s.listener.Close()
+
+		s.lock.Lock()
+		for session := range s.sessions {
+			session.raw.Close()
+		}
+		s.lock.Unlock()
+
+		s.wg.Wait()
+	})
+}
+
+// NotifyWork registers a remote sealer work package as a new job and pushes it
+// to all miners with an open channel.
+func (s *hmwireServer) NotifyWork(work [4]string, block *types.Block) {
+	job := newStratumJob(work, block)
+
+	s.lock.Lock()
+	s.jobID++
+	id := s.jobID
+	s.jobs[id] = job
+	for old, j := range s.jobs {
+		if j.number+s.hmhash.StaleWorkWindow() <= job.number {
+			delete(s.jobs, old)
+		}
+	}
+	sessions := make([]*hmwireSession, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.lock.Unlock()
+
+	for _, session := range sessions {
+		session.queueJob(id)
+	}
+}
+
+// currentJob returns the most recent job and its identifier, if any.
+func (s *hmwireServer) currentJob() (uint32, *stratumJob) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.jobID, s.jobs[s.jobID]
+}
+
+// findJob returns a recent job by its identifier.
+func (s *hmwireServer) findJob(id uint32) *stratumJob {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.jobs[id]
+}
+
+// hmwireSession is a single connected hmwire miner.
+type hmwireSession struct {
+	server *hmwireServer
+	raw    net.Conn    // Underlying connection, closed to abort the session
+	conn   net.Conn    // Possibly TLS wrapped connection, set once the handshake completes
+	jobCh  chan uint32 // Jobs waiting to be pushed, only the latest is kept
+	log    log.Logger
+
+	wlock sync.Mutex // Serializes frame writes
+
+	lock        sync.Mutex // Protects the fields below
+	setup       bool       // Whether SetupConnection succeeded
+	channels    map[uint32]string
+	nextChannel uint32
+	targets     map[uint32]*big.Int // Target last sent on each channel
+	accepted    uint32              // Number of accepted shares, across channels
+}
+
+// handle performs the handshake, then reads and processes messages from the
+// miner until the connection drops.
+func (sess *hmwireSession) handle() {
+	defer sess.raw.Close()
+
+	conn := sess.raw
+	if sess.server.config != nil {
+		tlsConn := tls.Server(sess.raw, sess.server.config)
+
+		sess.raw.SetDeadline(time.Now().Add(hmwireHandshakeTime))
+		if err := tlsConn.Handshake(); err != nil {
+			sess.log.Debug("Hmwire handshake failed", "err", err)
+			return
+		}
+		sess.raw.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	sess.conn = conn
+	sess.log.Debug("Hmwire miner connected")
+
+	// Push jobs on a separate goroutine so slow miners can't stall the sealer
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case id := <-sess.jobCh:
+				sess.sendJob(id)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		sess.raw.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		frame, err := readHmwireFrame(conn)
+		if err != nil {
+			sess.log.Debug("Hmwire miner disconnected", "err", err)
+			return
+		}
+		if err := sess.dispatch(frame); err != nil {
+			sess.log.Debug("Failed to process hmwire message", "type", frame.msgType, "err", err)
+			return
+		}
+	}
+}
+
+// dispatch processes a single message from the miner. Returning an error tears
+// down the connection, protocol level failures are reported to the miner.
+func (sess *hmwireSession) dispatch(frame *hmwireFrame) error {
+	dec := &hmwireDecoder{buf: frame.payload}
+
+	switch frame.msgType {
+	case hmwireSetupConnection:
+		var (
+			protocol   = dec.u8()
+			minVersion = dec.u16()
+			maxVersion = dec.u16()
+			_          = dec.u32() // Flags, none are supported
+		)
+		if dec.err != nil {
+			return dec.err
+		}
+		enc := new(hmwireEncoder)
+		switch {
+		case protocol != hmwireMiningProto:
+			enc.u32(0)
+			enc.str("unsupported-protocol")
+			return sess.write(hmwireSetupConnectionError, false, enc.buf)
+		case minVersion > hmwireVersion || maxVersion < hmwireVersion:
+			enc.u32(0)
+			enc.str("protocol-version-mismatch")
+			return sess.write(hmwireSetupConnectionError, false, enc.buf)
+		}
+		sess.lock.Lock()
+		sess.setup = true
+		sess.lock.Unlock()
+
+		enc.u16(hmwireVersion)
+		enc.u32(0)
+		return sess.write(hmwireSetupConnectionSuccess, false, enc.buf)
+
+	case hmwireOpenStandardMiningChannel:
+		var (
+			requestID = dec.u32()
+			user      = dec.str()
+			_         = dec.u32() // Nominal hash rate, unused
+			_         = dec.u256()
+		)
+		if dec.err != nil {
+			return dec.err
+		}
+		if user == "" {
+			enc := new(hmwireEncoder)
+			enc.u32(requestID)
+			enc.str("unknown-user")
+			return sess.write(hmwireOpenMiningChannelError, false, enc.buf)
+		}
+		sess.lock.Lock()
+		if !sess.setup {
+			sess.lock.Unlock()
+			return errHmwireNotSetup
+		}
+		sess.nextChannel++
+		channel := sess.nextChannel
+		sess.channels[channel] = user
+		sess.lock.Unlock()
+
+		id, job := sess.server.currentJob()
+		target := new(big.Int)
+		if job != nil {
+			target = sess.server.hmhash.workerTarget(user, job.difficulty)
+		}
+		enc := new(hmwireEncoder)
+		enc.u32(requestID)
+		enc.u32(channel)
+		enc.u256(target)
+		enc.bytes32(nil)
+		enc.u32(0)
+		if err := sess.write(hmwireOpenStandardMiningChannelSuccess, false, enc.buf); err != nil {
+			return err
+		}
+		if job != nil {
+			sess.queueJob(id)
+		}
+		return nil
+
+	case hmwireSubmitSharesStandard:
+		var (
+			channel  = dec.u32()
+			sequence = dec.u32()
+			jobID    = dec.u32()
+			nonce    = dec.u64()
+		)
+		if dec.err != nil {
+			return dec.err
+		}
+		return sess.submit(channel, sequence, jobID, nonce)
+
+	default:
+		return errHmwireUnknownType
+	}
+}
+
+// submit verifies and forwards a share for a previously handed out job.
+func (sess *hmwireSession) submit(channel, sequence, jobID uint32, nonce uint64) error {
+	reject := func(code string) error {
+		enc := new(hmwireEncoder)
+		enc.u32(channel)
+		enc.u32(sequence)
+		enc.str(code)
+		return sess.write(hmwireSubmitSharesError, true, enc.buf)
+	}
+	sess.lock.Lock()
+	user, open := sess.channels[channel]
+	sess.lock.Unlock()
+	if !open {
+		return reject("invalid-channel-id")
+	}
+	job := sess.server.findJob(jobID)
+	if job == nil {
+		return reject("invalid-job-id")
+	}
+	var (
+		hmhash   = sess.server.hmhash
+		sealhash = common.HexToHash(job.header)
+		digest   = hmhash.mixDigest(job.number, sealhash, nonce)
+	)
+	if !(&API{hmhash}).submitWork(types.EncodeNonce(nonce), sealhash, digest, user) {
+		return reject("difficulty-too-low")
+	}
+	sess.lock.Lock()
+	sess.accepted++
+	accepted := sess.accepted
+	sess.lock.Unlock()
+
+	enc := new(hmwireEncoder)
+	enc.u32(channel)
+	enc.u32(sequence)
+	enc.u32(accepted)
+	enc.u64(1)
+	if err := sess.write(hmwireSubmitSharesSuccess, true, enc.buf); err != nil {
+		return err
+	}
+	// Push the current job again if the share changed the worker's share
+	// difficulty, so the channel picks up its new target
+	if id, current := sess.server.currentJob(); current != nil {
+		sess.lock.Lock()
+		retargeted := sess.targets[channel] != nil && sess.targets[channel].Cmp(hmhash.workerTarget(user, current.difficulty)) != 0
+		sess.lock.Unlock()
+
+		if retargeted {
+			sess.queueJob(id)
+		}
+	}
+	return nil
+}
+
+// queueJob schedules a job to be pushed to the miner, replacing any job still
+// waiting in the queue. It never blocks.
+func (sess *hmwireSession) queueJob(id uint32) {
+	for {
+		select {
+		case sess.jobCh <- id:
+			return
+		default:
+		}
+		select {
+		case <-sess.jobCh:
+		default:
+		}
+	}
+}
+
+// sendJob pushes a job to every open channel of the miner, preceded by a
+// target update on channels whose worker's target for the job changed.
+func (sess *hmwireSession) sendJob(id uint32) {
+	job := sess.server.findJob(id)
+	if job == nil {
+		return
+	}
+	sess.lock.Lock()
+	var (
+		channels []uint32
+		updates  = make(map[uint32]*big.Int)
+	)
+	for channel, user := range sess.channels {
+		channels = append(channels, channel)
+		if target := sess.server.hmhash.workerTarget(user, job.difficulty); sess.targets[channel] == nil || sess.targets[channel].Cmp(target) != 0 {
+			sess.targets[channel] = target
+			updates[channel] = target
+		}
+	}
+	sess.lock.Unlock()
+
+	for channel, target := range updates {
+		enc := new(hmwireEncoder)
+		enc.u32(channel)
+		enc.u256(target)
+		if err := sess.write(hmwireSetTarget, true, enc.buf); err != nil {
+			return
+		}
+	}
+	for _, channel := range channels {
+		enc := new(hmwireEncoder)
+		enc.u32(channel)
+		enc.u32(id)
+		enc.boolean(false)
+		enc.hash(common.HexToHash(job.header))
+		enc.hash(common.HexToHash(job.seed))
+		enc.u64(job.number)
+		if err := sess.write(hmwireNewMiningJob, true, enc.buf); err != nil {
+			return
+		}
+	}
+}
+
+// write sends a single framed message to the miner.
+func (sess *hmwireSession) write(msgType uint8, channel bool, payload []byte) error {
+	sess.wlock.Lock()
+	defer sess.wlock.Unlock()
+
+	sess.raw.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+	if _, err := sess.conn.Write(encodeHmwireFrame(msgType, channel, payload)); err != nil {
+		sess.log.Debug("Failed to write hmwire message", "err", err)
+		sess.raw.Close()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// hmwireTestClient is a minimal hmwire client.
+type hmwireTestClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func dialHmwire(t *testing.T, server *hmwireServer, config *tls.Config) *hmwireTestClient {
+	conn, err := tls.Dial("tcp", server.listener.Addr().String(), config)
+	if err != nil {
+		t.Fatalf("failed to dial hmwire server: %v", err)
+	}
+	return &hmwireTestClient{t: t, conn: conn}
+}
+
+// send frames and sends a single message.
+func (c *hmwireTestClient) send(msgType uint8, channel bool, enc *hmwireEncoder) {
+	if _, err := c.conn.Write(encodeHmwireFrame(msgType, channel, enc.buf)); err != nil {
+		c.t.Fatalf("failed to send message %#x: %v", msgType, err)
+	}
+}
+
+// read returns the next message sent by the server, checking its type.
+func (c *hmwireTestClient) read(msgType uint8) *hmwireDecoder {
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	frame, err := readHmwireFrame(c.conn)
+	if err != nil {
+		c.t.Fatalf("failed to read message: %v", err)
+	}
+	if frame.msgType != msgType {
+		c.t.Fatalf("message type mismatch: have %#x, want %#x", frame.msgType, msgType)
+	}
+	return &hmwireDecoder{buf: frame.payload}
+}
+
+// Tests the full hmwire flow: TLS handshake, connection setup, channel opening,
+// job notification and share submission.
+func TestHmwireServer(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, blob []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, blob, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	ca, caKey, _, _ := testCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "node", ca, caKey)
+
+	hmhash := New(Config{
+		PowMode:    ModeTest,
+		HmwireAddr: "127.0.0.1:0",
+		TLSCert:    write("node.crt", serverPEM),
+		TLSKey:     write("node.key", serverKeyPEM),
+	}, nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := dialHmwire(t, hmhash.hmwire, &tls.Config{RootCAs: roots})
+	defer client.conn.Close()
+
+	// Negotiate the protocol version, rejecting unsupported ranges
+	setup := func(min, max uint16) {
+		enc := new(hmwireEncoder)
+		enc.u8(hmwireMiningProto)
+		enc.u16(min)
+		enc.u16(max)
+		enc.u32(0)
+		enc.str("localhost")
+		client.send(hmwireSetupConnection, false, enc)
+	}
+	setup(3, 4)
+	if code := client.read(hmwireSetupConnectionError); code.u32() != 0 || code.str() != "protocol-version-mismatch" {
+		t.Fatalf("unexpected setup error")
+	}
+	setup(1, 3)
+	if version := client.read(hmwireSetupConnectionSuccess).u16(); version != hmwireVersion {
+		t.Fatalf("negotiated version mismatch: have %d, want %d", version, hmwireVersion)
+	}
+	// Open a channel before there's any work
+	enc := new(hmwireEncoder)
+	enc.u32(7)
+	enc.str("worker")
+	enc.u32(0)
+	enc.u256(new(big.Int).Sub(two256, big.NewInt(1)))
+	client.send(hmwireOpenStandardMiningChannel, false, enc)
+
+	dec := client.read(hmwireOpenStandardMiningChannelSuccess)
+	if id := dec.u32(); id != 7 {
+		t.Fatalf("request id mismatch: have %d, want 7", id)
+	}
+	channel := dec.u32()
+
+	// Push some work and ensure the job is delivered
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+	target := new(big.Int).Div(two256, header.Difficulty)
+	dec = client.read(hmwireSetTarget)
+	if dec.u32() != channel || dec.u256().Cmp(target) != 0 {
+		t.Fatalf("target update mismatch")
+	}
+	dec = client.read(hmwireNewMiningJob)
+	var (
+		_        = dec.u32()
+		jobID    = dec.u32()
+		_        = dec.boolean()
+		sealhash = dec.hash()
+		_        = dec.hash()
+		number   = dec.u64()
+	)
+	if sealhash != hmhash.SealHash(header) || number != 1 {
+		t.Fatalf("job mismatch: have %x/%d, want %x/1", sealhash, number, hmhash.SealHash(header))
+	}
+	// Submissions for unknown jobs must be rejected
+	submit := func(sequence, job uint32, nonce uint64) {
+		enc := new(hmwireEncoder)
+		enc.u32(channel)
+		enc.u32(sequence)
+		enc.u32(job)
+		enc.u64(nonce)
+		client.send(hmwireSubmitSharesStandard, true, enc)
+	}
+	submit(1, jobID+1, 0)
+	if dec := client.read(hmwireSubmitSharesError); dec.u32() != channel || dec.u32() != 1 || dec.str() != "invalid-job-id" {
+		t.Fatalf("unexpected rejection of unknown job")
+	}
+	// Search a valid nonce and submit it
+	var (
+		cache = hmhash.cache(nil, 1)
+		nonce uint64
+	)
+	for ; ; nonce++ {
+		_, result := hashimotoLight(hmhash.algo, testDatasetSize, cache.cache, sealhash.Bytes(), nonce)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			break
+		}
+	}
+	submit(2, jobID, nonce)
+	if dec := client.read(hmwireSubmitSharesSuccess); dec.u32() != channel || dec.u32() != 2 || dec.u32() != 1 {
+		t.Fatalf("unexpected share acceptance reply")
+	}
+	select {
+	case block := <-results:
+		if block.Nonce() != nonce {
+			t.Errorf("sealed nonce mismatch: have %d, want %d", block.Nonce(), nonce)
+		}
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Errorf("sealed block invalid: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("sealed block not delivered")
+	}
+}
+
+// Tests that frames are only accepted with their declared payload, and that
+// oversized ones are rejected before being read.
+func TestHmwireFraming(t *testing.T) {
+	frame := encodeHmwireFrame(hmwireSetupConnection, true, []byte{1, 2, 3})
+	if _, err := decodeHmwireFrame(frame[:len(frame)-1]); err != errHmwireBadFrame {
+		t.Errorf("truncated frame error mismatch: have %v, want %v", err, errHmwireBadFrame)
+	}
+	decoded, err := readHmwireFrame(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if decoded.msgType != hmwireSetupConnection || decoded.extension != hmwireChannelBit || !bytes.Equal(decoded.payload, []byte{1, 2, 3}) {
+		t.Errorf("frame mismatch: have %+v", decoded)
+	}
+	oversized := encodeHmwireFrame(hmwireSetupConnection, false, make([]byte, hmwireMaxPayload+1))
+	if _, err := readHmwireFrame(bytes.NewReader(oversized[:hmwireHeaderSize])); err != errHmwireBadFrame {
+		t.Errorf("oversized frame error mismatch: have %v, want %v", err, errHmwireBadFrame)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// validatorSealLength is the length of the validator signature suffixed to
+	// the extra-data of validator sealed blocks.
+	validatorSealLength = crypto.SignatureLength
+
+	// maxValidators caps the validator set read from the system contract, so a
+	// corrupt length can't stall block verification.
+	maxValidators = 1024
+)
+
+// validatorDifficulty is the difficulty of validator sealed blocks, the minimal
+// one so they don't sway the fork choice, equivocating validators included.
+var validatorDifficulty = big1
+
+var (
+	// errMissingValidatorSeal is returned if a validator sealed block's extra-data
+	// section doesn't seem to contain a 65 byte secp256k1 signature.
+	errMissingValidatorSeal = errors.New("extra-data 65 byte validator signature suffix missing")
+
+	// errValidatorPoW is returned if a validator sealed block carries a
+	// proof-of-work nonce or mix digest.
+	errValidatorPoW = errors.New("proof-of-work fields set in validator sealed block")
+
+	// errUnauthorizedValidator is returned if a block is sealed by an address not
+	// in the validator set.
+	errUnauthorizedValidator = errors.New("unauthorized validator")
+
+	// errTooManyValidators is returned if the validator set of the system
+	// contract is larger than supported.
+	errTooManyValidators = errors.New("validator set too large")
+
+	// errNotValidator is returned when sealing a validator block without having
+	// been authorized.
+	errNotValidator = errors.New("not authorized to seal validator blocks")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
+
+// hybridSigner is the validator account sealing validator blocks.
+type hybridSigner struct {
+	address common.Address
+	signFn  SignerFn
+}
+
+// Authorize injects a validator key into the consensus engine to seal the
+// validator blocks of hybrid chains with.
+func (hmhash *Hmhash) Authorize(validator common.Address, signFn SignerFn) {
+	hmhash.lock.Lock()
+	defer hmhash.lock.Unlock()
+
+	hmhash.signer = &hybridSigner{address: validator, signFn: signFn}
+}
+
+// HybridRLP returns the rlp bytes which need to be signed by a validator to seal
+// a block. The validator signature is not part of it, so the extra-data of the
+// header needs to hold it already.
+func HybridRLP(header *types.Header) []byte {
+	cpy := types.CopyHeader(header)
+	cpy.Extra = cpy.Extra[:len(cpy.Extra)-validatorSealLength]
+
+	b := new(bytes.Buffer)
+	encodeSealHeader(b, cpy)
+	return b.Bytes()
+}
+
+// validatorOf recovers the validator which sealed a block.
+func validatorOf(header *types.Header) (common.Address, error) {
+	if len(header.Extra) < validatorSealLength {
+		return common.Address{}, errMissingValidatorSeal
+	}
+	signature := header.Extra[len(header.Extra)-validatorSealLength:]
+
+	pubkey, err := crypto.Ecrecover(crypto.Keccak256(HybridRLP(header)), signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var validator common.Address
+	copy(validator[:], crypto.Keccak256(pubkey[1:])[12:])
+	return validator, nil
+}
+
+// verifyValidatorSeal checks whether a validator sealed block carries a valid
+// signature of one of the signers of the chain config instead of a proof-of-work.
+// Whether the validator is part of the validator set of the system contract is
+// only known with the state, see VerifyState.
+func (hmhash *Hmhash) verifyValidatorSeal(config *params.EthashConfig, header *types.Header) error {
+	if header.Nonce != (types.BlockNonce{}) || header.MixDigest != (common.Hash{}) {
+		return errValidatorPoW
+	}
+	signer, err := validatorOf(header)
+	if err != nil {
+		return err
+	}
+	if !config.Hybrid.IsSigner(signer) {
+		return errUnauthorizedValidator
+	}
+	return nil
+}
+
+// validatorParent returns the parent a proof-of-work block following validator
+// sealed blocks adjusts its difficulty from: the parent with the difficulty of
+// the last proof-of-work block, and its timestamp moved so the block time is the
+// average one since that block. It returns the parent itself if it isn't a
+// validator block, or the last proof-of-work block is unknown.
+func validatorParent(chain headerReader, config *params.ChainConfig, time uint64, parent *types.Header) *types.Header {
+	if chain == nil || !config.Ethash.IsValidatorBlock(parent.Number) {
+		return parent
+	}
+	prev, span := parent, uint64(1)
+	for config.Ethash.IsValidatorBlock(prev.Number) {
+		if prev.Number.Sign() == 0 {
+			return parent
+		}
+		if prev = chain.GetHeader(prev.ParentHash, prev.Number.Uint64()-1); prev == nil {
+			return parent
+		}
+		span++
+	}
+	if time <= prev.Time {
+		return parent
+	}
+	synthetic := types.CopyHeader(parent)
+	synthetic.Difficulty = new(big.Int).Set(prev.Difficulty)
+	synthetic.Time = time - (time-prev.Time)/span
+	return synthetic
+}
+
+// VerifyState implements consensus.StateVerifier, checking that validator sealed
+// blocks are signed by a member of the validator set of the parent state.
+func (hmhash *Hmhash) VerifyState(chain consensus.ChainHeaderReader, header *types.Header, parent *state.StateDB) error {
+	config := chain.Config().Ethash
+	if !config.IsValidatorBlock(header.Number) || config.Hybrid.Validators == (common.Address{}) {
+		return nil
+	}
+	signer, err := validatorOf(header)
+	if err != nil {
+		return err
+	}
+	validators, err := readValidators(parent, config.Hybrid.Validators)
+	if err != nil {
+		return err
+	}
+	for _, validator := range validators {
+		if validator == signer {
+			return nil
+		}
+	}
+	return errUnauthorizedValidator
+}
+
+// readValidators reads the validator set from the system contract, which keeps
+// it in an address array at the first storage slot.
+func readValidators(statedb *state.StateDB, contract common.Address) ([]common.Address, error) {
+	length := statedb.GetState(contract, common.Hash{}).Big()
+	if length.Cmp(big.NewInt(maxValidators)) > 0 {
+		return nil, errTooManyValidators
+	}
+	var (
+		slot       = crypto.Keccak256Hash(common.Hash{}.Bytes()).Big()
+		validators = make([]common.Address, length.Uint64())
+	)
+	for i := range validators {
+		validators[i] = common.BytesToAddress(statedb.GetState(contract, common.BigToHash(slot)).Bytes())
+		slot.Add(slot, big1)
+	}
+	return validators, nil
+}
+
+// sealValidator signs a validator block with the authorized validator key.
+func (hmhash *Hmhash) sealValidator(block *types.Block) (*types.Block, error) {
+	hmhash.lock.Lock()
+	signer := hmhash.signer
+	hmhash.lock.Unlock()
+
+	if signer == nil {
+		return nil, errNotValidator
+	}
+	header := block.Header()
+	header.Nonce, header.MixDigest = types.BlockNonce{}, common.Hash{}
+	if len(header.Extra) < validatorSealLength {
+		return nil, errMissingValidatorSeal
+	}
+	sighash, err := signer.signFn(accounts.Account{Address: signer.address}, accounts.MimetypeHmhash, HybridRLP(header))
+	if err != nil {
+		return nil, err
+	}
+	copy(header.Extra[len(header.Extra)-validatorSealLength:], sighash)
+	return block.WithSeal(header), nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// keySigner returns a signer function sealing with the given key.
+func keySigner(key *ecdsa.PrivateKey) SignerFn {
+	return func(signer accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	}
+}
+
+// Tests that validator blocks of hybrid chains are sealed by signature and that
+// the signers of the chain config and the validator set of the system contract
+// are enforced.
+func TestHybridSeal(t *testing.T) {
+	var (
+		contract     = common.HexToAddress("0xdeadbeef")
+		validator, _ = crypto.GenerateKey()
+		outsider, _  = crypto.GenerateKey()
+	)
+	config := &params.ChainConfig{
+		ChainID: big.NewInt(1),
+		Ethash: &params.EthashConfig{Hybrid: &params.HybridConfig{
+			Block:      big.NewInt(10),
+			Period:     2,
+			Signers:    []common.Address{crypto.PubkeyToAddress(validator.PublicKey)},
+			Validators: contract,
+		}},
+	}
+	for number, want := range map[int64]bool{8: false, 9: false, 10: true, 11: false, 12: true} {
+		if have := config.Ethash.IsValidatorBlock(big.NewInt(number)); have != want {
+			t.Errorf("block %d: validator block mismatch: have %v, want %v", number, have, want)
+		}
+	}
+	parent := &types.Header{Number: big.NewInt(9), Difficulty: big.NewInt(131072), GasLimit: 5000, UncleHash: types.EmptyUncleHash}
+	chain := &testHeaderChain{config: config, headers: map[common.Hash]*types.Header{parent.Hash(): parent}}
+
+	// Seal a validator block with an unauthorized and an authorized engine
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(10), Time: 15, GasLimit: 5000, Extra: []byte("vanity")}
+	if err := hmhash.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if len(header.Extra) != len("vanity")+validatorSealLength {
+		t.Fatalf("validator seal not reserved: extra length %d", len(header.Extra))
+	}
+	if header.Difficulty.Cmp(validatorDifficulty) != 0 {
+		t.Fatalf("validator block difficulty mismatch: have %v, want %v", header.Difficulty, validatorDifficulty)
+	}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != errNotValidator {
+		t.Fatalf("unauthorized seal error mismatch: have %v, want %v", err, errNotValidator)
+	}
+	hmhash.Authorize(crypto.PubkeyToAddress(validator.PublicKey), keySigner(validator))
+	if err := hmhash.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal validator block: %v", err)
+	}
+	sealed := (<-results).Header()
+	if err := hmhash.VerifyHeader(chain, sealed, true); err != nil {
+		t.Fatalf("failed to verify validator block: %v", err)
+	}
+	if signer, err := validatorOf(sealed); err != nil || signer != crypto.PubkeyToAddress(validator.PublicKey) {
+		t.Fatalf("validator mismatch: have %x (%v), want %x", signer, err, crypto.PubkeyToAddress(validator.PublicKey))
+	}
+	// Validator blocks must not carry proof-of-work fields nor be tampered with
+	mined := types.CopyHeader(sealed)
+	mined.Nonce = types.EncodeNonce(1)
+	if err := hmhash.verifyValidatorSeal(config.Ethash, mined); err != errValidatorPoW {
+		t.Errorf("proof-of-work fields error mismatch: have %v, want %v", err, errValidatorPoW)
+	}
+	unsigned := types.CopyHeader(sealed)
+	unsigned.Extra = unsigned.Extra[:len("vanity")]
+	if err := hmhash.verifyValidatorSeal(config.Ethash, unsigned); err != errMissingValidatorSeal {
+		t.Errorf("missing signature error mismatch: have %v, want %v", err, errMissingValidatorSeal)
+	}
+	// Keys outside the signers of the chain config are rejected with the header
+	// alone
+	outsiderEngine := NewTester(nil, false)
+	defer outsiderEngine.Close()
+
+	outsiderEngine.Authorize(crypto.PubkeyToAddress(outsider.PublicKey), keySigner(outsider))
+	if err := outsiderEngine.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal outsider block: %v", err)
+	}
+	if err := hmhash.VerifyHeader(chain, (<-results).Header(), true); err != errUnauthorizedValidator {
+		t.Errorf("outsider error mismatch: have %v, want %v", err, errUnauthorizedValidator)
+	}
+	// The proof-of-work block after a validator block adjusts from the last
+	// proof-of-work block
+	chain.headers[sealed.Hash()] = sealed
+	if have, want := hmhash.CalcDifficulty(chain, sealed.Time+15, sealed), CalcDifficulty(config, sealed.Time+15, &types.Header{Number: sealed.Number, Difficulty: parent.Difficulty, Time: sealed.Time, UncleHash: types.EmptyUncleHash}); have.Cmp(want) != 0 {
+		t.Errorf("difficulty after validator block mismatch: have %v, want %v", have, want)
+	}
+	// The signer must be part of the validator set in the parent state
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err := hmhash.VerifyState(chain, sealed, statedb); err != errUnauthorizedValidator {
+		t.Errorf("empty validator set error mismatch: have %v, want %v", err, errUnauthorizedValidator)
+	}
+	slot := crypto.Keccak256Hash(common.Hash{}.Bytes())
+	statedb.SetState(contract, common.Hash{}, common.BigToHash(big.NewInt(2)))
+	statedb.SetState(contract, slot, common.BytesToHash(crypto.PubkeyToAddress(outsider.PublicKey).Bytes()))
+	statedb.SetState(contract, common.BigToHash(new(big.Int).Add(slot.Big(), big1)), common.BytesToHash(crypto.PubkeyToAddress(validator.PublicKey).Bytes()))
+
+	if err := hmhash.VerifyState(chain, sealed, statedb); err != nil {
+		t.Errorf("failed to verify validator against the validator set: %v", err)
+	}
+	statedb.SetState(contract, common.Hash{}, common.BigToHash(big.NewInt(1)))
+	if err := hmhash.VerifyState(chain, sealed, statedb); err != errUnauthorizedValidator {
+		t.Errorf("removed validator error mismatch: have %v, want %v", err, errUnauthorizedValidator)
+	}
+	// Proof-of-work blocks are not subject to the validator set
+	if err := hmhash.VerifyState(chain, &types.Header{Number: big.NewInt(11)}, statedb); err != nil {
+		t.Errorf("proof-of-work block rejected by the validator set: %v", err)
+	}
+}
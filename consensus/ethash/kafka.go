@@ -0,0 +1,513 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// defaultKafkaTopic is the topic the mining events are produced to if the
+	// config leaves it unset.
+	defaultKafkaTopic = "hmhash-events"
+
+	kafkaClientID    = "hmhash"
+	kafkaTimeout     = 10 * time.Second // Timeout of the connections and broker replies
+	kafkaFlushPeriod = time.Second      // Interval the queued events are produced in
+	kafkaMaxBatch    = 500              // Events produced with a single request
+	kafkaMaxQueue    = 10000            // Events queued while the brokers are unreachable
+	kafkaMaxResponse = 1 << 20          // Size limit of the responses read from the brokers
+)
+
+// Kafka APIs and versions spoken by the producer, the oldest ones still
+// supported by current brokers.
+const (
+	kafkaProduceAPI      = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadataAPI     = 3
+	kafkaMetadataVersion = 4
+)
+
+var (
+	kafkaProducedMeter = metrics.NewRegisteredMeter("hmhash/events/kafka/produced", nil)
+	kafkaDroppedMeter  = metrics.NewRegisteredMeter("hmhash/events/kafka/dropped", nil)
+)
+
+var (
+	errKafkaNoBroker = errors.New("no kafka broker configured")
+	errKafkaResponse = errors.New("malformed kafka response")
+)
+
+// crc32c is the CRC table of the record batch checksums.
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaEvent is the JSON encoded value of the Kafka messages, keyed by the type
+// of the mining event.
+type kafkaEvent struct {
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	Event interface{} `json:"event"`
+}
+
+// kafkaMessage is a mining event queued for production.
+type kafkaMessage struct {
+	key   []byte
+	value []byte
+	time  time.Time
+}
+
+// kafkaSink streams the mining events to the first partition of a Kafka topic,
+// keeping them ordered. Events are queued while the brokers are unreachable,
+// dropping the oldest ones if too many accumulate, as the telemetry must never
+// stall sealing.
+type kafkaSink struct {
+	hmhash  *Hmhash
+	brokers []string // Bootstrap brokers to look up the partition leader with
+	topic   string
+
+	conn   net.Conn // Connection to the leader of the partition, nil if not connected
+	corrID int32    // Correlation ID of the last request
+
+	quit chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// startKafkaSink subscribes to the mining events of the engine and starts
+// producing them to a Kafka topic.
+func startKafkaSink(hmhash *Hmhash, brokers []string, topic string) *kafkaSink {
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	s := &kafkaSink{
+		hmhash:  hmhash,
+		brokers: brokers,
+		topic:   topic,
+		quit:    make(chan struct{}),
+	}
+	var (
+		work   = make(chan WorkPackageIssued, 16)
+		found  = make(chan SolutionFound, 16)
+		reject = make(chan SolutionRejected, 16)
+		epochs = make(chan EpochTransition, 16)
+		rates  = make(chan HashrateSample, 16)
+		subs   = []event.Subscription{
+			hmhash.SubscribeWorkPackageIssued(work),
+			hmhash.SubscribeSolutionFound(found),
+			hmhash.SubscribeSolutionRejected(reject),
+			hmhash.SubscribeEpochTransition(epochs),
+			hmhash.SubscribeHashrateSample(rates),
+		}
+	)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			for _, sub := range subs {
+				sub.Unsubscribe()
+			}
+		}()
+		var (
+			queue   []kafkaMessage
+			busy    bool
+			batches = make(chan []kafkaMessage)
+			failed  = make(chan []kafkaMessage)
+			flush   = time.NewTicker(kafkaFlushPeriod)
+		)
+		defer flush.Stop()
+
+		go func() {
+			for batch := range batches {
+				if err := s.produce(batch); err != nil {
+					hmhash.config.Log.Warn("Failed to produce mining events to kafka", "topic", s.topic, "events", len(batch), "err", err)
+				} else {
+					batch = nil
+				}
+				failed <- batch
+			}
+		}()
+		defer close(batches)
+
+		for {
+			var (
+				kind string
+				ev   interface{}
+			)
+			select {
+			case e := <-work:
+				kind, ev = "work", e
+			case e := <-found:
+				kind, ev = "solution", e
+			case e := <-reject:
+				kind, ev = "rejection", e
+			case e := <-epochs:
+				kind, ev = "epoch", e
+			case e := <-rates:
+				kind, ev = "hashrate", e
+
+			case <-flush.C:
+				if !busy && len(queue) > 0 {
+					n := len(queue)
+					if n > kafkaMaxBatch {
+						n = kafkaMaxBatch
+					}
+					batches <- queue[:n]
+					queue, busy = queue[n:], true
+				}
+				continue
+
+			case batch := <-failed:
+				queue, busy = s.requeue(batch, queue), false
+				continue
+
+			case <-s.quit:
+				// Try producing the queued events once more before exiting
+				if busy {
+					queue = s.requeue(<-failed, queue)
+				}
+				if len(queue) > 0 {
+					if err := s.produce(queue); err != nil {
+						kafkaDroppedMeter.Mark(int64(len(queue)))
+						hmhash.config.Log.Warn("Dropped mining events pending for kafka", "topic", s.topic, "events", len(queue), "err", err)
+					}
+				}
+				if s.conn != nil {
+					s.conn.Close()
+				}
+				return
+			}
+			now := time.Now()
+			value, _ := json.Marshal(kafkaEvent{Type: kind, Time: now, Event: ev})
+			queue = s.requeue(nil, append(queue, kafkaMessage{key: []byte(kind), value: value, time: now}))
+		}
+	}()
+	hmhash.config.Log.Info("Streaming mining events to kafka", "brokers", brokers, "topic", topic)
+	return s
+}
+
+// close stops streaming the mining events, waiting for the queued ones to be
+// produced.
+func (s *kafkaSink) close() {
+	s.once.Do(func() {
+		close(s.quit)
+		s.wg.Wait()
+	})
+}
+
+// requeue prepends the messages of a failed batch to the queue, dropping the
+// oldest messages beyond the queue limit.
+func (s *kafkaSink) requeue(failed []kafkaMessage, queue []kafkaMessage) []kafkaMessage {
+	if len(failed) > 0 {
+		queue = append(failed[:len(failed):len(failed)], queue...)
+	}
+	if drop := len(queue) - kafkaMaxQueue; drop > 0 {
+		kafkaDroppedMeter.Mark(int64(drop))
+		queue = queue[drop:]
+	}
+	return queue
+}
+
+// produce sends a batch of messages to the leader of the partition, waiting for
+// it to acknowledge them.
+func (s *kafkaSink) produce(batch []kafkaMessage) error {
+	for len(batch) > 0 {
+		n := len(batch)
+		if n > kafkaMaxBatch {
+			n = kafkaMaxBatch
+		}
+		if err := s.produceBatch(batch[:n]); err != nil {
+			if s.conn != nil {
+				s.conn.Close()
+				s.conn = nil
+			}
+			return err
+		}
+		kafkaProducedMeter.Mark(int64(n))
+		batch = batch[n:]
+	}
+	return nil
+}
+
+// produceBatch sends a single produce request.
+func (s *kafkaSink) produceBatch(batch []kafkaMessage) error {
+	conn, err := s.leader()
+	if err != nil {
+		return err
+	}
+	records := kafkaRecordBatch(batch)
+
+	req := binary.BigEndian.AppendUint16(nil, 0xffff) // No transactional ID
+	req = binary.BigEndian.AppendUint16(req, 1)       // Acknowledged by the leader
+	req = binary.BigEndian.AppendUint32(req, uint32(kafkaTimeout/time.Millisecond))
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = appendKafkaString(req, s.topic)
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = binary.BigEndian.AppendUint32(req, 0) // Partition
+	req = binary.BigEndian.AppendUint32(req, uint32(len(records)))
+	req = append(req, records...)
+
+	res, err := s.roundTrip(conn, kafkaProduceAPI, kafkaProduceVersion, req)
+	if err != nil {
+		return err
+	}
+	for topics := res.uint32(); topics > 0 && res.err == nil; topics-- {
+		res.string()
+		for partitions := res.uint32(); partitions > 0 && res.err == nil; partitions-- {
+			res.uint32() // Partition
+			if code := int16(res.uint16()); code != 0 && res.err == nil {
+				return fmt.Errorf("kafka produce error code %d", code)
+			}
+			res.uint64() // Base offset
+			res.uint64() // Log append time
+		}
+	}
+	return res.err
+}
+
+// leader returns the connection to the leader of the partition, looking it up
+// with the bootstrap brokers if not connected.
+func (s *kafkaSink) leader() (net.Conn, error) {
+	if s.conn != nil {
+		return s.conn, nil
+	}
+	err := errKafkaNoBroker
+	for _, broker := range s.brokers {
+		conn, derr := net.DialTimeout("tcp", broker, kafkaTimeout)
+		if derr != nil {
+			err = derr
+			continue
+		}
+		addr, merr := s.metadata(conn)
+		if merr != nil {
+			conn.Close()
+			err = merr
+			continue
+		}
+		if addr != broker {
+			conn.Close()
+			if conn, err = net.DialTimeout("tcp", addr, kafkaTimeout); err != nil {
+				continue
+			}
+		}
+		s.conn = conn
+		return conn, nil
+	}
+	return nil, err
+}
+
+// metadata fetches the address of the leader of the partition from a broker.
+func (s *kafkaSink) metadata(conn net.Conn) (string, error) {
+	req := binary.BigEndian.AppendUint32(nil, 1)
+	req = appendKafkaString(req, s.topic)
+	req = append(req, 1) // Allow auto topic creation
+
+	res, err := s.roundTrip(conn, kafkaMetadataAPI, kafkaMetadataVersion, req)
+	if err != nil {
+		return "", err
+	}
+	res.uint32() // Throttle time
+
+	brokers := make(map[int32]string)
+	for n := res.uint32(); n > 0 && res.err == nil; n-- {
+		id := int32(res.uint32())
+		host := res.string()
+		port := res.uint32()
+		res.string() // Rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	res.string() // Cluster ID
+	res.uint32() // Controller ID
+
+	for topics := res.uint32(); topics > 0 && res.err == nil; topics-- {
+		code := int16(res.uint16())
+		name := res.string()
+		res.bytes(1) // Internal flag
+		for partitions := res.uint32(); partitions > 0 && res.err == nil; partitions-- {
+			pcode := int16(res.uint16())
+			index := res.uint32()
+			leader := int32(res.uint32())
+			res.bytes(4 * int(res.uint32())) // Replicas
+			res.bytes(4 * int(res.uint32())) // In-sync replicas
+
+			if name != s.topic || index != 0 || res.err != nil {
+				continue
+			}
+			if code == 0 {
+				code = pcode
+			}
+			if code != 0 {
+				return "", fmt.Errorf("kafka metadata error code %d", code)
+			}
+			if addr, ok := brokers[leader]; ok {
+				return addr, nil
+			}
+			return "", fmt.Errorf("unknown kafka partition leader %d", leader)
+		}
+		if name == s.topic && code != 0 && res.err == nil {
+			return "", fmt.Errorf("kafka metadata error code %d", code)
+		}
+	}
+	if res.err != nil {
+		return "", res.err
+	}
+	return "", fmt.Errorf("kafka topic %q has no partition 0", s.topic)
+}
+
+// roundTrip sends a request to a broker and reads its response.
+func (s *kafkaSink) roundTrip(conn net.Conn, api, version uint16, body []byte) (*kafkaReader, error) {
+	s.corrID++
+
+	req := make([]byte, 4, 4+14+len(kafkaClientID)+len(body))
+	req = binary.BigEndian.AppendUint16(req, api)
+	req = binary.BigEndian.AppendUint16(req, version)
+	req = binary.BigEndian.AppendUint32(req, uint32(s.corrID))
+	req = appendKafkaString(req, kafkaClientID)
+	req = append(req, body...)
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+
+	conn.SetDeadline(time.Now().Add(kafkaTimeout))
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponse {
+		return nil, fmt.Errorf("%w: %d bytes long", errKafkaResponse, n)
+	}
+	res := make([]byte, n)
+	if _, err := io.ReadFull(conn, res); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(res)); id != s.corrID {
+		return nil, fmt.Errorf("%w: correlation ID %d, want %d", errKafkaResponse, id, s.corrID)
+	}
+	return &kafkaReader{buf: res[4:]}, nil
+}
+
+// kafkaRecordBatch encodes messages into a v2 record batch.
+func kafkaRecordBatch(msgs []kafkaMessage) []byte {
+	var (
+		first = msgs[0].time.UnixMilli()
+		last  = first
+		recs  []byte
+	)
+	for i, msg := range msgs {
+		ts := msg.time.UnixMilli()
+		if ts > last {
+			last = ts
+		}
+		rec := []byte{0} // Attributes
+		rec = binary.AppendVarint(rec, ts-first)
+		rec = binary.AppendVarint(rec, int64(i))
+		rec = binary.AppendVarint(rec, int64(len(msg.key)))
+		rec = append(rec, msg.key...)
+		rec = binary.AppendVarint(rec, int64(len(msg.value)))
+		rec = append(rec, msg.value...)
+		rec = binary.AppendVarint(rec, 0) // Headers
+
+		recs = binary.AppendVarint(recs, int64(len(rec)))
+		recs = append(recs, rec...)
+	}
+	// Assemble the fields covered by the checksum
+	body := binary.BigEndian.AppendUint16(nil, 0) // Attributes
+	body = binary.BigEndian.AppendUint32(body, uint32(len(msgs)-1))
+	body = binary.BigEndian.AppendUint64(body, uint64(first))
+	body = binary.BigEndian.AppendUint64(body, uint64(last))
+	body = binary.BigEndian.AppendUint64(body, ^uint64(0)) // No producer ID
+	body = binary.BigEndian.AppendUint16(body, 0xffff)     // No producer epoch
+	body = binary.BigEndian.AppendUint32(body, 0xffffffff) // No base sequence
+	body = binary.BigEndian.AppendUint32(body, uint32(len(msgs)))
+	body = append(body, recs...)
+
+	batch := binary.BigEndian.AppendUint64(nil, 0) // Base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(body)))
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff) // Partition leader epoch
+	batch = append(batch, 2)                                 // Magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, crc32c))
+	return append(batch, body...)
+}
+
+// appendKafkaString appends a length prefixed string.
+func appendKafkaString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// kafkaReader decodes the fields of a Kafka response, recording the first
+// decoding error and returning zero values afterwards.
+type kafkaReader struct {
+	buf []byte
+	err error
+}
+
+func (r *kafkaReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = fmt.Errorf("%w: truncated", errKafkaResponse)
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *kafkaReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *kafkaReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *kafkaReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// string decodes a nullable string, null decoding as empty.
+func (r *kafkaReader) string() string {
+	n := int16(r.uint16())
+	if n < 0 {
+		return ""
+	}
+	return string(r.bytes(int(n)))
+}
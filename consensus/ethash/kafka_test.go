@@ -0,0 +1,207 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// kafkaTestBroker is a single node Kafka broker serving metadata and accepting
+// produced record batches.
+type kafkaTestBroker struct {
+	t        *testing.T
+	listener net.Listener
+	records  chan [2]string // Keys and values of the produced records
+}
+
+func newKafkaTestBroker(t *testing.T) *kafkaTestBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	b := &kafkaTestBroker{t: t, listener: listener, records: make(chan [2]string, 16)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *kafkaTestBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		r := &kafkaReader{buf: req}
+		api, version, corrID := r.uint16(), r.uint16(), r.uint32()
+		if client := r.string(); client != kafkaClientID {
+			b.t.Errorf("client ID mismatch: have %q, want %q", client, kafkaClientID)
+		}
+		var res []byte
+		switch {
+		case api == kafkaMetadataAPI && version == kafkaMetadataVersion:
+			res = b.metadata()
+		case api == kafkaProduceAPI && version == kafkaProduceVersion:
+			res = b.produce(r)
+		default:
+			b.t.Errorf("unexpected request: api %d, version %d", api, version)
+			return
+		}
+		res = append(binary.BigEndian.AppendUint32(nil, corrID), res...)
+		conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(res))), res...))
+	}
+}
+
+// metadata returns a metadata response naming the broker as the leader of the
+// only partition of every topic.
+func (b *kafkaTestBroker) metadata() []byte {
+	host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+	portnum, _ := strconv.Atoi(port)
+
+	res := binary.BigEndian.AppendUint32(nil, 0) // Throttle time
+	res = binary.BigEndian.AppendUint32(res, 1)
+	res = binary.BigEndian.AppendUint32(res, 7) // Node ID
+	res = appendKafkaString(res, host)
+	res = binary.BigEndian.AppendUint32(res, uint32(portnum))
+	res = binary.BigEndian.AppendUint16(res, 0xffff) // Rack
+	res = appendKafkaString(res, "cluster")
+	res = binary.BigEndian.AppendUint32(res, 7) // Controller ID
+	res = binary.BigEndian.AppendUint32(res, 1)
+	res = binary.BigEndian.AppendUint16(res, 0)
+	res = appendKafkaString(res, "farm-events")
+	res = append(res, 0)
+	res = binary.BigEndian.AppendUint32(res, 1)
+	res = binary.BigEndian.AppendUint16(res, 0)
+	res = binary.BigEndian.AppendUint32(res, 0) // Partition
+	res = binary.BigEndian.AppendUint32(res, 7) // Leader
+	res = binary.BigEndian.AppendUint32(res, 1)
+	res = binary.BigEndian.AppendUint32(res, 7)
+	res = binary.BigEndian.AppendUint32(res, 1)
+	return binary.BigEndian.AppendUint32(res, 7)
+}
+
+// produce decodes the record batch of a produce request and acknowledges it.
+func (b *kafkaTestBroker) produce(r *kafkaReader) []byte {
+	r.uint16() // Transactional ID
+	if acks := r.uint16(); acks != 1 {
+		b.t.Errorf("acks mismatch: have %d, want 1", acks)
+	}
+	r.uint32() // Timeout
+	r.uint32() // Topics
+	topic := r.string()
+	r.uint32() // Partitions
+	r.uint32() // Partition
+	batch := &kafkaReader{buf: r.bytes(int(r.uint32()))}
+
+	batch.uint64() // Base offset
+	batch.uint32() // Batch length
+	batch.uint32() // Partition leader epoch
+	if magic := batch.bytes(1); magic == nil || magic[0] != 2 {
+		b.t.Errorf("record batch magic mismatch: %v", magic)
+	}
+	crc := batch.uint32()
+	if have := crc32.Checksum(batch.buf, crc32c); have != crc {
+		b.t.Errorf("record batch checksum mismatch: have %x, want %x", have, crc)
+	}
+	batch.bytes(2 + 4 + 8 + 8 + 8 + 2 + 4) // Attributes up to the base sequence
+	count := batch.uint32()
+	if batch.err != nil {
+		b.t.Errorf("malformed record batch: %v", batch.err)
+	}
+	recs := batch.buf
+	for i := uint32(0); i < count; i++ {
+		size, n := binary.Varint(recs)
+		rec := recs[n : n+int(size)]
+		recs = recs[n+int(size):]
+
+		rec = rec[1:] // Attributes
+		for j := 0; j < 2; j++ {
+			_, n = binary.Varint(rec) // Timestamp and offset deltas
+			rec = rec[n:]
+		}
+		var kv [2]string
+		for j := range kv {
+			size, n := binary.Varint(rec)
+			kv[j] = string(rec[n : n+int(size)])
+			rec = rec[n+int(size):]
+		}
+		b.records <- kv
+	}
+	res := binary.BigEndian.AppendUint32(nil, 1)
+	res = appendKafkaString(res, topic)
+	res = binary.BigEndian.AppendUint32(res, 1)
+	res = binary.BigEndian.AppendUint32(res, 0)
+	res = binary.BigEndian.AppendUint16(res, 0)
+	res = binary.BigEndian.AppendUint64(res, 0)
+	res = binary.BigEndian.AppendUint64(res, ^uint64(0))
+	return binary.BigEndian.AppendUint32(res, 0)
+}
+
+// Tests that mining events are produced to the configured Kafka topic.
+func TestKafkaSink(t *testing.T) {
+	broker := newKafkaTestBroker(t)
+	defer broker.listener.Close()
+
+	hmhash := New(Config{PowMode: ModeTest, KafkaBrokers: []string{broker.listener.Addr().String()}, KafkaTopic: "farm-events"}, nil, false)
+	defer hmhash.Close()
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), nil, nil)
+
+	for {
+		select {
+		case kv := <-broker.records:
+			if kv[0] != "work" {
+				continue
+			}
+			var ev struct {
+				Type  string
+				Event WorkPackageIssued
+			}
+			if err := json.Unmarshal([]byte(kv[1]), &ev); err != nil {
+				t.Fatalf("failed to decode event %q: %v", kv[1], err)
+			}
+			if ev.Type != "work" || ev.Event.SealHash != hmhash.SealHash(header) || ev.Event.Number != 1 {
+				t.Errorf("work event mismatch: %+v", ev)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatalf("work event not produced")
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import "encoding/binary"
+
+// Rates of the legacy Keccak sponges, the number of bytes absorbed per
+// permutation.
+const (
+	keccak256Rate = 136
+	keccak512Rate = 72
+)
+
+// sumKeccak computes the legacy Keccak digest of the concatenated data into dst,
+// sized 32 or 64 bytes with the matching rate. The data must fit into a single
+// rate block, as the hashimoto seed and result do, which spares the buffering
+// and allocations of the sha3 package in the mining hot loop. The permutation
+// itself is the generic one of the sha3 package, see keccakf.go.
+func sumKeccak(dst []byte, rate int, data ...[]byte) {
+	var block [keccak256Rate]byte
+
+	n := 0
+	for _, d := range data {
+		n += copy(block[n:rate-1], d)
+	}
+	block[n] ^= 0x01
+	block[rate-1] ^= 0x80
+
+	var state [25]uint64
+	for i := 0; i < rate/8; i++ {
+		state[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+	keccakF1600(&state)
+
+	for i := 0; i < len(dst)/8; i++ {
+		binary.LittleEndian.PutUint64(dst[i*8:], state[i])
+	}
+}
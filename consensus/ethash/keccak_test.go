@@ -0,0 +1,71 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"hash"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Tests that the single block Keccak matches the sha3 package for all input
+// lengths fitting into a block.
+func TestSumKeccak(t *testing.T) {
+	tests := []struct {
+		rate   int
+		size   int
+		hasher func() hash.Hash
+	}{
+		{keccak256Rate, 32, sha3.NewLegacyKeccak256},
+		{keccak512Rate, 64, sha3.NewLegacyKeccak512},
+	}
+	for _, tt := range tests {
+		for n := 0; n < tt.rate; n++ {
+			data := make([]byte, n)
+			rand.Read(data)
+
+			h := tt.hasher()
+			h.Write(data)
+			want := h.Sum(nil)
+
+			have := make([]byte, tt.size)
+			sumKeccak(have, tt.rate, data[:n/2], data[n/2:])
+			if !bytes.Equal(have, want) {
+				t.Errorf("rate %d, length %d: digest mismatch: have %x, want %x", tt.rate, n, have, want)
+			}
+		}
+	}
+}
+
+func BenchmarkSumKeccak512(b *testing.B) {
+	data, dst := make([]byte, 40), make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		sumKeccak(dst, keccak512Rate, data)
+	}
+}
+
+func BenchmarkLegacyKeccak512(b *testing.B) {
+	data := make([]byte, 40)
+	for i := 0; i < b.N; i++ {
+		h := sha3.NewLegacyKeccak512()
+		h.Write(data)
+		h.Sum(nil)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Subsystems of the mining logs, each with a verbosity of its own so a single
+// one can be debugged without raising the verbosity of the whole node.
+const (
+	LogSealer   = "sealer"   // Local mining and the remote sealer
+	LogVerifier = "verifier" // Seal verification
+	LogDataset  = "dataset"  // Verification cache and mining DAG generation
+)
+
+// Context keys of the mining logs, shared by all subsystems so the records of
+// an epoch, work package or remote worker can be correlated.
+const (
+	logEpoch    = "epoch"
+	logWorker   = "worker"
+	logSealHash = "sealhash"
+	logNonce    = "nonce"
+	logElapsed  = "elapsed"
+)
+
+var errUnknownLogSubsystem = errors.New("unknown log subsystem")
+
+// newSubsystemLog creates the logger of a mining subsystem, writing to the
+// handler of the parent logger. Unless the verbosity of the subsystem is set,
+// records are filtered like all others by the node's verbosity.
+func newSubsystemLog(parent log.Logger, name string, level *atomic.Int32) log.Logger {
+	logger := parent.New("subsys", name)
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		handler := parent.GetHandler()
+
+		lvl := level.Load()
+		if lvl < 0 {
+			return handler.Log(r)
+		}
+		if r.Lvl > log.Lvl(lvl) {
+			return nil
+		}
+		// Bypass the verbosity filters of the node
+		if glog, ok := handler.(*log.GlogHandler); ok {
+			handler = glog.Handler()
+		}
+		return handler.Log(r)
+	}))
+	return logger
+}
+
+// miningLogs are the loggers of the mining subsystems.
+type miningLogs struct {
+	sealer   log.Logger
+	verifier log.Logger
+	dataset  log.Logger
+
+	levels map[string]*atomic.Int32 // Verbosity of each subsystem, negative to use the node's
+}
+
+// newMiningLogs creates the loggers of the mining subsystems.
+func newMiningLogs(parent log.Logger) miningLogs {
+	levels := make(map[string]*atomic.Int32)
+	for _, name := range []string{LogSealer, LogVerifier, LogDataset} {
+		levels[name] = new(atomic.Int32)
+		levels[name].Store(-1)
+	}
+	return miningLogs{
+		sealer:   newSubsystemLog(parent, LogSealer, levels[LogSealer]),
+		verifier: newSubsystemLog(parent, LogVerifier, levels[LogVerifier]),
+		dataset:  newSubsystemLog(parent, LogDataset, levels[LogDataset]),
+		levels:   levels,
+	}
+}
+
+// SetLogVerbosity sets the verbosity of a mining subsystem's logs, overriding
+// the node's verbosity for them: 0=silent, 1=error, 2=warn, 3=info, 4=debug,
+// 5=trace. A negative verbosity reverts to the node's one.
+func (hmhash *Hmhash) SetLogVerbosity(subsystem string, level int) error {
+	if hmhash.shared != nil {
+		return hmhash.shared.SetLogVerbosity(subsystem, level)
+	}
+	current, ok := hmhash.logs.levels[subsystem]
+	if !ok {
+		return fmt.Errorf("%w: %q", errUnknownLogSubsystem, subsystem)
+	}
+	if level < 0 {
+		level = -1
+	} else if level > int(log.LvlTrace) {
+		level = int(log.LvlTrace)
+	}
+	current.Store(int32(level))
+	hmhash.config.Log.Info("Changed hmhash log verbosity", "subsys", subsystem, "level", level)
+	return nil
+}
+
+// LogVerbosity returns the verbosity of the logs of each mining subsystem, -1
+// for the ones following the node's verbosity.
+func (hmhash *Hmhash) LogVerbosity() map[string]int {
+	if hmhash.shared != nil {
+		return hmhash.shared.LogVerbosity()
+	}
+	levels := make(map[string]int)
+	for name, level := range hmhash.logs.levels {
+		levels[name] = int(level.Load())
+	}
+	return levels
+}
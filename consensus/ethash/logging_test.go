@@ -0,0 +1,80 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Tests that the verbosity of a mining subsystem overrides the node's one for
+// its records only.
+func TestSubsystemLogVerbosity(t *testing.T) {
+	var records []*log.Record
+	glog := log.NewGlogHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	glog.Verbosity(log.LvlInfo)
+
+	parent := log.New()
+	parent.SetHandler(glog)
+
+	hmhash := NewFaker()
+	hmhash.config.Log = parent
+	hmhash.logs = newMiningLogs(parent)
+
+	hmhash.logs.sealer.Debug("hidden")
+	hmhash.logs.verifier.Debug("hidden")
+	if len(records) != 0 {
+		t.Fatalf("debug records logged at node verbosity: %d", len(records))
+	}
+	if err := hmhash.SetLogVerbosity(LogSealer, int(log.LvlDebug)); err != nil {
+		t.Fatalf("failed to set verbosity: %v", err)
+	}
+	records = nil
+	hmhash.logs.sealer.Debug("shown", logSealHash, hmhash.SealHash(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)}).Header()))
+	hmhash.logs.sealer.Trace("hidden")
+	hmhash.logs.verifier.Debug("hidden")
+	if len(records) != 1 || records[0].Msg != "shown" || records[0].Ctx[0] != "subsys" || records[0].Ctx[1] != LogSealer {
+		t.Fatalf("subsystem records mismatch: %v", records)
+	}
+	if have := hmhash.LogVerbosity(); have[LogSealer] != int(log.LvlDebug) || have[LogVerifier] != -1 || have[LogDataset] != -1 {
+		t.Errorf("verbosity mismatch: %v", have)
+	}
+	// Ensure the subsystem can be silenced and reverted to the node's verbosity
+	hmhash.SetLogVerbosity(LogSealer, 0)
+	records = nil
+	hmhash.logs.sealer.Error("hidden")
+	if len(records) != 0 {
+		t.Errorf("silenced subsystem logged: %v", records)
+	}
+	hmhash.SetLogVerbosity(LogSealer, -5)
+	records = nil
+	hmhash.logs.sealer.Info("shown")
+	hmhash.logs.sealer.Debug("hidden")
+	if len(records) != 1 {
+		t.Errorf("reverted subsystem records mismatch: %v", records)
+	}
+	if err := hmhash.SetLogVerbosity("gpu", 3); !errors.Is(err, errUnknownLogSubsystem) {
+		t.Errorf("error mismatch: have %v, want %v", err, errUnknownLogSubsystem)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// medianTimePast returns the median timestamp of the last n blocks up to and
+// including parent, or of as many as the chain has.
+func medianTimePast(chain headerReader, parent *types.Header, n uint64) uint64 {
+	window := difficultyWindow(chain, parent, n-1)
+
+	times := make([]uint64, len(window))
+	for i, header := range window {
+		times[i] = header.Time
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// makeTimedChain creates a chain of headers with the given timestamps, oldest
+// first.
+func makeTimedChain(config *params.ChainConfig, times []uint64) (*testHeaderChain, []*types.Header) {
+	chain := &testHeaderChain{config: config, headers: make(map[common.Hash]*types.Header)}
+	headers := make([]*types.Header, len(times))
+	for i, time := range times {
+		headers[i] = &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Time:       time,
+			Difficulty: big.NewInt(131072),
+			GasLimit:   params.GenesisGasLimit,
+		}
+		if i > 0 {
+			headers[i].ParentHash = headers[i-1].Hash()
+		}
+		chain.headers[headers[i].Hash()] = headers[i]
+	}
+	return chain, headers
+}
+
+func TestMedianTimePast(t *testing.T) {
+	tests := []struct {
+		times  []uint64
+		n      uint64
+		median uint64
+	}{
+		{[]uint64{7}, 11, 7},
+		{[]uint64{1, 2, 3}, 11, 2},
+		{[]uint64{1, 2, 3, 4}, 3, 3},
+		{[]uint64{10, 20, 30, 90, 80, 70, 60, 50, 40}, 5, 60},
+		{[]uint64{10, 20, 30, 90, 80, 70, 60, 50, 40}, 11, 50},
+	}
+	for i, tt := range tests {
+		chain, headers := makeTimedChain(&params.ChainConfig{}, tt.times)
+		if have := medianTimePast(chain, headers[len(headers)-1], tt.n); have != tt.median {
+			t.Errorf("test %d: median mismatch: have %d, want %d", i, have, tt.median)
+		}
+	}
+}
+
+// Tests that headers timestamped at or below the median of their ancestors are
+// rejected once the rule is active, even if past their parent.
+func TestMedianTimePastRule(t *testing.T) {
+	config := &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+	config.Ethash = &params.EthashConfig{MedianTime: &params.MedianTimeConfig{Block: big.NewInt(5), Window: 5}}
+
+	// Manipulated ancestors pushing the median ahead of the parent
+	chain, headers := makeTimedChain(config, []uint64{100, 1000, 1010, 1020, 110})
+	parent := headers[len(headers)-1]
+
+	verify := func(time uint64) error {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, big1),
+			Time:       time,
+			GasLimit:   parent.GasLimit,
+			UncleHash:  types.EmptyUncleHash,
+		}
+		header.Difficulty = CalcDifficulty(config, header.Time, parent)
+		return NewFaker().verifyHeader(context.Background(), chain, header, parent, false, false, int64(header.Time))
+	}
+	if err := verify(1000); !errors.Is(err, errMedianTimePast) {
+		t.Errorf("header at median error mismatch: have %v, want %v", err, errMedianTimePast)
+	}
+	if err := verify(1001); err != nil {
+		t.Errorf("header past median rejected: %v", err)
+	}
+	// Blocks before the activation are left alone
+	config.Ethash.MedianTime.Block = big.NewInt(6)
+	if err := verify(1000); err != nil {
+		t.Errorf("header rejected before activation: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import "github.com/ethereum/go-ethereum/metrics"
+
+// Metrics of the sealing and verification work of the engine, exported with
+// an hmhash_ prefix by the Prometheus endpoint of the metrics registry.
+var (
+	sealAttemptMeter      = metrics.NewRegisteredMeter("hmhash/seal/attempts", nil)      // Blocks handed out for sealing
+	solutionFoundMeter    = metrics.NewRegisteredMeter("hmhash/solutions/found", nil)    // Sealed blocks handed to the miner, local or remote
+	solutionAcceptedMeter = metrics.NewRegisteredMeter("hmhash/solutions/accepted", nil) // Remote solutions and shares accepted
+	solutionRejectedMeter = metrics.NewRegisteredMeter("hmhash/solutions/rejected", nil) // Remote solutions rejected
+	solutionStaleMeter    = metrics.NewRegisteredMeter("hmhash/solutions/stale", nil)    // Remote solutions to work older than the current
+	solutionUncleMeter    = metrics.NewRegisteredMeter("hmhash/solutions/uncles", nil)   // Remote solutions to outdated work handed over as uncles
+	sealVerifyTimer       = metrics.NewRegisteredTimer("hmhash/verify/seal", nil)        // Seal verifications, excluding cache hits
+	sealCacheHitMeter     = metrics.NewRegisteredMeter("hmhash/verify/cached", nil)      // Seal verifications served by the seal cache
+	cacheGenerateTimer    = metrics.NewRegisteredTimer("hmhash/cache/generate", nil)     // Verification cache generations
+	datasetGenerateTimer  = metrics.NewRegisteredTimer("hmhash/dataset/generate", nil)   // Mining dataset generations
+	remoteWorkersGauge    = metrics.NewRegisteredGauge("hmhash/remote/workers", nil)     // Remote miners reporting their hash rate
+	remoteWorksGauge      = metrics.NewRegisteredGauge("hmhash/remote/works", nil)       // Work packages pending remote solutions
+	deepReorgMeter        = metrics.NewRegisteredMeter("hmhash/reorg/refused", nil)      // Headers refused for reorganizing the chain too deep
+	competingChainMeter   = metrics.NewRegisteredMeter("hmhash/reorg/competing", nil)    // Headers of chains competing deeper than the alert depth
+	forkRuleAlertMeter    = metrics.NewRegisteredMeter("hmhash/forkrules/alerts", nil)   // Alerts raised by the fork rule monitor
+	benchmarkSealTimer    = metrics.NewRegisteredTimer("hmhash/seal/benchmark", nil)     // Proof-of-work computations of benchmark mode seals
+)
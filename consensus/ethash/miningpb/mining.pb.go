@@ -0,0 +1,597 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        (unknown)
+// source: mining.proto
+
+package miningpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetWorkRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Worker string `protobuf:"bytes,1,opt,name=worker,proto3" json:"worker,omitempty"` // Name of the worker, for its variable share difficulty
+}
+
+func (x *GetWorkRequest) Reset() {
+	*x = GetWorkRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mining_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetWorkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetWorkRequest) ProtoMessage() {}
+
+func (x *GetWorkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mining_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetWorkRequest.ProtoReflect.Descriptor instead.
+func (*GetWorkRequest) Descriptor() ([]byte, []int) {
+	return file_mining_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetWorkRequest) GetWorker() string {
+	if x != nil {
+		return x.Worker
+	}
+	return ""
+}
+
+// Work is a single work package.
+type Work struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SealHash   []byte `protobuf:"bytes,1,opt,name=seal_hash,json=sealHash,proto3" json:"seal_hash,omitempty"` // 32 byte header hash without the seal
+	SeedHash   []byte `protobuf:"bytes,2,opt,name=seed_hash,json=seedHash,proto3" json:"seed_hash,omitempty"` // 32 byte seed hash of the dataset epoch
+	Target     []byte `protobuf:"bytes,3,opt,name=target,proto3" json:"target,omitempty"`                     // 32 byte big endian boundary condition, the worker's share target if shares are tracked
+	Number     uint64 `protobuf:"varint,4,opt,name=number,proto3" json:"number,omitempty"`                    // Number of the block being sealed
+	Extranonce []byte `protobuf:"bytes,5,opt,name=extranonce,proto3" json:"extranonce,omitempty"`             // Nonce prefix reserved for the stream, empty if disabled
+}
+
+func (x *Work) Reset() {
+	*x = Work{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mining_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Work) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Work) ProtoMessage() {}
+
+func (x *Work) ProtoReflect() protoreflect.Message {
+	mi := &file_mining_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Work.ProtoReflect.Descriptor instead.
+func (*Work) Descriptor() ([]byte, []int) {
+	return file_mining_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Work) GetSealHash() []byte {
+	if x != nil {
+		return x.SealHash
+	}
+	return nil
+}
+
+func (x *Work) GetSeedHash() []byte {
+	if x != nil {
+		return x.SeedHash
+	}
+	return nil
+}
+
+func (x *Work) GetTarget() []byte {
+	if x != nil {
+		return x.Target
+	}
+	return nil
+}
+
+func (x *Work) GetNumber() uint64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Work) GetExtranonce() []byte {
+	if x != nil {
+		return x.Extranonce
+	}
+	return nil
+}
+
+type SubmitWorkRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SealHash  []byte `protobuf:"bytes,1,opt,name=seal_hash,json=sealHash,proto3" json:"seal_hash,omitempty"`    // Seal hash of the work package solved
+	Nonce     uint64 `protobuf:"varint,2,opt,name=nonce,proto3" json:"nonce,omitempty"`                         // Nonce solving the work package
+	MixDigest []byte `protobuf:"bytes,3,opt,name=mix_digest,json=mixDigest,proto3" json:"mix_digest,omitempty"` // 32 byte mix digest, computed by the node if empty
+	Worker    string `protobuf:"bytes,4,opt,name=worker,proto3" json:"worker,omitempty"`                        // Name of the worker credited with the share, if any
+}
+
+func (x *SubmitWorkRequest) Reset() {
+	*x = SubmitWorkRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mining_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitWorkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitWorkRequest) ProtoMessage() {}
+
+func (x *SubmitWorkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mining_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitWorkRequest.ProtoReflect.Descriptor instead.
+func (*SubmitWorkRequest) Descriptor() ([]byte, []int) {
+	return file_mining_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubmitWorkRequest) GetSealHash() []byte {
+	if x != nil {
+		return x.SealHash
+	}
+	return nil
+}
+
+func (x *SubmitWorkRequest) GetNonce() uint64 {
+	if x != nil {
+		return x.Nonce
+	}
+	return 0
+}
+
+func (x *SubmitWorkRequest) GetMixDigest() []byte {
+	if x != nil {
+		return x.MixDigest
+	}
+	return nil
+}
+
+func (x *SubmitWorkRequest) GetWorker() string {
+	if x != nil {
+		return x.Worker
+	}
+	return ""
+}
+
+type SubmitWorkResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Accepted bool `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"` // False for invalid, stale or unknown work
+}
+
+func (x *SubmitWorkResponse) Reset() {
+	*x = SubmitWorkResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mining_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitWorkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitWorkResponse) ProtoMessage() {}
+
+func (x *SubmitWorkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mining_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitWorkResponse.ProtoReflect.Descriptor instead.
+func (*SubmitWorkResponse) Descriptor() ([]byte, []int) {
+	return file_mining_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubmitWorkResponse) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+type SubmitHashrateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id        []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`                              // 32 byte identifier of the miner, unique across the farm
+	Rate      uint64 `protobuf:"varint,2,opt,name=rate,proto3" json:"rate,omitempty"`                         // Hashes per second
+	Signature []byte `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`                // Signature of the hashrate by the key registered for the id, if any
+	SignedAt  uint64 `protobuf:"varint,4,opt,name=signed_at,json=signedAt,proto3" json:"signed_at,omitempty"` // Unix time the signature was made at
+}
+
+func (x *SubmitHashrateRequest) Reset() {
+	*x = SubmitHashrateRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mining_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitHashrateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitHashrateRequest) ProtoMessage() {}
+
+func (x *SubmitHashrateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mining_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitHashrateRequest.ProtoReflect.Descriptor instead.
+func (*SubmitHashrateRequest) Descriptor() ([]byte, []int) {
+	return file_mining_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubmitHashrateRequest) GetId() []byte {
+	if x != nil {
+		return x.Id
+	}
+	return nil
+}
+
+func (x *SubmitHashrateRequest) GetRate() uint64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *SubmitHashrateRequest) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *SubmitHashrateRequest) GetSignedAt() uint64 {
+	if x != nil {
+		return x.SignedAt
+	}
+	return 0
+}
+
+type SubmitHashrateResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Accepted bool `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+}
+
+func (x *SubmitHashrateResponse) Reset() {
+	*x = SubmitHashrateResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mining_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitHashrateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitHashrateResponse) ProtoMessage() {}
+
+func (x *SubmitHashrateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mining_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitHashrateResponse.ProtoReflect.Descriptor instead.
+func (*SubmitHashrateResponse) Descriptor() ([]byte, []int) {
+	return file_mining_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SubmitHashrateResponse) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+var File_mining_proto protoreflect.FileDescriptor
+
+var file_mining_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x6d, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x10,
+	0x68, 0x6d, 0x68, 0x61, 0x73, 0x68, 0x2e, 0x6d, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x31,
+	0x22, 0x28, 0x0a, 0x0e, 0x47, 0x65, 0x74, 0x57, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x22, 0x90, 0x01, 0x0a, 0x04, 0x57,
+	0x6f, 0x72, 0x6b, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x65, 0x61, 0x6c, 0x5f, 0x68, 0x61, 0x73, 0x68,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x73, 0x65, 0x61, 0x6c, 0x48, 0x61, 0x73, 0x68,
+	0x12, 0x1b, 0x0a, 0x09, 0x73, 0x65, 0x65, 0x64, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x08, 0x73, 0x65, 0x65, 0x64, 0x48, 0x61, 0x73, 0x68, 0x12, 0x16, 0x0a,
+	0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x74,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x1e, 0x0a,
+	0x0a, 0x65, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x0a, 0x65, 0x78, 0x74, 0x72, 0x61, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x22, 0x7d, 0x0a,
+	0x11, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x57, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x65, 0x61, 0x6c, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x73, 0x65, 0x61, 0x6c, 0x48, 0x61, 0x73, 0x68, 0x12,
+	0x14, 0x0a, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05,
+	0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x6d, 0x69, 0x78, 0x5f, 0x64, 0x69, 0x67,
+	0x65, 0x73, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x6d, 0x69, 0x78, 0x44, 0x69,
+	0x67, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x22, 0x30, 0x0a, 0x12,
+	0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x57, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x65, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x65, 0x64, 0x22, 0x76,
+	0x0a, 0x15, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x48, 0x61, 0x73, 0x68, 0x72, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x02, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x73,
+	0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09,
+	0x73, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x69, 0x67,
+	0x6e, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x73, 0x69,
+	0x67, 0x6e, 0x65, 0x64, 0x41, 0x74, 0x22, 0x34, 0x0a, 0x16, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74,
+	0x48, 0x61, 0x73, 0x68, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x65, 0x64, 0x32, 0x8d, 0x02, 0x0a,
+	0x06, 0x4d, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x12, 0x45, 0x0a, 0x07, 0x47, 0x65, 0x74, 0x57, 0x6f,
+	0x72, 0x6b, 0x12, 0x20, 0x2e, 0x68, 0x6d, 0x68, 0x61, 0x73, 0x68, 0x2e, 0x6d, 0x69, 0x6e, 0x69,
+	0x6e, 0x67, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x57, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x68, 0x6d, 0x68, 0x61, 0x73, 0x68, 0x2e, 0x6d, 0x69,
+	0x6e, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x31, 0x2e, 0x57, 0x6f, 0x72, 0x6b, 0x30, 0x01, 0x12, 0x57,
+	0x0a, 0x0a, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x57, 0x6f, 0x72, 0x6b, 0x12, 0x23, 0x2e, 0x68,
+	0x6d, 0x68, 0x61, 0x73, 0x68, 0x2e, 0x6d, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x31, 0x2e,
+	0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x57, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x24, 0x2e, 0x68, 0x6d, 0x68, 0x61, 0x73, 0x68, 0x2e, 0x6d, 0x69, 0x6e, 0x69, 0x6e,
+	0x67, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x57, 0x6f, 0x72, 0x6b, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x63, 0x0a, 0x0e, 0x53, 0x75, 0x62, 0x6d, 0x69,
+	0x74, 0x48, 0x61, 0x73, 0x68, 0x72, 0x61, 0x74, 0x65, 0x12, 0x27, 0x2e, 0x68, 0x6d, 0x68, 0x61,
+	0x73, 0x68, 0x2e, 0x6d, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62,
+	0x6d, 0x69, 0x74, 0x48, 0x61, 0x73, 0x68, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x28, 0x2e, 0x68, 0x6d, 0x68, 0x61, 0x73, 0x68, 0x2e, 0x6d, 0x69, 0x6e, 0x69,
+	0x6e, 0x67, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x48, 0x61, 0x73, 0x68,
+	0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x3b, 0x5a, 0x39,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x65, 0x74, 0x68, 0x65, 0x72,
+	0x65, 0x75, 0x6d, 0x2f, 0x67, 0x6f, 0x2d, 0x65, 0x74, 0x68, 0x65, 0x72, 0x65, 0x75, 0x6d, 0x2f,
+	0x63, 0x6f, 0x6e, 0x73, 0x65, 0x6e, 0x73, 0x75, 0x73, 0x2f, 0x65, 0x74, 0x68, 0x61, 0x73, 0x68,
+	0x2f, 0x6d, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_mining_proto_rawDescOnce sync.Once
+	file_mining_proto_rawDescData = file_mining_proto_rawDesc
+)
+
+func file_mining_proto_rawDescGZIP() []byte {
+	file_mining_proto_rawDescOnce.Do(func() {
+		file_mining_proto_rawDescData = protoimpl.X.CompressGZIP(file_mining_proto_rawDescData)
+	})
+	return file_mining_proto_rawDescData
+}
+
+var file_mining_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_mining_proto_goTypes = []interface{}{
+	(*GetWorkRequest)(nil),         // 0: hmhash.mining.v1.GetWorkRequest
+	(*Work)(nil),                   // 1: hmhash.mining.v1.Work
+	(*SubmitWorkRequest)(nil),      // 2: hmhash.mining.v1.SubmitWorkRequest
+	(*SubmitWorkResponse)(nil),     // 3: hmhash.mining.v1.SubmitWorkResponse
+	(*SubmitHashrateRequest)(nil),  // 4: hmhash.mining.v1.SubmitHashrateRequest
+	(*SubmitHashrateResponse)(nil), // 5: hmhash.mining.v1.SubmitHashrateResponse
+}
+var file_mining_proto_depIdxs = []int32{
+	0, // 0: hmhash.mining.v1.Mining.GetWork:input_type -> hmhash.mining.v1.GetWorkRequest
+	2, // 1: hmhash.mining.v1.Mining.SubmitWork:input_type -> hmhash.mining.v1.SubmitWorkRequest
+	4, // 2: hmhash.mining.v1.Mining.SubmitHashrate:input_type -> hmhash.mining.v1.SubmitHashrateRequest
+	1, // 3: hmhash.mining.v1.Mining.GetWork:output_type -> hmhash.mining.v1.Work
+	3, // 4: hmhash.mining.v1.Mining.SubmitWork:output_type -> hmhash.mining.v1.SubmitWorkResponse
+	5, // 5: hmhash.mining.v1.Mining.SubmitHashrate:output_type -> hmhash.mining.v1.SubmitHashrateResponse
+	3, // [3:6] is the sub-list for method output_type
+	0, // [0:3] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_mining_proto_init() }
+func file_mining_proto_init() {
+	if File_mining_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_mining_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetWorkRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mining_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Work); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mining_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubmitWorkRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mining_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubmitWorkResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mining_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubmitHashrateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mining_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubmitHashrateResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_mining_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_mining_proto_goTypes,
+		DependencyIndexes: file_mining_proto_depIdxs,
+		MessageInfos:      file_mining_proto_msgTypes,
+	}.Build()
+	File_mining_proto = out.File
+	file_mining_proto_rawDesc = nil
+	file_mining_proto_goTypes = nil
+	file_mining_proto_depIdxs = nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: mining.proto
+
+package miningpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Mining_GetWork_FullMethodName        = "/hmhash.mining.v1.Mining/GetWork"
+	Mining_SubmitWork_FullMethodName     = "/hmhash.mining.v1.Mining/SubmitWork"
+	Mining_SubmitHashrate_FullMethodName = "/hmhash.mining.v1.Mining/SubmitHashrate"
+)
+
+// MiningClient is the client API for Mining service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MiningClient interface {
+	// GetWork streams the current work package, followed by every new one as
+	// soon as the node starts sealing it. Each stream is leased its own nonce
+	// prefix, which all nonces searched for its packages should start with.
+	GetWork(ctx context.Context, in *GetWorkRequest, opts ...grpc.CallOption) (Mining_GetWorkClient, error)
+	// SubmitWork submits a proof-of-work solution for a work package.
+	SubmitWork(ctx context.Context, in *SubmitWorkRequest, opts ...grpc.CallOption) (*SubmitWorkResponse, error)
+	// SubmitHashrate reports the hashrate of a miner, which is included in the
+	// total hashrate of the node.
+	SubmitHashrate(ctx context.Context, in *SubmitHashrateRequest, opts ...grpc.CallOption) (*SubmitHashrateResponse, error)
+}
+
+type miningClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMiningClient(cc grpc.ClientConnInterface) MiningClient {
+	return &miningClient{cc}
+}
+
+func (c *miningClient) GetWork(ctx context.Context, in *GetWorkRequest, opts ...grpc.CallOption) (Mining_GetWorkClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Mining_ServiceDesc.Streams[0], Mining_GetWork_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &miningGetWorkClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Mining_GetWorkClient interface {
+	Recv() (*Work, error)
+	grpc.ClientStream
+}
+
+type miningGetWorkClient struct {
+	grpc.ClientStream
+}
+
+func (x *miningGetWorkClient) Recv() (*Work, error) {
+	m := new(Work)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *miningClient) SubmitWork(ctx context.Context, in *SubmitWorkRequest, opts ...grpc.CallOption) (*SubmitWorkResponse, error) {
+	out := new(SubmitWorkResponse)
+	err := c.cc.Invoke(ctx, Mining_SubmitWork_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miningClient) SubmitHashrate(ctx context.Context, in *SubmitHashrateRequest, opts ...grpc.CallOption) (*SubmitHashrateResponse, error) {
+	out := new(SubmitHashrateResponse)
+	err := c.cc.Invoke(ctx, Mining_SubmitHashrate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MiningServer is the server API for Mining service.
+// All implementations must embed UnimplementedMiningServer
+// for forward compatibility
+type MiningServer interface {
+	// GetWork streams the current work package, followed by every new one as
+	// soon as the node starts sealing it. Each stream is leased its own nonce
+	// prefix, which all nonces searched for its packages should start with.
+	GetWork(*GetWorkRequest, Mining_GetWorkServer) error
+	// SubmitWork submits a proof-of-work solution for a work package.
+	SubmitWork(context.Context, *SubmitWorkRequest) (*SubmitWorkResponse, error)
+	// SubmitHashrate reports the hashrate of a miner, which is included in the
+	// total hashrate of the node.
+	SubmitHashrate(context.Context, *SubmitHashrateRequest) (*SubmitHashrateResponse, error)
+	mustEmbedUnimplementedMiningServer()
+}
+
+// UnimplementedMiningServer must be embedded to have forward compatible implementations.
+type UnimplementedMiningServer struct {
+}
+
+func (UnimplementedMiningServer) GetWork(*GetWorkRequest, Mining_GetWorkServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetWork not implemented")
+}
+func (UnimplementedMiningServer) SubmitWork(context.Context, *SubmitWorkRequest) (*SubmitWorkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitWork not implemented")
+}
+func (UnimplementedMiningServer) SubmitHashrate(context.Context, *SubmitHashrateRequest) (*SubmitHashrateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitHashrate not implemented")
+}
+func (UnimplementedMiningServer) mustEmbedUnimplementedMiningServer() {}
+
+// UnsafeMiningServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MiningServer will
+// result in compilation errors.
+type UnsafeMiningServer interface {
+	mustEmbedUnimplementedMiningServer()
+}
+
+func RegisterMiningServer(s grpc.ServiceRegistrar, srv MiningServer) {
+	s.RegisterService(&Mining_ServiceDesc, srv)
+}
+
+func _Mining_GetWork_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetWorkRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MiningServer).GetWork(m, &miningGetWorkServer{stream})
+}
+
+type Mining_GetWorkServer interface {
+	Send(*Work) error
+	grpc.ServerStream
+}
+
+type miningGetWorkServer struct {
+	grpc.ServerStream
+}
+
+func (x *miningGetWorkServer) Send(m *Work) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Mining_SubmitWork_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitWorkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiningServer).SubmitWork(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Mining_SubmitWork_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiningServer).SubmitWork(ctx, req.(*SubmitWorkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Mining_SubmitHashrate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitHashrateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiningServer).SubmitHashrate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Mining_SubmitHashrate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiningServer).SubmitHashrate(ctx, req.(*SubmitHashrateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Mining_ServiceDesc is the grpc.ServiceDesc for Mining service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Mining_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hmhash.mining.v1.Mining",
+	HandlerType: (*MiningServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitWork",
+			Handler:    _Mining_SubmitWork_Handler,
+		},
+		{
+			MethodName: "SubmitHashrate",
+			Handler:    _Mining_SubmitHashrate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetWork",
+			Handler:       _Mining_GetWork_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mining.proto",
+}
@@ -0,0 +1,392 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	crand "crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// defaultMQTTTopic is the topic work notifications are published to if the
+	// config leaves it unset.
+	defaultMQTTTopic = "hmhash/work"
+
+	mqttKeepAlive  = time.Minute      // Keep alive interval announced to the broker
+	mqttTimeout    = 10 * time.Second // Timeout of the connection and broker replies
+	mqttMinBackoff = time.Second      // Delay before retrying a failed publication
+	mqttMaxBackoff = 30 * time.Second // Cap of the doubling retry delays
+	mqttMaxPacket  = 1 << 16          // Size limit of the packets read from the broker
+)
+
+// MQTT 3.1.1 control packet types used by the publisher.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+var mqttFailureMeter = metrics.NewRegisteredMeter("hmhash/remote/mqtt/failures", nil)
+
+var (
+	errMQTTScheme = errors.New("unsupported mqtt broker scheme")
+	errMQTTQoS    = errors.New("unsupported mqtt qos, only 0 and 1 are")
+	errMQTTPacket = errors.New("malformed mqtt packet")
+)
+
+// mqttPublisher is a remote transport publishing the work notifications to a
+// topic of an MQTT broker, retained so subscribers joining between blocks get
+// the current work too.
+type mqttPublisher struct {
+	hmhash   *Hmhash
+	broker   *url.URL    // Broker URL, the host including the port
+	tls      *tls.Config // TLS configuration of the connection, nil for plain TCP
+	topic    string
+	qos      byte
+	clientID string
+
+	works chan []byte // Latest notification payload pending publication
+	quit  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+}
+
+// newMQTTPublisher creates a publisher of the work notifications to an MQTT
+// broker, reached over TLS for ssl://, tls:// and mqtts:// URLs.
+func newMQTTPublisher(hmhash *Hmhash, broker, topic string, qos byte, tlsConfig *tls.Config) (*mqttPublisher, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		tlsConfig = nil
+	case "ssl", "tls", "mqtts":
+		port = "8883"
+		if tlsConfig == nil {
+			tlsConfig = new(tls.Config)
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", errMQTTScheme, u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	if qos > 1 {
+		return nil, fmt.Errorf("%w: %d", errMQTTQoS, qos)
+	}
+	if topic == "" {
+		topic = defaultMQTTTopic
+	}
+	id := make([]byte, 4)
+	crand.Read(id)
+
+	return &mqttPublisher{
+		hmhash:   hmhash,
+		broker:   u,
+		tls:      tlsConfig,
+		topic:    topic,
+		qos:      qos,
+		clientID: "hmhash-" + hex.EncodeToString(id),
+		works:    make(chan []byte, 1),
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// Start begins publishing the work notifications in the background.
+func (s *mqttPublisher) Start() {
+	s.wg.Add(1)
+	go s.loop()
+	s.hmhash.config.Log.Info("Hmhash MQTT publisher started", "broker", s.broker.Redacted(), "topic", s.topic, "qos", s.qos)
+}
+
+// Close disconnects from the broker, waiting for the publisher to exit.
+func (s *mqttPublisher) Close() {
+	s.once.Do(func() {
+		close(s.quit)
+		s.wg.Wait()
+	})
+}
+
+// NotifyWork queues a work package for publication, replacing any older one
+// not published yet.
+func (s *mqttPublisher) NotifyWork(work [4]string, block *types.Block) {
+	payload := s.hmhash.notifyPayload(work, block)
+	select {
+	case <-s.works:
+	default:
+	}
+	s.works <- payload
+}
+
+// loop publishes the queued work notifications, keeping the broker connection
+// alive and reconnecting with exponential backoff on failures.
+func (s *mqttPublisher) loop() {
+	defer s.wg.Done()
+
+	var (
+		conn    net.Conn
+		pending []byte
+		id      uint16
+		backoff time.Duration
+		retry   <-chan time.Time
+		ping    = time.NewTicker(mqttKeepAlive / 2)
+		log     = s.hmhash.config.Log
+	)
+	defer ping.Stop()
+	defer func() {
+		if conn != nil {
+			writeMQTTPacket(conn, mqttDisconnect<<4, nil)
+			conn.Close()
+		}
+	}()
+	for {
+		select {
+		case pending = <-s.works:
+		case <-retry:
+			retry = nil
+		case <-ping.C:
+			if conn != nil {
+				if err := s.ping(conn); err != nil {
+					log.Debug("Hmhash MQTT broker unresponsive", "broker", s.broker.Redacted(), "err", err)
+					conn.Close()
+					conn = nil
+				}
+			}
+			continue
+		case <-s.quit:
+			return
+		}
+		if pending == nil || retry != nil {
+			continue
+		}
+		var err error
+		if conn == nil {
+			conn, err = s.connect()
+		}
+		if err == nil {
+			if id++; id == 0 {
+				id++ // Packet identifiers must be non-zero
+			}
+			err = s.publish(conn, id, pending)
+		}
+		if err != nil {
+			if conn != nil {
+				conn.Close()
+				conn = nil
+			}
+			if backoff *= 2; backoff < mqttMinBackoff {
+				backoff = mqttMinBackoff
+			} else if backoff > mqttMaxBackoff {
+				backoff = mqttMaxBackoff
+			}
+			retry = time.After(backoff)
+
+			mqttFailureMeter.Mark(1)
+			log.Warn("Failed to publish work over MQTT", "broker", s.broker.Redacted(), "retry", backoff, "err", err)
+			continue
+		}
+		log.Trace("Published work over MQTT", "broker", s.broker.Redacted(), "topic", s.topic)
+		pending, backoff = nil, 0
+	}
+}
+
+// connect dials the broker and establishes a clean MQTT session, authenticated
+// with the credentials of the broker URL if any.
+func (s *mqttPublisher) connect() (net.Conn, error) {
+	var (
+		dialer = &net.Dialer{Timeout: mqttTimeout}
+		conn   net.Conn
+		err    error
+	)
+	if s.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.broker.Host, s.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", s.broker.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var (
+		flags     = byte(0x02) // Clean session
+		keepalive = uint16(mqttKeepAlive / time.Second)
+		user      = s.broker.User
+		password  string
+		body      = appendMQTTString(nil, "MQTT")
+	)
+	if user != nil {
+		flags |= 0x80
+		if pass, ok := user.Password(); ok {
+			flags |= 0x40
+			password = pass
+		}
+	}
+	body = append(body, 4, flags, byte(keepalive>>8), byte(keepalive))
+	body = appendMQTTString(body, s.clientID)
+	if user != nil {
+		body = appendMQTTString(body, user.Username())
+		if flags&0x40 != 0 {
+			body = appendMQTTString(body, password)
+		}
+	}
+	if err := writeMQTTPacket(conn, mqttConnect<<4, body); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	header, reply, err := readMQTTPacketTimeout(conn)
+	switch {
+	case err != nil:
+	case header>>4 != mqttConnack || len(reply) != 2:
+		err = fmt.Errorf("%w: unexpected reply of type %d to connect", errMQTTPacket, header>>4)
+	case reply[1] != 0:
+		err = fmt.Errorf("mqtt connection refused with code %d", reply[1])
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// publish publishes a retained message to the topic, waiting for the broker to
+// acknowledge it for QoS 1.
+func (s *mqttPublisher) publish(conn net.Conn, id uint16, payload []byte) error {
+	body := appendMQTTString(nil, s.topic)
+	if s.qos > 0 {
+		body = append(body, byte(id>>8), byte(id))
+	}
+	body = append(body, payload...)
+	if err := writeMQTTPacket(conn, mqttPublish<<4|s.qos<<1|0x01, body); err != nil {
+		return err
+	}
+	if s.qos == 0 {
+		return nil
+	}
+	return expectMQTTReply(conn, mqttPuback, []byte{byte(id >> 8), byte(id)})
+}
+
+// ping checks that the broker connection is alive.
+func (s *mqttPublisher) ping(conn net.Conn) error {
+	if err := writeMQTTPacket(conn, mqttPingreq<<4, nil); err != nil {
+		return err
+	}
+	return expectMQTTReply(conn, mqttPingresp, nil)
+}
+
+// expectMQTTReply reads the reply of the broker to a packet, skipping stray
+// ping responses.
+func expectMQTTReply(conn net.Conn, kind byte, body []byte) error {
+	for {
+		header, reply, err := readMQTTPacketTimeout(conn)
+		if err != nil {
+			return err
+		}
+		switch {
+		case header>>4 == kind && string(reply) == string(body):
+			return nil
+		case header>>4 == mqttPingresp:
+			continue
+		default:
+			return fmt.Errorf("%w: unexpected reply of type %d, want %d", errMQTTPacket, header>>4, kind)
+		}
+	}
+}
+
+// appendMQTTString appends a length prefixed UTF-8 string.
+func appendMQTTString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// writeMQTTPacket writes a control packet with the given fixed header byte.
+func writeMQTTPacket(conn net.Conn, header byte, body []byte) error {
+	packet := []byte{header}
+	for size := len(body); ; {
+		digit := byte(size % 128)
+		if size /= 128; size > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if size == 0 {
+			break
+		}
+	}
+	conn.SetWriteDeadline(time.Now().Add(mqttTimeout))
+	_, err := conn.Write(append(packet, body...))
+	return err
+}
+
+// readMQTTPacketTimeout reads a control packet, failing if the broker doesn't
+// send one in time.
+func readMQTTPacketTimeout(conn net.Conn) (byte, []byte, error) {
+	conn.SetReadDeadline(time.Now().Add(mqttTimeout))
+	return readMQTTPacket(conn)
+}
+
+// readMQTTPacket reads a control packet, returning its fixed header byte and
+// its body.
+func readMQTTPacket(r io.Reader) (byte, []byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, nil, err
+	}
+	header := buf[0]
+
+	var size int
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0, nil, err
+		}
+		digit := buf[0]
+		if i == 4 {
+			return 0, nil, fmt.Errorf("%w: remaining length too long", errMQTTPacket)
+		}
+		size |= int(digit&0x7f) << (7 * i)
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	if size > mqttMaxPacket {
+		return 0, nil, fmt.Errorf("%w: %d bytes too large", errMQTTPacket, size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// readMQTTString reads a length prefixed string off the front of a packet body.
+func readMQTTString(body []byte) (string, []byte) {
+	if len(body) < 2 {
+		return "", nil
+	}
+	size := int(body[0])<<8 | int(body[1])
+	if len(body) < 2+size {
+		return "", nil
+	}
+	return string(body[2 : 2+size]), body[2+size:]
+}
+
+// Tests that work notifications are published to an MQTT broker, retrying the
+// connection if the broker refuses it.
+func TestMQTTPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	type publication struct {
+		user    string
+		header  byte
+		topic   string
+		payload []byte
+	}
+	published := make(chan publication, 1)
+	go func() {
+		for attempt := 0; ; attempt++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Check the connection request, refusing the first one
+			header, body, err := readMQTTPacket(conn)
+			if err != nil || header>>4 != mqttConnect {
+				t.Errorf("invalid connect packet %x: %v", header, err)
+				conn.Close()
+				return
+			}
+			proto, rest := readMQTTString(body)
+			if proto != "MQTT" || len(rest) < 4 || rest[0] != 4 || rest[1] != 0xc2 {
+				t.Errorf("invalid connect header: %x", body)
+			}
+			_, rest = readMQTTString(rest[4:]) // client id
+			user, _ := readMQTTString(rest)
+
+			if attempt == 0 {
+				writeMQTTPacket(conn, mqttConnack<<4, []byte{0, 5})
+				conn.Close()
+				continue
+			}
+			writeMQTTPacket(conn, mqttConnack<<4, []byte{0, 0})
+
+			// Acknowledge the publication and hand it to the test
+			header, body, err = readMQTTPacket(conn)
+			if err != nil || header>>4 != mqttPublish {
+				t.Errorf("invalid publish packet %x: %v", header, err)
+				conn.Close()
+				return
+			}
+			topic, rest := readMQTTString(body)
+			writeMQTTPacket(conn, mqttPuback<<4, rest[:2])
+			published <- publication{user, header, topic, rest[2:]}
+			return
+		}
+	}()
+	hmhash := New(Config{
+		PowMode:    ModeTest,
+		MQTTBroker: "tcp://miner:secret@" + listener.Addr().String(),
+		MQTTTopic:  "farm/work",
+		MQTTQoS:    1,
+	}, nil, false)
+	defer hmhash.Close()
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), nil, nil)
+
+	select {
+	case pub := <-published:
+		if pub.user != "miner" {
+			t.Errorf("username mismatch: have %q, want %q", pub.user, "miner")
+		}
+		if pub.header != mqttPublish<<4|0x03 {
+			t.Errorf("publish flags mismatch: have %x, want QoS 1 retained", pub.header)
+		}
+		if pub.topic != "farm/work" {
+			t.Errorf("topic mismatch: have %q, want %q", pub.topic, "farm/work")
+		}
+		var work []string
+		if err := json.Unmarshal(pub.payload, &work); err != nil {
+			t.Fatalf("failed to decode work %q: %v", pub.payload, err)
+		}
+		if len(work) != 6 || work[0] != hmhash.SealHash(header).Hex() || work[4] != hexutil.EncodeUint64(WorkVersion) {
+			t.Errorf("published work mismatch: %v", work)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("work not published")
+	}
+}
+
+// Tests that invalid MQTT configurations are rejected.
+func TestMQTTPublisherConfig(t *testing.T) {
+	tests := []struct {
+		broker string
+		qos    byte
+		err    error
+	}{
+		{"http://localhost", 0, errMQTTScheme},
+		{"tcp://localhost", 2, errMQTTQoS},
+		{"ssl://localhost", 1, nil},
+	}
+	for i, tt := range tests {
+		_, err := newMQTTPublisher(nil, tt.broker, "", tt.qos, nil)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	s, _ := newMQTTPublisher(nil, "mqtts://localhost", "", 0, nil)
+	if s.broker.Host != "localhost:8883" || s.tls == nil || s.tls.ServerName != "localhost" || s.topic != defaultMQTTTopic {
+		t.Errorf("publisher defaults mismatch: host %s, topic %s", s.broker.Host, s.topic)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// errRotatedHashAlgo is returned by the stateless seal verification for blocks
+// sealed with a hash algorithm of a rotation other than the default one.
+var errRotatedHashAlgo = errors.New("block sealed with a rotated hash algorithm")
+
+// algoCaches are the verification caches and mining datasets of a hash
+// algorithm of the rotation of the chain.
+type algoCaches struct {
+	algo     HashAlgo
+	caches   *lru[*cache]
+	datasets *lru[*dataset]
+}
+
+// newCaches creates the in-memory verification caches and mining datasets of a
+// hash algorithm.
+func (hmhash *Hmhash) newCaches(algo HashAlgo) (*lru[*cache], *lru[*dataset]) {
+	caches := newlru(hmhash.config.CachesInMem, func(epoch uint64) *cache {
+		c := newCache(epoch, algo)
+		c.log = hmhash.logs.dataset
+		return c
+	})
+	datasets := newlru(hmhash.config.DatasetsInMem, func(epoch uint64) *dataset {
+		d := newDataset(epoch, algo)
+		d.progress = hmhash.reportDatasetProgress
+		d.fraction = hmhash.config.DatasetFraction
+		d.log = hmhash.logs.dataset
+		return d
+	})
+	return caches, datasets
+}
+
+// rotated returns the hash algorithm and caches sealing the block at the given
+// height if the ethash rules of the chain rotate them, nil otherwise. The caches
+// of an algorithm are created when first needed, sharing those of the engine's
+// own algorithm.
+func (hmhash *Hmhash) rotated(rules *params.EthashConfig, block uint64) *algoCaches {
+	if rules == nil {
+		return nil
+	}
+	name := rules.MultiAlgo.AlgoAt(new(big.Int).SetUint64(block))
+	if name == "" {
+		return nil
+	}
+	hmhash.rotationLock.Lock()
+	defer hmhash.rotationLock.Unlock()
+
+	if r, ok := hmhash.rotation[name]; ok {
+		return r
+	}
+	if hmhash.rotation == nil {
+		hmhash.rotation = make(map[string]*algoCaches)
+	}
+	if name == hmhash.algo.Name() {
+		hmhash.rotation[name] = &algoCaches{algo: hmhash.algo, caches: hmhash.caches, datasets: hmhash.datasets}
+		return hmhash.rotation[name]
+	}
+	algo, err := lookupHashAlgo(name)
+	if err != nil {
+		// Remember the failure not to log it again, the seals of the blocks of the
+		// algorithm won't verify with the engine's own one
+		hmhash.logs.verifier.Error("Unsupported hash algorithm in rotation", "algo", name, "err", err)
+		hmhash.rotation[name] = nil
+		return nil
+	}
+	caches, datasets := hmhash.newCaches(algo)
+	hmhash.rotation[name] = &algoCaches{algo: algo, caches: caches, datasets: datasets}
+	return hmhash.rotation[name]
+}
+
+// rotatedAlgos returns the hash algorithms of the rotation whose caches were
+// created so far, besides the engine's own one.
+func (hmhash *Hmhash) rotatedAlgos() []HashAlgo {
+	hmhash.rotationLock.Lock()
+	defer hmhash.rotationLock.Unlock()
+
+	var algos []HashAlgo
+	for _, r := range hmhash.rotation {
+		if r != nil && r.algo.Name() != hmhash.algo.Name() {
+			algos = append(algos, r.algo)
+		}
+	}
+	return algos
+}
+
+// algoAt returns the hash algorithm sealing the block at the given height.
+func (hmhash *Hmhash) algoAt(rules *params.EthashConfig, block uint64) HashAlgo {
+	if r := hmhash.rotated(rules, block); r != nil {
+		return r.algo
+	}
+	return hmhash.algo
+}
+
+// cachesAt returns the verification caches of the hash algorithm sealing the
+// block at the given height.
+func (hmhash *Hmhash) cachesAt(rules *params.EthashConfig, block uint64) *lru[*cache] {
+	if r := hmhash.rotated(rules, block); r != nil {
+		return r.caches
+	}
+	return hmhash.caches
+}
+
+// datasetsAt returns the mining datasets of the hash algorithm sealing the block
+// at the given height.
+func (hmhash *Hmhash) datasetsAt(rules *params.EthashConfig, block uint64) *lru[*dataset] {
+	if r := hmhash.rotated(rules, block); r != nil {
+		return r.datasets
+	}
+	return hmhash.datasets
+}
+
+// rotationParent returns the parent a block of a hash algorithm rotation adjusts
+// its difficulty from: the parent block with the difficulty of the previous
+// block of the same algorithm, and its timestamp moved so the block time is the
+// average one since that block. It returns the parent itself if the rotation
+// isn't active at both blocks, or the previous block is unknown.
+func rotationParent(chain headerReader, config *params.ChainConfig, time uint64, parent *types.Header) *types.Header {
+	if chain == nil || config.Ethash == nil || config.Ethash.MultiAlgo == nil {
+		return parent
+	}
+	var (
+		rotation = config.Ethash.MultiAlgo
+		span     = uint64(len(rotation.Algos))
+		number   = parent.Number.Uint64() + 1
+	)
+	if number < span || rotation.AlgoAt(new(big.Int).SetUint64(number-span)) == "" {
+		return parent
+	}
+	prev := parent
+	for i := uint64(1); i < span; i++ {
+		if prev = chain.GetHeader(prev.ParentHash, prev.Number.Uint64()-1); prev == nil {
+			return parent
+		}
+	}
+	if time <= prev.Time {
+		return parent
+	}
+	synthetic := types.CopyHeader(parent)
+	synthetic.Difficulty = new(big.Int).Set(prev.Difficulty)
+	synthetic.Time = time - (time-prev.Time)/span
+	return synthetic
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that blocks are sealed and verified with the hash algorithm of the
+// rotation at their height.
+func TestMultiAlgoSeal(t *testing.T) {
+	rotation := &params.MultiAlgoConfig{Block: big.NewInt(0), Algos: []string{"keccak", "blake2b", "sha3"}}
+
+	config := &params.ChainConfig{Ethash: &params.EthashConfig{MultiAlgo: rotation}}
+	chain := configReader{config}
+
+	hmhash := New(Config{PowMode: ModeTest}, nil, false)
+	defer hmhash.Close()
+
+	for number, want := range []string{"keccak", "blake2b", "sha3", "keccak"} {
+		if have := hmhash.algoAt(config.Ethash, uint64(number)).Name(); have != want {
+			t.Errorf("block %d: hash algorithm mismatch: have %s, want %s", number, have, want)
+		}
+	}
+	if hmhash.cachesAt(config.Ethash, 0) != hmhash.caches || hmhash.cachesAt(config.Ethash, 1) == hmhash.caches || hmhash.cachesAt(config.Ethash, 1) == hmhash.cachesAt(config.Ethash, 2) {
+		t.Errorf("caches not separated by hash algorithm")
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block)
+	if err := hmhash.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	select {
+	case block := <-results:
+		header.Nonce = types.EncodeNonce(block.Nonce())
+		header.MixDigest = block.MixDigest()
+	case <-time.NewTimer(4 * time.Second).C:
+		t.Fatal("sealing result timeout")
+	}
+	if err := hmhash.verifySeal(context.Background(), chain, header, false); err != nil {
+		t.Fatalf("unexpected verification error: %v", err)
+	}
+	// Engines without the rotation verify with keccak, and the stateless
+	// verification refuses the block
+	tester := NewTester(nil, false)
+	defer tester.Close()
+	if err := tester.verifySeal(context.Background(), nil, header, false); err == nil {
+		t.Errorf("blake2b seal accepted by keccak engine")
+	}
+	if err := VerifyHeaderSeal(config, header); err != errRotatedHashAlgo {
+		t.Errorf("stateless verification error mismatch: have %v, want %v", err, errRotatedHashAlgo)
+	}
+}
+
+// Tests that every hash algorithm of the rotation adjusts its difficulty from
+// the previous block of the same algorithm.
+func TestMultiAlgoDifficulty(t *testing.T) {
+	config := &params.ChainConfig{HomesteadBlock: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}
+	config.Ethash = &params.EthashConfig{MultiAlgo: &params.MultiAlgoConfig{Block: big.NewInt(1), Algos: []string{"keccak", "blake2b"}}}
+
+	chain := &testHeaderChain{config: config, headers: make(map[common.Hash]*types.Header)}
+	var headers []*types.Header
+	for i, diff := range []int64{1_000_000, 2_000_000, 50_000_000, 3_000_000} {
+		header := &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Time:       uint64(i * 13),
+			Difficulty: big.NewInt(diff),
+			UncleHash:  types.EmptyUncleHash,
+		}
+		if i > 0 {
+			header.ParentHash = headers[i-1].Hash()
+		}
+		chain.headers[header.Hash()] = header
+		headers = append(headers, header)
+	}
+	// Block 4 (keccak) follows block 2 by two target block times, so it keeps the
+	// difficulty of block 2
+	parent := headers[3]
+	if have := calcDifficulty(chain, config, parent.Time+13, parent); have.Cmp(headers[2].Difficulty) != 0 {
+		t.Errorf("rotated difficulty mismatch: have %v, want %v", have, headers[2].Difficulty)
+	}
+	// Faster blocks of the algorithm raise its difficulty
+	if have := calcDifficulty(chain, config, parent.Time+1, parent); have.Cmp(headers[2].Difficulty) <= 0 {
+		t.Errorf("fast rotated block difficulty not raised: have %v", have)
+	}
+	// Block 2 follows block 0 from before the activation, so it adjusts from its
+	// parent
+	want := CalcDifficulty(config, headers[1].Time+13, headers[1])
+	if have := calcDifficulty(chain, config, headers[1].Time+13, headers[1]); have.Cmp(want) != 0 {
+		t.Errorf("first rotation difficulty mismatch: have %v, want %v", have, want)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+)
+
+const (
+	// defaultHashrateBlocks is the number of recent blocks the network hashrate
+	// is estimated over if the caller doesn't choose.
+	defaultHashrateBlocks = 120
+
+	// maxHashrateBlocks caps the number of blocks the network hashrate is
+	// estimated over, bounding the headers retrieved per call.
+	maxHashrateBlocks = 10000
+)
+
+var (
+	errNoHashrateBlocks = errors.New("network hashrate needs at least one block")
+	errNoHashrateSpan   = errors.New("not enough chain history to estimate network hashrate")
+)
+
+// EstimateNetworkHashrate estimates the hashrate of the whole network from the
+// last blocks of the chain: the work of the blocks, their summed difficulty,
+// over the time it took to mine them. Fewer blocks are used close to genesis.
+func EstimateNetworkHashrate(chain consensus.ChainHeaderReader, blocks uint64) (*big.Int, error) {
+	if blocks == 0 {
+		return nil, errNoHashrateBlocks
+	}
+	if blocks > maxHashrateBlocks {
+		blocks = maxHashrateBlocks
+	}
+	head := chain.CurrentHeader()
+	if head == nil {
+		return nil, errNoHashrateSpan
+	}
+	var (
+		work   = new(big.Int)
+		oldest = head
+	)
+	for i := uint64(0); i < blocks && oldest.Number.Sign() > 0; i++ {
+		parent := chain.GetHeader(oldest.ParentHash, oldest.Number.Uint64()-1)
+		if parent == nil {
+			break
+		}
+		work.Add(work, oldest.Difficulty)
+		oldest = parent
+	}
+	if head.Time <= oldest.Time {
+		return nil, errNoHashrateSpan
+	}
+	return work.Div(work, new(big.Int).SetUint64(head.Time-oldest.Time)), nil
+}
+
+// NetworkAPI exposes estimates about the whole hmhash network for the RPC
+// interface.
+type NetworkAPI struct {
+	chain consensus.ChainHeaderReader
+}
+
+// EstimateNetworkHashrate estimates the hashrate of the whole network over the
+// given number of recent blocks, 120 if omitted.
+func (api *NetworkAPI) EstimateNetworkHashrate(blocks *hexutil.Uint64) (*hexutil.Big, error) {
+	n := uint64(defaultHashrateBlocks)
+	if blocks != nil {
+		n = uint64(*blocks)
+	}
+	rate, err := EstimateNetworkHashrate(api.chain, n)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(rate), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// headedChain is a testHeaderChain with a current header.
+type headedChain struct {
+	*testHeaderChain
+	head *types.Header
+}
+
+func (c *headedChain) CurrentHeader() *types.Header { return c.head }
+
+// Tests that the network hashrate is estimated from the work and timespan of
+// the recent blocks.
+func TestEstimateNetworkHashrate(t *testing.T) {
+	chain := &headedChain{testHeaderChain: &testHeaderChain{headers: make(map[common.Hash]*types.Header)}}
+
+	var genesis *types.Header
+	for i := int64(0); i <= 10; i++ {
+		header := &types.Header{Number: big.NewInt(i), Time: uint64(i * 10), Difficulty: big.NewInt(1000 * i)}
+		if chain.head != nil {
+			header.ParentHash = chain.head.Hash()
+		}
+		if genesis == nil {
+			genesis = header
+		}
+		chain.headers[header.Hash()] = header
+		chain.head = header
+	}
+	// The last block carries 10000 work over 10 seconds, the last 2 blocks 19000
+	// over 20 seconds and all of them 55000 over 100 seconds
+	for blocks, want := range map[uint64]int64{1: 1000, 2: 950, 10: 550, 1000: 550} {
+		rate, err := EstimateNetworkHashrate(chain, blocks)
+		if err != nil || rate.Int64() != want {
+			t.Errorf("%d blocks: hashrate mismatch: have %v (%v), want %d", blocks, rate, err, want)
+		}
+	}
+	if _, err := EstimateNetworkHashrate(chain, 0); err != errNoHashrateBlocks {
+		t.Errorf("zero blocks error mismatch: have %v, want %v", err, errNoHashrateBlocks)
+	}
+	api := &NetworkAPI{chain}
+	if rate, err := api.EstimateNetworkHashrate(nil); err != nil || rate.ToInt().Int64() != 550 {
+		t.Errorf("default hashrate mismatch: have %v (%v), want 550", rate, err)
+	}
+	n := hexutil.Uint64(2)
+	if rate, err := api.EstimateNetworkHashrate(&n); err != nil || rate.ToInt().Int64() != 950 {
+		t.Errorf("2 block hashrate mismatch: have %v (%v), want 950", rate, err)
+	}
+	// A chain without history can't be estimated
+	chain.head = genesis
+	if _, err := EstimateNetworkHashrate(chain, 10); err != errNoHashrateSpan {
+		t.Errorf("genesis error mismatch: have %v, want %v", err, errNoHashrateSpan)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// NonceStrategy decides which part of the nonce space each worker (CPU thread
+// or GPU) sealing a block searches.
+type NonceStrategy interface {
+	// Name returns the textual form of the strategy, accepted by
+	// ParseNonceStrategy.
+	Name() string
+
+	// Assign returns the first nonce to try and the increment between tries for
+	// worker id out of the given number of workers sealing the same block. GPUs
+	// search consecutive batches of nonces and only use the first nonce.
+	Assign(rand *rand.Rand, id, workers int) (start, step uint64)
+}
+
+// DefaultNonceStrategy is the name of the nonce strategy used if none is set.
+const DefaultNonceStrategy = "sequential"
+
+var errInvalidNonceStrategy = errors.New("invalid nonce strategy")
+
+// ParseNonceStrategy creates a nonce strategy from its textual form, one of
+// "sequential", "random-stride" or "split-range:<index>/<count>". An empty
+// string selects the default strategy.
+func ParseNonceStrategy(s string) (NonceStrategy, error) {
+	switch {
+	case s == "" || s == DefaultNonceStrategy:
+		return SequentialNonces(), nil
+	case s == "random-stride":
+		return RandomStrideNonces(), nil
+	case strings.HasPrefix(s, "split-range:"):
+		index, count, ok := strings.Cut(strings.TrimPrefix(s, "split-range:"), "/")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errInvalidNonceStrategy, s)
+		}
+		i, err := strconv.ParseUint(index, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", errInvalidNonceStrategy, s, err)
+		}
+		n, err := strconv.ParseUint(count, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", errInvalidNonceStrategy, s, err)
+		}
+		return SplitRangeNonces(i, n)
+	default:
+		return nil, fmt.Errorf("%w: %q", errInvalidNonceStrategy, s)
+	}
+}
+
+// sequentialNonces starts every worker at an independent random nonce and
+// counts up from there.
+type sequentialNonces struct{}
+
+// SequentialNonces returns the default strategy, starting every worker at a
+// random nonce and counting up.
+func SequentialNonces() NonceStrategy { return sequentialNonces{} }
+
+func (sequentialNonces) Name() string { return DefaultNonceStrategy }
+
+func (sequentialNonces) Assign(rand *rand.Rand, id, workers int) (uint64, uint64) {
+	return uint64(rand.Int63()), 1
+}
+
+// randomStrideNonces starts every worker at an independent random nonce and
+// advances it by a random odd stride. Odd strides are coprime with 2^64, so
+// every worker still visits the whole nonce space before repeating.
+type randomStrideNonces struct{}
+
+// RandomStrideNonces returns a strategy starting every worker at a random nonce
+// and advancing it by a random stride, spreading the search over the nonce space.
+func RandomStrideNonces() NonceStrategy { return randomStrideNonces{} }
+
+func (randomStrideNonces) Name() string { return "random-stride" }
+
+func (randomStrideNonces) Assign(rand *rand.Rand, id, workers int) (uint64, uint64) {
+	return rand.Uint64(), rand.Uint64() | 1
+}
+
+// splitRangeNonces splits the nonce space into equal ranges, one for each node
+// of a mining farm sharing the same work package, and the range of the local
+// node further between its workers.
+type splitRangeNonces struct {
+	index uint64 // Index of the local node within the farm
+	count uint64 // Number of nodes in the farm
+}
+
+// SplitRangeNonces returns a strategy for node index out of count nodes mining
+// the same work package, searching disjoint ranges of the nonce space.
+func SplitRangeNonces(index, count uint64) (NonceStrategy, error) {
+	if count == 0 || index >= count {
+		return nil, fmt.Errorf("%w: node index %d out of %d", errInvalidNonceStrategy, index, count)
+	}
+	return splitRangeNonces{index: index, count: count}, nil
+}
+
+func (s splitRangeNonces) Name() string {
+	return fmt.Sprintf("split-range:%d/%d", s.index, s.count)
+}
+
+// Assign starts the worker at a random offset within the first half of its
+// range, so restarted seals don't repeat the same work. Ranges are large
+// enough never to be exhausted in the lifetime of a block.
+func (s splitRangeNonces) Assign(rand *rand.Rand, id, workers int) (uint64, uint64) {
+	var (
+		size  = math.MaxUint64 / s.count
+		sub   = size / uint64(workers)
+		start = s.index*size + uint64(id)*sub
+	)
+	if half := sub / 2; half > 0 {
+		start += rand.Uint64() % half
+	}
+	return start, 1
+}
+
+// SetNonceStrategy changes the way the nonce space is split between the mining
+// workers. Like SetThreads, this does not start mining, but running seals pick
+// up the change.
+func (hmhash *Hmhash) SetNonceStrategy(strategy NonceStrategy) {
+	hmhash.lock.Lock()
+	defer hmhash.lock.Unlock()
+
+	// If we're running a shared PoW, set the strategy on that instead
+	if hmhash.shared != nil {
+		hmhash.shared.SetNonceStrategy(strategy)
+		return
+	}
+	hmhash.nonces = strategy
+	select {
+	case hmhash.update <- struct{}{}:
+	default:
+	}
+}
+
+// NonceStrategy returns the way the nonce space is split between the mining
+// workers.
+func (hmhash *Hmhash) NonceStrategy() NonceStrategy {
+	hmhash.lock.Lock()
+	defer hmhash.lock.Unlock()
+
+	if hmhash.shared != nil {
+		return hmhash.shared.NonceStrategy()
+	}
+	return hmhash.nonces
+}
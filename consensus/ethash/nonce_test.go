@@ -0,0 +1,102 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that nonce strategies are parsed from and formatted to the same text.
+func TestParseNonceStrategy(t *testing.T) {
+	for _, name := range []string{"sequential", "random-stride", "split-range:0/1", "split-range:2/3"} {
+		strategy, err := ParseNonceStrategy(name)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %v", name, err)
+			continue
+		}
+		if strategy.Name() != name {
+			t.Errorf("%s: name mismatch: have %s", name, strategy.Name())
+		}
+	}
+	for _, name := range []string{"random", "split-range:1", "split-range:3/3", "split-range:0/0", "split-range:a/2"} {
+		if _, err := ParseNonceStrategy(name); !errors.Is(err, errInvalidNonceStrategy) {
+			t.Errorf("%s: error mismatch: have %v, want %v", name, err, errInvalidNonceStrategy)
+		}
+	}
+}
+
+// Tests that split ranges assign every worker of every node a distinct section
+// of the nonce space.
+func TestSplitRangeNonces(t *testing.T) {
+	var (
+		rand    = rand.New(rand.NewSource(1))
+		nodes   = uint64(3)
+		workers = 4
+		size    = math.MaxUint64 / nodes
+		sub     = size / uint64(workers)
+	)
+	for node := uint64(0); node < nodes; node++ {
+		strategy, _ := SplitRangeNonces(node, nodes)
+		for id := 0; id < workers; id++ {
+			first := node*size + uint64(id)*sub
+			for i := 0; i < 100; i++ {
+				start, step := strategy.Assign(rand, id, workers)
+				if step != 1 {
+					t.Fatalf("node %d worker %d: step mismatch: have %d, want 1", node, id, step)
+				}
+				if start < first || start >= first+sub/2 {
+					t.Fatalf("node %d worker %d: start %d outside [%d, %d)", node, id, start, first, first+sub/2)
+				}
+			}
+		}
+	}
+}
+
+// Tests that blocks can be sealed with all built-in nonce strategies.
+func TestNonceStrategySealing(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	for _, name := range []string{"sequential", "random-stride", "split-range:1/2"} {
+		strategy, _ := ParseNonceStrategy(name)
+		hmhash.SetNonceStrategy(strategy)
+
+		header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+		results := make(chan *types.Block)
+		hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+		select {
+		case block := <-results:
+			if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+				t.Errorf("%s: sealed block invalid: %v", name, err)
+			}
+			if name == "split-range:1/2" && block.Nonce() < math.MaxUint64/2 {
+				t.Errorf("%s: nonce %d outside of node range", name, block.Nonce())
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: sealing timed out", name)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// defaultNotifyBackoff is the delay before the first retry of a failed work
+	// notification if the config leaves it unset, doubling for every retry.
+	defaultNotifyBackoff = 100 * time.Millisecond
+
+	// notifyQuarantineTime is how long a persistently failing notification
+	// target is skipped before being tried again.
+	notifyQuarantineTime = time.Minute
+)
+
+var notifyFailureMeter = metrics.NewRegisteredMeter("hmhash/remote/notify/failures", nil)
+
+var (
+	errNoRemoteSealer      = errors.New("remote sealer not running")
+	errInvalidNotifyTarget = errors.New("notify target must be an http or https URL")
+	errKnownNotifyTarget   = errors.New("notify target already added")
+	errUnknownNotifyTarget = errors.New("unknown notify target")
+)
+
+// NotifyTargetHealth is the delivery record of a URL notified of new work.
+type NotifyTargetHealth struct {
+	URL         string    `json:"url"`
+	Delivered   uint64    `json:"delivered"`           // Notifications delivered
+	Failed      uint64    `json:"failed"`              // Notifications failed after all retries
+	Failing     uint64    `json:"failing"`             // Notifications failed in a row
+	LastError   string    `json:"lastError,omitempty"` // Error of the last failed notification
+	LastSuccess time.Time `json:"lastSuccess"`         // Time of the last delivered notification
+	Quarantined bool      `json:"quarantined"`         // Whether the target is skipped for failing
+}
+
+// notifyTarget is a URL notified of new work, tracking its delivery record.
+type notifyTarget struct {
+	url string
+
+	lock       sync.Mutex
+	delivered  uint64
+	failed     uint64
+	failing    uint64    // Notifications failed in a row
+	lastErr    string    // Error of the last failed notification
+	lastOK     time.Time // Time of the last delivered notification
+	quarantine time.Time // Time until which the target is skipped
+}
+
+// ready reports whether the target is to be notified, that is not quarantined.
+func (t *notifyTarget) ready(now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return !now.Before(t.quarantine)
+}
+
+// record updates the delivery record with the outcome of a notification,
+// returning whether the target got quarantined for failing threshold times in
+// a row. A zero threshold never quarantines.
+func (t *notifyTarget) record(err error, threshold uint64, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err == nil {
+		t.delivered++
+		t.failing = 0
+		t.lastOK = now
+		return false
+	}
+	t.failed++
+	t.failing++
+	t.lastErr = err.Error()
+
+	if threshold > 0 && t.failing >= threshold {
+		t.quarantine = now.Add(notifyQuarantineTime)
+		return true
+	}
+	return false
+}
+
+// health returns the delivery record of the target.
+func (t *notifyTarget) health(now time.Time) NotifyTargetHealth {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return NotifyTargetHealth{
+		URL:         t.url,
+		Delivered:   t.delivered,
+		Failed:      t.failed,
+		Failing:     t.failing,
+		LastError:   t.lastErr,
+		LastSuccess: t.lastOK,
+		Quarantined: now.Before(t.quarantine),
+	}
+}
+
+// notifyTargets is the set of URLs notified of new work, persisted to a file if
+// one is configured so targets added at runtime survive restarts.
+type notifyTargets struct {
+	lock sync.RWMutex
+	list []*notifyTarget
+	path string // File persisting the URLs, empty if not persisted
+}
+
+// newNotifyTargets creates the notification targets of the given URLs, followed
+// by the ones persisted in path. The targets are always returned, the error only
+// reports an unreadable file.
+func newNotifyTargets(urls []string, path string) (*notifyTargets, error) {
+	targets := &notifyTargets{path: path}
+	for _, url := range urls {
+		targets.insert(url)
+	}
+	if path == "" {
+		return targets, nil
+	}
+	blob, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return targets, nil
+	}
+	if err != nil {
+		return targets, err
+	}
+	var persisted []string
+	if err := json.Unmarshal(blob, &persisted); err != nil {
+		return targets, err
+	}
+	for _, url := range persisted {
+		targets.insert(url)
+	}
+	return targets, nil
+}
+
+// insert appends a target unless its URL is already notified, reporting whether
+// it was appended. The caller must hold the write lock or own the set.
+func (ts *notifyTargets) insert(url string) bool {
+	for _, target := range ts.list {
+		if target.url == url {
+			return false
+		}
+	}
+	ts.list = append(ts.list, &notifyTarget{url: url})
+	return true
+}
+
+// validNotifyTarget reports whether a URL can be notified of new work.
+func validNotifyTarget(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// add starts notifying a URL of new work, persisting the updated set.
+func (ts *notifyTargets) add(rawurl string) error {
+	if !validNotifyTarget(rawurl) {
+		return errInvalidNotifyTarget
+	}
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	old := ts.list
+	ts.list = append([]*notifyTarget(nil), old...)
+	if !ts.insert(rawurl) {
+		ts.list = old
+		return errKnownNotifyTarget
+	}
+	if err := ts.save(); err != nil {
+		ts.list = old
+		return err
+	}
+	return nil
+}
+
+// remove stops notifying a URL of new work, persisting the updated set.
+func (ts *notifyTargets) remove(url string) error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for i, target := range ts.list {
+		if target.url != url {
+			continue
+		}
+		old := ts.list
+		ts.list = append(append([]*notifyTarget(nil), old[:i]...), old[i+1:]...)
+		if err := ts.save(); err != nil {
+			ts.list = old
+			return err
+		}
+		return nil
+	}
+	return errUnknownNotifyTarget
+}
+
+// replace swaps the notified URLs for the given ones, persisting the updated set.
+// Targets notified before keep their delivery record.
+func (ts *notifyTargets) replace(urls []string) error {
+	for _, url := range urls {
+		if !validNotifyTarget(url) {
+			return errInvalidNotifyTarget
+		}
+	}
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	known := make(map[string]*notifyTarget, len(ts.list))
+	for _, target := range ts.list {
+		known[target.url] = target
+	}
+	old := ts.list
+	ts.list = nil
+	for _, url := range urls {
+		if target, ok := known[url]; ok {
+			ts.list = append(ts.list, target)
+			delete(known, url)
+			continue
+		}
+		ts.insert(url)
+	}
+	if err := ts.save(); err != nil {
+		ts.list = old
+		return err
+	}
+	return nil
+}
+
+// save writes the URLs of the targets into the persistence file, if any. The
+// caller must hold the write lock.
+func (ts *notifyTargets) save() error {
+	if ts.path == "" {
+		return nil
+	}
+	urls := make([]string, 0, len(ts.list))
+	for _, target := range ts.list {
+		urls = append(urls, target.url)
+	}
+	blob, err := json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0755); err != nil {
+		return err
+	}
+	temp := ts.path + "." + strconv.Itoa(rand.Int())
+	if err := os.WriteFile(temp, blob, 0644); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, ts.path)
+}
+
+// all returns the current notification targets.
+func (ts *notifyTargets) all() []*notifyTarget {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+
+	return append([]*notifyTarget(nil), ts.list...)
+}
+
+// NotifyTargets returns the delivery record of each URL notified of new work.
+func (hmhash *Hmhash) NotifyTargets() []NotifyTargetHealth {
+	if hmhash.remote == nil {
+		return nil
+	}
+	var (
+		now     = time.Now()
+		targets = hmhash.remote.targets.all()
+		health  = make([]NotifyTargetHealth, 0, len(targets))
+	)
+	for _, target := range targets {
+		health = append(health, target.health(now))
+	}
+	return health
+}
+
+// AddNotifyTarget starts notifying a URL of new work without restarting the
+// node. The URL is persisted if a notify file is configured.
+func (hmhash *Hmhash) AddNotifyTarget(url string) error {
+	if hmhash.remote == nil {
+		return errNoRemoteSealer
+	}
+	if err := hmhash.remote.targets.add(url); err != nil {
+		return err
+	}
+	hmhash.logs.sealer.Info("Added remote miner notify target", "miner", url)
+	return nil
+}
+
+// RemoveNotifyTarget stops notifying a URL of new work, be it configured on the
+// command line or added at runtime.
+func (hmhash *Hmhash) RemoveNotifyTarget(url string) error {
+	if hmhash.remote == nil {
+		return errNoRemoteSealer
+	}
+	if err := hmhash.remote.targets.remove(url); err != nil {
+		return err
+	}
+	hmhash.logs.sealer.Info("Removed remote miner notify target", "miner", url)
+	return nil
+}
+
+// sendNotification notifies a target of new work, retrying failed attempts with
+// exponential backoff until the round of the work is cancelled by newer work.
+func (s *remoteSealer) sendNotification(ctx context.Context, round context.Context, target *notifyTarget, json []byte, work [4]string) {
+	defer s.reqWG.Done()
+
+	if !target.ready(time.Now()) {
+		return
+	}
+	var (
+		config  = s.hmhash.config
+		backoff = config.NotifyBackoff
+		err     error
+	)
+	if backoff <= 0 {
+		backoff = defaultNotifyBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		reqctx := ctx
+		if attempt > 0 {
+			reqctx = round
+		}
+		err = postNotification(reqctx, s.client, target.url, json, s.hmhash.workHeader())
+		if err == nil || attempt >= config.NotifyRetries {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-round.Done():
+		}
+		if round.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+	// Don't hold failures against the target when shutting down
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		notifyFailureMeter.Mark(1)
+		s.hmhash.logs.sealer.Warn("Failed to notify remote miner", "miner", target.url, "err", err)
+	} else {
+		s.hmhash.logs.sealer.Trace("Notified remote miner", "miner", target.url, "hash", work[0], "target", work[2])
+	}
+	if target.record(err, config.NotifyQuarantine, time.Now()) {
+		s.hmhash.logs.sealer.Warn("Quarantined failing remote miner", "miner", target.url, "duration", notifyQuarantineTime)
+	}
+}
+
+// postNotification posts a work notification to a URL with the given headers,
+// failing on error responses too.
+func postNotification(ctx context.Context, client *http.Client, url string, json []byte, header http.Header) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(json))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, remoteSealerTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bad response status: %s", resp.Status)
+	}
+	return nil
+}
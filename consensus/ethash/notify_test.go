@@ -0,0 +1,134 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that failed work notifications are retried until delivered.
+func TestNotifyRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	hmhash := New(Config{PowMode: ModeTest, NotifyRetries: 2, NotifyBackoff: time.Millisecond}, []string{server.URL}, false)
+	defer hmhash.Close()
+
+	hmhash.Seal(nil, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}), nil, nil)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		health := hmhash.NotifyTargets()
+		if len(health) != 1 {
+			t.Fatalf("notify target count mismatch: have %d, want 1", len(health))
+		}
+		if health[0].Delivered == 1 {
+			if health[0].Failed != 0 || health[0].Quarantined {
+				t.Fatalf("retried notification held against target: %+v", health[0])
+			}
+			break
+		}
+		if time.Since(start) > 3*time.Second {
+			t.Fatalf("notification not delivered: %+v", health[0])
+		}
+	}
+	if have := atomic.LoadInt32(&requests); have != 3 {
+		t.Errorf("request count mismatch: have %d, want 3", have)
+	}
+}
+
+// Tests that persistently failing notification targets are quarantined.
+func TestNotifyQuarantine(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	hmhash := New(Config{PowMode: ModeTest, NotifyQuarantine: 2}, []string{server.URL}, false)
+	defer hmhash.Close()
+
+	var (
+		remote = hmhash.remote
+		target = remote.targets.all()[0]
+		ctx    = context.Background()
+	)
+	for i := 0; i < 3; i++ {
+		remote.reqWG.Add(1)
+		remote.sendNotification(ctx, ctx, target, []byte("[]"), [4]string{})
+	}
+	if have := atomic.LoadInt32(&requests); have != 2 {
+		t.Errorf("request count mismatch: have %d, want 2", have)
+	}
+	health := hmhash.NotifyTargets()[0]
+	if !health.Quarantined || health.Failed != 2 || health.Failing != 2 || health.LastError == "" {
+		t.Errorf("failing target health mismatch: %+v", health)
+	}
+}
+
+// Tests that notify targets can be added and removed at runtime, and that the
+// changes are persisted across restarts.
+func TestNotifyTargetsRuntime(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "notify.json")
+
+	hmhash := New(Config{PowMode: ModeTest, NotifyFile: file}, []string{"http://static"}, false)
+	if err := hmhash.AddNotifyTarget("http://dynamic:8080"); err != nil {
+		t.Fatalf("failed to add notify target: %v", err)
+	}
+	if err := hmhash.AddNotifyTarget("http://dynamic:8080"); err != errKnownNotifyTarget {
+		t.Errorf("duplicate target error mismatch: have %v, want %v", err, errKnownNotifyTarget)
+	}
+	if err := hmhash.AddNotifyTarget("ftp://dynamic"); err != errInvalidNotifyTarget {
+		t.Errorf("invalid target error mismatch: have %v, want %v", err, errInvalidNotifyTarget)
+	}
+	if err := hmhash.AddNotifyTarget("http://removed"); err != nil {
+		t.Fatalf("failed to add notify target: %v", err)
+	}
+	if err := hmhash.RemoveNotifyTarget("http://removed"); err != nil {
+		t.Fatalf("failed to remove notify target: %v", err)
+	}
+	if err := hmhash.RemoveNotifyTarget("http://removed"); err != errUnknownNotifyTarget {
+		t.Errorf("unknown target error mismatch: have %v, want %v", err, errUnknownNotifyTarget)
+	}
+	hmhash.Close()
+
+	// Restart with the persisted targets
+	hmhash = New(Config{PowMode: ModeTest, NotifyFile: file}, []string{"http://static"}, false)
+	defer hmhash.Close()
+
+	var urls []string
+	for _, target := range hmhash.NotifyTargets() {
+		urls = append(urls, target.URL)
+	}
+	if want := []string{"http://static", "http://dynamic:8080"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("persisted targets mismatch: have %v, want %v", urls, want)
+	}
+}
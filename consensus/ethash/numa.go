@@ -0,0 +1,243 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/edsrzf/mmap-go"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// NUMA placement policies of the local mining threads.
+const (
+	NUMAPin        = "pin"        // Pin the threads to the CPUs of the nodes
+	NUMAReplicate  = "replicate"  // Pin the threads and copy the dataset into the memory of every node
+	NUMAInterleave = "interleave" // Pin the threads and spread a copy of the dataset across the nodes
+)
+
+// numaRoot is the sysfs directory describing the NUMA nodes of the machine.
+const numaRoot = "/sys/devices/system/node"
+
+// numaStripeBytes is the size of the stripes of an interleaved dataset placed on
+// the nodes in turn.
+const numaStripeBytes = 2 * 1024 * 1024
+
+var (
+	errInvalidNUMAPolicy = errors.New("invalid NUMA policy")
+	errNoNUMANodes       = errors.New("no NUMA nodes found")
+)
+
+// numaNode is a NUMA node of the machine and the CPUs local to it.
+type numaNode struct {
+	id   int
+	cpus []int
+}
+
+// numaTopology reads the NUMA nodes of the machine from the sysfs directory.
+func numaTopology(root string) ([]numaNode, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	var nodes []numaNode
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		blob, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := parseCPUList(string(blob))
+		if err != nil {
+			return nil, fmt.Errorf("node %d: %w", id, err)
+		}
+		if len(cpus) > 0 {
+			nodes = append(nodes, numaNode{id: id, cpus: cpus})
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errNoNUMANodes
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+	return nodes, nil
+}
+
+// parseCPUList parses a kernel CPU list such as "0-3,8-11".
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, field := range strings.Split(strings.TrimSpace(list), ",") {
+		if field == "" {
+			continue
+		}
+		first, last, ranged := strings.Cut(field, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+		to := from
+		if ranged {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return nil, fmt.Errorf("invalid CPU list %q", list)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// numaPlacement places the local mining threads, and optionally copies of the
+// mining datasets they read, on the NUMA nodes of the machine.
+type numaPlacement struct {
+	policy string
+	nodes  []numaNode
+	log    log.Logger
+}
+
+// newNUMAPlacement creates the placement of a policy on the NUMA nodes described
+// in the sysfs directory.
+func newNUMAPlacement(policy string, root string, logger log.Logger) (*numaPlacement, error) {
+	switch policy {
+	case NUMAPin, NUMAReplicate, NUMAInterleave:
+	default:
+		return nil, fmt.Errorf("%w: %q", errInvalidNUMAPolicy, policy)
+	}
+	nodes, err := numaTopology(root)
+	if err != nil {
+		return nil, err
+	}
+	return &numaPlacement{policy: policy, nodes: nodes, log: logger}, nil
+}
+
+// node returns the node the mining thread with the given id is placed on.
+func (p *numaPlacement) node(id int) int {
+	return id % len(p.nodes)
+}
+
+// pin locks the calling goroutine to its OS thread and pins the thread to the
+// CPUs of a node. The goroutine must not unlock the thread, so it's terminated
+// along with the goroutine instead of running others with the affinity.
+func (p *numaPlacement) pin(node int) {
+	runtime.LockOSThread()
+	if err := setAffinity(p.nodes[node].cpus); err != nil {
+		p.log.Warn("Failed to pin hmhash mining thread", "node", p.nodes[node].id, "err", err)
+	}
+}
+
+// place returns the copy of a dataset read by the mining threads of a node.
+func (p *numaPlacement) place(d *dataset, node int) *dataset {
+	switch p.policy {
+	case NUMAReplicate:
+		return d.placed(node, func() *dataset {
+			// The caller is pinned to the node, so the pages of the copy are
+			// allocated in its memory when first touched by the copy
+			return numaCopy(d, func(dst []uint32) { copy(dst, d.dataset) })
+		})
+	case NUMAInterleave:
+		return d.placed(-1, func() *dataset {
+			return numaCopy(d, func(dst []uint32) { p.interleave(dst, d.dataset) })
+		})
+	}
+	return d
+}
+
+// interleave copies a dataset in stripes, each one by a thread pinned to the
+// nodes in turn, so its pages are spread across the memory of all nodes.
+func (p *numaPlacement) interleave(dst, src []uint32) {
+	var (
+		stripe = numaStripeBytes / 4
+		pend   sync.WaitGroup
+	)
+	for node := range p.nodes {
+		pend.Add(1)
+		go func(node int) {
+			defer pend.Done()
+			p.pin(node)
+
+			for start := node * stripe; start < len(src); start += len(p.nodes) * stripe {
+				end := start + stripe
+				if end > len(src) {
+					end = len(src)
+				}
+				copy(dst[start:end], src[start:end])
+			}
+		}(node)
+	}
+	pend.Wait()
+}
+
+// numaDataset is a copy of a dataset placed on the NUMA nodes, created once.
+type numaDataset struct {
+	once    sync.Once
+	dataset *dataset
+}
+
+// placed returns the copy of the dataset placed under the given key, creating it
+// on first use, or the dataset itself if the copy couldn't be created.
+func (d *dataset) placed(key int, create func() *dataset) *dataset {
+	d.numaLock.Lock()
+	if d.numa == nil {
+		d.numa = make(map[int]*numaDataset)
+	}
+	c, ok := d.numa[key]
+	if !ok {
+		c = new(numaDataset)
+		d.numa[key] = c
+	}
+	d.numaLock.Unlock()
+
+	c.once.Do(func() { c.dataset = create() })
+	if c.dataset == nil {
+		return d
+	}
+	return c.dataset
+}
+
+// numaCopy creates a copy of a dataset in anonymous memory filled by fill, or
+// returns nil if the memory can't be mapped.
+func numaCopy(d *dataset, fill func(dst []uint32)) *dataset {
+	mem, err := mmap.MapRegion(nil, len(d.dataset)*4, mmap.RDWR, mmap.ANON, 0)
+	if err != nil {
+		d.log.Warn("Failed to map NUMA copy of hmhash dataset", logEpoch, d.epoch, "err", err)
+		return nil
+	}
+	c := &dataset{
+		epoch:   d.epoch,
+		algo:    d.algo,
+		mmap:    mem,
+		dataset: unsafe.Slice((*uint32)(unsafe.Pointer(&mem[0])), len(mem)/4),
+		done:    1,
+		cache:   d.cache,
+		size:    d.size,
+		log:     d.log,
+	}
+	runtime.SetFinalizer(c, (*dataset).finalizer)
+	fill(c.dataset)
+	return c
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Tests that kernel CPU lists are parsed.
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list string
+		cpus []int
+		fail bool
+	}{
+		{list: "0\n", cpus: []int{0}},
+		{list: "0-3,8-9\n", cpus: []int{0, 1, 2, 3, 8, 9}},
+		{list: "\n", cpus: nil},
+		{list: "3-1", fail: true},
+		{list: "a-b", fail: true},
+	}
+	for i, tt := range tests {
+		cpus, err := parseCPUList(tt.list)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if !reflect.DeepEqual(cpus, tt.cpus) {
+			t.Errorf("test %d: CPUs mismatch: have %v, want %v", i, cpus, tt.cpus)
+		}
+	}
+}
+
+// Tests that the NUMA topology is read from sysfs, skipping nodes without CPUs.
+func TestNUMATopology(t *testing.T) {
+	root := t.TempDir()
+	for node, cpus := range map[string]string{"node1": "4-7\n", "node0": "0-3\n", "node2": "\n"} {
+		if err := os.MkdirAll(filepath.Join(root, node), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, node, "cpulist"), []byte(cpus), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "possible"), []byte("0-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := numaTopology(root)
+	if err != nil {
+		t.Fatalf("failed to read topology: %v", err)
+	}
+	want := []numaNode{{id: 0, cpus: []int{0, 1, 2, 3}}, {id: 1, cpus: []int{4, 5, 6, 7}}}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes mismatch: have %v, want %v", nodes, want)
+	}
+	if _, err := numaTopology(t.TempDir()); err != errNoNUMANodes {
+		t.Errorf("empty topology error mismatch: have %v, want %v", err, errNoNUMANodes)
+	}
+	if _, err := newNUMAPlacement("spread", root, log.Root()); err == nil {
+		t.Errorf("invalid policy accepted")
+	}
+}
+
+// testNUMAPlacement creates a placement on two fake nodes sharing the first CPU.
+func testNUMAPlacement(policy string) *numaPlacement {
+	return &numaPlacement{
+		policy: policy,
+		nodes:  []numaNode{{id: 0, cpus: []int{0}}, {id: 1, cpus: []int{0}}},
+		log:    log.Root(),
+	}
+}
+
+// Tests that datasets are replicated per node or interleaved across the nodes
+// depending on the policy.
+func TestNUMADatasetPlacement(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	d := hmhash.dataset(nil, 0, false)
+
+	if have := testNUMAPlacement(NUMAPin).place(d, 1); have != d {
+		t.Errorf("pinned placement copied the dataset")
+	}
+	replicate := testNUMAPlacement(NUMAReplicate)
+	first, second := replicate.place(d, 0), replicate.place(d, 1)
+	if first == d || second == d || first == second {
+		t.Fatalf("dataset not replicated per node")
+	}
+	if replicate.place(d, 0) != first {
+		t.Errorf("node replica recreated")
+	}
+	interleave := testNUMAPlacement(NUMAInterleave)
+	shared := interleave.place(d, 0)
+	if shared == d || interleave.place(d, 1) != shared {
+		t.Fatalf("dataset not interleaved once")
+	}
+	for _, c := range []*dataset{first, second, shared} {
+		if !reflect.DeepEqual(c.dataset, d.dataset) {
+			t.Errorf("placed dataset content mismatch")
+		}
+	}
+}
+
+// Tests that blocks are sealed by mining threads placed on NUMA nodes.
+func TestNUMASealing(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	hmhash.numa = testNUMAPlacement(NUMAReplicate)
+	hmhash.SetThreads(2)
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case block := <-results:
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Errorf("sealed block invalid: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("sealing timed out")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errPartialDataset is returned when the full mining dataset is needed but only
+// a part of it is kept in memory.
+var errPartialDataset = errors.New("only a part of the DAG is kept in memory")
+
+// partialDatasetWords returns the number of uint32s of a dataset of the given size
+// kept in memory by a partial dataset. At least the items read by ProgPoW from
+// its cached portion of the dataset are kept.
+func partialDatasetWords(size uint64, fraction float64) uint64 {
+	items := uint64(float64(size/hashBytes) * fraction)
+	if min := uint64(progpowCacheWords / hashWords); items < min {
+		items = min
+	}
+	if max := size / hashBytes; items > max {
+		items = max
+	}
+	return items * hashWords
+}
+
+// partialLookup returns a lookup of dataset items served from the leading items
+// of the dataset kept in memory, computing the others from the cache. The items
+// returned are only valid until the next lookup.
+func partialLookup(algo HashAlgo, cache []uint32, dataset []uint32) func(index uint32) []uint32 {
+	var (
+		hash512 = makeHasher(algo.New512())
+		held    = uint32(len(dataset) / hashWords)
+		item    = make([]uint32, hashWords)
+	)
+	return func(index uint32) []uint32 {
+		if index < held {
+			return dataset[index*hashWords : (index+1)*hashWords]
+		}
+		rawData := generateDatasetItem(cache, index, hash512)
+		for i := range item {
+			item[i] = binary.LittleEndian.Uint32(rawData[i*4:])
+		}
+		return item
+	}
+}
+
+// hashimotoPartial aggregates data from the full dataset, using the part of it
+// kept in memory and computing the rest from the cache, in order to produce our
+// final value for a particular header hash and nonce.
+func hashimotoPartial(algo HashAlgo, size uint64, cache []uint32, dataset []uint32, hash []byte, nonce uint64) ([]byte, []byte) {
+	return hashimoto(algo, hash, nonce, size, partialLookup(algo, cache, dataset))
+}
+
+// progpowPartial is the ProgPoW counterpart of hashimotoPartial.
+func progpowPartial(algo HashAlgo, size uint64, cache []uint32, dataset []uint32, hash []byte, nonce uint64, number uint64) ([]byte, []byte) {
+	var (
+		lookup = partialLookup(algo, cache, dataset)
+		entry  = make([]uint32, progpowEntryBytes/4)
+	)
+	return progpow(hash, nonce, size, number, dataset[:progpowCacheWords], func(index uint32) []uint32 {
+		for i := uint32(0); i < progpowEntryItems; i++ {
+			copy(entry[i*hashWords:], lookup(index*progpowEntryItems+i))
+		}
+		return entry
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that partial datasets produce the same proof-of-work as full ones, for
+// both hashimoto and ProgPoW.
+func TestPartialDataset(t *testing.T) {
+	rules := &params.EthashConfig{ProgpowBlock: big.NewInt(epochLength)}
+
+	full := New(Config{PowMode: ModeTest}, nil, false)
+	defer full.Close()
+
+	partial := New(Config{PowMode: ModeTest, DatasetFraction: 0.25, DatasetDir: t.TempDir()}, nil, false)
+	defer partial.Close()
+
+	hash := bytes.Repeat([]byte{0x42}, 32)
+	for _, block := range []uint64{0, epochLength} {
+		have, want := partial.dataset(rules, block, false), full.dataset(rules, block, false)
+		if !have.partial() || want.partial() {
+			t.Fatalf("block %d: partial flags mismatch: have %v, want true", block, have.partial())
+		}
+		if len(have.dataset) >= len(want.dataset) {
+			t.Fatalf("block %d: partial dataset not smaller: have %d, full %d", block, len(have.dataset), len(want.dataset))
+		}
+		for nonce := uint64(0); nonce < 16; nonce++ {
+			digest, result := partial.powFull(rules, have, block, hash, nonce)
+			wantDigest, wantResult := full.powFull(rules, want, block, hash, nonce)
+			if !bytes.Equal(digest, wantDigest) || !bytes.Equal(result, wantResult) {
+				t.Fatalf("block %d nonce %d: proof-of-work mismatch", block, nonce)
+			}
+		}
+	}
+	// Partial datasets can't be exported
+	if err := partial.ExportDAG(0, "dag"); err != errPartialDataset {
+		t.Errorf("export error mismatch: have %v, want %v", err, errPartialDataset)
+	}
+}
+
+// Tests that partial datasets keep at least the portion cached by ProgPoW, and
+// never more than the full dataset.
+func TestPartialDatasetWords(t *testing.T) {
+	tests := []struct {
+		size     uint64
+		fraction float64
+		want     uint64
+	}{
+		{1 << 20, 0.5, 1 << 17},
+		{1 << 20, 0.001, progpowCacheWords},
+		{testDatasetSize, 0.75, testDatasetSize * 3 / 16},
+		{progpowCacheBytes / 2, 0.5, progpowCacheWords / 2},
+	}
+	for i, tt := range tests {
+		if have := partialDatasetWords(tt.size, tt.fraction); have != tt.want {
+			t.Errorf("test %d: words mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// DefaultPayoutScheme is the name of the payout scheme used if none is set.
+const DefaultPayoutScheme = "pplns"
+
+// defaultPPLNSWindow is the number of last shares credited by the PPLNS scheme
+// if none is set.
+const defaultPPLNSWindow = 10000
+
+// defaultPayoutMaturity is the number of confirmations a block found by the
+// pool needs for its round to mature if the config leaves it unset.
+const defaultPayoutMaturity = 100
+
+// Maturity states of the payout rounds.
+const (
+	RoundPending  = "pending"  // Block not confirmed deep enough yet
+	RoundMature   = "mature"   // Block confirmed deep enough in the canonical chain, the round can be paid out
+	RoundOrphaned = "orphaned" // Block reorganized out of the canonical chain, the round earns nothing
+)
+
+// orphanedRoundMeter counts the payout rounds whose block was orphaned.
+var orphanedRoundMeter = metrics.NewRegisteredMeter("hmhash/payouts/orphaned", nil)
+
+var errInvalidPayoutScheme = errors.New("invalid payout scheme")
+
+// PayoutScheme splits the reward of the blocks found by the built-in pool
+// between the workers, implemented by operators for custom schemes.
+type PayoutScheme interface {
+	// Name returns the textual form of the scheme, accepted by
+	// ParsePayoutScheme for the built-in ones.
+	Name() string
+
+	// Window returns the number of shares of earlier rounds the scheme may
+	// credit besides those of the round itself.
+	Window() int
+
+	// Credit returns the amounts credited to the workers for a round ended by a
+	// block of the given reward. The shares of the round are ordered by
+	// submission, the last one sealing the block, and preceded by up to Window
+	// shares of earlier rounds.
+	Credit(previous, round []*Share, reward *big.Int) map[string]*big.Int
+}
+
+// ParsePayoutScheme creates a payout scheme from its textual form, one of
+// "pplns", "pplns:<shares>", "pps" or "proportional". An empty string selects
+// the default scheme.
+func ParsePayoutScheme(s string) (PayoutScheme, error) {
+	switch {
+	case s == "" || s == DefaultPayoutScheme:
+		return PPLNSPayouts(defaultPPLNSWindow)
+	case strings.HasPrefix(s, "pplns:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "pplns:"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", errInvalidPayoutScheme, s, err)
+		}
+		return PPLNSPayouts(n)
+	case s == "pps":
+		return PPSPayouts(), nil
+	case s == "proportional":
+		return ProportionalPayouts(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", errInvalidPayoutScheme, s)
+	}
+}
+
+// pplnsPayouts pays the reward for the last N shares up to the one sealing the
+// block, across rounds, in proportion to their difficulty.
+type pplnsPayouts struct {
+	n int // Number of last shares credited
+}
+
+// PPLNSPayouts returns a pay-per-last-N-shares scheme, discouraging pool
+// hopping by crediting the last n shares regardless of their round.
+func PPLNSPayouts(n int) (PayoutScheme, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: non-positive PPLNS window %d", errInvalidPayoutScheme, n)
+	}
+	return pplnsPayouts{n: n}, nil
+}
+
+func (s pplnsPayouts) Name() string {
+	if s.n == defaultPPLNSWindow {
+		return DefaultPayoutScheme
+	}
+	return fmt.Sprintf("pplns:%d", s.n)
+}
+
+func (s pplnsPayouts) Window() int { return s.n }
+
+func (s pplnsPayouts) Credit(previous, round []*Share, reward *big.Int) map[string]*big.Int {
+	shares := append(append([]*Share(nil), previous...), round...)
+	if len(shares) > s.n {
+		shares = shares[len(shares)-s.n:]
+	}
+	return splitByDifficulty(shares, reward)
+}
+
+// ppsPayouts pays every share its expected value, the block reward in
+// proportion to the share difficulty over the block difficulty, regardless of
+// the blocks actually found. The operator bears the variance of the rounds.
+type ppsPayouts struct{}
+
+// PPSPayouts returns a pay-per-share scheme, crediting every share of a round
+// its expected value. Shares recorded without the block difficulty aren't paid.
+func PPSPayouts() PayoutScheme { return ppsPayouts{} }
+
+func (ppsPayouts) Name() string { return "pps" }
+
+func (ppsPayouts) Window() int { return 0 }
+
+func (ppsPayouts) Credit(previous, round []*Share, reward *big.Int) map[string]*big.Int {
+	credits := make(map[string]*big.Int)
+	for _, share := range round {
+		if share.BlockDifficulty == nil || share.BlockDifficulty.Sign() <= 0 {
+			continue
+		}
+		amount := new(big.Int).Mul(reward, share.Difficulty)
+		amount.Div(amount, share.BlockDifficulty)
+		if credits[share.Worker] == nil {
+			credits[share.Worker] = new(big.Int)
+		}
+		credits[share.Worker].Add(credits[share.Worker], amount)
+	}
+	return credits
+}
+
+// proportionalPayouts pays the reward for the shares of the round in proportion
+// to their difficulty.
+type proportionalPayouts struct{}
+
+// ProportionalPayouts returns a proportional scheme, splitting the reward of a
+// block between the shares of its round.
+func ProportionalPayouts() PayoutScheme { return proportionalPayouts{} }
+
+func (proportionalPayouts) Name() string { return "proportional" }
+
+func (proportionalPayouts) Window() int { return 0 }
+
+func (proportionalPayouts) Credit(previous, round []*Share, reward *big.Int) map[string]*big.Int {
+	return splitByDifficulty(round, reward)
+}
+
+// splitByDifficulty splits an amount between the workers of the shares in
+// proportion to the share difficulty. Rounding dust isn't credited.
+func splitByDifficulty(shares []*Share, amount *big.Int) map[string]*big.Int {
+	var (
+		total   = new(big.Int)
+		weights = make(map[string]*big.Int)
+	)
+	for _, share := range shares {
+		if weights[share.Worker] == nil {
+			weights[share.Worker] = new(big.Int)
+		}
+		weights[share.Worker].Add(weights[share.Worker], share.Difficulty)
+		total.Add(total, share.Difficulty)
+	}
+	credits := make(map[string]*big.Int, len(weights))
+	if total.Sign() == 0 {
+		return credits
+	}
+	for worker, weight := range weights {
+		credit := new(big.Int).Mul(amount, weight)
+		credits[worker] = credit.Div(credit, total)
+	}
+	return credits
+}
+
+// PayoutRound is a ledger entry of the built-in pool: a round of shares ended by
+// a block found, and the payouts of its reward to the workers.
+type PayoutRound struct {
+	Number   hexutil.Uint64          `json:"number"`   // Number of the block found
+	Hash     common.Hash             `json:"hash"`     // Hash of the block found
+	SealHash common.Hash             `json:"sealHash"` // Seal hash of the block found
+	Status   string                  `json:"status"`   // Maturity of the block, one of the Round constants
+	Finder   string                  `json:"finder"`   // Worker which found the block
+	Time     hexutil.Uint64          `json:"time"`     // Unix timestamp of the block solution
+	Shares   hexutil.Uint64          `json:"shares"`   // Shares submitted in the round
+	Reward   *hexutil.Big            `json:"reward"`   // Block reward split between the workers
+	Payouts  map[string]*hexutil.Big `json:"payouts"`  // Amounts credited by worker name
+}
+
+// payoutRound is a round of shares closed by a block.
+type payoutRound struct {
+	previous []*Share // Shares of earlier rounds within the window of the scheme
+	shares   []*Share // Shares of the round, the last of which sealed the block
+	status   string   // Maturity of the block, one of the Round constants
+}
+
+// payoutLedger splits the shares into rounds ended by the blocks found, keeping
+// the shares the payout scheme credits. It's guarded by the lock of the share
+// tracker.
+type payoutLedger struct {
+	scheme  PayoutScheme
+	history []*Share       // Shares of the open round, preceded by up to the window of earlier ones
+	start   int            // Index of the first share of the open round in the history
+	rounds  []*payoutRound // Rounds closed by a block, oldest first
+}
+
+// newPayoutLedger creates an empty ledger paying out with the given scheme.
+func newPayoutLedger(scheme PayoutScheme) *payoutLedger {
+	return &payoutLedger{scheme: scheme}
+}
+
+// add records a share, closing the open round if it sealed a block.
+func (l *payoutLedger) add(share *Share) {
+	l.history = append(l.history, share)
+	if !share.Block {
+		return
+	}
+	end := len(l.history)
+	l.rounds = append(l.rounds, &payoutRound{
+		previous: l.history[:l.start:l.start],
+		shares:   l.history[l.start:end:end],
+		status:   RoundPending,
+	})
+	// Start a new round, keeping the window of the scheme
+	keep := l.scheme.Window()
+	if keep > end {
+		keep = end
+	}
+	l.history = append([]*Share(nil), l.history[end-keep:]...)
+	l.start = len(l.history)
+}
+
+// confirm settles the maturity of the pending rounds whose block is at least
+// depth blocks below the head, mature if it's the canonical block at its height
+// and orphaned otherwise. Rounds of shares recorded without the block hash can't
+// be checked and mature at depth.
+func (l *payoutLedger) confirm(head, depth uint64, canonical func(number uint64) *types.Header, logger log.Logger) {
+	for _, round := range l.rounds {
+		block := round.shares[len(round.shares)-1]
+		if round.status != RoundPending || block.Number+depth > head {
+			continue
+		}
+		switch header := canonical(block.Number); {
+		case block.BlockHash == (common.Hash{}):
+			round.status = RoundMature
+		case header == nil:
+			continue
+		case header.Hash() == block.BlockHash:
+			round.status = RoundMature
+			logger.Debug("Pool round matured", "number", block.Number, "hash", block.BlockHash, "finder", block.Worker)
+		default:
+			round.status = RoundOrphaned
+			orphanedRoundMeter.Mark(1)
+			logger.Warn("Pool round orphaned", "number", block.Number, "hash", block.BlockHash, "canonical", header.Hash(), "finder", block.Worker)
+		}
+	}
+}
+
+// payouts returns the ledger entries of the rounds ended by blocks from the
+// given number on, with the block rewards returned by the reward function.
+func (l *payoutLedger) payouts(from uint64, reward func(number uint64) *big.Int) []PayoutRound {
+	entries := make([]PayoutRound, 0)
+	for _, round := range l.rounds {
+		block := round.shares[len(round.shares)-1]
+		if block.Number < from {
+			continue
+		}
+		amount := reward(block.Number)
+		entry := PayoutRound{
+			Number:   hexutil.Uint64(block.Number),
+			Hash:     block.BlockHash,
+			SealHash: block.SealHash,
+			Status:   round.status,
+			Finder:   block.Worker,
+			Time:     hexutil.Uint64(block.Time),
+			Shares:   hexutil.Uint64(len(round.shares)),
+			Reward:   (*hexutil.Big)(new(big.Int).Set(amount)),
+			Payouts:  make(map[string]*hexutil.Big),
+		}
+		for worker, credit := range l.scheme.Credit(round.previous, round.shares, amount) {
+			entry.Payouts[worker] = (*hexutil.Big)(credit)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// PayoutLedger returns the payout ledger of the rounds ended by blocks from the
+// given number on, with the block rewards returned by the reward function, or
+// an error if share accounting is disabled. The maturity of the rounds is
+// settled against the given chain first, only mature rounds are to be paid.
+func (hmhash *Hmhash) PayoutLedger(chain consensus.ChainHeaderReader, from uint64, reward func(number uint64) *big.Int) ([]PayoutRound, error) {
+	if hmhash.shares == nil {
+		return nil, errSharesDisabled
+	}
+	if head := chain.CurrentHeader(); head != nil {
+		depth := hmhash.config.PayoutMaturity
+		if depth == 0 {
+			depth = defaultPayoutMaturity
+		}
+		hmhash.shares.confirm(head.Number.Uint64(), depth, chain.GetHeaderByNumber)
+	}
+	return hmhash.shares.payouts(from, reward), nil
+}
+
+// PoolAPI exposes the payout ledger of the built-in pool for the RPC interface.
+type PoolAPI struct {
+	hmhash *Hmhash
+	chain  consensus.ChainHeaderReader
+}
+
+// GetPayoutLedger returns the rounds ended by the blocks found by the pool from
+// the given number on, or all if omitted, with the payouts of the base block
+// reward to the workers for payment on-chain once the rounds are mature.
+// Transaction fees and uncle inclusion rewards aren't split.
+func (api *PoolAPI) GetPayoutLedger(from *hexutil.Uint64) ([]PayoutRound, error) {
+	var number uint64
+	if from != nil {
+		number = uint64(*from)
+	}
+	schedule := NewRewardSchedule(api.chain.Config())
+	return api.hmhash.PayoutLedger(api.chain, number, func(number uint64) *big.Int {
+		return schedule.Reward(new(big.Int).SetUint64(number)).Reward
+	})
+}
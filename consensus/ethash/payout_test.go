@@ -0,0 +1,210 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests the textual form of the payout schemes.
+func TestParsePayoutScheme(t *testing.T) {
+	for _, name := range []string{"pplns", "pplns:500", "pps", "proportional"} {
+		scheme, err := ParsePayoutScheme(name)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", name, err)
+		}
+		if scheme.Name() != name {
+			t.Errorf("name mismatch: have %q, want %q", scheme.Name(), name)
+		}
+	}
+	if scheme, err := ParsePayoutScheme(""); err != nil || scheme.Name() != DefaultPayoutScheme {
+		t.Errorf("default scheme mismatch: have %v, %v", scheme, err)
+	}
+	for _, name := range []string{"pplns:0", "pplns:x", "solo"} {
+		if _, err := ParsePayoutScheme(name); !errors.Is(err, errInvalidPayoutScheme) {
+			t.Errorf("%q: error mismatch: have %v, want %v", name, err, errInvalidPayoutScheme)
+		}
+	}
+}
+
+// Tests that the payout schemes split the rounds as specified.
+func TestPayoutSchemes(t *testing.T) {
+	share := func(worker string, difficulty int64, block bool) *Share {
+		return &Share{Worker: worker, Number: 10, Difficulty: big.NewInt(difficulty), Block: block, BlockDifficulty: big.NewInt(1000)}
+	}
+	var (
+		previous = []*Share{share("alice", 100, false), share("bob", 100, true), share("carol", 100, false)}
+		round    = []*Share{share("alice", 200, false), share("bob", 100, false), share("bob", 100, true)}
+		reward   = big.NewInt(1200)
+	)
+	pplns, _ := PPLNSPayouts(4)
+	tests := []struct {
+		scheme PayoutScheme
+		want   map[string]int64
+	}{
+		// Last 4 shares: carol 100, alice 200, bob 200
+		{pplns, map[string]int64{"alice": 480, "bob": 480, "carol": 240}},
+		// Round shares only: alice 200, bob 200
+		{ProportionalPayouts(), map[string]int64{"alice": 600, "bob": 600}},
+		// Every round share pays reward * difficulty / 1000
+		{PPSPayouts(), map[string]int64{"alice": 240, "bob": 240}},
+	}
+	for _, tt := range tests {
+		have := tt.scheme.Credit(previous, round, reward)
+		if len(have) != len(tt.want) {
+			t.Errorf("%s: payouts mismatch: have %v, want %v", tt.scheme.Name(), have, tt.want)
+			continue
+		}
+		for worker, amount := range tt.want {
+			if have[worker] == nil || have[worker].Int64() != amount {
+				t.Errorf("%s: payout of %s mismatch: have %v, want %d", tt.scheme.Name(), worker, have[worker], amount)
+			}
+		}
+	}
+}
+
+// Tests that the ledger closes the rounds on blocks found and restores them from
+// the persisted shares.
+func TestPayoutLedger(t *testing.T) {
+	db := memorydb.New()
+	scheme, _ := PPLNSPayouts(3)
+	tracker, err := newShareTracker(1000, 0, scheme, NewShareStore(db), log.Root())
+	if err != nil {
+		t.Fatalf("failed to create share tracker: %v", err)
+	}
+	var (
+		target     = new(big.Int).Div(two256, big.NewInt(1000))
+		difficulty = big.NewInt(4000)
+	)
+	submit := func(worker string, number uint64, nonce uint64, block bool) {
+		t.Helper()
+		if err := tracker.add(worker, &types.Header{Number: new(big.Int).SetUint64(number), Nonce: types.EncodeNonce(nonce), Difficulty: difficulty}, common.Hash{byte(number)}, target, block, 7); err != nil {
+			t.Fatalf("failed to add share: %v", err)
+		}
+	}
+	submit("alice", 1, 1, false)
+	submit("alice", 1, 2, false)
+	submit("bob", 1, 3, true)
+	submit("bob", 2, 1, false)
+	submit("carol", 2, 2, true)
+	submit("alice", 3, 1, false) // Open round, not paid out
+
+	reward := func(number uint64) *big.Int { return big.NewInt(int64(number) * 300) }
+	check := func(tracker *shareTracker) {
+		t.Helper()
+
+		rounds := tracker.payouts(0, reward)
+		if len(rounds) != 2 {
+			t.Fatalf("rounds mismatch: have %d, want 2", len(rounds))
+		}
+		if r := rounds[0]; r.Number != 1 || r.Finder != "bob" || r.Shares != 3 || r.Reward.ToInt().Int64() != 300 ||
+			r.Payouts["alice"].ToInt().Int64() != 200 || r.Payouts["bob"].ToInt().Int64() != 100 {
+			t.Errorf("first round mismatch: %+v", r)
+		}
+		if r := rounds[1]; r.Number != 2 || r.Finder != "carol" || r.Shares != 2 || len(r.Payouts) != 2 ||
+			r.Payouts["bob"].ToInt().Int64() != 400 || r.Payouts["carol"].ToInt().Int64() != 200 {
+			t.Errorf("second round mismatch: %+v", r)
+		}
+		if rounds := tracker.payouts(2, reward); len(rounds) != 1 || rounds[0].Number != 2 {
+			t.Errorf("rounds from block 2 mismatch: %+v", rounds)
+		}
+	}
+	check(tracker)
+
+	restored, err := newShareTracker(1000, 0, scheme, NewShareStore(db), log.Root())
+	if err != nil {
+		t.Fatalf("failed to restore share tracker: %v", err)
+	}
+	check(restored)
+}
+
+// Tests that the rounds mature once their block is confirmed deep enough in the
+// canonical chain and are orphaned if it was reorganized out.
+func TestPayoutMaturity(t *testing.T) {
+	scheme := PPSPayouts()
+	tracker, err := newShareTracker(1000, 0, scheme, NewShareStore(memorydb.New()), log.Root())
+	if err != nil {
+		t.Fatalf("failed to create share tracker: %v", err)
+	}
+	var (
+		target    = new(big.Int).Div(two256, big.NewInt(1000))
+		canonical = make(map[uint64]*types.Header)
+	)
+	for number := uint64(1); number <= 3; number++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Nonce: types.EncodeNonce(number), Difficulty: big.NewInt(4000)}
+		if err := tracker.add("alice", header, common.Hash{byte(number)}, target, true, 7); err != nil {
+			t.Fatalf("failed to add share: %v", err)
+		}
+		canonical[number] = header
+	}
+	// Block 2 is replaced by a sibling in the canonical chain
+	canonical[2] = &types.Header{Number: big.NewInt(2), Nonce: types.EncodeNonce(100), Difficulty: big.NewInt(4000)}
+	lookup := func(number uint64) *types.Header { return canonical[number] }
+
+	status := func() []string {
+		var statuses []string
+		for _, round := range tracker.payouts(0, func(uint64) *big.Int { return big.NewInt(1) }) {
+			statuses = append(statuses, round.Status)
+		}
+		return statuses
+	}
+	tracker.confirm(11, 10, lookup)
+	if have := status(); !reflect.DeepEqual(have, []string{RoundMature, RoundPending, RoundPending}) {
+		t.Errorf("statuses at head 11 mismatch: have %v", have)
+	}
+	tracker.confirm(13, 10, lookup)
+	if have := status(); !reflect.DeepEqual(have, []string{RoundMature, RoundOrphaned, RoundMature}) {
+		t.Errorf("statuses at head 13 mismatch: have %v", have)
+	}
+	// Settled rounds stay so, even if the chain reorganizes again
+	canonical[2], canonical[3] = canonical[3], nil
+	tracker.confirm(20, 10, lookup)
+	if have := status(); !reflect.DeepEqual(have, []string{RoundMature, RoundOrphaned, RoundMature}) {
+		t.Errorf("statuses after reorg mismatch: have %v", have)
+	}
+}
+
+// Tests that the pool API pays out the base block reward of the chain.
+func TestPoolAPI(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, ShareDifficulty: 1, PayoutScheme: "proportional"}, nil, true)
+	defer hmhash.Close()
+
+	target := new(big.Int).Div(two256, big.NewInt(1))
+	hmhash.shares.add("alice", &types.Header{Number: big.NewInt(5), Nonce: types.EncodeNonce(1), Difficulty: big.NewInt(1)}, common.Hash{5}, target, true, 7)
+
+	api := &PoolAPI{hmhash, &testHeaderChain{config: params.TestChainConfig}}
+	rounds, err := api.GetPayoutLedger(nil)
+	if err != nil {
+		t.Fatalf("failed to get ledger: %v", err)
+	}
+	if len(rounds) != 1 || rounds[0].Payouts["alice"].ToInt().Cmp(ConstantinopleBlockReward) != 0 {
+		t.Errorf("ledger mismatch: %+v", rounds)
+	}
+	disabled := New(Config{PowMode: ModeTest}, nil, true)
+	defer disabled.Close()
+	if _, err := (&PoolAPI{disabled, api.chain}).GetPayoutLedger(nil); err != errSharesDisabled {
+		t.Errorf("error mismatch: have %v, want %v", err, errSharesDisabled)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"sync"
+)
+
+// pregenRequest is a chain progress report sent to the pregenerator.
+type pregenRequest struct {
+	block   uint64 // Block number that was verified or sealed
+	dataset bool   // Whether the full dataset was needed (i.e. mining)
+}
+
+// pregenerator watches the chain progress reported by verification and sealing
+// and generates the verification cache (and mining dataset, if mining) of the
+// next epoch in the background, so that neither stalls at the epoch boundary.
+type pregenerator struct {
+	hmhash   *Hmhash
+	distance uint64 // Number of blocks before the transition to start generating
+
+	progressCh  chan pregenRequest // Notification channel for chain progress
+	requestExit chan struct{}
+	exitCh      chan struct{}
+	closeOnce   sync.Once
+}
+
+// startPregenerator creates a pregenerator and starts its background thread.
+func startPregenerator(hmhash *Hmhash, distance uint64) *pregenerator {
+	p := &pregenerator{
+		hmhash:      hmhash,
+		distance:    distance,
+		progressCh:  make(chan pregenRequest, 16),
+		requestExit: make(chan struct{}),
+		exitCh:      make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+// observe reports a block number used for verification or sealing. It never
+// blocks, dropping the report if the pregenerator is busy.
+func (p *pregenerator) observe(block uint64, dataset bool) {
+	select {
+	case p.progressCh <- pregenRequest{block: block, dataset: dataset}:
+	default:
+	}
+}
+
+// stop terminates the background thread and waits for it to exit. Any ongoing
+// generation is finished first, since it cannot be interrupted.
+func (p *pregenerator) stop() {
+	p.closeOnce.Do(func() {
+		close(p.requestExit)
+		<-p.exitCh
+	})
+}
+
+func (p *pregenerator) loop() {
+	defer close(p.exitCh)
+
+	var cacheEpoch, datasetEpoch uint64 // Last pregenerated epochs (0 is never pregenerated)
+	for {
+		select {
+		case req := <-p.progressCh:
+			if epochLength-req.block%epochLength > p.distance {
+				continue
+			}
+			next := req.block/epochLength + 1
+			if next != cacheEpoch {
+				cacheEpoch = next
+				p.generateCache(next)
+			}
+			if req.dataset && next != datasetEpoch {
+				datasetEpoch = next
+				p.generateDataset(next)
+			}
+
+		case <-p.requestExit:
+			return
+		}
+	}
+}
+
+// generateCache pregenerates the verification cache of the given epoch.
+func (p *pregenerator) generateCache(epoch uint64) {
+	var (
+		config = p.hmhash.config
+		block  = epoch * epochLength
+	)
+	p.hmhash.logs.dataset.Debug("Pregenerating hmhash cache", logEpoch, epoch)
+
+	c := p.hmhash.caches.prefetch(epoch)
+	c.generate(config.CacheDir, config.CachesOnDisk, config.CachesLockMmap, p.hmhash.cacheSize(block))
+}
+
+// generateDataset pregenerates the mining dataset of the given epoch.
+func (p *pregenerator) generateDataset(epoch uint64) {
+	var (
+		config = p.hmhash.config
+		block  = epoch * epochLength
+	)
+	p.hmhash.logs.dataset.Info("Pregenerating hmhash DAG", logEpoch, epoch)
+
+	d := p.hmhash.datasets.prefetch(epoch)
+	d.generate(config.DatasetDir, config.DatasetsOnDisk, config.DatasetsLockMmap, p.hmhash.cacheSize(block), p.hmhash.datasetSize(block))
+}
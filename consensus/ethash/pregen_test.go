@@ -0,0 +1,65 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that approaching an epoch transition pregenerates the next epoch's cache
+// without evicting the current one from memory.
+func TestPregeneration(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, CachesInMem: 1, PregenerationDistance: 100}, nil, false)
+	defer hmhash.Close()
+
+	// Far from the transition, nothing should be pregenerated
+	current := hmhash.cache(nil, epochLength-500)
+	time.Sleep(100 * time.Millisecond)
+
+	hmhash.caches.mu.Lock()
+	future := hmhash.caches.futureItem
+	hmhash.caches.mu.Unlock()
+	if future != nil {
+		t.Fatalf("cache pregenerated too early for epoch %d", future.epoch)
+	}
+	// Close to the transition, the next epoch should be pregenerated
+	hmhash.cache(nil, epochLength-50)
+	for i := 0; ; i++ {
+		hmhash.caches.mu.Lock()
+		future = hmhash.caches.futureItem
+		hmhash.caches.mu.Unlock()
+		if future != nil && future.cache != nil {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("next epoch cache not pregenerated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if future.epoch != 1 {
+		t.Fatalf("pregenerated epoch mismatch: have %d, want %d", future.epoch, 1)
+	}
+	// Pregeneration must not evict the current cache, and crossing the transition
+	// must reuse the pregenerated one
+	if prev := hmhash.cache(nil, epochLength-1); prev != current {
+		t.Errorf("current cache evicted by pregeneration")
+	}
+	if next := hmhash.cache(nil, epochLength); next != future {
+		t.Errorf("pregenerated cache not reused")
+	}
+}
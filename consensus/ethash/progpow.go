@@ -0,0 +1,376 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProgPoW (version 0.9.4) replaces the hashimoto inner loop with a random
+// program that changes every progpowPeriod blocks, operating on the same
+// dataset as the original proof-of-work. The program is designed to use the
+// whole of a commodity GPU, removing the advantage of specialized hardware.
+const (
+	progpowPeriod     = 10        // Blocks per random program
+	progpowLanes      = 16        // Parallel lanes that coordinate to calculate a single hash
+	progpowRegs       = 32        // Register file size of each lane
+	progpowDagLoads   = 4         // Words loaded from the dataset by each lane per loop
+	progpowCacheBytes = 16 * 1024 // Size of the cached portion of the dataset
+	progpowCntDag     = 64        // Number of dataset accesses, same as hashimoto
+	progpowCntCache   = 11        // Number of cache accesses per loop
+	progpowCntMath    = 18        // Number of math operations per loop
+
+	progpowCacheWords = progpowCacheBytes / 4              // Words in the cached portion of the dataset
+	progpowEntryBytes = progpowLanes * progpowDagLoads * 4 // Bytes loaded from the dataset per loop
+	progpowEntryItems = progpowEntryBytes / hashBytes      // Dataset items loaded per loop
+	progpowFnvOffset  = 0x811c9dc5                         // FNV-1a offset basis
+	progpowFnvPrime   = 0x01000193                         // FNV-1a prime
+	progpowPadFirst   = 0x00000001                         // Keccak-f[800] multi-rate padding start
+	progpowPadLast    = 0x80008081                         // Keccak-f[800] multi-rate padding end
+)
+
+// keccakf800RoundConstants are the round constants of Keccak-f[800].
+var keccakf800RoundConstants = [22]uint32{
+	0x00000001, 0x00008082, 0x0000808a, 0x80008000, 0x0000808b, 0x80000001,
+	0x80008081, 0x00008009, 0x0000008a, 0x00000088, 0x80008009, 0x8000000a,
+	0x8000808b, 0x0000008b, 0x00008089, 0x00008003, 0x00008002, 0x00000080,
+	0x0000800a, 0x8000000a, 0x80008081, 0x00008080,
+}
+
+// keccakf800 is the Keccak-f[800] permutation, a 32 bit word variant of the
+// Keccak-f[1600] permutation underlying SHA3.
+func keccakf800(st *[25]uint32) {
+	var bc [5]uint32
+	for r := 0; r < len(keccakf800RoundConstants); r++ {
+		// Theta
+		for i := 0; i < 5; i++ {
+			bc[i] = st[i] ^ st[i+5] ^ st[i+10] ^ st[i+15] ^ st[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := bc[(i+4)%5] ^ bits.RotateLeft32(bc[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				st[j+i] ^= t
+			}
+		}
+		// Rho Pi
+		t := st[1]
+		for i, j := range keccakPiLane {
+			bc[0] = st[j]
+			st[j] = bits.RotateLeft32(t, keccakRotc[i]%32)
+			t = bc[0]
+		}
+		// Chi
+		for j := 0; j < 25; j += 5 {
+			for i := 0; i < 5; i++ {
+				bc[i] = st[j+i]
+			}
+			for i := 0; i < 5; i++ {
+				st[j+i] ^= ^bc[(i+1)%5] & bc[(i+2)%5]
+			}
+		}
+		// Iota
+		st[0] ^= keccakf800RoundConstants[r]
+	}
+}
+
+// Rotation offsets and lane order of the Keccak rho and pi steps.
+var (
+	keccakRotc   = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	keccakPiLane = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+// fnv1a hashes data into h using the FNV-1a method on 32 bit words.
+func fnv1a(h *uint32, data uint32) uint32 {
+	*h = (*h ^ data) * progpowFnvPrime
+	return *h
+}
+
+// kiss99 is the KISS99 pseudorandom generator by George Marsaglia, chosen for
+// being simple to implement in GPU kernels.
+type kiss99 struct {
+	z, w, jsr, jcong uint32
+}
+
+// next returns the next pseudorandom number of the generator.
+func (k *kiss99) next() uint32 {
+	k.z = 36969*(k.z&65535) + (k.z >> 16)
+	k.w = 18000*(k.w&65535) + (k.w >> 16)
+	mwc := (k.z << 16) + k.w
+	k.jsr ^= k.jsr << 17
+	k.jsr ^= k.jsr >> 13
+	k.jsr ^= k.jsr << 5
+	k.jcong = 69069*k.jcong + 1234567
+	return (mwc ^ k.jcong) + k.jsr
+}
+
+// progpowFillMix initializes the registers of a lane from the hash seed.
+func progpowFillMix(seed uint64, lane uint32, mix *[progpowRegs]uint32) {
+	h := uint32(progpowFnvOffset)
+
+	var rnd kiss99
+	rnd.z = fnv1a(&h, uint32(seed))
+	rnd.w = fnv1a(&h, uint32(seed>>32))
+	rnd.jsr = fnv1a(&h, lane)
+	rnd.jcong = fnv1a(&h, lane)
+	for i := range mix {
+		mix[i] = rnd.next()
+	}
+}
+
+// progpowInit seeds the random program generator of a period and shuffles the
+// register sequences the program merges into and reads from.
+func progpowInit(period uint64) (kiss99, [progpowRegs]uint32, [progpowRegs]uint32) {
+	h := uint32(progpowFnvOffset)
+
+	var rnd kiss99
+	rnd.z = fnv1a(&h, uint32(period))
+	rnd.w = fnv1a(&h, uint32(period>>32))
+	rnd.jsr = fnv1a(&h, uint32(period))
+	rnd.jcong = fnv1a(&h, uint32(period>>32))
+
+	// Create a random sequence of registers via a Fisher-Yates shuffle
+	var dst, src [progpowRegs]uint32
+	for i := range dst {
+		dst[i], src[i] = uint32(i), uint32(i)
+	}
+	for i := uint32(progpowRegs - 1); i > 0; i-- {
+		j := rnd.next() % (i + 1)
+		dst[i], dst[j] = dst[j], dst[i]
+		j = rnd.next() % (i + 1)
+		src[i], src[j] = src[j], src[i]
+	}
+	return rnd, dst, src
+}
+
+// progpowMerge merges new data into a register, retaining the entropy of both.
+func progpowMerge(a *uint32, b uint32, r uint32) {
+	switch r % 4 {
+	case 0:
+		*a = (*a * 33) + b
+	case 1:
+		*a = (*a ^ b) * 33
+	case 2:
+		*a = bits.RotateLeft32(*a, int((r>>16)%31)+1) ^ b
+	case 3:
+		*a = bits.RotateLeft32(*a, -int((r>>16)%31)-1) ^ b
+	}
+}
+
+// progpowMath is a random math operation between two registers.
+func progpowMath(a, b, r uint32) uint32 {
+	switch r % 11 {
+	case 0:
+		return a + b
+	case 1:
+		return a * b
+	case 2:
+		hi, _ := bits.Mul32(a, b)
+		return hi
+	case 3:
+		if a < b {
+			return a
+		}
+		return b
+	case 4:
+		return bits.RotateLeft32(a, int(b%32))
+	case 5:
+		return bits.RotateLeft32(a, -int(b%32))
+	case 6:
+		return a & b
+	case 7:
+		return a | b
+	case 8:
+		return a ^ b
+	case 9:
+		return uint32(bits.LeadingZeros32(a) + bits.LeadingZeros32(b))
+	default:
+		return uint32(bits.OnesCount32(a) + bits.OnesCount32(b))
+	}
+}
+
+// progpowLoop executes a single iteration of the random program of a period.
+// The lookup function returns the dataset entry at the given index, consisting
+// of progpowDagLoads words for every lane.
+func progpowLoop(period uint64, loop uint32, mix *[progpowLanes][progpowRegs]uint32, entries uint32, lookup func(index uint32) []uint32, cdag []uint32) {
+	// On each loop iteration rotate which lane is the source of the dataset
+	// address, and shuffle which portion of the entry each lane accesses.
+	entry := lookup(mix[loop%progpowLanes][0] % entries)
+
+	var loads [progpowLanes][progpowDagLoads]uint32
+	for l := uint32(0); l < progpowLanes; l++ {
+		offset := ((l ^ loop) % progpowLanes) * progpowDagLoads
+		copy(loads[l][:], entry[offset:offset+progpowDagLoads])
+	}
+	rnd, dst, src := progpowInit(period)
+
+	var dstCnt, srcCnt int
+	for i := 0; i < progpowCntMath; i++ {
+		if i < progpowCntCache {
+			// Cached memory access, lanes access random words within the cached
+			// portion of the dataset
+			s := src[srcCnt%progpowRegs]
+			srcCnt++
+			d := dst[dstCnt%progpowRegs]
+			dstCnt++
+			sel := rnd.next()
+			for l := 0; l < progpowLanes; l++ {
+				offset := mix[l][s] % progpowCacheWords
+				progpowMerge(&mix[l][d], cdag[offset], sel)
+			}
+		}
+		// Random math between two distinct registers
+		srcRnd := rnd.next() % (progpowRegs * (progpowRegs - 1))
+		src1 := srcRnd % progpowRegs
+		src2 := srcRnd / progpowRegs
+		if src2 >= src1 {
+			src2++
+		}
+		sel1 := rnd.next()
+		d := dst[dstCnt%progpowRegs]
+		dstCnt++
+		sel2 := rnd.next()
+		for l := 0; l < progpowLanes; l++ {
+			data := progpowMath(mix[l][src1], mix[l][src2], sel1)
+			progpowMerge(&mix[l][d], data, sel2)
+		}
+	}
+	// Consume the dataset loads at the very end of the loop, always merging into
+	// the first register to feed the next address calculation
+	for i := 0; i < progpowDagLoads; i++ {
+		d := uint32(0)
+		if i != 0 {
+			d = dst[dstCnt%progpowRegs]
+			dstCnt++
+		}
+		sel := rnd.next()
+		for l := 0; l < progpowLanes; l++ {
+			progpowMerge(&mix[l][d], loads[l][i], sel)
+		}
+	}
+}
+
+// progpow aggregates data from the dataset using the random program of the
+// block's period in order to produce our final value for a particular header
+// hash and nonce.
+func progpow(hash []byte, nonce uint64, size uint64, number uint64, cdag []uint32, lookup func(index uint32) []uint32) ([]byte, []byte) {
+	// Absorb the header and nonce into the initial Keccak-f[800] state
+	var st [25]uint32
+	for i := 0; i < 8; i++ {
+		st[i] = binary.LittleEndian.Uint32(hash[i*4:])
+	}
+	st[8] = uint32(nonce)
+	st[9] = uint32(nonce >> 32)
+	st[10] = progpowPadFirst
+	st[18] = progpowPadLast
+	keccakf800(&st)
+
+	var seed [8]uint32
+	copy(seed[:], st[:8])
+
+	// Initialize the registers of all lanes and run the random program
+	var mix [progpowLanes][progpowRegs]uint32
+	for l := uint32(0); l < progpowLanes; l++ {
+		progpowFillMix(uint64(seed[1])<<32|uint64(seed[0]), l, &mix[l])
+	}
+	var (
+		period  = number / progpowPeriod
+		entries = uint32(size / progpowEntryBytes)
+	)
+	for i := uint32(0); i < progpowCntDag; i++ {
+		progpowLoop(period, i, &mix, entries, lookup, cdag)
+	}
+	// Reduce the registers to a per-lane digest, then all lanes to 256 bits
+	var lanes [progpowLanes]uint32
+	for l := range lanes {
+		lanes[l] = progpowFnvOffset
+		for i := 0; i < progpowRegs; i++ {
+			fnv1a(&lanes[l], mix[l][i])
+		}
+	}
+	var mixed [8]uint32
+	for i := range mixed {
+		mixed[i] = progpowFnvOffset
+	}
+	for l := range lanes {
+		fnv1a(&mixed[l%8], lanes[l])
+	}
+	digest := make([]byte, common.HashLength)
+	for i, val := range mixed {
+		binary.LittleEndian.PutUint32(digest[i*4:], val)
+	}
+	// Absorb the seed and the digest into the final Keccak-f[800] state
+	st = [25]uint32{}
+	copy(st[:8], seed[:])
+	copy(st[8:16], mixed[:])
+	st[16] = progpowPadFirst
+	st[24] = progpowPadLast
+	keccakf800(&st)
+
+	result := make([]byte, common.HashLength)
+	for i := 0; i < 8; i++ {
+		binary.BigEndian.PutUint32(result[i*4:], st[i])
+	}
+	return digest, result
+}
+
+// generateProgpowCache generates the cached portion of the dataset from the
+// verification cache, needed for light verification of ProgPoW seals.
+func generateProgpowCache(algo HashAlgo, cache []uint32) []uint32 {
+	hash512 := makeHasher(algo.New512())
+
+	cdag := make([]uint32, progpowCacheWords)
+	for i := 0; i < progpowCacheWords/hashWords; i++ {
+		item := generateDatasetItem(cache, uint32(i), hash512)
+		for j := 0; j < hashWords; j++ {
+			cdag[i*hashWords+j] = binary.LittleEndian.Uint32(item[j*4:])
+		}
+	}
+	return cdag
+}
+
+// progpowLight aggregates data from the full dataset (using only the small
+// in-memory cache and its pregenerated cached portion of the dataset) in order
+// to produce our final value for a particular header hash and nonce.
+func progpowLight(algo HashAlgo, size uint64, cache []uint32, cdag []uint32, hash []byte, nonce uint64, number uint64) ([]byte, []byte) {
+	hash512 := makeHasher(algo.New512())
+
+	entry := make([]uint32, progpowEntryBytes/4)
+	lookup := func(index uint32) []uint32 {
+		for i := uint32(0); i < progpowEntryItems; i++ {
+			item := generateDatasetItem(cache, index*progpowEntryItems+i, hash512)
+			for j := uint32(0); j < hashWords; j++ {
+				entry[i*hashWords+j] = binary.LittleEndian.Uint32(item[j*4:])
+			}
+		}
+		return entry
+	}
+	return progpow(hash, nonce, size, number, cdag, lookup)
+}
+
+// progpowFull aggregates data from the full dataset (using the full in-memory
+// dataset) in order to produce our final value for a particular header hash and
+// nonce.
+func progpowFull(dataset []uint32, hash []byte, nonce uint64, number uint64) ([]byte, []byte) {
+	lookup := func(index uint32) []uint32 {
+		offset := index * progpowEntryBytes / 4
+		return dataset[offset : offset+progpowEntryBytes/4]
+	}
+	return progpow(hash, nonce, uint64(len(dataset))*4, number, dataset[:progpowCacheWords], lookup)
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests the random number generators against the ProgPoW specification.
+func TestProgpowPrimitives(t *testing.T) {
+	h := uint32(0x811c9dc5)
+	if have := fnv1a(&h, 0xddd0a47b); have != 0xd37ee61a {
+		t.Errorf("fnv1a mismatch: have %#x, want %#x", have, 0xd37ee61a)
+	}
+	rnd := kiss99{z: 362436069, w: 521288629, jsr: 123456789, jcong: 380116160}
+	for i, want := range []uint32{769445856, 742012328, 2121196314, 2805620942} {
+		if have := rnd.next(); have != want {
+			t.Errorf("kiss99 output %d mismatch: have %d, want %d", i, have, want)
+		}
+	}
+	for i := 4; i < 99999; i++ {
+		rnd.next()
+	}
+	if have := rnd.next(); have != 941074834 {
+		t.Errorf("kiss99 output 100000 mismatch: have %d, want %d", have, 941074834)
+	}
+}
+
+// Tests that light and full ProgPoW verification produce the same results, and
+// that they differ from hashimoto and between periods.
+func TestProgpowLightFull(t *testing.T) {
+	cache := make([]uint32, 1024/4)
+	generateCache(keccakAlgo{}, cache, 0, make([]byte, 32))
+
+	dataset := make([]uint32, 32*1024/4)
+	generateDataset(keccakAlgo{}, dataset, 0, cache, nil)
+
+	hash := []byte("test hash of 32 bytes for seals.")
+	cdag := generateProgpowCache(keccakAlgo{}, cache)
+
+	digest, result := progpowLight(keccakAlgo{}, 32*1024, cache, cdag, hash, 0, 10)
+	fullDigest, fullResult := progpowFull(dataset, hash, 0, 10)
+	if !bytes.Equal(digest, fullDigest) || !bytes.Equal(result, fullResult) {
+		t.Fatalf("light/full mismatch: light %x/%x, full %x/%x", digest, result, fullDigest, fullResult)
+	}
+	if _, other := progpowFull(dataset, hash, 0, 20); bytes.Equal(result, other) {
+		t.Errorf("same result in different periods")
+	}
+	if _, other := progpowFull(dataset, hash, 0, 19); !bytes.Equal(result, other) {
+		t.Errorf("different result within the same period")
+	}
+	if _, other := hashimotoFull(keccakAlgo{}, dataset, hash, 0); bytes.Equal(result, other) {
+		t.Errorf("same result as hashimoto")
+	}
+}
+
+// Tests that blocks are sealed and verified with ProgPoW from the fork block on.
+func TestProgpowSealing(t *testing.T) {
+	chain := configReader{&params.ChainConfig{Ethash: &params.EthashConfig{ProgpowBlock: big.NewInt(2)}}}
+
+	hmhash := New(Config{PowMode: ModeTest}, nil, false)
+	defer hmhash.Close()
+
+	legacy := NewTester(nil, false)
+	defer legacy.Close()
+
+	for _, number := range []int64{1, 2} {
+		header := &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(100)}
+		results := make(chan *types.Block)
+		hmhash.Seal(chain, types.NewBlockWithHeader(header), results, nil)
+
+		var block *types.Block
+		select {
+		case block = <-results:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("block %d: sealing timed out", number)
+		}
+		if err := hmhash.verifySeal(context.Background(), chain, block.Header(), false); err != nil {
+			t.Errorf("block %d: light verification failed: %v", number, err)
+		}
+		if err := hmhash.verifySeal(context.Background(), chain, block.Header(), true); err != nil {
+			t.Errorf("block %d: full verification failed: %v", number, err)
+		}
+		err := legacy.verifySeal(context.Background(), nil, block.Header(), false)
+		if progpow := number >= 2; progpow == (err == nil) {
+			t.Errorf("block %d: hashimoto verification mismatch: err %v, progpow %v", number, err, progpow)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// proofChunkRows is the number of dataset rows below each node of the lowest
+// level kept of the dataset Merkle trees. The levels below are rehashed for each
+// proven element, sparing the memory of the whole tree.
+const proofChunkRows = 1024
+
+var (
+	errFakeProof         = errors.New("fake proof-of-work can't be proven")
+	errNotPoWSealed      = errors.New("block not sealed by its own proof-of-work")
+	errIncompleteProof   = errors.New("proof carries no dataset elements")
+	errUnknownBlock      = errors.New("unknown block")
+	errProofMismatch     = errors.New("proof doesn't match its header")
+	errInvalidProofOrder = errors.New("dataset element not in the access order")
+	errInvalidBranch     = errors.New("invalid dataset element branch")
+)
+
+// PowProof is a compact proof of the proof-of-work of a header, which a verifier
+// knowing the dataset Merkle roots, such as a bridge contract on another chain,
+// can check without the dataset.
+//
+// The dataset elements are the 128 byte rows mixed by hashimoto, in the order of
+// the accesses, each with its Merkle branch up to the dataset root. The leaves of
+// the tree are the Keccak256 hashes of the rows, padded with zero hashes to a
+// power of two, and the nodes the Keccak256 hashes of their children. Elements
+// are only included if the dataset of the epoch is generated on the node, and
+// for blocks sealed with hashimoto and the default Keccak.
+type PowProof struct {
+	Header      hexutil.Bytes    `json:"header"`
+	SealHash    common.Hash      `json:"sealHash"`
+	Nonce       types.BlockNonce `json:"nonce"`
+	MixDigest   common.Hash      `json:"mixDigest"`
+	Epoch       hexutil.Uint64   `json:"epoch"`
+	DatasetSize hexutil.Uint64   `json:"datasetSize"`
+	DatasetRoot *common.Hash     `json:"datasetRoot,omitempty"`
+	Elements    []ProofElement   `json:"elements,omitempty"`
+}
+
+// ProofElement is a dataset row accessed by hashimoto with its Merkle branch,
+// ordered from the sibling of the leaf up to the child of the root.
+type ProofElement struct {
+	Index  hexutil.Uint64 `json:"index"`
+	Data   hexutil.Bytes  `json:"data"`
+	Branch []common.Hash  `json:"branch"`
+}
+
+// PowProof creates the proof of the proof-of-work of a header. Blocks sealed by
+// a validator or merge-mined have no proof-of-work of their own to prove.
+func (hmhash *Hmhash) PowProof(chain consensus.ChainHeaderReader, header *types.Header) (*PowProof, error) {
+	if hmhash.shared != nil {
+		return hmhash.shared.PowProof(chain, header)
+	}
+	if hmhash.config.PowMode == ModeFake || hmhash.config.PowMode == ModeFullFake || hmhash.config.PowMode == ModeSimulated || hmhash.config.PowMode == ModeBenchmark {
+		return nil, errFakeProof
+	}
+	if config := chain.Config(); config.Ethash.IsValidatorBlock(header.Number) || (config.IsAuxPoW(header.Number) && isAuxPoW(header)) {
+		return nil, errNotPoWSealed
+	}
+	enc, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	number := header.Number.Uint64()
+	proof := &PowProof{
+		Header:      enc,
+		SealHash:    hmhash.SealHash(header),
+		Nonce:       header.Nonce,
+		MixDigest:   header.MixDigest,
+		Epoch:       hexutil.Uint64(number / epochLength),
+		DatasetSize: hexutil.Uint64(hmhash.datasetSize(number)),
+	}
+	rules := chain.Config().Ethash
+	if _, keccak := hmhash.algoAt(rules, number).(keccakAlgo); !keccak || isProgpow(rules, number) || isCPUPoW(rules, number) {
+		return proof, nil
+	}
+	dataset, ok := hmhash.datasetsAt(rules, number).peek(number / epochLength)
+	if !ok || !dataset.generated() || dataset.partial() {
+		return proof, nil
+	}
+	defer runtime.KeepAlive(dataset)
+
+	// Replay hashimoto over the dataset, collecting the accessed rows
+	var rows []uint64
+	digest, _ := hashimoto(hmhash.algo, proof.SealHash.Bytes(), header.Nonce.Uint64(), uint64(proof.DatasetSize), func(index uint32) []uint32 {
+		if index%2 == 0 {
+			rows = append(rows, uint64(index/2))
+		}
+		offset := index * hashWords
+		return dataset.dataset[offset : offset+hashWords]
+	})
+	if common.BytesToHash(digest) != header.MixDigest {
+		return nil, errInvalidMixDigest
+	}
+	tree := hmhash.proofs.get(dataset)
+	root := tree.root()
+	proof.DatasetRoot = &root
+
+	for _, row := range rows {
+		proof.Elements = append(proof.Elements, ProofElement{
+			Index:  hexutil.Uint64(row),
+			Data:   datasetRow(dataset.dataset, row),
+			Branch: tree.branch(dataset.dataset, row),
+		})
+	}
+	return proof, nil
+}
+
+// VerifyPowProof checks a proof of the proof-of-work of a header against the
+// dataset root it carries, which the caller has to trust separately, e.g. by
+// comparing it against the roots of the epochs known to the verifier.
+func VerifyPowProof(proof *PowProof) error {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(proof.Header, header); err != nil {
+		return err
+	}
+	if header.Nonce != proof.Nonce || header.MixDigest != proof.MixDigest || new(Hmhash).SealHash(header) != proof.SealHash {
+		return errProofMismatch
+	}
+	if header.Difficulty.Sign() <= 0 {
+		return errInvalidDifficulty
+	}
+	if proof.DatasetRoot == nil || len(proof.Elements) != loopAccesses {
+		return errIncompleteProof
+	}
+	width := proofTreeWidth(uint64(proof.DatasetSize) / mixBytes)
+	for _, element := range proof.Elements {
+		if len(element.Data) != mixBytes || uint64(element.Index) >= width || 1<<len(element.Branch) != width {
+			return errInvalidBranch
+		}
+		hash := crypto.Keccak256Hash(element.Data)
+		for level, sibling := range element.Branch {
+			if uint64(element.Index)>>level&1 == 0 {
+				hash = crypto.Keccak256Hash(hash[:], sibling[:])
+			} else {
+				hash = crypto.Keccak256Hash(sibling[:], hash[:])
+			}
+		}
+		if hash != *proof.DatasetRoot {
+			return errInvalidBranch
+		}
+	}
+	// Replay hashimoto over the proven elements, which have to come in the order
+	// of the accesses
+	var (
+		access int
+		valid  = true
+	)
+	digest, result := hashimoto(keccakAlgo{}, proof.SealHash.Bytes(), header.Nonce.Uint64(), uint64(proof.DatasetSize), func(index uint32) []uint32 {
+		element := proof.Elements[access/2]
+		if uint64(element.Index) != uint64(index/2) {
+			valid = false
+		}
+		access++
+
+		words := make([]uint32, hashWords)
+		for i := range words {
+			words[i] = binary.LittleEndian.Uint32(element.Data[(index%2)*hashBytes+uint32(i)*4:])
+		}
+		return words
+	})
+	if !valid {
+		return errInvalidProofOrder
+	}
+	if common.BytesToHash(digest) != header.MixDigest {
+		return errInvalidMixDigest
+	}
+	target := new(big.Int).Div(two256, header.Difficulty)
+	if new(big.Int).SetBytes(result).Cmp(target) > 0 {
+		return errInvalidPoW
+	}
+	return nil
+}
+
+// datasetRow returns the little endian encoding of a 128 byte row of a dataset.
+func datasetRow(dataset []uint32, row uint64) []byte {
+	data := make([]byte, mixBytes)
+	for i, word := range dataset[row*mixBytes/4 : (row+1)*mixBytes/4] {
+		binary.LittleEndian.PutUint32(data[i*4:], word)
+	}
+	return data
+}
+
+// proofTreeWidth returns the number of leaves of the Merkle tree over a number
+// of dataset rows, the next power of two.
+func proofTreeWidth(rows uint64) uint64 {
+	width := uint64(1)
+	for width < rows {
+		width <<= 1
+	}
+	return width
+}
+
+// datasetTree is the upper part of the Merkle tree over the rows of a dataset,
+// down to the roots of the chunks of proofChunkRows rows.
+type datasetTree struct {
+	epoch  uint64
+	rows   uint64          // Number of rows of the dataset
+	chunk  uint64          // Number of leaves below each node of the lowest level
+	levels [][]common.Hash // Levels of the tree, from the chunk roots up to the root
+}
+
+// newDatasetTree hashes the Merkle tree over the rows of a generated dataset.
+func newDatasetTree(epoch uint64, dataset []uint32) *datasetTree {
+	rows := uint64(len(dataset)) * 4 / mixBytes
+	width := proofTreeWidth(rows)
+
+	tree := &datasetTree{epoch: epoch, rows: rows, chunk: proofChunkRows}
+	if tree.chunk > width {
+		tree.chunk = width
+	}
+	level := make([]common.Hash, width/tree.chunk)
+	for i := range level {
+		level[i], _ = tree.subtree(dataset, uint64(i)*tree.chunk, 0)
+	}
+	tree.levels = append(tree.levels, level)
+	for len(level) > 1 {
+		level = hashProofLevel(level)
+		tree.levels = append(tree.levels, level)
+	}
+	return tree
+}
+
+// root returns the Merkle root of the dataset.
+func (t *datasetTree) root() common.Hash {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// branch returns the Merkle branch of a dataset row, rehashing the chunk it
+// belongs to.
+func (t *datasetTree) branch(dataset []uint32, row uint64) []common.Hash {
+	_, branch := t.subtree(dataset, row-row%t.chunk, row)
+	index := row / t.chunk
+	for _, level := range t.levels[:len(t.levels)-1] {
+		branch = append(branch, level[index^1])
+		index >>= 1
+	}
+	return branch
+}
+
+// subtree hashes the chunk of rows starting at start, returning its root and
+// the branch of the given row within it, if the chunk contains it.
+func (t *datasetTree) subtree(dataset []uint32, start uint64, row uint64) (common.Hash, []common.Hash) {
+	var (
+		level  = make([]common.Hash, t.chunk)
+		hasher = crypto.NewKeccakState()
+		branch []common.Hash
+	)
+	for i := range level {
+		if start+uint64(i) < t.rows {
+			hasher.Reset()
+			hasher.Write(datasetRow(dataset, start+uint64(i)))
+			hasher.Read(level[i][:])
+		}
+	}
+	contained := row >= start && row < start+t.chunk
+	for index := row - start; len(level) > 1; index >>= 1 {
+		if contained {
+			branch = append(branch, level[index^1])
+		}
+		level = hashProofLevel(level)
+	}
+	return level[0], branch
+}
+
+// hashProofLevel hashes the pairs of nodes of a Merkle tree level into the
+// level above.
+func hashProofLevel(level []common.Hash) []common.Hash {
+	next := make([]common.Hash, len(level)/2)
+	for i := range next {
+		next[i] = crypto.Keccak256Hash(level[2*i][:], level[2*i+1][:])
+	}
+	return next
+}
+
+// proofTrees keeps the Merkle tree of the most recently proven dataset.
+type proofTrees struct {
+	lock sync.Mutex
+	tree *datasetTree
+}
+
+// get returns the Merkle tree of a generated dataset, hashing it if not yet
+// done. Concurrent callers wait for the same hashing.
+func (p *proofTrees) get(dataset *dataset) *datasetTree {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.tree == nil || p.tree.epoch != dataset.epoch {
+		start := time.Now()
+		p.tree = newDatasetTree(dataset.epoch, dataset.dataset)
+		dataset.log.Info("Hashed hmhash dataset proof tree", "epoch", dataset.epoch, "root", p.tree.root(), "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return p.tree
+}
+
+// BridgeAPI exposes proofs of hmhash seals for the RPC interface, for relays
+// feeding the headers to verifiers on other chains.
+type BridgeAPI struct {
+	hmhash *Hmhash
+	chain  consensus.ChainHeaderReader
+}
+
+// GetPowProof returns the proof of the proof-of-work of a block.
+func (api *BridgeAPI) GetPowProof(hash common.Hash) (*PowProof, error) {
+	header := api.chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.hmhash.PowProof(api.chain, header)
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the proofs of seals carry the dataset elements once the dataset is
+// generated, and that they verify.
+func TestPowProof(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	config := *params.TestChainConfig
+	config.Ethash = new(params.EthashConfig)
+	chain := configReader{&config}
+
+	// Seal a header, the difficulty accepting any nonce
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), Nonce: types.EncodeNonce(42)}
+	digest, _ := hmhash.powLight(nil, hmhash.cache(nil, 1), 1, hmhash.SealHash(header).Bytes(), 42)
+	header.MixDigest = common.BytesToHash(digest)
+
+	proof, err := hmhash.PowProof(chain, header)
+	if err != nil {
+		t.Fatalf("failed to create proof: %v", err)
+	}
+	if proof.DatasetRoot != nil || len(proof.Elements) != 0 {
+		t.Errorf("proof carries dataset elements before the dataset is generated")
+	}
+	if err := VerifyPowProof(proof); err != errIncompleteProof {
+		t.Errorf("elementless proof error mismatch: have %v, want %v", err, errIncompleteProof)
+	}
+	hmhash.dataset(nil, 1, false)
+	if proof, err = hmhash.PowProof(chain, header); err != nil {
+		t.Fatalf("failed to create proof: %v", err)
+	}
+	if len(proof.Elements) != loopAccesses {
+		t.Fatalf("dataset element count mismatch: have %d, want %d", len(proof.Elements), loopAccesses)
+	}
+	if err := VerifyPowProof(proof); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	// Tampered elements, access orders and headers are rejected
+	tampered := *proof
+	tampered.Elements = append([]ProofElement{}, proof.Elements...)
+	tampered.Elements[0].Data = append([]byte{}, proof.Elements[0].Data...)
+	tampered.Elements[0].Data[0]++
+	if err := VerifyPowProof(&tampered); err != errInvalidBranch {
+		t.Errorf("tampered element error mismatch: have %v, want %v", err, errInvalidBranch)
+	}
+	tampered.Elements = append([]ProofElement{}, proof.Elements...)
+	for i := 1; i < len(tampered.Elements); i++ {
+		if tampered.Elements[i].Index != tampered.Elements[0].Index {
+			tampered.Elements[0], tampered.Elements[i] = tampered.Elements[i], tampered.Elements[0]
+			break
+		}
+	}
+	if err := VerifyPowProof(&tampered); err != errInvalidProofOrder {
+		t.Errorf("reordered elements error mismatch: have %v, want %v", err, errInvalidProofOrder)
+	}
+	tampered = *proof
+	tampered.Nonce = types.EncodeNonce(43)
+	if err := VerifyPowProof(&tampered); err != errProofMismatch {
+		t.Errorf("tampered nonce error mismatch: have %v, want %v", err, errProofMismatch)
+	}
+	// Invalid seals are not proven
+	bad := types.CopyHeader(header)
+	bad.Nonce = types.EncodeNonce(43)
+	if _, err := hmhash.PowProof(chain, bad); err != errInvalidMixDigest {
+		t.Errorf("invalid seal error mismatch: have %v, want %v", err, errInvalidMixDigest)
+	}
+}
+
+// Tests that the dataset Merkle branches lead to the root of the whole tree
+// across the chunks rehashed for each element.
+func TestDatasetTreeBranch(t *testing.T) {
+	rows := uint64(3*proofChunkRows + 5)
+	dataset := make([]uint32, rows*mixBytes/4)
+	for i := range dataset {
+		dataset[i] = uint32(i)
+	}
+	tree := newDatasetTree(0, dataset)
+
+	// Hash the whole tree naively
+	level := make([]common.Hash, proofTreeWidth(rows))
+	for i := uint64(0); i < rows; i++ {
+		level[i] = crypto.Keccak256Hash(datasetRow(dataset, i))
+	}
+	for len(level) > 1 {
+		level = hashProofLevel(level)
+	}
+	if tree.root() != level[0] {
+		t.Fatalf("root mismatch: have %x, want %x", tree.root(), level[0])
+	}
+	for _, row := range []uint64{0, 1, proofChunkRows - 1, proofChunkRows, 2*proofChunkRows + 17, rows - 1} {
+		hash := crypto.Keccak256Hash(datasetRow(dataset, row))
+		for i, sibling := range tree.branch(dataset, row) {
+			if row>>i&1 == 0 {
+				hash = crypto.Keccak256Hash(hash[:], sibling[:])
+			} else {
+				hash = crypto.Keccak256Hash(sibling[:], hash[:])
+			}
+		}
+		if hash != tree.root() {
+			t.Errorf("row %d: branch leads to %x, want %x", row, hash, tree.root())
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+
+	lrupkg "github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// defaultMaxRequestSize is the maximum size of remote mining requests if the
+	// config leaves it unset, plenty for the fixed size getwork payloads.
+	defaultMaxRequestSize = 16 * 1024
+
+	// maxRequestSources is the number of sources whose request rates are tracked,
+	// the least recently seen ones being forgotten above it.
+	maxRequestSources = 4096
+)
+
+// Remote sealer methods limited per source.
+const (
+	methodGetWork        = "getwork"
+	methodSubmitWork     = "submitwork"
+	methodSubmitHashrate = "submithashrate"
+)
+
+var (
+	errRequestThrottle = errors.New("request rate limit exceeded")
+	errRequestTooLarge = errors.New("request too large")
+)
+
+var (
+	throttledRequestMeters = map[string]metrics.Meter{
+		methodGetWork:        metrics.NewRegisteredMeter("hmhash/remote/throttled/"+methodGetWork, nil),
+		methodSubmitWork:     metrics.NewRegisteredMeter("hmhash/remote/throttled/"+methodSubmitWork, nil),
+		methodSubmitHashrate: metrics.NewRegisteredMeter("hmhash/remote/throttled/"+methodSubmitHashrate, nil),
+	}
+	oversizedRequestMeter = metrics.NewRegisteredMeter("hmhash/remote/oversized", nil)
+)
+
+// requestKey identifies the requests of a source to a method.
+type requestKey struct {
+	method string
+	source string
+}
+
+// requestLimiter limits the rate of the requests to each remote sealer method
+// per source, so a single miner or address can't flood the sealer loop.
+type requestLimiter struct {
+	limit rate.Limit
+	burst int
+
+	lock     sync.Mutex
+	limiters lrupkg.BasicLRU[requestKey, *rate.Limiter]
+}
+
+// newRequestLimiter creates a limiter allowing limit requests per second to each
+// method for each source, in bursts of as many. It returns nil if limit isn't
+// positive, allowing any rate.
+func newRequestLimiter(limit float64) *requestLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &requestLimiter{
+		limit:    rate.Limit(limit),
+		burst:    int(math.Max(1, math.Ceil(limit))),
+		limiters: lrupkg.NewBasicLRU[requestKey, *rate.Limiter](maxRequestSources),
+	}
+}
+
+// allow reports whether a source may call a method now, counting the rejected
+// calls.
+func (l *requestLimiter) allow(method, source string) bool {
+	if l == nil {
+		return true
+	}
+	l.lock.Lock()
+	key := requestKey{method, source}
+	limiter, ok := l.limiters.Get(key)
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters.Add(key, limiter)
+	}
+	allowed := limiter.Allow()
+	l.lock.Unlock()
+
+	if !allowed {
+		throttledRequestMeters[method].Mark(1)
+	}
+	return allowed
+}
+
+// requestSource returns the IP address a remote sealer request was received
+// from over JSON-RPC or gRPC, empty for in-process calls.
+func requestSource(ctx context.Context) string {
+	source := rpc.PeerInfoFromContext(ctx).RemoteAddr
+	if p, ok := peer.FromContext(ctx); ok && source == "" {
+		source = p.Addr.String()
+	}
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		source = host
+	}
+	return source
+}
+
+// tokenSize returns the size of an optional submission token.
+func tokenSize(token *string) int {
+	if token == nil {
+		return 0
+	}
+	return len(*token)
+}
+
+// maxRequestSize returns the maximum size of remote mining requests.
+func maxRequestSize(config *Config) int {
+	if config.MaxRequestSize <= 0 {
+		return defaultMaxRequestSize
+	}
+	return config.MaxRequestSize
+}
+
+// checkRequest rate limits a remote sealer request and checks the size of its
+// variable sized payload, returning why it was rejected, if so.
+func (s *remoteSealer) checkRequest(ctx context.Context, method string, payload int) error {
+	if payload > s.maxRequest {
+		oversizedRequestMeter.Mark(1)
+		return fmt.Errorf("%w: %d > %d bytes", errRequestTooLarge, payload, s.maxRequest)
+	}
+	if !s.limits.allow(method, requestSource(ctx)) {
+		return errRequestThrottle
+	}
+	return nil
+}
+
+// getworkBodyLimit wraps the getwork handler, rejecting request bodies larger
+// than the given limit before decoding them.
+func getworkBodyLimit(handler http.Handler, limit int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > int64(limit) {
+			oversizedRequestMeter.Mark(1)
+			http.Error(w, errRequestTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, int64(limit))
+		handler.ServeHTTP(w, r)
+	})
+}
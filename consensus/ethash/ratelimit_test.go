@@ -0,0 +1,101 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that requests are limited independently per method and source.
+func TestRequestLimiter(t *testing.T) {
+	limits := newRequestLimiter(1)
+	if !limits.allow(methodGetWork, "1.2.3.4") {
+		t.Fatalf("first request throttled")
+	}
+	if limits.allow(methodGetWork, "1.2.3.4") {
+		t.Errorf("request over the limit allowed")
+	}
+	if !limits.allow(methodSubmitWork, "1.2.3.4") {
+		t.Errorf("request to another method throttled")
+	}
+	if !limits.allow(methodGetWork, "5.6.7.8") {
+		t.Errorf("request of another source throttled")
+	}
+	// Without a limit, every request is allowed
+	if unlimited := newRequestLimiter(0); !unlimited.allow(methodGetWork, "") || !unlimited.allow(methodGetWork, "") {
+		t.Errorf("unlimited request throttled")
+	}
+}
+
+// Tests that the remote sealer methods reject throttled and oversized requests.
+func TestRequestLimitRemote(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, RequestRateLimit: 1, MaxRequestSize: 64}, nil, true)
+	defer hmhash.Close()
+
+	var (
+		api    = &API{hmhash}
+		ctx    = context.Background()
+		header = &types.Header{Number: common.Big1, Difficulty: common.Big1}
+	)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+	if _, err := api.GetWork(ctx); err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	if _, err := api.GetWork(ctx); err != errRequestThrottle {
+		t.Errorf("throttled work error mismatch: have %v, want %v", err, errRequestThrottle)
+	}
+	if !api.SubmitHashrate(ctx, hexutil.Uint64(100), common.Hash{1}, nil, nil, nil) {
+		t.Errorf("hashrate rejected")
+	}
+	if api.SubmitHashrate(ctx, hexutil.Uint64(100), common.Hash{2}, nil, nil, nil) {
+		t.Errorf("throttled hashrate accepted")
+	}
+	if !api.SubmitWork(ctx, types.BlockNonce{}, hmhash.SealHash(header), common.Hash{}, nil) {
+		t.Errorf("work rejected")
+	}
+	token := strings.Repeat("x", 65)
+	if res := (&MiningAPI{hmhash}).SubmitWorkDetailed(ctx, types.BlockNonce{}, hmhash.SealHash(header), common.Hash{}, &token); res.Code != SubmitUnauthorized {
+		t.Errorf("oversized token code mismatch: have %s, want %s", res.Code, SubmitUnauthorized)
+	}
+	if res := (&MiningAPI{hmhash}).SubmitWorkDetailed(ctx, types.BlockNonce{}, hmhash.SealHash(header), common.Hash{}, nil); res.Code != SubmitThrottled {
+		t.Errorf("throttled work code mismatch: have %s, want %s", res.Code, SubmitThrottled)
+	}
+}
+
+// Tests that the getwork endpoint rejects request bodies over the size limit.
+func TestGetworkBodyLimit(t *testing.T) {
+	handler := getworkBodyLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 16)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 16))))
+	if rec.Code != http.StatusOK {
+		t.Errorf("small request status mismatch: have %d, want %d", rec.Code, http.StatusOK)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 17))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large request status mismatch: have %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	errAlreadyRecording = errors.New("already recording")
+	errNotRecording     = errors.New("not recording")
+	errNoRecordingsDir  = errors.New("no recordings directory configured")
+	errInvalidRecording = errors.New("invalid recording file name")
+)
+
+// Kinds of the entries of a recorded mining session.
+const (
+	recordWork     = "work"
+	recordSubmit   = "submit"
+	recordHashrate = "hashrate"
+)
+
+// sessionEntry is an entry of a recorded mining session, a JSON line each.
+type sessionEntry struct {
+	Kind string    `json:"kind"`
+	Time time.Time `json:"time"`
+
+	// Work package handed out, the RLP encoded block
+	Block hexutil.Bytes `json:"block,omitempty"`
+
+	// Solution submitted and the error rejecting it, empty if accepted
+	SealHash  common.Hash      `json:"sealHash,omitempty"`
+	Nonce     types.BlockNonce `json:"nonce,omitempty"`
+	MixDigest common.Hash      `json:"mixDigest,omitempty"`
+	Aux       hexutil.Bytes    `json:"aux,omitempty"`
+	Worker    string           `json:"worker,omitempty"`
+	Source    string           `json:"source,omitempty"`
+	Error     string           `json:"error,omitempty"`
+
+	// Hash rate submitted
+	ID   common.Hash    `json:"id,omitempty"`
+	Rate hexutil.Uint64 `json:"rate,omitempty"`
+}
+
+// sessionRecorder records the work packages and submissions of the remote
+// sealer to a file, for replaying them against another engine.
+type sessionRecorder struct {
+	log log.Logger
+
+	lock sync.Mutex
+	file *os.File
+	out  *bufio.Writer
+	enc  *json.Encoder
+	path string
+}
+
+// start starts recording to a new file at the given path.
+func (r *sessionRecorder) start(path string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file != nil {
+		return fmt.Errorf("%w to %s", errAlreadyRecording, r.path)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	r.file, r.out, r.path = file, bufio.NewWriter(file), path
+	r.enc = json.NewEncoder(r.out)
+	return nil
+}
+
+// stop stops recording, flushing and closing the file.
+func (r *sessionRecorder) stop() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return errNotRecording
+	}
+	err := r.out.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file, r.out, r.enc, r.path = nil, nil, nil, ""
+	return err
+}
+
+// record appends an entry to the recording, if recording.
+func (r *sessionRecorder) record(entry *sessionEntry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.enc == nil {
+		return
+	}
+	if err := r.enc.Encode(entry); err != nil {
+		r.log.Warn("Failed to record mining session", "path", r.path, "err", err)
+	}
+}
+
+// recordWork records a work package handed out.
+func (r *sessionRecorder) recordWork(block *types.Block) {
+	if !r.recording() {
+		return
+	}
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return
+	}
+	r.record(&sessionEntry{Kind: recordWork, Time: time.Now(), Block: enc})
+}
+
+// recordSubmit records a solution submitted and its outcome.
+func (r *sessionRecorder) recordSubmit(result *mineResult, err error) {
+	if !r.recording() {
+		return
+	}
+	entry := &sessionEntry{
+		Kind:      recordSubmit,
+		Time:      result.received,
+		SealHash:  result.hash,
+		Nonce:     result.nonce,
+		MixDigest: result.mixDigest,
+		Worker:    result.worker,
+		Source:    result.source,
+	}
+	if result.aux != nil {
+		entry.Aux, _ = rlp.EncodeToBytes(result.aux)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	r.record(entry)
+}
+
+// recordHashrate records a hash rate submitted.
+func (r *sessionRecorder) recordHashrate(rate *hashrate) {
+	if !r.recording() {
+		return
+	}
+	r.record(&sessionEntry{Kind: recordHashrate, Time: time.Now(), ID: rate.id, Rate: hexutil.Uint64(rate.rate), Worker: rate.worker})
+}
+
+// recording reports whether a session is being recorded.
+func (r *sessionRecorder) recording() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.enc != nil
+}
+
+// ReplayMismatch is a recorded submission whose outcome differed on replay.
+type ReplayMismatch struct {
+	Line     int         `json:"line"`     // Line of the submission in the recording
+	SealHash common.Hash `json:"sealHash"` // Work the solution was submitted to
+	Recorded string      `json:"recorded"` // Error rejecting the solution when recorded, empty if accepted
+	Replayed string      `json:"replayed"` // Error rejecting the solution on replay, empty if accepted
+}
+
+// ReplayResult is the outcome of replaying a recorded mining session.
+type ReplayResult struct {
+	Works       int              `json:"works"`       // Work packages replayed
+	Submissions int              `json:"submissions"` // Solutions replayed
+	Hashrates   int              `json:"hashrates"`   // Hash rates replayed
+	Mismatches  []ReplayMismatch `json:"mismatches"`  // Solutions with a different outcome on replay
+}
+
+// replay replays a recorded mining session against the remote sealer, in the
+// recorded order but without its timing. Sealed blocks are discarded.
+func (s *remoteSealer) replay(path string) (*ReplayResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		result  = new(ReplayResult)
+		results = make(chan *types.Block, 1)
+		scanner = bufio.NewScanner(file)
+	)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry sessionEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		switch entry.Kind {
+		case recordWork:
+			block := new(types.Block)
+			if err := rlp.DecodeBytes(entry.Block, block); err != nil {
+				return result, fmt.Errorf("line %d: %w", line, err)
+			}
+			select {
+			case s.workCh <- &sealTask{block: block, results: results}:
+			case <-s.exitCh:
+				return result, errHmhashStopped
+			}
+			result.Works++
+
+		case recordSubmit:
+			submit := &mineResult{
+				nonce:     entry.Nonce,
+				mixDigest: entry.MixDigest,
+				hash:      entry.SealHash,
+				worker:    entry.Worker,
+				source:    entry.Source,
+				received:  time.Now(),
+				ctx:       context.Background(),
+				errc:      make(chan error, 1),
+			}
+			if len(entry.Aux) > 0 {
+				submit.aux = new(types.Header)
+				if err := rlp.DecodeBytes(entry.Aux, submit.aux); err != nil {
+					return result, fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+			select {
+			case s.submitWorkCh <- submit:
+			case <-s.exitCh:
+				return result, errHmhashStopped
+			}
+			var replayed string
+			if err := <-submit.errc; err != nil {
+				replayed = err.Error()
+			}
+			if replayed != entry.Error {
+				result.Mismatches = append(result.Mismatches, ReplayMismatch{Line: line, SealHash: entry.SealHash, Recorded: entry.Error, Replayed: replayed})
+			}
+			result.Submissions++
+
+			// Drain the sealed block, so the next one can be handed over
+			select {
+			case <-results:
+			default:
+			}
+
+		case recordHashrate:
+			done := make(chan struct{})
+			select {
+			case s.submitRateCh <- &hashrate{done: done, rate: uint64(entry.Rate), id: entry.ID, worker: entry.Worker}:
+			case <-s.exitCh:
+				return result, errHmhashStopped
+			}
+			<-done
+			result.Hashrates++
+
+		default:
+			return result, fmt.Errorf("line %d: unknown entry kind %q", line, entry.Kind)
+		}
+	}
+	return result, scanner.Err()
+}
+
+// StartRecording starts recording the work packages handed out to remote
+// miners and their submissions to a new file of the recordings directory.
+func (hmhash *Hmhash) StartRecording(name string) error {
+	if hmhash.remote == nil {
+		return errNoRemoteSealer
+	}
+	path, err := hmhash.recordingPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(hmhash.config.RecordingsDir, 0755); err != nil {
+		return err
+	}
+	return hmhash.remote.recorder.start(path)
+}
+
+// recordingPath resolves the name of a recorded mining session within the
+// recordings directory, refusing names escaping it.
+func (hmhash *Hmhash) recordingPath(name string) (string, error) {
+	if hmhash.config.RecordingsDir == "" {
+		return "", errNoRecordingsDir
+	}
+	path, ok := localPath(hmhash.config.RecordingsDir, name)
+	if !ok {
+		return "", errInvalidRecording
+	}
+	return path, nil
+}
+
+// StopRecording stops recording the remote mining session.
+func (hmhash *Hmhash) StopRecording() error {
+	if hmhash.remote == nil {
+		return errNoRemoteSealer
+	}
+	return hmhash.remote.recorder.stop()
+}
+
+// Replay replays a remote mining session of the recordings directory against
+// the engine, which is best a fresh one without local mining threads, reporting
+// the submissions whose outcome differs from the recorded one.
+func (hmhash *Hmhash) Replay(name string) (*ReplayResult, error) {
+	if hmhash.remote == nil {
+		return nil, errNoRemoteSealer
+	}
+	path, err := hmhash.recordingPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return hmhash.remote.replay(path)
+}
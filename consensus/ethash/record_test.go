@@ -0,0 +1,128 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that recorded mining sessions replay with the same outcomes against an
+// engine configured alike, and report the diverging ones against another.
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	hmhash := New(Config{PowMode: ModeTest, RecordingsDir: dir}, nil, true)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	path := "session.jsonl"
+	if err := hmhash.StopRecording(); err != errNotRecording {
+		t.Errorf("stop error mismatch: have %v, want %v", err, errNotRecording)
+	}
+	if err := hmhash.StartRecording(path); err != nil {
+		t.Fatalf("failed to start recording: %v", err)
+	}
+	if err := hmhash.StartRecording(path); !errors.Is(err, errAlreadyRecording) {
+		t.Errorf("restart error mismatch: have %v, want %v", err, errAlreadyRecording)
+	}
+	header := &types.Header{ParentHash: common.Hash{0x01}, Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+
+	api := &API{hmhash}
+	if _, err := api.GetWork(context.Background()); err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	sealhash := hmhash.SealHash(header)
+	if !api.SubmitWork(context.Background(), types.BlockNonce{1}, sealhash, common.Hash{}, nil) {
+		t.Errorf("unverified solution rejected")
+	}
+	if api.SubmitWork(context.Background(), types.BlockNonce{1}, sealhash, common.Hash{}, nil) {
+		t.Errorf("duplicate solution accepted")
+	}
+	if api.SubmitWork(context.Background(), types.BlockNonce{2}, common.Hash{0x02}, common.Hash{}, nil) {
+		t.Errorf("solution to unknown work accepted")
+	}
+	if !api.SubmitHashrate(context.Background(), hexutil.Uint64(100), common.Hash{1}, nil, nil, nil) {
+		t.Errorf("hashrate rejected")
+	}
+	if err := hmhash.StopRecording(); err != nil {
+		t.Fatalf("failed to stop recording: %v", err)
+	}
+	// Replay against an engine not verifying the seals either
+	replayer := New(Config{PowMode: ModeTest, RecordingsDir: dir}, nil, true)
+	defer replayer.Close()
+
+	result, err := replayer.Replay(path)
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if result.Works != 1 || result.Submissions != 3 || result.Hashrates != 1 || len(result.Mismatches) != 0 {
+		t.Errorf("replay result mismatch: %+v", result)
+	}
+	if rate := replayer.Hashrate(); rate != 100 {
+		t.Errorf("replayed hashrate mismatch: have %f, want 100", rate)
+	}
+	// Replay against a verifying engine, rejecting the made up solution
+	verifier := New(Config{PowMode: ModeTest, RecordingsDir: dir}, nil, false)
+	defer verifier.Close()
+
+	if result, err = verifier.Replay(path); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if len(result.Mismatches) != 1 || result.Mismatches[0].Recorded != "" || result.Mismatches[0].Replayed != errInvalidMixDigest.Error() {
+		t.Errorf("verified replay mismatches: %+v", result.Mismatches)
+	}
+}
+
+// Tests that sessions are only recorded to and replayed from the recordings
+// directory.
+func TestRecordingPath(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest}, nil, true)
+	defer hmhash.Close()
+
+	if err := hmhash.StartRecording("session.jsonl"); err != errNoRecordingsDir {
+		t.Errorf("record error mismatch: have %v, want %v", err, errNoRecordingsDir)
+	}
+	dir := t.TempDir()
+	hmhash.config.RecordingsDir = filepath.Join(dir, "recordings")
+
+	for _, name := range []string{"", ".", "..", "../session.jsonl", filepath.Join(dir, "session.jsonl")} {
+		if err := hmhash.StartRecording(name); err != errInvalidRecording {
+			t.Errorf("name %q: record error mismatch: have %v, want %v", name, err, errInvalidRecording)
+		}
+		if _, err := hmhash.Replay(name); err != errInvalidRecording {
+			t.Errorf("name %q: replay error mismatch: have %v, want %v", name, err, errInvalidRecording)
+		}
+	}
+	if err := hmhash.StartRecording("session.jsonl"); err != nil {
+		t.Fatalf("failed to start recording: %v", err)
+	}
+	if err := hmhash.StopRecording(); err != nil {
+		t.Fatalf("failed to stop recording: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "recordings", "session.jsonl")); err != nil {
+		t.Errorf("recording missing: %v", err)
+	}
+}
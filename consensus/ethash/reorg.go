@@ -0,0 +1,186 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	lrupkg "github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// errDeepReorg is returned if a header would reorganize the chain deeper
+	// than allowed below the local head.
+	errDeepReorg = errors.New("reorganization too deep")
+
+	// errNoReorgGuard is returned when changing the reorganization depth of an
+	// engine without reorganization guard, e.g. a fake one.
+	errNoReorgGuard = errors.New("reorganization guard unavailable")
+)
+
+// reorgGuard refuses headers forking off the local chain deeper than a number of
+// blocks below its head, a defense against 51% attacks rewriting the history
+// beyond the confirmations awaited by exchanges. The depth can be changed at
+// runtime through the runtime configuration, zero disabling the guard to let a
+// node recover manually onto the majority chain.
+type reorgGuard struct {
+	depth atomic.Uint64 // Deepest reorganization accepted, zero if unlimited
+	log   log.Logger
+}
+
+// newReorgGuard creates a reorganization guard with the given depth.
+func newReorgGuard(depth uint64, logger log.Logger) *reorgGuard {
+	guard := &reorgGuard{log: logger}
+	guard.depth.Store(depth)
+	return guard
+}
+
+// limit returns the deepest reorganization accepted, zero if unlimited.
+func (g *reorgGuard) limit() uint64 {
+	if g == nil {
+		return 0
+	}
+	return g.depth.Load()
+}
+
+// setLimit changes the deepest reorganization accepted, zero for unlimited.
+func (g *reorgGuard) setLimit(depth uint64) {
+	g.depth.Store(depth)
+}
+
+// verify checks that a header doesn't fork off the local chain more than the
+// allowed depth below its head. Headers whose ancestry is not yet known, e.g.
+// within a batch under verification, are let through, as the first header of
+// the batch is checked.
+func (g *reorgGuard) verify(chain consensus.ChainHeaderReader, header *types.Header) error {
+	depth := g.limit()
+	if depth == 0 {
+		return nil
+	}
+	head := chain.CurrentHeader()
+	if head == nil || head.Number.Uint64() <= depth {
+		return nil
+	}
+	cutoff := head.Number.Uint64() - depth
+
+	// Walk the ancestry down to the cutoff, stopping early on reaching the local
+	// chain above it, and check the ancestor at the cutoff, or the header itself
+	// if below, to be canonical
+	ancestor := header
+	for number := ancestor.Number.Uint64(); number > cutoff; number-- {
+		if canonical := chain.GetHeaderByNumber(number - 1); canonical != nil && canonical.Hash() == ancestor.ParentHash {
+			return nil
+		}
+		if ancestor = chain.GetHeader(ancestor.ParentHash, number-1); ancestor == nil {
+			return nil
+		}
+	}
+	if canonical := chain.GetHeaderByNumber(ancestor.Number.Uint64()); canonical == nil || canonical.Hash() == ancestor.Hash() {
+		return nil
+	}
+	deepReorgMeter.Mark(1)
+	g.log.Warn("Refused deep chain reorganization", "number", header.Number, "hash", header.Hash(), "head", head.Number, "depth", depth)
+	return errDeepReorg
+}
+
+// forkAncestorsCacheSize is the number of competing headers whose common
+// ancestor with the local chain is remembered, so following headers of the same
+// branch don't walk it all again.
+const forkAncestorsCacheSize = 256
+
+// forkMonitor detects the chains competing with the local one deeper than an
+// alert depth below its head during header verification.
+type forkMonitor struct {
+	depth     uint64                                    // Fork depth from which competing chains are reported
+	ancestors *lrupkg.Cache[common.Hash, *types.Header] // Common ancestors of recent competing headers
+}
+
+// newForkMonitor creates a monitor of the chains competing deeper than depth.
+func newForkMonitor(depth uint64) *forkMonitor {
+	return &forkMonitor{
+		depth:     depth,
+		ancestors: lrupkg.NewCache[common.Hash, *types.Header](forkAncestorsCacheSize),
+	}
+}
+
+// check returns the competing chain a header is the tip of, nil if it extends
+// the local chain, forks off it within the alert depth, or has an unknown
+// ancestry.
+func (m *forkMonitor) check(chain consensus.ChainHeaderReader, header *types.Header) *CompetingChain {
+	head := chain.CurrentHeader()
+	if head == nil || head.Number.Uint64() <= m.depth {
+		return nil
+	}
+	number := header.Number.Uint64()
+	if canonical := chain.GetHeaderByNumber(number); canonical != nil && canonical.Hash() == header.Hash() {
+		return nil
+	}
+	// Walk the ancestry down to the local chain, or a header of the same branch
+	// met before
+	var ancestor *types.Header
+	for cur := header; ancestor == nil; {
+		if cur.Number.Sign() == 0 {
+			return nil
+		}
+		if cached, ok := m.ancestors.Get(cur.ParentHash); ok {
+			ancestor = cached
+			break
+		}
+		parent := cur.Number.Uint64() - 1
+		if canonical := chain.GetHeaderByNumber(parent); canonical != nil && canonical.Hash() == cur.ParentHash {
+			ancestor = canonical
+			break
+		}
+		if cur = chain.GetHeader(cur.ParentHash, parent); cur == nil {
+			return nil
+		}
+	}
+	m.ancestors.Add(header.Hash(), ancestor)
+
+	if head.Number.Uint64() <= ancestor.Number.Uint64()+m.depth {
+		return nil
+	}
+	return &CompetingChain{
+		Ancestor:       ancestor.Hash(),
+		AncestorNumber: ancestor.Number.Uint64(),
+		LocalHead:      head.Hash(),
+		LocalNumber:    head.Number.Uint64(),
+		Tip:            header.Hash(),
+		TipNumber:      number,
+		Depth:          head.Number.Uint64() - ancestor.Number.Uint64(),
+	}
+}
+
+// checkCompetingChain reports the competing chain a header is the tip of, if
+// deeper than the alert depth.
+func (hmhash *Hmhash) checkCompetingChain(chain consensus.ChainHeaderReader, header *types.Header) {
+	if hmhash.forks == nil {
+		return
+	}
+	fork := hmhash.forks.check(chain, header)
+	if fork == nil {
+		return
+	}
+	competingChainMeter.Mark(1)
+	hmhash.config.Log.Warn("Competing chain detected", "ancestor", fork.AncestorNumber, "head", fork.LocalNumber, "tip", fork.TipNumber, "hash", fork.Tip, "depth", fork.Depth)
+	hmhash.events.forks.Send(*fork)
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// reorgTestChain is a header chain with a canonical head, as seen by the
+// reorganization guard.
+type reorgTestChain struct {
+	*testHeaderChain
+	head *types.Header
+}
+
+func (c *reorgTestChain) CurrentHeader() *types.Header { return c.head }
+
+// extend creates n headers on top of parent, tagged to fork off any sibling,
+// and adds them to the chain, marking them canonical if requested.
+func (c *reorgTestChain) extend(parent *types.Header, n int, tag byte, canonical bool) []*types.Header {
+	headers := make([]*types.Header, n)
+	for i := range headers {
+		headers[i] = &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, big1),
+			Extra:      []byte{tag},
+		}
+		c.headers[headers[i].Hash()] = headers[i]
+		if canonical {
+			c.canonical[headers[i].Number.Uint64()] = headers[i].Hash()
+			c.head = headers[i]
+		}
+		parent = headers[i]
+	}
+	return headers
+}
+
+func TestReorgGuard(t *testing.T) {
+	genesis := &types.Header{Number: new(big.Int)}
+	chain := &reorgTestChain{
+		testHeaderChain: &testHeaderChain{
+			config:    &params.ChainConfig{},
+			headers:   map[common.Hash]*types.Header{genesis.Hash(): genesis},
+			canonical: map[uint64]common.Hash{0: genesis.Hash()},
+		},
+		head: genesis,
+	}
+	local := chain.extend(genesis, 20, 0, true)
+
+	// Forks off block 15 (5 below the head) and block 10 (10 below the head)
+	shallow := chain.extend(local[14], 6, 1, false)
+	deep := chain.extend(local[9], 12, 2, false)
+
+	guard := newReorgGuard(5, log.Root())
+	tests := []struct {
+		header *types.Header
+		err    error
+	}{
+		{chain.extend(local[19], 1, 0, false)[0], nil}, // Next block
+		{local[12], nil},         // Known canonical block
+		{shallow[0], nil},        // Sibling of the block at the cutoff
+		{shallow[5], nil},        // Shallow fork taking over
+		{deep[0], errDeepReorg},  // Sibling of a block below the cutoff
+		{deep[11], errDeepReorg}, // Deep fork taking over
+	}
+	for i, tt := range tests {
+		if err := guard.verify(chain, tt.header); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Lifting the limit lets the deep fork through for recovery
+	guard.setLimit(0)
+	if err := guard.verify(chain, deep[11]); err != nil {
+		t.Errorf("deep fork refused without limit: %v", err)
+	}
+	// Headers with unknown ancestry are left to the verification of their parents
+	orphan := &types.Header{ParentHash: common.Hash{0xff}, Number: big.NewInt(19)}
+	guard.setLimit(5)
+	if err := guard.verify(chain, orphan); err != nil {
+		t.Errorf("orphan header refused: %v", err)
+	}
+}
+
+// Tests that the chains competing deeper than the alert depth are reported with
+// both tips and their common ancestor.
+func TestCompetingChainReports(t *testing.T) {
+	genesis := &types.Header{Number: new(big.Int)}
+	chain := &reorgTestChain{
+		testHeaderChain: &testHeaderChain{
+			config:    &params.ChainConfig{},
+			headers:   map[common.Hash]*types.Header{genesis.Hash(): genesis},
+			canonical: map[uint64]common.Hash{0: genesis.Hash()},
+		},
+		head: genesis,
+	}
+	local := chain.extend(genesis, 20, 0, true)
+	shallow := chain.extend(local[14], 3, 1, false)
+	deep := chain.extend(local[9], 3, 2, false)
+
+	hmhash := New(Config{PowMode: ModeTest, ReorgAlertDepth: 5}, nil, false)
+	defer hmhash.Close()
+
+	forks := make(chan CompetingChain, 8)
+	sub := hmhash.SubscribeCompetingChain(forks)
+	defer sub.Unsubscribe()
+
+	for _, header := range []*types.Header{local[12], shallow[0], shallow[2], deep[0], deep[1], deep[2]} {
+		hmhash.checkCompetingChain(chain, header)
+	}
+	for i, tip := range deep {
+		select {
+		case fork := <-forks:
+			want := CompetingChain{
+				Ancestor:       local[9].Hash(),
+				AncestorNumber: 10,
+				LocalHead:      local[19].Hash(),
+				LocalNumber:    20,
+				Tip:            tip.Hash(),
+				TipNumber:      uint64(11 + i),
+				Depth:          10,
+			}
+			if fork != want {
+				t.Errorf("report %d mismatch: have %+v, want %+v", i, fork, want)
+			}
+		default:
+			t.Fatalf("report %d missing", i)
+		}
+	}
+	select {
+	case fork := <-forks:
+		t.Errorf("unexpected report: %+v", fork)
+	default:
+	}
+}
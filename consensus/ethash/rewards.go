@@ -0,0 +1,85 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// RewardSchedule is the emission curve of an hmhash chain: the block reward
+// steps, ordered by activation block.
+type RewardSchedule []*params.RewardConfig
+
+// NewRewardSchedule returns the reward schedule of the chain config, or the
+// Ethereum one of its Byzantium and Constantinople forks if none is configured.
+func NewRewardSchedule(config *params.ChainConfig) RewardSchedule {
+	if config.Ethash != nil && len(config.Ethash.RewardSchedule) > 0 {
+		return config.Ethash.RewardSchedule
+	}
+	schedule := RewardSchedule{{Block: new(big.Int), Reward: FrontierBlockReward}}
+	if config.ByzantiumBlock != nil {
+		schedule = append(schedule, &params.RewardConfig{Block: config.ByzantiumBlock, Reward: ByzantiumBlockReward})
+	}
+	if config.ConstantinopleBlock != nil {
+		schedule = append(schedule, &params.RewardConfig{Block: config.ConstantinopleBlock, Reward: ConstantinopleBlockReward})
+	}
+	return schedule
+}
+
+// Reward returns the block reward step in effect at the given block. Blocks
+// before the first step are not rewarded.
+func (s RewardSchedule) Reward(number *big.Int) *params.RewardConfig {
+	active := &params.RewardConfig{Block: new(big.Int), Reward: new(big.Int)}
+	for _, step := range s {
+		if step.Block.Cmp(number) <= 0 {
+			active = step
+		}
+	}
+	return active
+}
+
+// payTreasury credits the treasury with its share of the block reward, if it's
+// active at the given block, and returns the amount paid. Weighted recipients are
+// paid in proportion to their weights, any rounding dust stays with the miner.
+func payTreasury(treasury *params.TreasuryConfig, state *state.StateDB, number *big.Int, blockReward *big.Int) *big.Int {
+	paid := new(big.Int)
+	if !treasury.IsActive(number) || treasury.Percent == 0 {
+		return paid
+	}
+	share := new(big.Int).Mul(blockReward, new(big.Int).SetUint64(treasury.Percent))
+	share.Div(share, big100)
+
+	if len(treasury.Recipients) == 0 {
+		state.AddBalance(treasury.Address, share)
+		return share
+	}
+	weights := new(big.Int)
+	for _, recipient := range treasury.Recipients {
+		weights.Add(weights, new(big.Int).SetUint64(recipient.Weight))
+	}
+	for _, recipient := range treasury.Recipients {
+		amount := new(big.Int).Mul(share, new(big.Int).SetUint64(recipient.Weight))
+		amount.Div(amount, weights)
+
+		state.AddBalance(recipient.Address, amount)
+		paid.Add(paid, amount)
+	}
+	return paid
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the default reward schedule follows the Ethereum forks and that a
+// configured one replaces it.
+func TestRewardSchedule(t *testing.T) {
+	ethereum := &params.ChainConfig{ByzantiumBlock: big.NewInt(10), ConstantinopleBlock: big.NewInt(20)}
+	custom := &params.ChainConfig{
+		ByzantiumBlock: big.NewInt(10),
+		Ethash: &params.EthashConfig{
+			RewardSchedule: []*params.RewardConfig{
+				{Block: big.NewInt(1), Reward: big.NewInt(100)},
+				{Block: big.NewInt(15), Reward: big.NewInt(50)},
+			},
+		},
+	}
+	tests := []struct {
+		config *params.ChainConfig
+		number int64
+		want   *big.Int
+	}{
+		{ethereum, 0, FrontierBlockReward},
+		{ethereum, 9, FrontierBlockReward},
+		{ethereum, 10, ByzantiumBlockReward},
+		{ethereum, 19, ByzantiumBlockReward},
+		{ethereum, 20, ConstantinopleBlockReward},
+		{custom, 0, new(big.Int)},
+		{custom, 1, big.NewInt(100)},
+		{custom, 14, big.NewInt(100)},
+		{custom, 15, big.NewInt(50)},
+		{custom, 1000, big.NewInt(50)},
+	}
+	for i, tt := range tests {
+		if have := NewRewardSchedule(tt.config).Reward(big.NewInt(tt.number)).Reward; have.Cmp(tt.want) != 0 {
+			t.Errorf("test %d: reward mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the block and uncle rewards are credited according to the reward
+// schedule of the chain config.
+func TestAccumulateRewards(t *testing.T) {
+	var (
+		miner = common.HexToAddress("0x01")
+		uncle = common.HexToAddress("0x02")
+	)
+	tests := []struct {
+		step       *params.RewardConfig
+		miner      int64
+		uncleMiner int64
+	}{
+		{&params.RewardConfig{Block: new(big.Int), Reward: big.NewInt(3200)}, 3200 + 100, 3200 * 6 / 8},
+		{&params.RewardConfig{Block: new(big.Int), Reward: big.NewInt(3200), UncleRewardFraction: big.NewRat(1, 2)}, 3200 + 100, 3200 * 6 / 16},
+		{&params.RewardConfig{Block: new(big.Int), Reward: big.NewInt(3200), UncleRewardFraction: new(big.Rat)}, 3200 + 100, 0},
+	}
+	for i, tt := range tests {
+		config := &params.ChainConfig{Ethash: &params.EthashConfig{RewardSchedule: []*params.RewardConfig{tt.step}}}
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+		header := &types.Header{Number: big.NewInt(10), Coinbase: miner}
+		accumulateRewards(config, statedb, header, []*types.Header{{Number: big.NewInt(8), Coinbase: uncle}})
+
+		if have := statedb.GetBalance(miner); have.Cmp(big.NewInt(tt.miner)) != 0 {
+			t.Errorf("test %d: miner balance mismatch: have %v, want %d", i, have, tt.miner)
+		}
+		if have := statedb.GetBalance(uncle); have.Cmp(big.NewInt(tt.uncleMiner)) != 0 {
+			t.Errorf("test %d: uncle balance mismatch: have %v, want %d", i, have, tt.uncleMiner)
+		}
+	}
+}
+
+// Tests that the treasury share is split off the block reward of the miner while
+// the treasury is active.
+func TestTreasuryRewards(t *testing.T) {
+	var (
+		miner = common.HexToAddress("0x01")
+		fund  = common.HexToAddress("0x10")
+		devs  = common.HexToAddress("0x11")
+		ops   = common.HexToAddress("0x12")
+	)
+	schedule := []*params.RewardConfig{{Block: new(big.Int), Reward: big.NewInt(1000)}}
+	single := &params.TreasuryConfig{Block: big.NewInt(5), EndBlock: big.NewInt(10), Percent: 10, Address: fund}
+	weighted := &params.TreasuryConfig{
+		Block:   big.NewInt(5),
+		Percent: 20,
+		Recipients: []*params.TreasuryRecipient{
+			{Address: devs, Weight: 2},
+			{Address: ops, Weight: 1},
+		},
+	}
+	tests := []struct {
+		treasury *params.TreasuryConfig
+		number   int64
+		want     map[common.Address]int64
+	}{
+		{single, 4, map[common.Address]int64{miner: 1000, fund: 0}},
+		{single, 5, map[common.Address]int64{miner: 900, fund: 100}},
+		{single, 9, map[common.Address]int64{miner: 900, fund: 100}},
+		{single, 10, map[common.Address]int64{miner: 1000, fund: 0}},
+		{weighted, 100, map[common.Address]int64{miner: 801, devs: 133, ops: 66}},
+	}
+	for i, tt := range tests {
+		config := &params.ChainConfig{Ethash: &params.EthashConfig{RewardSchedule: schedule, Treasury: tt.treasury}}
+		if err := config.CheckConfigForkOrder(); err != nil {
+			t.Fatalf("test %d: invalid chain config: %v", i, err)
+		}
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		accumulateRewards(config, statedb, &types.Header{Number: big.NewInt(tt.number), Coinbase: miner}, nil)
+
+		for addr, want := range tt.want {
+			if have := statedb.GetBalance(addr); have.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("test %d: balance mismatch for %x: have %v, want %d", i, addr, have, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	errInvalidShareDiff   = errors.New("share difficulty must be positive")
+	errInvalidSealTimeout = errors.New("seal timeout must not be negative")
+)
+
+// RuntimeConfig is the part of the engine configuration which can be changed
+// without restarting the node. When updating, fields left nil are unchanged,
+// while an empty list of notify targets stops all notifications.
+type RuntimeConfig struct {
+	NotifyTargets   []string        `json:"notifyTargets"`   // URLs notified of new work
+	NotifyFull      *bool           `json:"notifyFull"`      // Whether notifications carry the full header
+	ShareDifficulty *hexutil.Uint64 `json:"shareDifficulty"` // Share difficulty, if share accounting is enabled
+	SealTimeout     *string         `json:"sealTimeout"`     // Sealing deadline as a Go duration, "0s" if none
+	NonceStrategy   *string         `json:"nonceStrategy"`   // Nonce strategy, see ParseNonceStrategy
+	MaxReorgDepth   *hexutil.Uint64 `json:"maxReorgDepth"`   // Deepest reorganization accepted, 0 for any
+	MinerCPUs       *string         `json:"minerCPUs"`       // CPUs the mining threads may run on, "" for all
+	MinerNice       *int            `json:"minerNice"`       // Nice value of the mining threads
+}
+
+// RuntimeConfig returns the effective configuration of the engine which can be
+// changed at runtime.
+func (hmhash *Hmhash) RuntimeConfig() *RuntimeConfig {
+	hmhash.lock.Lock()
+	defer hmhash.lock.Unlock()
+
+	if hmhash.shared != nil {
+		return hmhash.shared.RuntimeConfig()
+	}
+	var (
+		full     = hmhash.config.NotifyFull
+		timeout  = hmhash.config.SealTimeout.String()
+		strategy = DefaultNonceStrategy
+		targets  = []string{}
+		cpus     = hmhash.config.MinerCPUs
+		nice     = hmhash.config.MinerNice
+	)
+	if hmhash.nonces != nil {
+		strategy = hmhash.nonces.Name()
+	}
+	if hmhash.remote != nil {
+		for _, target := range hmhash.remote.targets.all() {
+			targets = append(targets, target.url)
+		}
+	}
+	config := &RuntimeConfig{
+		NotifyTargets: targets,
+		NotifyFull:    &full,
+		SealTimeout:   &timeout,
+		NonceStrategy: &strategy,
+		MinerCPUs:     &cpus,
+		MinerNice:     &nice,
+	}
+	if hmhash.shares != nil {
+		difficulty := hexutil.Uint64(hmhash.config.ShareDifficulty)
+		config.ShareDifficulty = &difficulty
+	}
+	if hmhash.reorgs != nil {
+		depth := hexutil.Uint64(hmhash.reorgs.limit())
+		config.MaxReorgDepth = &depth
+	}
+	return config
+}
+
+// SetRuntimeConfig applies a partial configuration update without restarting
+// the node. The update is validated beforehand and applied atomically, either
+// all of it or none.
+func (hmhash *Hmhash) SetRuntimeConfig(update *RuntimeConfig) error {
+	// Validate the whole update before changing anything
+	var (
+		timeout  time.Duration
+		strategy NonceStrategy
+		cpus     []int
+		err      error
+	)
+	if update.SealTimeout != nil {
+		if timeout, err = time.ParseDuration(*update.SealTimeout); err != nil {
+			return fmt.Errorf("invalid seal timeout: %v", err)
+		}
+		if timeout < 0 {
+			return errInvalidSealTimeout
+		}
+	}
+	if update.NonceStrategy != nil {
+		if strategy, err = ParseNonceStrategy(*update.NonceStrategy); err != nil {
+			return err
+		}
+	}
+	if update.MinerCPUs != nil {
+		if cpus, err = parseCPUList(*update.MinerCPUs); err != nil {
+			return err
+		}
+	}
+	if update.MinerNice != nil && !validNice(*update.MinerNice) {
+		return errInvalidNice
+	}
+	if update.ShareDifficulty != nil && *update.ShareDifficulty == 0 {
+		return errInvalidShareDiff
+	}
+	for _, url := range update.NotifyTargets {
+		if !validNotifyTarget(url) {
+			return fmt.Errorf("%w: %q", errInvalidNotifyTarget, url)
+		}
+	}
+	hmhash.lock.Lock()
+	defer hmhash.lock.Unlock()
+
+	if hmhash.shared != nil {
+		return hmhash.shared.SetRuntimeConfig(update)
+	}
+	if update.ShareDifficulty != nil && hmhash.shares == nil {
+		return errSharesDisabled
+	}
+	if update.NotifyTargets != nil && hmhash.remote == nil {
+		return errNoRemoteSealer
+	}
+	if update.MaxReorgDepth != nil && hmhash.reorgs == nil {
+		return errNoReorgGuard
+	}
+	// Replace the notify targets first, the only change which may fail
+	if update.NotifyTargets != nil {
+		if err := hmhash.remote.targets.replace(update.NotifyTargets); err != nil {
+			return err
+		}
+	}
+	if update.NotifyFull != nil {
+		hmhash.config.NotifyFull = *update.NotifyFull
+	}
+	if update.ShareDifficulty != nil {
+		hmhash.config.ShareDifficulty = uint64(*update.ShareDifficulty)
+		hmhash.shares.setDifficulty(hmhash.config.ShareDifficulty)
+	}
+	if update.SealTimeout != nil {
+		hmhash.config.SealTimeout = timeout
+	}
+	if update.MaxReorgDepth != nil {
+		hmhash.config.MaxReorgDepth = uint64(*update.MaxReorgDepth)
+		hmhash.reorgs.setLimit(hmhash.config.MaxReorgDepth)
+	}
+	if update.MinerCPUs != nil {
+		hmhash.config.MinerCPUs = *update.MinerCPUs
+		hmhash.affinity.cpus = cpus
+	}
+	if update.MinerNice != nil {
+		hmhash.config.MinerNice = *update.MinerNice
+		hmhash.affinity.nice = *update.MinerNice
+	}
+	// Restart the mining threads with the new nonce strategy or placement
+	if strategy != nil || update.MinerCPUs != nil || update.MinerNice != nil {
+		if strategy != nil {
+			hmhash.nonces = strategy
+		}
+		select {
+		case hmhash.update <- struct{}{}:
+		default:
+		}
+	}
+	hmhash.config.Log.Info("Updated hmhash configuration", "notifyfull", hmhash.config.NotifyFull,
+		"sharediff", hmhash.config.ShareDifficulty, "timeout", hmhash.config.SealTimeout, "nonces", update.NonceStrategy != nil, "reorgdepth", hmhash.config.MaxReorgDepth,
+		"cpus", hmhash.config.MinerCPUs, "nice", hmhash.config.MinerNice)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Tests that partial configuration updates are applied atomically and reflected
+// by the effective configuration.
+func TestRuntimeConfig(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, ShareDifficulty: 10}, []string{"http://127.0.0.1:1/a"}, false)
+	defer hmhash.Close()
+	api, admin := &MiningAPI{hmhash}, &AdminAPI{hmhash: hmhash}
+
+	config := api.GetConfig()
+	if !reflect.DeepEqual(config.NotifyTargets, []string{"http://127.0.0.1:1/a"}) || *config.NotifyFull ||
+		uint64(*config.ShareDifficulty) != 10 || *config.SealTimeout != "0s" || *config.NonceStrategy != DefaultNonceStrategy {
+		blob, _ := json.Marshal(config)
+		t.Fatalf("initial config mismatch: %s", blob)
+	}
+	// Apply a partial update decoded as from an RPC call
+	var update RuntimeConfig
+	if err := json.Unmarshal([]byte(`{"notifyTargets": ["http://127.0.0.1:1/b"], "shareDifficulty": "0x20", "sealTimeout": "30s", "maxReorgDepth": "0x64"}`), &update); err != nil {
+		t.Fatalf("failed to decode update: %v", err)
+	}
+	if err := admin.SetConfig(update); err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+	config = api.GetConfig()
+	if !reflect.DeepEqual(config.NotifyTargets, []string{"http://127.0.0.1:1/b"}) || *config.NotifyFull ||
+		uint64(*config.ShareDifficulty) != 32 || *config.SealTimeout != "30s" || *config.NonceStrategy != DefaultNonceStrategy {
+		blob, _ := json.Marshal(config)
+		t.Fatalf("updated config mismatch: %s", blob)
+	}
+	if hmhash.config.SealTimeout != 30*time.Second || hmhash.shares.difficulty.Uint64() != 32 || hmhash.reorgs.limit() != 100 {
+		t.Errorf("update not applied to the engine")
+	}
+	// Ensure invalid updates change nothing
+	var (
+		full     = true
+		strategy = "split-range:2/2"
+	)
+	if err := admin.SetConfig(RuntimeConfig{NotifyTargets: []string{}, NotifyFull: &full, NonceStrategy: &strategy}); err == nil {
+		t.Fatalf("invalid update accepted")
+	}
+	if have := api.GetConfig(); !reflect.DeepEqual(have, config) {
+		t.Errorf("config changed by invalid update")
+	}
+	// Ensure the notify targets can be cleared
+	strategy = "random-stride"
+	if err := admin.SetConfig(RuntimeConfig{NotifyTargets: []string{}, NotifyFull: &full, NonceStrategy: &strategy}); err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+	config = api.GetConfig()
+	if len(config.NotifyTargets) != 0 || !*config.NotifyFull || *config.NonceStrategy != "random-stride" {
+		blob, _ := json.Marshal(config)
+		t.Errorf("cleared config mismatch: %s", blob)
+	}
+}
+
+// Tests that share difficulty updates are rejected without share accounting.
+func TestRuntimeConfigSharesDisabled(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest}, nil, false)
+	defer hmhash.Close()
+
+	config := hmhash.RuntimeConfig()
+	if config.ShareDifficulty != nil {
+		t.Errorf("share difficulty reported without share accounting")
+	}
+	difficulty := hexutil.Uint64(100)
+	if err := hmhash.SetRuntimeConfig(&RuntimeConfig{ShareDifficulty: &difficulty}); err != errSharesDisabled {
+		t.Errorf("error mismatch: have %v, want %v", err, errSharesDisabled)
+	}
+}
@@ -17,9 +17,10 @@
 package ethash
 
 import (
-	"bytes"
 	"context"
 	crand "crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"math"
@@ -28,27 +29,70 @@ import (
 	"net/http"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 const (
-	// staleThreshold is the maximum depth of the acceptable stale but valid hmhash solution.
+	// staleThreshold is the default maximum depth of the acceptable stale but
+	// valid hmhash solution, see Config.StaleWorkWindow.
 	staleThreshold = 7
+
+	// uncleDepth is the number of generations back a block may include uncles
+	// from, bounding how late solutions are useful as uncle candidates.
+	uncleDepth = 7
 )
 
 var (
-	errNoMiningWork      = errors.New("no mining work available yet")
-	errInvalidSealResult = errors.New("invalid or stale proof-of-work solution")
+	errNoMiningWork       = errors.New("no mining work available yet")
+	errInvalidStaleWindow = errors.New("stale work window must be at least one block")
+
+	// ErrSealTimeout is reported to the seal failure subscribers if no solution
+	// was found for a block within the configured sealing deadline.
+	ErrSealTimeout = errors.New("no solution found before the sealing deadline")
+
+	staleAcceptedMeter = metrics.NewRegisteredMeter("hmhash/remote/stale/accepted", nil)
+	staleRejectedMeter = metrics.NewRegisteredMeter("hmhash/remote/stale/rejected", nil)
+	shareMeter         = metrics.NewRegisteredMeter("hmhash/remote/shares", nil)
 )
 
 // Seal implements consensus.Engine, attempting to find a nonce that satisfies
 // the block's difficulty requirements.
 func (hmhash *Hmhash) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	return hmhash.seal(context.Background(), chain, block, results, stop)
+}
+
+// seal attempts to find a nonce that satisfies the block's difficulty
+// requirements, tracing the search as a child span of the context's one.
+func (hmhash *Hmhash) seal(ctx context.Context, chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	// Validator sealed blocks of hybrid chains are signed instead of mined
+	if chain != nil && chain.Config().Ethash.IsValidatorBlock(block.Number()) {
+		sealed, err := hmhash.sealValidator(block)
+		if err != nil {
+			return err
+		}
+		select {
+		case results <- sealed:
+		default:
+			hmhash.logs.sealer.Warn("Sealing result is not read by miner", "mode", "validator", logSealHash, hmhash.SealHash(block.Header()))
+		}
+		return nil
+	}
+	// Remember the ethash rules of the chain, the remote solutions to the work
+	// being verified outside of it
+	rules := hmhash.chainRules(chain)
+	if chain != nil {
+		hmhash.sealRules.Store(rules)
+	}
 	// If we're running a fake PoW, simply return a 0 nonce immediately
 	if hmhash.config.PowMode == ModeFake || hmhash.config.PowMode == ModeFullFake {
 		header := block.Header()
@@ -56,19 +100,35 @@ func (hmhash *Hmhash) Seal(chain consensus.ChainHeaderReader, block *types.Block
 		select {
 		case results <- block.WithSeal(header):
 		default:
-			hmhash.config.Log.Warn("Sealing result is not read by miner", "mode", "fake", "sealhash", hmhash.SealHash(block.Header()))
+			hmhash.logs.sealer.Warn("Sealing result is not read by miner", "mode", "fake", logSealHash, hmhash.SealHash(block.Header()))
 		}
 		return nil
 	}
+	// If we're simulating PoW, seal once the simulated block time passes
+	if hmhash.config.PowMode == ModeSimulated {
+		go hmhash.sealSimulated(block, results, stop)
+		return nil
+	}
+	// If we're benchmarking, seal with the first nonce regardless of the target
+	if hmhash.config.PowMode == ModeBenchmark {
+		hmhash.sealBenchmark(rules, block, results)
+		return nil
+	}
 	// If we're running a shared PoW, delegate sealing to it
 	if hmhash.shared != nil {
-		return hmhash.shared.Seal(chain, block, results, stop)
+		return hmhash.shared.seal(ctx, chain, block, results, stop)
 	}
+	sealAttemptMeter.Mark(1)
+	hmhash.postWork(block)
+	issued := time.Now()
+
 	// Create a runner and the multiple search threads it directs
 	abort := make(chan struct{})
 
 	hmhash.lock.Lock()
-	threads := hmhash.threads
+	threads, gpus, strategy := hmhash.threads, hmhash.gpus, hmhash.nonces
+	affinity := hmhash.affinity
+	timeout := hmhash.config.SealTimeout
 	if hmhash.rand == nil {
 		seed, err := crand.Int(crand.Reader, big.NewInt(math.MaxInt64))
 		if err != nil {
@@ -77,6 +137,16 @@ func (hmhash *Hmhash) Seal(chain consensus.ChainHeaderReader, block *types.Block
 		}
 		hmhash.rand = rand.New(rand.NewSource(seed.Int64()))
 	}
+	if hmhash.draining {
+		hmhash.lock.Unlock()
+		return errSealDraining
+	}
+	if hmhash.drain == nil {
+		hmhash.drain = make(chan struct{})
+	}
+	drain := hmhash.drain
+	hmhash.sealing.Add(1)
+	rng := hmhash.rand
 	hmhash.lock.Unlock()
 	if threads == 0 {
 		threads = runtime.NumCPU()
@@ -84,6 +154,39 @@ func (hmhash *Hmhash) Seal(chain consensus.ChainHeaderReader, block *types.Block
 	if threads < 0 {
 		threads = 0 // Allows disabling local mining without extra logic around local/remote
 	}
+	if hmhash.governor != nil && threads > 1 {
+		// The governor takes threads off while the node is loaded, keeping one
+		threads -= int(hmhash.governor.throttled.Load())
+		if threads < 1 {
+			threads = 1
+		}
+	}
+	deterministic := hmhash.config.PowMode == ModeDeterministic
+	if deterministic {
+		// Search from nonce zero on a single thread, so the first solution found
+		// only depends on the header
+		sealhash := hmhash.SealHash(block.Header())
+		rng = rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sealhash[:8]))))
+		threads, gpus = 1, nil
+	}
+	meters := hmhash.threadMeters(threads)
+	if len(gpus) > 0 && isProgpow(rules, block.NumberU64()) {
+		// The GPU kernels only implement hashimoto, leave ProgPoW to the CPU
+		hmhash.logs.sealer.Debug("Skipping GPU mining of ProgPoW block", "number", block.NumberU64())
+		gpus = nil
+	}
+	if len(gpus) > 0 && hmhash.algoAt(rules, block.NumberU64()).Name() != DefaultHashAlgo {
+		// The GPU kernels only implement keccak, leave the rotated algorithms to the CPU
+		hmhash.logs.sealer.Debug("Skipping GPU mining of rotated hash algorithm block", "number", block.NumberU64())
+		gpus = nil
+	}
+	if len(gpus) > 0 && isCPUPoW(rules, block.NumberU64()) {
+		// The CPU proof-of-work is meant for CPUs, as its name tells
+		hmhash.logs.sealer.Debug("Skipping GPU mining of CPU proof-of-work block", "number", block.NumberU64())
+		gpus = nil
+	}
+	_, span := hmhash.startSpan(ctx, "hmhash.Seal", attribute.Int64("hmhash.number", int64(block.NumberU64())), attribute.Int("hmhash.threads", threads+len(gpus)))
+
 	// Push new work to remote sealer
 	if hmhash.remote != nil {
 		hmhash.remote.workCh <- &sealTask{block: block, results: results}
@@ -92,33 +195,90 @@ func (hmhash *Hmhash) Seal(chain consensus.ChainHeaderReader, block *types.Block
 		pend   sync.WaitGroup
 		locals = make(chan *types.Block)
 	)
+	workers := threads + len(gpus)
 	for i := 0; i < threads; i++ {
 		pend.Add(1)
-		go func(id int, nonce uint64) {
+		nonce, step := strategy.Assign(rng, i, workers)
+		if deterministic {
+			nonce = 0
+		}
+		go func(id int, nonce, step uint64) {
+			defer pend.Done()
+			affinity.apply(hmhash.logs.sealer)
+			hmhash.mine(rules, block, id, nonce, step, meters[id], abort, locals)
+		}(i, nonce, step)
+	}
+	for i, miner := range gpus {
+		pend.Add(1)
+		nonce, _ := strategy.Assign(rng, threads+i, workers)
+		go func(miner *gpuMiner, nonce uint64) {
 			defer pend.Done()
-			hmhash.mine(block, id, nonce, abort, locals)
-		}(i, uint64(hmhash.rand.Int63()))
+			hmhash.mineGPU(rules, block, miner, nonce, abort, locals)
+		}(miner, nonce)
 	}
 	// Wait until sealing is terminated or a nonce is found
 	go func() {
+		defer hmhash.sealing.Done()
+		defer span.End()
+
+		var deadline <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
 		var result *types.Block
 		select {
+		case <-deadline:
+			// No solution in time, abort so the miner can rebuild the block
+			close(abort)
+			sealhash := hmhash.SealHash(block.Header())
+			hmhash.logs.sealer.Debug("Sealing deadline passed", "number", block.NumberU64(), logSealHash, sealhash, "timeout", timeout)
+			hmhash.events.failures.Send(consensus.SealFailure{SealHash: sealhash, Err: ErrSealTimeout})
+			span.SetStatus(codes.Error, ErrSealTimeout.Error())
 		case <-stop:
 			// Outside abort, stop all miner threads
 			close(abort)
+		case <-drain:
+			// Draining timed out, stop all miner threads
+			close(abort)
 		case result = <-locals:
-			// One of the threads found a block, abort all others
+			// One of the threads found a block, abort all others. A block found
+			// while the seal is being stopped is dropped, so no result is ever
+			// delivered after stopping.
 			select {
-			case results <- result:
+			case <-stop:
 			default:
-				hmhash.config.Log.Warn("Sealing result is not read by miner", "mode", "local", "sealhash", hmhash.SealHash(block.Header()))
+				trace := &SolutionTrace{
+					SealHash: hmhash.SealHash(block.Header()),
+					Hash:     result.Hash(),
+					Number:   result.NumberU64(),
+					Issued:   issued,
+					Received: time.Now(),
+				}
+				select {
+				case results <- result:
+					broadcast := time.Now()
+					trace.Outcome, trace.Broadcast = TraceAccepted, &broadcast
+					hmhash.solutionFound(SolutionFound{
+						SealHash: trace.SealHash,
+						Hash:     result.Hash(),
+						Number:   result.NumberU64(),
+						Nonce:    types.EncodeNonce(result.Nonce()),
+					})
+				default:
+					trace.Outcome = TraceDropped
+					hmhash.logs.sealer.Warn("Sealing result is not read by miner", "mode", "local", logSealHash, trace.SealHash)
+				}
+				hmhash.traceSolution(trace)
+				span.SetAttributes(attribute.String("hmhash.outcome", trace.Outcome))
 			}
 			close(abort)
 		case <-hmhash.update:
 			// Thread count was changed on user request, restart
 			close(abort)
-			if err := hmhash.Seal(chain, block, results, stop); err != nil {
-				hmhash.config.Log.Error("Failed to restart sealing after update", "err", err)
+			if err := hmhash.seal(ctx, chain, block, results, stop); err != nil {
+				hmhash.logs.sealer.Error("Failed to restart sealing after update", "err", err)
 			}
 		}
 		// Wait for all miners to terminate and return the block
@@ -127,30 +287,54 @@ func (hmhash *Hmhash) Seal(chain consensus.ChainHeaderReader, block *types.Block
 	return nil
 }
 
+// SealContext implements consensus.ContextSealer, sealing a block like Seal
+// until the context is done.
+func (hmhash *Hmhash) SealContext(ctx context.Context, chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return hmhash.seal(ctx, chain, block, results, ctx.Done())
+}
+
 // mine is the actual proof-of-work miner that searches for a nonce starting from
-// seed that results in correct final block difficulty.
-func (hmhash *Hmhash) mine(block *types.Block, id int, seed uint64, abort chan struct{}, found chan *types.Block) {
+// seed and advancing by step that results in correct final block difficulty.
+func (hmhash *Hmhash) mine(rules *params.EthashConfig, block *types.Block, id int, seed uint64, step uint64, meter metrics.Meter, abort chan struct{}, found chan *types.Block) {
 	// Extract some data from the header
 	var (
-		header = block.Header()
-		hash   = hmhash.SealHash(header).Bytes()
-		target = new(big.Int).Div(two256, header.Difficulty)
+		header  = block.Header()
+		hash    = hmhash.SealHash(header).Bytes()
+		target  = new(big.Int).Div(two256, header.Difficulty)
+		number  = header.Number.Uint64()
+		dataset *dataset
 	)
+	if !isCPUPoW(rules, number) {
+		dataset = hmhash.dataset(rules, number, false)
+	}
+	// Pin the thread to its NUMA node, reading the dataset placed for it
+	if hmhash.numa != nil {
+		node := hmhash.numa.node(id)
+		hmhash.numa.pin(node)
+		if dataset != nil {
+			dataset = hmhash.numa.place(dataset, node)
+		}
+	}
 	// Start generating random nonces until we abort or find a good one
 	var (
 		attempts  = int64(0)
+		searched  = uint64(0)
 		nonce     = seed
 		powBuffer = new(big.Int)
 	)
-	logger := hmhash.config.Log.New("miner", id)
+	logger := hmhash.logs.sealer.New("miner", id)
 	logger.Trace("Started hmhash search for new nonces", "seed", seed)
 search:
 	for {
 		select {
 		case <-abort:
 			// Mining terminated, update stats and abort
-			logger.Trace("Hmhash nonce search aborted", "attempts", nonce-seed)
+			logger.Trace("Hmhash nonce search aborted", "attempts", searched)
 			hmhash.hashrate.Mark(attempts)
+			meter.Mark(attempts)
 			break search
 
 		default:
@@ -158,27 +342,33 @@ search:
 			attempts++
 			if (attempts % (1 << 15)) == 0 {
 				hmhash.hashrate.Mark(attempts)
+				meter.Mark(attempts)
 				attempts = 0
 			}
 			// Compute the PoW value of this nonce
-			result := hashimotoFull(hash, types.EncodeNonce(nonce).Hash())
+			digest, result := hmhash.powFull(rules, dataset, number, hash, nonce)
 			if powBuffer.SetBytes(result).Cmp(target) <= 0 {
 				// Correct nonce found, create a new header with it
 				header = types.CopyHeader(header)
 				header.Nonce = types.EncodeNonce(nonce)
+				header.MixDigest = common.BytesToHash(digest)
 
 				// Seal and return a block (if still needed)
 				select {
 				case found <- block.WithSeal(header):
-					logger.Trace("Hmhash nonce found and reported", "attempts", nonce-seed, "nonce", nonce)
+					logger.Trace("Hmhash nonce found and reported", "attempts", searched, logNonce, nonce)
 				case <-abort:
-					logger.Trace("Hmhash nonce found but discarded", "attempts", nonce-seed, "nonce", nonce)
+					logger.Trace("Hmhash nonce found but discarded", "attempts", searched, logNonce, nonce)
 				}
 				break search
 			}
-			nonce++
+			nonce += step
+			searched++
 		}
 	}
+	// Datasets are unmapped in a finalizer. Ensure that the dataset stays live
+	// during sealing so it's not unmapped while being read.
+	runtime.KeepAlive(dataset)
 }
 
 // This is the timeout for HTTP requests to notify external miners.
@@ -186,22 +376,41 @@ const remoteSealerTimeout = 1 * time.Second
 
 type remoteSealer struct {
 	works        map[common.Hash]*types.Block
+	issued       map[common.Hash]time.Time // Time the pending work packages were issued
+	order        []common.Hash             // Work packages in order of creation, oldest first, if buffered
+	roster       *workerRoster             // Remote workers seen, expired after the configured time
+	audit        *shareAuditor             // Share audit of the named workers, nil if share accounting is disabled
+	withhold     *withholdMonitor          // Block withholding monitor of the named workers, nil if share accounting is disabled
 	rates        map[common.Hash]hashrate
 	currentBlock *types.Block
 	currentWork  [4]string
 	notifyCtx    context.Context
 	cancelNotify context.CancelFunc // cancels all notification requests
+	cancelRound  context.CancelFunc // cancels the notification requests of the previous work
 	reqWG        sync.WaitGroup     // tracks notification request goroutines
+	announced    uint64             // Last epoch pre-announced to the remote miners
 
 	hmhash       *Hmhash
 	noverify     bool
-	notifyURLs   []string
+	targets      *notifyTargets
+	client       *http.Client     // HTTP client sending the work notifications
+	auth         *submitAuth      // Authenticator of submissions, nil if anonymous
+	bans         *banList         // Duplicate and invalid submission tracker banning abusers
+	limits       *requestLimiter  // Request rate limiter per method and source, nil if unlimited
+	signers      *hashrateSigners // Keys registered to sign the hash rates of remote workers
+	recorder     *sessionRecorder // Recorder of the work packages and submissions, if recording
+	maxRequest   int              // Maximum size of the variable sized request payloads
+	pending      atomic.Int64     // Number of work packages pending, readable outside the loop
 	results      chan<- *types.Block
-	workCh       chan *sealTask   // Notification channel to push new work and relative result channel to remote sealer
-	fetchWorkCh  chan *sealWork   // Channel used for remote sealer to fetch mining work
-	submitWorkCh chan *mineResult // Channel used for remote sealer to submit their mining result
-	fetchRateCh  chan chan uint64 // Channel used to gather submitted hash rate for local or remote sealer.
-	submitRateCh chan *hashrate   // Channel used for remote sealer to submit their mining hashrate
+	workCh       chan *sealTask                   // Notification channel to push new work and relative result channel to remote sealer
+	fetchWorkCh  chan *sealWork                   // Channel used for remote sealer to fetch mining work
+	submitWorkCh chan *mineResult                 // Channel used for remote sealer to submit their mining result
+	fetchRateCh  chan chan uint64                 // Channel used to gather submitted hash rate for local or remote sealer.
+	fetchRatesCh chan chan map[common.Hash]uint64 // Channel used to gather submitted hash rates by remote sealer.
+	submitRateCh chan *hashrate                   // Channel used for remote sealer to submit their mining hashrate
+	rosterCh     chan chan []RemoteWorker         // Channel used to gather the roster of the remote workers
+	auditCh      chan chan []ShareAudit           // Channel used to gather the share audits of the remote workers
+	lookupCh     chan *workLookup                 // Channel used to look up the pending work of a seal hash
 	requestExit  chan struct{}
 	exitCh       chan struct{}
 }
@@ -217,15 +426,21 @@ type mineResult struct {
 	nonce     types.BlockNonce
 	mixDigest common.Hash
 	hash      common.Hash
+	worker    string          // Worker credited with the share, empty if anonymous
+	source    string          // Submitter tracked for abuse, the worker or IP address
+	aux       *types.Header   // Parent chain header merge-mining the work, nil if mined directly
+	received  time.Time       // Time the solution was submitted
+	ctx       context.Context // Context of the submission, carrying its span
 
 	errc chan error
 }
 
 // hashrate wraps the hash rate submitted by the remote sealer.
 type hashrate struct {
-	id   common.Hash
-	ping time.Time
-	rate uint64
+	id     common.Hash
+	ping   time.Time
+	rate   uint64
+	worker string // Worker bound to the id, empty if anonymous
 
 	done chan struct{}
 }
@@ -236,32 +451,60 @@ type sealWork struct {
 	res  chan [4]string
 }
 
-func startRemoteSealer(hmhash *Hmhash, urls []string, noverify bool) *remoteSealer {
+func startRemoteSealer(hmhash *Hmhash, urls []string, noverify bool, tlsConfig *tls.Config) *remoteSealer {
+	client := http.DefaultClient
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client = &http.Client{Transport: transport}
+	}
+	targets, err := newNotifyTargets(urls, hmhash.config.NotifyFile)
+	if err != nil {
+		hmhash.logs.sealer.Warn("Failed to load remote miner notify targets", "file", hmhash.config.NotifyFile, "err", err)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &remoteSealer{
 		hmhash:       hmhash,
 		noverify:     noverify,
-		notifyURLs:   urls,
+		targets:      targets,
+		client:       client,
+		auth:         newSubmitAuth(hmhash.config.SubmitTokens, hmhash.config.SubmitRateLimit),
+		bans:         newBanList(hmhash.config.SubmitBanThreshold, hmhash.config.SubmitBanTime),
+		limits:       newRequestLimiter(hmhash.config.RequestRateLimit),
+		signers:      newHashrateSigners(hmhash.config.SignedHashrate),
+		recorder:     &sessionRecorder{log: hmhash.logs.sealer},
+		maxRequest:   maxRequestSize(&hmhash.config),
 		notifyCtx:    ctx,
 		cancelNotify: cancel,
 		works:        make(map[common.Hash]*types.Block),
+		issued:       make(map[common.Hash]time.Time),
 		rates:        make(map[common.Hash]hashrate),
+		roster:       newWorkerRoster(hmhash.config.WorkerExpiry),
 		workCh:       make(chan *sealTask),
 		fetchWorkCh:  make(chan *sealWork),
 		submitWorkCh: make(chan *mineResult),
 		fetchRateCh:  make(chan chan uint64),
+		fetchRatesCh: make(chan chan map[common.Hash]uint64),
 		submitRateCh: make(chan *hashrate),
+		rosterCh:     make(chan chan []RemoteWorker),
+		auditCh:      make(chan chan []ShareAudit),
+		lookupCh:     make(chan *workLookup),
 		requestExit:  make(chan struct{}),
 		exitCh:       make(chan struct{}),
 	}
+	if hmhash.shares != nil {
+		s.audit = newShareAuditor(hmhash.config.ShareAuditWindow, hmhash.config.ShareAuditThreshold)
+		s.withhold = newWithholdMonitor(hmhash.config.WithholdWindow, hmhash.config.WithholdSignificance)
+	}
 	go s.loop()
 	return s
 }
 
 func (s *remoteSealer) loop() {
 	defer func() {
-		s.hmhash.config.Log.Trace("Hmhash remote sealer is exiting")
+		s.hmhash.logs.sealer.Trace("Hmhash remote sealer is exiting")
 		s.cancelNotify()
+		s.recorder.stop() // Flush the recording, if any
 		s.reqWG.Wait()
 		close(s.exitCh)
 	}()
@@ -276,7 +519,9 @@ func (s *remoteSealer) loop() {
 			// Note same work can be past twice, happens when changing CPU threads.
 			s.results = work.results
 			s.makeWork(work.block)
+			s.recorder.recordWork(work.block)
 			s.notifyWork()
+			s.announceEpoch(work.block.NumberU64())
 
 		case work := <-s.fetchWorkCh:
 			// Return current mining work to remote miner.
@@ -288,15 +533,55 @@ func (s *remoteSealer) loop() {
 
 		case result := <-s.submitWorkCh:
 			// Verify submitted PoW solution based on maintained mining blocks.
-			if s.submitWork(result.nonce, result.mixDigest, result.hash) {
-				result.errc <- nil
+			// Duplicates are rejected without verification.
+			var err error
+			switch {
+			case result.aux != nil:
+				err = s.submitAuxWork(result.aux, result.received)
+			case s.bans.duplicate(result.hash, result.nonce):
+				err = errDuplicateSolution
+				s.hmhash.logs.sealer.Debug("Duplicate work submitted", logSealHash, result.hash, "source", result.source)
+				s.hmhash.events.reject.Send(SolutionRejected{SealHash: result.hash, Nonce: result.nonce, Source: result.source, Reason: RejectDuplicate})
+				if s.bans.record(result.source, true, time.Now()) {
+					s.hmhash.logs.sealer.Warn("Banned remote miner for duplicate submissions", "source", result.source, "duration", s.bans.duration)
+				}
+			default:
+				err = s.submitWork(result.ctx, result.nonce, result.mixDigest, result.hash, result.worker, result.received)
+				if err != nil {
+					s.hmhash.events.reject.Send(SolutionRejected{SealHash: result.hash, Nonce: result.nonce, Source: result.source, Reason: RejectInvalid})
+					if s.bans.record(result.source, false, time.Now()) {
+						s.hmhash.logs.sealer.Warn("Banned remote miner for invalid submissions", "source", result.source, "duration", s.bans.duration)
+					}
+				}
+			}
+			accepted := err == nil
+			s.roster.submit(result.source, accepted, time.Now())
+			if accepted && s.audit != nil && result.worker != "" {
+				s.audit.share(result.worker)
+			}
+			if accepted {
+				solutionAcceptedMeter.Mark(1)
 			} else {
-				result.errc <- errInvalidSealResult
+				solutionRejectedMeter.Mark(1)
+				markSubmitRejection(err)
 			}
+			s.recorder.recordSubmit(result, err)
+			result.errc <- err
 
 		case result := <-s.submitRateCh:
 			// Trace remote sealer's hash rate by submitted value.
 			s.rates[result.id] = hashrate{rate: result.rate, ping: time.Now()}
+			remoteWorkersGauge.Update(int64(len(s.rates)))
+
+			id := result.worker
+			if id == "" {
+				id = result.id.Hex()
+			}
+			s.roster.report(id, result.rate, time.Now())
+			s.recorder.recordHashrate(result)
+			if s.audit != nil && result.worker != "" {
+				s.audit.report(result.worker, result.rate, time.Now())
+			}
 			close(result.done)
 
 		case req := <-s.fetchRateCh:
@@ -308,21 +593,70 @@ func (s *remoteSealer) loop() {
 			}
 			req <- total
 
+		case req := <-s.fetchRatesCh:
+			// Gather the hash rate submitted by each remote sealer.
+			rates := make(map[common.Hash]uint64, len(s.rates))
+			for id, rate := range s.rates {
+				rates[id] = rate.rate
+			}
+			req <- rates
+
+		case req := <-s.rosterCh:
+			// Gather the roster of the remote workers.
+			req <- s.roster.list(time.Now())
+
+		case req := <-s.lookupCh:
+			// Look up the pending work of a seal hash.
+			work := &pendingWork{block: s.works[req.sealhash]}
+			if work.block != nil {
+				work.current = s.currentBlock != nil && s.hmhash.SealHash(s.currentBlock.Header()) == req.sealhash
+			}
+			req.result <- work
+
+		case req := <-s.auditCh:
+			// Gather the latest share audits of the remote workers.
+			var audits []ShareAudit
+			if s.audit != nil {
+				audits = s.audit.list()
+			}
+			req <- audits
+
 		case <-ticker.C:
-			// Clear stale submitted hash rate.
+			// Clear stale submitted hash rate and publish the remaining.
+			var remote uint64
 			for id, rate := range s.rates {
-				if time.Since(rate.ping) > 10*time.Second {
+				if time.Since(rate.ping) > remoteHashrateTimeout {
 					delete(s.rates, id)
+				} else {
+					remote += rate.rate
 				}
 			}
+			remoteWorkersGauge.Update(int64(len(s.rates)))
+			if expired := s.roster.expire(time.Now()); expired > 0 {
+				s.hmhash.logs.sealer.Debug("Expired stale remote workers", "count", expired, "expiry", s.roster.expiry)
+			}
+			if s.audit != nil {
+				s.auditShares()
+			}
+			if s.withhold != nil {
+				s.checkWithholding()
+			}
+			s.hmhash.events.rates.Send(HashrateSample{Local: s.hmhash.hashrate.Rate1(), Remote: remote, Time: time.Now()})
 			// Clear stale pending blocks
 			if s.currentBlock != nil {
+				window := s.hmhash.StaleWorkWindow()
+				if s.buffered() && window < uncleDepth {
+					window = uncleDepth
+				}
 				for hash, block := range s.works {
-					if block.NumberU64()+staleThreshold <= s.currentBlock.NumberU64() {
+					if block.NumberU64()+window <= s.currentBlock.NumberU64() {
 						delete(s.works, hash)
+						delete(s.issued, hash)
 					}
 				}
+				s.pruneOrder()
 			}
+			s.updatePending()
 
 		case <-s.requestExit:
 			return
@@ -330,6 +664,33 @@ func (s *remoteSealer) loop() {
 	}
 }
 
+// auditShares accrues the shares expected from the named workers and audits
+// those whose window is over, warning about the ones deviating too much.
+func (s *remoteSealer) auditShares() {
+	now := time.Now()
+	s.audit.accrue(now, func(worker string) *big.Int {
+		if s.currentBlock == nil {
+			return nil
+		}
+		return s.hmhash.shares.shareDifficulty(worker, s.currentBlock.Difficulty())
+	})
+	for _, finding := range s.audit.audit(now) {
+		s.hmhash.logs.sealer.Warn("Remote worker shares deviate from reported hashrate", logWorker, finding.Worker,
+			"hashrate", uint64(finding.Hashrate), "expected", finding.Expected, "actual", finding.Actual, "deviation", finding.Deviation)
+	}
+}
+
+// checkWithholding closes the withholding windows which are over, publishing
+// the workers suspected of withholding blocks.
+func (s *remoteSealer) checkWithholding() {
+	for _, suspect := range s.withhold.check(time.Now()) {
+		withholdingMeter.Mark(1)
+		s.hmhash.logs.sealer.Warn("Remote worker suspected of withholding blocks", logWorker, suspect.Worker,
+			"shares", suspect.Shares, "expected", suspect.Expected, "blocks", suspect.Blocks, "probability", suspect.Probability)
+		s.hmhash.events.withhold.Send(suspect)
+	}
+}
+
 // makeWork creates a work package for external miner.
 //
 // The work package consists of 3 strings:
@@ -342,104 +703,266 @@ func (s *remoteSealer) makeWork(block *types.Block) {
 	hash := s.hmhash.SealHash(block.Header())
 	s.currentWork[0] = hash.Hex()
 	s.currentWork[1] = common.BytesToHash(SeedHash(block.NumberU64())).Hex()
-	s.currentWork[2] = common.BytesToHash(new(big.Int).Div(two256, block.Difficulty()).Bytes()).Hex()
+	s.currentWork[2] = common.BytesToHash(s.hmhash.workerTarget("", block.Difficulty()).Bytes()).Hex()
 	s.currentWork[3] = hexutil.EncodeBig(block.Number())
 
 	// Trace the seal work fetched by remote sealer.
 	s.currentBlock = block
+	if _, ok := s.works[hash]; !ok {
+		s.issued[hash] = time.Now()
+		if s.buffered() {
+			s.order = append(s.order, hash)
+			for len(s.order) > s.hmhash.config.WorkBuffer {
+				delete(s.works, s.order[0])
+				delete(s.issued, s.order[0])
+				s.order = s.order[1:]
+			}
+		}
+	}
 	s.works[hash] = block
+	s.updatePending()
+}
+
+// buffered reports whether a bounded number of work packages is kept, handing
+// late solutions to the miner as uncle candidates.
+func (s *remoteSealer) buffered() bool {
+	return s.hmhash.config.WorkBuffer > 0
+}
+
+// pruneOrder drops the work packages no longer pending from the creation order.
+func (s *remoteSealer) pruneOrder() {
+	order := s.order[:0]
+	for _, hash := range s.order {
+		if _, ok := s.works[hash]; ok {
+			order = append(order, hash)
+		}
+	}
+	s.order = order
+}
+
+// updatePending publishes the number of work packages pending remote solutions.
+func (s *remoteSealer) updatePending() {
+	s.pending.Store(int64(len(s.works)))
+	remoteWorksGauge.Update(int64(len(s.works)))
 }
 
 // notifyWork notifies all the specified mining endpoints of the availability of
 // new work to be processed.
 func (s *remoteSealer) notifyWork() {
 	work := s.currentWork
+	blob := s.hmhash.notifyPayload(work, s.currentBlock)
 
-	// Encode the JSON payload of the notification. When NotifyFull is set,
-	// this is the complete block header, otherwise it is a JSON array.
-	var blob []byte
-	if s.hmhash.config.NotifyFull {
-		blob, _ = json.Marshal(s.currentBlock.Header())
-	} else {
-		blob, _ = json.Marshal(work)
+	// Notify the targets, abandoning the retries of the previous work so they
+	// don't override the new one
+	if s.cancelRound != nil {
+		s.cancelRound()
 	}
+	var round context.Context
+	round, s.cancelRound = context.WithCancel(s.notifyCtx)
 
-	s.reqWG.Add(len(s.notifyURLs))
-	for _, url := range s.notifyURLs {
-		go s.sendNotification(s.notifyCtx, url, blob, work)
+	targets := s.targets.all()
+	s.reqWG.Add(len(targets))
+	for _, target := range targets {
+		go s.sendNotification(s.notifyCtx, round, target, blob, work)
+	}
+	// Push the work to any miners connected over the remote transports
+	for _, server := range s.hmhash.servers {
+		server.NotifyWork(work, s.currentBlock)
 	}
 }
 
-func (s *remoteSealer) sendNotification(ctx context.Context, url string, json []byte, work [4]string) {
-	defer s.reqWG.Done()
-
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(json))
-	if err != nil {
-		s.hmhash.config.Log.Warn("Can't create remote miner notification", "err", err)
-		return
-	}
-	ctx, cancel := context.WithTimeout(ctx, remoteSealerTimeout)
-	defer cancel()
-	req = req.WithContext(ctx)
-	req.Header.Set("Content-Type", "application/json")
+// notifyPayload encodes the JSON payload of a work notification. When NotifyFull
+// is set, this is the complete block header, otherwise it is a JSON array.
+func (hmhash *Hmhash) notifyPayload(work [4]string, block *types.Block) []byte {
+	hmhash.lock.Lock()
+	full := hmhash.config.NotifyFull
+	hmhash.lock.Unlock()
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		s.hmhash.config.Log.Warn("Failed to notify remote miner", "err", err)
+	var blob []byte
+	if full {
+		blob, _ = json.Marshal(block.Header())
 	} else {
-		s.hmhash.config.Log.Trace("Notified remote miner", "miner", url, "hash", work[0], "target", work[2])
-		resp.Body.Close()
+		blob, _ = json.Marshal(hmhash.versionWork(work))
 	}
+	return blob
 }
 
-// submitWork verifies the submitted pow solution, returning
-// whether the solution was accepted or not (not can be both a bad pow as well as
-// any other error, like no pending work or stale mining result).
-func (s *remoteSealer) submitWork(nonce types.BlockNonce, mixDigest common.Hash, sealhash common.Hash) bool {
+// submitWork verifies the submitted pow solution, returning why the solution
+// was rejected if so (a bad pow as well as any other error, like no pending
+// work or stale mining result).
+func (s *remoteSealer) submitWork(ctx context.Context, nonce types.BlockNonce, mixDigest common.Hash, sealhash common.Hash, worker string, received time.Time) error {
 	if s.currentBlock == nil {
-		s.hmhash.config.Log.Error("Pending work without block", "sealhash", sealhash)
-		return false
+		s.hmhash.logs.sealer.Error("Pending work without block", logSealHash, sealhash)
+		return errNoMiningWork
 	}
 	// Make sure the work submitted is present
 	block := s.works[sealhash]
 	if block == nil {
-		s.hmhash.config.Log.Warn("Work submitted but none pending", "sealhash", sealhash, "curnumber", s.currentBlock.NumberU64())
-		return false
+		s.hmhash.logs.sealer.Warn("Work submitted but none pending", logSealHash, sealhash, "curnumber", s.currentBlock.NumberU64())
+		return errUnknownWork
 	}
 	// Verify the correctness of submitted result.
 	header := block.Header()
 	header.Nonce = nonce
 	header.MixDigest = mixDigest
 
+	// Credit the worker with a share if share accounting is enabled, and only
+	// go on with sealing if the share also meets the block target
+	if s.hmhash.shares != nil && !s.noverify {
+		sealed, err := s.submitShare(block, header, sealhash, worker)
+		if err != nil {
+			s.hmhash.logs.sealer.Warn("Invalid share submitted", logSealHash, sealhash, logWorker, worker, "err", err)
+			return err
+		}
+		if !sealed {
+			return nil
+		}
+	}
 	start := time.Now()
 	if !s.noverify {
-		if err := s.hmhash.verifySeal(nil, header, true); err != nil {
-			s.hmhash.config.Log.Warn("Invalid proof-of-work submitted", "sealhash", sealhash, "elapsed", common.PrettyDuration(time.Since(start)), "err", err)
-			return false
+		if err := s.hmhash.verifySeal(ctx, nil, header, true); err != nil {
+			s.hmhash.logs.sealer.Warn("Invalid proof-of-work submitted", logSealHash, sealhash, logElapsed, common.PrettyDuration(time.Since(start)), "err", err)
+			return err
 		}
 	}
-	// Make sure the result channel is assigned.
-	if s.results == nil {
-		s.hmhash.config.Log.Warn("Hmhash result channel is empty, submitted mining result is rejected")
-		return false
-	}
-	s.hmhash.config.Log.Trace("Verified correct proof-of-work", "sealhash", sealhash, "elapsed", common.PrettyDuration(time.Since(start)))
+	s.hmhash.logs.sealer.Trace("Verified correct proof-of-work", logSealHash, sealhash, logElapsed, common.PrettyDuration(time.Since(start)))
 
 	// Solutions seems to be valid, return to the miner and notify acceptance.
-	solution := block.WithSeal(header)
+	return s.deliver(block.WithSeal(header), s.trace(sealhash, worker, received, time.Since(start)))
+}
+
+// submitAuxWork verifies a parent chain header merge-mining a pending work,
+// returning why the solution was rejected, if so. The work is identified by
+// the commitment ending the extra-data of the parent chain header.
+func (s *remoteSealer) submitAuxWork(aux *types.Header, received time.Time) error {
+	if s.currentBlock == nil {
+		s.hmhash.logs.sealer.Error("Pending work without block", "parent", aux.Hash())
+		return errNoMiningWork
+	}
+	if len(aux.Extra) < common.HashLength {
+		s.hmhash.logs.sealer.Warn("Merge-mined header without commitment", "parent", aux.Hash())
+		return errMissingCommitment
+	}
+	sealhash := common.BytesToHash(aux.Extra[len(aux.Extra)-common.HashLength:])
+
+	// Make sure the work committed to is present
+	block := s.works[sealhash]
+	if block == nil {
+		s.hmhash.logs.sealer.Warn("Merge-mined work submitted but none pending", logSealHash, sealhash, "curnumber", s.currentBlock.NumberU64())
+		return errUnknownWork
+	}
+	header, err := AuxSeal(block.Header(), aux)
+	if err != nil {
+		s.hmhash.logs.sealer.Warn("Invalid merge-mined header submitted", logSealHash, sealhash, "err", err)
+		return err
+	}
+	start := time.Now()
+	if !s.noverify {
+		if err := s.hmhash.verifyAuxPoW(header); err != nil {
+			s.hmhash.logs.sealer.Warn("Invalid auxiliary proof-of-work submitted", logSealHash, sealhash, logElapsed, common.PrettyDuration(time.Since(start)), "err", err)
+			return err
+		}
+	}
+	s.hmhash.logs.sealer.Trace("Verified correct auxiliary proof-of-work", logSealHash, sealhash, logElapsed, common.PrettyDuration(time.Since(start)))
+	return s.deliver(block.WithSeal(header), s.trace(sealhash, "", received, time.Since(start)))
+}
 
+// trace starts the latency trace of a verified solution to a pending work.
+func (s *remoteSealer) trace(sealhash common.Hash, worker string, received time.Time, verification time.Duration) *SolutionTrace {
+	return &SolutionTrace{
+		SealHash:     sealhash,
+		Remote:       true,
+		Worker:       worker,
+		Issued:       s.issued[sealhash],
+		Received:     received,
+		Verification: verification,
+	}
+}
+
+// deliver hands a sealed block to the miner, unless it's too old to accept,
+// recording the trace of the solution and returning why it was dropped, if so.
+func (s *remoteSealer) deliver(solution *types.Block, trace *SolutionTrace) error {
+	sealhash, worker := trace.SealHash, trace.Worker
+	trace.Hash, trace.Number = solution.Hash(), solution.NumberU64()
+	defer s.hmhash.traceSolution(trace)
+
+	// Make sure the result channel is assigned.
+	if s.results == nil {
+		s.hmhash.logs.sealer.Warn("Hmhash result channel is empty, submitted mining result is rejected")
+		trace.Outcome = TraceDropped
+		return errDroppedSolution
+	}
+	if solution.NumberU64() < s.currentBlock.NumberU64() {
+		solutionStaleMeter.Mark(1)
+
+		// Solutions to buffered outdated work can't extend the chain anymore, hand
+		// them over as uncle candidates instead
+		if s.buffered() {
+			if solution.NumberU64()+uncleDepth <= s.currentBlock.NumberU64() {
+				staleRejectedMeter.Mark(1)
+				s.hmhash.logs.sealer.Warn("Work submitted is too old for an uncle", "number", solution.NumberU64(), logSealHash, sealhash, "hash", solution.Hash())
+				trace.Outcome = TraceStale
+				return errStaleWork
+			}
+			solutionUncleMeter.Mark(1)
+			s.hmhash.events.uncles.Send(solution)
+			broadcast := time.Now()
+			trace.Outcome, trace.Broadcast = TraceUncle, &broadcast
+			s.hmhash.logs.sealer.Debug("Work submitted is an uncle candidate", "number", solution.NumberU64(), logSealHash, sealhash, "hash", solution.Hash())
+			return nil
+		}
+	}
 	// The submitted solution is within the scope of acceptance.
-	if solution.NumberU64()+staleThreshold > s.currentBlock.NumberU64() {
+	if solution.NumberU64()+s.hmhash.StaleWorkWindow() > s.currentBlock.NumberU64() {
 		select {
 		case s.results <- solution:
-			s.hmhash.config.Log.Debug("Work submitted is acceptable", "number", solution.NumberU64(), "sealhash", sealhash, "hash", solution.Hash())
-			return true
+			broadcast := time.Now()
+			trace.Outcome, trace.Broadcast = TraceAccepted, &broadcast
+			s.hmhash.logs.sealer.Debug("Work submitted is acceptable", "number", solution.NumberU64(), logSealHash, sealhash, "hash", solution.Hash())
+			if solution.NumberU64() < s.currentBlock.NumberU64() {
+				staleAcceptedMeter.Mark(1)
+			}
+			s.hmhash.solutionFound(SolutionFound{
+				SealHash: sealhash,
+				Hash:     solution.Hash(),
+				Number:   solution.NumberU64(),
+				Nonce:    types.EncodeNonce(solution.Nonce()),
+				Remote:   true,
+				Worker:   worker,
+			})
+			return nil
 		default:
-			s.hmhash.config.Log.Warn("Sealing result is not read by miner", "mode", "remote", "sealhash", sealhash)
-			return false
+			s.hmhash.logs.sealer.Warn("Sealing result is not read by miner", "mode", "remote", logSealHash, sealhash)
+			trace.Outcome = TraceDropped
+			return errDroppedSolution
 		}
 	}
 	// The submitted block is too old to accept, drop it.
-	s.hmhash.config.Log.Warn("Work submitted is too old", "number", solution.NumberU64(), "sealhash", sealhash, "hash", solution.Hash())
-	return false
+	staleRejectedMeter.Mark(1)
+	s.hmhash.logs.sealer.Warn("Work submitted is too old", "number", solution.NumberU64(), logSealHash, sealhash, "hash", solution.Hash())
+	trace.Outcome = TraceStale
+	return errStaleWork
+}
+
+// submitShare verifies a solution against the share target and records it,
+// returning whether it also meets the block target.
+func (s *remoteSealer) submitShare(block *types.Block, header *types.Header, sealhash common.Hash, worker string) (bool, error) {
+	number := header.Number.Uint64()
+	digest, result := s.hmhash.powResult(number, sealhash, header.Nonce.Uint64())
+	if digest != header.MixDigest {
+		return false, errInvalidMixDigest
+	}
+	target, ok := s.hmhash.shares.check(worker, header.Difficulty, new(big.Int).SetBytes(result))
+	if !ok {
+		return false, errInvalidPoW
+	}
+	sealed := new(big.Int).SetBytes(result).Cmp(new(big.Int).Div(two256, header.Difficulty)) <= 0
+	if err := s.hmhash.shares.add(worker, header, sealhash, target, sealed, s.hmhash.StaleWorkWindow()); err != nil {
+		return false, err
+	}
+	shareMeter.Mark(1)
+	if s.withhold != nil && worker != "" {
+		s.withhold.share(worker, new(big.Int).Div(two256, target), header.Difficulty, sealed, time.Now())
+	}
+	return sealed, nil
 }
@@ -17,7 +17,9 @@
 package ethash
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"math/big"
 	"net/http"
@@ -27,6 +29,8 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/testlog"
 	"github.com/ethereum/go-ethereum/log"
@@ -268,7 +272,7 @@ func TestStaleSubmission(t *testing.T) {
 		for _, h := range c.headers {
 			hmhash.Seal(nil, types.NewBlockWithHeader(h), results, nil)
 		}
-		if res := api.SubmitWork(fakeNonce, hmhash.SealHash(c.headers[c.submitIndex]), fakeDigest); res != c.submitRes {
+		if res := api.SubmitWork(context.Background(), fakeNonce, hmhash.SealHash(c.headers[c.submitIndex]), fakeDigest, nil); res != c.submitRes {
 			t.Errorf("case %d submit result mismatch, want %t, get %t", id+1, c.submitRes, res)
 		}
 		if !c.submitRes {
@@ -296,3 +300,206 @@ func TestStaleSubmission(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the stale work window can be adjusted at runtime.
+func TestStaleWorkWindow(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, StaleWorkWindow: 10}, nil, true)
+	defer hmhash.Close()
+	api := &API{hmhash}
+	mining := &MiningAPI{hmhash}
+
+	if window := mining.GetStaleWorkWindow(); window != 10 {
+		t.Fatalf("configured window mismatch: have %d, want 10", window)
+	}
+	if err := mining.SetStaleWorkWindow(0); err != errInvalidStaleWindow {
+		t.Fatalf("empty window error mismatch: have %v, want %v", err, errInvalidStaleWindow)
+	}
+	fakeNonce, fakeDigest := types.BlockNonce{0x01, 0x02, 0x03}, common.HexToHash("deadbeef")
+	results := make(chan *types.Block, 16)
+
+	testcases := []struct {
+		window uint64
+		old    int64
+		head   int64
+		accept bool
+	}{
+		{10, 1, 8, true},    // Beyond the default window, within the configured one
+		{10, 10, 20, false}, // Beyond the configured window
+		{3, 30, 32, true},   // Within the reduced window
+		{3, 40, 43, false},  // Beyond the reduced window
+	}
+	for i, c := range testcases {
+		if err := mining.SetStaleWorkWindow(hexutil.Uint64(c.window)); err != nil {
+			t.Fatalf("case %d: failed to set window: %v", i, err)
+		}
+		old := &types.Header{Number: big.NewInt(c.old), Difficulty: big.NewInt(100000000)}
+		head := &types.Header{Number: big.NewInt(c.head), Difficulty: big.NewInt(100000000)}
+		hmhash.Seal(nil, types.NewBlockWithHeader(old), results, nil)
+		hmhash.Seal(nil, types.NewBlockWithHeader(head), results, nil)
+
+		if res := api.SubmitWork(context.Background(), fakeNonce, hmhash.SealHash(old), fakeDigest, nil); res != c.accept {
+			t.Errorf("case %d: submit result mismatch: have %t, want %t", i, res, c.accept)
+		}
+		if c.accept {
+			<-results
+		}
+	}
+}
+
+// Tests that sealing and seal verification are abandoned once their context is
+// done, and that no result is delivered after cancelling a seal.
+func TestSealContext(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	// Cancel a seal which can't be found in time
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(common.Big1, 200)}
+	results := make(chan *types.Block, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := hmhash.SealContext(ctx, nil, types.NewBlockWithHeader(header), results); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	cancel()
+	if err := hmhash.SealContext(ctx, nil, types.NewBlockWithHeader(header), results); err != context.Canceled {
+		t.Errorf("cancelled seal error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	select {
+	case block := <-results:
+		t.Errorf("result delivered after cancelling: %x", block.Hash())
+	case <-time.After(100 * time.Millisecond):
+	}
+	// Verify a sealed header, and abandon a verification
+	header = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	if err := hmhash.SealContext(context.Background(), nil, types.NewBlockWithHeader(header), results); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	var sealed *types.Block
+	select {
+	case sealed = <-results:
+	case <-time.After(4 * time.Second):
+		t.Fatalf("sealing result timeout")
+	}
+	if err := hmhash.VerifySealContext(context.Background(), nil, sealed.Header()); err != nil {
+		t.Errorf("failed to verify seal: %v", err)
+	}
+	if err := hmhash.VerifySealContext(ctx, nil, sealed.Header()); err != context.Canceled {
+		t.Errorf("cancelled verification error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
+
+// Tests that seals not found before the sealing deadline are abandoned and
+// reported to the seal failure subscribers.
+func TestSealTimeout(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	hmhash.config.SealTimeout = 100 * time.Millisecond
+
+	failures := make(chan consensus.SealFailure, 1)
+	sub := hmhash.SubscribeSealFailures(failures)
+	defer sub.Unsubscribe()
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(common.Big1, 200)}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	select {
+	case failure := <-failures:
+		if failure.SealHash != hmhash.SealHash(header) {
+			t.Errorf("sealhash mismatch: have %x, want %x", failure.SealHash, hmhash.SealHash(header))
+		}
+		if !errors.Is(failure.Err, ErrSealTimeout) {
+			t.Errorf("failure error mismatch: have %v, want %v", failure.Err, ErrSealTimeout)
+		}
+	case block := <-results:
+		t.Fatalf("unexpected result delivered: %x", block.Hash())
+	case <-time.After(4 * time.Second):
+		t.Fatalf("sealing deadline not reported")
+	}
+}
+
+// Tests that deterministic engines seal the same block identically across runs.
+func TestSealDeterministic(t *testing.T) {
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+
+	var sealed []*types.Block
+	for i := 0; i < 2; i++ {
+		hmhash := NewDeterministic(nil, false)
+		defer hmhash.Close()
+
+		results := make(chan *types.Block, 1)
+		if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+			t.Fatalf("run %d: failed to seal block: %v", i, err)
+		}
+		select {
+		case block := <-results:
+			if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+				t.Fatalf("run %d: failed to verify seal: %v", i, err)
+			}
+			sealed = append(sealed, block)
+		case <-time.After(4 * time.Second):
+			t.Fatalf("run %d: sealing result timeout", i)
+		}
+	}
+	if sealed[0].Hash() != sealed[1].Hash() {
+		t.Errorf("sealed block mismatch: nonce %d vs %d", sealed[0].Nonce(), sealed[1].Nonce())
+	}
+}
+
+// Tests that a bounded number of work packages is kept, with solutions to the
+// outdated ones handed over as uncle candidates.
+func TestWorkBufferUncles(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, WorkBuffer: 3}, nil, true)
+	defer hmhash.Close()
+	api := &API{hmhash}
+
+	uncles := make(chan *types.Block, 1)
+	sub := hmhash.SubscribeUncleCandidates(uncles)
+	defer sub.Unsubscribe()
+
+	headers := []*types.Header{
+		{ParentHash: common.Hash{0x1}, Number: big.NewInt(3), Difficulty: big.NewInt(100000000)},
+		{ParentHash: common.Hash{0x2}, Number: big.NewInt(4), Difficulty: big.NewInt(100000000)},
+		{ParentHash: common.Hash{0x3}, Number: big.NewInt(5), Difficulty: big.NewInt(100000000)},
+		{ParentHash: common.Hash{0x3}, Number: big.NewInt(5), Difficulty: big.NewInt(100000001)},
+	}
+	results := make(chan *types.Block, 1)
+	for _, header := range headers {
+		hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+	}
+	nonce, digest := types.BlockNonce{0x01}, common.HexToHash("deadbeef")
+
+	// The oldest work was evicted from the buffer
+	if api.SubmitWork(context.Background(), nonce, hmhash.SealHash(headers[0]), digest, nil) {
+		t.Errorf("evicted work accepted")
+	}
+	// Outdated work becomes an uncle candidate
+	if !api.SubmitWork(context.Background(), nonce, hmhash.SealHash(headers[1]), digest, nil) {
+		t.Fatalf("outdated work rejected")
+	}
+	select {
+	case block := <-uncles:
+		if block.NumberU64() != 4 || block.Nonce() != nonce.Uint64() {
+			t.Errorf("uncle candidate mismatch: number %d, nonce %x", block.NumberU64(), block.Nonce())
+		}
+	case block := <-results:
+		t.Fatalf("outdated work delivered as block %d", block.NumberU64())
+	case <-time.After(time.Second):
+		t.Fatalf("uncle candidate timeout")
+	}
+	// Work at the current height is still delivered as a block
+	if !api.SubmitWork(context.Background(), nonce, hmhash.SealHash(headers[2]), digest, nil) {
+		t.Fatalf("current work rejected")
+	}
+	select {
+	case block := <-results:
+		if block.NumberU64() != 5 {
+			t.Errorf("sealed block number mismatch: have %d, want 5", block.NumberU64())
+		}
+	case <-uncles:
+		t.Fatalf("current work delivered as uncle candidate")
+	case <-time.After(time.Second):
+		t.Fatalf("sealing result timeout")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// seedEpochLimit is the number of epochs whose seeds are cached, and searched by
+// EpochFromSeedHash, lasting way beyond the lifetime of any chain.
+const seedEpochLimit = 8192
+
+var (
+	errInvalidSeedHash = errors.New("invalid seed hash length")
+	errUnknownSeedHash = errors.New("unknown seed hash")
+)
+
+// seedCache holds the seeds of the epochs computed so far, each one being the
+// keccak256 hash of the previous one, so they're derived incrementally.
+var seedCache = struct {
+	seeds [][32]byte          // Seeds indexed by epoch
+	epoch map[[32]byte]uint64 // Epochs indexed by seed
+	lock  sync.Mutex
+}{
+	seeds: [][32]byte{{}},
+	epoch: map[[32]byte]uint64{{}: 0},
+}
+
+// epochSeed returns the seed of an epoch, caching the seeds up to it.
+func epochSeed(epoch uint64) [32]byte {
+	// Seeds beyond the cached ones are derived from the last cached one, without
+	// holding up other callers
+	if epoch >= seedEpochLimit {
+		seed := epochSeed(seedEpochLimit - 1)
+		keccak256 := makeHasher(sha3.NewLegacyKeccak256())
+		for i := uint64(seedEpochLimit); i <= epoch; i++ {
+			keccak256(seed[:], seed[:])
+		}
+		return seed
+	}
+	seedCache.lock.Lock()
+	defer seedCache.lock.Unlock()
+
+	if epoch < uint64(len(seedCache.seeds)) {
+		return seedCache.seeds[epoch]
+	}
+	keccak256 := makeHasher(sha3.NewLegacyKeccak256())
+	seed := seedCache.seeds[len(seedCache.seeds)-1]
+	for i := uint64(len(seedCache.seeds)); i <= epoch; i++ {
+		keccak256(seed[:], seed[:])
+		seedCache.seeds = append(seedCache.seeds, seed)
+		seedCache.epoch[seed] = i
+	}
+	return seed
+}
+
+// EpochFromSeedHash returns the epoch of a seed hash, as handed out in work
+// packages, for tools that don't know the block number of the work.
+func EpochFromSeedHash(seed []byte) (uint64, error) {
+	if len(seed) != 32 {
+		return 0, errInvalidSeedHash
+	}
+	var key [32]byte
+	copy(key[:], seed)
+
+	seedCache.lock.Lock()
+	epoch, ok := seedCache.epoch[key]
+	cached := len(seedCache.seeds)
+	seedCache.lock.Unlock()
+	if ok {
+		return epoch, nil
+	}
+	// Not cached yet, compute all the seeds that can be looked up
+	if cached < seedEpochLimit {
+		epochSeed(seedEpochLimit - 1)
+
+		seedCache.lock.Lock()
+		epoch, ok = seedCache.epoch[key]
+		seedCache.lock.Unlock()
+		if ok {
+			return epoch, nil
+		}
+	}
+	return 0, errUnknownSeedHash
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Tests that the cached seeds match the ones computed from scratch, and that
+// seeds map back to their epoch.
+func TestSeedHash(t *testing.T) {
+	seed := make([]byte, 32)
+	for epoch := uint64(0); epoch < seedEpochLimit+3; epoch++ {
+		for _, block := range []uint64{epoch * epochLength, epoch*epochLength + epochLength - 1} {
+			if have := SeedHash(block); !bytes.Equal(have, seed) {
+				t.Fatalf("block %d: seed mismatch: have %x, want %x", block, have, seed)
+			}
+		}
+		if epoch%1000 == 0 && epoch < seedEpochLimit {
+			if have, err := EpochFromSeedHash(seed); err != nil || have != epoch {
+				t.Fatalf("epoch %d: reverse lookup mismatch: have %d, %v", epoch, have, err)
+			}
+		}
+		hasher := sha3.NewLegacyKeccak256()
+		hasher.Write(seed)
+		seed = hasher.Sum(nil)
+	}
+	if _, err := EpochFromSeedHash(seed); err != errUnknownSeedHash {
+		t.Errorf("uncached seed error mismatch: have %v, want %v", err, errUnknownSeedHash)
+	}
+	if _, err := EpochFromSeedHash(seed[:31]); err != errInvalidSeedHash {
+		t.Errorf("short seed error mismatch: have %v, want %v", err, errInvalidSeedHash)
+	}
+}
+
+// Tests that seeds are looked up before the epochs are sealed or verified.
+func TestEpochFromSeedHashUncached(t *testing.T) {
+	seed := SeedHash(2 * epochLength)
+	seedCache.lock.Lock()
+	seedCache.seeds = seedCache.seeds[:1]
+	for key, epoch := range seedCache.epoch {
+		if epoch > 0 {
+			delete(seedCache.epoch, key)
+		}
+	}
+	seedCache.lock.Unlock()
+
+	if epoch, err := EpochFromSeedHash(seed); err != nil || epoch != 2 {
+		t.Errorf("reverse lookup mismatch: have %d, %v, want 2", epoch, err)
+	}
+}
+
+func BenchmarkSeedHash(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		SeedHash(1000 * epochLength)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// defaultShareAuditWindow is the period over which the shares of a worker are
+	// compared to its reported hashrate if the config leaves it unset.
+	defaultShareAuditWindow = time.Hour
+
+	// defaultShareAuditThreshold is the relative deviation of the shares of a
+	// worker from the expected count flagging it if the config leaves it unset.
+	defaultShareAuditThreshold = 0.5
+
+	// minShareAuditExpected is the number of shares a worker must be expected to
+	// submit in a window for its deviation to be significant.
+	minShareAuditExpected = 10
+)
+
+// shareAuditFlaggedGauge is the number of workers flagged by their latest share
+// audit.
+var shareAuditFlaggedGauge = metrics.NewRegisteredGauge("hmhash/shares/audit/flagged", nil)
+
+// ShareAudit is the comparison of the shares submitted by a named remote worker
+// in an audit window to the number expected from its reported hashrate and
+// share difficulty. Workers deviating beyond the threshold are flagged, as they
+// might spoof their hashrate.
+type ShareAudit struct {
+	Worker    string         `json:"worker"`    // Name of the worker audited
+	Start     time.Time      `json:"start"`     // Start of the audit window
+	End       time.Time      `json:"end"`       // End of the audit window
+	Hashrate  hexutil.Uint64 `json:"hashrate"`  // Hash rate last reported by the worker
+	Expected  float64        `json:"expected"`  // Shares expected from the reported hashrate
+	Actual    uint64         `json:"actual"`    // Shares accepted from the worker
+	Deviation float64        `json:"deviation"` // Relative deviation of the actual from the expected shares
+	Flagged   bool           `json:"flagged"`   // Whether the deviation exceeds the threshold
+}
+
+// auditWindow accumulates the expected and actual shares of a worker in the
+// current audit window.
+type auditWindow struct {
+	start    time.Time // Start of the window
+	rate     uint64    // Hash rate last reported by the worker
+	reported time.Time // Time of the last hashrate report
+	expected float64   // Shares expected in the window so far
+	actual   uint64    // Shares accepted in the window so far
+}
+
+// shareAuditor compares the shares of the named remote workers to their
+// reported hashrates. Only workers whose hashrate id is bound to their name by
+// a submission token can be audited. It's only accessed from the remote sealer
+// loop, so it needs no locking.
+type shareAuditor struct {
+	window    time.Duration
+	threshold float64
+	accrued   time.Time               // Time the expected shares were last accrued
+	windows   map[string]*auditWindow // Open audit windows by worker name
+	findings  map[string]ShareAudit   // Latest audit by worker name
+}
+
+// newShareAuditor creates a share auditor, using the defaults for a zero window
+// or threshold.
+func newShareAuditor(window time.Duration, threshold float64) *shareAuditor {
+	if window <= 0 {
+		window = defaultShareAuditWindow
+	}
+	if threshold <= 0 {
+		threshold = defaultShareAuditThreshold
+	}
+	return &shareAuditor{
+		window:    window,
+		threshold: threshold,
+		windows:   make(map[string]*auditWindow),
+		findings:  make(map[string]ShareAudit),
+	}
+}
+
+// report records the hashrate reported by a worker, opening its audit window
+// if none is open.
+func (a *shareAuditor) report(worker string, rate uint64, now time.Time) {
+	w := a.windows[worker]
+	if w == nil {
+		w = &auditWindow{start: now}
+		a.windows[worker] = w
+	}
+	w.rate, w.reported = rate, now
+}
+
+// share records a share accepted from a worker. Shares of workers without an
+// open audit window aren't audited.
+func (a *shareAuditor) share(worker string) {
+	if w := a.windows[worker]; w != nil {
+		w.actual++
+	}
+}
+
+// accrue adds the shares expected since the last accrual to the open windows,
+// based on the hashrate of the workers still reporting it and their share
+// difficulty, if known.
+func (a *shareAuditor) accrue(now time.Time, difficulty func(worker string) *big.Int) {
+	elapsed := now.Sub(a.accrued)
+	if a.accrued.IsZero() || elapsed <= 0 {
+		a.accrued = now
+		return
+	}
+	a.accrued = now
+	for worker, w := range a.windows {
+		if now.Sub(w.reported) > remoteHashrateTimeout {
+			continue
+		}
+		share := difficulty(worker)
+		if share == nil || share.Sign() <= 0 {
+			continue
+		}
+		diff, _ := new(big.Float).SetInt(share).Float64()
+		w.expected += float64(w.rate) * elapsed.Seconds() / diff
+	}
+}
+
+// audit closes the windows which lasted the audit period, recording their
+// findings and returning the flagged ones. Windows of workers which stopped
+// reporting their hashrate are dropped.
+func (a *shareAuditor) audit(now time.Time) []ShareAudit {
+	var flagged []ShareAudit
+	for worker, w := range a.windows {
+		if now.Sub(w.start) < a.window {
+			continue
+		}
+		finding := ShareAudit{
+			Worker:   worker,
+			Start:    w.start,
+			End:      now,
+			Hashrate: hexutil.Uint64(w.rate),
+			Expected: w.expected,
+			Actual:   w.actual,
+		}
+		if w.expected > 0 {
+			finding.Deviation = (float64(w.actual) - w.expected) / w.expected
+		}
+		finding.Flagged = w.expected >= minShareAuditExpected && math.Abs(finding.Deviation) > a.threshold
+		if finding.Flagged {
+			flagged = append(flagged, finding)
+		}
+		a.findings[worker] = finding
+
+		if now.Sub(w.reported) > remoteHashrateTimeout {
+			delete(a.windows, worker)
+		} else {
+			w.start, w.expected, w.actual = now, 0, 0
+		}
+	}
+	var count int64
+	for _, finding := range a.findings {
+		if finding.Flagged {
+			count++
+		}
+	}
+	shareAuditFlaggedGauge.Update(count)
+	return flagged
+}
+
+// list returns the latest audit of every worker sorted by name.
+func (a *shareAuditor) list() []ShareAudit {
+	findings := make([]ShareAudit, 0, len(a.findings))
+	for _, finding := range a.findings {
+		findings = append(findings, finding)
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Worker < findings[j].Worker })
+	return findings
+}
+
+// ShareAudits returns the latest share audit of every named remote worker, or
+// an error if share accounting is disabled.
+func (hmhash *Hmhash) ShareAudits() ([]ShareAudit, error) {
+	if hmhash.shared != nil {
+		return hmhash.shared.ShareAudits()
+	}
+	if hmhash.shares == nil || hmhash.remote == nil {
+		return nil, errSharesDisabled
+	}
+	req := make(chan []ShareAudit, 1)
+	select {
+	case hmhash.remote.auditCh <- req:
+	case <-hmhash.remote.exitCh:
+		return nil, errHmhashStopped
+	}
+	return <-req, nil
+}
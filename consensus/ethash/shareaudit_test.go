@@ -0,0 +1,103 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Tests that the share auditor flags the workers whose shares deviate from the
+// count expected from their reported hashrate.
+func TestShareAudit(t *testing.T) {
+	var (
+		audit = newShareAuditor(time.Minute, 0.5)
+		now   = time.Now()
+	)
+	difficulty := func(worker string) *big.Int { return big.NewInt(1000) }
+
+	// Every worker reports 100 H/s at difficulty 1000, expecting 6 shares a minute
+	audit.accrue(now, difficulty)
+	for _, worker := range []string{"honest", "spoofer", "idle"} {
+		audit.report(worker, 100, now)
+	}
+	for i := 0; i < 12; i++ {
+		now = now.Add(5 * time.Second)
+		for _, worker := range []string{"honest", "spoofer"} {
+			audit.report(worker, 100, now)
+		}
+		audit.accrue(now, difficulty)
+		if i%2 == 0 {
+			audit.share("honest")
+		}
+	}
+	audit.share("spoofer")
+	audit.share("unknown") // Workers without hashrate reports aren't audited
+
+	if flagged := audit.audit(now); len(flagged) != 0 {
+		t.Fatalf("flagged below the significant expected count: %+v", flagged)
+	}
+	findings := audit.list()
+	if len(findings) != 3 {
+		t.Fatalf("findings mismatch: have %+v", findings)
+	}
+	if f := findings[0]; f.Worker != "honest" || math.Abs(f.Expected-6) > 1e-9 || f.Actual != 6 || f.Deviation != 0 {
+		t.Errorf("honest finding mismatch: %+v", f)
+	}
+	if f := findings[1]; f.Worker != "idle" || math.Abs(f.Expected-1) > 1e-9 || f.Actual != 0 {
+		t.Errorf("idle finding mismatch: %+v", f)
+	}
+	if f := findings[2]; f.Worker != "spoofer" || f.Actual != 1 || f.Flagged {
+		t.Errorf("spoofer finding mismatch: %+v", f)
+	}
+	// The idle worker stopped reporting, the others are audited over a window
+	// expecting significant share counts
+	if _, ok := audit.windows["idle"]; ok {
+		t.Errorf("window of stopped worker kept")
+	}
+	for i := 0; i < 12; i++ {
+		now = now.Add(5 * time.Second)
+		for _, worker := range []string{"honest", "spoofer"} {
+			audit.report(worker, 1000, now)
+		}
+		audit.accrue(now, difficulty)
+		for j := 0; j < 5; j++ {
+			audit.share("honest")
+		}
+	}
+	flagged := audit.audit(now)
+	if len(flagged) != 1 || flagged[0].Worker != "spoofer" || math.Abs(flagged[0].Deviation+1) > 1e-9 {
+		t.Fatalf("flagged workers mismatch: %+v", flagged)
+	}
+}
+
+// Tests that share audits are unavailable without share accounting.
+func TestShareAuditDisabled(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest}, nil, true)
+	defer hmhash.Close()
+
+	if _, err := (&MiningAPI{hmhash}).GetShareAudit(); err != errSharesDisabled {
+		t.Fatalf("error mismatch: have %v, want %v", err, errSharesDisabled)
+	}
+	hmhash = New(Config{PowMode: ModeTest, ShareDifficulty: 10}, nil, true)
+	defer hmhash.Close()
+
+	if audits, err := hmhash.ShareAudits(); err != nil || len(audits) != 0 {
+		t.Fatalf("audits mismatch: have %v, %v", audits, err)
+	}
+}
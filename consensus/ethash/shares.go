@@ -0,0 +1,381 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	errSharesDisabled = errors.New("share accounting disabled")
+	errDuplicateShare = errors.New("duplicate share")
+
+	// shareKeyPrefix prefixes the database keys of the persisted shares, followed
+	// by the block number, seal hash and nonce of the share.
+	shareKeyPrefix = []byte("hmhash-share-")
+)
+
+// Share is a solution submitted by a remote worker which met the share target,
+// whether or not it sealed the block.
+type Share struct {
+	Worker     string           // Name of the worker credited with the share
+	Number     uint64           // Number of the block the work belonged to
+	SealHash   common.Hash      // Seal hash of the work package
+	Nonce      types.BlockNonce // Nonce solving the work package
+	Difficulty *big.Int         // Difficulty of the share target met
+	Block      bool             // Whether the share also sealed the block
+	Time       uint64           // Unix timestamp of the submission
+
+	BlockDifficulty *big.Int    `rlp:"optional"` // Difficulty of the block the work belonged to
+	BlockHash       common.Hash `rlp:"optional"` // Hash of the block sealed by the share, if any
+}
+
+// ShareStore is the persistence hook of the share accounting, allowing the node
+// to be restarted without losing the shares of a running pool.
+type ShareStore interface {
+	// WriteShare persists an accepted share.
+	WriteShare(share *Share) error
+
+	// IterateShares calls fn with every persisted share, ordered by block number,
+	// until it returns false.
+	IterateShares(fn func(share *Share) bool) error
+
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// dbShareStore is a ShareStore backed by a key-value database.
+type dbShareStore struct {
+	db ethdb.KeyValueStore
+}
+
+// NewShareStore creates a share store persisting into the given database, which
+// is closed together with the store.
+func NewShareStore(db ethdb.KeyValueStore) ShareStore {
+	return &dbShareStore{db: db}
+}
+
+// NewLevelDBShareStore creates a share store persisting into a LevelDB database
+// in the given directory.
+func NewLevelDBShareStore(dir string) (ShareStore, error) {
+	db, err := leveldb.New(dir, 16, 16, "hmhash/shares/", false)
+	if err != nil {
+		return nil, err
+	}
+	return NewShareStore(db), nil
+}
+
+// shareKey = shareKeyPrefix + number (uint64 big endian) + sealhash + nonce
+func shareKey(number uint64, sealhash common.Hash, nonce types.BlockNonce) []byte {
+	key := make([]byte, len(shareKeyPrefix)+8+common.HashLength+8)
+	copy(key, shareKeyPrefix)
+	binary.BigEndian.PutUint64(key[len(shareKeyPrefix):], number)
+	copy(key[len(shareKeyPrefix)+8:], sealhash[:])
+	copy(key[len(shareKeyPrefix)+8+common.HashLength:], nonce[:])
+	return key
+}
+
+func (s *dbShareStore) WriteShare(share *Share) error {
+	blob, err := rlp.EncodeToBytes(share)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(shareKey(share.Number, share.SealHash, share.Nonce), blob)
+}
+
+func (s *dbShareStore) IterateShares(fn func(share *Share) bool) error {
+	it := s.db.NewIterator(shareKeyPrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		share := new(Share)
+		if err := rlp.DecodeBytes(it.Value(), share); err != nil {
+			return err
+		}
+		if !fn(share) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+func (s *dbShareStore) Close() error {
+	return s.db.Close()
+}
+
+// WorkerShares is the share statistics of a single worker.
+type WorkerShares struct {
+	Shares     hexutil.Uint64 `json:"shares"`     // Number of accepted shares
+	Difficulty *hexutil.Big   `json:"difficulty"` // Sum of the difficulty of the accepted shares
+	Blocks     hexutil.Uint64 `json:"blocks"`     // Number of shares which also sealed a block
+	LastShare  hexutil.Uint64 `json:"lastShare"`  // Unix timestamp of the latest accepted share
+}
+
+// shareTracker records the shares submitted by the remote workers, so a solo
+// pool can pay them out in proportion to their work.
+type shareTracker struct {
+	difficulty *big.Int   // Share difficulty, the starting difficulty of named workers with vardiff
+	rate       uint64     // Shares per minute targeted by vardiff, zero if disabled
+	store      ShareStore // Persistence hook, nil to keep shares in memory only
+	log        log.Logger
+
+	lock     sync.Mutex
+	workers  map[string]*WorkerShares        // Share statistics by worker name
+	seen     map[uint64]map[shareID]struct{} // Recent shares by block number, to reject duplicates
+	vardiffs map[string]*vardiff             // Share difficulty of named workers, if vardiff is enabled
+	ledger   *payoutLedger                   // Rounds of shares ended by blocks, nil if payouts are disabled
+}
+
+// shareID identifies a share across workers, so the same solution can't be
+// credited twice.
+type shareID struct {
+	sealhash common.Hash
+	nonce    types.BlockNonce
+}
+
+// newShareTracker creates a share tracker, restoring the statistics and payout
+// rounds of the shares found in the store. A nil payout scheme keeps no ledger.
+func newShareTracker(difficulty uint64, rate uint64, scheme PayoutScheme, store ShareStore, logger log.Logger) (*shareTracker, error) {
+	t := &shareTracker{
+		difficulty: new(big.Int).SetUint64(difficulty),
+		rate:       rate,
+		store:      store,
+		log:        logger,
+		workers:    make(map[string]*WorkerShares),
+		seen:       make(map[uint64]map[shareID]struct{}),
+		vardiffs:   make(map[string]*vardiff),
+	}
+	if scheme != nil {
+		t.ledger = newPayoutLedger(scheme)
+	}
+	if store != nil {
+		var count int
+		err := store.IterateShares(func(share *Share) bool {
+			t.account(share)
+			count++
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Restored hmhash shares", "shares", count, "workers", len(t.workers))
+	}
+	return t, nil
+}
+
+// target returns the share target of a worker for a block of the given
+// difficulty, which is the block's own target if the block is easier.
+func (t *shareTracker) target(worker string, difficulty *big.Int) *big.Int {
+	t.lock.Lock()
+	share := t.difficulty
+	if worker != "" && t.rate > 0 {
+		share = t.vardiff(worker, time.Now()).difficulty
+	}
+	t.lock.Unlock()
+
+	if difficulty.Cmp(share) < 0 {
+		share = difficulty
+	}
+	return new(big.Int).Div(two256, share)
+}
+
+// shareDifficulty returns the share difficulty of a worker for a block of the
+// given difficulty, without starting vardiff for workers unknown to it.
+func (t *shareTracker) shareDifficulty(worker string, difficulty *big.Int) *big.Int {
+	t.lock.Lock()
+	share := t.difficulty
+	if v := t.vardiffs[worker]; v != nil {
+		share = v.difficulty
+	}
+	t.lock.Unlock()
+
+	if difficulty.Cmp(share) < 0 {
+		share = difficulty
+	}
+	return share
+}
+
+// setDifficulty changes the share difficulty, the starting difficulty of named
+// workers not retargeted by vardiff yet.
+func (t *shareTracker) setDifficulty(difficulty uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.difficulty = new(big.Int).SetUint64(difficulty)
+}
+
+// check returns the share target met by a proof-of-work result, accepting the
+// previous target of the worker for shares mined before a vardiff retarget.
+func (t *shareTracker) check(worker string, difficulty *big.Int, result *big.Int) (*big.Int, bool) {
+	if target := t.target(worker, difficulty); result.Cmp(target) <= 0 {
+		return target, true
+	}
+	if worker == "" || t.rate == 0 {
+		return nil, false
+	}
+	t.lock.Lock()
+	share := t.vardiff(worker, time.Now()).previous
+	t.lock.Unlock()
+
+	if difficulty.Cmp(share) < 0 {
+		share = difficulty
+	}
+	if target := new(big.Int).Div(two256, share); result.Cmp(target) <= 0 {
+		return target, true
+	}
+	return nil, false
+}
+
+// account adds a share to the statistics of its worker and the payout ledger.
+func (t *shareTracker) account(share *Share) {
+	if t.ledger != nil {
+		t.ledger.add(share)
+	}
+	stats := t.workers[share.Worker]
+	if stats == nil {
+		stats = &WorkerShares{Difficulty: new(hexutil.Big)}
+		t.workers[share.Worker] = stats
+	}
+	stats.Shares++
+	(*big.Int)(stats.Difficulty).Add((*big.Int)(stats.Difficulty), share.Difficulty)
+	if share.Block {
+		stats.Blocks++
+	}
+	if hexutil.Uint64(share.Time) > stats.LastShare {
+		stats.LastShare = hexutil.Uint64(share.Time)
+	}
+}
+
+// add records a share sealing the given header with the given target, returning
+// an error if it was already credited. Shares of work older than the stale window
+// are forgotten.
+func (t *shareTracker) add(worker string, header *types.Header, sealhash common.Hash, target *big.Int, block bool, window uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	number, nonce := header.Number.Uint64(), header.Nonce
+
+	id := shareID{sealhash: sealhash, nonce: nonce}
+	if _, ok := t.seen[number][id]; ok {
+		return errDuplicateShare
+	}
+	if t.seen[number] == nil {
+		t.seen[number] = make(map[shareID]struct{})
+		for n := range t.seen {
+			if n+window <= number {
+				delete(t.seen, n)
+			}
+		}
+	}
+	t.seen[number][id] = struct{}{}
+	if worker != "" && t.rate > 0 {
+		t.vardiff(worker, time.Now()).shares++
+	}
+	share := &Share{
+		Worker:     worker,
+		Number:     number,
+		SealHash:   sealhash,
+		Nonce:      nonce,
+		Difficulty: new(big.Int).Div(two256, target),
+		Block:      block,
+		Time:       uint64(time.Now().Unix()),
+
+		BlockDifficulty: new(big.Int).Set(header.Difficulty),
+	}
+	if block {
+		share.BlockHash = header.Hash()
+	}
+	t.account(share)
+	if t.store != nil {
+		if err := t.store.WriteShare(share); err != nil {
+			t.log.Warn("Failed to persist hmhash share", "worker", worker, "err", err)
+		}
+	}
+	return nil
+}
+
+// workerShares returns a copy of the share statistics of every worker.
+func (t *shareTracker) workerShares() map[string]*WorkerShares {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	shares := make(map[string]*WorkerShares, len(t.workers))
+	for worker, stats := range t.workers {
+		cpy := *stats
+		cpy.Difficulty = (*hexutil.Big)(new(big.Int).Set((*big.Int)(stats.Difficulty)))
+		shares[worker] = &cpy
+	}
+	return shares
+}
+
+// payouts returns the payout ledger entries of the rounds ended by blocks from
+// the given number on, empty if payouts are disabled.
+func (t *shareTracker) payouts(from uint64, reward func(number uint64) *big.Int) []PayoutRound {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.ledger == nil {
+		return []PayoutRound{}
+	}
+	return t.ledger.payouts(from, reward)
+}
+
+// confirm settles the maturity of the pending payout rounds against the
+// canonical chain.
+func (t *shareTracker) confirm(head, depth uint64, canonical func(number uint64) *types.Header) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.ledger != nil {
+		t.ledger.confirm(head, depth, canonical, t.log)
+	}
+}
+
+// close releases the share store, after which shares are kept in memory only.
+func (t *shareTracker) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.store != nil {
+		if err := t.store.Close(); err != nil {
+			t.log.Warn("Failed to close hmhash share store", "err", err)
+		}
+		t.store = nil
+	}
+}
+
+// workerTarget returns the boundary condition handed out to a remote worker for
+// a block of the given difficulty, which is its share target if share
+// accounting is enabled.
+func (hmhash *Hmhash) workerTarget(worker string, difficulty *big.Int) *big.Int {
+	if hmhash.shares != nil {
+		return hmhash.shares.target(worker, difficulty)
+	}
+	return new(big.Int).Div(two256, difficulty)
+}
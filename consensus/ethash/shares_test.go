@@ -0,0 +1,138 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Tests that shares are credited once and restored from the persistence hook.
+func TestShareTracker(t *testing.T) {
+	db := memorydb.New()
+	tracker, err := newShareTracker(1000, 0, nil, NewShareStore(db), log.Root())
+	if err != nil {
+		t.Fatalf("failed to create share tracker: %v", err)
+	}
+	var (
+		sealhash = common.HexToHash("0x01")
+		target   = new(big.Int).Div(two256, big.NewInt(1000))
+	)
+	if err := tracker.add("alice", &types.Header{Number: big.NewInt(1), Nonce: types.EncodeNonce(1), Difficulty: big.NewInt(1000000)}, sealhash, target, false, 7); err != nil {
+		t.Fatalf("failed to add share: %v", err)
+	}
+	if err := tracker.add("bob", &types.Header{Number: big.NewInt(1), Nonce: types.EncodeNonce(1), Difficulty: big.NewInt(1000000)}, sealhash, target, false, 7); err != errDuplicateShare {
+		t.Fatalf("duplicate share error mismatch: have %v, want %v", err, errDuplicateShare)
+	}
+	if err := tracker.add("alice", &types.Header{Number: big.NewInt(1), Nonce: types.EncodeNonce(2), Difficulty: big.NewInt(1000000)}, sealhash, target, true, 7); err != nil {
+		t.Fatalf("failed to add share: %v", err)
+	}
+	// Shares of old blocks are forgotten, so they're not rejected anymore
+	if err := tracker.add("bob", &types.Header{Number: big.NewInt(9), Nonce: types.EncodeNonce(1), Difficulty: big.NewInt(1000000)}, common.HexToHash("0x02"), target, false, 7); err != nil {
+		t.Fatalf("failed to add share: %v", err)
+	}
+	if len(tracker.seen) != 1 {
+		t.Errorf("old shares not pruned: have %d blocks, want 1", len(tracker.seen))
+	}
+	check := func(shares map[string]*WorkerShares) {
+		t.Helper()
+
+		alice, bob := shares["alice"], shares["bob"]
+		if alice == nil || alice.Shares != 2 || alice.Blocks != 1 || alice.Difficulty.ToInt().Uint64() != 2000 {
+			t.Errorf("alice share mismatch: have %+v", alice)
+		}
+		if bob == nil || bob.Shares != 1 || bob.Blocks != 0 || bob.Difficulty.ToInt().Uint64() != 1000 {
+			t.Errorf("bob share mismatch: have %+v", bob)
+		}
+	}
+	check(tracker.workerShares())
+
+	// Recreate the tracker from the same database and check the restored shares
+	restored, err := newShareTracker(1000, 0, nil, NewShareStore(db), log.Root())
+	if err != nil {
+		t.Fatalf("failed to restore share tracker: %v", err)
+	}
+	check(restored.workerShares())
+}
+
+// Tests that remote workers are handed the share target and are credited for
+// solutions meeting it, even if they don't seal the block.
+func TestRemoteShares(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, ShareDifficulty: 10}, nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	api := &API{hmhash}
+	if _, err := (&MiningAPI{hmhash}).GetShares(); err != nil {
+		t.Fatalf("failed to retrieve shares: %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1000000)}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+	work, err := api.GetWork(context.Background())
+	if err != nil {
+		t.Fatalf("failed to retrieve work: %v", err)
+	}
+	target := new(big.Int).Div(two256, big.NewInt(10))
+	if have := new(big.Int).SetBytes(common.FromHex(work[2])); have.Cmp(target) != 0 {
+		t.Fatalf("work target mismatch: have %x, want %x", have, target)
+	}
+	// Search for a share that doesn't seal the block
+	var (
+		sealhash = hmhash.SealHash(header)
+		block    = new(big.Int).Div(two256, header.Difficulty)
+		nonce    uint64
+		digest   common.Hash
+	)
+	for ; ; nonce++ {
+		var result []byte
+		digest, result = hmhash.powResult(1, sealhash, nonce)
+		if res := new(big.Int).SetBytes(result); res.Cmp(target) <= 0 && res.Cmp(block) > 0 {
+			break
+		}
+	}
+	mining := &MiningAPI{hmhash}
+	if !mining.SubmitShare("worker", types.EncodeNonce(nonce), sealhash, digest) {
+		t.Fatalf("valid share rejected")
+	}
+	if mining.SubmitShare("worker", types.EncodeNonce(nonce), sealhash, digest) {
+		t.Fatalf("duplicate share accepted")
+	}
+	if mining.SubmitShare("worker", types.EncodeNonce(nonce), sealhash, common.Hash{}) {
+		t.Fatalf("share with invalid digest accepted")
+	}
+	select {
+	case <-results:
+		t.Fatalf("block sealed by a share")
+	case <-time.After(100 * time.Millisecond):
+	}
+	shares, err := mining.GetShares()
+	if err != nil {
+		t.Fatalf("failed to retrieve shares: %v", err)
+	}
+	if stats := shares["worker"]; stats == nil || stats.Shares != 1 || stats.Difficulty.ToInt().Uint64() != 10 {
+		t.Fatalf("worker share mismatch: have %+v", stats)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// defaultSimulatedBlockTime is the mean simulated block interval if the config
+// leaves it unset.
+const defaultSimulatedBlockTime = 15 * time.Second
+
+// simulatedTime returns the timestamp of a simulated block on top of parent:
+// the parent timestamp advanced by an exponentially distributed interval, as
+// proof-of-work blocks are, but never before the proposed timestamp. The
+// interval is drawn from the parent hash, so every rebuild of the block gets
+// the same one and the difficulty adjusts to it as it would to mined blocks.
+func (hmhash *Hmhash) simulatedTime(parent *types.Header, proposed uint64) uint64 {
+	mean := hmhash.config.SimulatedBlockTime
+	if mean <= 0 {
+		mean = defaultSimulatedBlockTime
+	}
+	hash := parent.Hash()
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(hash[:8]))))
+
+	interval := uint64(rng.ExpFloat64() * mean.Seconds())
+	if interval == 0 {
+		interval = 1
+	}
+	if next := parent.Time + interval; next > proposed {
+		return next
+	}
+	return proposed
+}
+
+// sealSimulated seals a block without proof-of-work once the wall clock reaches
+// its simulated timestamp, unless sealing is stopped before.
+func (hmhash *Hmhash) sealSimulated(block *types.Block, results chan<- *types.Block, stop <-chan struct{}) {
+	header := block.Header()
+	header.Nonce, header.MixDigest = types.BlockNonce{}, common.Hash{}
+
+	timer := time.NewTimer(time.Until(time.Unix(int64(header.Time), 0)))
+	defer timer.Stop()
+
+	select {
+	case <-stop:
+		return
+	case <-timer.C:
+	}
+	select {
+	case results <- block.WithSeal(header):
+	default:
+		hmhash.logs.sealer.Warn("Sealing result is not read by miner", "mode", "simulated", logSealHash, hmhash.SealHash(header))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that simulated blocks are timestamped reproducibly after their parent
+// and sealed without proof-of-work once that time is reached.
+func TestSimulatedSeal(t *testing.T) {
+	hmhash := NewSimulated(10 * time.Second)
+	defer hmhash.Close()
+
+	parent := &types.Header{Number: big.NewInt(1), Time: 1000, Difficulty: big.NewInt(100)}
+	next := hmhash.simulatedTime(parent, 0)
+	if next <= parent.Time {
+		t.Fatalf("simulated time not after parent: have %d, parent %d", next, parent.Time)
+	}
+	if again := hmhash.simulatedTime(parent, 0); again != next {
+		t.Errorf("simulated time not reproducible: have %d, want %d", again, next)
+	}
+	if proposed := hmhash.simulatedTime(parent, next+100); proposed != next+100 {
+		t.Errorf("later proposed time mismatch: have %d, want %d", proposed, next+100)
+	}
+	// Blocks in the future are held back until stopped
+	results := make(chan *types.Block, 1)
+	header := &types.Header{Number: big.NewInt(2), Time: uint64(time.Now().Add(time.Hour).Unix()), Difficulty: big.NewInt(100)}
+
+	stop := make(chan struct{})
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, stop); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	close(stop)
+	select {
+	case block := <-results:
+		t.Fatalf("future block sealed early: %x", block.Hash())
+	case <-time.After(100 * time.Millisecond):
+	}
+	// Blocks due are sealed right away and pass verification
+	header.Time = uint64(time.Now().Unix())
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	select {
+	case block := <-results:
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Errorf("failed to verify simulated seal: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("due block not sealed")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// solutionTraceLimit is the number of the most recent solution traces kept.
+const solutionTraceLimit = 256
+
+// Outcomes of traced solutions.
+const (
+	TraceAccepted = "accepted" // Handed to the miner for broadcast
+	TraceUncle    = "uncle"    // Solved outdated work, handed over as an uncle candidate
+	TraceStale    = "stale"    // Solved work too old to be accepted
+	TraceDropped  = "dropped"  // Not read by the miner
+)
+
+// SolutionTrace is the latency trace of a solution, from the issuance of the
+// work package it solves to the handover of the sealed block for broadcast,
+// for diagnosing orphaned blocks.
+type SolutionTrace struct {
+	SealHash     common.Hash   `json:"sealHash"`
+	Hash         common.Hash   `json:"hash"` // Hash of the sealed block
+	Number       uint64        `json:"number"`
+	Remote       bool          `json:"remote"`              // Whether the solution was submitted by a remote miner
+	Worker       string        `json:"worker,omitempty"`    // Remote worker of the solution, empty if anonymous
+	Issued       time.Time     `json:"issued"`              // Time the work package was issued
+	Received     time.Time     `json:"received"`            // Time the solution was found or submitted
+	Verification time.Duration `json:"verification"`        // Nanoseconds spent verifying the solution
+	Broadcast    *time.Time    `json:"broadcast,omitempty"` // Time the block was handed over, nil if not
+	Outcome      string        `json:"outcome"`
+}
+
+// solutionTraces is a ring of the most recent solution traces.
+type solutionTraces struct {
+	traces []SolutionTrace
+	next   int // Position of the next trace once the ring is full
+	lock   sync.Mutex
+}
+
+// add records a trace, overwriting the oldest one if the ring is full.
+func (r *solutionTraces) add(t SolutionTrace) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.traces) < solutionTraceLimit {
+		r.traces = append(r.traces, t)
+		return
+	}
+	r.traces[r.next] = t
+	r.next = (r.next + 1) % solutionTraceLimit
+}
+
+// last returns the count most recent traces, oldest first.
+func (r *solutionTraces) last(count int) []SolutionTrace {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if count > len(r.traces) {
+		count = len(r.traces)
+	}
+	traces := make([]SolutionTrace, 0, count)
+	for i := len(r.traces) - count; i < len(r.traces); i++ {
+		traces = append(traces, r.traces[(r.next+i)%len(r.traces)])
+	}
+	return traces
+}
+
+// SolutionTraces returns the count most recent solution traces, oldest first.
+func (hmhash *Hmhash) SolutionTraces(count int) []SolutionTrace {
+	return hmhash.traces.last(count)
+}
+
+// traceSolution records the trace of a solution, also emitting it as a span if
+// tracing is enabled.
+func (hmhash *Hmhash) traceSolution(t *SolutionTrace) {
+	hmhash.traces.add(*t)
+
+	_, span := hmhash.spanTracer().Start(context.Background(), "hmhash.solution", trace.WithTimestamp(t.Issued))
+	if !span.IsRecording() {
+		span.End()
+		return
+	}
+	span.SetAttributes(
+		attribute.String("hmhash.sealhash", t.SealHash.Hex()),
+		attribute.String("hmhash.hash", t.Hash.Hex()),
+		attribute.Int64("hmhash.number", int64(t.Number)),
+		attribute.Bool("hmhash.remote", t.Remote),
+		attribute.String("hmhash.worker", t.Worker),
+		attribute.String("hmhash.outcome", t.Outcome),
+	)
+	span.AddEvent("received", trace.WithTimestamp(t.Received))
+	verified := t.Received.Add(t.Verification)
+	span.AddEvent("verified", trace.WithTimestamp(verified))
+
+	end := verified
+	if t.Broadcast != nil {
+		span.AddEvent("broadcast", trace.WithTimestamp(*t.Broadcast))
+		end = *t.Broadcast
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that remote solutions are traced from the issuance of their work to
+// their handover to the miner.
+func TestSolutionTraces(t *testing.T) {
+	hmhash := NewTester(nil, true)
+	defer hmhash.Close()
+	mining := &MiningAPI{hmhash}
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100000000)}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	sealhash := hmhash.SealHash(header)
+	if !(&API{hmhash}).submitWork(types.BlockNonce{0x01}, sealhash, common.HexToHash("deadbeef"), "rig") {
+		t.Fatalf("solution rejected")
+	}
+	var block *types.Block
+	select {
+	case block = <-results:
+	case <-time.After(time.Second):
+		t.Fatalf("sealing result timeout")
+	}
+	traces := mining.GetSolutionTraces(nil)
+	if len(traces) != 1 {
+		t.Fatalf("trace count mismatch: have %d, want 1", len(traces))
+	}
+	trace := traces[0]
+	if trace.SealHash != sealhash || trace.Hash != block.Hash() || trace.Number != 1 || !trace.Remote || trace.Worker != "rig" || trace.Outcome != TraceAccepted {
+		t.Errorf("trace mismatch: %+v", trace)
+	}
+	if trace.Issued.IsZero() || trace.Received.Before(trace.Issued) {
+		t.Errorf("received before issued: issued %v, received %v", trace.Issued, trace.Received)
+	}
+	if trace.Broadcast == nil || trace.Broadcast.Before(trace.Received.Add(trace.Verification)) {
+		t.Errorf("broadcast before verified: %+v", trace)
+	}
+	// Solutions to unknown work are not traced
+	(&API{hmhash}).SubmitWork(context.Background(), types.BlockNonce{0x02}, common.Hash{1}, common.Hash{}, nil)
+	if traces := mining.GetSolutionTraces(nil); len(traces) != 1 {
+		t.Errorf("trace count mismatch: have %d, want 1", len(traces))
+	}
+}
+
+// Tests that only the most recent solution traces are kept.
+func TestSolutionTraceLimit(t *testing.T) {
+	hmhash := NewTester(nil, true)
+	defer hmhash.Close()
+
+	for i := 0; i < solutionTraceLimit+10; i++ {
+		hmhash.traceSolution(&SolutionTrace{Number: uint64(i), Outcome: TraceAccepted})
+	}
+	if traces := hmhash.SolutionTraces(solutionTraceLimit + 10); len(traces) != solutionTraceLimit {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), solutionTraceLimit)
+	}
+	count := hexutil.Uint64(3)
+	traces := (&MiningAPI{hmhash}).GetSolutionTraces(&count)
+	if len(traces) != 3 {
+		t.Fatalf("trace count mismatch: have %d, want 3", len(traces))
+	}
+	for i, trace := range traces {
+		if want := uint64(solutionTraceLimit + 7 + i); trace.Number != want {
+			t.Errorf("trace %d: number mismatch: have %d, want %d", i, trace.Number, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var errNoEthashConfig = errors.New("chain config has no ethash section")
+
+// lightCaches are the in-memory verification caches shared by the stateless
+// seal verifications, so headers of the same epoch only generate one.
+var lightCaches = newlru(2, func(epoch uint64) *cache {
+	c := newCache(epoch, keccakAlgo{})
+	c.log = lightLogs.dataset
+	return c
+})
+
+// lightLogs are the loggers of the stateless seal verifications.
+var lightLogs = newMiningLogs(log.Root())
+
+// VerifyHeaderSeal checks whether the seal of a header is valid according to a
+// chain configuration: the proof-of-work, or the auxiliary proof-of-work or
+// validator signature where the chain enables them. It needs no engine nor cache
+// directory, the verification caches being generated in memory, so it suits
+// light clients and provers embedded in other programs. Chains mined with a
+// custom hash algorithm, or the blocks of a rotation sealed with one, have to be
+// verified with an engine instead.
+//
+// Validator signatures are only checked to be well formed and recoverable, the
+// membership of the signer in the validator set needs the chain state.
+func VerifyHeaderSeal(config *params.ChainConfig, header *types.Header) error {
+	if config.Ethash == nil {
+		return errNoEthashConfig
+	}
+	if algo := config.Ethash.MultiAlgo.AlgoAt(header.Number); algo != "" && algo != DefaultHashAlgo {
+		return errRotatedHashAlgo
+	}
+	verifier := &Hmhash{
+		algo:   keccakAlgo{},
+		caches: lightCaches,
+		logs:   lightLogs,
+	}
+	return verifier.checkSeal(configReader{config}, header, false)
+}
+
+// configReader is a chain header reader only knowing the chain configuration,
+// which is all the seal verification looks at.
+type configReader struct {
+	config *params.ChainConfig
+}
+
+func (r configReader) Config() *params.ChainConfig                    { return r.config }
+func (r configReader) CurrentHeader() *types.Header                   { return nil }
+func (r configReader) GetHeader(common.Hash, uint64) *types.Header    { return nil }
+func (r configReader) GetHeaderByNumber(uint64) *types.Header         { return nil }
+func (r configReader) GetHeaderByHash(common.Hash) *types.Header      { return nil }
+func (r configReader) GetTd(hash common.Hash, number uint64) *big.Int { return nil }
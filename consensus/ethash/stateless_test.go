@@ -0,0 +1,61 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that seals are verified without an engine, honouring the proof-of-work
+// algorithm switches of the chain config.
+func TestVerifyHeaderSeal(t *testing.T) {
+	// Seal a header with the shared verification cache, the difficulty accepting
+	// any nonce
+	cache := lightCaches.get(0)
+	cache.generate("", 0, false, cacheSize(1))
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), Nonce: types.EncodeNonce(42)}
+	digest, _ := hashimotoLight(keccakAlgo{}, datasetSize(1), cache.cache, new(Hmhash).SealHash(header).Bytes(), 42)
+	header.MixDigest = common.BytesToHash(digest)
+
+	config := *params.TestChainConfig
+	config.Ethash = new(params.EthashConfig)
+	if err := VerifyHeaderSeal(&config, header); err != nil {
+		t.Fatalf("valid seal rejected: %v", err)
+	}
+	bad := types.CopyHeader(header)
+	bad.Nonce = types.EncodeNonce(43)
+	if err := VerifyHeaderSeal(&config, bad); err != errInvalidMixDigest {
+		t.Errorf("tampered seal error mismatch: have %v, want %v", err, errInvalidMixDigest)
+	}
+	// Chains switched to ProgPoW expect another digest
+	progpow := config
+	progpow.Ethash = &params.EthashConfig{ProgpowBlock: common.Big0}
+	if err := VerifyHeaderSeal(&progpow, header); err != errInvalidMixDigest {
+		t.Errorf("hashimoto seal on ProgPoW chain error mismatch: have %v, want %v", err, errInvalidMixDigest)
+	}
+	noethash := config
+	noethash.Ethash = nil
+	if err := VerifyHeaderSeal(&noethash, header); err != errNoEthashConfig {
+		t.Errorf("non-ethash chain error mismatch: have %v, want %v", err, errNoEthashConfig)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"strings"
+	"time"
+)
+
+// Status is a health report of the engine, for orchestration systems to probe.
+type Status struct {
+	Mode         string            `json:"mode"`
+	Threads      int               `json:"threads"`                // Local mining threads, see SetThreads
+	Sealing      bool              `json:"sealing"`                // Whether any work was handed out for sealing
+	Epoch        uint64            `json:"epoch"`                  // Epoch of the last work handed out for sealing
+	DatasetReady bool              `json:"datasetReady"`           // Whether the mining dataset of the epoch is generated
+	RemoteSealer bool              `json:"remoteSealer"`           // Whether the remote sealer is running
+	Listeners    map[string]string `json:"listeners,omitempty"`    // Listening addresses of each remote mining endpoint, comma separated
+	PendingWorks int               `json:"pendingWorks"`           // Work packages pending remote solutions
+	LastSolution *time.Time        `json:"lastSolution,omitempty"` // Time of the last sealed block, nil if none
+}
+
+// Status returns a health report of the engine.
+func (hmhash *Hmhash) Status() *Status {
+	if hmhash.shared != nil {
+		status := hmhash.shared.Status()
+		status.Mode = ModeShared.String()
+		return status
+	}
+	status := &Status{
+		Mode:    hmhash.config.PowMode.String(),
+		Threads: hmhash.Threads(),
+	}
+	if epoch := hmhash.events.epoch.Load(); epoch != 0 {
+		status.Sealing, status.Epoch = true, epoch-1
+		if hmhash.datasets != nil {
+			if d, ok := hmhash.datasets.peek(status.Epoch); ok {
+				status.DatasetReady = d.generated()
+			}
+		}
+	}
+	if hmhash.remote != nil {
+		select {
+		case <-hmhash.remote.exitCh:
+		default:
+			status.RemoteSealer = true
+		}
+		status.PendingWorks = int(hmhash.remote.pending.Load())
+	}
+	listeners := make(map[string]string)
+	if hmhash.stratum != nil {
+		listeners["stratum"] = hmhash.stratum.listener.Addr().String()
+	}
+	if hmhash.hmwire != nil {
+		listeners["hmwire"] = hmhash.hmwire.listener.Addr().String()
+	}
+	if hmhash.grpc != nil {
+		listeners["grpc"] = hmhash.grpc.listener.Addr().String()
+	}
+	if hmhash.getwork != nil {
+		addrs := make([]string, len(hmhash.getwork.listeners))
+		for i, listener := range hmhash.getwork.listeners {
+			addrs[i] = listener.Addr().String()
+		}
+		listeners["getwork"] = strings.Join(addrs, ",")
+	}
+	if len(listeners) > 0 {
+		status.Listeners = listeners
+	}
+	if last := hmhash.lastSeal.Load(); last != 0 {
+		t := time.Unix(0, last)
+		status.LastSolution = &t
+	}
+	return status
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that the health report follows the sealing state of the engine.
+func TestStatus(t *testing.T) {
+	hmhash := NewTester(nil, false)
+
+	status := hmhash.Status()
+	if status.Mode != "test" || status.Sealing || !status.RemoteSealer || status.LastSolution != nil {
+		t.Errorf("idle status mismatch: %+v", status)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	select {
+	case <-results:
+	case <-time.After(4 * time.Second):
+		t.Fatalf("sealing result timeout")
+	}
+	status = hmhash.Status()
+	if !status.Sealing || status.Epoch != 0 || !status.DatasetReady || status.PendingWorks != 1 || status.LastSolution == nil {
+		t.Errorf("sealing status mismatch: %+v", status)
+	}
+	hmhash.Close()
+	if hmhash.Status().RemoteSealer {
+		t.Errorf("remote sealer reported running after close")
+	}
+}
@@ -0,0 +1,506 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bufio"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// stratumProtocol is the protocol name reported on subscription.
+	stratumProtocol = "EthereumStratum/1.0.0"
+
+	stratumMaxLine      = 4096             // Maximum length of a single stratum message
+	stratumIdleTimeout  = 10 * time.Minute // Drop connections without traffic for this long
+	stratumWriteTimeout = 5 * time.Second  // Maximum time allowed to push a message to a miner
+)
+
+var (
+	errStratumUnknownMethod = errors.New("unknown stratum method")
+	errStratumInvalidParams = errors.New("invalid stratum parameters")
+	errStratumUnsubscribed  = errors.New("not subscribed")
+	errStratumUnauthorized  = errors.New("not authorized")
+	errStratumUnknownJob    = errors.New("job not found")
+
+	// stratumDiff1 is the target corresponding to a stratum difficulty of 1.
+	stratumDiff1 = new(big.Int).Lsh(big.NewInt(0xffff), 208)
+)
+
+// stratumRequest is a single JSON-RPC style message received from a miner.
+type stratumRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stratumResponse is the reply to a stratumRequest.
+type stratumResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result"`
+	Error  interface{}     `json:"error"`
+}
+
+// stratumNotification is a server initiated message pushed to a miner.
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumJob is a work package in the form handed out to stratum miners.
+type stratumJob struct {
+	id     string   // Job identifier, the seal hash without hex prefix
+	seed   string   // Seed hash without hex prefix
+	header string   // Seal hash without hex prefix
+	number uint64   // Block number the work belongs to
+	target *big.Int // Boundary condition of the work, the share target if shares are tracked
+
+	difficulty *big.Int // Difficulty of the block, bounding the share difficulty of workers
+}
+
+// newStratumJob converts a remote sealer work package into a stratum job.
+func newStratumJob(work [4]string, block *types.Block) *stratumJob {
+	return &stratumJob{
+		id:     strings.TrimPrefix(work[0], "0x"),
+		seed:   strings.TrimPrefix(work[1], "0x"),
+		header: strings.TrimPrefix(work[0], "0x"),
+		number: block.NumberU64(),
+		target: new(big.Int).SetBytes(common.FromHex(work[2])),
+
+		difficulty: block.Difficulty(),
+	}
+}
+
+// stratumServer is a Stratum v1 (EthereumStratum/1.0.0) endpoint that allows
+// off-the-shelf mining software to connect directly to the remote sealer.
+type stratumServer struct {
+	hmhash   *Hmhash
+	listener net.Listener
+
+	lock     sync.Mutex
+	sessions map[*stratumSession]struct{}
+	job      *stratumJob            // Most recent job, nil if there's no work yet
+	jobs     map[string]*stratumJob // Recent jobs by identifier, for late submissions
+
+	wg       sync.WaitGroup
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// listenStratum opens the stratum listener on the given address. Connections
+// are only accepted after start is called.
+func listenStratum(hmhash *Hmhash, addr string) (*stratumServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &stratumServer{
+		hmhash:   hmhash,
+		listener: listener,
+		sessions: make(map[*stratumSession]struct{}),
+		jobs:     make(map[string]*stratumJob),
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// Start begins serving stratum connections in the background.
+func (s *stratumServer) Start() {
+	s.wg.Add(1)
+	go s.serve()
+
+	s.hmhash.logs.sealer.Info("Stratum server started", "addr", s.listener.Addr())
+}
+
+// serve accepts incoming connections until the listener is closed.
+func (s *stratumServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			s.hmhash.logs.sealer.Warn("Stratum accept failed", "err", err)
+			return
+		}
+		session := &stratumSession{
+			server: s,
+			conn:   conn,
+			jobCh:  make(chan *stratumJob, 1),
+			log:    s.hmhash.logs.sealer.New("miner", conn.RemoteAddr()),
+		}
+
+		s.lock.Lock()
+		s.sessions[session] = struct{}{}
+		s.lock.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			session.handle()
+
+			s.lock.Lock()
+			delete(s.sessions, session)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+// Close terminates the listener and all open sessions, waiting for them to exit.
+func (s *stratumServer) Close() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+		s.listener.Close()
+
+		s.lock.Lock()
+		for session := range s.sessions {
+			session.conn.Close()
+		}
+		s.lock.Unlock()
+
+		s.wg.Wait()
+	})
+}
+
+// NotifyWork registers a remote sealer work package as the current job and
+// pushes it to all subscribed miners.
+func (s *stratumServer) NotifyWork(work [4]string, block *types.Block) {
+	job := newStratumJob(work, block)
+
+	s.lock.Lock()
+	s.job = job
+	s.jobs[job.id] = job
+	for id, old := range s.jobs {
+		if old.number+s.hmhash.StaleWorkWindow() <= job.number {
+			delete(s.jobs, id)
+		}
+	}
+	sessions := make([]*stratumSession, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.lock.Unlock()
+
+	for _, session := range sessions {
+		if session.isSubscribed() {
+			session.queueJob(job)
+		}
+	}
+}
+
+// currentJob returns the most recent job, if any.
+func (s *stratumServer) currentJob() *stratumJob {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.job
+}
+
+// findJob returns a recent job by its identifier.
+func (s *stratumServer) findJob(id string) *stratumJob {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.jobs[id]
+}
+
+// stratumSession is a single connected stratum miner.
+type stratumSession struct {
+	server *stratumServer
+	conn   net.Conn
+	jobCh  chan *stratumJob // Jobs waiting to be pushed, only the latest is kept
+	log    log.Logger
+
+	lock       sync.Mutex // Protects the fields below and serializes writes
+	subscribed bool
+	extranonce []byte // Nonce prefix leased to the connection, empty if disabled
+	worker     string // Worker name supplied on authorization, empty if not authorized
+	difficulty *big.Int
+}
+
+// handle reads and processes requests from the miner until the connection drops.
+func (sess *stratumSession) handle() {
+	defer sess.conn.Close()
+	defer func() {
+		sess.lock.Lock()
+		sess.server.hmhash.extra.release(sess.extranonce)
+		sess.lock.Unlock()
+	}()
+	sess.log.Debug("Stratum miner connected")
+
+	// Push jobs on a separate goroutine so slow miners can't stall the sealer
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case job := <-sess.jobCh:
+				sess.sendJob(job)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(sess.conn)
+	scanner.Buffer(make([]byte, 0, 512), stratumMaxLine)
+	for {
+		sess.conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		var req stratumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			sess.log.Debug("Invalid stratum message", "err", err)
+			return
+		}
+		result, err := sess.dispatch(&req)
+		res := &stratumResponse{ID: req.ID, Result: result}
+		if err != nil {
+			res.Result, res.Error = false, err.Error()
+		}
+		if err := sess.write(res); err != nil {
+			return
+		}
+		// Hand out the current job right after a successful authorization, and
+		// again if an accepted share changed the worker's share difficulty
+		if (req.Method == "mining.authorize" && err == nil) || (req.Method == "mining.submit" && result == true && sess.retargeted()) {
+			if job := sess.server.currentJob(); job != nil {
+				sess.queueJob(job)
+			}
+		}
+	}
+	sess.log.Debug("Stratum miner disconnected", "err", scanner.Err())
+}
+
+// dispatch executes a single stratum request, returning the result to reply with.
+func (sess *stratumSession) dispatch(req *stratumRequest) (interface{}, error) {
+	switch req.Method {
+	case "mining.subscribe":
+		sess.lock.Lock()
+		defer sess.lock.Unlock()
+
+		// Lease the nonce prefix on the first subscription, miners are expected to
+		// fill the remaining bytes only
+		if !sess.subscribed {
+			extranonce, err := sess.server.hmhash.extra.allocate()
+			if err != nil {
+				return nil, err
+			}
+			sess.extranonce = extranonce
+		}
+		sess.subscribed = true
+
+		id := make([]byte, 8)
+		crand.Read(id)
+		return []interface{}{[]interface{}{"mining.notify", common.Bytes2Hex(id), stratumProtocol}, common.Bytes2Hex(sess.extranonce)}, nil
+
+	case "mining.authorize":
+		if !sess.isSubscribed() {
+			return nil, errStratumUnsubscribed
+		}
+		var worker string
+		if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &worker) != nil {
+			return nil, errStratumInvalidParams
+		}
+		sess.lock.Lock()
+		sess.worker = worker
+		sess.lock.Unlock()
+		return true, nil
+
+	case "mining.configure":
+		// Negotiate the capabilities of the work packages, replying with the
+		// supported subset of the requested ones
+		var requested []string
+		if len(req.Params) > 0 && json.Unmarshal(req.Params[0], &requested) != nil {
+			return nil, errStratumInvalidParams
+		}
+		return map[string]interface{}{
+			"version":      WorkVersion,
+			"capabilities": sess.server.hmhash.negotiateCapabilities(requested),
+		}, nil
+
+	case "mining.extranonce.subscribe":
+		// The prefix leased on subscription is kept for the lifetime of the
+		// connection, so mining.set_extranonce is never needed
+		return true, nil
+
+	case "mining.submit":
+		var worker, jobID, nonce string
+		if len(req.Params) < 3 || json.Unmarshal(req.Params[0], &worker) != nil || json.Unmarshal(req.Params[1], &jobID) != nil || json.Unmarshal(req.Params[2], &nonce) != nil {
+			return nil, errStratumInvalidParams
+		}
+		return sess.submit(jobID, nonce)
+
+	default:
+		return nil, errStratumUnknownMethod
+	}
+}
+
+// submit verifies and forwards a solution for a previously handed out job.
+func (sess *stratumSession) submit(jobID string, nonceHex string) (bool, error) {
+	sess.lock.Lock()
+	worker, extranonce := sess.worker, sess.extranonce
+	sess.lock.Unlock()
+	if worker == "" {
+		return false, errStratumUnauthorized
+	}
+	job := sess.server.findJob(jobID)
+	if job == nil {
+		return false, errStratumUnknownJob
+	}
+	raw, err := hexutil.Decode("0x" + strings.TrimPrefix(nonceHex, "0x"))
+	if err != nil {
+		return false, errStratumInvalidParams
+	}
+	if raw, err = applyExtranonce(extranonce, raw); err != nil {
+		return false, err
+	}
+	var nonce types.BlockNonce
+	copy(nonce[:], raw)
+
+	var (
+		hmhash   = sess.server.hmhash
+		sealhash = common.HexToHash(job.header)
+		digest   = hmhash.mixDigest(job.number, sealhash, nonce.Uint64())
+	)
+	return (&API{hmhash}).submitWork(nonce, sealhash, digest, worker), nil
+}
+
+// isSubscribed returns whether the miner subscribed to job notifications.
+func (sess *stratumSession) isSubscribed() bool {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	return sess.subscribed
+}
+
+// queueJob schedules a job to be pushed to the miner, replacing any job still
+// waiting in the queue. It never blocks.
+func (sess *stratumSession) queueJob(job *stratumJob) {
+	for {
+		select {
+		case sess.jobCh <- job:
+			return
+		default:
+		}
+		select {
+		case <-sess.jobCh:
+		default:
+		}
+	}
+}
+
+// retargeted returns whether the share target of the worker changed since the
+// last job was sent to it.
+func (sess *stratumSession) retargeted() bool {
+	job := sess.server.currentJob()
+	if job == nil {
+		return false
+	}
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	return sess.difficulty != nil && sess.difficulty.Cmp(sess.server.hmhash.workerTarget(sess.worker, job.difficulty)) != 0
+}
+
+// sendJob pushes a job to the miner, preceded by a difficulty update if the
+// worker's target for the job differs from the one last sent.
+func (sess *stratumSession) sendJob(job *stratumJob) {
+	sess.lock.Lock()
+	target := sess.server.hmhash.workerTarget(sess.worker, job.difficulty)
+	update := sess.difficulty == nil || sess.difficulty.Cmp(target) != 0
+	sess.difficulty = target
+	sess.lock.Unlock()
+
+	if update {
+		diff, _ := new(big.Float).Quo(new(big.Float).SetInt(stratumDiff1), new(big.Float).SetInt(target)).Float64()
+		if err := sess.write(&stratumNotification{Method: "mining.set_difficulty", Params: []interface{}{diff}}); err != nil {
+			return
+		}
+	}
+	sess.write(&stratumNotification{Method: "mining.notify", Params: []interface{}{job.id, job.seed, job.header, true}})
+}
+
+// write sends a single newline terminated message to the miner.
+func (sess *stratumSession) write(msg interface{}) error {
+	blob, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	sess.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+	if _, err := sess.conn.Write(append(blob, '\n')); err != nil {
+		sess.log.Debug("Failed to write stratum message", "err", err)
+		sess.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// mixDigest computes the mix digest of a solution, needed for miners that only
+// submit nonces.
+func (hmhash *Hmhash) mixDigest(number uint64, sealhash common.Hash, nonce uint64) common.Hash {
+	digest, _ := hmhash.powResult(number, sealhash, nonce)
+	return digest
+}
+
+// powResult computes the mix digest and proof-of-work result of a solution. The
+// full dataset is used if available, the cache otherwise.
+func (hmhash *Hmhash) powResult(number uint64, sealhash common.Hash, nonce uint64) (common.Hash, []byte) {
+	if hmhash.shared != nil {
+		return hmhash.shared.powResult(number, sealhash, nonce)
+	}
+	rules := hmhash.sealRules.Load()
+	if isCPUPoW(rules, number) {
+		digest, result := hmhash.powCPU(rules, number, sealhash.Bytes(), nonce)
+		return common.BytesToHash(digest), result
+	}
+	if dataset := hmhash.dataset(rules, number, true); dataset.generated() {
+		digest, result := hmhash.powFull(rules, dataset, number, sealhash.Bytes(), nonce)
+		runtime.KeepAlive(dataset)
+		return common.BytesToHash(digest), result
+	}
+	cache := hmhash.cache(rules, number)
+	digest, result := hmhash.powLight(rules, cache, number, sealhash.Bytes(), nonce)
+	runtime.KeepAlive(cache)
+	return common.BytesToHash(digest), result
+}
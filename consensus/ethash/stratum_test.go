@@ -0,0 +1,208 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// stratumTestClient is a minimal line based stratum client.
+type stratumTestClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	id     int
+}
+
+func dialStratum(t *testing.T, addr string) *stratumTestClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial stratum server: %v", err)
+	}
+	return &stratumTestClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// call sends a request and returns the raw reply.
+func (c *stratumTestClient) call(method string, params ...interface{}) map[string]interface{} {
+	c.id++
+	blob, _ := json.Marshal(map[string]interface{}{"id": c.id, "method": method, "params": params})
+	if _, err := c.conn.Write(append(blob, '\n')); err != nil {
+		c.t.Fatalf("failed to send %s: %v", method, err)
+	}
+	return c.read()
+}
+
+// read returns the next message sent by the server.
+func (c *stratumTestClient) read() map[string]interface{} {
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatalf("failed to read stratum message: %v", err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		c.t.Fatalf("invalid stratum message %q: %v", line, err)
+	}
+	return msg
+}
+
+// Tests the full stratum flow: subscription, job notification and submission.
+func TestStratumServer(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, StratumAddr: "127.0.0.1:0"}, nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	client := dialStratum(t, hmhash.stratum.listener.Addr().String())
+	defer client.conn.Close()
+
+	if res := client.call("mining.authorize", "worker", "x"); res["error"] == nil {
+		t.Fatalf("authorization accepted before subscription")
+	}
+	if res := client.call("mining.subscribe", "test", stratumProtocol); res["error"] != nil {
+		t.Fatalf("subscription failed: %v", res["error"])
+	}
+	if res := client.call("mining.authorize", "worker", "x"); res["result"] != true {
+		t.Fatalf("authorization failed: %v", res["error"])
+	}
+	// Push some work and ensure the job is delivered
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+	if msg := client.read(); msg["method"] != "mining.set_difficulty" {
+		t.Fatalf("expected difficulty update, got %v", msg)
+	}
+	msg := client.read()
+	if msg["method"] != "mining.notify" {
+		t.Fatalf("expected job notification, got %v", msg)
+	}
+	params := msg["params"].([]interface{})
+	sealhash := hmhash.SealHash(header)
+	if params[0] != common.Bytes2Hex(sealhash.Bytes()) {
+		t.Fatalf("job id mismatch: have %v, want %x", params[0], sealhash)
+	}
+	// Submissions for unknown jobs and invalid solutions must be rejected
+	if res := client.call("mining.submit", "worker", "00", "0000000000000000"); res["error"] == nil {
+		t.Errorf("submission for unknown job accepted")
+	}
+	// Search a valid nonce and submit it
+	var (
+		cache  = hmhash.cache(nil, 1)
+		target = new(big.Int).Div(two256, header.Difficulty)
+		nonce  uint64
+	)
+	for ; ; nonce++ {
+		_, result := hashimotoLight(hmhash.algo, testDatasetSize, cache.cache, sealhash.Bytes(), nonce)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			break
+		}
+	}
+	if res := client.call("mining.submit", "worker", params[0], fmt.Sprintf("%016x", nonce)); res["result"] != true {
+		t.Fatalf("valid submission rejected: %v", res["error"])
+	}
+	select {
+	case block := <-results:
+		if block.Nonce() != nonce {
+			t.Errorf("sealed nonce mismatch: have %d, want %d", block.Nonce(), nonce)
+		}
+		if err := hmhash.verifySeal(context.Background(), nil, block.Header(), false); err != nil {
+			t.Errorf("sealed block invalid: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("sealed block not delivered")
+	}
+}
+
+// Tests that every stratum connection is leased a distinct extranonce and that
+// miners may submit the nonce without it.
+func TestStratumExtranonce(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, StratumAddr: "127.0.0.1:0", ExtranonceBytes: 2}, nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	var (
+		clients     [2]*stratumTestClient
+		extranonces [2]string
+	)
+	for i := range clients {
+		clients[i] = dialStratum(t, hmhash.stratum.listener.Addr().String())
+		defer clients[i].conn.Close()
+
+		res := clients[i].call("mining.subscribe", "test", stratumProtocol)
+		if res["error"] != nil {
+			t.Fatalf("client %d: subscription failed: %v", i, res["error"])
+		}
+		extranonces[i] = res["result"].([]interface{})[1].(string)
+		if len(extranonces[i]) != 4 {
+			t.Fatalf("client %d: extranonce length mismatch: have %q, want 2 bytes", i, extranonces[i])
+		}
+		if res := clients[i].call("mining.authorize", "worker", "x"); res["result"] != true {
+			t.Fatalf("client %d: authorization failed: %v", i, res["error"])
+		}
+	}
+	if extranonces[0] == extranonces[1] {
+		t.Fatalf("extranonce shared between connections: %s", extranonces[0])
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+
+	for _, client := range clients {
+		client.read() // mining.set_difficulty
+		client.read() // mining.notify
+	}
+	// Search a valid nonce within the range of the first connection
+	var (
+		sealhash = hmhash.SealHash(header)
+		jobID    = common.Bytes2Hex(sealhash.Bytes())
+		cache    = hmhash.cache(nil, 1)
+		target   = new(big.Int).Div(two256, header.Difficulty)
+		prefix   = new(big.Int).SetBytes(common.FromHex(extranonces[0])).Uint64() << 48
+		nonce    = prefix
+	)
+	for ; ; nonce++ {
+		_, result := hashimotoLight(hmhash.algo, testDatasetSize, cache.cache, sealhash.Bytes(), nonce)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			break
+		}
+	}
+	// The full nonce is outside of the range of the second connection
+	if res := clients[1].call("mining.submit", "worker", jobID, fmt.Sprintf("%016x", nonce)); res["error"] == nil {
+		t.Fatalf("nonce outside of extranonce range accepted")
+	}
+	if res := clients[0].call("mining.submit", "worker", jobID, fmt.Sprintf("%012x", nonce-prefix)); res["result"] != true {
+		t.Fatalf("valid submission without extranonce rejected: %v", res["error"])
+	}
+	select {
+	case block := <-results:
+		if block.Nonce() != nonce {
+			t.Errorf("sealed nonce mismatch: have %d, want %d", block.Nonce(), nonce)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("sealed block not delivered")
+	}
+}
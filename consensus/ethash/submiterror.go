@@ -0,0 +1,114 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	// errUnknownWork is returned if a solution is submitted to work that was
+	// never handed out or went stale long ago.
+	errUnknownWork = errors.New("unknown work")
+
+	// errStaleWork is returned if a solution is submitted to work too old to
+	// extend the chain or to be an uncle.
+	errStaleWork = errors.New("stale work")
+
+	errDuplicateSolution = errors.New("duplicate solution")
+	errBannedSubmitter   = errors.New("submitter banned")
+	errDroppedSolution   = errors.New("solution not read by the miner")
+	errMissingCommitment = errors.New("merge-mined header without commitment")
+)
+
+// Codes of the outcome of remote solutions, telling farm software whether to
+// retry, fetch new work or fix its miner.
+const (
+	SubmitAccepted      = "accepted"       // Solution accepted
+	SubmitUnknownWork   = "unknown-work"   // Work never handed out or long gone, fetch new work
+	SubmitStaleWork     = "stale-work"     // Work too old to extend the chain, fetch new work
+	SubmitLowDifficulty = "low-difficulty" // Proof-of-work doesn't meet the block or share target
+	SubmitBadMixDigest  = "bad-mix-digest" // Mix digest doesn't match the nonce, check the miner
+	SubmitChainRule     = "chain-rule"     // Seal violates another rule of the chain
+	SubmitDuplicate     = "duplicate"      // Solution submitted before
+	SubmitBanned        = "banned"         // Submitter banned for abuse
+	SubmitUnauthorized  = "unauthorized"   // Missing, unknown or oversized submission token
+	SubmitThrottled     = "throttled"      // Request rate limit exceeded, back off before retrying
+	SubmitDropped       = "dropped"        // Solution valid but not taken by the miner, retrying won't help
+)
+
+// submitRejectMeters count the rejected remote solutions by code.
+var submitRejectMeters = make(map[string]metrics.Meter)
+
+func init() {
+	for _, code := range []string{SubmitUnknownWork, SubmitStaleWork, SubmitLowDifficulty, SubmitBadMixDigest, SubmitChainRule, SubmitDuplicate, SubmitBanned, SubmitUnauthorized, SubmitThrottled, SubmitDropped} {
+		submitRejectMeters[code] = metrics.NewRegisteredMeter("hmhash/remote/rejected/"+code, nil)
+	}
+}
+
+// SubmitResult is the detailed outcome of a remote solution.
+type SubmitResult struct {
+	Accepted bool   `json:"accepted"`
+	Code     string `json:"code"`             // One of the Submit constants
+	Reason   string `json:"reason,omitempty"` // Error rejecting the solution
+}
+
+// submitCode returns the code of the outcome of a solution rejected with the
+// given error, or accepted if nil.
+func submitCode(err error) string {
+	switch {
+	case err == nil:
+		return SubmitAccepted
+	case errors.Is(err, errUnknownWork), errors.Is(err, errNoMiningWork):
+		return SubmitUnknownWork
+	case errors.Is(err, errStaleWork):
+		return SubmitStaleWork
+	case errors.Is(err, errInvalidPoW):
+		return SubmitLowDifficulty
+	case errors.Is(err, errInvalidMixDigest):
+		return SubmitBadMixDigest
+	case errors.Is(err, errDuplicateSolution), errors.Is(err, errDuplicateShare):
+		return SubmitDuplicate
+	case errors.Is(err, errBannedSubmitter):
+		return SubmitBanned
+	case errors.Is(err, errMissingToken), errors.Is(err, errUnknownToken), errors.Is(err, errRequestTooLarge):
+		return SubmitUnauthorized
+	case errors.Is(err, errTokenThrottle), errors.Is(err, errRequestThrottle):
+		return SubmitThrottled
+	case errors.Is(err, errDroppedSolution), errors.Is(err, errHmhashStopped):
+		return SubmitDropped
+	default:
+		return SubmitChainRule
+	}
+}
+
+// newSubmitResult creates the detailed outcome of a solution rejected with the
+// given error, or accepted if nil.
+func newSubmitResult(err error) *SubmitResult {
+	result := &SubmitResult{Accepted: err == nil, Code: submitCode(err)}
+	if err != nil {
+		result.Reason = err.Error()
+	}
+	return result
+}
+
+// markSubmitRejection counts a solution rejected with the given error.
+func markSubmitRejection(err error) {
+	submitRejectMeters[submitCode(err)].Mark(1)
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that remote solutions are rejected with the code telling farm software
+// how to react.
+func TestSubmitWorkDetailed(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	header := &types.Header{ParentHash: common.Hash{0x01}, Number: big.NewInt(1), Difficulty: big.NewInt(10)}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+	sealhash := hmhash.SealHash(header)
+
+	// Search a nonce sealing the block and two that don't
+	var (
+		target = new(big.Int).Div(two256, header.Difficulty)
+		valid  types.BlockNonce
+		digest common.Hash
+		lows   []types.BlockNonce
+		mixes  []common.Hash
+	)
+	for nonce := uint64(0); digest == (common.Hash{}) || len(lows) < 2; nonce++ {
+		header.Nonce = types.EncodeNonce(nonce)
+		mix, result := hmhash.computeSeal(nil, header, false)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			if digest == (common.Hash{}) {
+				valid, digest = header.Nonce, common.BytesToHash(mix)
+			}
+		} else if len(lows) < 2 {
+			lows, mixes = append(lows, header.Nonce), append(mixes, common.BytesToHash(mix))
+		}
+	}
+	api := &MiningAPI{hmhash}
+	tests := []struct {
+		nonce  types.BlockNonce
+		hash   common.Hash
+		digest common.Hash
+		code   string
+	}{
+		{valid, common.Hash{0x02}, digest, SubmitUnknownWork},
+		{lows[0], sealhash, common.Hash{0xff}, SubmitBadMixDigest},
+		{lows[1], sealhash, mixes[1], SubmitLowDifficulty},
+		{valid, sealhash, digest, SubmitAccepted},
+		{valid, sealhash, digest, SubmitDuplicate},
+	}
+	for i, tt := range tests {
+		res := api.SubmitWorkDetailed(context.Background(), tt.nonce, tt.hash, tt.digest, nil)
+		if res.Code != tt.code || res.Accepted != (tt.code == SubmitAccepted) || (res.Reason == "") != res.Accepted {
+			t.Errorf("test %d: result mismatch: have %+v, want code %s", i, res, tt.code)
+		}
+	}
+	select {
+	case block := <-results:
+		if block.Nonce() != valid.Uint64() {
+			t.Errorf("sealed nonce mismatch: have %d, want %d", block.Nonce(), valid.Uint64())
+		}
+	default:
+		t.Errorf("accepted solution not delivered")
+	}
+}
+
+// Tests that the rejection errors map to the codes of the outcome.
+func TestSubmitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{nil, SubmitAccepted},
+		{errStaleWork, SubmitStaleWork},
+		{errBannedSubmitter, SubmitBanned},
+		{errUnknownToken, SubmitUnauthorized},
+		{errDroppedSolution, SubmitDropped},
+		{errMissingCommitment, SubmitChainRule},
+	}
+	for _, tt := range tests {
+		if code := submitCode(tt.err); code != tt.code {
+			t.Errorf("error %v: code mismatch: have %s, want %s", tt.err, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the OpenTelemetry tracer of the engine.
+const tracerName = "github.com/ethereum/go-ethereum/consensus/ethash"
+
+// otlpTimeout is the deadline of exporting a batch of spans to an OTLP collector.
+const otlpTimeout = 10 * time.Second
+
+// newTracerProvider creates a tracer provider exporting the spans to the given
+// exporter: "stdout", or the URL of an OTLP/HTTP collector. Traces are sampled
+// with the given ratio, all of them if it's not within (0, 1).
+func newTracerProvider(exporter string, ratio float64) (*sdktrace.TracerProvider, error) {
+	var exp sdktrace.SpanExporter
+	if exporter == "stdout" {
+		var err error
+		if exp, err = stdouttrace.New(); err != nil {
+			return nil, err
+		}
+	} else {
+		u, err := url.Parse(exporter)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported trace exporter %q", exporter)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/traces"
+		}
+		exp = &otlpExporter{url: u.String(), client: &http.Client{Timeout: otlpTimeout}}
+	}
+	sampler := sdktrace.AlwaysSample()
+	if ratio > 0 && ratio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "geth"))),
+	), nil
+}
+
+// spanTracer returns the tracer of the engine spans, exporting them to the
+// configured exporter, or to the process-wide tracer provider otherwise, which
+// drops them unless one is installed.
+func (hmhash *Hmhash) spanTracer() trace.Tracer {
+	if hmhash.tracer != nil {
+		return hmhash.tracer
+	}
+	return otel.Tracer(tracerName)
+}
+
+// startSpan starts a span of an engine operation.
+func (hmhash *Hmhash) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return hmhash.spanTracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, marking it failed if the operation returned an error.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// otlpExporter exports spans to an OpenTelemetry collector over OTLP/HTTP, with
+// the JSON encoding of the protocol.
+type otlpExporter struct {
+	url    string
+	client *http.Client
+}
+
+// ExportSpans implements sdktrace.SpanExporter, posting the spans to the
+// collector.
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	blob, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("OTLP collector responded %s", res.Status)
+	}
+	return nil
+}
+
+// Shutdown implements sdktrace.SpanExporter.
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// otlpRequest assembles the JSON encoded OTLP export request of the spans,
+// grouped by resource and instrumentation scope.
+func otlpRequest(spans []sdktrace.ReadOnlySpan) map[string]interface{} {
+	type scopeKey struct {
+		resource attribute.Distinct
+		scope    string
+	}
+	var (
+		resources = make(map[attribute.Distinct][]interface{})
+		scopes    = make(map[scopeKey]map[string]interface{})
+		order     []*resource.Resource
+	)
+	for _, span := range spans {
+		res := span.Resource()
+		rkey := res.Equivalent()
+		if _, ok := resources[rkey]; !ok {
+			resources[rkey] = nil
+			order = append(order, res)
+		}
+		skey := scopeKey{rkey, span.InstrumentationScope().Name}
+		scope, ok := scopes[skey]
+		if !ok {
+			scope = map[string]interface{}{
+				"scope": map[string]interface{}{
+					"name":    span.InstrumentationScope().Name,
+					"version": span.InstrumentationScope().Version,
+				},
+				"spans": []interface{}{},
+			}
+			scopes[skey] = scope
+			resources[rkey] = append(resources[rkey], scope)
+		}
+		scope["spans"] = append(scope["spans"].([]interface{}), otlpSpan(span))
+	}
+	resourceSpans := make([]interface{}, 0, len(order))
+	for _, res := range order {
+		resourceSpans = append(resourceSpans, map[string]interface{}{
+			"resource":   map[string]interface{}{"attributes": otlpAttributes(res.Attributes())},
+			"scopeSpans": resources[res.Equivalent()],
+		})
+	}
+	return map[string]interface{}{"resourceSpans": resourceSpans}
+}
+
+// otlpSpan converts a span to its OTLP JSON encoding.
+func otlpSpan(span sdktrace.ReadOnlySpan) map[string]interface{} {
+	sc := span.SpanContext()
+	enc := map[string]interface{}{
+		"traceId":           sc.TraceID().String(),
+		"spanId":            sc.SpanID().String(),
+		"name":              span.Name(),
+		"kind":              int(span.SpanKind()),
+		"startTimeUnixNano": strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		"attributes":        otlpAttributes(span.Attributes()),
+	}
+	if parent := span.Parent(); parent.IsValid() {
+		enc["parentSpanId"] = parent.SpanID().String()
+	}
+	if events := span.Events(); len(events) > 0 {
+		encs := make([]interface{}, 0, len(events))
+		for _, event := range events {
+			encs = append(encs, map[string]interface{}{
+				"name":         event.Name,
+				"timeUnixNano": strconv.FormatInt(event.Time.UnixNano(), 10),
+				"attributes":   otlpAttributes(event.Attributes),
+			})
+		}
+		enc["events"] = encs
+	}
+	// The status codes of OTLP order "ok" and "error" the other way around
+	switch status := span.Status(); status.Code {
+	case codes.Ok:
+		enc["status"] = map[string]interface{}{"code": 1}
+	case codes.Error:
+		enc["status"] = map[string]interface{}{"code": 2, "message": status.Description}
+	}
+	return enc
+}
+
+// otlpAttributes converts attributes to their OTLP JSON encoding.
+func otlpAttributes(attrs []attribute.KeyValue) []interface{} {
+	encs := make([]interface{}, 0, len(attrs))
+	for _, attr := range attrs {
+		encs = append(encs, map[string]interface{}{"key": string(attr.Key), "value": otlpValue(attr.Value)})
+	}
+	return encs
+}
+
+// otlpValue converts an attribute value to its OTLP JSON encoding.
+func otlpValue(v attribute.Value) map[string]interface{} {
+	switch v.Type() {
+	case attribute.BOOL:
+		return map[string]interface{}{"boolValue": v.AsBool()}
+	case attribute.INT64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v.AsInt64(), 10)}
+	case attribute.FLOAT64:
+		return map[string]interface{}{"doubleValue": v.AsFloat64()}
+	case attribute.BOOLSLICE:
+		values := make([]interface{}, 0)
+		for _, b := range v.AsBoolSlice() {
+			values = append(values, otlpValue(attribute.BoolValue(b)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case attribute.INT64SLICE:
+		values := make([]interface{}, 0)
+		for _, i := range v.AsInt64Slice() {
+			values = append(values, otlpValue(attribute.Int64Value(i)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case attribute.FLOAT64SLICE:
+		values := make([]interface{}, 0)
+		for _, f := range v.AsFloat64Slice() {
+			values = append(values, otlpValue(attribute.Float64Value(f)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case attribute.STRINGSLICE:
+		values := make([]interface{}, 0)
+		for _, s := range v.AsStringSlice() {
+			values = append(values, otlpValue(attribute.StringValue(s)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	default:
+		return map[string]interface{}{"stringValue": v.Emit()}
+	}
+}
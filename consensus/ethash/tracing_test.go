@@ -0,0 +1,179 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// endedSpan waits for a span with the given name to end, failing if it doesn't
+// in time.
+func endedSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for deadline := time.Now().Add(4 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+	}
+	t.Fatalf("span %q not ended", name)
+	return nil
+}
+
+// spanAttribute returns the value of a span attribute.
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// Tests that sealing, seal verification and remote submissions are traced.
+func TestEngineSpans(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	hmhash.tracer = provider.Tracer(tracerName)
+
+	// Seal a block, tracing the search and the solution
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	results := make(chan *types.Block, 1)
+	if err := hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	block := <-results
+
+	seal := endedSpan(t, recorder, "hmhash.Seal")
+	if number := spanAttribute(seal, "hmhash.number").AsInt64(); number != 1 {
+		t.Errorf("seal number mismatch: have %d, want 1", number)
+	}
+	if outcome := spanAttribute(seal, "hmhash.outcome").AsString(); outcome != TraceAccepted {
+		t.Errorf("seal outcome mismatch: have %q, want %q", outcome, TraceAccepted)
+	}
+	solution := endedSpan(t, recorder, "hmhash.solution")
+	if hash := spanAttribute(solution, "hmhash.hash").AsString(); hash != block.Hash().Hex() {
+		t.Errorf("solution hash mismatch: have %s, want %x", hash, block.Hash())
+	}
+	// Verify the seal within a parent span, nesting the verification in it
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "import")
+	if err := hmhash.VerifySealContext(ctx, nil, block.Header()); err != nil {
+		t.Fatalf("failed to verify seal: %v", err)
+	}
+	parent.End()
+
+	verify := endedSpan(t, recorder, "hmhash.VerifySeal")
+	if verify.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("verification parent mismatch: have %s, want %s", verify.Parent().SpanID(), parent.SpanContext().SpanID())
+	}
+	// Submit a bogus remote solution, tracing its rejection
+	if (&API{hmhash}).submitWork(types.EncodeNonce(1), common.Hash{1}, common.Hash{}, "rig") {
+		t.Fatalf("bogus solution accepted")
+	}
+	submit := endedSpan(t, recorder, "hmhash.SubmitWork")
+	if spanAttribute(submit, "hmhash.accepted").AsBool() || spanAttribute(submit, "hmhash.source").AsString() != "rig" {
+		t.Errorf("submission attributes mismatch: %v", submit.Attributes())
+	}
+}
+
+// Tests that spans are exported to an OTLP/HTTP collector in the JSON encoding.
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan map[string]interface{}, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected export request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode export request: %v", err)
+		}
+		requests <- req
+	}))
+	defer collector.Close()
+
+	provider, err := newTracerProvider(collector.URL, 0)
+	if err != nil {
+		t.Fatalf("failed to create tracer provider: %v", err)
+	}
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "hmhash.VerifySeal")
+	span.SetAttributes(attribute.Int64("hmhash.number", 7), attribute.StringSlice("hmhash.tags", []string{"a", "b"}))
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to flush spans: %v", err)
+	}
+	var req map[string]interface{}
+	select {
+	case req = <-requests:
+	case <-time.After(time.Second):
+		t.Fatalf("export request timeout")
+	}
+	blob, _ := json.Marshal(req)
+	var decoded struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				Spans []struct {
+					TraceID    string `json:"traceId"`
+					SpanID     string `json:"spanId"`
+					Name       string `json:"name"`
+					Attributes []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(blob, &decoded); err != nil {
+		t.Fatalf("failed to decode spans: %v", err)
+	}
+	if len(decoded.ResourceSpans) != 1 || len(decoded.ResourceSpans[0].ScopeSpans) != 1 || len(decoded.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("span grouping mismatch: %s", blob)
+	}
+	scope := decoded.ResourceSpans[0].ScopeSpans[0]
+	if scope.Scope.Name != tracerName {
+		t.Errorf("scope mismatch: have %s, want %s", scope.Scope.Name, tracerName)
+	}
+	exported := scope.Spans[0]
+	if exported.Name != "hmhash.VerifySeal" || len(exported.TraceID) != 32 || len(exported.SpanID) != 16 {
+		t.Errorf("span mismatch: %s", blob)
+	}
+	if len(exported.Attributes) != 2 || exported.Attributes[0].Value["intValue"] != "7" {
+		t.Errorf("attributes mismatch: %s", blob)
+	}
+	if _, err := newTracerProvider("ftp://localhost", 0); err == nil {
+		t.Errorf("unsupported exporter accepted")
+	}
+}
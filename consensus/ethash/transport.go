@@ -0,0 +1,109 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// RemoteTransport is a channel distributing the work packages of the remote
+// sealer to remote miners, such as the built-in stratum, hmwire, gRPC and
+// getwork servers. HTTP work notifications are handled by the remote sealer
+// itself, as their targets are managed at runtime.
+type RemoteTransport interface {
+	// Start begins serving remote miners in the background.
+	Start()
+
+	// NotifyWork pushes a new work package to the connected miners. It's called
+	// from the remote sealer loop, so it must not block.
+	NotifyWork(work [4]string, block *types.Block)
+
+	// Close terminates the transport, waiting for its goroutines to exit.
+	Close()
+}
+
+// TransportFactory creates a remote transport for a hmhash engine. Transports
+// deliver the solutions and hashrates of their miners through the engine's
+// SubmitRemoteWork and SubmitRemoteHashrate methods.
+type TransportFactory func(hmhash *Hmhash) (RemoteTransport, error)
+
+var (
+	transportsLock sync.RWMutex
+	transports     = make(map[string]TransportFactory)
+)
+
+// RegisterTransport makes a remote transport available by name to the engines
+// listing it in their Config.Transports, allowing packages to compile in
+// custom transports. It panics if the name is registered twice.
+func RegisterTransport(name string, factory TransportFactory) {
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+
+	if factory == nil {
+		panic("hmhash: nil transport factory for " + name)
+	}
+	if _, ok := transports[name]; ok {
+		panic("hmhash: transport registered twice: " + name)
+	}
+	transports[name] = factory
+}
+
+// Transports returns the sorted names of the registered remote transports.
+func Transports() []string {
+	transportsLock.RLock()
+	defer transportsLock.RUnlock()
+
+	names := make([]string, 0, len(transports))
+	for name := range transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newTransport creates a registered remote transport for the engine.
+func newTransport(hmhash *Hmhash, name string) (RemoteTransport, error) {
+	transportsLock.RLock()
+	factory, ok := transports[name]
+	transportsLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown transport %q", name)
+	}
+	return factory(hmhash)
+}
+
+// SubmitRemoteWork submits a POW solution received by a remote transport on
+// behalf of a named worker, returning whether it was accepted.
+func (hmhash *Hmhash) SubmitRemoteWork(nonce types.BlockNonce, sealhash, mixDigest common.Hash, worker string) bool {
+	return (&API{hmhash}).submitWork(nonce, sealhash, mixDigest, worker)
+}
+
+// SubmitRemoteHashrate records the hashrate of a remote miner received by a
+// remote transport, returning whether it was accepted. Like eth_submitHashrate,
+// it's rate limited and checked against the submission token and the signing
+// key registered for the id, if configured.
+func (hmhash *Hmhash) SubmitRemoteHashrate(ctx context.Context, rate uint64, id common.Hash, token *string, sig []byte, signed uint64) bool {
+	return (&API{hmhash}).submitHashrateToken(ctx, hexutil.Uint64(rate), id, token, sig, signed)
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// testTransport is a remote transport recording the engine's calls.
+type testTransport struct {
+	hmhash  *Hmhash
+	started bool
+	closed  bool
+	works   chan [4]string
+}
+
+func (t *testTransport) Start() { t.started = true }
+func (t *testTransport) Close() { t.closed = true }
+
+func (t *testTransport) NotifyWork(work [4]string, block *types.Block) {
+	select {
+	case t.works <- work:
+	default:
+	}
+}
+
+// Tests that registered remote transports are run by the engines listing them.
+func TestRegisteredTransport(t *testing.T) {
+	var transport *testTransport
+	RegisterTransport("test", func(hmhash *Hmhash) (RemoteTransport, error) {
+		transport = &testTransport{hmhash: hmhash, works: make(chan [4]string, 1)}
+		return transport, nil
+	})
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate transport registration accepted")
+		}
+	}()
+	found := false
+	for _, name := range Transports() {
+		found = found || name == "test"
+	}
+	if !found {
+		t.Fatalf("registered transport not listed: %v", Transports())
+	}
+	hmhash := New(Config{PowMode: ModeTest, Transports: []string{"unknown", "test"}}, nil, false)
+	if transport == nil || transport.hmhash != hmhash || !transport.started {
+		t.Fatalf("transport not started: %+v", transport)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+
+	select {
+	case work := <-transport.works:
+		if work[0] != hmhash.SealHash(header).Hex() {
+			t.Errorf("work hash mismatch: have %s, want %s", work[0], hmhash.SealHash(header).Hex())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("work not pushed to transport")
+	}
+	if hmhash.SubmitRemoteWork(types.BlockNonce{}, hmhash.SealHash(header), common.Hash{}, "worker") {
+		t.Errorf("invalid solution accepted")
+	}
+	if !hmhash.SubmitRemoteHashrate(context.Background(), 100, common.Hash{0x01}, nil, nil, 0) {
+		t.Errorf("hashrate rejected")
+	}
+	hmhash.Close()
+	if !transport.closed {
+		t.Errorf("transport not closed")
+	}
+	RegisterTransport("test", func(hmhash *Hmhash) (RemoteTransport, error) { return nil, nil })
+}
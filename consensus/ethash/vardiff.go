@@ -0,0 +1,80 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"time"
+)
+
+const (
+	// vardiffRetargetInterval is the time over which the share rate of a worker
+	// is measured before its share difficulty is adjusted.
+	vardiffRetargetInterval = 30 * time.Second
+
+	// vardiffMaxAdjustment is the largest factor by which a single retarget may
+	// raise or lower the share difficulty, damping the noise of short windows.
+	vardiffMaxAdjustment = 4
+)
+
+// vardiff is the variable share difficulty of a single worker.
+type vardiff struct {
+	difficulty *big.Int  // Current share difficulty of the worker
+	previous   *big.Int  // Share difficulty before the last retarget, accepted for late shares
+	start      time.Time // Start of the current measurement window
+	shares     uint64    // Shares accepted within the current window
+}
+
+// vardiff returns the share difficulty of a named worker, retargeting it if the
+// measurement window elapsed. The caller must hold the tracker lock.
+func (t *shareTracker) vardiff(worker string, now time.Time) *vardiff {
+	v := t.vardiffs[worker]
+	if v == nil {
+		v = &vardiff{difficulty: t.difficulty, previous: t.difficulty, start: now}
+		t.vardiffs[worker] = v
+	}
+	if elapsed := now.Sub(v.start); elapsed >= vardiffRetargetInterval {
+		next := retargetVardiff(v.difficulty, v.shares, elapsed, t.rate)
+		if next.Cmp(v.difficulty) != 0 {
+			t.log.Debug("Retargeted hmhash share difficulty", "worker", worker, "shares", v.shares, "elapsed", elapsed, "old", v.difficulty, "new", next)
+		}
+		v.previous, v.difficulty = v.difficulty, next
+		v.start, v.shares = now, 0
+	}
+	return v
+}
+
+// retargetVardiff scales a share difficulty by the ratio of the measured share
+// rate to the targeted one (in shares per minute), within the bounds of
+// vardiffMaxAdjustment.
+func retargetVardiff(difficulty *big.Int, shares uint64, elapsed time.Duration, rate uint64) *big.Int {
+	// next = difficulty * shares * minute / (elapsed * rate)
+	next := new(big.Int).Mul(difficulty, new(big.Int).SetUint64(shares))
+	next.Mul(next, big.NewInt(int64(time.Minute)))
+	next.Div(next, new(big.Int).Mul(big.NewInt(int64(elapsed)), new(big.Int).SetUint64(rate)))
+
+	if upper := new(big.Int).Mul(difficulty, big.NewInt(vardiffMaxAdjustment)); next.Cmp(upper) > 0 {
+		next = upper
+	}
+	if lower := new(big.Int).Div(difficulty, big.NewInt(vardiffMaxAdjustment)); next.Cmp(lower) < 0 {
+		next = lower
+	}
+	if next.Sign() == 0 {
+		next.SetUint64(1)
+	}
+	return next
+}
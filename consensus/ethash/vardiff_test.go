@@ -0,0 +1,147 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Tests that share difficulties are scaled towards the targeted share rate.
+func TestRetargetVardiff(t *testing.T) {
+	tests := []struct {
+		difficulty uint64
+		shares     uint64
+		elapsed    time.Duration
+		rate       uint64
+		want       uint64
+	}{
+		{1000, 10, time.Minute, 10, 1000},       // On target
+		{1000, 20, time.Minute, 10, 2000},       // Twice too many shares
+		{1000, 5, time.Minute, 10, 500},         // Half the shares
+		{1000, 10, 30 * time.Second, 10, 2000},  // Rate measured over a short window
+		{1000, 1000, time.Minute, 10, 4000},     // Raise capped
+		{1000, 0, time.Minute, 10, 250},         // Drop capped
+		{2, 0, time.Minute, 10, 1},              // Never below one
+		{1000, 15, 90 * time.Second, 10, 1000},  // Fractional minutes
+		{1000, 3, 2 * time.Minute, 1, 1500},     // Slow workers
+		{100000, 123, time.Minute, 100, 123000}, // Arbitrary ratio
+	}
+	for i, tt := range tests {
+		have := retargetVardiff(new(big.Int).SetUint64(tt.difficulty), tt.shares, tt.elapsed, tt.rate)
+		if have.Uint64() != tt.want {
+			t.Errorf("test %d: difficulty mismatch: have %v, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that named workers are retargeted once the measurement window elapses,
+// shares mined against the previous target are still accepted and anonymous
+// workers keep the configured share difficulty.
+func TestVardiffTracker(t *testing.T) {
+	tracker, err := newShareTracker(1000, 10, nil, nil, log.Root())
+	if err != nil {
+		t.Fatalf("failed to create share tracker: %v", err)
+	}
+	block := big.NewInt(1000000)
+	if have, want := tracker.target("worker", block), new(big.Int).Div(two256, big.NewInt(1000)); have.Cmp(want) != 0 {
+		t.Fatalf("initial target mismatch: have %x, want %x", have, want)
+	}
+	// Report twice the targeted rate over a full window
+	tracker.vardiffs["worker"].start = time.Now().Add(-time.Minute)
+	tracker.vardiffs["worker"].shares = 20
+
+	tracker.target("worker", block)
+	if have := tracker.vardiffs["worker"].difficulty.Uint64(); have < 1990 || have > 2000 {
+		t.Fatalf("retargeted difficulty mismatch: have %d, want %d", have, 2000)
+	}
+	if have, want := tracker.target("", block), new(big.Int).Div(two256, big.NewInt(1000)); have.Cmp(want) != 0 {
+		t.Fatalf("anonymous target mismatch: have %x, want %x", have, want)
+	}
+	// Shares meeting the previous target are credited with its difficulty
+	result := new(big.Int).Div(two256, big.NewInt(1500))
+	if target, ok := tracker.check("worker", block, result); !ok || new(big.Int).Div(two256, target).Uint64() != 1000 {
+		t.Errorf("late share not credited with the previous difficulty: %x, %v", target, ok)
+	}
+	if _, ok := tracker.check("worker", block, new(big.Int).Div(two256, big.NewInt(500))); ok {
+		t.Errorf("share below both targets accepted")
+	}
+	// Blocks easier than the share difficulty bound the target
+	if have, want := tracker.target("worker", big.NewInt(100)), new(big.Int).Div(two256, big.NewInt(100)); have.Cmp(want) != 0 {
+		t.Fatalf("easy block target mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that stratum workers are pushed a new difficulty when an accepted share
+// retargets them.
+func TestStratumVardiff(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, StratumAddr: "127.0.0.1:0", ShareDifficulty: 10, VardiffRate: 1}, nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	client := dialStratum(t, hmhash.stratum.listener.Addr().String())
+	defer client.conn.Close()
+
+	client.call("mining.subscribe", "test", stratumProtocol)
+	client.call("mining.authorize", "worker", "x")
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1000000)}
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+
+	diff := func(msg map[string]interface{}) float64 {
+		t.Helper()
+		if msg["method"] != "mining.set_difficulty" {
+			t.Fatalf("expected difficulty update, got %v", msg)
+		}
+		return msg["params"].([]interface{})[0].(float64)
+	}
+	initial := diff(client.read())
+	if msg := client.read(); msg["method"] != "mining.notify" {
+		t.Fatalf("expected job notification, got %v", msg)
+	}
+	// Pretend the worker submitted far too many shares in the last minute
+	hmhash.shares.lock.Lock()
+	hmhash.shares.vardiffs["worker"].start = time.Now().Add(-time.Minute)
+	hmhash.shares.vardiffs["worker"].shares = 100
+	hmhash.shares.lock.Unlock()
+
+	var (
+		sealhash = hmhash.SealHash(header)
+		target   = new(big.Int).Div(two256, big.NewInt(10))
+		nonce    uint64
+	)
+	for ; ; nonce++ {
+		if _, result := hmhash.powResult(1, sealhash, nonce); new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			break
+		}
+	}
+	if res := client.call("mining.submit", "worker", common.Bytes2Hex(sealhash.Bytes()), fmt.Sprintf("%016x", nonce)); res["result"] != true {
+		t.Fatalf("valid share rejected: %v", res["error"])
+	}
+	if updated := diff(client.read()); updated <= initial*3.9 || updated >= initial*4.1 {
+		t.Fatalf("retargeted difficulty mismatch: have %v, want %v", updated, 4*initial)
+	}
+	if msg := client.read(); msg["method"] != "mining.notify" {
+		t.Fatalf("expected job notification, got %v", msg)
+	}
+}
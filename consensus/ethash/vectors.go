@@ -0,0 +1,110 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestVector is a known-answer test of the hmhash proof-of-work: the mix digest
+// and result the reference implementation computes for a header hash and nonce
+// at an epoch. Alternative implementations, like C or FPGA miners, can validate
+// against files of them.
+type TestVector struct {
+	Epoch      uint64         `json:"epoch"`
+	HeaderHash common.Hash    `json:"headerHash"`
+	Nonce      hexutil.Uint64 `json:"nonce"`
+	MixDigest  common.Hash    `json:"mixDigest"`
+	Result     common.Hash    `json:"result"`
+}
+
+// LoadTestVectors reads a JSON array of test vectors from a file.
+func LoadTestVectors(path string) ([]TestVector, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var vectors []TestVector
+	if err := json.Unmarshal(blob, &vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// MakeTestVectors computes count test vectors at an epoch with the reference
+// implementation. The header hashes and nonces are derived from the epoch and
+// the vector index, so the same vectors are generated on every run.
+func MakeTestVectors(epoch uint64, count int) []TestVector {
+	cache := vectorCache(epoch)
+
+	vectors := make([]TestVector, count)
+	for i := range vectors {
+		var seed [16]byte
+		binary.BigEndian.PutUint64(seed[:8], epoch)
+		binary.BigEndian.PutUint64(seed[8:], uint64(i))
+		hash := crypto.Keccak256Hash(seed[:])
+
+		vectors[i] = TestVector{
+			Epoch:      epoch,
+			HeaderHash: hash,
+			Nonce:      hexutil.Uint64(binary.BigEndian.Uint64(crypto.Keccak256(hash[:]))),
+		}
+		vectors[i].MixDigest, vectors[i].Result = vectors[i].compute(cache)
+	}
+	return vectors
+}
+
+// CheckTestVectors recomputes the test vectors with the reference implementation,
+// returning an error for the first one mismatching.
+func CheckTestVectors(vectors []TestVector) error {
+	caches := make(map[uint64][]uint32)
+	for i, v := range vectors {
+		cache, ok := caches[v.Epoch]
+		if !ok {
+			cache = vectorCache(v.Epoch)
+			caches[v.Epoch] = cache
+		}
+		digest, result := v.compute(cache)
+		if digest != v.MixDigest {
+			return fmt.Errorf("vector %d: mix digest mismatch: have %x, want %x", i, digest, v.MixDigest)
+		}
+		if result != v.Result {
+			return fmt.Errorf("vector %d: result mismatch: have %x, want %x", i, result, v.Result)
+		}
+	}
+	return nil
+}
+
+// vectorCache generates the full sized verification cache of an epoch in memory.
+func vectorCache(epoch uint64) []uint32 {
+	c := newCache(epoch, keccakAlgo{})
+	c.generate("", 0, false, cacheSize(epoch*epochLength))
+	return c.cache
+}
+
+// compute runs the light hashimoto of the vector over the cache of its epoch.
+func (v *TestVector) compute(cache []uint32) (common.Hash, common.Hash) {
+	digest, result := hashimotoLight(keccakAlgo{}, datasetSize(v.Epoch*epochLength), cache, v.HeaderHash[:], uint64(v.Nonce))
+	return common.BytesToHash(digest), common.BytesToHash(result)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// workLookup is a request for the pending work of a seal hash.
+type workLookup struct {
+	sealhash common.Hash
+	result   chan *pendingWork
+}
+
+// pendingWork is the pending work of a seal hash looked up.
+type pendingWork struct {
+	block   *types.Block // Block of the work, nil if unknown
+	current bool         // Whether the work is the latest one handed out
+}
+
+// WorkVerification is the outcome of checking a solution to the remote work
+// without submitting it, for miner developers debugging their submissions.
+type WorkVerification struct {
+	SealHash  common.Hash     `json:"sealHash"`
+	Number    *hexutil.Uint64 `json:"number,omitempty"` // Number of the block of the work, nil if unknown
+	Current   bool            `json:"current"`          // Whether the work is the latest one handed out, or stale
+	Valid     bool            `json:"valid"`            // Whether the solution seals the block
+	Reason    string          `json:"reason,omitempty"` // Why the solution doesn't seal the block
+	MixDigest common.Hash     `json:"mixDigest"`        // Mix digest computed for the nonce
+	Result    common.Hash     `json:"result"`           // PoW value computed for the nonce
+	Target    common.Hash     `json:"target"`           // Boundary the PoW value must meet, 2^256 / difficulty
+}
+
+// lookupWork returns the pending work of a seal hash, the current or a stale
+// one still remembered.
+func (hmhash *Hmhash) lookupWork(sealhash common.Hash) *pendingWork {
+	if hmhash.remote == nil {
+		return &pendingWork{}
+	}
+	req := &workLookup{sealhash: sealhash, result: make(chan *pendingWork, 1)}
+	select {
+	case hmhash.remote.lookupCh <- req:
+	case <-hmhash.remote.exitCh:
+		return &pendingWork{}
+	}
+	return <-req.result
+}
+
+// VerifyWork checks a solution to the remote work of the given seal hash, the
+// current or a stale one, without submitting it.
+func (hmhash *Hmhash) VerifyWork(sealhash common.Hash, nonce types.BlockNonce, mixDigest common.Hash) *WorkVerification {
+	if hmhash.shared != nil {
+		return hmhash.shared.VerifyWork(sealhash, nonce, mixDigest)
+	}
+	verification := &WorkVerification{SealHash: sealhash}
+
+	work := hmhash.lookupWork(sealhash)
+	if work.block == nil {
+		verification.Reason = errUnknownWork.Error()
+		return verification
+	}
+	header := work.block.Header()
+	header.Nonce, header.MixDigest = nonce, mixDigest
+
+	number := hexutil.Uint64(header.Number.Uint64())
+	verification.Number, verification.Current = &number, work.current
+	if header.Difficulty.Sign() <= 0 {
+		verification.Reason = errInvalidDifficulty.Error()
+		return verification
+	}
+	target := new(big.Int).Div(two256, header.Difficulty)
+	verification.Target = common.BytesToHash(target.Bytes())
+
+	// Fake proof-of-work accepts any seal, just as on submission
+	if hmhash.config.PowMode == ModeFake || hmhash.config.PowMode == ModeFullFake || hmhash.config.PowMode == ModeSimulated || hmhash.config.PowMode == ModeBenchmark {
+		if err := hmhash.verifySeal(context.Background(), nil, header, false); err != nil {
+			verification.Reason = err.Error()
+			return verification
+		}
+		verification.Valid = true
+		return verification
+	}
+	digest, result := hmhash.computeSeal(hmhash.sealRules.Load(), header, false)
+	verification.MixDigest = common.BytesToHash(digest)
+	verification.Result = common.BytesToHash(result)
+
+	switch {
+	case !bytes.Equal(mixDigest[:], digest):
+		verification.Reason = errInvalidMixDigest.Error()
+	case new(big.Int).SetBytes(result).Cmp(target) > 0:
+		verification.Reason = errInvalidPoW.Error()
+	default:
+		verification.Valid = true
+	}
+	return verification
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that solutions to the current and stale work are checked without being
+// submitted, with the reason of the failures.
+func TestVerifyWork(t *testing.T) {
+	hmhash := NewTester(nil, false)
+	defer hmhash.Close()
+	hmhash.SetThreads(-1)
+
+	header := &types.Header{ParentHash: common.Hash{0x01}, Number: big.NewInt(1), Difficulty: big.NewInt(10)}
+	results := make(chan *types.Block, 1)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), results, nil)
+	sealhash := hmhash.SealHash(header)
+
+	// Search a nonce sealing the block and one that doesn't
+	var (
+		target      = new(big.Int).Div(two256, header.Difficulty)
+		valid, low  types.BlockNonce
+		digest, bad common.Hash
+		foundValid  bool
+		foundLow    bool
+	)
+	for nonce := uint64(0); !foundValid || !foundLow; nonce++ {
+		header.Nonce = types.EncodeNonce(nonce)
+		mix, result := hmhash.computeSeal(nil, header, false)
+		if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
+			if !foundValid {
+				valid, digest, foundValid = header.Nonce, common.BytesToHash(mix), true
+			}
+		} else if !foundLow {
+			low, bad, foundLow = header.Nonce, common.BytesToHash(mix), true
+		}
+	}
+	if v := hmhash.VerifyWork(sealhash, valid, digest); !v.Valid || !v.Current || v.Reason != "" || v.MixDigest != digest || uint64(*v.Number) != 1 {
+		t.Errorf("valid solution mismatch: %+v", v)
+	}
+	if v := hmhash.VerifyWork(sealhash, valid, common.Hash{0xff}); v.Valid || v.Reason != errInvalidMixDigest.Error() || v.MixDigest != digest {
+		t.Errorf("bad mix digest mismatch: %+v", v)
+	}
+	if v := hmhash.VerifyWork(sealhash, low, bad); v.Valid || v.Reason != errInvalidPoW.Error() {
+		t.Errorf("low difficulty mismatch: %+v", v)
+	}
+	if v := hmhash.VerifyWork(common.Hash{0x02}, valid, digest); v.Valid || v.Reason != errUnknownWork.Error() || v.Number != nil {
+		t.Errorf("unknown work mismatch: %+v", v)
+	}
+	// Newer work leaves the solution valid for the stale work, nothing is submitted
+	hmhash.Seal(nil, types.NewBlockWithHeader(&types.Header{ParentHash: common.Hash{0x01}, Number: big.NewInt(1), Difficulty: big.NewInt(11)}), results, nil)
+	if v := hmhash.VerifyWork(sealhash, valid, digest); !v.Valid || v.Current {
+		t.Errorf("stale solution mismatch: %+v", v)
+	}
+	select {
+	case block := <-results:
+		t.Errorf("verified solution submitted: %x", block.Hash())
+	default:
+	}
+}
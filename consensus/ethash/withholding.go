@@ -0,0 +1,153 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// defaultWithholdWindow is the period over which the blocks found by a worker
+	// are compared to its shares if the config leaves it unset.
+	defaultWithholdWindow = 24 * time.Hour
+
+	// defaultWithholdSignificance is the probability of finding as few blocks
+	// as a worker did below which it is suspected of withholding them if the
+	// config leaves it unset.
+	defaultWithholdSignificance = 0.001
+)
+
+// withholdingMeter counts the windows in which a worker was suspected of
+// withholding blocks.
+var withholdingMeter = metrics.NewRegisteredMeter("hmhash/shares/withholding", nil)
+
+// WithholdingSuspected is posted when a named remote worker found improbably few
+// blocks for the shares it submitted in a window, a pattern of block-withholding
+// attacks against pools, which submit shares but drop the solutions meeting the
+// block target.
+type WithholdingSuspected struct {
+	Worker      string
+	Start       time.Time // Start of the window
+	End         time.Time // End of the window
+	Shares      uint64    // Shares submitted by the worker in the window
+	Expected    float64   // Blocks expected from the difficulty of the shares
+	Blocks      uint64    // Blocks found by the worker in the window
+	Probability float64   // Probability of finding as few blocks without withholding
+}
+
+// withholdWindow accumulates the shares and blocks of a worker in the current
+// window.
+type withholdWindow struct {
+	start    time.Time
+	shares   uint64
+	expected float64 // Blocks expected from the shares so far
+	blocks   uint64
+}
+
+// withholdMonitor compares the blocks found by the named remote workers to the
+// number expected from their shares. Each share of difficulty s mined for a
+// block of difficulty d also seals the block with probability s/d, so the
+// blocks found in a window are Poisson distributed around the sum of those. It's
+// only accessed from the remote sealer loop, so it needs no locking.
+type withholdMonitor struct {
+	window       time.Duration
+	significance float64
+	windows      map[string]*withholdWindow // Open windows by worker name
+}
+
+// newWithholdMonitor creates a withholding monitor, using the defaults for a
+// zero window or significance.
+func newWithholdMonitor(window time.Duration, significance float64) *withholdMonitor {
+	if window <= 0 {
+		window = defaultWithholdWindow
+	}
+	if significance <= 0 {
+		significance = defaultWithholdSignificance
+	}
+	return &withholdMonitor{
+		window:       window,
+		significance: significance,
+		windows:      make(map[string]*withholdWindow),
+	}
+}
+
+// share records a share of the given difficulty submitted by a worker for a
+// block of the given difficulty, and whether it also sealed the block.
+func (m *withholdMonitor) share(worker string, share, block *big.Int, sealed bool, now time.Time) {
+	w := m.windows[worker]
+	if w == nil {
+		w = &withholdWindow{start: now}
+		m.windows[worker] = w
+	}
+	ratio, _ := new(big.Rat).SetFrac(share, block).Float64()
+	w.shares++
+	w.expected += math.Min(ratio, 1)
+	if sealed {
+		w.blocks++
+	}
+}
+
+// check closes the windows which lasted the monitoring period, returning the
+// workers suspected of withholding blocks in them.
+func (m *withholdMonitor) check(now time.Time) []WithholdingSuspected {
+	var suspects []WithholdingSuspected
+	for worker, w := range m.windows {
+		if now.Sub(w.start) < m.window {
+			continue
+		}
+		delete(m.windows, worker)
+
+		if p := poissonCDF(w.blocks, w.expected); p < m.significance {
+			suspects = append(suspects, WithholdingSuspected{
+				Worker:      worker,
+				Start:       w.start,
+				End:         now,
+				Shares:      w.shares,
+				Expected:    w.expected,
+				Blocks:      w.blocks,
+				Probability: p,
+			})
+		}
+	}
+	return suspects
+}
+
+// poissonCDF returns the probability of a Poisson distributed variable of the
+// given mean being at most k, summing the terms in log space not to underflow
+// for large means.
+func poissonCDF(k uint64, mean float64) float64 {
+	if mean <= 0 {
+		return 1
+	}
+	var p float64
+	for i := uint64(0); i <= k; i++ {
+		lgamma, _ := math.Lgamma(float64(i) + 1)
+		p += math.Exp(float64(i)*math.Log(mean) - mean - lgamma)
+	}
+	return math.Min(p, 1)
+}
+
+// SubscribeWithholdingSuspected registers a subscription for the named remote
+// workers suspected of withholding blocks, monitored if share accounting is
+// enabled.
+func (hmhash *Hmhash) SubscribeWithholdingSuspected(ch chan<- WithholdingSuspected) event.Subscription {
+	return hmhash.events.scope.Track(hmhash.events.withhold.Subscribe(ch))
+}
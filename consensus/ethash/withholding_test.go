@@ -0,0 +1,91 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Tests the cumulative Poisson probabilities against known values.
+func TestPoissonCDF(t *testing.T) {
+	tests := []struct {
+		k    uint64
+		mean float64
+		want float64
+	}{
+		{0, 0, 1},
+		{0, 1, math.Exp(-1)},
+		{1, 1, 2 * math.Exp(-1)},
+		{2, 3, 8.5 * math.Exp(-3)},
+		{0, 1000, 0},
+		{2000, 1000, 1},
+	}
+	for i, tt := range tests {
+		if have := poissonCDF(tt.k, tt.mean); math.Abs(have-tt.want) > 1e-9 {
+			t.Errorf("test %d: P(X <= %d | %v) mismatch: have %v, want %v", i, tt.k, tt.mean, have, tt.want)
+		}
+	}
+}
+
+// Tests that the withholding monitor suspects the workers finding improbably
+// few blocks for their shares.
+func TestWithholdMonitor(t *testing.T) {
+	var (
+		monitor = newWithholdMonitor(time.Hour, 0.001)
+		now     = time.Now()
+		share   = big.NewInt(10)
+		block   = big.NewInt(1000)
+	)
+	// Both workers submit shares expecting 10 blocks, the honest one finding 9
+	for i := 0; i < 1000; i++ {
+		monitor.share("honest", share, block, i%111 == 0, now)
+		monitor.share("withholder", share, block, false, now)
+	}
+	if suspects := monitor.check(now.Add(time.Hour - time.Second)); len(suspects) != 0 {
+		t.Fatalf("suspects before the end of the window: %+v", suspects)
+	}
+	suspects := monitor.check(now.Add(time.Hour))
+	if len(suspects) != 1 {
+		t.Fatalf("suspects mismatch: have %+v", suspects)
+	}
+	if s := suspects[0]; s.Worker != "withholder" || s.Shares != 1000 || math.Abs(s.Expected-10) > 1e-9 || s.Blocks != 0 || math.Abs(s.Probability-math.Exp(-10)) > 1e-12 {
+		t.Errorf("suspect mismatch: %+v", s)
+	}
+	if len(monitor.windows) != 0 {
+		t.Errorf("closed windows kept: %d", len(monitor.windows))
+	}
+}
+
+// Tests that the withholding suspicions are delivered to the subscribers.
+func TestWithholdingSubscription(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, ShareDifficulty: 10}, nil, true)
+	defer hmhash.Close()
+
+	ch := make(chan WithholdingSuspected, 1)
+	sub := hmhash.SubscribeWithholdingSuspected(ch)
+	defer sub.Unsubscribe()
+
+	if hmhash.remote.withhold == nil {
+		t.Fatalf("withholding not monitored with share accounting")
+	}
+	hmhash.events.withhold.Send(WithholdingSuspected{Worker: "rig"})
+	if ev := <-ch; ev.Worker != "rig" {
+		t.Errorf("event mismatch: %+v", ev)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// remoteHashrateTimeout is the time the hashrate submitted by a remote worker
+	// is counted, and the worker considered alive, after its last report.
+	remoteHashrateTimeout = 10 * time.Second
+
+	// defaultWorkerExpiry is the time a remote worker is kept on the roster after
+	// it was last seen if the config leaves it unset.
+	defaultWorkerExpiry = 10 * time.Minute
+)
+
+// RemoteWorker is the roster entry of a remote worker, so pool proxies can
+// detect dead rigs.
+type RemoteWorker struct {
+	ID       string         `json:"id"`       // Worker name, or the hashrate id or IP address of anonymous miners
+	Alive    bool           `json:"alive"`    // Whether the worker was seen within the hashrate timeout
+	LastSeen time.Time      `json:"lastSeen"` // Time of the last hashrate report or solution of the worker
+	Hashrate hexutil.Uint64 `json:"hashrate"` // Hash rate last reported by the worker
+	Accepted uint64         `json:"accepted"` // Solutions of the worker accepted
+	Rejected uint64         `json:"rejected"` // Solutions of the worker rejected as invalid, stale or duplicate
+}
+
+// workerRoster tracks the remote workers seen by the remote sealer. It's only
+// accessed from the sealer loop, so it needs no locking.
+type workerRoster struct {
+	expiry  time.Duration            // Time a worker is kept after it was last seen
+	workers map[string]*RemoteWorker // Roster entries by worker id
+}
+
+// newWorkerRoster creates a roster expiring workers not seen for the given time,
+// or the default if zero.
+func newWorkerRoster(expiry time.Duration) *workerRoster {
+	if expiry <= 0 {
+		expiry = defaultWorkerExpiry
+	}
+	return &workerRoster{
+		expiry:  expiry,
+		workers: make(map[string]*RemoteWorker),
+	}
+}
+
+// seen returns the roster entry of a worker, adding it if unknown, and marks it
+// as seen at the given time.
+func (r *workerRoster) seen(id string, now time.Time) *RemoteWorker {
+	worker := r.workers[id]
+	if worker == nil {
+		worker = &RemoteWorker{ID: id}
+		r.workers[id] = worker
+	}
+	worker.LastSeen = now
+	return worker
+}
+
+// report records the hash rate reported by a worker.
+func (r *workerRoster) report(id string, rate uint64, now time.Time) {
+	r.seen(id, now).Hashrate = hexutil.Uint64(rate)
+}
+
+// submit records a solution submitted by a worker.
+func (r *workerRoster) submit(id string, accepted bool, now time.Time) {
+	if id == "" {
+		return
+	}
+	worker := r.seen(id, now)
+	if accepted {
+		worker.Accepted++
+	} else {
+		worker.Rejected++
+	}
+}
+
+// expire drops the workers not seen within the expiry time, returning the
+// number of workers dropped.
+func (r *workerRoster) expire(now time.Time) int {
+	var dropped int
+	for id, worker := range r.workers {
+		if now.Sub(worker.LastSeen) > r.expiry {
+			delete(r.workers, id)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// list returns a copy of the roster sorted by worker id.
+func (r *workerRoster) list(now time.Time) []RemoteWorker {
+	workers := make([]RemoteWorker, 0, len(r.workers))
+	for _, worker := range r.workers {
+		cpy := *worker
+		cpy.Alive = now.Sub(worker.LastSeen) <= remoteHashrateTimeout
+		workers = append(workers, cpy)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers
+}
+
+// Workers returns the roster of the remote workers seen within the worker
+// expiry time.
+func (hmhash *Hmhash) Workers() []RemoteWorker {
+	if hmhash.shared != nil {
+		return hmhash.shared.Workers()
+	}
+	if hmhash.remote == nil {
+		return nil
+	}
+	req := make(chan []RemoteWorker, 1)
+	select {
+	case hmhash.remote.rosterCh <- req:
+	case <-hmhash.remote.exitCh:
+		return nil
+	}
+	return <-req
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package ethash
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that the roster tracks the liveness of the workers and expires the
+// stale ones.
+func TestWorkerRoster(t *testing.T) {
+	var (
+		roster = newWorkerRoster(time.Minute)
+		now    = time.Now()
+	)
+	roster.report("rig", 100, now)
+	roster.submit("rig", true, now)
+	roster.submit("rig", false, now.Add(remoteHashrateTimeout))
+	roster.submit("dead", true, now)
+	roster.submit("", true, now) // Anonymous aux submissions aren't tracked
+
+	list := roster.list(now.Add(2 * remoteHashrateTimeout))
+	if len(list) != 2 {
+		t.Fatalf("roster size mismatch: have %d, want 2", len(list))
+	}
+	if w := list[0]; w.ID != "dead" || w.Alive || w.Accepted != 1 {
+		t.Errorf("dead worker mismatch: %+v", w)
+	}
+	if w := list[1]; w.ID != "rig" || !w.Alive || w.Hashrate != 100 || w.Accepted != 1 || w.Rejected != 1 {
+		t.Errorf("live worker mismatch: %+v", w)
+	}
+	if dropped := roster.expire(now.Add(time.Minute + remoteHashrateTimeout/2)); dropped != 1 {
+		t.Errorf("expired workers mismatch: have %d, want 1", dropped)
+	}
+	if list := roster.list(now); len(list) != 1 || list[0].ID != "rig" {
+		t.Errorf("roster after expiry mismatch: %+v", list)
+	}
+}
+
+// Tests that the remote sealer puts the workers submitting hashrates and
+// solutions on the roster.
+func TestRemoteWorkers(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest}, nil, true)
+	defer hmhash.Close()
+
+	var (
+		api    = &API{hmhash}
+		header = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	)
+	hmhash.Seal(nil, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil)
+	if _, err := api.GetWork(context.Background()); err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	if !api.SubmitHashrate(context.Background(), 500, common.Hash{1}, nil, nil, nil) {
+		t.Fatalf("hashrate rejected")
+	}
+	if !api.submitWork(types.EncodeNonce(1), hmhash.SealHash(header), common.Hash{}, "rig") {
+		t.Fatalf("solution rejected")
+	}
+	api.submitWork(types.EncodeNonce(2), common.Hash{1}, common.Hash{}, "rig")
+
+	workers := (&MiningAPI{hmhash}).GetWorkers()
+	if len(workers) != 2 {
+		t.Fatalf("roster size mismatch: have %+v", workers)
+	}
+	if w := workers[0]; w.ID != (common.Hash{1}).Hex() || !w.Alive || w.Hashrate != 500 {
+		t.Errorf("hashrate reporter mismatch: %+v", w)
+	}
+	if w := workers[1]; w.ID != "rig" || !w.Alive || w.Accepted != 1 || w.Rejected != 1 {
+		t.Errorf("solution submitter mismatch: %+v", w)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// WorkVersion is the version of the work package format handed out to remote
+// miners, bumped on changes existing miners may not understand.
+const WorkVersion = 1
+
+// Capabilities of the remote sealer advertised along the work packages. A
+// capability carrying a value is advertised as "<name>=<value>".
+const (
+	CapExtranonce    = "extranonce"     // Nonce prefixes are leased to stratum connections and gRPC streams
+	CapProgpowPeriod = "progpow-period" // Blocks switch to ProgPoW, valued with the blocks per program
+	CapBoundaryBE256 = "boundary-be256" // Boundaries are 256 bit big endian hex numbers
+	CapEpochAnnounce = "epoch-announce" // Upcoming epochs are announced, valued with the blocks ahead
+	CapCPUPoW        = "cpupow"         // Blocks switch to the CPU proof-of-work, valued with the switch block
+)
+
+// HTTP headers of the work notifications carrying the version and capabilities,
+// as full header notifications have no room for them in the payload.
+const (
+	workVersionHeader      = "X-Hmhash-Work-Version"
+	workCapabilitiesHeader = "X-Hmhash-Work-Capabilities"
+)
+
+// WorkCapabilities returns the capabilities of the remote sealer. The rule
+// switches are those of the chain last sealed on.
+func (hmhash *Hmhash) WorkCapabilities() []string {
+	rules := hmhash.sealRules.Load()
+	caps := []string{CapBoundaryBE256}
+	if hmhash.config.ExtranonceBytes > 0 {
+		caps = append(caps, CapExtranonce)
+	}
+	if hmhash.config.EpochAnnounceDistance > 0 {
+		caps = append(caps, CapEpochAnnounce+"="+strconv.FormatUint(hmhash.config.EpochAnnounceDistance, 10))
+	}
+	if rules != nil && rules.ProgpowBlock != nil {
+		caps = append(caps, CapProgpowPeriod+"="+strconv.Itoa(progpowPeriod))
+	}
+	if rules != nil && rules.CPUPoWBlock != nil {
+		caps = append(caps, CapCPUPoW+"="+rules.CPUPoWBlock.String())
+	}
+	return caps
+}
+
+// versionWork extends a work package with the work package version and the
+// comma separated capabilities of the remote sealer. Miners reading only the
+// leading fields are unaffected.
+func (hmhash *Hmhash) versionWork(work [4]string) []string {
+	return append(work[:], hexutil.EncodeUint64(WorkVersion), strings.Join(hmhash.WorkCapabilities(), ","))
+}
+
+// workHeader returns the HTTP headers announcing the work package version and
+// capabilities with the work notifications.
+func (hmhash *Hmhash) workHeader() http.Header {
+	header := make(http.Header)
+	header.Set(workVersionHeader, strconv.Itoa(WorkVersion))
+	header.Set(workCapabilitiesHeader, strings.Join(hmhash.WorkCapabilities(), ","))
+	return header
+}
+
+// negotiateCapabilities returns the capabilities of the remote sealer a miner
+// requested, all of them if it didn't request any. Capabilities are matched by
+// name, so a miner needn't know their values.
+func (hmhash *Hmhash) negotiateCapabilities(requested []string) []string {
+	supported := hmhash.WorkCapabilities()
+	if len(requested) == 0 {
+		return supported
+	}
+	caps := []string{}
+	for _, capability := range supported {
+		name, _, _ := strings.Cut(capability, "=")
+		for _, want := range requested {
+			if want, _, _ = strings.Cut(want, "="); want == name {
+				caps = append(caps, capability)
+				break
+			}
+		}
+	}
+	return caps
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that work packages carry the version and capabilities, both when
+// fetched and when notified.
+func TestWorkVersion(t *testing.T) {
+	type notification struct {
+		work   []string
+		header http.Header
+	}
+	sink := make(chan notification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var work []string
+		if err := json.NewDecoder(req.Body).Decode(&work); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		sink <- notification{work, req.Header}
+	}))
+	defer server.Close()
+
+	hmhash := New(Config{PowMode: ModeTest, ExtranonceBytes: 2}, []string{server.URL}, false)
+	defer hmhash.Close()
+
+	caps := "boundary-be256,extranonce"
+	if have := hmhash.WorkCapabilities(); !reflect.DeepEqual(have, []string{CapBoundaryBE256, CapExtranonce}) {
+		t.Fatalf("capabilities mismatch: have %v", have)
+	}
+	hmhash.Seal(nil, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}), nil, nil)
+
+	select {
+	case n := <-sink:
+		if len(n.work) != 6 || n.work[4] != hexutil.EncodeUint64(WorkVersion) || n.work[5] != caps {
+			t.Errorf("notified work mismatch: %v", n.work)
+		}
+		if have := n.header.Get(workVersionHeader); have != strconv.Itoa(WorkVersion) {
+			t.Errorf("version header mismatch: have %q", have)
+		}
+		if have := n.header.Get(workCapabilitiesHeader); have != caps {
+			t.Errorf("capabilities header mismatch: have %q, want %q", have, caps)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("work notification not delivered")
+	}
+	work, err := (&API{hmhash}).GetWork(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	if len(work) != 6 || work[4] != hexutil.EncodeUint64(WorkVersion) || work[5] != caps {
+		t.Errorf("work mismatch: %v", work)
+	}
+}
+
+// Tests that stratum miners can negotiate the capabilities of the work packages.
+func TestStratumConfigure(t *testing.T) {
+	hmhash := New(Config{PowMode: ModeTest, StratumAddr: "127.0.0.1:0"}, nil, false)
+	defer hmhash.Close()
+
+	client := dialStratum(t, hmhash.stratum.listener.Addr().String())
+	defer client.conn.Close()
+
+	tests := []struct {
+		requested []interface{}
+		want      []interface{}
+	}{
+		{nil, []interface{}{CapBoundaryBE256}},
+		{[]interface{}{[]string{"extranonce", "boundary-be256=1"}}, []interface{}{CapBoundaryBE256}},
+		{[]interface{}{[]string{"unknown"}}, []interface{}{}},
+	}
+	for i, tt := range tests {
+		res := client.call("mining.configure", tt.requested...)
+		result, ok := res["result"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("test %d: configuration failed: %v", i, res["error"])
+		}
+		if result["version"] != float64(WorkVersion) {
+			t.Errorf("test %d: version mismatch: have %v, want %d", i, result["version"], WorkVersion)
+		}
+		if !reflect.DeepEqual(result["capabilities"], tt.want) {
+			t.Errorf("test %d: capabilities mismatch: have %v, want %v", i, result["capabilities"], tt.want)
+		}
+	}
+	if res := client.call("mining.configure", "extranonce"); res["error"] == nil {
+		t.Errorf("malformed configuration accepted")
+	}
+}
@@ -1728,6 +1728,13 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 		if err != nil {
 			return it.index, err
 		}
+		// Verify the consensus rules depending on the state of the parent
+		if verifier, ok := bc.engine.(consensus.StateVerifier); ok {
+			if err := verifier.VerifyState(bc, block.Header(), statedb); err != nil {
+				bc.reportBlock(block, nil, err)
+				return it.index, err
+			}
+		}
 
 		// Enable prefetching to pull in trie node paths while processing transactions
 		statedb.StartPrefetcher("chain")
@@ -1776,6 +1783,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 		// Validate the state using the default validator
 		substart = time.Now()
 		if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
+			if diagnoser, ok := bc.engine.(consensus.StateDiagnoser); ok && (errors.Is(err, ErrStateRootMismatch) || errors.Is(err, ErrReceiptRootMismatch)) {
+				diagnoser.DiagnoseState(bc, block, err)
+			}
 			bc.reportBlock(block, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
 			return it.index, err
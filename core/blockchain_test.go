@@ -4340,3 +4340,40 @@ func TestEIP3651(t *testing.T) {
 		t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	}
 }
+
+// diagnosingEngine is a consensus engine recording the blocks it is asked to
+// diagnose a state mismatch of.
+type diagnosingEngine struct {
+	consensus.Engine
+	diagnosed []error
+}
+
+func (e *diagnosingEngine) DiagnoseState(chain consensus.ChainHeaderReader, block *types.Block, err error) {
+	e.diagnosed = append(e.diagnosed, err)
+}
+
+// Tests that the engine is asked to diagnose blocks failing on a state root
+// mismatch.
+func TestStateDiagnoser(t *testing.T) {
+	genesis := &Genesis{
+		BaseFee: big.NewInt(params.InitialBaseFee),
+		Config:  params.AllEthashProtocolChanges,
+	}
+	_, blocks, _ := GenerateChainWithGenesis(genesis, ethash.NewFaker(), 1, nil)
+
+	engine := &diagnosingEngine{Engine: ethash.NewFaker()}
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), nil, genesis, nil, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	header := blocks[0].Header()
+	header.Root = common.Hash{0x01}
+	if _, err := chain.InsertChain(types.Blocks{blocks[0].WithSeal(header)}); !errors.Is(err, ErrStateRootMismatch) {
+		t.Fatalf("insert error mismatch: have %v, want %v", err, ErrStateRootMismatch)
+	}
+	if len(engine.diagnosed) != 1 || !errors.Is(engine.diagnosed[0], ErrStateRootMismatch) {
+		t.Errorf("diagnosed mismatches: %v", engine.diagnosed)
+	}
+}
@@ -32,6 +32,14 @@ var (
 	// ErrNoGenesis is returned when there is no Genesis Block.
 	ErrNoGenesis = errors.New("genesis not found in chain")
 
+	// ErrReceiptRootMismatch is returned if the receipts of a processed block
+	// don't derive the receipt root of its header.
+	ErrReceiptRootMismatch = errors.New("invalid receipt root hash")
+
+	// ErrStateRootMismatch is returned if the state of a processed block doesn't
+	// match the state root of its header.
+	ErrStateRootMismatch = errors.New("invalid merkle root")
+
 	errSideChainReceipts = errors.New("side blocks can't be accepted as ancient chain data")
 )
 
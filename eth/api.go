@@ -36,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
@@ -129,11 +130,100 @@ func (api *MinerAPI) SetEtherbase(etherbase common.Address) bool {
 	return true
 }
 
+// SetCoinbaseRotation splits the block rewards across several coinbase
+// addresses, chosen in turn per block or by weight, or credits them all to the
+// etherbase again if the rotation is null.
+func (api *MinerAPI) SetCoinbaseRotation(rotation *miner.CoinbaseRotation) (bool, error) {
+	if err := api.e.Miner().SetCoinbaseRotation(rotation); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetCoinbaseRotation returns the rotation of the block rewards, null if they
+// are all credited to the etherbase.
+func (api *MinerAPI) GetCoinbaseRotation() *miner.CoinbaseRotation {
+	return api.e.Miner().CoinbaseRotation()
+}
+
+// GetBlockTemplate returns a complete block on top of the chain head for
+// external mining software to seal, including the pool transactions of the
+// given hashes in order, or the pending ones if omitted.
+func (api *MinerAPI) GetBlockTemplate(hashes *[]common.Hash) (*miner.BlockTemplate, error) {
+	if hashes == nil {
+		return api.e.Miner().BlockTemplate(nil)
+	}
+	txs := make(types.Transactions, len(*hashes))
+	for i, hash := range *hashes {
+		if txs[i] = api.e.TxPool().Get(hash); txs[i] == nil {
+			return nil, fmt.Errorf("transaction %x not found in the pool", hash)
+		}
+	}
+	return api.e.Miner().BlockTemplate(txs)
+}
+
+// SubmitBlock imports and broadcasts the RLP encoded block sealed from a block
+// template, returning its hash.
+func (api *MinerAPI) SubmitBlock(blob hexutil.Bytes) (common.Hash, error) {
+	block, err := submitBlock(api.e, blob)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Hash(), nil
+}
+
+// submitBlock decodes an RLP encoded sealed block, then validates, imports and
+// broadcasts it through the miner.
+func submitBlock(e *Ethereum, blob hexutil.Bytes) (*types.Block, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(blob, block); err != nil {
+		return nil, err
+	}
+	if err := e.Miner().SubmitBlock(block); err != nil {
+		log.Debug("Rejected submitted block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return nil, err
+	}
+	return block, nil
+}
+
 // SetRecommitInterval updates the interval for miner sealing work recommitting.
 func (api *MinerAPI) SetRecommitInterval(interval int) {
 	api.e.Miner().SetRecommitInterval(time.Duration(interval) * time.Millisecond)
 }
 
+// BuilderAPI accepts blocks assembled by external block builders, for proposer
+// and builder separation.
+type BuilderAPI struct {
+	e *Ethereum
+}
+
+// NewBuilderAPI creates a new BuilderAPI instance.
+func NewBuilderAPI(e *Ethereum) *BuilderAPI {
+	return &BuilderAPI{e}
+}
+
+// SubmittedBlock is the outcome of a block submitted by an external builder.
+type SubmittedBlock struct {
+	Hash      common.Hash    `json:"hash"`
+	Number    hexutil.Uint64 `json:"number"`
+	Canonical bool           `json:"canonical"` // Whether the block became the chain head rather than a side block
+}
+
+// SubmitBlock validates the RLP encoded sealed block of an external builder
+// against the consensus rules, its seal and the state transition, then imports
+// and broadcasts it.
+func (api *BuilderAPI) SubmitBlock(blob hexutil.Bytes) (*SubmittedBlock, error) {
+	block, err := submitBlock(api.e, blob)
+	if err != nil {
+		return nil, err
+	}
+	return &SubmittedBlock{
+		Hash:      block.Hash(),
+		Number:    hexutil.Uint64(block.NumberU64()),
+		Canonical: api.e.BlockChain().GetCanonicalHash(block.NumberU64()) == block.Hash(),
+	}, nil
+}
+
 // AdminAPI is the collection of Ethereum full node related APIs for node
 // administration.
 type AdminAPI struct {
@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/beacon"
 	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -202,6 +203,9 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := ethconfig.CheckPowMode(config.Ethash.PowMode, eth.blockchain.Genesis().Hash()); err != nil {
+		return nil, err
+	}
 	eth.bloomIndexer.Start(eth.blockchain)
 
 	if config.TxPool.Journal != "" {
@@ -301,6 +305,9 @@ func (s *Ethereum) APIs() []rpc.API {
 		}, {
 			Namespace: "miner",
 			Service:   NewMinerAPI(s),
+		}, {
+			Namespace: "hmhash",
+			Service:   NewBuilderAPI(s),
 		}, {
 			Namespace: "eth",
 			Service:   downloader.NewDownloaderAPI(s.handler.downloader, s.eventMux),
@@ -350,6 +357,16 @@ func (s *Ethereum) isLocalBlock(header *types.Header) bool {
 	if author == etherbase {
 		return true
 	}
+	// Check whether the given address is rotated in as coinbase.
+	if s.miner != nil {
+		if rotation := s.miner.CoinbaseRotation(); rotation != nil {
+			for _, addr := range rotation.Addresses {
+				if addr == author {
+					return true
+				}
+			}
+		}
+	}
 	// Check whether the given address is specified by `txpool.local`
 	// CLI flag.
 	for _, account := range s.config.TxPool.Locals {
@@ -440,6 +457,24 @@ func (s *Ethereum) StartMining(threads int) error {
 			}
 			cli.Authorize(eb, wallet.SignData)
 		}
+		// Hybrid chains need the etherbase key to seal validator blocks, but
+		// plain proof-of-work miners don't have to be validators
+		var hmh *ethash.Hmhash
+		if h, ok := s.engine.(*ethash.Hmhash); ok {
+			hmh = h
+		} else if cl, ok := s.engine.(*beacon.Beacon); ok {
+			if h, ok := cl.InnerEngine().(*ethash.Hmhash); ok {
+				hmh = h
+			}
+		}
+		if config := s.blockchain.Config(); hmh != nil && config.Ethash != nil && config.Ethash.Hybrid != nil {
+			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+			if wallet == nil || err != nil {
+				log.Warn("Etherbase account unavailable locally, not sealing validator blocks", "err", err)
+			} else {
+				hmh.Authorize(eb, wallet.SignData)
+			}
+		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
 		atomic.StoreUint32(&s.handler.acceptTxs, 1)
@@ -18,8 +18,10 @@
 package ethconfig
 
 import (
+	"errors"
 	"os"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -32,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/txpool"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/eth/payouts"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/miner"
@@ -61,8 +64,18 @@ var LightClientGPO = gasprice.Config{
 
 // Defaults contains default settings for use on the Ethereum main net.
 var Defaults = Config{
-	SyncMode:                downloader.SnapSync,
-	Ethash:                  ethash.Config{},
+	SyncMode: downloader.SnapSync,
+	Ethash: ethash.Config{
+		CacheDir:              "hmhash",
+		CachesInMem:           2,
+		CachesOnDisk:          3,
+		CachesLockMmap:        false,
+		DatasetsInMem:         1,
+		DatasetsOnDisk:        2,
+		DatasetsLockMmap:      false,
+		PregenerationDistance: 1000,
+		SealCacheSize:         4096,
+	},
 	NetworkId:               1,
 	TxLookupLimit:           2350000,
 	LightPeers:              100,
@@ -91,15 +104,16 @@ func init() {
 		}
 	}
 	if runtime.GOOS == "darwin" {
+		Defaults.Ethash.DatasetDir = filepath.Join(home, "Library", "Hmhash")
 	} else if runtime.GOOS == "windows" {
 		localappdata := os.Getenv("LOCALAPPDATA")
 		if localappdata != "" {
-
+			Defaults.Ethash.DatasetDir = filepath.Join(localappdata, "Hmhash")
 		} else {
-
+			Defaults.Ethash.DatasetDir = filepath.Join(home, "AppData", "Local", "Hmhash")
 		}
 	} else {
-
+		Defaults.Ethash.DatasetDir = filepath.Join(home, ".hmhash")
 	}
 }
 
@@ -167,6 +181,9 @@ type Config struct {
 	// Ethash options
 	Ethash ethash.Config
 
+	// Automatic payouts of the built-in hmhash pool
+	Payouts payouts.Config
+
 	// Transaction pool options
 	TxPool txpool.Config
 
@@ -199,6 +216,24 @@ type Config struct {
 	OverrideShanghai *uint64 `toml:",omitempty"`
 }
 
+// errPublicPowMode is returned if the engine is configured to skip the
+// proof-of-work verification of the blocks of a public network.
+var errPublicPowMode = errors.New("simulated and benchmark proof-of-work are only allowed on private networks")
+
+// CheckPowMode refuses the ethash modes accepting any seal on the built-in
+// public networks, where the node would import and relay blocks without valid
+// proof-of-work.
+func CheckPowMode(mode ethash.Mode, genesis common.Hash) error {
+	if mode != ethash.ModeSimulated && mode != ethash.ModeBenchmark {
+		return nil
+	}
+	switch genesis {
+	case params.MainnetGenesisHash, params.SepoliaGenesisHash, params.RinkebyGenesisHash, params.GoerliGenesisHash:
+		return errPublicPowMode
+	}
+	return nil
+}
+
 // CreateConsensusEngine creates a consensus engine for the given chain configuration.
 func CreateConsensusEngine(stack *node.Node, ethashConfig *ethash.Config, cliqueConfig *params.CliqueConfig, notify []string, noverify bool, db ethdb.Database) consensus.Engine {
 	// If proof-of-authority is requested, set it up
@@ -213,12 +248,109 @@ func CreateConsensusEngine(stack *node.Node, ethashConfig *ethash.Config, clique
 			log.Warn("Ethash used in test mode")
 		case ethash.ModeShared:
 			log.Warn("Ethash used in shared mode")
+		case ethash.ModeDeterministic:
+			log.Warn("Ethash used in deterministic mode")
+		case ethash.ModeSimulated:
+			log.Warn("Ethash used in simulated mode", "blocktime", ethashConfig.SimulatedBlockTime)
+		case ethash.ModeBenchmark:
+			log.Warn("Ethash used in benchmark mode")
 		}
 		engine = ethash.New(ethash.Config{
-			PowMode:    ethashConfig.PowMode,
-			NotifyFull: ethashConfig.NotifyFull,
+			PowMode:            ethashConfig.PowMode,
+			CacheDir:           stack.ResolvePath(ethashConfig.CacheDir),
+			CachesInMem:        ethashConfig.CachesInMem,
+			CachesOnDisk:       ethashConfig.CachesOnDisk,
+			CachesLockMmap:     ethashConfig.CachesLockMmap,
+			DatasetDir:         ethashConfig.DatasetDir,
+			DatasetsInMem:      ethashConfig.DatasetsInMem,
+			DatasetsOnDisk:     ethashConfig.DatasetsOnDisk,
+			DatasetsLockMmap:   ethashConfig.DatasetsLockMmap,
+			CacheInitBytes:     ethashConfig.CacheInitBytes,
+			CacheGrowthBytes:   ethashConfig.CacheGrowthBytes,
+			DatasetInitBytes:   ethashConfig.DatasetInitBytes,
+			DatasetGrowthBytes: ethashConfig.DatasetGrowthBytes,
+			DatasetFraction:    ethashConfig.DatasetFraction,
+			NUMA:               ethashConfig.NUMA,
+			MinerCPUs:          ethashConfig.MinerCPUs,
+			MinerNice:          ethashConfig.MinerNice,
+			NotifyFull:         ethashConfig.NotifyFull,
+			NotifyRetries:      ethashConfig.NotifyRetries,
+			NotifyQuarantine:   ethashConfig.NotifyQuarantine,
+			NotifyFile:         resolveOptionalPath(stack, ethashConfig.NotifyFile),
+			SubmitTokens:       ethashConfig.SubmitTokens,
+			SubmitRateLimit:    ethashConfig.SubmitRateLimit,
+			SubmitBanThreshold: ethashConfig.SubmitBanThreshold,
+			SubmitBanTime:      ethashConfig.SubmitBanTime,
+			RequestRateLimit:   ethashConfig.RequestRateLimit,
+			MaxRequestSize:     ethashConfig.MaxRequestSize,
+			SignedHashrate:     ethashConfig.SignedHashrate,
+			ClientTag:          ethashConfig.ClientTag,
+			WorkerExpiry:       ethashConfig.WorkerExpiry,
+			StratumAddr:        ethashConfig.StratumAddr,
+			HmwireAddr:       ethashConfig.HmwireAddr,
+			GRPCAddr:           ethashConfig.GRPCAddr,
+			GetworkAddr:        ethashConfig.GetworkAddr,
+			GetworkListeners:   ethashConfig.GetworkListeners,
+			GetworkCORS:        ethashConfig.GetworkCORS,
+			GetworkTimeouts:    ethashConfig.GetworkTimeouts,
+			MQTTBroker:         ethashConfig.MQTTBroker,
+			MQTTTopic:          ethashConfig.MQTTTopic,
+			MQTTQoS:            ethashConfig.MQTTQoS,
+			KafkaBrokers:       ethashConfig.KafkaBrokers,
+			KafkaTopic:         ethashConfig.KafkaTopic,
+			TraceExporter:      ethashConfig.TraceExporter,
+			TraceSampleRatio:   ethashConfig.TraceSampleRatio,
+			Transports:         ethashConfig.Transports,
+			TLSCert:            ethashConfig.TLSCert,
+			TLSKey:             ethashConfig.TLSKey,
+			TLSCA:              ethashConfig.TLSCA,
+			GPUDevices:         ethashConfig.GPUDevices,
+			HashAlgo:           ethashConfig.HashAlgo,
+			NonceStrategy:      ethashConfig.NonceStrategy,
+			StaleWorkWindow:    ethashConfig.StaleWorkWindow,
+			ExtranonceBytes:    ethashConfig.ExtranonceBytes,
+			SealCacheSize:      ethashConfig.SealCacheSize,
+			MaxReorgDepth:      ethashConfig.MaxReorgDepth,
+			ReorgAlertDepth:    ethashConfig.ReorgAlertDepth,
+			ForkRuleWindow:     ethashConfig.ForkRuleWindow,
+			ForkRuleThreshold:  ethashConfig.ForkRuleThreshold,
+			ChainWorkInterval:  ethashConfig.ChainWorkInterval,
+			DrainTimeout:       ethashConfig.DrainTimeout,
+			SealTimeout:        ethashConfig.SealTimeout,
+			WorkBuffer:         ethashConfig.WorkBuffer,
+			SimulatedBlockTime: ethashConfig.SimulatedBlockTime,
+			ShareDifficulty:    ethashConfig.ShareDifficulty,
+			VardiffRate:        ethashConfig.VardiffRate,
+			SharesDir:          resolveOptionalPath(stack, ethashConfig.SharesDir),
+			PayoutScheme:       ethashConfig.PayoutScheme,
+
+			PregenerationDistance: ethashConfig.PregenerationDistance,
+			EpochAnnounceDistance: ethashConfig.EpochAnnounceDistance,
+			GovernorImportLatency: ethashConfig.GovernorImportLatency,
+			GovernorRPCActive:     ethashConfig.GovernorRPCActive,
+			GovernorInterval:      ethashConfig.GovernorInterval,
+			HashrateResolution:    ethashConfig.HashrateResolution,
+			HashrateRetention:     ethashConfig.HashrateRetention,
+			ShareAuditWindow:      ethashConfig.ShareAuditWindow,
+			ShareAuditThreshold:   ethashConfig.ShareAuditThreshold,
+			WithholdWindow:        ethashConfig.WithholdWindow,
+			WithholdSignificance:  ethashConfig.WithholdSignificance,
+			PayoutMaturity:        ethashConfig.PayoutMaturity,
+			DiagnosticsDir:        resolveOptionalPath(stack, ethashConfig.DiagnosticsDir),
+			RecordingsDir:         resolveOptionalPath(stack, ethashConfig.RecordingsDir),
+			CheckpointPeers:       ethashConfig.CheckpointPeers,
+			CheckpointDB:          db,
 		}, notify, noverify)
 		engine.(*ethash.Hmhash).SetThreads(-1) // Disable CPU mining
 	}
 	return beacon.New(engine)
 }
+
+// resolveOptionalPath resolves a path within the instance directory of the node,
+// leaving it empty if unset instead of resolving it to the directory itself.
+func resolveOptionalPath(stack *node.Node, path string) string {
+	if path == "" {
+		return ""
+	}
+	return stack.ResolvePath(path)
+}
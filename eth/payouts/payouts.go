@@ -0,0 +1,373 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+// Package payouts implements the automatic on-chain payouts of the built-in
+// hmhash mining pool, paying the workers their balances of the payout ledger.
+package payouts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// defaultInterval is the number of blocks between payout runs if the config
+	// leaves it unset.
+	defaultInterval = 100
+
+	// defaultBatch is the maximum number of payout transactions sent in a run if
+	// the config leaves it unset.
+	defaultBatch = 100
+)
+
+// stateKey is the database key of the payout state.
+var stateKey = []byte("hmhash-pool-payouts")
+
+var (
+	errNotHmhash  = errors.New("pool payouts need the hmhash engine")
+	errNoGasPrice = errors.New("pool payouts need a gas price")
+	errNoWallet   = errors.New("pool payout account unavailable")
+	errNoChainID  = errors.New("pool payouts need a chain id")
+	errNoAccount  = errors.New("pool payouts need an account")
+)
+
+// Config is the configuration of the automatic pool payouts.
+type Config struct {
+	Account   common.Address // Keystore account paying the workers, which has to be unlocked; payouts are disabled if zero
+	Interval  uint64         // Blocks between payout runs, zero uses the default
+	Threshold *big.Int       `toml:",omitempty"` // Minimum balance paid out to a worker
+	GasPrice  *big.Int       `toml:",omitempty"` // Gas price of the payout transactions
+	Batch     int            // Maximum number of payout transactions of a run, zero uses the default
+}
+
+// Enabled returns whether automatic payouts are configured.
+func (c *Config) Enabled() bool {
+	return c.Account != (common.Address{})
+}
+
+// Backend is the node functionality the payout service needs, implemented by
+// the full Ethereum node.
+type Backend interface {
+	BlockChain() *core.BlockChain
+	TxPool() *txpool.TxPool
+	AccountManager() *accounts.Manager
+	Engine() consensus.Engine
+	ChainDb() ethdb.Database
+}
+
+// chainReader is the part of the chain the payouts follow.
+type chainReader interface {
+	Config() *params.ChainConfig
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+	GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLookupEntry
+	GetReceiptsByHash(hash common.Hash) types.Receipts
+}
+
+// txPool is the part of the transaction pool the payouts are sent to.
+type txPool interface {
+	Nonce(addr common.Address) uint64
+	AddLocal(tx *types.Transaction) error
+	Has(hash common.Hash) bool
+}
+
+// payoutState is the persisted progress of the payouts.
+type payoutState struct {
+	Number   uint64                      // Number of the last block whose round was credited
+	Balances map[common.Address]*big.Int // Credits not paid out yet
+	Pending  []*pendingPayout            // Payouts debited but not included yet
+}
+
+// pendingPayout is a payout transaction journaled before being sent, kept until
+// it is included or re-credited.
+type pendingPayout struct {
+	Nonce  uint64
+	To     common.Address
+	Amount *big.Int
+	Hash   common.Hash
+}
+
+// Service pays the workers of the built-in pool their balances of the payout
+// ledger every configured number of blocks, once they reach the threshold.
+// Workers are paid to the address they are named after, optionally followed
+// by a dot and the rig name, as is common for pools.
+type Service struct {
+	config Config
+	chain  chainReader
+	pool   txPool
+	db     ethdb.KeyValueStore
+	ledger func(from uint64) ([]ethash.PayoutRound, error)
+	sign   func(tx *types.Transaction) (*types.Transaction, error)
+
+	state *payoutState
+	next  uint64 // Number of the head triggering the next run
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates the payout service of a node, to be registered into its stack.
+func New(backend Backend, config Config) (*Service, error) {
+	if !config.Enabled() {
+		return nil, errNoAccount
+	}
+	engine := backend.Engine()
+	if b, ok := engine.(*beacon.Beacon); ok {
+		engine = b.InnerEngine()
+	}
+	hmhash, ok := engine.(*ethash.Hmhash)
+	if !ok {
+		return nil, errNotHmhash
+	}
+	chain := backend.BlockChain()
+	if chain.Config().ChainID == nil {
+		return nil, errNoChainID
+	}
+	account := accounts.Account{Address: config.Account}
+	wallet, err := backend.AccountManager().Find(account)
+	if err != nil {
+		return nil, errNoWallet
+	}
+	schedule := ethash.NewRewardSchedule(chain.Config())
+	ledger := func(from uint64) ([]ethash.PayoutRound, error) {
+		return hmhash.PayoutLedger(chain, from, func(number uint64) *big.Int {
+			return schedule.Reward(new(big.Int).SetUint64(number)).Reward
+		})
+	}
+	sign := func(tx *types.Transaction) (*types.Transaction, error) {
+		return wallet.SignTx(account, tx, chain.Config().ChainID)
+	}
+	return newService(config, chain, backend.TxPool(), backend.ChainDb(), ledger, sign)
+}
+
+// newService creates a payout service, restoring its persisted state.
+func newService(config Config, chain chainReader, pool txPool, db ethdb.KeyValueStore, ledger func(uint64) ([]ethash.PayoutRound, error), sign func(*types.Transaction) (*types.Transaction, error)) (*Service, error) {
+	if config.GasPrice == nil {
+		return nil, errNoGasPrice
+	}
+	if config.Interval == 0 {
+		config.Interval = defaultInterval
+	}
+	if config.Batch <= 0 {
+		config.Batch = defaultBatch
+	}
+	if config.Threshold == nil {
+		config.Threshold = new(big.Int)
+	}
+	s := &Service{
+		config: config,
+		chain:  chain,
+		pool:   pool,
+		db:     db,
+		ledger: ledger,
+		sign:   sign,
+		state:  &payoutState{Balances: make(map[common.Address]*big.Int)},
+		quit:   make(chan struct{}),
+	}
+	if blob, err := db.Get(stateKey); err == nil {
+		if err := json.Unmarshal(blob, s.state); err != nil {
+			return nil, err
+		}
+		if s.state.Balances == nil {
+			s.state.Balances = make(map[common.Address]*big.Int)
+		}
+	}
+	return s, nil
+}
+
+// Start implements node.Lifecycle, starting the payout runs on new chain heads.
+func (s *Service) Start() error {
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := s.chain.SubscribeChainHeadEvent(heads)
+
+	s.wg.Add(1)
+	go s.loop(heads, sub)
+	log.Info("Pool payouts enabled", "account", s.config.Account, "interval", s.config.Interval, "threshold", s.config.Threshold)
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the payout runs.
+func (s *Service) Stop() error {
+	close(s.quit)
+	s.wg.Wait()
+	return nil
+}
+
+// loop runs the payouts every configured number of blocks.
+func (s *Service) loop(heads chan core.ChainHeadEvent, sub event.Subscription) {
+	defer s.wg.Done()
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case head := <-heads:
+			number := head.Block.NumberU64()
+			if number < s.next {
+				continue
+			}
+			s.next = number + s.config.Interval
+			if err := s.run(number); err != nil {
+				log.Error("Failed to pay out pool rewards", "number", number, "err", err)
+			}
+		case <-sub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// run credits the workers with the mature rounds ended by blocks up to the
+// head and pays out the balances reaching the threshold. Crediting stops at the
+// first pending round, orphaned rounds are skipped.
+func (s *Service) run(head uint64) error {
+	s.settle()
+
+	rounds, err := s.ledger(s.state.Number + 1)
+	if err != nil {
+		return err
+	}
+	for _, round := range rounds {
+		if uint64(round.Number) > head || round.Status == ethash.RoundPending {
+			break
+		}
+		if round.Status == ethash.RoundOrphaned {
+			log.Warn("Skipping orphaned pool round", "number", uint64(round.Number), "hash", round.Hash)
+			s.state.Number = uint64(round.Number)
+			continue
+		}
+		for worker, amount := range round.Payouts {
+			addr, ok := workerAddress(worker)
+			if !ok {
+				log.Warn("Pool worker without payout address", "worker", worker, "number", uint64(round.Number), "amount", amount.ToInt())
+				continue
+			}
+			s.credit(addr, amount.ToInt())
+		}
+		s.state.Number = uint64(round.Number)
+	}
+	addrs := make([]common.Address, 0, len(s.state.Balances))
+	for addr := range s.state.Balances {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+
+	var (
+		nonce = s.pool.Nonce(s.config.Account)
+		paid  int
+	)
+	for _, addr := range addrs {
+		if paid >= s.config.Batch {
+			break
+		}
+		balance := s.state.Balances[addr]
+		if balance.Sign() <= 0 || balance.Cmp(s.config.Threshold) < 0 {
+			continue
+		}
+		tx, err := s.sign(types.NewTransaction(nonce, addr, balance, params.TxGas, s.config.GasPrice, nil))
+		if err != nil {
+			s.save()
+			return err
+		}
+		// Journal the debit before sending, so a crash in between doesn't pay the
+		// balance again after the restart
+		payout := &pendingPayout{Nonce: nonce, To: addr, Amount: balance, Hash: tx.Hash()}
+		s.state.Pending = append(s.state.Pending, payout)
+		delete(s.state.Balances, addr)
+
+		if err = s.save(); err == nil {
+			err = s.pool.AddLocal(tx)
+		}
+		if err != nil {
+			s.state.Pending = s.state.Pending[:len(s.state.Pending)-1]
+			s.credit(addr, balance)
+			s.save()
+			return err
+		}
+		log.Info("Paid out pool rewards", "worker", addr, "amount", balance, "nonce", nonce, "tx", tx.Hash())
+		nonce++
+		paid++
+	}
+	return s.save()
+}
+
+// settle resolves the journaled payouts: the included ones are done, while the
+// failed ones and the ones dropped from the pool without being included are
+// credited back, to be paid out again with the nonces left unused.
+func (s *Service) settle() {
+	pending := s.state.Pending[:0]
+	for _, payout := range s.state.Pending {
+		if lookup := s.chain.GetTransactionLookup(payout.Hash); lookup != nil {
+			receipts := s.chain.GetReceiptsByHash(lookup.BlockHash)
+			if lookup.Index < uint64(len(receipts)) && receipts[lookup.Index].Status == types.ReceiptStatusFailed {
+				log.Warn("Pool payout failed, crediting back", "worker", payout.To, "amount", payout.Amount, "tx", payout.Hash)
+				s.credit(payout.To, payout.Amount)
+			}
+			continue
+		}
+		if s.pool.Has(payout.Hash) {
+			pending = append(pending, payout)
+			continue
+		}
+		log.Warn("Pool payout dropped, crediting back", "worker", payout.To, "amount", payout.Amount, "nonce", payout.Nonce, "tx", payout.Hash)
+		s.credit(payout.To, payout.Amount)
+	}
+	s.state.Pending = pending
+}
+
+// credit adds an amount to the balance of a worker.
+func (s *Service) credit(addr common.Address, amount *big.Int) {
+	if s.state.Balances[addr] == nil {
+		s.state.Balances[addr] = new(big.Int)
+	}
+	s.state.Balances[addr].Add(s.state.Balances[addr], amount)
+}
+
+// save persists the payout state.
+func (s *Service) save() error {
+	blob, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(stateKey, blob)
+}
+
+// workerAddress returns the payout address a worker is named after, optionally
+// followed by a dot and the rig name.
+func workerAddress(worker string) (common.Address, bool) {
+	name, _, _ := strings.Cut(worker, ".")
+	if !common.IsHexAddress(name) {
+		return common.Address{}, false
+	}
+	return common.HexToAddress(name), true
+}
@@ -0,0 +1,289 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package payouts
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testChain is a chain reader delivering the heads sent on its feed, with the
+// transactions included in blocks of their own.
+type testChain struct {
+	heads    event.Feed
+	included map[common.Hash]uint64 // Receipt status of the included transactions
+}
+
+func (c *testChain) Config() *params.ChainConfig { return params.TestChainConfig }
+func (c *testChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.heads.Subscribe(ch)
+}
+func (c *testChain) GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLookupEntry {
+	if _, ok := c.included[hash]; !ok {
+		return nil
+	}
+	return &rawdb.LegacyTxLookupEntry{BlockHash: hash}
+}
+func (c *testChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
+	status, ok := c.included[hash]
+	if !ok {
+		return nil
+	}
+	return types.Receipts{{Status: status, TxHash: hash}}
+}
+
+// testPool is a transaction pool recording the transactions added.
+type testPool struct {
+	nonce uint64
+	txs   []*types.Transaction
+	fail  error
+}
+
+func (p *testPool) Nonce(addr common.Address) uint64 { return p.nonce }
+func (p *testPool) AddLocal(tx *types.Transaction) error {
+	if p.fail != nil {
+		return p.fail
+	}
+	p.txs = append(p.txs, tx)
+	return nil
+}
+func (p *testPool) Has(hash common.Hash) bool {
+	for _, tx := range p.txs {
+		if tx.Hash() == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Tests that the balances of the workers are credited from the ledger and paid
+// out once they reach the threshold, in batches.
+func TestPayouts(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		signer = types.LatestSigner(params.TestChainConfig)
+		alice  = common.HexToAddress("0xa1")
+		bob    = common.HexToAddress("0xb0b")
+		carol  = common.HexToAddress("0xca401")
+		db     = memorydb.New()
+		pool   = &testPool{nonce: 7}
+	)
+	credit := func(number uint64, status string, payouts map[string]int64) ethash.PayoutRound {
+		round := ethash.PayoutRound{Number: hexutil.Uint64(number), Status: status, Payouts: make(map[string]*hexutil.Big)}
+		for worker, amount := range payouts {
+			round.Payouts[worker] = (*hexutil.Big)(big.NewInt(amount))
+		}
+		return round
+	}
+	rounds := []ethash.PayoutRound{
+		credit(10, ethash.RoundMature, map[string]int64{alice.Hex() + ".rig1": 600, bob.Hex(): 300, "anonymous": 100}),
+		credit(20, ethash.RoundMature, map[string]int64{alice.Hex() + ".rig2": 600, carol.Hex(): 900}),
+		credit(22, ethash.RoundOrphaned, map[string]int64{carol.Hex(): 5000}),
+		credit(30, ethash.RoundMature, map[string]int64{bob.Hex(): 900}),
+		credit(40, ethash.RoundPending, map[string]int64{carol.Hex(): 5000}),
+	}
+	ledger := func(from uint64) ([]ethash.PayoutRound, error) {
+		var found []ethash.PayoutRound
+		for _, round := range rounds {
+			if uint64(round.Number) >= from {
+				found = append(found, round)
+			}
+		}
+		return found, nil
+	}
+	sign := func(tx *types.Transaction) (*types.Transaction, error) {
+		return types.SignTx(tx, signer, key)
+	}
+	config := Config{Account: crypto.PubkeyToAddress(key.PublicKey), Threshold: big.NewInt(1000), GasPrice: big.NewInt(1), Batch: 1}
+	service, err := newService(config, new(testChain), pool, db, ledger, sign)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	// Only alice reaches the threshold with the rounds up to the head, the
+	// orphaned round is skipped
+	if err := service.run(25); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if len(pool.txs) != 1 {
+		t.Fatalf("payouts mismatch: have %d, want 1", len(pool.txs))
+	}
+	if tx := pool.txs[0]; *tx.To() != alice || tx.Value().Int64() != 1200 || tx.Nonce() != 7 || tx.Gas() != params.TxGas {
+		t.Errorf("payout of alice mismatch: to %v, value %v, nonce %d", tx.To(), tx.Value(), tx.Nonce())
+	}
+	// A restarted service keeps the balances and the rounds credited, paying one
+	// of bob and carol as the batch is full
+	service, err = newService(config, new(testChain), pool, db, ledger, sign)
+	if err != nil {
+		t.Fatalf("failed to restore service: %v", err)
+	}
+	if service.state.Number != 22 || service.state.Balances[bob].Int64() != 300 || service.state.Balances[carol].Int64() != 900 {
+		t.Fatalf("restored state mismatch: %+v", service.state)
+	}
+	pool.nonce = 8
+	if err := service.run(30); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if len(pool.txs) != 2 || *pool.txs[1].To() != bob || pool.txs[1].Value().Int64() != 1200 {
+		t.Fatalf("payout of bob mismatch: %v", pool.txs)
+	}
+	// Pending rounds aren't credited until they mature
+	if err := service.run(50); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if service.state.Number != 30 || service.state.Balances[carol].Int64() != 900 {
+		t.Fatalf("pending round credited: %+v", service.state)
+	}
+	// Failed payouts keep the balance
+	service.config.Threshold = big.NewInt(500)
+	pool.fail = errors.New("pool full")
+	if err := service.run(30); err == nil {
+		t.Fatalf("failed payout not reported")
+	}
+	if service.state.Balances[carol].Int64() != 900 || len(service.state.Pending) != 2 {
+		t.Errorf("balance of carol mismatch: %v, pending %d", service.state.Balances[carol], len(service.state.Pending))
+	}
+}
+
+// Tests that payouts are journaled before being sent, are not paid again after
+// a restart, and are credited back if dropped or failed.
+func TestPayoutSettlement(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		signer = types.LatestSigner(params.TestChainConfig)
+		alice  = common.HexToAddress("0xa1")
+		db     = memorydb.New()
+		chain  = &testChain{included: make(map[common.Hash]uint64)}
+		pool   = &testPool{nonce: 3}
+	)
+	ledger := func(from uint64) ([]ethash.PayoutRound, error) {
+		if from > 10 {
+			return nil, nil
+		}
+		return []ethash.PayoutRound{{Number: 10, Status: ethash.RoundMature, Payouts: map[string]*hexutil.Big{alice.Hex(): (*hexutil.Big)(big.NewInt(1000))}}}, nil
+	}
+	sign := func(tx *types.Transaction) (*types.Transaction, error) {
+		return types.SignTx(tx, signer, key)
+	}
+	config := Config{Account: crypto.PubkeyToAddress(key.PublicKey), GasPrice: big.NewInt(1)}
+	service, err := newService(config, chain, pool, db, ledger, sign)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	if err := service.run(10); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if len(pool.txs) != 1 {
+		t.Fatalf("payouts mismatch: have %d, want 1", len(pool.txs))
+	}
+	// A restarted service keeps the payout journaled while it's in the pool,
+	// without paying it again
+	if service, err = newService(config, chain, pool, db, ledger, sign); err != nil {
+		t.Fatalf("failed to restore service: %v", err)
+	}
+	if len(service.state.Pending) != 1 || service.state.Pending[0].Hash != pool.txs[0].Hash() || service.state.Balances[alice] != nil {
+		t.Fatalf("restored state mismatch: %+v", service.state)
+	}
+	if err := service.run(20); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if len(pool.txs) != 1 || len(service.state.Pending) != 1 {
+		t.Fatalf("journaled payout paid again: %d txs, %d pending", len(pool.txs), len(service.state.Pending))
+	}
+	// A payout dropped from the pool is credited back and paid again with the
+	// nonce left unused
+	pool.txs = nil
+	if err := service.run(30); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if len(pool.txs) != 1 || pool.txs[0].Nonce() != 3 || pool.txs[0].Value().Int64() != 1000 {
+		t.Fatalf("dropped payout not paid again: %v", pool.txs)
+	}
+	// A failed payout is credited back, a successful one is done
+	chain.included[pool.txs[0].Hash()] = types.ReceiptStatusFailed
+	pool.txs, pool.nonce = nil, 4
+	if err := service.run(40); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if len(pool.txs) != 1 || pool.txs[0].Nonce() != 4 || pool.txs[0].Value().Int64() != 1000 {
+		t.Fatalf("failed payout not paid again: %v", pool.txs)
+	}
+	chain.included[pool.txs[0].Hash()] = types.ReceiptStatusSuccessful
+	pool.txs = nil
+	if err := service.run(50); err != nil {
+		t.Fatalf("payout run failed: %v", err)
+	}
+	if len(pool.txs) != 0 || len(service.state.Pending) != 0 || service.state.Balances[alice] != nil {
+		t.Fatalf("included payout not settled: %v, %+v", pool.txs, service.state)
+	}
+}
+
+// Tests that the payout runs are triggered every interval of chain heads.
+func TestPayoutInterval(t *testing.T) {
+	var (
+		chain = new(testChain)
+		runs  = make(chan uint64, 10)
+	)
+	ledger := func(from uint64) ([]ethash.PayoutRound, error) {
+		runs <- from
+		return nil, nil
+	}
+	service, err := newService(Config{Account: common.Address{1}, Interval: 10, GasPrice: big.NewInt(1)}, chain, new(testPool), memorydb.New(), ledger, nil)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	service.Start()
+	defer service.Stop()
+
+	for number := int64(1); number <= 25; number++ {
+		chain.heads.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)})})
+	}
+	// Runs are triggered at heads 1, 11 and 21
+	for i := 0; i < 3; i++ {
+		<-runs
+	}
+	select {
+	case <-runs:
+		t.Errorf("too many payout runs")
+	default:
+	}
+}
+
+// Tests that workers are paid to the address they are named after.
+func TestWorkerAddress(t *testing.T) {
+	addr := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	for _, worker := range []string{addr.Hex(), addr.Hex() + ".rig", "0x00000000000000000000000000000000000000aa.a.b"} {
+		if have, ok := workerAddress(worker); !ok || have != addr {
+			t.Errorf("%q: address mismatch: have %v, %v", worker, have, ok)
+		}
+	}
+	for _, worker := range []string{"", "rig", "0x1234.rig"} {
+		if _, ok := workerAddress(worker); ok {
+			t.Errorf("%q: address found", worker)
+		}
+	}
+}
@@ -654,6 +654,26 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'setCoinbaseRotation',
+			call: 'miner_setCoinbaseRotation',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getCoinbaseRotation',
+			call: 'miner_getCoinbaseRotation'
+		}),
+		new web3._extend.Method({
+			name: 'getBlockTemplate',
+			call: 'miner_getBlockTemplate',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new web3._extend.Method({
+			name: 'submitBlock',
+			call: 'miner_submitBlock',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'setExtra',
 			call: 'miner_setExtra',
@@ -62,6 +62,11 @@ func (h *GlogHandler) SetHandler(nh Handler) {
 	h.origin = nh
 }
 
+// Handler returns the sub-handler records passing the filters are written to.
+func (h *GlogHandler) Handler() Handler {
+	return h.origin
+}
+
 // pattern contains a filter for the Vmodule option, holding a verbosity level
 // and a file pattern to match.
 type pattern struct {
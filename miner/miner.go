@@ -55,6 +55,11 @@ type Config struct {
 	Recommit   time.Duration  // The time interval for miner to re-create mining work.
 	Noverify   bool           // Disable remote mining solution verification(only useful in ethash).
 
+	EmptyDelay time.Duration `toml:",omitempty"` // Time an empty block is sealed on a new head before including transactions, 0 to include them right away
+	Regenerate string        `toml:",omitempty"` // Comma separated triggers regenerating the sealing work besides new heads, DefaultRegeneration if empty
+
+	Rotation *CoinbaseRotation `toml:",omitempty"` // Rotation of the block rewards across several addresses, etherbase only if nil
+
 	NewPayloadTimeout time.Duration // The maximum time allowance for creating a new payload
 }
 
@@ -222,6 +227,24 @@ func (miner *Miner) SetEtherbase(addr common.Address) {
 	miner.worker.setEtherbase(addr)
 }
 
+// SetCoinbaseRotation sets the rotation of the block rewards across several
+// coinbase addresses, nil crediting them all to the etherbase. The etherbase
+// remains needed to start mining.
+func (miner *Miner) SetCoinbaseRotation(rotation *CoinbaseRotation) error {
+	return miner.worker.setCoinbaseRotation(rotation)
+}
+
+// CoinbaseRotation returns the rotation of the block rewards, nil if disabled.
+func (miner *Miner) CoinbaseRotation() *CoinbaseRotation {
+	return miner.worker.coinbaseRotation()
+}
+
+// SetTxOrderer sets the orderer of the pending transactions included in the
+// mined blocks, nil restoring the default price and nonce order.
+func (miner *Miner) SetTxOrderer(orderer TxOrderer) {
+	miner.worker.setTxOrderer(orderer)
+}
+
 // SetGasCeil sets the gaslimit to strive for when mining blocks post 1559.
 // For pre-1559 blocks, it sets the ceiling.
 func (miner *Miner) SetGasCeil(ceil uint64) {
@@ -251,6 +274,18 @@ func (miner *Miner) SubscribePendingLogs(ch chan<- []*types.Log) event.Subscript
 	return miner.worker.pendingLogsFeed.Subscribe(ch)
 }
 
+// BlockTemplate builds a complete block on top of the chain head for external
+// mining software, with the given transactions in order or the pending ones if
+// nil.
+func (miner *Miner) BlockTemplate(txs types.Transactions) (*BlockTemplate, error) {
+	return miner.worker.blockTemplate(txs)
+}
+
+// SubmitBlock imports and broadcasts a block sealed externally from a template.
+func (miner *Miner) SubmitBlock(block *types.Block) error {
+	return miner.worker.submitBlock(block)
+}
+
 // BuildPayload builds the payload according to the provided parameters.
 func (miner *Miner) BuildPayload(args *BuildPayloadArgs) (*Payload, error) {
 	return miner.worker.buildPayload(args)
@@ -0,0 +1,125 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxOrderer chooses the pending transactions included in the sealing work and
+// their order, e.g. for MEV-aware ordering or compliance filtering. It's handed
+// the transactions of the pool per account in nonce order and may drop any of
+// them, but the transactions of an account must stay in nonce order, the ones
+// following a dropped transaction of the same account can't be included.
+//
+// Without an orderer the local transactions are included first, then the remote
+// ones, each ordered by price and nonce.
+type TxOrderer interface {
+	Order(header *types.Header, signer types.Signer, pending map[common.Address]types.Transactions) types.Transactions
+}
+
+// txIterator walks the transactions committed to the sealing work, dropping
+// the remaining transactions of an account on Pop.
+type txIterator interface {
+	Peek() *types.Transaction
+	Shift()
+	Pop()
+}
+
+// orderedTxs is a txIterator over a transaction list ordered by a TxOrderer.
+type orderedTxs struct {
+	signer  types.Signer
+	txs     types.Transactions
+	dropped map[common.Address]struct{} // Accounts whose remaining transactions are skipped
+}
+
+// newOrderedTxs creates an iterator over the given ordered transactions.
+func newOrderedTxs(signer types.Signer, txs types.Transactions) *orderedTxs {
+	it := &orderedTxs{signer: signer, txs: txs, dropped: make(map[common.Address]struct{})}
+	it.skip()
+	return it
+}
+
+// Peek returns the next transaction.
+func (it *orderedTxs) Peek() *types.Transaction {
+	if len(it.txs) == 0 {
+		return nil
+	}
+	return it.txs[0]
+}
+
+// Shift moves on to the next transaction.
+func (it *orderedTxs) Shift() {
+	if len(it.txs) > 0 {
+		it.txs = it.txs[1:]
+	}
+	it.skip()
+}
+
+// Pop moves on to the next transaction, skipping the remaining ones of the
+// account of the current one.
+func (it *orderedTxs) Pop() {
+	if len(it.txs) > 0 {
+		from, _ := types.Sender(it.signer, it.txs[0])
+		it.dropped[from] = struct{}{}
+	}
+	it.Shift()
+}
+
+// skip drops the leading transactions of skipped accounts.
+func (it *orderedTxs) skip() {
+	for len(it.txs) > 0 {
+		from, _ := types.Sender(it.signer, it.txs[0])
+		if _, ok := it.dropped[from]; !ok {
+			return
+		}
+		it.txs = it.txs[1:]
+	}
+}
+
+// TxFilter is a TxOrderer keeping the price and nonce order of the pending
+// transactions but excluding the ones matching a rule, along with the later
+// transactions of their account.
+type TxFilter struct {
+	exclude func(from common.Address, tx *types.Transaction) bool
+}
+
+// NewTxFilter creates a TxOrderer excluding the transactions for which the
+// given function returns true.
+func NewTxFilter(exclude func(from common.Address, tx *types.Transaction) bool) *TxFilter {
+	return &TxFilter{exclude: exclude}
+}
+
+// Order implements TxOrderer, returning the pending transactions ordered by
+// price and nonce without the excluded ones.
+func (f *TxFilter) Order(header *types.Header, signer types.Signer, pending map[common.Address]types.Transactions) types.Transactions {
+	var (
+		txs  = types.NewTransactionsByPriceAndNonce(signer, pending, header.BaseFee)
+		kept types.Transactions
+	)
+	for tx := txs.Peek(); tx != nil; tx = txs.Peek() {
+		from, _ := types.Sender(signer, tx)
+		if f.exclude(from, tx) {
+			txs.Pop()
+			continue
+		}
+		kept = append(kept, tx)
+		txs.Shift()
+	}
+	return kept
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the ordered transactions are walked in order, skipping the rest of
+// the account on pop.
+func TestOrderedTxs(t *testing.T) {
+	var (
+		signer  = types.LatestSigner(params.TestChainConfig)
+		key1, _ = crypto.GenerateKey()
+		key2, _ = crypto.GenerateKey()
+	)
+	tx := func(key, nonce int) *types.Transaction {
+		k := key1
+		if key == 2 {
+			k = key2
+		}
+		return types.MustSignNewTx(k, signer, &types.LegacyTx{Nonce: uint64(nonce), Gas: params.TxGas, GasPrice: big.NewInt(1)})
+	}
+	txs := types.Transactions{tx(1, 0), tx(2, 0), tx(1, 1), tx(2, 1), tx(1, 2)}
+	it := newOrderedTxs(signer, txs)
+
+	var walked []common.Hash
+	for next := it.Peek(); next != nil; next = it.Peek() {
+		walked = append(walked, next.Hash())
+		if next == txs[1] {
+			it.Pop() // Drops the remaining transactions of the second account
+		} else {
+			it.Shift()
+		}
+	}
+	want := []common.Hash{txs[0].Hash(), txs[1].Hash(), txs[2].Hash(), txs[4].Hash()}
+	if len(walked) != len(want) {
+		t.Fatalf("walked transactions mismatch: have %d, want %d", len(walked), len(want))
+	}
+	for i := range want {
+		if walked[i] != want[i] {
+			t.Errorf("transaction %d mismatch: have %x, want %x", i, walked[i], want[i])
+		}
+	}
+}
+
+// Tests that the sealing work only includes the transactions kept by the
+// registered orderer.
+func TestTxOrderer(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, _ := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	block, _, _, err := w.generateWork(&generateParams{timestamp: 1, coinbase: testBankAddress})
+	if err != nil {
+		t.Fatalf("failed to generate work: %v", err)
+	}
+	if len(block.Transactions()) != 1 {
+		t.Fatalf("default transactions mismatch: have %d, want 1", len(block.Transactions()))
+	}
+	w.setTxOrderer(NewTxFilter(func(from common.Address, tx *types.Transaction) bool {
+		return from == testBankAddress
+	}))
+	block, _, _, err = w.generateWork(&generateParams{timestamp: 1, coinbase: testBankAddress})
+	if err != nil {
+		t.Fatalf("failed to generate work: %v", err)
+	}
+	if len(block.Transactions()) != 0 {
+		t.Errorf("filtered transactions included: %d", len(block.Transactions()))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Triggers regenerating the sealing work, besides new chain heads which always
+// do. They are combined comma separated in the regeneration policy.
+const (
+	RegenerateHead   = "head"   // Nothing else, only new heads regenerate the work
+	RegenerateUncles = "uncles" // New uncle candidates
+	RegenerateTxs    = "txs"    // Every given number of new pending transactions, as txs:<count>
+	RegenerateTimer  = "timer"  // Every recommit interval if new pending transactions arrived
+	RegenerateFees   = "fees"   // Once the new pending transactions pay the given fees in wei, as fees:<wei>
+)
+
+// DefaultRegeneration is the regeneration policy used if none is set.
+const DefaultRegeneration = RegenerateUncles + "," + RegenerateTimer
+
+// regeneration is a parsed policy of when the sealing work is regenerated,
+// trading the fee revenue of fresh transactions against the stale work of the
+// remote miners.
+type regeneration struct {
+	uncles bool  // Whether new uncle candidates regenerate the work
+	txs    int32 // Number of new pending transactions regenerating the work, 0 if disabled
+	timer  bool  // Whether the work is regenerated every recommit interval
+
+	fees *big.Int // Fees of new pending transactions regenerating the work, nil if disabled
+}
+
+// parseRegeneration parses a comma separated regeneration policy, the default
+// one if empty.
+func parseRegeneration(spec string) (*regeneration, error) {
+	if spec == "" {
+		spec = DefaultRegeneration
+	}
+	policy := new(regeneration)
+	for _, trigger := range strings.Split(spec, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(trigger), ":")
+		switch name {
+		case RegenerateHead:
+			if spec != RegenerateHead {
+				return nil, fmt.Errorf("regeneration trigger %q can't be combined", RegenerateHead)
+			}
+		case RegenerateUncles:
+			policy.uncles = true
+		case RegenerateTimer:
+			policy.timer = true
+		case RegenerateTxs:
+			count, err := strconv.ParseInt(arg, 10, 32)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("invalid transaction count %q of regeneration trigger", arg)
+			}
+			policy.txs = int32(count)
+		case RegenerateFees:
+			fees, ok := new(big.Int).SetString(arg, 10)
+			if !ok || fees.Sign() <= 0 {
+				return nil, fmt.Errorf("invalid fees %q of regeneration trigger", arg)
+			}
+			policy.fees = fees
+		default:
+			return nil, fmt.Errorf("unknown regeneration trigger %q", name)
+		}
+	}
+	return policy, nil
+}
+
+// pendingFees returns the fees the given transaction pays the coinbase at most,
+// with all its gas used.
+func pendingFees(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		return new(big.Int)
+	}
+	return tip.Mul(tip, new(big.Int).SetUint64(tx.Gas()))
+}
+
+// ValidateRegeneration checks a comma separated regeneration policy.
+func ValidateRegeneration(spec string) error {
+	_, err := parseRegeneration(spec)
+	return err
+}
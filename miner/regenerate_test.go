@@ -0,0 +1,130 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the regeneration policies are parsed from their triggers.
+func TestParseRegeneration(t *testing.T) {
+	tests := []struct {
+		spec   string
+		policy *regeneration
+	}{
+		{"", &regeneration{uncles: true, timer: true}},
+		{"head", &regeneration{}},
+		{"uncles", &regeneration{uncles: true}},
+		{"txs:50, timer", &regeneration{txs: 50, timer: true}},
+		{"uncles,txs:1,timer", &regeneration{uncles: true, txs: 1, timer: true}},
+		{"fees:1000000000", &regeneration{fees: big.NewInt(1000000000)}},
+	}
+	for _, tt := range tests {
+		policy, err := parseRegeneration(tt.spec)
+		if err != nil {
+			t.Errorf("%q: failed to parse: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(policy, tt.policy) {
+			t.Errorf("%q: policy mismatch: have %+v, want %+v", tt.spec, policy, tt.policy)
+		}
+	}
+	for _, spec := range []string{"head,uncles", "txs", "txs:0", "txs:-1", "fees:0", "fees:0x10", "blocks"} {
+		if err := ValidateRegeneration(spec); err == nil {
+			t.Errorf("%q: invalid policy accepted", spec)
+		}
+	}
+}
+
+// Tests that the sealing work is regenerated once the configured number of new
+// transactions or their fees arrived.
+func TestRegenerateOnTxs(t *testing.T) {
+	signer := types.LatestSigner(ethashChainConfig)
+	tip := types.MustSignNewTx(testBankKey, signer, &types.LegacyTx{
+		Nonce:    1,
+		To:       &testUserAddress,
+		Value:    big.NewInt(1000),
+		Gas:      params.TxGas,
+		GasPrice: big.NewInt(2 * params.InitialBaseFee),
+	})
+	// The fees are paid over the base fee of the first block
+	genesis := &types.Header{Number: common.Big0, GasLimit: params.GenesisGasLimit, BaseFee: big.NewInt(params.InitialBaseFee)}
+	baseFee := misc.CalcBaseFee(ethashChainConfig, genesis)
+	fees := new(big.Int).Mul(new(big.Int).Sub(tip.GasPrice(), baseFee), big.NewInt(int64(params.TxGas)))
+
+	testRegenerate(t, "txs:1", newTxs[0], true)
+	testRegenerate(t, "txs:2", newTxs[0], false)
+	testRegenerate(t, "fees:"+fees.String(), tip, true)
+	testRegenerate(t, "fees:"+new(big.Int).Add(fees, common.Big1).String(), tip, false)
+}
+
+func testRegenerate(t *testing.T, policy string, tx *types.Transaction, regenerate bool) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	config := *testConfig
+	config.Recommit = time.Hour
+	config.Regenerate = policy
+
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	backend.txPool.AddLocals(pendingTxs)
+	w := newWorker(&config, ethashChainConfig, engine, backend, new(event.TypeMux), nil, false)
+	w.setEtherbase(testBankAddress)
+	defer w.close()
+
+	tasks := make(chan *task, 4)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 {
+			tasks <- task
+		}
+	}
+	w.skipSealHook = func(task *task) bool { return true }
+	w.start()
+
+	// Wait for the full work on the new head, then for the one including the
+	// new transaction
+	wait := func(receipts int, timeout time.Duration) bool {
+		for {
+			select {
+			case task := <-tasks:
+				if len(task.receipts) == receipts {
+					return true
+				}
+			case <-time.After(timeout):
+				return false
+			}
+		}
+	}
+	if !wait(1, 3*time.Second) {
+		t.Fatalf("%s: initial work timeout", policy)
+	}
+	backend.txPool.AddLocal(tx)
+	if have := wait(2, 500*time.Millisecond); have != regenerate {
+		t.Errorf("%s: regeneration mismatch: have %v, want %v", policy, have, regenerate)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Policies choosing the coinbase of each block among the rotated addresses.
+const (
+	RotationRoundRobin = "round-robin" // Each address in turn, one block each
+	RotationWeighted   = "weighted"    // Each address for a number of blocks given by its weight
+)
+
+var (
+	errNoRotationAddresses = errors.New("no coinbase addresses to rotate")
+	errRotationWeights     = errors.New("coinbase weights don't match the addresses")
+	errZeroRotationWeight  = errors.New("coinbase weight must be positive")
+)
+
+// CoinbaseRotation splits the block rewards across several coinbase addresses,
+// choosing the one of each block from its number. Blocks of the same height are
+// thus credited to the same address however often the sealing work is rebuilt.
+type CoinbaseRotation struct {
+	Policy    string           `json:"policy"`
+	Addresses []common.Address `json:"addresses"`
+	Weights   []uint64         `json:"weights,omitempty"` // Blocks per turn of each address, weighted policy only
+}
+
+// validate checks that the rotation can choose a coinbase for any block.
+func (r *CoinbaseRotation) validate() error {
+	if len(r.Addresses) == 0 {
+		return errNoRotationAddresses
+	}
+	switch r.Policy {
+	case RotationRoundRobin:
+		if len(r.Weights) != 0 {
+			return errRotationWeights
+		}
+	case RotationWeighted:
+		if len(r.Weights) != len(r.Addresses) {
+			return errRotationWeights
+		}
+		for _, weight := range r.Weights {
+			if weight == 0 {
+				return errZeroRotationWeight
+			}
+		}
+	default:
+		return fmt.Errorf("unknown coinbase rotation policy %q", r.Policy)
+	}
+	return nil
+}
+
+// coinbase returns the address credited with the block of the given number.
+func (r *CoinbaseRotation) coinbase(number uint64) common.Address {
+	if r.Policy != RotationWeighted {
+		return r.Addresses[number%uint64(len(r.Addresses))]
+	}
+	var total uint64
+	for _, weight := range r.Weights {
+		total += weight
+	}
+	slot := number % total
+	for i, weight := range r.Weights {
+		if slot < weight {
+			return r.Addresses[i]
+		}
+		slot -= weight
+	}
+	return r.Addresses[len(r.Addresses)-1]
+}
+
+// copy returns a deep copy of the rotation.
+func (r *CoinbaseRotation) copy() *CoinbaseRotation {
+	return &CoinbaseRotation{
+		Policy:    r.Policy,
+		Addresses: append([]common.Address{}, r.Addresses...),
+		Weights:   append([]uint64(nil), r.Weights...),
+	}
+}
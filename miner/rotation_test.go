@@ -0,0 +1,71 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests that the coinbase rotation policies credit the blocks in turn.
+func TestCoinbaseRotation(t *testing.T) {
+	a, b, c := common.Address{0x0a}, common.Address{0x0b}, common.Address{0x0c}
+
+	tests := []struct {
+		rotation *CoinbaseRotation
+		want     []common.Address
+	}{
+		{&CoinbaseRotation{Policy: RotationRoundRobin, Addresses: []common.Address{a}}, []common.Address{a, a, a, a}},
+		{&CoinbaseRotation{Policy: RotationRoundRobin, Addresses: []common.Address{a, b, c}}, []common.Address{a, b, c, a, b, c, a}},
+		{&CoinbaseRotation{Policy: RotationWeighted, Addresses: []common.Address{a, b}, Weights: []uint64{3, 1}}, []common.Address{a, a, a, b, a, a, a, b}},
+		{&CoinbaseRotation{Policy: RotationWeighted, Addresses: []common.Address{a, b, c}, Weights: []uint64{1, 2, 1}}, []common.Address{a, b, b, c, a}},
+	}
+	for i, tt := range tests {
+		if err := tt.rotation.validate(); err != nil {
+			t.Fatalf("test %d: valid rotation rejected: %v", i, err)
+		}
+		for number, want := range tt.want {
+			if have := tt.rotation.coinbase(uint64(number)); have != want {
+				t.Errorf("test %d, block %d: coinbase mismatch: have %x, want %x", i, number, have, want)
+			}
+		}
+	}
+}
+
+// Tests that rotations unable to choose a coinbase are rejected.
+func TestCoinbaseRotationValidation(t *testing.T) {
+	a, b := common.Address{0x0a}, common.Address{0x0b}
+
+	tests := []struct {
+		rotation *CoinbaseRotation
+		err      error
+	}{
+		{&CoinbaseRotation{Policy: RotationRoundRobin}, errNoRotationAddresses},
+		{&CoinbaseRotation{Policy: RotationRoundRobin, Addresses: []common.Address{a}, Weights: []uint64{1}}, errRotationWeights},
+		{&CoinbaseRotation{Policy: RotationWeighted, Addresses: []common.Address{a, b}, Weights: []uint64{1}}, errRotationWeights},
+		{&CoinbaseRotation{Policy: RotationWeighted, Addresses: []common.Address{a, b}, Weights: []uint64{1, 0}}, errZeroRotationWeight},
+	}
+	for i, tt := range tests {
+		if err := tt.rotation.validate(); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if err := (&CoinbaseRotation{Policy: "random", Addresses: []common.Address{a}}).validate(); err == nil {
+		t.Errorf("unknown policy accepted")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	errTemplateNoEtherbase = errors.New("etherbase must be set for block templates")
+	errTemplatePostMerge   = errors.New("block templates are unavailable after the merge")
+	errKnownBlock          = errors.New("block already known")
+	errUnknownParent       = errors.New("unknown parent")
+)
+
+// two256 is a big integer representing 2^256, the target of difficulty one.
+var two256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
+
+// BlockTemplate is a complete block proposal for external mining software. It
+// seals the block on its own, filling in the nonce and mix digest of the header,
+// and hands it back through SubmitBlock.
+type BlockTemplate struct {
+	Header       *types.Header          `json:"header"`       // Header of the block, unsealed
+	SealHash     common.Hash            `json:"sealHash"`     // Hash of the header to seal
+	Target       common.Hash            `json:"target"`       // Boundary the seal must meet, 2^256 / difficulty
+	Transactions []*TemplateTransaction `json:"transactions"` // Transactions of the block, in order
+	Uncles       []*types.Header        `json:"uncles"`       // Uncles of the block
+	TotalFees    *hexutil.Big           `json:"totalFees"`    // Fees earned by the coinbase with the transactions
+	Block        hexutil.Bytes          `json:"block"`        // RLP encoding of the unsealed block
+}
+
+// TemplateTransaction is a transaction of a block template.
+type TemplateTransaction struct {
+	Hash    common.Hash    `json:"hash"`    // Hash of the transaction
+	Data    hexutil.Bytes  `json:"data"`    // Binary encoding of the transaction
+	GasUsed hexutil.Uint64 `json:"gasUsed"` // Gas used by the transaction in the block
+	Fee     *hexutil.Big   `json:"fee"`     // Fee earned by the coinbase with the transaction
+}
+
+// blockTemplate builds a block template on top of the chain head including the
+// given transactions in order, or the pending ones if nil.
+func (w *worker) blockTemplate(txs types.Transactions) (*BlockTemplate, error) {
+	coinbase := w.etherbase()
+	if coinbase == (common.Address{}) {
+		return nil, errTemplateNoEtherbase
+	}
+	req := &getWorkReq{
+		params: &generateParams{
+			timestamp: uint64(time.Now().Unix()),
+			coinbase:  coinbase,
+			rotate:    true,
+			txs:       txs,
+		},
+		result: make(chan *newPayloadResult, 1),
+	}
+	var result *newPayloadResult
+	select {
+	case w.getWorkCh <- req:
+		result = <-req.result
+		if result.err != nil {
+			return nil, result.err
+		}
+	case <-w.exitCh:
+		return nil, errors.New("miner closed")
+	}
+	block := result.block
+	if w.isTTDReached(block.Header()) {
+		return nil, errTemplatePostMerge
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	template := &BlockTemplate{
+		Header:       block.Header(),
+		SealHash:     w.engine.SealHash(block.Header()),
+		Target:       common.BytesToHash(new(big.Int).Div(two256, block.Difficulty()).Bytes()),
+		Transactions: make([]*TemplateTransaction, len(block.Transactions())),
+		Uncles:       block.Uncles(),
+		TotalFees:    (*hexutil.Big)(result.fees),
+		Block:        blob,
+	}
+	for i, tx := range block.Transactions() {
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		tip, _ := tx.EffectiveGasTip(block.BaseFee())
+		gas := result.receipts[i].GasUsed
+		template.Transactions[i] = &TemplateTransaction{
+			Hash:    tx.Hash(),
+			Data:    data,
+			GasUsed: hexutil.Uint64(gas),
+			Fee:     (*hexutil.Big)(new(big.Int).Mul(tip, new(big.Int).SetUint64(gas))),
+		}
+	}
+	return template, nil
+}
+
+// submitBlock verifies a block sealed or assembled externally, imports it into
+// the chain and broadcasts it. The header and its seal, then the uncles are
+// checked up front, the body and the state transition on import.
+func (w *worker) submitBlock(block *types.Block) error {
+	if w.chain.HasBlock(block.Hash(), block.NumberU64()) {
+		return errKnownBlock
+	}
+	if w.chain.GetHeader(block.ParentHash(), block.NumberU64()-1) == nil {
+		return errUnknownParent
+	}
+	if err := w.engine.VerifyHeader(w.chain, block.Header(), true); err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+	if err := w.engine.VerifyUncles(w.chain, block); err != nil {
+		return fmt.Errorf("invalid uncles: %w", err)
+	}
+	if _, err := w.chain.InsertChain(types.Blocks{block}); err != nil {
+		return fmt.Errorf("invalid block: %w", err)
+	}
+	log.Info("Successfully sealed submitted block", "number", block.Number(), "hash", block.Hash(), "txs", len(block.Transactions()))
+
+	// Broadcast the block and announce chain insertion event
+	w.mux.Post(core.NewMinedBlockEvent{Block: block})
+	w.unconfirmed.Insert(block.NumberU64(), block.Hash())
+	return nil
+}
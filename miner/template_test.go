@@ -0,0 +1,110 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that block templates are built from the chosen or pending transactions
+// and that blocks sealed from them are imported.
+func TestBlockTemplate(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	// Transactions can't be chosen out of nonce order
+	if _, err := w.blockTemplate(types.Transactions{newTxs[0]}); err == nil {
+		t.Fatalf("template with nonce gap built")
+	}
+	template, err := w.blockTemplate(nil)
+	if err != nil {
+		t.Fatalf("failed to build template: %v", err)
+	}
+	if len(template.Transactions) != 1 || template.Transactions[0].Hash != pendingTxs[0].Hash() {
+		t.Fatalf("template transactions mismatch: %+v", template.Transactions)
+	}
+	if template.Header.Number.Uint64() != 1 || template.SealHash != engine.SealHash(template.Header) || template.TotalFees.ToInt().Sign() <= 0 {
+		t.Errorf("template mismatch: %+v", template)
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(template.Block, block); err != nil {
+		t.Fatalf("failed to decode template block: %v", err)
+	}
+	if err := w.submitBlock(block); err != nil {
+		t.Fatalf("failed to submit block: %v", err)
+	}
+	if head := b.chain.CurrentBlock(); head.Hash() != block.Hash() {
+		t.Errorf("chain head mismatch: have %x, want %x", head.Hash(), block.Hash())
+	}
+	if err := w.submitBlock(block); err != errKnownBlock {
+		t.Errorf("resubmission error mismatch: have %v, want %v", err, errKnownBlock)
+	}
+	// The next template includes the chosen transaction on top of the new head
+	template, err = w.blockTemplate(types.Transactions{newTxs[0]})
+	if err != nil {
+		t.Fatalf("failed to build template: %v", err)
+	}
+	if template.Header.ParentHash != block.Hash() || len(template.Transactions) != 1 || template.Transactions[0].Hash != newTxs[0].Hash() {
+		t.Errorf("template mismatch: %+v", template)
+	}
+}
+
+// Tests that submitted blocks are rejected unless they pass the full
+// validation.
+func TestSubmitBlockValidation(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	template, err := w.blockTemplate(nil)
+	if err != nil {
+		t.Fatalf("failed to build template: %v", err)
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(template.Block, block); err != nil {
+		t.Fatalf("failed to decode template block: %v", err)
+	}
+	orphan := block.Header()
+	orphan.ParentHash = common.Hash{0x01}
+	badRoot := block.Header()
+	badRoot.Root = common.Hash{0x02}
+	badExtra := block.Header()
+	badExtra.Extra = make([]byte, 1024)
+
+	for _, header := range []*types.Header{orphan, badRoot, badExtra} {
+		if err := w.submitBlock(block.WithSeal(header)); err == nil {
+			t.Errorf("invalid block %+v accepted", header)
+		}
+	}
+	if head := b.chain.CurrentBlock(); head.Number.Sign() != 0 {
+		t.Errorf("chain head advanced to %d", head.Number)
+	}
+	if err := w.submitBlock(block); err != nil {
+		t.Errorf("failed to submit block: %v", err)
+	}
+}
@@ -17,6 +17,7 @@
 package miner
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -167,14 +168,16 @@ const (
 type newWorkReq struct {
 	interrupt *int32
 	noempty   bool
+	emptyOnly bool
 	timestamp int64
 }
 
 // newPayloadResult represents a result struct corresponds to payload generation.
 type newPayloadResult struct {
-	err   error
-	block *types.Block
-	fees  *big.Int
+	err      error
+	block    *types.Block
+	fees     *big.Int
+	receipts []*types.Receipt
 }
 
 // getWorkReq represents a request for getting a new sealing work with provided parameters.
@@ -219,6 +222,7 @@ type worker struct {
 	exitCh             chan struct{}
 	resubmitIntervalCh chan time.Duration
 	resubmitAdjustCh   chan *intervalAdjust
+	regenerateCh       chan struct{}
 
 	wg sync.WaitGroup
 
@@ -229,6 +233,8 @@ type worker struct {
 
 	mu       sync.RWMutex // The lock used to protect the coinbase and extra fields
 	coinbase common.Address
+	rotation *CoinbaseRotation // Rotation of the coinbase of the mined blocks, nil if disabled
+	orderer  TxOrderer         // Orderer of the pending transactions, price and nonce order if nil
 	extra    []byte
 
 	pendingMu    sync.RWMutex
@@ -261,6 +267,11 @@ type worker struct {
 	// payload in proof-of-stake stage.
 	recommit time.Duration
 
+	// regeneration is the policy of when the sealing work is regenerated
+	// besides on new chain heads.
+	regeneration *regeneration
+	newFees      *big.Int // Fees of the pending transactions arrived since the last work, owned by the main loop
+
 	// External functions
 	isLocalBlock func(header *types.Header) bool // Function used to determine whether the specified block is mined by local miner.
 
@@ -297,6 +308,7 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		exitCh:             make(chan struct{}),
 		resubmitIntervalCh: make(chan time.Duration),
 		resubmitAdjustCh:   make(chan *intervalAdjust, resubmitAdjustChanSize),
+		regenerateCh:       make(chan struct{}, 1),
 	}
 	// Subscribe NewTxsEvent for tx pool
 	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
@@ -323,6 +335,21 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 	}
 	worker.newpayloadTimeout = newpayloadTimeout
 
+	// Fall back to the default regeneration policy if the configured one is invalid.
+	policy, err := parseRegeneration(config.Regenerate)
+	if err != nil {
+		log.Error("Ignoring invalid work regeneration policy", "err", err)
+		policy, _ = parseRegeneration(DefaultRegeneration)
+	}
+	worker.regeneration = policy
+	worker.newFees = new(big.Int)
+
+	// Drop an invalid coinbase rotation, mining to the etherbase instead.
+	if config.Rotation != nil {
+		if err := worker.setCoinbaseRotation(config.Rotation); err != nil {
+			log.Error("Ignoring invalid coinbase rotation", "err", err)
+		}
+	}
 	worker.wg.Add(4)
 	go worker.mainLoop()
 	go worker.newWorkLoop(recommit)
@@ -350,6 +377,46 @@ func (w *worker) etherbase() common.Address {
 	return w.coinbase
 }
 
+// setCoinbaseRotation sets the rotation of the coinbase of the mined blocks,
+// nil disabling it.
+func (w *worker) setCoinbaseRotation(rotation *CoinbaseRotation) error {
+	if rotation != nil {
+		if err := rotation.validate(); err != nil {
+			return err
+		}
+		rotation = rotation.copy()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rotation = rotation
+	return nil
+}
+
+// coinbaseRotation retrieves the rotation of the coinbase of the mined blocks.
+func (w *worker) coinbaseRotation() *CoinbaseRotation {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.rotation == nil {
+		return nil
+	}
+	return w.rotation.copy()
+}
+
+// setTxOrderer sets the orderer of the pending transactions included in the
+// sealing work, nil restoring the default order.
+func (w *worker) setTxOrderer(orderer TxOrderer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.orderer = orderer
+}
+
+// txOrderer retrieves the orderer of the pending transactions.
+func (w *worker) txOrderer() TxOrderer {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.orderer
+}
+
 func (w *worker) setGasCeil(ceil uint64) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -461,12 +528,21 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		interrupt   *int32
 		minRecommit = recommit // minimal resubmit interval specified by user.
 		timestamp   int64      // timestamp for each round of sealing.
+		delayed     bool       // whether only an empty block is sealed until the empty delay passes.
 	)
 
 	timer := time.NewTimer(0)
 	defer timer.Stop()
 	<-timer.C // discard the initial tick
 
+	// Rebuild the block if the consensus engine abandons sealing it
+	var failures chan consensus.SealFailure
+	if notifier, ok := w.engine.(consensus.SealFailureNotifier); ok {
+		failures = make(chan consensus.SealFailure, 1)
+		sub := notifier.SubscribeSealFailures(failures)
+		defer sub.Unsubscribe()
+	}
+
 	// commit aborts in-flight transaction execution with given signal and resubmits a new one.
 	commit := func(noempty bool, s int32) {
 		if interrupt != nil {
@@ -474,11 +550,15 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		}
 		interrupt = new(int32)
 		select {
-		case w.newWorkCh <- &newWorkReq{interrupt: interrupt, noempty: noempty, timestamp: timestamp}:
+		case w.newWorkCh <- &newWorkReq{interrupt: interrupt, noempty: noempty, emptyOnly: delayed, timestamp: timestamp}:
 		case <-w.exitCh:
 			return
 		}
-		timer.Reset(recommit)
+		if delayed {
+			timer.Reset(w.config.EmptyDelay)
+		} else {
+			timer.Reset(recommit)
+		}
 		atomic.StoreInt32(&w.newTxs, 0)
 	}
 	// clearPending cleans the stale pending tasks.
@@ -497,17 +577,26 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		case <-w.startCh:
 			clearPending(w.chain.CurrentBlock().Number.Uint64())
 			timestamp = time.Now().Unix()
+			delayed = w.isRunning() && w.config.EmptyDelay > 0
 			commit(false, commitInterruptNewHead)
 
 		case head := <-w.chainHeadCh:
 			clearPending(head.Block.NumberU64())
 			timestamp = time.Now().Unix()
+			delayed = w.isRunning() && w.config.EmptyDelay > 0
 			commit(false, commitInterruptNewHead)
 
 		case <-timer.C:
+			// If only the empty block was sealed and no competing block arrived
+			// in the meantime, include the transactions.
+			if delayed {
+				delayed = false
+				commit(true, commitInterruptResubmit)
+				continue
+			}
 			// If sealing is running resubmit a new work cycle periodically to pull in
 			// higher priced transactions. Disable this overhead for pending blocks.
-			if w.isRunning() && (w.chainConfig.Clique == nil || w.chainConfig.Clique.Period > 0) {
+			if w.isRunning() && w.regeneration.timer && (w.chainConfig.Clique == nil || w.chainConfig.Clique.Period > 0) {
 				// Short circuit if no new transaction arrives.
 				if atomic.LoadInt32(&w.newTxs) == 0 {
 					timer.Reset(recommit)
@@ -516,6 +605,21 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 				commit(true, commitInterruptResubmit)
 			}
 
+		case <-w.regenerateCh:
+			// Enough new transactions arrived, unless they're delayed on purpose.
+			if w.isRunning() && !delayed {
+				commit(true, commitInterruptResubmit)
+			}
+
+		case failure := <-failures:
+			// Sealing was abandoned, rebuild with a fresh timestamp and transactions.
+			if w.isRunning() {
+				log.Debug("Rebuilding abandoned sealing work", "sealhash", failure.SealHash, "err", failure.Err)
+				timestamp = time.Now().Unix()
+				delayed = false
+				commit(false, commitInterruptResubmit)
+			}
+
 		case interval := <-w.resubmitIntervalCh:
 			// Adjust resubmit interval explicitly by user.
 			if interval < minRecommitInterval {
@@ -569,17 +673,27 @@ func (w *worker) mainLoop() {
 	cleanTicker := time.NewTicker(time.Second * 10)
 	defer cleanTicker.Stop()
 
+	// Track the late sealed blocks of the engine as uncle candidates
+	var uncles chan *types.Block
+	if sealer, ok := w.engine.(consensus.UncleSealer); ok {
+		uncles = make(chan *types.Block, chainSideChanSize)
+		sub := sealer.SubscribeUncleCandidates(uncles)
+		defer sub.Unsubscribe()
+	}
+
 	for {
 		select {
 		case req := <-w.newWorkCh:
-			w.commitWork(req.interrupt, req.noempty, req.timestamp)
+			w.newFees.SetUint64(0)
+			w.commitWork(req.interrupt, req.noempty, req.emptyOnly, req.timestamp)
 
 		case req := <-w.getWorkCh:
-			block, fees, err := w.generateWork(req.params)
+			block, fees, receipts, err := w.generateWork(req.params)
 			req.result <- &newPayloadResult{
-				err:   err,
-				block: block,
-				fees:  fees,
+				err:      err,
+				block:    block,
+				fees:     fees,
+				receipts: receipts,
 			}
 		case ev := <-w.chainSideCh:
 			// Short circuit for duplicate side blocks
@@ -598,13 +712,26 @@ func (w *worker) mainLoop() {
 			// If our sealing block contains less than 2 uncle blocks,
 			// add the new uncle block if valid and regenerate a new
 			// sealing block for higher profit.
-			if w.isRunning() && w.current != nil && len(w.current.uncles) < 2 {
+			if w.isRunning() && w.regeneration.uncles && w.current != nil && len(w.current.uncles) < 2 {
 				start := time.Now()
 				if err := w.commitUncle(w.current, ev.Block.Header()); err == nil {
 					w.commit(w.current.copy(), nil, true, start)
 				}
 			}
 
+		case block := <-uncles:
+			// Late sealed blocks of the engine are locally mined uncle candidates
+			if _, exist := w.localUncles[block.Hash()]; exist {
+				continue
+			}
+			w.localUncles[block.Hash()] = block
+			if w.isRunning() && w.regeneration.uncles && w.current != nil && len(w.current.uncles) < 2 {
+				start := time.Now()
+				if err := w.commitUncle(w.current, block.Header()); err == nil {
+					w.commit(w.current.copy(), nil, true, start)
+				}
+			}
+
 		case <-cleanTicker.C:
 			chainHead := w.chain.CurrentBlock()
 			for hash, uncle := range w.localUncles {
@@ -648,10 +775,25 @@ func (w *worker) mainLoop() {
 				// submit sealing work here since all empty submission will be rejected
 				// by clique. Of course the advance sealing(empty submission) is disabled.
 				if w.chainConfig.Clique != nil && w.chainConfig.Clique.Period == 0 {
-					w.commitWork(nil, true, time.Now().Unix())
+					w.commitWork(nil, true, false, time.Now().Unix())
+				}
+			}
+			newTxs := atomic.AddInt32(&w.newTxs, int32(len(ev.Txs)))
+			regenerate := w.regeneration.txs > 0 && newTxs >= w.regeneration.txs
+
+			// Sum up the fees of the new transactions if they regenerate the work
+			if w.regeneration.fees != nil && w.current != nil {
+				for _, tx := range ev.Txs {
+					w.newFees.Add(w.newFees, pendingFees(tx, w.current.header.BaseFee))
+				}
+				regenerate = regenerate || w.newFees.Cmp(w.regeneration.fees) >= 0
+			}
+			if w.isRunning() && regenerate {
+				select {
+				case w.regenerateCh <- struct{}{}:
+				default:
 				}
 			}
-			atomic.AddInt32(&w.newTxs, int32(len(ev.Txs)))
 
 		// System stopped
 		case <-w.exitCh:
@@ -671,15 +813,15 @@ func (w *worker) mainLoop() {
 func (w *worker) taskLoop() {
 	defer w.wg.Done()
 	var (
-		stopCh chan struct{}
+		cancel context.CancelFunc
 		prev   common.Hash
 	)
 
 	// interrupt aborts the in-flight sealing task.
 	interrupt := func() {
-		if stopCh != nil {
-			close(stopCh)
-			stopCh = nil
+		if cancel != nil {
+			cancel()
+			cancel = nil
 		}
 	}
 	for {
@@ -695,7 +837,8 @@ func (w *worker) taskLoop() {
 			}
 			// Interrupt previous sealing operation
 			interrupt()
-			stopCh, prev = make(chan struct{}), sealHash
+			ctx, stop := context.WithCancel(context.Background())
+			cancel, prev = stop, sealHash
 
 			if w.skipSealHook != nil && w.skipSealHook(task) {
 				continue
@@ -704,7 +847,7 @@ func (w *worker) taskLoop() {
 			w.pendingTasks[sealHash] = task
 			w.pendingMu.Unlock()
 
-			if err := w.engine.Seal(w.chain, task.block, w.resultCh, stopCh); err != nil {
+			if err := w.seal(ctx, task.block); err != nil {
 				log.Warn("Block sealing failed", "err", err)
 				w.pendingMu.Lock()
 				delete(w.pendingTasks, sealHash)
@@ -717,6 +860,15 @@ func (w *worker) taskLoop() {
 	}
 }
 
+// seal hands a block to the consensus engine for sealing until the context is
+// cancelled, which engines supporting it honour without racing a late result.
+func (w *worker) seal(ctx context.Context, block *types.Block) error {
+	if sealer, ok := w.engine.(consensus.ContextSealer); ok {
+		return sealer.SealContext(ctx, w.chain, block, w.resultCh)
+	}
+	return w.engine.Seal(w.chain, block, w.resultCh, ctx.Done())
+}
+
 // resultLoop is a standalone goroutine to handle sealing result submitting
 // and flush relative data to the database.
 func (w *worker) resultLoop() {
@@ -878,7 +1030,7 @@ func (w *worker) commitTransaction(env *environment, tx *types.Transaction) ([]*
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByPriceAndNonce, interrupt *int32) error {
+func (w *worker) commitTransactions(env *environment, txs txIterator, interrupt *int32) error {
 	gasLimit := env.header.GasLimit
 	if env.gasPool == nil {
 		env.gasPool = new(core.GasPool).AddGas(gasLimit)
@@ -972,14 +1124,16 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 
 // generateParams wraps various of settings for generating sealing task.
 type generateParams struct {
-	timestamp   uint64            // The timstamp for sealing task
-	forceTime   bool              // Flag whether the given timestamp is immutable or not
-	parentHash  common.Hash       // Parent block hash, empty means the latest chain head
-	coinbase    common.Address    // The fee recipient address for including transaction
-	random      common.Hash       // The randomness generated by beacon chain, empty before the merge
-	withdrawals types.Withdrawals // List of withdrawals to include in block.
-	noUncle     bool              // Flag whether the uncle block inclusion is allowed
-	noTxs       bool              // Flag whether an empty block without any transaction is expected
+	timestamp   uint64             // The timstamp for sealing task
+	forceTime   bool               // Flag whether the given timestamp is immutable or not
+	parentHash  common.Hash        // Parent block hash, empty means the latest chain head
+	coinbase    common.Address     // The fee recipient address for including transaction
+	rotate      bool               // Flag whether the coinbase rotation, if any, overrides the coinbase
+	random      common.Hash        // The randomness generated by beacon chain, empty before the merge
+	withdrawals types.Withdrawals  // List of withdrawals to include in block.
+	noUncle     bool               // Flag whether the uncle block inclusion is allowed
+	noTxs       bool               // Flag whether an empty block without any transaction is expected
+	txs         types.Transactions // Transactions chosen by the caller instead of the pending ones, if any
 }
 
 // prepareWork constructs the sealing task according to the given parameters,
@@ -1007,13 +1161,19 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 		}
 		timestamp = parent.Time + 1
 	}
+	// Credit the block to the address in turn if the coinbase is rotated.
+	number := new(big.Int).Add(parent.Number, common.Big1)
+	coinbase := genParams.coinbase
+	if genParams.rotate && w.rotation != nil {
+		coinbase = w.rotation.coinbase(number.Uint64())
+	}
 	// Construct the sealing block header.
 	header := &types.Header{
 		ParentHash: parent.Hash(),
-		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Number:     number,
 		GasLimit:   core.CalcGasLimit(parent.GasLimit, w.config.GasCeil),
 		Time:       timestamp,
-		Coinbase:   genParams.coinbase,
+		Coinbase:   coinbase,
 	}
 	// Set the extra field.
 	if len(w.extra) != 0 {
@@ -1037,9 +1197,9 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 		return nil, err
 	}
 	// Could potentially happen if starting to mine in an odd state.
-	// Note genParams.coinbase can be different with header.Coinbase
+	// Note the coinbase can be different with header.Coinbase
 	// since clique algorithm can modify the coinbase field in header.
-	env, err := w.makeEnv(parent, header, genParams.coinbase)
+	env, err := w.makeEnv(parent, header, coinbase)
 	if err != nil {
 		log.Error("Failed to create sealing context", "err", err)
 		return nil, err
@@ -1069,9 +1229,14 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 // into the given sealing block. The transaction selection and ordering strategy can
 // be customized with the plugin in the future.
 func (w *worker) fillTransactions(interrupt *int32, env *environment) error {
-	// Split the pending transactions into locals and remotes
-	// Fill the block with all available pending transactions.
+	// Fill the block with all available pending transactions, in the order
+	// chosen by the orderer if one is set.
 	pending := w.eth.TxPool().Pending(true)
+	if orderer := w.txOrderer(); orderer != nil {
+		txs := orderer.Order(types.CopyHeader(env.header), env.signer, pending)
+		return w.commitTransactions(env, newOrderedTxs(env.signer, txs), interrupt)
+	}
+	// Split the pending transactions into locals and remotes
 	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
 	for _, account := range w.eth.TxPool().Locals() {
 		if txs := remoteTxs[account]; len(txs) > 0 {
@@ -1094,15 +1259,35 @@ func (w *worker) fillTransactions(interrupt *int32, env *environment) error {
 	return nil
 }
 
+// commitChosenTransactions fills the given transactions into the sealing block
+// in order, failing if any of them can't be included.
+func (w *worker) commitChosenTransactions(env *environment, txs types.Transactions) error {
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	for i, tx := range txs {
+		env.state.SetTxContext(tx.Hash(), env.tcount)
+		if _, err := w.commitTransaction(env, tx); err != nil {
+			return fmt.Errorf("transaction %d (%x) rejected: %w", i, tx.Hash(), err)
+		}
+		env.tcount++
+	}
+	return nil
+}
+
 // generateWork generates a sealing block based on the given parameters.
-func (w *worker) generateWork(params *generateParams) (*types.Block, *big.Int, error) {
+func (w *worker) generateWork(params *generateParams) (*types.Block, *big.Int, []*types.Receipt, error) {
 	work, err := w.prepareWork(params)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	defer work.discard()
 
-	if !params.noTxs {
+	if params.txs != nil {
+		if err := w.commitChosenTransactions(work, params.txs); err != nil {
+			return nil, nil, nil, err
+		}
+	} else if !params.noTxs {
 		interrupt := new(int32)
 		timer := time.AfterFunc(w.newpayloadTimeout, func() {
 			atomic.StoreInt32(interrupt, commitInterruptTimeout)
@@ -1116,14 +1301,14 @@ func (w *worker) generateWork(params *generateParams) (*types.Block, *big.Int, e
 	}
 	block, err := w.engine.FinalizeAndAssemble(w.chain, work.header, work.state, work.txs, work.unclelist(), work.receipts, params.withdrawals)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	return block, totalFees(block, work.receipts), nil
+	return block, totalFees(block, work.receipts), work.receipts, nil
 }
 
 // commitWork generates several new sealing tasks based on the parent block
 // and submit them to the sealer.
-func (w *worker) commitWork(interrupt *int32, noempty bool, timestamp int64) {
+func (w *worker) commitWork(interrupt *int32, noempty bool, emptyOnly bool, timestamp int64) {
 	start := time.Now()
 
 	// Set the coinbase if the worker is running or it's required
@@ -1138,10 +1323,21 @@ func (w *worker) commitWork(interrupt *int32, noempty bool, timestamp int64) {
 	work, err := w.prepareWork(&generateParams{
 		timestamp: uint64(timestamp),
 		coinbase:  coinbase,
+		rotate:    w.isRunning(),
 	})
 	if err != nil {
 		return
 	}
+	// Seal only the empty block if the transactions are delayed, they are
+	// included by the next commit unless a competing block arrives first.
+	if emptyOnly {
+		w.commit(work.copy(), nil, true, start)
+		if w.current != nil {
+			w.current.discard()
+		}
+		w.current = work
+		return
+	}
 	// Create an empty block based on temporary copied state for
 	// sealing in advance without waiting block execution finished.
 	if !noempty && atomic.LoadUint32(&w.noempty) == 0 {
@@ -128,7 +128,7 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 		e.Authorize(testBankAddress, func(account accounts.Account, s string, data []byte) ([]byte, error) {
 			return crypto.Sign(crypto.Keccak256(data), testBankKey)
 		})
-	case *ethash.Ethash:
+	case *ethash.Hmhash:
 	default:
 		t.Fatalf("unexpected consensus engine type: %T", engine)
 	}
@@ -319,6 +319,46 @@ func testEmptyWork(t *testing.T, chainConfig *params.ChainConfig, engine consens
 	}
 }
 
+// Tests that with an empty delay only the empty block is sealed on a new head
+// until the delay passes.
+func TestEmptyDelay(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	config := *testConfig
+	config.EmptyDelay = 300 * time.Millisecond
+
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	backend.txPool.AddLocals(pendingTxs)
+	w := newWorker(&config, ethashChainConfig, engine, backend, new(event.TypeMux), nil, false)
+	w.setEtherbase(testBankAddress)
+	defer w.close()
+
+	tasks := make(chan *task, 2)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 {
+			tasks <- task
+		}
+	}
+	w.skipSealHook = func(task *task) bool { return true }
+
+	start := time.Now()
+	w.start()
+	for i, want := range []int{0, 1} {
+		select {
+		case task := <-tasks:
+			if len(task.receipts) != want {
+				t.Fatalf("task %d: receipt number mismatch: have %d, want %d", i, len(task.receipts), want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("task %d: timeout", i)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < config.EmptyDelay {
+		t.Errorf("transactions included after %v, before the delay", elapsed)
+	}
+}
+
 func TestStreamUncleBlock(t *testing.T) {
 	ethash := ethash.NewFaker()
 	defer ethash.Close()
@@ -17,11 +17,15 @@
 package params
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -452,7 +456,828 @@ type ChainConfig struct {
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
-type EthashConfig struct{}
+type EthashConfig struct {
+	ProgpowBlock    *big.Int                `json:"progpowBlock,omitempty"`    // ProgPoW switch block (nil = no fork, 0 = already activated)
+	AuxPoWBlock     *big.Int                `json:"auxPowBlock,omitempty"`     // Merged mining switch block (nil = no fork, 0 = already activated)
+	DifficultyAlgos []*DifficultyAlgoConfig `json:"difficultyAlgos,omitempty"` // Difficulty algorithm switches, ordered by activation block
+	DifficultyBomb  *DifficultyBombConfig   `json:"difficultyBomb,omitempty"`  // Difficulty bomb override (nil = Ethereum ice age)
+	RewardSchedule  []*RewardConfig         `json:"rewardSchedule,omitempty"`  // Block reward steps, ordered by activation block (nil = Ethereum rewards)
+	Treasury        *TreasuryConfig         `json:"treasury,omitempty"`        // Treasury share of the block rewards (nil = none)
+	BlockTime       uint64                  `json:"blockTime,omitempty"`       // Targeted block time in seconds (0 = 13, as Ethereum)
+	BlockTimeBlock  *big.Int                `json:"blockTimeBlock,omitempty"`  // Targeted block time switch block (nil = genesis)
+	Hybrid          *HybridConfig           `json:"hybrid,omitempty"`          // Validator sealed blocks (nil = proof-of-work only)
+	Finality        *FinalityConfig         `json:"finality,omitempty"`        // Checkpoint finality (nil = none)
+	ExtraData       *ExtraDataConfig        `json:"extraData,omitempty"`       // Extra-data policy (nil = any up to MaximumExtraDataSize)
+	DifficultyRange *DifficultyRangeConfig  `json:"difficultyRange,omitempty"` // Difficulty floor and ceiling (nil = MinimumDifficulty floor only)
+	Emergency       *EmergencyConfig        `json:"emergency,omitempty"`       // Emergency difficulty adjustment after stalls (nil = none)
+	MedianTime      *MedianTimeConfig       `json:"medianTime,omitempty"`      // Median-time-past rule (nil = parent timestamp only)
+	MultiAlgo       *MultiAlgoConfig        `json:"multiAlgo,omitempty"`       // Hash algorithm rotation (nil = node's hash algorithm)
+	CPUPoWBlock     *big.Int                `json:"cpuPowBlock,omitempty"`     // CPU-friendly proof-of-work switch block (nil = no fork, 0 = already activated)
+}
+
+// MultiAlgoConfig rotates the proof-of-work hash algorithm of the blocks of an
+// ethash chain by height from its activation block onwards, so diverse hardware
+// can take part in mining. Every algorithm tracks its own difficulty, adjusted
+// from the previous block of the same algorithm. The algorithms are named as the
+// hash algorithms of the ethash engine.
+type MultiAlgoConfig struct {
+	Block *big.Int `json:"block"` // Activation block
+	Algos []string `json:"algos"` // Hash algorithms, block n is sealed with Algos[n % len(Algos)]
+}
+
+// AlgoAt returns the hash algorithm of the rotation sealing block num, empty if
+// the rotation is not active at it.
+func (c *MultiAlgoConfig) AlgoAt(num *big.Int) string {
+	if c == nil || len(c.Algos) == 0 || !isBlockForked(c.Block, num) {
+		return ""
+	}
+	return c.Algos[new(big.Int).Mod(num, big.NewInt(int64(len(c.Algos)))).Int64()]
+}
+
+// checkMultiAlgo ensures the hash algorithm rotation is well formed and not
+// combined with windowed difficulty algorithms, which would average over the
+// blocks of all the algorithms.
+func (c *EthashConfig) checkMultiAlgo() error {
+	rotation := c.MultiAlgo
+	if rotation == nil {
+		return nil
+	}
+	if rotation.Block == nil {
+		return errors.New("hash algorithm rotation has no activation block")
+	}
+	if len(rotation.Algos) < 2 {
+		return errors.New("hash algorithm rotation needs at least two algorithms")
+	}
+	for _, algo := range rotation.Algos {
+		if algo == "" {
+			return errors.New("hash algorithm rotation has an unnamed algorithm")
+		}
+	}
+	for _, algo := range c.DifficultyAlgos {
+		if algo.Algo == DifficultyAlgoDigishield || algo.Algo == DifficultyAlgoLWMA {
+			return fmt.Errorf("hash algorithm rotation incompatible with %s difficulty algorithm", algo.Algo)
+		}
+	}
+	return nil
+}
+
+// checkMultiAlgoCompatible returns an error if the hash algorithm rotation was
+// changed while active at or below the head block.
+func (c *EthashConfig) checkMultiAlgoCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	var stored, updated MultiAlgoConfig
+	if c.MultiAlgo != nil {
+		stored = *c.MultiAlgo
+	}
+	if newcfg.MultiAlgo != nil {
+		updated = *newcfg.MultiAlgo
+	}
+	if isForkBlockIncompatible(stored.Block, updated.Block, head) {
+		return newBlockCompatError("Hash algorithm rotation fork block", stored.Block, updated.Block)
+	}
+	if isBlockForked(stored.Block, head) && strings.Join(stored.Algos, ",") != strings.Join(updated.Algos, ",") {
+		return newBlockCompatError("Hash algorithm rotation", stored.Block, updated.Block)
+	}
+	return nil
+}
+
+// MedianTimeConfig requires the timestamp of the blocks of an ethash chain to
+// exceed the median timestamp of their last ancestors from its activation block
+// onwards, hardening small networks against timestamp games manipulating the
+// difficulty.
+type MedianTimeConfig struct {
+	Block  *big.Int `json:"block"`            // Activation block
+	Window uint64   `json:"window,omitempty"` // Number of ancestors (0 = DefaultMedianTimeWindow)
+}
+
+// DefaultMedianTimeWindow is the number of ancestors of the median-time-past
+// rule if it doesn't set one, as Bitcoin.
+const DefaultMedianTimeWindow = 11
+
+// Ancestors returns the number of ancestors of the median-time-past rule.
+func (c *MedianTimeConfig) Ancestors() uint64 {
+	if c.Window != 0 {
+		return c.Window
+	}
+	return DefaultMedianTimeWindow
+}
+
+// MedianTimeAt returns the median-time-past rule active at block num, nil if
+// none.
+func (c *EthashConfig) MedianTimeAt(num *big.Int) *MedianTimeConfig {
+	if c == nil || c.MedianTime == nil || !isBlockForked(c.MedianTime.Block, num) {
+		return nil
+	}
+	return c.MedianTime
+}
+
+// checkMedianTimeCompatible returns an error if the median-time-past rule was
+// changed while active at or below the head block.
+func (c *EthashConfig) checkMedianTimeCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	var stored, updated MedianTimeConfig
+	if c.MedianTime != nil {
+		stored = *c.MedianTime
+	}
+	if newcfg.MedianTime != nil {
+		updated = *newcfg.MedianTime
+	}
+	if isForkBlockIncompatible(stored.Block, updated.Block, head) {
+		return newBlockCompatError("Median-time-past fork block", stored.Block, updated.Block)
+	}
+	if isBlockForked(stored.Block, head) && stored.Ancestors() != updated.Ancestors() {
+		return newBlockCompatError("Median-time-past window", stored.Block, updated.Block)
+	}
+	return nil
+}
+
+// EmergencyConfig cuts the difficulty of a block sharply if its parent is older
+// than a number of targeted block times, so a small network recovers on its own
+// after a major miner leaves. The difficulty is divided by the divisor for every
+// stall period elapsed since the parent.
+type EmergencyConfig struct {
+	Block   *big.Int `json:"block"`             // Activation block
+	Stall   uint64   `json:"stall"`             // Stall period, in targeted block times
+	Divisor uint64   `json:"divisor,omitempty"` // Difficulty cut per stall period (0 = DefaultEmergencyDivisor)
+}
+
+// DefaultEmergencyDivisor is the difficulty cut per stall period if the
+// emergency difficulty adjustment doesn't set one.
+const DefaultEmergencyDivisor = 4
+
+// CutDivisor returns the difficulty cut per stall period.
+func (c *EmergencyConfig) CutDivisor() uint64 {
+	if c.Divisor != 0 {
+		return c.Divisor
+	}
+	return DefaultEmergencyDivisor
+}
+
+// EmergencyAt returns the emergency difficulty adjustment active at block num,
+// nil if none.
+func (c *EthashConfig) EmergencyAt(num *big.Int) *EmergencyConfig {
+	if c == nil || c.Emergency == nil || !isBlockForked(c.Emergency.Block, num) {
+		return nil
+	}
+	return c.Emergency
+}
+
+// checkEmergency ensures the emergency difficulty adjustment is well formed.
+func (c *EthashConfig) checkEmergency() error {
+	eda := c.Emergency
+	if eda == nil {
+		return nil
+	}
+	if eda.Block == nil {
+		return errors.New("emergency difficulty adjustment has no activation block")
+	}
+	if eda.Stall < 2 {
+		return fmt.Errorf("emergency difficulty stall period of %d block times too short", eda.Stall)
+	}
+	if eda.Divisor == 1 {
+		return errors.New("emergency difficulty divisor of 1 cuts nothing")
+	}
+	return nil
+}
+
+// checkEmergencyCompatible returns an error if the emergency difficulty
+// adjustment was changed while active at or below the head block.
+func (c *EthashConfig) checkEmergencyCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	var stored, updated EmergencyConfig
+	if c.Emergency != nil {
+		stored = *c.Emergency
+	}
+	if newcfg.Emergency != nil {
+		updated = *newcfg.Emergency
+	}
+	if isForkBlockIncompatible(stored.Block, updated.Block, head) {
+		return newBlockCompatError("Emergency difficulty fork block", stored.Block, updated.Block)
+	}
+	if isBlockForked(stored.Block, head) && (stored.Stall != updated.Stall || stored.CutDivisor() != updated.CutDivisor()) {
+		return newBlockCompatError("Emergency difficulty adjustment", stored.Block, updated.Block)
+	}
+	return nil
+}
+
+// DifficultyRangeConfig bounds the difficulty of the blocks of an ethash chain
+// from its activation block onwards, keeping devnets from drifting to absurd
+// difficulties, e.g. after a long downtime. The stock difficulty adjustment never
+// goes below MinimumDifficulty, lower floors only apply to the alternative
+// difficulty algorithms.
+type DifficultyRangeConfig struct {
+	Block   *big.Int `json:"block"`             // Activation block
+	Minimum *big.Int `json:"minimum,omitempty"` // Difficulty floor (nil = MinimumDifficulty)
+	Maximum *big.Int `json:"maximum,omitempty"` // Difficulty ceiling (nil = none)
+}
+
+// Floor returns the minimum difficulty of the blocks.
+func (c *DifficultyRangeConfig) Floor() *big.Int {
+	if c.Minimum != nil {
+		return c.Minimum
+	}
+	return MinimumDifficulty
+}
+
+// DifficultyRangeAt returns the difficulty range active at block num, nil if
+// none.
+func (c *EthashConfig) DifficultyRangeAt(num *big.Int) *DifficultyRangeConfig {
+	if c == nil || c.DifficultyRange == nil || !isBlockForked(c.DifficultyRange.Block, num) {
+		return nil
+	}
+	return c.DifficultyRange
+}
+
+// checkDifficultyRange ensures the difficulty range is well formed.
+func (c *EthashConfig) checkDifficultyRange() error {
+	bounds := c.DifficultyRange
+	if bounds == nil {
+		return nil
+	}
+	if bounds.Block == nil {
+		return errors.New("difficulty range has no activation block")
+	}
+	if bounds.Minimum != nil && bounds.Minimum.Sign() <= 0 {
+		return fmt.Errorf("invalid minimum difficulty %v", bounds.Minimum)
+	}
+	if bounds.Maximum != nil && bounds.Maximum.Cmp(bounds.Floor()) < 0 {
+		return fmt.Errorf("maximum difficulty %v below minimum %v", bounds.Maximum, bounds.Floor())
+	}
+	return nil
+}
+
+// checkDifficultyRangeCompatible returns an error if the difficulty range
+// was changed while active at or below the head block.
+func (c *EthashConfig) checkDifficultyRangeCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	var stored, updated DifficultyRangeConfig
+	if c.DifficultyRange != nil {
+		stored = *c.DifficultyRange
+	}
+	if newcfg.DifficultyRange != nil {
+		updated = *newcfg.DifficultyRange
+	}
+	if isForkBlockIncompatible(stored.Block, updated.Block, head) {
+		return newBlockCompatError("Difficulty range fork block", stored.Block, updated.Block)
+	}
+	if isBlockForked(stored.Block, head) && (!configBlockEqual(stored.Minimum, updated.Minimum) || !configBlockEqual(stored.Maximum, updated.Maximum)) {
+		return newBlockCompatError("Difficulty range", stored.Block, updated.Block)
+	}
+	return nil
+}
+
+// ExtraDataConfig restricts the extra-data of the blocks of an ethash chain from
+// its activation block onwards, e.g. for a consortium to mandate the miners to
+// identify themselves. The rules apply to the vanity of the extra-data, without
+// the signature of validator sealed blocks or the auxiliary proof-of-work of
+// merge-mined ones.
+type ExtraDataConfig struct {
+	Block     *big.Int        `json:"block"`               // Activation block
+	MaxLength uint64          `json:"maxLength,omitempty"` // Maximum vanity length (0 = MaximumExtraDataSize)
+	Prefix    hexutil.Bytes   `json:"prefix,omitempty"`    // Tag the vanity has to start with
+	Denied    []hexutil.Bytes `json:"denied,omitempty"`    // Tags the vanity mustn't contain
+}
+
+// MaxVanity returns the maximum length of the extra-data vanity.
+func (c *ExtraDataConfig) MaxVanity() uint64 {
+	if c.MaxLength != 0 {
+		return c.MaxLength
+	}
+	return MaximumExtraDataSize
+}
+
+// ExtraDataRules returns the extra-data policy active at block num, nil if
+// none.
+func (c *EthashConfig) ExtraDataRules(num *big.Int) *ExtraDataConfig {
+	if c == nil || c.ExtraData == nil || !isBlockForked(c.ExtraData.Block, num) {
+		return nil
+	}
+	return c.ExtraData
+}
+
+// checkExtraData ensures the extra-data policy is well formed. Merge-mined
+// blocks are told apart by their extra-data exceeding MaximumExtraDataSize, so
+// longer vanities are only allowed on chains without merged mining.
+func (c *EthashConfig) checkExtraData(auxpow bool) error {
+	rules := c.ExtraData
+	if rules == nil {
+		return nil
+	}
+	if rules.Block == nil {
+		return errors.New("extra-data policy has no activation block")
+	}
+	if auxpow && rules.MaxVanity() > MaximumExtraDataSize {
+		return fmt.Errorf("extra-data length %d exceeds %d on merge-mined chain", rules.MaxVanity(), MaximumExtraDataSize)
+	}
+	if uint64(len(rules.Prefix)) > rules.MaxVanity() {
+		return fmt.Errorf("extra-data prefix exceeds maximum length %d", rules.MaxVanity())
+	}
+	for _, tag := range rules.Denied {
+		if len(tag) == 0 {
+			return errors.New("empty denied extra-data tag")
+		}
+	}
+	return nil
+}
+
+// checkExtraDataCompatible returns an error if the extra-data policy was
+// changed while active at or below the head block.
+func (c *EthashConfig) checkExtraDataCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	var stored, updated ExtraDataConfig
+	if c.ExtraData != nil {
+		stored = *c.ExtraData
+	}
+	if newcfg.ExtraData != nil {
+		updated = *newcfg.ExtraData
+	}
+	if isForkBlockIncompatible(stored.Block, updated.Block, head) {
+		return newBlockCompatError("Extra-data policy fork block", stored.Block, updated.Block)
+	}
+	if isBlockForked(stored.Block, head) && !stored.equalRules(&updated) {
+		return newBlockCompatError("Extra-data policy", stored.Block, updated.Block)
+	}
+	return nil
+}
+
+// equalRules returns whether two extra-data policies enforce the same rules.
+func (c *ExtraDataConfig) equalRules(other *ExtraDataConfig) bool {
+	if c.MaxVanity() != other.MaxVanity() || !bytes.Equal(c.Prefix, other.Prefix) || len(c.Denied) != len(other.Denied) {
+		return false
+	}
+	for i, tag := range c.Denied {
+		if !bytes.Equal(tag, other.Denied[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// FinalityConfig enables checkpoint finality on an ethash chain: every Interval
+// blocks, a checkpoint co-signed by a quorum of the signers is finalized and the
+// chain can't be reorganized across it anymore.
+type FinalityConfig struct {
+	Interval uint64           `json:"interval"`         // Distance between checkpoint blocks
+	Signers  []common.Address `json:"signers"`          // Checkpoint signers
+	Quorum   uint64           `json:"quorum,omitempty"` // Signatures finalizing a checkpoint (0 = more than two thirds)
+}
+
+// Threshold returns the number of signatures finalizing a checkpoint.
+func (c *FinalityConfig) Threshold() int {
+	if c.Quorum != 0 {
+		return int(c.Quorum)
+	}
+	return len(c.Signers)*2/3 + 1
+}
+
+// checkFinality ensures the checkpoint finality is well formed.
+func (c *EthashConfig) checkFinality() error {
+	finality := c.Finality
+	if finality == nil {
+		return nil
+	}
+	if finality.Interval == 0 {
+		return errors.New("checkpoint finality has no interval")
+	}
+	if len(finality.Signers) == 0 {
+		return errors.New("checkpoint finality has no signers")
+	}
+	if finality.Quorum > uint64(len(finality.Signers)) {
+		return fmt.Errorf("checkpoint quorum %d exceeds the %d signers", finality.Quorum, len(finality.Signers))
+	}
+	return nil
+}
+
+// checkFinalityCompatible returns an error if the checkpoint finality was
+// changed while there were checkpoints at or below the head block.
+func (c *EthashConfig) checkFinalityCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	stored, updated := c.Finality, newcfg.Finality
+	if stored == nil && updated == nil {
+		return nil
+	}
+	if stored != nil && updated != nil && stored.Interval == updated.Interval &&
+		stored.Threshold() == updated.Threshold() && addressesEqual(stored.Signers, updated.Signers) {
+		return nil
+	}
+	var storedBlock, updatedBlock *big.Int
+	if stored != nil {
+		storedBlock = new(big.Int).SetUint64(stored.Interval)
+	}
+	if updated != nil {
+		updatedBlock = new(big.Int).SetUint64(updated.Interval)
+	}
+	if isBlockForked(storedBlock, head) || isBlockForked(updatedBlock, head) {
+		return newBlockCompatError("Checkpoint finality", storedBlock, updatedBlock)
+	}
+	return nil
+}
+
+// HybridConfig mixes validator sealed blocks into an ethash chain: from the
+// activation block onwards, every Period-th block (or every block if Period is
+// zero) is sealed by the signature of a validator instead of a proof-of-work.
+// The signers of validator blocks are checked against Signers with the header
+// alone, and against the validator set of the system contract in the state of
+// the parent, if any. Validator blocks add the minimal difficulty to the chain,
+// so the fork choice stays with the proof-of-work.
+type HybridConfig struct {
+	Block      *big.Int         `json:"block"`                // Activation block
+	Period     uint64           `json:"period,omitempty"`     // Distance between validator sealed blocks (0 = all blocks)
+	Signers    []common.Address `json:"signers"`              // Addresses allowed to seal validator blocks
+	Validators common.Address   `json:"validators,omitempty"` // System contract narrowing down the signers (zero = none)
+}
+
+// IsSigner returns whether an address is allowed to seal validator blocks.
+func (c *HybridConfig) IsSigner(addr common.Address) bool {
+	for _, signer := range c.Signers {
+		if signer == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHybrid ensures the validator sealed blocks are well formed.
+func (c *EthashConfig) checkHybrid() error {
+	hybrid := c.Hybrid
+	if hybrid == nil {
+		return nil
+	}
+	if hybrid.Block == nil {
+		return errors.New("hybrid validator blocks have no activation block")
+	}
+	if len(hybrid.Signers) == 0 {
+		return errors.New("hybrid validator blocks have no signers")
+	}
+	return nil
+}
+
+// IsValidatorBlock returns whether block num must be sealed by a validator.
+func (c *EthashConfig) IsValidatorBlock(num *big.Int) bool {
+	if c == nil || c.Hybrid == nil || !isBlockForked(c.Hybrid.Block, num) {
+		return false
+	}
+	return c.Hybrid.Period == 0 || new(big.Int).Mod(num, new(big.Int).SetUint64(c.Hybrid.Period)).Sign() == 0
+}
+
+// TreasuryConfig splits a share of the block reward of an ethash chain off to a
+// treasury, either a single address or a list of weighted recipients.
+type TreasuryConfig struct {
+	Block      *big.Int             `json:"block"`                // Activation block
+	EndBlock   *big.Int             `json:"endBlock,omitempty"`   // Deactivation block (nil = never)
+	Percent    uint64               `json:"percent"`              // Percentage of the block reward paid to the treasury
+	Address    common.Address       `json:"address,omitempty"`    // Treasury address, if there are no recipients
+	Recipients []*TreasuryRecipient `json:"recipients,omitempty"` // Weighted treasury recipients
+}
+
+// TreasuryRecipient is a treasury address paid in proportion to its weight.
+type TreasuryRecipient struct {
+	Address common.Address `json:"address"`
+	Weight  uint64         `json:"weight"`
+}
+
+// IsActive returns whether the treasury is paid at block num.
+func (c *TreasuryConfig) IsActive(num *big.Int) bool {
+	return isBlockForked(c.Block, num) && !isBlockForked(c.EndBlock, num)
+}
+
+// checkHybridCompatible returns an error if the validator sealed blocks were
+// changed while active at or below the head block.
+func (c *EthashConfig) checkHybridCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	var stored, updated HybridConfig
+	if c.Hybrid != nil {
+		stored = *c.Hybrid
+	}
+	if newcfg.Hybrid != nil {
+		updated = *newcfg.Hybrid
+	}
+	if isForkBlockIncompatible(stored.Block, updated.Block, head) {
+		return newBlockCompatError("Hybrid fork block", stored.Block, updated.Block)
+	}
+	if isBlockForked(stored.Block, head) && (stored.Period != updated.Period || stored.Validators != updated.Validators || !addressesEqual(stored.Signers, updated.Signers)) {
+		return newBlockCompatError("Hybrid validator blocks", stored.Block, updated.Block)
+	}
+	return nil
+}
+
+// addressesEqual reports whether two address lists are equal.
+func addressesEqual(x, y []common.Address) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTreasury ensures the treasury split is well formed.
+func (c *EthashConfig) checkTreasury() error {
+	treasury := c.Treasury
+	if treasury == nil {
+		return nil
+	}
+	if treasury.Block == nil {
+		return errors.New("treasury has no activation block")
+	}
+	if treasury.EndBlock != nil && treasury.EndBlock.Cmp(treasury.Block) <= 0 {
+		return fmt.Errorf("treasury deactivated at block %v, before its activation at block %v", treasury.EndBlock, treasury.Block)
+	}
+	if treasury.Percent > 100 {
+		return fmt.Errorf("invalid treasury percentage %d", treasury.Percent)
+	}
+	if len(treasury.Recipients) == 0 {
+		return nil
+	}
+	var weights uint64
+	for _, recipient := range treasury.Recipients {
+		weights += recipient.Weight
+	}
+	if weights == 0 {
+		return errors.New("treasury recipients have no weight")
+	}
+	return nil
+}
+
+// checkTreasuryCompatible returns an error if the treasury split was changed
+// while it was active at or below the head block.
+func (c *EthashConfig) checkTreasuryCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	stored, updated := c.Treasury, newcfg.Treasury
+	if stored == nil && updated == nil {
+		return nil
+	}
+	var storedBlock, updatedBlock *big.Int
+	if stored != nil {
+		storedBlock = stored.Block
+	}
+	if updated != nil {
+		updatedBlock = updated.Block
+	}
+	if !isBlockForked(storedBlock, head) && !isBlockForked(updatedBlock, head) {
+		return nil
+	}
+	if stored == nil || updated == nil || !configBlockEqual(stored.Block, updated.Block) ||
+		stored.Percent != updated.Percent || stored.Address != updated.Address || !treasuryRecipientsEqual(stored.Recipients, updated.Recipients) {
+		return newBlockCompatError("Treasury split", storedBlock, updatedBlock)
+	}
+	// Only the deactivation changed, which is fine as long as it's in the future
+	if isForkBlockIncompatible(stored.EndBlock, updated.EndBlock, head) {
+		return newBlockCompatError("Treasury deactivation block", stored.EndBlock, updated.EndBlock)
+	}
+	return nil
+}
+
+// treasuryRecipientsEqual reports whether two treasury recipient lists are equal.
+func treasuryRecipientsEqual(x, y []*TreasuryRecipient) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if *x[i] != *y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RewardConfig sets the block reward of an ethash chain from its activation
+// block onwards.
+type RewardConfig struct {
+	Block               *big.Int `json:"block"`                         // Activation block
+	Reward              *big.Int `json:"reward"`                        // Block reward in wei
+	UncleRewardFraction *big.Rat `json:"uncleRewardFraction,omitempty"` // Share of the Ethereum uncle reward paid to uncles (nil = 1)
+}
+
+// DifficultyBombConfig overrides the exponential difficulty bomb (the "ice age")
+// of the stock ethash difficulty adjustment. As the bomb has no activation block,
+// it must not be changed once it contributed to the difficulty of the chain.
+type DifficultyBombConfig struct {
+	Disabled bool   `json:"disabled,omitempty"` // Whether to remove the bomb entirely
+	Delay    uint64 `json:"delay,omitempty"`    // Blocks to delay the bomb by, on top of the delays of the enabled forks
+	Period   uint64 `json:"period,omitempty"`   // Blocks between doublings of the bomb (0 = 100000)
+}
+
+// DoublingPeriod returns the number of blocks between doublings of the bomb.
+func (c *DifficultyBombConfig) DoublingPeriod() uint64 {
+	if c.Period != 0 {
+		return c.Period
+	}
+	return 100000
+}
+
+// earliestBlock returns the first block the bomb may add difficulty to, nil if
+// never. The bomb delays of the enabled forks are left out, as they only push
+// the bomb further. The Ethereum ice age is used without an override.
+func (c *DifficultyBombConfig) earliestBlock() *big.Int {
+	if c == nil {
+		c = new(DifficultyBombConfig)
+	}
+	if c.Disabled {
+		return nil
+	}
+	// The bomb adds 2^(periods - 2) from the second period on
+	block := new(big.Int).SetUint64(c.DoublingPeriod())
+	block.Lsh(block, 1)
+	return block.Add(block, new(big.Int).SetUint64(c.Delay))
+}
+
+// BlockTimeAt returns the block time targeted at block num in seconds, 0 if the
+// Ethereum one.
+func (c *EthashConfig) BlockTimeAt(num *big.Int) uint64 {
+	if c == nil || c.BlockTime == 0 || (c.BlockTimeBlock != nil && !isBlockForked(c.BlockTimeBlock, num)) {
+		return 0
+	}
+	return c.BlockTime
+}
+
+// blockTimeSwitch returns the block the targeted block time switches at, nil if
+// it never does.
+func (c *EthashConfig) blockTimeSwitch() *big.Int {
+	switch {
+	case c.BlockTime == 0:
+		return nil
+	case c.BlockTimeBlock == nil:
+		return common.Big0
+	default:
+		return c.BlockTimeBlock
+	}
+}
+
+// checkBlockTimeCompatible returns an error if the targeted block time was
+// changed while active at or below the head block.
+func (c *EthashConfig) checkBlockTimeCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	stored, updated := c.blockTimeSwitch(), newcfg.blockTimeSwitch()
+	if isForkBlockIncompatible(stored, updated, head) {
+		return newBlockCompatError("Block time fork block", stored, updated)
+	}
+	if isBlockForked(stored, head) && c.BlockTime != newcfg.BlockTime {
+		return newBlockCompatError("Targeted block time", stored, updated)
+	}
+	return nil
+}
+
+// checkDifficultyBombCompatible returns an error if the difficulty bomb was
+// changed while it might have added to the difficulty of the blocks at or below
+// the head block.
+func (c *EthashConfig) checkDifficultyBombCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	var stored, updated DifficultyBombConfig
+	if c.DifficultyBomb != nil {
+		stored = *c.DifficultyBomb
+	}
+	if newcfg.DifficultyBomb != nil {
+		updated = *newcfg.DifficultyBomb
+	}
+	if stored.Disabled == updated.Disabled && (stored.Disabled || (stored.Delay == updated.Delay && stored.DoublingPeriod() == updated.DoublingPeriod())) {
+		return nil
+	}
+	storedBlock, updatedBlock := stored.earliestBlock(), updated.earliestBlock()
+	if isBlockForked(storedBlock, head) || isBlockForked(updatedBlock, head) {
+		return newBlockCompatError("Difficulty bomb", storedBlock, updatedBlock)
+	}
+	return nil
+}
+
+// Difficulty adjustment algorithms selectable by DifficultyAlgoConfig.
+const (
+	DifficultyAlgoEthash     = "ethash"     // Stock Ethereum difficulty adjustment, including the bomb
+	DifficultyAlgoDigishield = "digishield" // Digishield v3, dampened average over a window
+	DifficultyAlgoLWMA       = "lwma"       // Linearly weighted moving average over a window
+	DifficultyAlgoEMA        = "ema"        // Exponential moving average of the block times
+)
+
+// DifficultyAlgoConfig switches the difficulty adjustment algorithm of an ethash
+// chain from its activation block onwards.
+type DifficultyAlgoConfig struct {
+	Block      *big.Int `json:"block"`                // Activation block
+	Algo       string   `json:"algo"`                 // Name of the algorithm, see the DifficultyAlgo constants
+	TargetTime uint64   `json:"targetTime,omitempty"` // Targeted block time in seconds (0 = algorithm default)
+	Window     uint64   `json:"window,omitempty"`     // Averaging window in blocks (0 = algorithm default)
+}
+
+// DifficultyAlgo returns the difficulty algorithm switch active at block num,
+// or nil if the stock ethash difficulty adjustment is in effect.
+func (c *EthashConfig) DifficultyAlgo(num *big.Int) *DifficultyAlgoConfig {
+	var active *DifficultyAlgoConfig
+	for _, algo := range c.DifficultyAlgos {
+		if isBlockForked(algo.Block, num) {
+			active = algo
+		}
+	}
+	return active
+}
+
+// checkDifficultyAlgos ensures the difficulty algorithm switches are known and
+// ordered by activation block.
+func (c *EthashConfig) checkDifficultyAlgos() error {
+	var last *big.Int
+	for i, algo := range c.DifficultyAlgos {
+		switch algo.Algo {
+		case DifficultyAlgoEthash, DifficultyAlgoDigishield, DifficultyAlgoLWMA, DifficultyAlgoEMA:
+		default:
+			return fmt.Errorf("unsupported difficulty algorithm %q at index %d", algo.Algo, i)
+		}
+		if algo.Block == nil {
+			return fmt.Errorf("difficulty algorithm %q at index %d has no activation block", algo.Algo, i)
+		}
+		if last != nil && last.Cmp(algo.Block) >= 0 {
+			return fmt.Errorf("unsupported difficulty algorithm ordering: %q enabled at block %v, after block %v", algo.Algo, algo.Block, last)
+		}
+		last = algo.Block
+	}
+	return nil
+}
+
+// checkRewardSchedule ensures the block reward steps are well formed and ordered
+// by activation block.
+func (c *EthashConfig) checkRewardSchedule() error {
+	var last *big.Int
+	for i, step := range c.RewardSchedule {
+		if step.Block == nil {
+			return fmt.Errorf("block reward at index %d has no activation block", i)
+		}
+		if step.Reward == nil || step.Reward.Sign() < 0 {
+			return fmt.Errorf("invalid block reward %v at block %v", step.Reward, step.Block)
+		}
+		if step.UncleRewardFraction != nil && step.UncleRewardFraction.Sign() < 0 {
+			return fmt.Errorf("invalid uncle reward fraction %v at block %v", step.UncleRewardFraction, step.Block)
+		}
+		if last != nil && last.Cmp(step.Block) >= 0 {
+			return fmt.Errorf("unsupported block reward ordering: reward changed at block %v, after block %v", step.Block, last)
+		}
+		last = step.Block
+	}
+	return nil
+}
+
+// checkRewardScheduleCompatible returns an error if the block reward steps were
+// changed at or below the head block.
+func (c *EthashConfig) checkRewardScheduleCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	for i := 0; i < len(c.RewardSchedule) || i < len(newcfg.RewardSchedule); i++ {
+		var stored, updated *RewardConfig
+		if i < len(c.RewardSchedule) {
+			stored = c.RewardSchedule[i]
+		}
+		if i < len(newcfg.RewardSchedule) {
+			updated = newcfg.RewardSchedule[i]
+		}
+		if stored != nil && updated != nil && configBlockEqual(stored.Block, updated.Block) &&
+			configBlockEqual(stored.Reward, updated.Reward) && configRatEqual(stored.UncleRewardFraction, updated.UncleRewardFraction) {
+			continue
+		}
+		// The first differing step decides, later ones can only be later
+		var storedBlock, updatedBlock *big.Int
+		if stored != nil {
+			storedBlock = stored.Block
+		}
+		if updated != nil {
+			updatedBlock = updated.Block
+		}
+		if isBlockForked(storedBlock, head) || isBlockForked(updatedBlock, head) {
+			return newBlockCompatError("Block reward schedule", storedBlock, updatedBlock)
+		}
+		return nil
+	}
+	return nil
+}
+
+// configRatEqual reports whether two optional fractions of the chain config are
+// equal.
+func configRatEqual(x, y *big.Rat) bool {
+	if x == nil {
+		return y == nil
+	}
+	if y == nil {
+		return false
+	}
+	return x.Cmp(y) == 0
+}
+
+// checkDifficultyAlgosCompatible returns an error if the difficulty algorithm
+// switches were changed at or below the head block.
+func (c *EthashConfig) checkDifficultyAlgosCompatible(newcfg *EthashConfig, head *big.Int) *ConfigCompatError {
+	for i := 0; i < len(c.DifficultyAlgos) || i < len(newcfg.DifficultyAlgos); i++ {
+		var stored, updated *DifficultyAlgoConfig
+		if i < len(c.DifficultyAlgos) {
+			stored = c.DifficultyAlgos[i]
+		}
+		if i < len(newcfg.DifficultyAlgos) {
+			updated = newcfg.DifficultyAlgos[i]
+		}
+		if stored != nil && updated != nil && configBlockEqual(stored.Block, updated.Block) &&
+			stored.Algo == updated.Algo && stored.TargetTime == updated.TargetTime && stored.Window == updated.Window {
+			continue
+		}
+		// The first differing switch decides, later ones can only be later
+		var storedBlock, updatedBlock *big.Int
+		if stored != nil {
+			storedBlock = stored.Block
+		}
+		if updated != nil {
+			updatedBlock = updated.Block
+		}
+		if isBlockForked(storedBlock, head) || isBlockForked(updatedBlock, head) {
+			return newBlockCompatError("Difficulty algorithm switch", storedBlock, updatedBlock)
+		}
+		return nil
+	}
+	return nil
+}
 
 // String implements the stringer interface, returning the consensus engine details.
 func (c *EthashConfig) String() string {
@@ -528,6 +1353,58 @@ func (c *ChainConfig) Description() string {
 	if c.GrayGlacierBlock != nil {
 		banner += fmt.Sprintf(" - Gray Glacier:                #%-8v (https://github.com/ethereum/execution-specs/blob/master/network-upgrades/mainnet-upgrades/gray-glacier.md)\n", c.GrayGlacierBlock)
 	}
+	if c.Ethash != nil && c.Ethash.ProgpowBlock != nil {
+		banner += fmt.Sprintf(" - ProgPoW:                     #%-8v\n", c.Ethash.ProgpowBlock)
+	}
+	if c.Ethash != nil && c.Ethash.CPUPoWBlock != nil {
+		banner += fmt.Sprintf(" - CPU proof-of-work:           #%-8v\n", c.Ethash.CPUPoWBlock)
+	}
+	if c.Ethash != nil && c.Ethash.AuxPoWBlock != nil {
+		banner += fmt.Sprintf(" - Merged mining:               #%-8v\n", c.Ethash.AuxPoWBlock)
+	}
+	if c.Ethash != nil {
+		for _, algo := range c.Ethash.DifficultyAlgos {
+			banner += fmt.Sprintf(" - Difficulty %-17s #%-8v\n", algo.Algo+":", algo.Block)
+		}
+		if bomb := c.Ethash.DifficultyBomb; bomb != nil {
+			if bomb.Disabled {
+				banner += " - Difficulty bomb:             disabled\n"
+			} else {
+				banner += fmt.Sprintf(" - Difficulty bomb:             delayed %d blocks, doubling every %d blocks\n", bomb.Delay, bomb.DoublingPeriod())
+			}
+		}
+		for _, step := range c.Ethash.RewardSchedule {
+			banner += fmt.Sprintf(" - Block reward:                #%-8v (%v wei)\n", step.Block, step.Reward)
+		}
+		if hybrid := c.Ethash.Hybrid; hybrid != nil {
+			period := "every block"
+			if hybrid.Period > 1 {
+				period = fmt.Sprintf("every %d blocks", hybrid.Period)
+			}
+			banner += fmt.Sprintf(" - Hybrid validator blocks:     #%-8v (%s, validators at %s)\n", hybrid.Block, period, hybrid.Validators.Hex())
+		}
+		if finality := c.Ethash.Finality; finality != nil {
+			banner += fmt.Sprintf(" - Checkpoint finality:         every %d blocks, %d of %d signers\n", finality.Interval, finality.Threshold(), len(finality.Signers))
+		}
+		if block := c.Ethash.blockTimeSwitch(); block != nil {
+			banner += fmt.Sprintf(" - Target block time:           #%-8v (%ds)\n", block, c.Ethash.BlockTime)
+		}
+		if eda := c.Ethash.Emergency; eda != nil {
+			banner += fmt.Sprintf(" - Emergency difficulty:        #%-8v (1/%d after %d block times)\n", eda.Block, eda.CutDivisor(), eda.Stall)
+		}
+		if mtp := c.Ethash.MedianTime; mtp != nil {
+			banner += fmt.Sprintf(" - Median-time-past:            #%-8v (%d ancestors)\n", mtp.Block, mtp.Ancestors())
+		}
+		if rotation := c.Ethash.MultiAlgo; rotation != nil {
+			banner += fmt.Sprintf(" - Hash algorithm rotation:     #%-8v (%s)\n", rotation.Block, strings.Join(rotation.Algos, ", "))
+		}
+		if treasury := c.Ethash.Treasury; treasury != nil {
+			banner += fmt.Sprintf(" - Treasury:                    #%-8v (%d%% of the block reward)\n", treasury.Block, treasury.Percent)
+			if treasury.EndBlock != nil {
+				banner += fmt.Sprintf(" - Treasury end:                #%-8v\n", treasury.EndBlock)
+			}
+		}
+	}
 	banner += "\n"
 
 	// Add a special section for the merge as it's non-obvious
@@ -631,6 +1508,22 @@ func (c *ChainConfig) IsGrayGlacier(num *big.Int) bool {
 	return isBlockForked(c.GrayGlacierBlock, num)
 }
 
+// IsProgpow returns whether num is either equal to the ProgPoW fork block or greater.
+func (c *ChainConfig) IsProgpow(num *big.Int) bool {
+	return c.Ethash != nil && isBlockForked(c.Ethash.ProgpowBlock, num)
+}
+
+// IsCPUPoW returns whether num is either equal to the CPU proof-of-work fork
+// block or greater.
+func (c *ChainConfig) IsCPUPoW(num *big.Int) bool {
+	return c.Ethash != nil && isBlockForked(c.Ethash.CPUPoWBlock, num)
+}
+
+// IsAuxPoW returns whether num is either equal to the merged mining fork block or greater.
+func (c *ChainConfig) IsAuxPoW(num *big.Int) bool {
+	return c.Ethash != nil && isBlockForked(c.Ethash.AuxPoWBlock, num)
+}
+
 // IsTerminalPoWBlock returns whether the given block is the last block of PoW stage.
 func (c *ChainConfig) IsTerminalPoWBlock(parentTotalDiff *big.Int, totalDiff *big.Int) bool {
 	if c.TerminalTotalDifficulty == nil {
@@ -743,6 +1636,38 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	if c.Ethash != nil {
+		if err := c.Ethash.checkDifficultyAlgos(); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkRewardSchedule(); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkTreasury(); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkHybrid(); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkFinality(); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkExtraData(c.Ethash.AuxPoWBlock != nil); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkDifficultyRange(); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkEmergency(); err != nil {
+			return err
+		}
+		if c.Ethash.MedianTime != nil && c.Ethash.MedianTime.Block == nil {
+			return errors.New("median-time-past rule has no activation block")
+		}
+		if err := c.Ethash.checkMultiAlgo(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -799,6 +1724,53 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, headNumber *big.Int,
 	if isForkBlockIncompatible(c.GrayGlacierBlock, newcfg.GrayGlacierBlock, headNumber) {
 		return newBlockCompatError("Gray Glacier fork block", c.GrayGlacierBlock, newcfg.GrayGlacierBlock)
 	}
+	if c.Ethash != nil && newcfg.Ethash != nil && isForkBlockIncompatible(c.Ethash.ProgpowBlock, newcfg.Ethash.ProgpowBlock, headNumber) {
+		return newBlockCompatError("ProgPoW fork block", c.Ethash.ProgpowBlock, newcfg.Ethash.ProgpowBlock)
+	}
+	if c.Ethash != nil && newcfg.Ethash != nil && isForkBlockIncompatible(c.Ethash.CPUPoWBlock, newcfg.Ethash.CPUPoWBlock, headNumber) {
+		return newBlockCompatError("CPU proof-of-work fork block", c.Ethash.CPUPoWBlock, newcfg.Ethash.CPUPoWBlock)
+	}
+	if c.Ethash != nil && newcfg.Ethash != nil && isForkBlockIncompatible(c.Ethash.AuxPoWBlock, newcfg.Ethash.AuxPoWBlock, headNumber) {
+		return newBlockCompatError("AuxPoW fork block", c.Ethash.AuxPoWBlock, newcfg.Ethash.AuxPoWBlock)
+	}
+	if c.Ethash != nil && newcfg.Ethash != nil {
+		if err := c.Ethash.checkDifficultyAlgosCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkDifficultyBombCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkBlockTimeCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkRewardScheduleCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkTreasuryCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkHybridCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkFinalityCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkExtraDataCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkDifficultyRangeCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkEmergencyCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkMedianTimeCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+		if err := c.Ethash.checkMultiAlgoCompatible(newcfg.Ethash, headNumber); err != nil {
+			return err
+		}
+	}
 	if isForkBlockIncompatible(c.MergeNetsplitBlock, newcfg.MergeNetsplitBlock, headNumber) {
 		return newBlockCompatError("Merge netsplit fork block", c.MergeNetsplitBlock, newcfg.MergeNetsplitBlock)
 	}
@@ -22,6 +22,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
 )
 
@@ -92,6 +94,208 @@ func TestCheckCompatible(t *testing.T) {
 				RewindToBlock: 30,
 			},
 		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{DifficultyAlgos: []*DifficultyAlgoConfig{{Block: big.NewInt(10), Algo: DifficultyAlgoLWMA}}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{DifficultyAlgos: []*DifficultyAlgoConfig{{Block: big.NewInt(20), Algo: DifficultyAlgoLWMA}}}},
+			headBlock: 9,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{DifficultyAlgos: []*DifficultyAlgoConfig{{Block: big.NewInt(10), Algo: DifficultyAlgoLWMA}}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{DifficultyAlgos: []*DifficultyAlgoConfig{{Block: big.NewInt(10), Algo: DifficultyAlgoEMA}}}},
+			headBlock: 15,
+			wantErr: &ConfigCompatError{
+				What:          "Difficulty algorithm switch",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{RewardSchedule: []*RewardConfig{{Block: big.NewInt(10), Reward: big.NewInt(1)}}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{RewardSchedule: []*RewardConfig{{Block: big.NewInt(10), Reward: big.NewInt(1), UncleRewardFraction: big.NewRat(1, 2)}}}},
+			headBlock: 15,
+			wantErr: &ConfigCompatError{
+				What:          "Block reward schedule",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{Treasury: &TreasuryConfig{Block: big.NewInt(10), Percent: 5}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{Treasury: &TreasuryConfig{Block: big.NewInt(10), EndBlock: big.NewInt(30), Percent: 5}}},
+			headBlock: 20,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{Treasury: &TreasuryConfig{Block: big.NewInt(10), Percent: 5}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{Treasury: &TreasuryConfig{Block: big.NewInt(10), Percent: 10}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Treasury split",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{AuxPoWBlock: big.NewInt(10)}},
+			new:       &ChainConfig{Ethash: &EthashConfig{AuxPoWBlock: big.NewInt(20)}},
+			headBlock: 15,
+			wantErr: &ConfigCompatError{
+				What:          "AuxPoW fork block",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(20),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{CPUPoWBlock: big.NewInt(10)}},
+			new:       &ChainConfig{Ethash: &EthashConfig{}},
+			headBlock: 15,
+			wantErr: &ConfigCompatError{
+				What:          "CPU proof-of-work fork block",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      nil,
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{ExtraData: &ExtraDataConfig{Block: big.NewInt(10), Prefix: []byte("farm")}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{ExtraData: &ExtraDataConfig{Block: big.NewInt(10), Prefix: []byte("farm"), MaxLength: 32}}},
+			headBlock: 20,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{ExtraData: &ExtraDataConfig{Block: big.NewInt(10), Prefix: []byte("farm")}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{ExtraData: &ExtraDataConfig{Block: big.NewInt(10), Prefix: []byte("farm"), Denied: []hexutil.Bytes{[]byte("bad")}}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Extra-data policy",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{DifficultyRange: &DifficultyRangeConfig{Block: big.NewInt(10), Maximum: big.NewInt(1000)}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{DifficultyRange: &DifficultyRangeConfig{Block: big.NewInt(10), Maximum: big.NewInt(2000)}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Difficulty range",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{Emergency: &EmergencyConfig{Block: big.NewInt(10), Stall: 12}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{Emergency: &EmergencyConfig{Block: big.NewInt(10), Stall: 12, Divisor: 8}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Emergency difficulty adjustment",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{MedianTime: &MedianTimeConfig{Block: big.NewInt(10)}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{MedianTime: &MedianTimeConfig{Block: big.NewInt(10), Window: 21}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Median-time-past window",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{MultiAlgo: &MultiAlgoConfig{Block: big.NewInt(10), Algos: []string{"keccak", "blake2b"}}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{MultiAlgo: &MultiAlgoConfig{Block: big.NewInt(10), Algos: []string{"blake2b", "keccak"}}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Hash algorithm rotation",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{Hybrid: &HybridConfig{Block: big.NewInt(10), Signers: []common.Address{{0x01}}}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{Hybrid: &HybridConfig{Block: big.NewInt(10), Signers: []common.Address{{0x02}}}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Hybrid validator blocks",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(10),
+				RewindToBlock: 9,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{Finality: &FinalityConfig{Interval: 10, Signers: []common.Address{{0x01}}}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{Finality: &FinalityConfig{Interval: 10, Signers: []common.Address{{0x01}}, Quorum: 1}}},
+			headBlock: 20,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{Finality: &FinalityConfig{Interval: 10, Signers: []common.Address{{0x01}}}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{Finality: &FinalityConfig{Interval: 5, Signers: []common.Address{{0x01}}}}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Checkpoint finality",
+				StoredBlock:   big.NewInt(10),
+				NewBlock:      big.NewInt(5),
+				RewindToBlock: 4,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{BlockTime: 10}},
+			new:       &ChainConfig{Ethash: &EthashConfig{BlockTime: 10, BlockTimeBlock: big.NewInt(0)}},
+			headBlock: 20,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{}},
+			new:       &ChainConfig{Ethash: &EthashConfig{BlockTime: 10, BlockTimeBlock: big.NewInt(30)}},
+			headBlock: 20,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{BlockTime: 10}},
+			new:       &ChainConfig{Ethash: &EthashConfig{BlockTime: 5}},
+			headBlock: 20,
+			wantErr: &ConfigCompatError{
+				What:          "Targeted block time",
+				StoredBlock:   big.NewInt(0),
+				NewBlock:      big.NewInt(0),
+				RewindToBlock: 0,
+			},
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{}},
+			new:       &ChainConfig{Ethash: &EthashConfig{DifficultyBomb: &DifficultyBombConfig{Period: 100000}}},
+			headBlock: 300000,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{DifficultyBomb: &DifficultyBombConfig{Delay: 1000000}}},
+			new:       &ChainConfig{Ethash: &EthashConfig{DifficultyBomb: &DifficultyBombConfig{Disabled: true}}},
+			headBlock: 1100000,
+			wantErr:   nil,
+		},
+		{
+			stored:    &ChainConfig{Ethash: &EthashConfig{}},
+			new:       &ChainConfig{Ethash: &EthashConfig{DifficultyBomb: &DifficultyBombConfig{Disabled: true}}},
+			headBlock: 300000,
+			wantErr: &ConfigCompatError{
+				What:          "Difficulty bomb",
+				StoredBlock:   big.NewInt(200000),
+				NewBlock:      nil,
+				RewindToBlock: 199999,
+			},
+		},
 		{
 			stored:        &ChainConfig{ShanghaiTime: newUint64(10)},
 			new:           &ChainConfig{ShanghaiTime: newUint64(20)},
@@ -455,8 +455,10 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
+	activeRequestGauge.Inc(1)
 	start := time.Now()
 	answer := h.runMethod(cp.ctx, msg, callb, args)
+	activeRequestGauge.Dec(1)
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
 	if callb != h.unsubscribeCb {
@@ -27,6 +27,7 @@ var (
 	rpcRequestGauge        = metrics.NewRegisteredGauge("rpc/requests", nil)
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedRequestGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
+	activeRequestGauge     = metrics.NewRegisteredGauge("rpc/active", nil)
 
 	// serveTimeHistName is the prefix of the per-request serving time histograms.
 	serveTimeHistName = "rpc/duration"